@@ -0,0 +1,281 @@
+// Command clientgen generates the typed clients of the grpc api of a service
+// created from the template, for the services consuming the api. The clients
+// wrap the stubs generated by protoc-gen-go-grpc with the conventions of the
+// template: the retries, the forwarding of the trace context and the decoding
+// of the errors of the framework, see pkg/client.
+//
+// Usage, from the package of the clients, usually with go:generate:
+//
+//	clientgen [-pb ../api/v1] [-out .] [-idempotent '^(Get|List)']
+//
+// Every service of the *_grpc.pb.go files of the pb directory gets a client,
+// written to a file named after the service, e.g. the VenuesService gets the
+// VenuesClient in venues.go. The generated files are overwritten, thus
+// regenerate them whenever the api changes. Streaming methods are skipped.
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+func main() {
+	pb := flag.String("pb", "../api/v1", "the directory of the generated grpc stubs")
+	out := flag.String("out", ".", "the directory of the generated clients")
+	idempotent := flag.String("idempotent", "^(Get|List)",
+		"the regexp matching the names of the idempotent methods, which are retried on timeouts")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	re, err := regexp.Compile(*idempotent)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "clientgen: invalid -idempotent:", err)
+		os.Exit(2)
+	}
+	files, err := generate(*pb, *out, re)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "clientgen:", err)
+		os.Exit(1)
+	}
+	for _, f := range files {
+		fmt.Println("generated", f)
+	}
+}
+
+// generate writes the clients of the services of the stubs in pb to out, and
+// returns the paths of the written files.
+func generate(pb, out string, idempotent *regexp.Regexp) ([]string, error) {
+	importPath, err := importPathOf(pb)
+	if err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(pb, "*_grpc.pb.go"))
+	if err != nil {
+		return nil, err //nolint:wrapcheck // the pattern is valid
+	}
+	if len(paths) == 0 {
+		return nil, fmt.Errorf("no grpc stubs in %s, see protoc-gen-go-grpc", pb)
+	}
+	sort.Strings(paths)
+
+	var written []string
+	for _, p := range paths {
+		services, err := parseStubs(p, importPath, idempotent)
+		if err != nil {
+			return written, err
+		}
+		for _, s := range services {
+			path := filepath.Join(out, snake(s.Name)+".go")
+			if err := render(path, s); err != nil {
+				return written, err
+			}
+			written = append(written, path)
+		}
+	}
+	return written, nil
+}
+
+// parseStubs returns the services of the grpc stubs in the file.
+func parseStubs(path, importPath string, idempotent *regexp.Regexp) ([]service, error) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, path, nil, parser.ParseComments)
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", path, err)
+	}
+
+	var services []service
+	for _, decl := range f.Decls {
+		gen, ok := decl.(*ast.GenDecl)
+		if !ok || gen.Tok != token.TYPE {
+			continue
+		}
+		for _, spec := range gen.Specs {
+			ts := spec.(*ast.TypeSpec) //nolint:forcetypeassert // type declarations hold type specs
+			iface, ok := ts.Type.(*ast.InterfaceType)
+			stub, isClient := strings.CutSuffix(ts.Name.Name, "Client")
+			if !ok || !isClient || !ts.Name.IsExported() || strings.Contains(stub, "_") {
+				continue // e.g. the stream clients, VenuesService_WatchClient
+			}
+			s := service{
+				Name:       strings.TrimSuffix(stub, "Service"),
+				Stub:       ts.Name.Name,
+				GRPCName:   stub,
+				PB:         importPath,
+				PBAlias:    f.Name.Name,
+				SourceFile: filepath.Base(path),
+			}
+			for _, m := range iface.Methods.List {
+				if method, ok := unaryMethod(m, f.Name.Name); ok {
+					method.Idempotent = idempotent.MatchString(method.Name)
+					s.Methods = append(s.Methods, method)
+				}
+			}
+			if len(s.Methods) > 0 {
+				services = append(services, s)
+			}
+		}
+	}
+	return services, nil
+}
+
+// unaryMethod returns the method of the field of a client interface, if it is
+// a unary method, i.e. M(ctx, *Req, ...grpc.CallOption) (*Resp, error).
+func unaryMethod(field *ast.Field, pbAlias string) (method, bool) {
+	fn, ok := field.Type.(*ast.FuncType)
+	if !ok || len(field.Names) != 1 || fn.Params.NumFields() != 3 || fn.Results.NumFields() != 2 {
+		return method{}, false
+	}
+	req, ok := fn.Params.List[1].Type.(*ast.StarExpr)
+	if !ok {
+		return method{}, false
+	}
+	resp, ok := fn.Results.List[0].Type.(*ast.StarExpr)
+	if !ok {
+		return method{}, false // a stream
+	}
+	m := method{
+		Name: field.Names[0].Name,
+		Req:  qualify(req.X, pbAlias),
+		Resp: qualify(resp.X, pbAlias),
+	}
+	if field.Doc != nil {
+		m.Doc = strings.Split(strings.TrimSpace(field.Doc.Text()), "\n")
+	}
+	return m, true
+}
+
+// qualify returns the type as referred to from the package of the clients,
+// e.g. apiv1.Venue for Venue, or emptypb.Empty as is.
+func qualify(expr ast.Expr, pbAlias string) string {
+	switch x := expr.(type) {
+	case *ast.Ident:
+		return pbAlias + "." + x.Name
+	case *ast.SelectorExpr:
+		return fmt.Sprintf("%s.%s", x.X, x.Sel.Name)
+	default:
+		return fmt.Sprintf("%s", x)
+	}
+}
+
+// importPathOf returns the import path of the package in dir, from the module
+// that contains it.
+func importPathOf(dir string) (string, error) {
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return "", err //nolint:wrapcheck // the working directory is gone
+	}
+	for root := abs; ; root = filepath.Dir(root) {
+		b, err := os.ReadFile(filepath.Join(root, "go.mod"))
+		if err == nil {
+			module, err := modulePath(b)
+			if err != nil {
+				return "", err
+			}
+			rel, err := filepath.Rel(root, abs)
+			if err != nil {
+				return "", err //nolint:wrapcheck // both paths are absolute
+			}
+			return strings.TrimSuffix(module+"/"+filepath.ToSlash(rel), "/."), nil
+		}
+		if root == filepath.Dir(root) {
+			return "", fmt.Errorf("%s is not inside a go module", dir)
+		}
+	}
+}
+
+// modulePath returns the module path of the go.mod file.
+func modulePath(gomod []byte) (string, error) {
+	for _, line := range strings.Split(string(gomod), "\n") {
+		if p, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(p), `"`), nil
+		}
+	}
+	return "", errors.New("go.mod has no module path")
+}
+
+// render executes the template of the client and writes the formatted source
+// to the path.
+func render(path string, s service) error {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, "client.go.tmpl", s); err != nil {
+		return fmt.Errorf("execute the template of %s: %w", s.Name, err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format %s: %w", path, err)
+	}
+	return os.WriteFile(path, src, 0o644) //nolint:gosec // source files are world readable
+}
+
+// service is the input of the template, a grpc service.
+type service struct {
+	Name     string // e.g. Venues
+	Stub     string // e.g. VenuesServiceClient
+	GRPCName string // e.g. VenuesService
+
+	// PB and PBAlias are the import path and the name of the package of
+	// the stubs, and SourceFile is the file declaring them.
+	PB         string
+	PBAlias    string
+	SourceFile string
+
+	Methods []method
+}
+
+// method is a unary method of a grpc service.
+type method struct {
+	Name       string   // e.g. GetVenue
+	Req, Resp  string   // e.g. apiv1.GetVenueRequest
+	Doc        []string // the lines of the doc comment of the stub
+	Idempotent bool
+}
+
+// snake converts the name to snake case, e.g. "TicketTypes" becomes
+// "ticket_types".
+func snake(name string) string {
+	var b strings.Builder
+	r := []rune(name)
+	for i, c := range r {
+		if unicode.IsUpper(c) && i > 0 &&
+			(unicode.IsLower(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// usage is the usage of the command.
+const usage = `Usage: clientgen [flags]
+
+Generates the clients of the grpc services of the stubs in the -pb directory.
+
+Flags:
+`
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// templates are the templates of the generated files.
+var templates = template.Must(template.New("").ParseFS(templateFS, "templates/*.tmpl"))
@@ -0,0 +1,380 @@
+// Command newservice creates a new service from the template in one step. It
+// copies the template with gonew, which rewrites the import paths of the go
+// files, and then rewrites what gonew leaves behind:
+//
+//   - the module path in the other files, e.g. the proto and the docs,
+//   - the ServiceName type and the <service-name> placeholders,
+//   - the prefix of the environment variables of the service, see envPrefix,
+//   - the ports of the servers in the Dockerfile and the docs,
+//
+// and prunes the components that the service does not need, see -no-grpc,
+// -no-bus and -no-venues. Finally the dependencies are tidied and vendored,
+// and the service is built. The copy does not include newservice itself.
+//
+// Usage:
+//
+//	newservice [flags] <module> [dir]
+//
+// e.g.
+//
+//	newservice -env-prefix VENUES_ -no-bus github.com/eventscompass/venues-service
+//
+// The directory defaults to the last element of the module path. With
+// -skip-gonew the directory must hold a copy of the template already, e.g. one
+// created with gonew by hand.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// options are the command line options of newservice.
+type options struct {
+	template  string
+	module    string
+	dir       string
+	name      string
+	typeName  string
+	envPrefix string
+	httpPort  int
+	grpcPort  int
+	adminPort int
+	skipGonew bool
+	prune     map[string]bool // by component name
+}
+
+func main() {
+	var o options
+	flag.StringVar(&o.template, "template", templateModule,
+		"the module path of the template, with an optional @version")
+	flag.StringVar(&o.name, "name", "",
+		"the name of the service, e.g. in the docker image; defaults to the last element of the module")
+	flag.StringVar(&o.typeName, "type", "",
+		"the name of the go type of the service; defaults to the camel cased name")
+	flag.StringVar(&o.envPrefix, "env-prefix", "",
+		"the prefix of the environment variables of the service, e.g. VENUES_")
+	flag.IntVar(&o.httpPort, "http-port", defaultHTTPPort, "the port of the rest server")
+	flag.IntVar(&o.grpcPort, "grpc-port", defaultGRPCPort, "the port of the grpc server")
+	flag.IntVar(&o.adminPort, "admin-port", defaultAdminPort, "the port of the admin server")
+	flag.BoolVar(&o.skipGonew, "skip-gonew", false,
+		"rewrite an existing copy of the template instead of running gonew")
+	o.prune = make(map[string]bool)
+	for _, c := range components {
+		c := c
+		flag.BoolFunc("no-"+c.name, c.summary, func(string) error {
+			o.prune[c.name] = true
+			return nil
+		})
+	}
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if flag.NArg() < 1 || flag.NArg() > 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	o.module, o.dir = flag.Arg(0), flag.Arg(1)
+	if err := run(o); err != nil {
+		fmt.Fprintln(os.Stderr, "newservice:", err)
+		os.Exit(1)
+	}
+}
+
+// run creates the service described by the options.
+func run(o options) error {
+	if err := o.complete(); err != nil {
+		return err
+	}
+	if o.skipGonew {
+		if _, err := os.Stat(filepath.Join(o.dir, "go.mod")); err != nil {
+			return fmt.Errorf("no copy of the template in %s: %w", o.dir, err)
+		}
+	} else if err := command(".", "gonew", o.template, o.module, o.dir); err != nil {
+		return fmt.Errorf("%w; install gonew with: go install golang.org/x/tools/cmd/gonew@latest", err)
+	}
+
+	// The service does not need the tool creating services from the template.
+	if err := os.RemoveAll(filepath.Join(o.dir, "cmd", "newservice")); err != nil {
+		return err
+	}
+	from, _, _ := strings.Cut(o.template, "@")
+	if err := rewriteAll(o.dir, strings.NewReplacer(
+		from, o.module,
+		"<service-name>", o.name,
+	)); err != nil {
+		return err
+	}
+	for _, c := range components {
+		if o.prune[c.name] {
+			if err := c.prune(o.dir, o.module); err != nil {
+				return fmt.Errorf("prune %s: %w", c.name, err)
+			}
+			fmt.Println("pruned", c.name)
+		}
+	}
+	if err := renameType(o.dir, o.typeName); err != nil {
+		return err
+	}
+	if err := configure(o); err != nil {
+		return err
+	}
+
+	for _, args := range [][]string{
+		{"gofmt", "-w", "src", "cmd"},
+		{"go", "mod", "tidy"},
+		{"go", "mod", "vendor"},
+		{"go", "build", "./..."},
+	} {
+		if err := command(o.dir, args[0], args[1:]...); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("\nCreated %s in %s.\n\nNext steps:\n", o.module, o.dir)
+	for _, s := range nextSteps(o) {
+		fmt.Println("  -", s)
+	}
+	return nil
+}
+
+// complete validates the options and sets the defaults.
+func (o *options) complete() error {
+	if !modulePathRe.MatchString(o.module) {
+		return fmt.Errorf("invalid module path %q, e.g. github.com/eventscompass/venues-service",
+			o.module)
+	}
+	if o.dir == "" {
+		o.dir = path.Base(o.module)
+	}
+	if o.name == "" {
+		o.name = path.Base(o.module)
+	}
+	if !nameRe.MatchString(o.name) {
+		return fmt.Errorf("invalid name %q, use lower case letters, digits and dashes", o.name)
+	}
+	if o.typeName == "" {
+		o.typeName = camelCase(o.name)
+	}
+	if !typeNameRe.MatchString(o.typeName) {
+		return fmt.Errorf("invalid type name %q, must be an exported go identifier", o.typeName)
+	}
+	if o.envPrefix != "" && !strings.HasSuffix(o.envPrefix, "_") {
+		o.envPrefix += "_"
+	}
+	if o.envPrefix != "" && !envPrefixRe.MatchString(o.envPrefix) {
+		return fmt.Errorf("invalid environment prefix %q, use upper case letters, digits and underscores",
+			o.envPrefix)
+	}
+	for _, p := range []int{o.httpPort, o.grpcPort, o.adminPort} {
+		if p <= 0 || p > 65535 {
+			return fmt.Errorf("invalid port %d", p)
+		}
+	}
+	return nil
+}
+
+// rewriteAll applies the replacer to the text files of the service. The
+// vendored dependencies and the git metadata are left alone.
+func rewriteAll(dir string, r *strings.Replacer) error {
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "vendor" || name == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil || bytes.IndexByte(data, 0) >= 0 { // binary files
+			return err
+		}
+		if updated := r.Replace(string(data)); updated != string(data) {
+			return os.WriteFile(p, []byte(updated), d.Type().Perm()|0o600)
+		}
+		return nil
+	})
+}
+
+// renameType renames the ServiceName type of the template in the go files, the
+// templates of svcgen and the docs.
+func renameType(dir, typeName string) error {
+	re := regexp.MustCompile(`\bServiceName\b`)
+	return filepath.WalkDir(dir, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			if name := d.Name(); name == "vendor" || name == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		// The generated code may use the name otherwise, e.g. the
+		// service descriptors of grpc.
+		ext := filepath.Ext(p)
+		if (ext != ".go" && ext != ".md" && ext != ".tmpl") || strings.HasSuffix(p, ".pb.go") {
+			return nil
+		}
+		data, err := os.ReadFile(p)
+		if err != nil {
+			return err
+		}
+		if updated := re.ReplaceAll(data, []byte(typeName)); !bytes.Equal(updated, data) {
+			return os.WriteFile(p, updated, d.Type().Perm()|0o600)
+		}
+		return nil
+	})
+}
+
+// configure sets the environment prefix and the ports of the service.
+func configure(o options) error {
+	if o.envPrefix != "" {
+		if err := replaceIn(o.dir, "src/config.go", `const envPrefix = ""`,
+			"const envPrefix = "+strconv.Quote(o.envPrefix)); err != nil {
+			return err
+		}
+		if err := replaceIn(o.dir, "src/internal/servicetest/servicetest.go", `var EnvPrefix = ""`,
+			"var EnvPrefix = "+strconv.Quote(o.envPrefix)); err != nil {
+			return err
+		}
+	}
+	ports := []struct {
+		from, to int
+		files    []string
+	}{
+		{defaultHTTPPort, o.httpPort, []string{"Dockerfile", "README.md"}},
+		{defaultGRPCPort, o.grpcPort, []string{"Dockerfile", "README.md"}},
+		{defaultAdminPort, o.adminPort, []string{"src/internal/admin/admin.go"}},
+	}
+	for _, p := range ports {
+		if p.from == p.to {
+			continue
+		}
+		from, to := ":"+strconv.Itoa(p.from), ":"+strconv.Itoa(p.to)
+		r := strings.NewReplacer(from, to, strconv.Itoa(p.from)+"/tcp", strconv.Itoa(p.to)+"/tcp",
+			"port "+strconv.Itoa(p.from), "port "+strconv.Itoa(p.to))
+		for _, f := range p.files {
+			if err := rewriteFile(filepath.Join(o.dir, f), r); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// rewriteFile applies the replacer to the file, if it exists.
+func rewriteFile(p string, r *strings.Replacer) error {
+	data, err := os.ReadFile(p)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(r.Replace(string(data))), 0o600)
+}
+
+// replaceIn replaces the text in the file of the service. It fails if the
+// text is missing, i.e. the template changed and newservice has to follow.
+func replaceIn(dir, file, old, updated string) error {
+	p := filepath.Join(dir, file)
+	data, err := os.ReadFile(p)
+	if err != nil {
+		return err
+	}
+	if !bytes.Contains(data, []byte(old)) {
+		return fmt.Errorf("%s: the template changed, %q not found", file, old)
+	}
+	return os.WriteFile(p, bytes.Replace(data, []byte(old), []byte(updated), 1), 0o600)
+}
+
+// command runs the command in the directory, with the output of newservice.
+func command(dir, name string, args ...string) error {
+	cmd := exec.Command(name, args...)
+	cmd.Dir, cmd.Stdout, cmd.Stderr = dir, os.Stdout, os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("%s %s: %w", name, strings.Join(args, " "), err)
+	}
+	return nil
+}
+
+// nextSteps returns the manual steps left after creating the service.
+func nextSteps(o options) []string {
+	steps := []string{
+		"regenerate the protobuf code, so that it carries the new module path: go generate ./pkg/...",
+		"replace the example events of pkg/events/v1 with the events of the service",
+	}
+	if !o.prune["venues"] {
+		steps = append(steps,
+			"start the modules of the service as copies of src/internal/venues, then delete the venues")
+	} else {
+		steps = append(steps,
+			"remove the venue events of pkg/events/v1 and the reference module from the README")
+	}
+	return append(steps,
+		"set up the CI/CD pipelines, see the README",
+		"commit the service: git init && git add -A && git commit -m 'Create the service'",
+	)
+}
+
+// camelCase converts the dashed name to an exported go identifier, e.g.
+// "venues-service" to "VenuesService".
+func camelCase(name string) string {
+	var b strings.Builder
+	for _, part := range strings.FieldsFunc(name, func(r rune) bool { return r == '-' || r == '_' }) {
+		rs := []rune(part)
+		rs[0] = unicode.ToUpper(rs[0])
+		b.WriteString(string(rs))
+	}
+	return b.String()
+}
+
+const usage = `Usage: newservice [flags] <module> [dir]
+
+Creates a new service from the template, e.g.
+
+	newservice -env-prefix VENUES_ -no-bus github.com/eventscompass/venues-service
+
+Flags:
+`
+
+const (
+	// templateModule is the module path of the template.
+	templateModule = "github.com/eventscompass/service-template"
+
+	// The ports of the servers of the template.
+	defaultHTTPPort  = 8080
+	defaultGRPCPort  = 8081
+	defaultAdminPort = 10070
+)
+
+var (
+	// modulePathRe matches the module paths, loosely.
+	modulePathRe = regexp.MustCompile(`^[a-z0-9.-]+(/[A-Za-z0-9._~-]+)+$`)
+
+	// nameRe matches the names of the services.
+	nameRe = regexp.MustCompile(`^[a-z][a-z0-9-]*$`)
+
+	// typeNameRe matches exported go identifiers.
+	typeNameRe = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+	// envPrefixRe matches the prefixes of the environment variables.
+	envPrefixRe = regexp.MustCompile(`^[A-Z][A-Z0-9_]*_$`)
+)
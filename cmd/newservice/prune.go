@@ -0,0 +1,217 @@
+package main
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// component is a part of the template that a service can leave out.
+type component struct {
+	name    string
+	summary string
+
+	// remove are the files and directories of the component.
+	remove []string
+
+	// edits unwire the component from the remaining files. The
+	// edits of removed files are skipped.
+	edits []edit
+
+	// write are the files rewritten with the given contents, e.g.
+	// the tests of the component.
+	write map[string]string
+}
+
+// edit replaces a snippet of a file. The snippets spell out the imports with
+// the module path of the template, which is replaced by the module path of
+// the service.
+type edit struct {
+	file, old, new string
+}
+
+// prune removes the component from the service in dir.
+func (c component) prune(dir, module string) error {
+	for _, p := range c.remove {
+		if err := os.RemoveAll(filepath.Join(dir, p)); err != nil {
+			return err
+		}
+	}
+	for _, e := range c.edits {
+		_, err := os.Stat(filepath.Join(dir, e.file))
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		old := strings.ReplaceAll(e.old, templateModule, module)
+		updated := strings.ReplaceAll(e.new, templateModule, module)
+		if err := replaceIn(dir, e.file, old, updated); err != nil {
+			return err
+		}
+	}
+	for file, data := range c.write {
+		if err := os.WriteFile(filepath.Join(dir, file), []byte(data), 0o600); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// components are the components that can be pruned, in the order they are
+// pruned. Keep the snippets in sync with the template.
+var components = []component{
+	{
+		name:    "venues",
+		summary: "leave out the venues, the reference module",
+		remove: []string{
+			"src/internal/venues",
+			"src/venues.go",
+			"migrations/0001_create_venues.sql",
+			"pkg/api",
+			"pkg/client/venues.go",
+		},
+		edits: []edit{
+			{"src/main.go", "\tif err := s.initVenues(ctx); err != nil {\n\t\treturn err\n\t}\n", ""},
+			{"src/rest.go", "// api of the venues, see initVenues.", "// api of the service."},
+			{
+				"src/grpc.go",
+				"// server of the venues api, see initVenues, or nil if no api is registered\n// on it.",
+				"// server of the service, or nil if no api is registered on it.",
+			},
+		},
+		write: map[string]string{
+			"src/rest_test.go": "package main_test\n\n" +
+				"// This file should contain integration tests for the rest api of the service.\n",
+			"src/grpc_test.go": "package main_test\n\n" +
+				"// This file should contain integration tests for the grpc api of the service.\n",
+		},
+	},
+	{
+		name:    "grpc",
+		summary: "leave out the grpc server",
+		remove: []string{
+			"src/grpc.go",
+			"src/grpc_test.go",
+			"src/internal/venues/grpc.go",
+			"pkg/api",
+			"pkg/client/grpc.go",
+			"pkg/client/generate.go",
+			"pkg/client/venues.go",
+			"cmd/clientgen",
+		},
+		edits: []edit{
+			{"src/main.go", "\t\"google.golang.org/grpc\"\n", ""},
+			{
+				"src/main.go",
+				"\t// rest and grpc are the servers returned by REST and GRPC. The\n" +
+					"\t// apis of the service are registered on grpc on Init.\n" +
+					"\trest http.Handler\n\tgrpc *grpc.Server\n",
+				"\t// rest is the server returned by REST.\n\trest http.Handler\n",
+			},
+			{
+				"src/main.go",
+				"\tgrpcServer, err := newGRPCServer(s.cfg.GRPCTLS, s.clientIP)\n" +
+					"\tif err != nil {\n" +
+					"\t\treturn fmt.Errorf(\"init grpc server: %w\", err)\n" +
+					"\t}\n" +
+					"\ts.grpc = grpcServer\n",
+				"",
+			},
+			{"src/config.go", "\t\"" + templateModule + "/src/internal/tlsconfig\"\n", ""},
+			{
+				"src/config.go",
+				"\n\t// GRPCTLS is the tls configuration of the grpc server, e.g.\n" +
+					"\t// GRPC_TLS_CERT_FILE. The server serves plaintext without it.\n" +
+					"\tGRPCTLS tlsconfig.Config `envPrefix:\"GRPC_\"`\n",
+				"",
+			},
+			{"src/validate.go", "\t\"" + templateModule + "/src/internal/tlsconfig\"\n", ""},
+			{
+				"src/validate.go",
+				"\t\t{\"grpc tls\", func(context.Context) error {\n" +
+					"\t\t\tif s.cfg.GRPCTLS == (tlsconfig.Config{}) {\n" +
+					"\t\t\t\treturn errSkipped\n" +
+					"\t\t\t}\n" +
+					"\t\t\t_, err := tlsconfig.Server(s.cfg.GRPCTLS)\n" +
+					"\t\t\treturn err //nolint:wrapcheck // reported as is\n" +
+					"\t\t}},\n",
+				"",
+			},
+			{"src/venues.go", "\tapiv1 \"" + templateModule + "/pkg/api/v1\"\n", ""},
+			{"src/venues.go", "// rest and grpc servers of the service.", "// rest server of the service."},
+			{
+				"src/venues.go",
+				"\tapiv1.RegisterVenuesServiceServer(s.grpc, venues.NewGRPCServer(svc, s.cfg.Page))\n",
+				"",
+			},
+			{
+				"src/internal/venues/venues.go",
+				"//   - [Handler] serves the rest api, and [GRPCServer] the grpc api; both are\n" +
+					"//     thin adapters over the [Service].\n",
+				"//   - [Handler] serves the rest api, a thin adapter over the [Service].\n",
+			},
+			{
+				"src/internal/venues/venues.go",
+				"//\tapiv1.RegisterVenuesServiceServer(srv, venues.NewGRPCServer(svc, s.cfg.Page))\n",
+				"",
+			},
+			{"Dockerfile", "EXPOSE 8081/tcp\n", ""},
+			{"Dockerfile", "ENV GRPC_SERVER_LISTEN=:8081\n", ""},
+			{
+				"Dockerfile",
+				"# The REST server listens on port 8080, and the gRPC - on 8081.",
+				"# The REST server listens on port 8080.",
+			},
+		},
+	},
+	{
+		name:    "bus",
+		summary: "leave out the RabbitMQ message bus",
+		remove:  []string{"src/internal/rabbitmq"},
+		edits: []edit{
+			{"src/main.go", "\t\"" + templateModule + "/src/internal/rabbitmq\"\n", ""},
+			{
+				"src/main.go",
+				"\tif s.bus == nil && s.cfg.Bus.URL != \"\" {\n" +
+					"\t\tbus, err := rabbitmq.Dial(ctx, s.cfg.Bus)\n" +
+					"\t\tif err != nil {\n" +
+					"\t\t\treturn fmt.Errorf(\"init message bus: %w\", err)\n" +
+					"\t\t}\n" +
+					"\t\ts.bus = chaos.Bus(bus)\n" +
+					"\t\tif s.cfg.Bus.Buffer.Size > 0 {\n" +
+					"\t\t\ts.bus = rabbitmq.NewBuffered(s.bus, s.cfg.Bus.Buffer)\n" +
+					"\t\t}\n" +
+					"\t}\n",
+				"",
+			},
+			{"src/config.go", "\t\"" + templateModule + "/src/internal/rabbitmq\"\n", ""},
+			{"src/validate.go", "\t\"" + templateModule + "/src/internal/rabbitmq\"\n", ""},
+			{
+				"src/validate.go",
+				"\t\t{\"message bus\", func(ctx context.Context) error {\n" +
+					"\t\t\tif s.cfg.Bus.URL == \"\" {\n" +
+					"\t\t\t\treturn errSkipped\n" +
+					"\t\t\t}\n" +
+					"\t\t\tif err := s.cfg.Bus.Validate(); err != nil || !probe {\n" +
+					"\t\t\t\treturn err //nolint:wrapcheck // reported as is\n" +
+					"\t\t\t}\n" +
+					"\t\t\tbus, err := rabbitmq.Dial(ctx, s.cfg.Bus)\n" +
+					"\t\t\tif err != nil {\n" +
+					"\t\t\t\treturn err //nolint:wrapcheck // reported as is\n" +
+					"\t\t\t}\n" +
+					"\t\t\treturn bus.Close() //nolint:wrapcheck // reported as is\n" +
+					"\t\t}},\n",
+				"",
+			},
+			{"src/config.go", "\tBus       rabbitmq.Config\n", ""},
+			{
+				"src/events.go",
+				"// Bus implements the [service.CloudService] interface. It returns the\n" +
+					"// RabbitMQ message bus of the service, or nil if MESSAGE_BUS_URL is not set.\n",
+				"// Bus implements the [service.CloudService] interface. The service does not\n" +
+					"// use a message bus, thus it returns nil.\n",
+			},
+		},
+	},
+}
@@ -0,0 +1,251 @@
+// Command svcgen scaffolds the endpoints and the event handlers of a service
+// created from the template, so that they follow the conventions of the
+// template: request types that validate themselves, business logic returning
+// the errors of the framework, which the handlers map to the status codes of
+// the api, and tests for the validation and the error mapping.
+//
+// Usage, from the root of the service:
+//
+//	svcgen rest <Name> <METHOD> <path>   e.g. svcgen rest CreateVenue POST /venues
+//	svcgen grpc <Name>                   e.g. svcgen grpc GetVenue
+//	svcgen event <Name>                  e.g. svcgen event VenueCreated
+//
+// The files are written to src/, named after the kind and the name, e.g.
+// src/rest_create_venue.go, and are never overwritten. svcgen prints the
+// remaining manual steps, e.g. routing the new handler.
+package main
+
+import (
+	"bytes"
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"go/format"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+	"unicode"
+)
+
+func main() {
+	dir := flag.String("dir", "src", "the directory of the service sources")
+	pb := flag.String("pb", "", "the import path of the generated grpc package, "+
+		"defaults to <module>/pkg/api/v1")
+	flag.Usage = func() {
+		fmt.Fprint(flag.CommandLine.Output(), usage)
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	files, steps, err := generate(*dir, *pb, flag.Args())
+	if errors.Is(err, errUsage) {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "svcgen:", err)
+		os.Exit(1)
+	}
+	for _, f := range files {
+		fmt.Println("created", f)
+	}
+	fmt.Println("\nNext steps:")
+	for _, s := range steps {
+		fmt.Println("  -", s)
+	}
+}
+
+// generate writes the files of the scaffold described by the arguments, and
+// returns their paths and the remaining manual steps.
+func generate(dir, pb string, args []string) ([]string, []string, error) {
+	if len(args) < 2 {
+		return nil, nil, errUsage
+	}
+	kind, name := args[0], args[1]
+	if !identRe.MatchString(name) {
+		return nil, nil, fmt.Errorf("name %q must be an exported go identifier, e.g. CreateVenue", name)
+	}
+	module, err := modulePath()
+	if err != nil {
+		return nil, nil, err
+	}
+	d := data{Name: name, Lower: lowerFirst(name), Snake: snake(name), Module: module}
+
+	var steps []string
+	switch kind {
+	case "rest":
+		if len(args) != 4 {
+			return nil, nil, errUsage
+		}
+		d.Method, d.Path = strings.ToUpper(args[2]), args[3]
+		if !strings.HasPrefix(d.Path, "/") {
+			return nil, nil, fmt.Errorf("path %q must start with /", d.Path)
+		}
+		steps = []string{
+			fmt.Sprintf("route %s %s to s.handle%s in the rest handler, see src/rest.go",
+				d.Method, d.Path, name),
+			fmt.Sprintf("implement s.%s", d.Lower),
+		}
+	case "grpc":
+		if len(args) != 2 {
+			return nil, nil, errUsage
+		}
+		if pb == "" {
+			pb = module + "/pkg/api/v1"
+		}
+		d.PB, d.PBAlias = pb, filepath.Base(filepath.Dir(pb))+filepath.Base(pb)
+		steps = []string{
+			fmt.Sprintf("add rpc %s(%sRequest) returns (%sResponse) to the proto of the api "+
+				"and regenerate %s", name, name, name, pb),
+			fmt.Sprintf("implement s.%s", d.Lower),
+		}
+	case "event":
+		if len(args) != 2 {
+			return nil, nil, errUsage
+		}
+		d.PB = module + "/pkg/events/v1"
+		steps = []string{
+			fmt.Sprintf("add the %s message to pkg/events/v1/events.proto and regenerate it", name),
+			fmt.Sprintf("define events.%s in src/internal/events/catalog.go", name),
+			fmt.Sprintf("return events.%s.Handler(s.on%s) from the Events method, "+
+				"see events.Handlers", name, name),
+		}
+	default:
+		return nil, nil, errUsage
+	}
+
+	outputs := []output{
+		{kind + ".go.tmpl", filepath.Join(dir, kind+"_"+d.Snake+".go")},
+		{kind + "_test.go.tmpl", filepath.Join(dir, kind+"_"+d.Snake+"_test.go")},
+	}
+	for _, o := range outputs {
+		if _, err := os.Stat(o.path); err == nil {
+			return nil, nil, fmt.Errorf("%s already exists", o.path)
+		}
+	}
+	// The error mapping is shared by the grpc methods.
+	if errPath := filepath.Join(dir, "grpc_errors.go"); kind == "grpc" {
+		if _, err := os.Stat(errPath); err != nil {
+			outputs = append(outputs, output{"grpc_errors.go.tmpl", errPath})
+		}
+	}
+
+	var created []string
+	for _, o := range outputs {
+		if err := render(o.tmpl, o.path, d); err != nil {
+			return created, nil, err
+		}
+		created = append(created, o.path)
+	}
+	return created, steps, nil
+}
+
+// render executes the template and writes the formatted source to the path.
+func render(tmpl, path string, d data) error {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, tmpl, d); err != nil {
+		return fmt.Errorf("execute %s: %w", tmpl, err)
+	}
+	src, err := format.Source(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("format %s: %w", path, err)
+	}
+	return os.WriteFile(path, src, 0o644) //nolint:gosec // source files are world readable
+}
+
+// modulePath returns the path of the module in the working directory.
+func modulePath() (string, error) {
+	b, err := os.ReadFile("go.mod")
+	if err != nil {
+		return "", fmt.Errorf("run svcgen from the root of the service: %w", err)
+	}
+	for _, line := range strings.Split(string(b), "\n") {
+		if p, ok := strings.CutPrefix(strings.TrimSpace(line), "module "); ok {
+			return strings.Trim(strings.TrimSpace(p), `"`), nil
+		}
+	}
+	return "", errors.New("go.mod has no module path")
+}
+
+// data is the input of the templates.
+type data struct {
+	Name  string // e.g. CreateVenue
+	Lower string // e.g. createVenue
+	Snake string // e.g. create_venue
+
+	// Module is the module path of the service.
+	Module string
+
+	// Method and Path are the route of a rest endpoint.
+	Method string
+	Path   string
+
+	// PB and PBAlias are the import path and the name of the generated
+	// protobuf package.
+	PB      string
+	PBAlias string
+}
+
+// output is a file generated from a template.
+type output struct {
+	tmpl string
+	path string
+}
+
+// lowerFirst lowers the first letter, or the leading initialism, of the
+// name, e.g. "HTTPStatus" becomes "httpStatus".
+func lowerFirst(name string) string {
+	r := []rune(name)
+	for i := 0; i < len(r) && unicode.IsUpper(r[i]); i++ {
+		if i > 0 && i+1 < len(r) && unicode.IsLower(r[i+1]) {
+			break
+		}
+		r[i] = unicode.ToLower(r[i])
+	}
+	return string(r)
+}
+
+// snake converts the name to snake case, e.g. "GetHTTPStatus" becomes
+// "get_http_status".
+func snake(name string) string {
+	var b strings.Builder
+	r := []rune(name)
+	for i, c := range r {
+		if unicode.IsUpper(c) && i > 0 &&
+			(unicode.IsLower(r[i-1]) || (i+1 < len(r) && unicode.IsLower(r[i+1]))) {
+			b.WriteByte('_')
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	return b.String()
+}
+
+// usage is the usage of the command.
+const usage = `Usage: svcgen [flags] <kind> <Name> [arguments]
+
+Kinds:
+  rest <Name> <METHOD> <path>   a rest endpoint, e.g. rest CreateVenue POST /venues
+  grpc <Name>                   a grpc method, e.g. grpc GetVenue
+  event <Name>                  an event subscription, e.g. event VenueCreated
+
+Flags:
+`
+
+// errUsage is returned for invalid arguments.
+var errUsage = errors.New("invalid arguments")
+
+// identRe matches exported go identifiers.
+var identRe = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// templates are the templates of the generated files.
+var templates = template.Must(template.New("").Funcs(template.FuncMap{
+	// title converts an http method to the suffix of its constant, e.g.
+	// "POST" to "Post" for http.MethodPost.
+	"title": func(s string) string { return s[:1] + strings.ToLower(s[1:]) },
+}).ParseFS(templateFS, "templates/*.tmpl"))
@@ -0,0 +1,12 @@
+-- The venues of the reference module, see venues.SQLRepository.
+CREATE TABLE venues (
+	id         TEXT PRIMARY KEY,
+	name       TEXT NOT NULL,
+	city       TEXT NOT NULL,
+	capacity   INTEGER NOT NULL,
+	created_at TIMESTAMPTZ NOT NULL,
+	updated_at TIMESTAMPTZ NOT NULL,
+	deleted_at TIMESTAMPTZ
+);
+
+CREATE INDEX venues_created_at_id ON venues (created_at, id);
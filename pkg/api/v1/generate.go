@@ -0,0 +1,5 @@
+// Package apiv1 contains the generated types and grpc stubs of the api of the
+// service, see venues.proto.
+package apiv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative --go-grpc_out=. --go-grpc_opt=paths=source_relative venues.proto
@@ -1,3 +1,188 @@
+// Package client contains the clients of the apis of the service, for the
+// services consuming them. The typed clients of the grpc api are generated from
+// the stubs in pkg/api by cmd/clientgen, see generate.go; the shared behavior
+// of the generated clients lives in this file:
+//
+//   - calls failing with codes.Unavailable, i.e. not processed by the server,
+//     are retried with an exponential backoff, and so are calls of idempotent
+//     methods failing with codes.DeadlineExceeded or codes.Aborted;
+//   - the trace context of the incoming request, i.e. the "traceparent" and
+//     "tracestate" metadata, is forwarded to the calls;
+//   - the status errors of the server are decoded to the errors of the
+//     framework, thus callers check them with [errors.Is] and
+//     [service.ErrNotFound] and friends.
+//
+// Usage:
+//
+//	conn, err := grpc.Dial(target, grpc.WithTransportCredentials(creds))
+//	venues := client.NewVenuesClient(conn, client.DefaultConfig)
+//	v, err := venues.GetVenue(ctx, &apiv1.GetVenueRequest{Id: id})
+//	if errors.Is(err, service.ErrNotFound) {
+//		// ...
+//	}
 package client
 
-// This file contains a client implementation for the rest api of the service.
+import (
+	"context"
+	"fmt"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// Config encapsulates the configuration of a client. It is usually embedded
+// into the configuration of the consuming service with a prefix naming the
+// api, e.g.
+//
+//	Venues client.Config `envPrefix:"VENUES_"`
+//
+// The zero value makes a single attempt per call, without a timeout.
+type Config struct {
+	// Timeout limits the duration of a single attempt. Zero means no
+	// limit other than the deadline of the context.
+	Timeout time.Duration `env:"CLIENT_TIMEOUT" envDefault:"10s"`
+
+	// MaxAttempts is the maximum number of attempts of a call,
+	// including the first one.
+	MaxAttempts int `env:"CLIENT_MAX_ATTEMPTS" envDefault:"3"`
+
+	// InitialBackoff is the delay before the first retry. Every
+	// following retry doubles the delay, up to MaxBackoff.
+	InitialBackoff time.Duration `env:"CLIENT_INITIAL_BACKOFF" envDefault:"100ms"`
+	MaxBackoff     time.Duration `env:"CLIENT_MAX_BACKOFF" envDefault:"2s"`
+}
+
+// DefaultConfig is the configuration of the env defaults.
+var DefaultConfig = Config{
+	Timeout:        10 * time.Second, //nolint:gomnd // see the env defaults
+	MaxAttempts:    3,                //nolint:gomnd // see the env defaults
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     2 * time.Second,
+}
+
+// call makes the attempts of a call, until one succeeds, fails with an error
+// that is not retried, or the attempts are exhausted. It returns the decoded
+// error of the last attempt, or the error of ctx in case it is done while
+// waiting to retry.
+func (c Config) call(
+	ctx context.Context,
+	idempotent bool,
+	attempt func(ctx context.Context) error,
+) error {
+	ctx = forwardTrace(ctx)
+	backoff := c.InitialBackoff
+	for n := 1; ; n++ {
+		err := c.attempt(ctx, attempt)
+		if err == nil {
+			return nil
+		}
+		if n >= c.MaxAttempts || !retryable(err, idempotent) || ctx.Err() != nil {
+			return Error(err)
+		}
+
+		// The delays are randomized ("full jitter"), so that many clients
+		// failing at the same time do not retry in lockstep.
+		var delay time.Duration
+		if backoff > 0 {
+			delay = time.Duration(rand.Int63n(int64(backoff))) //nolint:gosec // jitter
+		}
+		t := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err() //nolint:wrapcheck // context errors are returned as is
+		case <-t.C:
+		}
+		if backoff *= 2; c.MaxBackoff > 0 && backoff > c.MaxBackoff {
+			backoff = c.MaxBackoff
+		}
+	}
+}
+
+// attempt makes a single attempt of a call, limited by the timeout.
+func (c Config) attempt(ctx context.Context, attempt func(ctx context.Context) error) error {
+	if c.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, c.Timeout)
+		defer cancel()
+	}
+	return attempt(ctx)
+}
+
+// Error decodes the status error of a call to the error of the framework that
+// the server returned, so that the callers check it with [errors.Is], e.g.
+// [service.ErrNotFound] for codes.NotFound. The message of the error is kept.
+// Errors other than status errors are returned as is.
+func Error(err error) error {
+	st, ok := status.FromError(err)
+	if !ok || st.Code() == codes.OK {
+		return err
+	}
+	switch st.Code() { //nolint:exhaustive // the rest are unexpected
+	case codes.Canceled:
+		return fmt.Errorf("%w: %s", context.Canceled, st.Message())
+	case codes.DeadlineExceeded:
+		return fmt.Errorf("%w: %s", service.ErrTimeOut, trimPrefix(st.Message(), service.ErrTimeOut))
+	}
+	target, ok := statusErrors[st.Code()]
+	if !ok {
+		target = service.ErrUnexpected
+	}
+	return fmt.Errorf("%w: %s", target, trimPrefix(st.Message(), target))
+}
+
+// retryable reports whether the call failing with err is retried. Unavailable
+// servers did not process the call; the other codes are retried only for
+// idempotent methods, as the server may have processed the call.
+func retryable(err error, idempotent bool) bool {
+	switch status.Code(err) { //nolint:exhaustive // the rest are not retried
+	case codes.Unavailable:
+		return true
+	case codes.DeadlineExceeded, codes.Aborted:
+		return idempotent
+	}
+	return false
+}
+
+// forwardTrace forwards the trace context of the incoming request, if any, to
+// the outgoing calls.
+func forwardTrace(ctx context.Context) context.Context {
+	in, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	out, _ := metadata.FromOutgoingContext(ctx)
+	for _, key := range traceKeys {
+		if v := in.Get(key); len(v) > 0 && len(out.Get(key)) == 0 {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, v[0])
+		}
+	}
+	return ctx
+}
+
+// trimPrefix removes the message of the error from the start of the message
+// of the status, as the servers of the template include it, e.g.
+// "not found: venue 42".
+func trimPrefix(msg string, err error) string {
+	return strings.TrimPrefix(msg, err.Error()+": ")
+}
+
+// statusErrors are the errors of the framework by the status codes the servers
+// map them to.
+var statusErrors = map[codes.Code]error{
+	codes.InvalidArgument:   service.ErrBadRequest,
+	codes.NotFound:          service.ErrNotFound,
+	codes.AlreadyExists:     service.ErrAlreadyExists,
+	codes.PermissionDenied:  service.ErrNotAllowed,
+	codes.Unauthenticated:   service.ErrNotAllowed,
+	codes.ResourceExhausted: service.ErrSpaceFull,
+	codes.Unavailable:       service.ErrConnectionClosed,
+}
+
+// traceKeys are the metadata keys of the W3C trace context.
+var traceKeys = []string{"traceparent", "tracestate"}
@@ -0,0 +1,23 @@
+package eventsv1
+
+// The topics on which the events are published. Producers and consumers use
+// these constants instead of spelling out topic names.
+const (
+	// TopicExamples carries the lifecycle events of the examples:
+	// ExampleCreated.
+	TopicExamples = "examples"
+
+	// TopicVenues carries the lifecycle events of the venues:
+	// VenueCreated, VenueUpdated and VenueDeleted.
+	TopicVenues = "venues"
+)
+
+// The current schema versions of the events, carried by the envelopes.
+// Increment the version of an event when the meaning of its fields changes,
+// and keep an upcaster from the previous version in the consumers.
+const (
+	ExampleCreatedVersion uint32 = 1
+	VenueCreatedVersion   uint32 = 1
+	VenueUpdatedVersion   uint32 = 1
+	VenueDeletedVersion   uint32 = 1
+)
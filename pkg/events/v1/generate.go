@@ -0,0 +1,5 @@
+// Package eventsv1 contains the generated types of the events published by the
+// service, see events.proto.
+package eventsv1
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative events.proto
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/info"
+	"github.com/eventscompass/service-template/src/internal/introspect"
+	"github.com/eventscompass/service-template/src/internal/lifecycle"
+	"github.com/eventscompass/service-template/src/internal/store"
+)
+
+// serve runs the service until it receives a stop signal. With -validate, or
+// SERVICE_DRY_RUN, it validates the service instead, see validate.
+func (s *ServiceName) serve(ctx context.Context, args []string) error {
+	validate, probe, err := dryRun(args)
+	if err != nil {
+		return err
+	}
+	if validate {
+		return s.validate(ctx, os.Stdout, probe)
+	}
+	// The configuration is parsed by Init, thus it is passed by reference.
+	return lifecycle.Start(s, &s.cfg.Lifecycle) //nolint:wrapcheck // printed as is
+}
+
+// migrate applies the sql migrations of the directory given as argument, or
+// of MIGRATIONS_DIR. The database driver must be imported by the service.
+func migrate(ctx context.Context, args []string) error {
+	var cfg struct {
+		Store store.Config
+		Dir   string `env:"MIGRATIONS_DIR" envDefault:"migrations"`
+	}
+	if err := parseEnv(&cfg); err != nil {
+		return fmt.Errorf("%w: parse environment variables: %v", service.ErrBadRequest, err)
+	}
+	if len(args) > 0 {
+		cfg.Dir = args[0]
+	}
+
+	db, err := store.Open(ctx, cfg.Store)
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	defer db.Close() //nolint:errcheck // intentional
+	applied, err := store.Migrate(ctx, db, os.DirFS(cfg.Dir))
+	for _, name := range applied {
+		fmt.Println("applied", name)
+	}
+	if err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	if len(applied) == 0 {
+		fmt.Println("no pending migrations")
+	}
+	return nil
+}
+
+// checkConfig parses the configuration of the service from the environment
+// and prints it, with the secrets redacted.
+func (s *ServiceName) checkConfig(context.Context, []string) error {
+	if err := parseEnv(&s.cfg); err != nil {
+		return fmt.Errorf("%w: parse environment variables: %v", service.ErrBadRequest, err)
+	}
+	return printJSON(introspect.Redact(s.cfg))
+}
+
+// version prints the build information of the binary.
+func version(context.Context, []string) error {
+	return printJSON(info.Detect().Build)
+}
+
+// routes prints the routes of the rest handler, the grpc methods and the
+// subscriptions of the service, without initializing it.
+func (s *ServiceName) routes(ctx context.Context, _ []string) error {
+	snap := introspect.Of(ctx, s, nil)
+	for _, r := range snap.Routes {
+		fmt.Println("rest ", r)
+	}
+	for _, m := range snap.GRPCMethods {
+		fmt.Println("grpc ", m)
+	}
+	for _, t := range snap.Subscriptions {
+		fmt.Println("event", t)
+	}
+	return nil
+}
+
+// printJSON prints the indented json encoding of v.
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("%w: encode: %v", service.ErrUnexpected, err)
+	}
+	return nil
+}
@@ -1 +1,56 @@
 package main
+
+import (
+	"github.com/caarlos0/env/v6"
+
+	"github.com/eventscompass/service-template/src/internal/admin"
+	"github.com/eventscompass/service-template/src/internal/autotune"
+	"github.com/eventscompass/service-template/src/internal/chaos"
+	"github.com/eventscompass/service-template/src/internal/clientip"
+	"github.com/eventscompass/service-template/src/internal/discovery"
+	"github.com/eventscompass/service-template/src/internal/envalias"
+	"github.com/eventscompass/service-template/src/internal/jobs"
+	"github.com/eventscompass/service-template/src/internal/lifecycle"
+	"github.com/eventscompass/service-template/src/internal/listen"
+	"github.com/eventscompass/service-template/src/internal/page"
+	"github.com/eventscompass/service-template/src/internal/rabbitmq"
+	"github.com/eventscompass/service-template/src/internal/stream"
+	"github.com/eventscompass/service-template/src/internal/tlsconfig"
+	"github.com/eventscompass/service-template/src/internal/tracing"
+)
+
+// Config encapsulates the configuration of the service. The configuration is
+// parsed from environment variables on Init.
+type Config struct {
+	Admin     admin.Config
+	Autotune  autotune.Config
+	Chaos     chaos.Config
+	ClientIP  clientip.Config
+	Discovery discovery.Config
+	Jobs      jobs.Config
+	Lifecycle lifecycle.Config
+	Listen    listen.Config
+	Page      page.Config
+	Bus       rabbitmq.Config
+	Stream    stream.Config
+	Tracing   tracing.Config
+
+	// GRPCTLS is the tls configuration of the grpc server, e.g.
+	// GRPC_TLS_CERT_FILE. The server serves plaintext without it.
+	GRPCTLS tlsconfig.Config `envPrefix:"GRPC_"`
+}
+
+// parseEnv parses the environment variables of the service into v, see
+// [envPrefix]. Variables set under a deprecated name, see the envDeprecated
+// tags, are still read, and logged with their replacement.
+func parseEnv(v any) error {
+	environ, deprecated := envalias.Environ(v, envPrefix)
+	envalias.Log(deprecated)
+	return env.Parse(v, env.Options{Prefix: envPrefix, Environment: environ}) //nolint:wrapcheck // wrapped by the callers
+}
+
+// envPrefix prefixes the names of the environment variables of the service,
+// e.g. "VENUES_" for VENUES_DATABASE_DSN, so that services sharing an
+// environment do not read each other's configuration. It is set by newservice.
+// The variables of the framework, e.g. HTTP_SERVER_LISTEN, are not prefixed.
+const envPrefix = ""
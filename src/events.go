@@ -1 +1,7 @@
 package main
+
+import "github.com/eventscompass/service-framework/service"
+
+// Bus implements the [service.CloudService] interface. It returns the
+// RabbitMQ message bus of the service, or nil if MESSAGE_BUS_URL is not set.
+func (s *ServiceName) Bus() service.MessageBus { return s.bus }
@@ -1 +1,51 @@
 package main
+
+import (
+	"fmt"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+
+	"github.com/eventscompass/service-template/src/internal/chaos"
+	"github.com/eventscompass/service-template/src/internal/clientip"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/tlsconfig"
+	"github.com/eventscompass/service-template/src/internal/tracing"
+)
+
+// GRPC implements the [service.CloudService] interface. It returns the grpc
+// server of the venues api, see initVenues, or nil if no api is registered
+// on it.
+func (s *ServiceName) GRPC() *grpc.Server {
+	if s.grpc == nil || len(s.grpc.GetServiceInfo()) == 0 {
+		return nil
+	}
+	return s.grpc
+}
+
+// newGRPCServer creates the grpc server that the apis of the service are
+// registered on. The client address of the calls is resolved with the given
+// resolver, and the calls are traced and measured, see the tracing and the
+// metrics packages. The server serves tls if a certificate is configured, and
+// verifies the client certificates against the configured CAs, see
+// [tlsconfig.Config]. This function returns [service.ErrBadRequest] in case
+// the tls configuration is invalid.
+func newGRPCServer(cfg tlsconfig.Config, clientIP *clientip.Resolver) (*grpc.Server, error) {
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(
+			clientIP.UnaryServerInterceptor(),
+			tracing.UnaryServerInterceptor(),
+			metrics.UnaryServerInterceptor(),
+			chaos.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(tracing.StreamServerInterceptor(), metrics.StreamServerInterceptor()),
+	}
+	tlsCfg, err := tlsconfig.Server(cfg)
+	if err != nil {
+		return nil, fmt.Errorf("grpc tls: %w", err)
+	}
+	if tlsCfg != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsCfg)))
+	}
+	return grpc.NewServer(opts...), nil
+}
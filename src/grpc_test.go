@@ -1,3 +1,150 @@
 package main_test
 
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	apiv1 "github.com/eventscompass/service-template/pkg/api/v1"
+	"github.com/eventscompass/service-template/pkg/client"
+	"github.com/eventscompass/service-template/src/internal/chaos"
+	"github.com/eventscompass/service-template/src/internal/page"
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+	"github.com/eventscompass/service-template/src/internal/venues"
+)
+
 // This file should contain integration tests for the grpc api of the service.
+// The venues api of the reference module is served in memory through the
+// interceptors of the service, see servicetest.StartGRPC.
+
+func TestVenuesGRPC(t *testing.T) {
+	t.Setenv(servicetest.EnvPrefix+"PAGE_DEFAULT_LIMIT", "2")
+	t.Setenv(servicetest.EnvPrefix+"PAGE_MAX_LIMIT", "2")
+	client := startVenuesGRPC(t)
+	ctx := context.Background()
+
+	var ids []string
+	for _, name := range []string{"Arena", "Hall", "Stadium"} {
+		v, err := client.CreateVenue(ctx, &apiv1.CreateVenueRequest{Name: name, City: "Sofia", Capacity: 100})
+		if err != nil {
+			t.Fatalf("CreateVenue: %v", err)
+		}
+		ids = append(ids, v.GetId())
+	}
+
+	// The venues are listed oldest first, two per page.
+	var listed []string
+	req := &apiv1.ListVenuesRequest{}
+	for {
+		resp, err := client.ListVenues(ctx, req)
+		if err != nil {
+			t.Fatalf("ListVenues: %v", err)
+		}
+		for _, v := range resp.GetVenues() {
+			listed = append(listed, v.GetId())
+		}
+		if resp.GetNextPageToken() == "" {
+			break
+		}
+		req.PageToken = resp.GetNextPageToken()
+	}
+	if len(listed) != len(ids) {
+		t.Fatalf("ListVenues: got %v, want %v", listed, ids)
+	}
+	for i := range ids {
+		if listed[i] != ids[i] {
+			t.Errorf("ListVenues: got %v, want %v", listed, ids)
+			break
+		}
+	}
+
+	v, err := client.UpdateVenue(ctx, &apiv1.UpdateVenueRequest{Id: ids[0], Name: "Arena", City: "Plovdiv", Capacity: 100})
+	if err != nil || v.GetCity() != "Plovdiv" {
+		t.Errorf("UpdateVenue: got %v, %v, want the city updated", v, err)
+	}
+	if _, err := client.DeleteVenue(ctx, &apiv1.DeleteVenueRequest{Id: ids[0]}); err != nil {
+		t.Errorf("DeleteVenue: %v", err)
+	}
+	_, err = client.GetVenue(ctx, &apiv1.GetVenueRequest{Id: ids[0]})
+	servicetest.AssertGRPCError(t, err, codes.NotFound, "")
+}
+
+func TestVenuesGRPCErrors(t *testing.T) {
+	client := startVenuesGRPC(t)
+	ctx := context.Background()
+
+	_, err := client.CreateVenue(ctx, &apiv1.CreateVenueRequest{City: "Sofia", Capacity: 1})
+	servicetest.AssertGRPCError(t, err, codes.InvalidArgument, "name is required")
+	_, err = client.GetVenue(ctx, &apiv1.GetVenueRequest{Id: "unknown"})
+	servicetest.AssertGRPCError(t, err, codes.NotFound, "")
+	_, err = client.ListVenues(ctx, &apiv1.ListVenuesRequest{PageToken: "x"})
+	servicetest.AssertGRPCError(t, err, codes.InvalidArgument, "cursor")
+	_, err = client.ListVenues(ctx, &apiv1.ListVenuesRequest{PageSize: -1})
+	servicetest.AssertGRPCError(t, err, codes.InvalidArgument, "page size")
+}
+
+func TestVenuesGRPCInterceptors(t *testing.T) {
+	// The calls go through the fault injection of the service, which fails
+	// every call once enabled.
+	t.Setenv(servicetest.EnvPrefix+"CHAOS_ENABLED", "true")
+	t.Setenv(servicetest.EnvPrefix+"CHAOS_ERROR_RATE", "1")
+	t.Cleanup(func() { chaos.Configure(chaos.Config{}) }) //nolint:errcheck // valid config
+	client := startVenuesGRPC(t)
+	_, err := client.GetVenue(context.Background(), &apiv1.GetVenueRequest{Id: "unknown"})
+	servicetest.AssertGRPCError(t, err, codes.Unavailable, "injected fault")
+}
+
+func TestVenuesClient(t *testing.T) {
+	t.Parallel()
+	// The server is unavailable for every other call, which the client
+	// retries.
+	var calls atomic.Int32
+	flaky := func(ctx context.Context, req any, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+		if calls.Add(1)%2 == 1 {
+			return nil, status.Error(codes.Unavailable, "try again")
+		}
+		return handler(ctx, req)
+	}
+	srv := grpc.NewServer(grpc.UnaryInterceptor(flaky))
+	svc := venues.NewService(venues.NewMemoryRepository(), nil)
+	apiv1.RegisterVenuesServiceServer(srv, venues.NewGRPCServer(svc, page.Config{DefaultLimit: 20}))
+	cfg := client.Config{Timeout: time.Second, MaxAttempts: 2, InitialBackoff: time.Millisecond}
+	c := client.NewVenuesClient(servicetest.ServeGRPC(t, srv), cfg)
+	ctx := context.Background()
+
+	v, err := c.CreateVenue(ctx, &apiv1.CreateVenueRequest{Name: "Arena", City: "Sofia", Capacity: 100})
+	if err != nil {
+		t.Fatalf("CreateVenue: %v", err)
+	}
+	if got, err := c.GetVenue(ctx, &apiv1.GetVenueRequest{Id: v.GetId()}); err != nil || got.GetName() != "Arena" {
+		t.Errorf("GetVenue: got %v, %v, want the venue", got, err)
+	}
+	if n := calls.Load(); n != 4 {
+		t.Errorf("got %d calls, want every call attempted twice", n)
+	}
+
+	// The status errors are decoded to the errors of the framework.
+	_, err = c.GetVenue(ctx, &apiv1.GetVenueRequest{Id: "unknown"})
+	if !errors.Is(err, service.ErrNotFound) {
+		t.Errorf("GetVenue: got %v, want %v", err, service.ErrNotFound)
+	}
+	_, err = c.CreateVenue(ctx, &apiv1.CreateVenueRequest{City: "Sofia", Capacity: 1})
+	if !errors.Is(err, service.ErrBadRequest) {
+		t.Errorf("CreateVenue: got %v, want %v", err, service.ErrBadRequest)
+	}
+}
+
+// startVenuesGRPC serves the grpc api of the service with the venues in
+// memory, see newService.
+func startVenuesGRPC(t *testing.T) apiv1.VenuesServiceClient {
+	t.Helper()
+	s, _ := newService()
+	return apiv1.NewVenuesServiceClient(servicetest.StartGRPC(t, s))
+}
@@ -0,0 +1,112 @@
+// Package admin serves the internal endpoints of the service, e.g. job status,
+// on a dedicated listener. The admin listener must not be exposed outside of
+// the cluster.
+//
+// Every service has an admin [Server] of its own, on which its components
+// register their endpoints with [Server.Handle]. The admin server is run as a
+// background worker, see [Server.Worker]. The endpoints controlling the
+// service at runtime, e.g. changing the log level, are registered with
+// [Server.RegisterControl] and require a token of their own.
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/auth"
+	"github.com/eventscompass/service-template/src/internal/health"
+	"github.com/eventscompass/service-template/src/internal/listen"
+	"github.com/eventscompass/service-template/src/internal/workers"
+)
+
+// Config encapsulates the configuration for the admin server.
+type Config struct {
+	// Listen is the port on which the internal endpoints of this
+	// service will be registered.
+	Listen string `env:"ADMIN_SERVER_LISTEN" envDefault:":10070"`
+
+	// ControlToken is the bearer token required by the
+	// runtime-control endpoints, see [Server.RegisterControl]. Empty
+	// disables the endpoints.
+	ControlToken string `env:"ADMIN_CONTROL_TOKEN"`
+
+	// Credentials names the credentials of the requests, which
+	// the request dumps redact, see [Server.DumpRequests].
+	Credentials auth.Credentials
+}
+
+// Server is the admin server of a service.
+type Server struct {
+	cfg   Config
+	mux   *http.ServeMux
+	ready *health.Registry
+
+	// draining fails the readiness of the service, see
+	// [Server.RegisterControl].
+	draining atomic.Bool
+}
+
+// New creates the admin [Server] of a service with the given readiness
+// registry, which fails once the server is stopped.
+func New(cfg Config, ready *health.Registry) *Server {
+	return &Server{cfg: cfg, mux: http.NewServeMux(), ready: ready}
+}
+
+// Handle registers the handler for the given pattern on the admin server.
+func (s *Server) Handle(pattern string, h http.Handler) { s.mux.Handle(pattern, h) }
+
+// JSON returns a handler responding with the json encoding of the value
+// returned by fn.
+func JSON(fn func() any) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "no-store")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(fn()); err != nil {
+			slog.Error("failed to encode admin response", slog.String("error", err.Error()))
+		}
+	})
+}
+
+// Worker returns the background worker running the admin server. Once the
+// worker is stopped, the readiness checks fail, see [health.Registry.Drain],
+// and the server shuts down. The service is taken out of rotation before it
+// stops, see lifecycle.Config.ShutdownDelay.
+func (s *Server) Worker() workers.Worker {
+	return workers.Worker{
+		Name:    "admin-server",
+		Restart: workers.RestartOnFailure,
+		Run: func(ctx context.Context) error {
+			l, err := listen.Listen("admin", s.cfg.Listen)
+			if err != nil {
+				return err //nolint:wrapcheck // logged by the supervisor
+			}
+			srv := &http.Server{
+				Addr:              s.cfg.Listen,
+				Handler:           s.mux,
+				ReadHeaderTimeout: readHeaderTimeout,
+			}
+			go func() {
+				<-ctx.Done() // block until context is cancelled
+				s.ready.Drain()
+				slog.Info("shutting down admin server")
+				srv.Shutdown(context.Background()) //nolint:errcheck,contextcheck // intentional
+			}()
+
+			slog.Info("starting admin server", slog.String("port", s.cfg.Listen))
+			if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				return err //nolint:wrapcheck // logged by the supervisor
+			}
+			return nil
+		},
+	}
+}
+
+// readHeaderTimeout protects the admin server from slow clients.
+const readHeaderTimeout = 10 * time.Second
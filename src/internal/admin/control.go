@@ -0,0 +1,288 @@
+package admin
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/http/httputil"
+	"runtime"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/eventscompass/service-template/src/internal/logs"
+)
+
+// RegisterControl registers the runtime-control endpoints on the admin server,
+// under "/control/", and installs the runtime adjustable log level on the
+// default logger, once per process. The endpoints require the bearer token of
+// [Config.ControlToken], and are not registered without one:
+//
+//   - GET, PUT /control/log-level reads or changes the log level, with a
+//     {"level":"debug"} body;
+//   - POST /control/drain fails the readiness of the service, so that it stops
+//     receiving traffic while it keeps running, and DELETE undoes it;
+//   - GET /control/goroutines dumps the stacks of the goroutines;
+//   - GET /control/heap writes a heap profile, after a garbage collection if
+//     gc=1 is set;
+//   - GET, PUT /control/request-dump reads or toggles the request dumping of
+//     [Server.DumpRequests], with a {"enabled":true} body;
+//   - GET /control/quarantine lists the quarantined messages, see
+//     [RegisterQuarantine].
+//
+// RegisterControl is usually called once on Init, before anything is logged.
+func (s *Server) RegisterControl() {
+	if s.cfg.ControlToken == "" {
+		return
+	}
+	installLogLevel.Do(func() {
+		logLevel.Set(slog.LevelInfo)
+		logs.Wrap(func(h slog.Handler) slog.Handler { return &levelHandler{Handler: h} })
+	})
+	s.ready.Register(drainCheckName, func(context.Context) error {
+		if s.draining.Load() {
+			return errors.New("the service is draining")
+		}
+		return nil
+	})
+
+	control := func(pattern string, h http.HandlerFunc) {
+		s.Handle("/control/"+pattern, requireToken(s.cfg.ControlToken, h))
+	}
+	control("log-level", handleLogLevel)
+	control("drain", s.handleDrain)
+	control("goroutines", handleGoroutines)
+	control("heap", handleHeap)
+	control("request-dump", handleRequestDump)
+	control("quarantine", handleQuarantine)
+}
+
+// QuarantineLister lists the messages set aside by a component because they
+// could not be handled, e.g. dead-lettered messages. The result is encoded as
+// json.
+type QuarantineLister func(ctx context.Context) (any, error)
+
+// RegisterQuarantine registers the lister of the quarantined messages of a
+// component, reported under name by GET /control/quarantine. Registering a
+// lister with the same name again replaces the previous lister.
+func RegisterQuarantine(name string, l QuarantineLister) {
+	quarantineMu.Lock()
+	defer quarantineMu.Unlock()
+	quarantine[name] = l
+}
+
+// DumpRequests logs the requests passed to the handler while request dumping
+// is enabled, see [Server.RegisterControl]. The bodies are not dumped, the
+// credentials in the headers are redacted, and the query parameters carrying
+// credentials are left out, see [Config.Credentials].
+func (s *Server) DumpRequests(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if dumpRequests.Load() {
+			if b, err := httputil.DumpRequest(s.redact(r), false); err == nil {
+				slog.InfoContext(r.Context(), "request dump", slog.String("request", string(b)))
+			}
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// redact returns a copy of the request without its credentials, see
+// [Server.DumpRequests].
+func (s *Server) redact(r *http.Request) *http.Request {
+	r = r.Clone(r.Context())
+	for _, h := range s.cfg.Credentials.Headers() {
+		if r.Header.Get(h) != "" {
+			r.Header.Set(h, "REDACTED")
+		}
+	}
+	if params := s.cfg.Credentials.QueryParams(); len(params) > 0 && r.URL.RawQuery != "" {
+		q := r.URL.Query()
+		for _, p := range params {
+			q.Del(p)
+		}
+		r.URL.RawQuery = q.Encode()
+		r.RequestURI = r.URL.RequestURI()
+	}
+	return r
+}
+
+// requireToken rejects the requests without the bearer token.
+func requireToken(token string, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(got), []byte(token)) != 1 {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "invalid control token", http.StatusUnauthorized) // 401
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// handleLogLevel reads or changes the level of the default logger.
+func handleLogLevel(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			Level slog.Level `json:"level"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid log level: "+err.Error(), http.StatusBadRequest) // 400
+			return
+		}
+		if old := logLevel.Level(); old != body.Level {
+			slog.Warn("changing the log level",
+				slog.String("from", old.String()), slog.String("to", body.Level.String()))
+			logLevel.Set(body.Level)
+		}
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+	writeJSON(w, map[string]string{"level": logLevel.Level().String()})
+}
+
+// handleDrain starts or stops draining the service.
+func (s *Server) handleDrain(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodPost:
+		if !s.draining.Swap(true) {
+			slog.Warn("draining the service")
+		}
+	case http.MethodDelete:
+		if s.draining.Swap(false) {
+			slog.Warn("stopped draining the service")
+		}
+	default:
+		methodNotAllowed(w, http.MethodPost, http.MethodDelete)
+		return
+	}
+	writeJSON(w, map[string]bool{"draining": s.draining.Load()})
+}
+
+// handleGoroutines dumps the stacks of all goroutines.
+func handleGoroutines(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	pprof.Lookup("goroutine").WriteTo(w, 2) //nolint:errcheck,gosec // the client went away
+}
+
+// handleHeap writes a heap profile, in the format read by "go tool pprof".
+func handleHeap(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	if r.URL.Query().Get("gc") == "1" {
+		runtime.GC()
+	}
+	w.Header().Set("Content-Type", "application/octet-stream")
+	w.Header().Set("Content-Disposition", `attachment; filename="heap.pb.gz"`)
+	pprof.Lookup("heap").WriteTo(w, 0) //nolint:errcheck,gosec // the client went away
+}
+
+// handleRequestDump reads or toggles the request dumping.
+func handleRequestDump(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPut:
+		var body struct {
+			Enabled bool `json:"enabled"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "invalid request: "+err.Error(), http.StatusBadRequest) // 400
+			return
+		}
+		if dumpRequests.Swap(body.Enabled) != body.Enabled {
+			slog.Warn("toggled request dumping", slog.Bool("enabled", body.Enabled))
+		}
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut)
+		return
+	}
+	writeJSON(w, map[string]bool{"enabled": dumpRequests.Load()})
+}
+
+// handleQuarantine lists the quarantined messages of every component.
+func handleQuarantine(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		methodNotAllowed(w, http.MethodGet)
+		return
+	}
+	quarantineMu.Lock()
+	listers := make(map[string]QuarantineLister, len(quarantine))
+	for name, l := range quarantine {
+		listers[name] = l
+	}
+	quarantineMu.Unlock()
+
+	report := make(map[string]any, len(listers))
+	for name, l := range listers {
+		msgs, err := l(r.Context())
+		if err != nil {
+			report[name] = map[string]string{"error": err.Error()}
+			continue
+		}
+		report[name] = msgs
+	}
+	writeJSON(w, report)
+}
+
+// writeJSON writes the json encoding of v.
+func writeJSON(w http.ResponseWriter, v any) {
+	JSON(func() any { return v }).ServeHTTP(w, nil)
+}
+
+// methodNotAllowed rejects a request with a method other than the allowed
+// ones.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed) // 405
+}
+
+// levelHandler filters the records of a handler by the runtime adjustable
+// log level.
+type levelHandler struct {
+	slog.Handler
+}
+
+// Enabled implements the [slog.Handler] interface.
+func (h *levelHandler) Enabled(_ context.Context, l slog.Level) bool {
+	return l >= logLevel.Level()
+}
+
+// WithAttrs implements the [slog.Handler] interface.
+func (h *levelHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements the [slog.Handler] interface.
+func (h *levelHandler) WithGroup(name string) slog.Handler {
+	return &levelHandler{Handler: h.Handler.WithGroup(name)}
+}
+
+// drainCheckName is the name of the health check failing while the service
+// is draining.
+const drainCheckName = "drain"
+
+var (
+	// logLevel is the level of the default logger, see
+	// [Server.RegisterControl].
+	logLevel        slog.LevelVar
+	installLogLevel sync.Once
+
+	// dumpRequests enables the request dumping of [DumpRequests].
+	dumpRequests atomic.Bool
+
+	// quarantine holds the registered listers of quarantined messages.
+	quarantineMu sync.Mutex
+	quarantine   = make(map[string]QuarantineLister)
+)
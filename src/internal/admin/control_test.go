@@ -0,0 +1,44 @@
+package admin
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/http/httputil"
+	"strings"
+	"testing"
+
+	"github.com/eventscompass/service-template/src/internal/auth"
+	"github.com/eventscompass/service-template/src/internal/health"
+)
+
+func TestRedact(t *testing.T) {
+	s := New(Config{Credentials: auth.Credentials{
+		APIKeyHeader:     "X-Partner-Key",
+		APIKeyQueryParam: "api_key",
+		SignatureHeader:  "X-Signature",
+	}}, health.NewRegistry())
+	r := httptest.NewRequest(http.MethodGet, "/venues?city=Sofia&api_key=secret-query", nil)
+	for _, h := range []string{
+		"Authorization", "Cookie", "X-Partner-Key", "X-Signature", "Stripe-Signature", "X-Hub-Signature-256",
+	} {
+		r.Header.Set(h, "secret-"+h)
+	}
+	r.Header.Set("X-Request-ID", "req-1")
+
+	b, err := httputil.DumpRequest(s.redact(r), false)
+	if err != nil {
+		t.Fatalf("dump request: %v", err)
+	}
+	dump := string(b)
+	if strings.Contains(dump, "secret") {
+		t.Errorf("got credentials in the dump:\n%s", dump)
+	}
+	for _, want := range []string{"GET /venues?city=Sofia HTTP/1.1", "X-Partner-Key: REDACTED", "X-Request-Id: req-1"} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("got dump without %q:\n%s", want, dump)
+		}
+	}
+	if r.Header.Get("Authorization") != "secret-Authorization" || r.URL.Query().Get("api_key") == "" {
+		t.Error("got the credentials of the request itself redacted")
+	}
+}
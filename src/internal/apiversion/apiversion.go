@@ -0,0 +1,202 @@
+// Package apiversion routes the requests of the rest api to the handlers of
+// the version they ask for, so that a service can evolve its api while the
+// clients of older versions keep working.
+//
+// The version is taken from the first segment of the path, e.g. "/v2/venues",
+// or from the API-Version header, see [Config]. The handlers of a version are
+// registered without the prefix:
+//
+//	r := apiversion.NewRouter(cfg.APIVersion)
+//	r.Handle("v1", v1, apiversion.Policy{
+//		Deprecated: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+//		Sunset:     time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC),
+//		Link:       "https://docs.example.com/migrate-to-v2",
+//	})
+//	r.Handle("v2", v2, apiversion.Policy{})
+//
+// Responses of deprecated versions carry the Deprecation, Sunset and Link
+// headers, and their usage is counted, so that the remaining clients can be
+// found before the version is removed. Versions past their sunset respond
+// with 410.
+package apiversion
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Config encapsulates the configuration of the version routing.
+type Config struct {
+	// Header is the request header naming the version, for
+	// requests without version prefix. The served version is set
+	// as response header of the same name.
+	Header string `env:"API_VERSION_HEADER" envDefault:"API-Version"`
+
+	// Default is the version of the requests that name none.
+	// Empty selects the latest registered version.
+	Default string `env:"API_VERSION_DEFAULT"`
+}
+
+// Policy is the lifecycle of a version.
+type Policy struct {
+	// Deprecated is the time from which on the version is
+	// deprecated. Zero means the version is not deprecated.
+	Deprecated time.Time
+
+	// Sunset is the time from which on the version is not served
+	// anymore. Zero means the version has no planned sunset.
+	Sunset time.Time
+
+	// Link documents the deprecation, e.g. a migration guide.
+	Link string
+}
+
+// Router routes the requests to the handlers of their version.
+type Router struct {
+	cfg      Config
+	versions map[string]*version
+	latest   string
+}
+
+// version is a registered version.
+type version struct {
+	name    string
+	handler http.Handler
+	policy  Policy
+}
+
+var _ http.Handler = (*Router)(nil)
+
+// NewRouter creates a new [Router]. Use [Router.Handle] to register the
+// versions.
+func NewRouter(cfg Config) *Router {
+	return &Router{cfg: cfg, versions: make(map[string]*version)}
+}
+
+// Handle registers the handler of the version, e.g. "v1". The latest
+// registered version serves the requests that name none, unless a default is
+// configured. Handle must be called before the router serves requests.
+func (r *Router) Handle(name string, h http.Handler, p Policy) {
+	r.versions[name] = &version{name: name, handler: h, policy: p}
+	r.latest = name
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (r *Router) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	ctx := req.Context()
+	v, req, err := r.route(req)
+	if err != nil {
+		service.HTTPError(ctx, w, err)
+		return
+	}
+	if r.cfg.Header != "" {
+		w.Header().Set(r.cfg.Header, v.name)
+	}
+
+	now := time.Now()
+	p := v.policy
+	if !p.Sunset.IsZero() && !now.Before(p.Sunset) {
+		sunsetRequests.Inc(v.name)
+		msg := fmt.Sprintf("api version %s was removed on %s", v.name, p.Sunset.Format(time.DateOnly))
+		http.Error(w, msg, http.StatusGone) // 410
+		return
+	}
+	if !p.Deprecated.IsZero() && !now.Before(p.Deprecated) {
+		setDeprecationHeaders(w.Header(), p)
+		deprecatedRequests.Inc(v.name)
+		slog.Debug("request to deprecated api version",
+			slog.String("version", v.name),
+			slog.String("path", req.URL.Path),
+			slog.String("user_agent", req.UserAgent()),
+		)
+	} else if !p.Sunset.IsZero() {
+		w.Header().Set("Sunset", p.Sunset.UTC().Format(http.TimeFormat))
+	}
+	v.handler.ServeHTTP(w, req.WithContext(WithVersion(ctx, v.name)))
+}
+
+// route returns the version of the request, and the request without the
+// version prefix. This function returns [service.ErrNotFound] in case the
+// request names an unknown version.
+func (r *Router) route(req *http.Request) (*version, *http.Request, error) {
+	first, rest, _ := strings.Cut(strings.TrimPrefix(req.URL.Path, "/"), "/")
+	if v, ok := r.versions[first]; ok {
+		// Strip the prefix like http.StripPrefix does.
+		req2 := new(http.Request)
+		*req2 = *req
+		req2.URL = new(url.URL)
+		*req2.URL = *req.URL
+		req2.URL.Path = "/" + rest
+		req2.URL.RawPath = ""
+		return v, req2, nil
+	}
+
+	name := r.cfg.Default
+	if r.cfg.Header != "" {
+		if h := req.Header.Get(r.cfg.Header); h != "" {
+			name = h
+		}
+	}
+	if name == "" {
+		name = r.latest
+	}
+	v, ok := r.versions[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("%w: unknown api version %q", service.ErrNotFound, name)
+	}
+	return v, req, nil
+}
+
+// WithVersion returns a copy of ctx carrying the api version of the request.
+func WithVersion(ctx context.Context, v string) context.Context {
+	return context.WithValue(ctx, versionKey{}, v)
+}
+
+// From returns the api version of the request, for handlers shared between
+// versions. Returns false if the request was not routed by a [Router].
+func From(ctx context.Context) (string, bool) {
+	v, ok := ctx.Value(versionKey{}).(string)
+	return v, ok
+}
+
+// setDeprecationHeaders sets the headers announcing the deprecation of a
+// version. https://datatracker.ietf.org/doc/html/rfc9745 and
+// https://datatracker.ietf.org/doc/html/rfc8594
+func setDeprecationHeaders(h http.Header, p Policy) {
+	h.Set("Deprecation", "@"+strconv.FormatInt(p.Deprecated.Unix(), 10))
+	if !p.Sunset.IsZero() {
+		h.Set("Sunset", p.Sunset.UTC().Format(http.TimeFormat))
+	}
+	if p.Link != "" {
+		h.Add("Link", fmt.Sprintf("<%s>; rel=%q", p.Link, "deprecation"))
+	}
+}
+
+// versionKey is the context key of the api version.
+type versionKey struct{}
+
+var (
+	// deprecatedRequests counts the requests to deprecated versions.
+	deprecatedRequests = metrics.NewCounter(
+		"api_deprecated_requests_total",
+		"Number of requests to deprecated api versions.",
+		"version",
+	)
+
+	// sunsetRequests counts the rejected requests to removed versions.
+	sunsetRequests = metrics.NewCounter(
+		"api_sunset_requests_total",
+		"Number of requests to api versions past their sunset.",
+		"version",
+	)
+)
@@ -0,0 +1,284 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+// APIKeyConfig encapsulates the configuration for authenticating machine to
+// machine calls with api keys.
+type APIKeyConfig struct {
+	// Header is the request header carrying the api key. For
+	// grpc calls the lower-cased header is used as metadata key.
+	Header string `env:"AUTH_API_KEY_HEADER" envDefault:"X-API-Key"`
+
+	// QueryParam is the url query parameter carrying the api
+	// key. Keys in urls end up in access logs, thus this is
+	// disabled by default.
+	QueryParam string `env:"AUTH_API_KEY_QUERY_PARAM"`
+
+	// Keys are the static api keys, see [NewStaticKeyStore].
+	Keys []string `env:"AUTH_API_KEYS"`
+}
+
+// APIKey holds the metadata of an api key. The key itself is never stored,
+// only its digest, see [HashAPIKey].
+type APIKey struct {
+	// ID identifies the key, e.g. in logs. It is not secret.
+	ID string
+
+	// Owner is the caller to which the key was issued.
+	Owner string
+
+	// Scopes are the permissions granted to the key.
+	Scopes []string
+}
+
+// KeyStore looks up api keys.
+type KeyStore interface {
+	// Lookup returns the metadata of the key with the given
+	// digest. Returns [service.ErrNotFound] in case the key
+	// does not exist or was revoked.
+	Lookup(_ context.Context, digest string) (*APIKey, error)
+}
+
+// APIKeyVerifier is a [Verifier] for api keys. The principal of a key has the
+// owner of the key as subject, and carries the key id as "key_id" claim.
+type APIKeyVerifier struct {
+	cfg   APIKeyConfig
+	store KeyStore
+}
+
+var _ Verifier = (*APIKeyVerifier)(nil)
+
+// NewAPIKeyVerifier creates a new [APIKeyVerifier] looking up the keys in the
+// given store.
+func NewAPIKeyVerifier(cfg APIKeyConfig, s KeyStore) *APIKeyVerifier {
+	return &APIKeyVerifier{cfg: cfg, store: s}
+}
+
+// Verify implements the [Verifier] interface. This function returns
+// [ErrUnauthorized] in case the key is unknown.
+func (v *APIKeyVerifier) Verify(ctx context.Context, key string) (*Principal, error) {
+	k, err := v.store.Lookup(ctx, HashAPIKey(key))
+	if errors.Is(err, service.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown api key", ErrUnauthorized)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("lookup api key: %w", err)
+	}
+	return &Principal{
+		Subject: k.Owner,
+		Issuer:  apiKeyIssuer,
+		Scopes:  k.Scopes,
+		Claims:  map[string]any{"key_id": k.ID},
+	}, nil
+}
+
+// APIKeyMiddleware returns an http middleware that authenticates every request
+// with the api key from the configured header or query parameter. Requests that
+// cannot be authenticated are rejected with 401.
+func APIKeyMiddleware(v *APIKeyVerifier) func(http.Handler) http.Handler {
+	return middleware(v, func(r *http.Request) string {
+		if key := r.Header.Get(v.cfg.Header); key != "" {
+			return key
+		}
+		if v.cfg.QueryParam != "" {
+			return r.URL.Query().Get(v.cfg.QueryParam)
+		}
+		return ""
+	})
+}
+
+// APIKeyUnaryServerInterceptor returns a grpc interceptor that authenticates
+// every unary call with the api key from the metadata.
+func APIKeyUnaryServerInterceptor(v *APIKeyVerifier) grpc.UnaryServerInterceptor {
+	return unaryInterceptor(v, v.fromMetadata)
+}
+
+// APIKeyStreamServerInterceptor returns a grpc interceptor that authenticates
+// every stream with the api key from the metadata.
+func APIKeyStreamServerInterceptor(v *APIKeyVerifier) grpc.StreamServerInterceptor {
+	return streamInterceptor(v, v.fromMetadata)
+}
+
+// HashAPIKey returns the digest under which the key is stored.
+func HashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// StaticKeyStore is a [KeyStore] holding a fixed set of keys, e.g. from the
+// environment.
+type StaticKeyStore struct {
+	keys map[string]*APIKey
+}
+
+var _ KeyStore = (*StaticKeyStore)(nil)
+
+// NewStaticKeyStore creates a new [StaticKeyStore] from entries formatted as
+// "<id>:<owner>:<space separated scopes>:<key>". Instead of the key, its
+// digest can be provided as "sha256=<hex digest>", so that the key itself does
+// not need to be deployed. This function returns [service.ErrBadRequest] in
+// case an entry is malformed.
+func NewStaticKeyStore(entries []string) (*StaticKeyStore, error) {
+	s := &StaticKeyStore{keys: make(map[string]*APIKey, len(entries))}
+	for _, e := range entries {
+		parts := strings.SplitN(e, ":", 4) //nolint:gomnd // id:owner:scopes:key
+		if len(parts) != 4 || parts[0] == "" || parts[3] == "" {
+			return nil, fmt.Errorf("%w: malformed api key entry", service.ErrBadRequest)
+		}
+		digest, ok := strings.CutPrefix(parts[3], "sha256=")
+		if !ok {
+			digest = HashAPIKey(parts[3])
+		}
+		s.keys[digest] = &APIKey{
+			ID:     parts[0],
+			Owner:  parts[1],
+			Scopes: strings.Fields(parts[2]),
+		}
+	}
+	return s, nil
+}
+
+// Lookup implements the [KeyStore] interface.
+func (s *StaticKeyStore) Lookup(_ context.Context, digest string) (*APIKey, error) {
+	if k, ok := s.keys[digest]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("%w: api key", service.ErrNotFound)
+}
+
+// SQLKeyStore is a [KeyStore] backed by a postgres table. The table must be
+// created by the migrations of the service:
+//
+//	CREATE TABLE api_keys (
+//		id         TEXT PRIMARY KEY,
+//		digest     TEXT NOT NULL UNIQUE,
+//		owner      TEXT NOT NULL,
+//		scopes     TEXT NOT NULL DEFAULT '',
+//		revoked_at TIMESTAMPTZ
+//	);
+type SQLKeyStore struct {
+	db *sql.DB
+}
+
+var _ KeyStore = (*SQLKeyStore)(nil)
+
+// NewSQLKeyStore creates a new [SQLKeyStore].
+func NewSQLKeyStore(db *sql.DB) *SQLKeyStore {
+	return &SQLKeyStore{db: db}
+}
+
+// Lookup implements the [KeyStore] interface.
+func (s *SQLKeyStore) Lookup(ctx context.Context, digest string) (*APIKey, error) {
+	var (
+		k      APIKey
+		scopes string
+	)
+	err := s.db.QueryRowContext(ctx,
+		"SELECT id, owner, scopes FROM api_keys WHERE digest = $1 AND revoked_at IS NULL",
+		digest,
+	).Scan(&k.ID, &k.Owner, &scopes)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("%w: api key", service.ErrNotFound)
+	}
+	if err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	k.Scopes = strings.Fields(scopes)
+	return &k, nil
+}
+
+// CachedKeyStore caches the lookups of another [KeyStore]. Unknown keys are
+// cached as well, so that invalid keys do not hit the underlying store on
+// every request. Revoked keys keep working until their cache entry expires.
+type CachedKeyStore struct {
+	store KeyStore
+	ttl   time.Duration
+	clock clock.Clock
+
+	mu      sync.Mutex
+	entries map[string]cachedKey
+}
+
+var _ KeyStore = (*CachedKeyStore)(nil)
+
+// NewCachedKeyStore creates a new [CachedKeyStore] caching the lookups of s
+// for the given ttl.
+func NewCachedKeyStore(s KeyStore, ttl time.Duration) *CachedKeyStore {
+	return &CachedKeyStore{store: s, ttl: ttl, clock: clock.Real, entries: make(map[string]cachedKey)}
+}
+
+// UseClock makes the store use the given clock for expiring the cache entries,
+// e.g. a fake clock in tests. UseClock must be called before the store is used.
+func (s *CachedKeyStore) UseClock(c clock.Clock) {
+	s.clock = clock.Or(c)
+}
+
+// Lookup implements the [KeyStore] interface.
+func (s *CachedKeyStore) Lookup(ctx context.Context, digest string) (*APIKey, error) {
+	now := s.clock.Now()
+	s.mu.Lock()
+	e, ok := s.entries[digest]
+	s.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		if e.key == nil {
+			return nil, fmt.Errorf("%w: api key", service.ErrNotFound)
+		}
+		return e.key, nil
+	}
+
+	k, err := s.store.Lookup(ctx, digest)
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		return nil, err
+	}
+
+	s.mu.Lock()
+	if len(s.entries) >= maxCachedKeys {
+		for d, e := range s.entries {
+			if now.After(e.expires) {
+				delete(s.entries, d)
+			}
+		}
+		if len(s.entries) >= maxCachedKeys {
+			s.entries = make(map[string]cachedKey)
+		}
+	}
+	s.entries[digest] = cachedKey{key: k, expires: now.Add(s.ttl)}
+	s.mu.Unlock()
+	return k, err
+}
+
+// fromMetadata returns the api key of the incoming grpc metadata.
+func (v *APIKeyVerifier) fromMetadata(ctx context.Context) string {
+	return firstMetadata(ctx, strings.ToLower(v.cfg.Header))
+}
+
+// cachedKey is an entry of a [CachedKeyStore]. A nil key means that the key
+// does not exist.
+type cachedKey struct {
+	key     *APIKey
+	expires time.Time
+}
+
+const (
+	// apiKeyIssuer is the issuer of the principals authenticated by api keys.
+	apiKeyIssuer = "api-key"
+
+	// maxCachedKeys bounds the memory used by a [CachedKeyStore].
+	maxCachedKeys = 10000
+)
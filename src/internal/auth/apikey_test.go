@@ -0,0 +1,210 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestNewStaticKeyStore(t *testing.T) {
+	tests := []struct {
+		name    string
+		entry   string
+		wantErr error
+	}{
+		{"key", "k1:billing:read write:secret", nil},
+		{"digest", "k1:billing::sha256=" + HashAPIKey("secret"), nil},
+		{"key with colons", "k1:billing:read:sec:ret", nil},
+		{"missing key", "k1:billing:read:", service.ErrBadRequest},
+		{"missing id", ":billing:read:secret", service.ErrBadRequest},
+		{"too few fields", "k1:secret", service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewStaticKeyStore([]string{tt.entry}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAPIKeyVerifier(t *testing.T) {
+	store, err := NewStaticKeyStore([]string{
+		"k1:billing:read write:secret-1",
+		"k2:reports::sha256=" + HashAPIKey("secret-2"),
+	})
+	if err != nil {
+		t.Fatalf("create store: %v", err)
+	}
+	v := NewAPIKeyVerifier(APIKeyConfig{Header: "X-API-Key"}, store)
+
+	tests := []struct {
+		name      string
+		key       string
+		wantOwner string
+		wantID    string
+		wantErr   error
+	}{
+		{"key", "secret-1", "billing", "k1", nil},
+		{"key by digest", "secret-2", "reports", "k2", nil},
+		{"unknown key", "secret-3", "", "", ErrUnauthorized},
+		{"key mismatch by one character", "secret-1 ", "", "", ErrUnauthorized},
+		{"digest instead of the key", HashAPIKey("secret-1"), "", "", ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := v.Verify(context.Background(), tt.key)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Subject != tt.wantOwner || p.Issuer != apiKeyIssuer || p.Claims["key_id"] != tt.wantID {
+				t.Errorf("got principal %+v, want owner %s with key %s", p, tt.wantOwner, tt.wantID)
+			}
+		})
+	}
+}
+
+func TestAPIKeyMiddleware(t *testing.T) {
+	store, _ := NewStaticKeyStore([]string{"k1:billing:read:secret"})
+	tests := []struct {
+		name       string
+		queryParam string
+		header     string
+		query      string
+		want       int
+	}{
+		{"header", "", "secret", "", http.StatusOK},
+		{"wrong header", "", "wrong", "", http.StatusUnauthorized},
+		{"missing", "", "", "", http.StatusUnauthorized},
+		{"query disabled", "", "", "?api_key=secret", http.StatusUnauthorized},
+		{"query enabled", "api_key", "", "?api_key=secret", http.StatusOK},
+		{"header before query", "api_key", "wrong", "?api_key=secret", http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewAPIKeyVerifier(APIKeyConfig{Header: "X-API-Key", QueryParam: tt.queryParam}, store)
+			h := APIKeyMiddleware(v)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				if p, ok := PrincipalFrom(r.Context()); !ok || p.Subject != "billing" {
+					t.Errorf("got principal %+v, want billing", p)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/"+tt.query, nil)
+			if tt.header != "" {
+				req.Header.Set("X-API-Key", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestAPIKeyUnaryServerInterceptor(t *testing.T) {
+	store, _ := NewStaticKeyStore([]string{"k1:billing:read:secret"})
+	interceptor := APIKeyUnaryServerInterceptor(NewAPIKeyVerifier(APIKeyConfig{Header: "X-API-Key"}, store))
+	tests := []struct {
+		name string
+		md   metadata.MD
+		want codes.Code
+	}{
+		{"key", metadata.Pairs("x-api-key", "secret"), codes.OK},
+		{"wrong key", metadata.Pairs("x-api-key", "wrong"), codes.Unauthenticated},
+		{"missing", metadata.MD{}, codes.Unauthenticated},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), tt.md)
+			_, err := interceptor(ctx, nil, &grpc.UnaryServerInfo{}, func(ctx context.Context, _ any) (any, error) {
+				if _, ok := PrincipalFrom(ctx); !ok {
+					t.Error("got no principal")
+				}
+				return nil, nil
+			})
+			if got := status.Code(err); got != tt.want {
+				t.Errorf("got code %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCachedKeyStore(t *testing.T) {
+	tests := []struct {
+		name        string
+		key         string
+		advance     time.Duration
+		wantLookups int
+		wantErr     error
+	}{
+		{"cached key", "secret", time.Minute - time.Second, 1, nil},
+		{"cached unknown key", "wrong", time.Minute - time.Second, 1, service.ErrNotFound},
+		{"expired key", "secret", time.Minute + time.Second, 2, nil},
+		{"expired unknown key", "wrong", time.Minute + time.Second, 2, service.ErrNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			static, _ := NewStaticKeyStore([]string{"k1:billing:read:secret"})
+			counting := &countingKeyStore{KeyStore: static}
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			s := NewCachedKeyStore(counting, time.Minute)
+			s.UseClock(c)
+
+			for i := 0; i < 2; i++ {
+				if _, err := s.Lookup(context.Background(), HashAPIKey(tt.key)); !errors.Is(err, tt.wantErr) {
+					t.Fatalf("got error %v, want %v", err, tt.wantErr)
+				}
+				c.Advance(tt.advance)
+			}
+			if counting.lookups != tt.wantLookups {
+				t.Errorf("got %d lookups, want %d", counting.lookups, tt.wantLookups)
+			}
+		})
+	}
+}
+
+func TestCachedKeyStoreErrors(t *testing.T) {
+	errDown := errors.New("database down")
+	s := NewCachedKeyStore(failingKeyStore{err: errDown}, time.Minute)
+	for i := 0; i < 2; i++ {
+		// Failed lookups are not cached.
+		if _, err := s.Lookup(context.Background(), HashAPIKey("secret")); !errors.Is(err, errDown) {
+			t.Errorf("got error %v, want %v", err, errDown)
+		}
+	}
+}
+
+// countingKeyStore counts the lookups of the underlying store.
+type countingKeyStore struct {
+	KeyStore
+	lookups int
+}
+
+func (s *countingKeyStore) Lookup(ctx context.Context, digest string) (*APIKey, error) {
+	s.lookups++
+	return s.KeyStore.Lookup(ctx, digest) //nolint:wrapcheck // test store
+}
+
+// failingKeyStore fails every lookup.
+type failingKeyStore struct{ err error }
+
+func (s failingKeyStore) Lookup(context.Context, string) (*APIKey, error) { return nil, s.err }
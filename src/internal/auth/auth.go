@@ -0,0 +1,238 @@
+// Package auth authenticates the callers of the rest and grpc apis of the
+// service.
+//
+// The authenticated caller is represented by a [Principal], which is put into
+// the request context by the http middleware and the grpc interceptors. The
+// handlers retrieve it with [PrincipalFrom].
+//
+// End users are authenticated with bearer JWTs, see [JWTVerifier], or with
+// opaque tokens that are checked by the identity provider, see
+// [IntrospectionVerifier]. Machine to machine calls may be authenticated with
+// api keys instead, see [APIKeyVerifier]. Inbound webhooks are authenticated
+// by their signatures, see [WebhookMiddleware].
+package auth
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/httperr"
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+// ErrUnauthorized is returned when the caller could not be authenticated, e.g.
+// the credentials are missing, malformed, or expired. The rest api responds
+// to it with 401 and a bearer challenge, and the grpc interceptors with
+// codes.Unauthenticated.
+var ErrUnauthorized = httperr.New("unauthorized", httperr.Response{
+	Status: http.StatusUnauthorized, // 401
+	Header: http.Header{"WWW-Authenticate": {`Bearer error="invalid_token"`}},
+	Log:    "client could not be authenticated",
+})
+
+// Principal is the authenticated caller of the service, see
+// [reqctx.Principal].
+type Principal = reqctx.Principal
+
+// WithPrincipal returns a copy of ctx carrying the principal, see
+// [reqctx.WithPrincipal].
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return reqctx.WithPrincipal(ctx, p)
+}
+
+// PrincipalFrom returns the principal carried by ctx. Returns false if the
+// request was not authenticated. It is the same as [reqctx.PrincipalFrom].
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	return reqctx.PrincipalFrom(ctx)
+}
+
+// Verifier verifies the credentials presented by a caller, see [JWTVerifier].
+type Verifier interface {
+	// Verify returns the principal identified by the token.
+	Verify(_ context.Context, token string) (*Principal, error)
+}
+
+// Credentials names where the requests carry their credentials, e.g. to
+// redact them from the logs. It is read from the variables of
+// [APIKeyConfig] and [HMACConfig], thus it follows their configuration.
+type Credentials struct {
+	// APIKeyHeader is the header carrying the api key, see
+	// [APIKeyConfig.Header].
+	APIKeyHeader string `env:"AUTH_API_KEY_HEADER" envDefault:"X-API-Key"`
+
+	// APIKeyQueryParam is the query parameter carrying the api
+	// key, if any, see [APIKeyConfig.QueryParam].
+	APIKeyQueryParam string `env:"AUTH_API_KEY_QUERY_PARAM"`
+
+	// SignatureHeader is the header carrying the signature of
+	// the signed requests, see [HMACConfig.Header].
+	SignatureHeader string `env:"AUTH_HMAC_HEADER" envDefault:"X-Signature"`
+}
+
+// Headers returns the headers carrying credentials: the standard ones, e.g.
+// Authorization, the configured ones, and the signature headers of the
+// webhooks, see [NewStripeVerifier] and [GitHubVerifier].
+func (c Credentials) Headers() []string {
+	headers := []string{
+		"Authorization", "Cookie", "Proxy-Authorization",
+		"Stripe-Signature", "X-Hub-Signature-256",
+	}
+	for _, h := range []string{c.APIKeyHeader, c.SignatureHeader} {
+		if h != "" {
+			headers = append(headers, h)
+		}
+	}
+	return headers
+}
+
+// QueryParams returns the query parameters carrying credentials.
+func (c Credentials) QueryParams() []string {
+	if c.APIKeyQueryParam == "" {
+		return nil
+	}
+	return []string{c.APIKeyQueryParam}
+}
+
+// Middleware returns an http middleware that authenticates every request with
+// the bearer token from the Authorization header. Requests that cannot be
+// authenticated are rejected with 401.
+func Middleware(v Verifier) func(http.Handler) http.Handler {
+	return middleware(v, func(r *http.Request) string {
+		return bearerToken(r.Header.Get("Authorization"))
+	})
+}
+
+// UnaryServerInterceptor returns a grpc interceptor that authenticates every
+// unary call with the bearer token from the "authorization" metadata.
+func UnaryServerInterceptor(v Verifier) grpc.UnaryServerInterceptor {
+	return unaryInterceptor(v, bearerMetadata)
+}
+
+// StreamServerInterceptor returns a grpc interceptor that authenticates every
+// stream with the bearer token from the "authorization" metadata.
+func StreamServerInterceptor(v Verifier) grpc.StreamServerInterceptor {
+	return streamInterceptor(v, bearerMetadata)
+}
+
+// middleware returns an http middleware that authenticates every request with
+// the token returned by extract.
+func middleware(v Verifier, extract func(*http.Request) string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			p, err := authenticate(ctx, v, extract(r))
+			if err != nil {
+				httperr.Write(ctx, w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(ctx, p)))
+		})
+	}
+}
+
+// unaryInterceptor returns a grpc interceptor that authenticates every unary
+// call with the token returned by extract.
+func unaryInterceptor(
+	v Verifier,
+	extract func(context.Context) string,
+) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		p, err := authenticate(ctx, v, extract(ctx))
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		return handler(WithPrincipal(ctx, p), req)
+	}
+}
+
+// streamInterceptor returns a grpc interceptor that authenticates every stream
+// with the token returned by extract.
+func streamInterceptor(
+	v Verifier,
+	extract func(context.Context) string,
+) grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx := ss.Context()
+		p, err := authenticate(ctx, v, extract(ctx))
+		if err != nil {
+			return grpcError(err)
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: WithPrincipal(ctx, p)})
+	}
+}
+
+// authenticate verifies the token. An empty token means that the caller did
+// not present any credentials.
+func authenticate(ctx context.Context, v Verifier, token string) (*Principal, error) {
+	if token == "" {
+		return nil, fmt.Errorf("%w: missing credentials", ErrUnauthorized)
+	}
+	return v.Verify(ctx, token)
+}
+
+// bearerToken returns the token of a bearer authorization value.
+func bearerToken(authorization string) string {
+	scheme, token, ok := strings.Cut(authorization, " ")
+	if !ok || !strings.EqualFold(scheme, "Bearer") {
+		return ""
+	}
+	return strings.TrimSpace(token)
+}
+
+// bearerMetadata returns the bearer token of the incoming grpc metadata.
+func bearerMetadata(ctx context.Context) string {
+	return bearerToken(firstMetadata(ctx, "authorization"))
+}
+
+// firstMetadata returns the first value for the key of the incoming grpc
+// metadata.
+func firstMetadata(ctx context.Context, key string) string {
+	if vs := metadata.ValueFromIncomingContext(ctx, key); len(vs) > 0 {
+		return vs[0]
+	}
+	return ""
+}
+
+// grpcError converts the error to a grpc status error.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrUnauthorized):
+		return status.Error(codes.Unauthenticated, err.Error())
+	case errors.Is(err, service.ErrNotAllowed):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
+
+// serverStream overrides the context of a grpc stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context //nolint:containedctx // required by the interface
+}
+
+// Context implements the [grpc.ServerStream] interface.
+func (s *serverStream) Context() context.Context { return s.ctx }
@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+
+	"github.com/eventscompass/service-template/src/internal/httperr"
+)
+
+// Requirement declares what a caller needs in order to access a route or rpc.
+// The zero value only requires the caller to be authenticated.
+type Requirement struct {
+	// Roles lists the accepted roles. The caller must have at
+	// least one of them. Empty means that any role is accepted.
+	Roles []string `json:"roles,omitempty"`
+
+	// Scopes lists the required scopes. The caller must have
+	// all of them.
+	Scopes []string `json:"scopes,omitempty"`
+}
+
+// RequireRoles returns a [Requirement] accepting callers with any of the roles.
+func RequireRoles(roles ...string) Requirement { return Requirement{Roles: roles} }
+
+// RequireScopes returns a [Requirement] accepting callers with all the scopes.
+func RequireScopes(scopes ...string) Requirement { return Requirement{Scopes: scopes} }
+
+// Allows reports whether the principal satisfies the requirement.
+func (req Requirement) Allows(p *Principal) bool {
+	if p == nil {
+		return false
+	}
+	if len(req.Roles) > 0 {
+		ok := false
+		for _, r := range req.Roles {
+			ok = ok || p.HasRole(r)
+		}
+		if !ok {
+			return false
+		}
+	}
+	for _, s := range req.Scopes {
+		if !p.HasScope(s) {
+			return false
+		}
+	}
+	return true
+}
+
+// Authorize checks the principal of ctx against the requirement. This function
+// returns [ErrUnauthorized] in case ctx carries no principal, and
+// [service.ErrNotAllowed] in case the principal does not satisfy the
+// requirement.
+func Authorize(ctx context.Context, req Requirement) error {
+	p, ok := PrincipalFrom(ctx)
+	if !ok {
+		return fmt.Errorf("%w: no authenticated caller", ErrUnauthorized)
+	}
+	if !req.Allows(p) {
+		return fmt.Errorf("%w: %s", service.ErrNotAllowed, req.missing(p))
+	}
+	return nil
+}
+
+// Require returns an http middleware that rejects requests whose principal does
+// not satisfy the requirement with 403. It must be installed after one of the
+// authentication middlewares.
+func Require(req Requirement) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := Authorize(r.Context(), req); err != nil {
+				httperr.Write(r.Context(), w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireUnary returns a grpc interceptor enforcing the requirements of the
+// rpcs, keyed by full method name, e.g. "/venues.v1.Venues/CreateVenue". Rpcs
+// without a requirement only need an authenticated caller. It must be chained
+// after one of the authentication interceptors.
+func RequireUnary(reqs map[string]Requirement) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if err := Authorize(ctx, reqs[info.FullMethod]); err != nil {
+			return nil, grpcError(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// RequireStream is the streaming variant of [RequireUnary].
+func RequireStream(reqs map[string]Requirement) grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := Authorize(ss.Context(), reqs[info.FullMethod]); err != nil {
+			return grpcError(err)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// missing describes why the principal does not satisfy the requirement.
+func (req Requirement) missing(p *Principal) string {
+	var missing []string
+	for _, s := range req.Scopes {
+		if !p.HasScope(s) {
+			missing = append(missing, s)
+		}
+	}
+	if len(missing) > 0 {
+		return "missing scopes " + strings.Join(missing, " ")
+	}
+	return "requires one of the roles " + strings.Join(req.Roles, " ")
+}
@@ -0,0 +1,227 @@
+package auth
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/flight"
+)
+
+// IntrospectionConfig encapsulates the configuration for verifying opaque
+// tokens with OAuth2 token introspection (RFC 7662).
+type IntrospectionConfig struct {
+	// URL is the introspection endpoint of the identity provider.
+	URL string `env:"AUTH_INTROSPECTION_URL,notEmpty"`
+
+	// ClientID and ClientSecret authenticate the service at the
+	// introspection endpoint.
+	ClientID     string `env:"AUTH_INTROSPECTION_CLIENT_ID"`
+	ClientSecret string `env:"AUTH_INTROSPECTION_CLIENT_SECRET"`
+
+	// Audience is the expected "aud" of the tokens. If empty, the
+	// audience is not checked.
+	Audience string `env:"AUTH_INTROSPECTION_AUDIENCE"`
+
+	// CacheTTL is how long an active token is cached. Revoked
+	// tokens are accepted up to this long, but never beyond their
+	// expiry.
+	CacheTTL time.Duration `env:"AUTH_INTROSPECTION_CACHE_TTL" envDefault:"5m"`
+
+	// NegativeCacheTTL is how long an inactive token is cached,
+	// so that clients retrying with a bad token do not flood the
+	// identity provider.
+	NegativeCacheTTL time.Duration `env:"AUTH_INTROSPECTION_NEGATIVE_CACHE_TTL" envDefault:"30s"`
+
+	// Timeout limits the duration of an introspection request.
+	Timeout time.Duration `env:"AUTH_INTROSPECTION_TIMEOUT" envDefault:"5s"`
+}
+
+// IntrospectionVerifier is a [Verifier] for opaque tokens, which are sent to
+// the introspection endpoint of the identity provider. The results are cached,
+// thus only the first request with a token hits the identity provider.
+type IntrospectionVerifier struct {
+	cfg    IntrospectionConfig
+	client *http.Client
+	clock  clock.Clock
+
+	// flight collapses the concurrent introspections of a token.
+	flight *flight.Group[[sha256.Size]byte, *Principal]
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]introspected
+}
+
+var _ Verifier = (*IntrospectionVerifier)(nil)
+
+// NewIntrospectionVerifier creates a new [IntrospectionVerifier].
+func NewIntrospectionVerifier(cfg IntrospectionConfig) *IntrospectionVerifier {
+	return &IntrospectionVerifier{
+		cfg:     cfg,
+		client:  &http.Client{Timeout: cfg.Timeout},
+		clock:   clock.Real,
+		flight:  flight.NewGroup[[sha256.Size]byte, *Principal]("introspection"),
+		entries: make(map[[sha256.Size]byte]introspected),
+	}
+}
+
+// UseClock makes the verifier use the given clock for checking the expiry of
+// the tokens and of the cached introspections, e.g. a fake clock in tests.
+// UseClock must be called before the verifier is used.
+func (v *IntrospectionVerifier) UseClock(c clock.Clock) {
+	v.clock = clock.Or(c)
+}
+
+// Verify implements the [Verifier] interface. This function returns
+// [ErrUnauthorized] in case the token is not active, and
+// [service.ErrUnexpected] in case the identity provider could not be reached.
+func (v *IntrospectionVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	// The tokens are cached by digest, so that a memory dump does not
+	// leak them.
+	digest := sha256.Sum256([]byte(token))
+	now := v.clock.Now()
+	v.mu.Lock()
+	e, ok := v.entries[digest]
+	v.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		if e.principal == nil {
+			return nil, fmt.Errorf("%w: inactive token", ErrUnauthorized)
+		}
+		return e.principal, nil
+	}
+
+	// The concurrent requests of a client with a new token, e.g. a page
+	// loading its resources, share the introspection.
+	return v.flight.Do(ctx, digest, func(ctx context.Context) (*Principal, error) {
+		claims, err := v.introspect(ctx, token)
+		if err != nil {
+			return nil, err
+		}
+		p, expires, err := v.principal(claims, now)
+		if err != nil {
+			v.store(digest, introspected{expires: now.Add(v.cfg.NegativeCacheTTL)}, now)
+			return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+		}
+		v.store(digest, introspected{principal: p, expires: expires}, now)
+		return p, nil
+	})
+}
+
+// introspect sends the token to the introspection endpoint and returns the
+// response.
+func (v *IntrospectionVerifier) introspect(
+	ctx context.Context,
+	token string,
+) (map[string]any, error) {
+	form := url.Values{"token": {token}, "token_type_hint": {"access_token"}}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, v.cfg.URL,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: create request: %v", service.ErrUnexpected, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	if v.cfg.ClientID != "" {
+		req.SetBasicAuth(url.QueryEscape(v.cfg.ClientID), url.QueryEscape(v.cfg.ClientSecret))
+	}
+
+	resp, err := v.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: introspect token: %v", service.ErrUnexpected, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // intentional
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%w: introspect token: %s", service.ErrUnexpected, resp.Status)
+	}
+
+	var claims map[string]any
+	dec := json.NewDecoder(io.LimitReader(resp.Body, maxIntrospectionSize))
+	dec.UseNumber()
+	if err := dec.Decode(&claims); err != nil {
+		return nil, fmt.Errorf("%w: decode introspection response: %v", service.ErrUnexpected, err)
+	}
+	return claims, nil
+}
+
+// principal returns the principal of an introspection response and until when
+// it may be cached. An error is returned if the token is not active.
+func (v *IntrospectionVerifier) principal(
+	claims map[string]any,
+	now time.Time,
+) (*Principal, time.Time, error) {
+	if active, _ := claims["active"].(bool); !active {
+		return nil, time.Time{}, errors.New("inactive token")
+	}
+	if v.cfg.Audience != "" && !hasAudience(claims["aud"], v.cfg.Audience) {
+		return nil, time.Time{}, errors.New("unexpected audience")
+	}
+	expires := now.Add(v.cfg.CacheTTL)
+	if exp, ok := numericDate(claims["exp"]); ok {
+		if !now.Before(exp) {
+			return nil, time.Time{}, errors.New("token expired")
+		}
+		if exp.Before(expires) {
+			expires = exp
+		}
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Before(nbf) {
+		return nil, time.Time{}, errors.New("token not valid yet")
+	}
+
+	iss, _ := claims["iss"].(string)
+	sub, _ := claims["sub"].(string)
+	if sub == "" {
+		// Tokens of the client credentials grant have no subject.
+		sub, _ = claims["client_id"].(string)
+	}
+	return &Principal{
+		Subject: sub,
+		Issuer:  iss,
+		Roles:   stringList(claims["roles"]),
+		Scopes:  scopes(claims),
+		Claims:  claims,
+	}, expires, nil
+}
+
+// store caches the introspection result of a token.
+func (v *IntrospectionVerifier) store(digest [sha256.Size]byte, e introspected, now time.Time) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if len(v.entries) >= maxCachedTokens {
+		for d, e := range v.entries {
+			if now.After(e.expires) {
+				delete(v.entries, d)
+			}
+		}
+		if len(v.entries) >= maxCachedTokens {
+			v.entries = make(map[[sha256.Size]byte]introspected)
+		}
+	}
+	v.entries[digest] = e
+}
+
+// introspected is a cached introspection result. A nil principal means that
+// the token is not active.
+type introspected struct {
+	principal *Principal
+	expires   time.Time
+}
+
+const (
+	// maxIntrospectionSize limits the size of the introspection response.
+	maxIntrospectionSize = 1 << 20
+
+	// maxCachedTokens bounds the memory used by the introspection cache.
+	maxCachedTokens = 10000
+)
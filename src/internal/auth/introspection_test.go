@@ -0,0 +1,87 @@
+package auth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestIntrospectionVerifierCache(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls.Add(1)
+		claims := map[string]any{"active": r.PostFormValue("token") != "revoked", "sub": "user-1"}
+		if r.PostFormValue("token") == "short-lived" {
+			claims["exp"] = now.Add(time.Minute).Unix()
+		}
+		json.NewEncoder(w).Encode(claims) //nolint:errcheck,errchkjson // test server
+	}))
+	defer srv.Close()
+
+	type call struct {
+		token     string
+		advance   time.Duration
+		wantErr   error
+		wantCalls int32
+	}
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "active token cached",
+			calls: []call{
+				{token: "token", wantCalls: 1},
+				{token: "token", advance: 4 * time.Minute, wantCalls: 1},
+				{token: "token", advance: time.Minute, wantCalls: 2},
+			},
+		},
+		{
+			name: "cached up to the expiry",
+			calls: []call{
+				{token: "short-lived", wantCalls: 1},
+				{token: "short-lived", advance: time.Minute, wantErr: ErrUnauthorized, wantCalls: 2},
+			},
+		},
+		{
+			name: "inactive token cached",
+			calls: []call{
+				{token: "revoked", wantErr: ErrUnauthorized, wantCalls: 1},
+				{token: "revoked", advance: 29 * time.Second, wantErr: ErrUnauthorized, wantCalls: 1},
+				{token: "revoked", advance: time.Second, wantErr: ErrUnauthorized, wantCalls: 2},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			calls.Store(0)
+			clk := servicetest.NewFakeClock(now)
+			v := NewIntrospectionVerifier(IntrospectionConfig{
+				URL:              srv.URL,
+				CacheTTL:         5 * time.Minute,
+				NegativeCacheTTL: 30 * time.Second,
+				Timeout:          time.Second,
+			})
+			v.UseClock(clk)
+			for i, c := range tt.calls {
+				clk.Advance(c.advance)
+				_, err := v.Verify(context.Background(), c.token)
+				if !errors.Is(err, c.wantErr) {
+					t.Errorf("call %d: got error %v, want %v", i, err, c.wantErr)
+				}
+				if got := calls.Load(); got != c.wantCalls {
+					t.Errorf("call %d: got %d introspections, want %d", i, got, c.wantCalls)
+				}
+			}
+		})
+	}
+}
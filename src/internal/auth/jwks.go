@@ -0,0 +1,249 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/flight"
+)
+
+// keySet caches the keys of a JSON Web Key Set. The keys are fetched again
+// when the cache is older than the refresh interval, or when a token refers to
+// an unknown key, e.g. because the issuer rotated its keys.
+type keySet struct {
+	url     string
+	refresh time.Duration
+	client  *http.Client
+
+	// flight collapses the concurrent fetches of the key set.
+	flight *flight.Group[struct{}, struct{}]
+
+	mu          sync.RWMutex
+	clock       clock.Clock
+	keys        map[string]crypto.PublicKey
+	fetched     time.Time
+	lastAttempt time.Time
+}
+
+func newKeySet(url string, refresh time.Duration) *keySet {
+	return &keySet{
+		url:     url,
+		refresh: refresh,
+		client:  &http.Client{Timeout: fetchTimeout},
+		flight:  flight.NewGroup[struct{}, struct{}]("jwks"),
+		clock:   clock.Real,
+	}
+}
+
+// useClock makes the key set use the given clock for its age.
+func (s *keySet) useClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = c
+}
+
+// key returns the key with the given id. If the id is empty, the key set must
+// contain a single key. This function returns [ErrUnauthorized] in case the key
+// is not part of the key set.
+func (s *keySet) key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	if k, ok := s.cached(kid); ok {
+		return k, nil
+	}
+
+	// The tokens arriving while the key set is fetched share the fetch.
+	_, err := s.flight.Do(ctx, struct{}{}, func(ctx context.Context) (struct{}, error) {
+		s.mu.RLock()
+		throttled := clock.Since(s.clock, s.lastAttempt) < minRefreshInterval
+		s.mu.RUnlock()
+		if !throttled {
+			if err := s.fetch(ctx); err != nil {
+				// Keep using the stale keys if the issuer is unavailable.
+				slog.Warn("failed to fetch key set",
+					slog.String("url", s.url),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+		return struct{}{}, nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: wait for key set: %v", service.ErrTimeOut, err)
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if k, ok := s.lookup(kid); ok {
+		return k, nil
+	}
+	if s.keys == nil {
+		return nil, fmt.Errorf("%w: key set is not available", service.ErrUnexpected)
+	}
+	return nil, fmt.Errorf("%w: unknown signing key %q", ErrUnauthorized, kid)
+}
+
+// cached returns the key with the given id if the cache is fresh.
+func (s *keySet) cached(kid string) (crypto.PublicKey, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if clock.Since(s.clock, s.fetched) > s.refresh {
+		return nil, false
+	}
+	return s.lookup(kid)
+}
+
+// lookup returns the key with the given id. The caller must hold the lock.
+func (s *keySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, k := range s.keys {
+			return k, true
+		}
+	}
+	k, ok := s.keys[kid]
+	return k, ok
+}
+
+// fetch downloads the key set and replaces the cached keys.
+func (s *keySet) fetch(ctx context.Context) error {
+	s.mu.Lock()
+	s.lastAttempt = s.clock.Now()
+	s.mu.Unlock()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.url, nil)
+	if err != nil {
+		return fmt.Errorf("%w: create request: %v", service.ErrUnexpected, err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: fetch key set: %v", service.ErrUnexpected, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // intentional
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("%w: fetch key set: %s", service.ErrUnexpected, resp.Status)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxKeySetSize)).Decode(&set); err != nil {
+		return fmt.Errorf("%w: decode key set: %v", service.ErrUnexpected, err)
+	}
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			slog.Warn("skipping invalid key",
+				slog.String("kid", k.Kid),
+				slog.String("error", err.Error()),
+			)
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	s.mu.Lock()
+	s.keys, s.fetched = keys, s.clock.Now()
+	s.mu.Unlock()
+	return nil
+}
+
+// jwk is a single JSON Web Key.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+
+	// RSA keys.
+	N string `json:"n"`
+	E string `json:"e"`
+
+	// EC keys.
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// publicKey decodes the public key.
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		curve, ok := curves[k.Crv]
+		if !ok {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+// decodeInt decodes a base64url encoded big-endian integer.
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by the caller
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+const (
+	// minRefreshInterval limits how often unknown keys can trigger a fetch of
+	// the key set, so that forged tokens cannot flood the issuer.
+	minRefreshInterval = time.Minute
+
+	// fetchTimeout limits the duration of a fetch of the key set.
+	fetchTimeout = 10 * time.Second
+
+	// maxKeySetSize limits the size of the key set response.
+	maxKeySetSize = 1 << 20
+)
+
+var curves = map[string]elliptic.Curve{
+	"P-256": elliptic.P256(),
+	"P-384": elliptic.P384(),
+	"P-521": elliptic.P521(),
+}
@@ -0,0 +1,280 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+// JWTConfig encapsulates the configuration for verifying JWTs.
+type JWTConfig struct {
+	// Issuer is the expected "iss" claim of the tokens.
+	Issuer string `env:"AUTH_JWT_ISSUER,notEmpty"`
+
+	// Audience is the expected "aud" claim of the tokens. If
+	// empty, the audience is not checked.
+	Audience string `env:"AUTH_JWT_AUDIENCE"`
+
+	// JWKSURL is the url of the key set of the issuer.
+	JWKSURL string `env:"AUTH_JWKS_URL,notEmpty"`
+
+	// JWKSRefreshInterval is how often the key set is fetched
+	// again. Tokens signed with an unknown key trigger an early
+	// refresh, so that key rotations are picked up quickly.
+	JWKSRefreshInterval time.Duration `env:"AUTH_JWKS_REFRESH_INTERVAL" envDefault:"1h"`
+
+	// Leeway is the tolerated clock skew when checking the
+	// expiry and not-before times of the tokens.
+	Leeway time.Duration `env:"AUTH_JWT_LEEWAY" envDefault:"1m"`
+}
+
+// JWTVerifier is a [Verifier] for JWTs signed with asymmetric keys that are
+// published as a JSON Web Key Set. RSA (RS*, PS*) and ECDSA (ES*) signatures are
+// supported.
+type JWTVerifier struct {
+	cfg   JWTConfig
+	keys  *keySet
+	clock clock.Clock
+}
+
+var _ Verifier = (*JWTVerifier)(nil)
+
+// NewJWTVerifier creates a new [JWTVerifier]. The key set is fetched lazily
+// when the first token is verified.
+func NewJWTVerifier(cfg JWTConfig) *JWTVerifier {
+	return &JWTVerifier{
+		cfg:   cfg,
+		keys:  newKeySet(cfg.JWKSURL, cfg.JWKSRefreshInterval),
+		clock: clock.Real,
+	}
+}
+
+// UseClock makes the verifier use the given clock for checking the expiry of
+// the tokens and the age of the key set, e.g. a fake clock in tests. UseClock
+// must be called before the verifier is used.
+func (v *JWTVerifier) UseClock(c clock.Clock) {
+	v.clock = clock.Or(c)
+	v.keys.useClock(v.clock)
+}
+
+// WithAudience returns a verifier that expects the given audience, but shares
+// the cached key set with v. This is useful when the same issuer signs tokens
+// for different audiences, e.g. access tokens and OIDC id tokens.
+func (v *JWTVerifier) WithAudience(audience string) *JWTVerifier {
+	cfg := v.cfg
+	cfg.Audience = audience
+	return &JWTVerifier{cfg: cfg, keys: v.keys, clock: v.clock}
+}
+
+// Verify implements the [Verifier] interface. This function returns
+// [ErrUnauthorized] in case the token is malformed, has an invalid signature,
+// or fails the claim checks.
+func (v *JWTVerifier) Verify(ctx context.Context, token string) (*Principal, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 { //nolint:gomnd // header.payload.signature
+		return nil, fmt.Errorf("%w: malformed token", ErrUnauthorized)
+	}
+	var h jwtHeader
+	if err := decodeSegment(parts[0], &h); err != nil {
+		return nil, fmt.Errorf("%w: decode header: %v", ErrUnauthorized, err)
+	}
+	alg, ok := algorithms[h.Alg]
+	if !ok {
+		return nil, fmt.Errorf("%w: unsupported algorithm %q", ErrUnauthorized, h.Alg)
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("%w: decode signature: %v", ErrUnauthorized, err)
+	}
+
+	key, err := v.keys.key(ctx, h.Kid)
+	if err != nil {
+		return nil, err
+	}
+	if err := alg.verify(key, parts[0]+"."+parts[1], sig); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+
+	var claims map[string]any
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("%w: decode claims: %v", ErrUnauthorized, err)
+	}
+	if err := v.check(claims, v.clock.Now()); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrUnauthorized, err)
+	}
+
+	iss, _ := claims["iss"].(string)
+	sub, _ := claims["sub"].(string)
+	return &Principal{
+		Subject: sub,
+		Issuer:  iss,
+		Roles:   stringList(claims["roles"]),
+		Scopes:  scopes(claims),
+		Claims:  claims,
+	}, nil
+}
+
+// check validates the registered claims of the token.
+func (v *JWTVerifier) check(claims map[string]any, now time.Time) error {
+	if iss, _ := claims["iss"].(string); iss != v.cfg.Issuer {
+		return fmt.Errorf("unexpected issuer %q", iss)
+	}
+	if v.cfg.Audience != "" && !hasAudience(claims["aud"], v.cfg.Audience) {
+		return errors.New("unexpected audience")
+	}
+
+	exp, ok := numericDate(claims["exp"])
+	if !ok {
+		return errors.New("missing expiry")
+	}
+	if now.After(exp.Add(v.cfg.Leeway)) {
+		return errors.New("token expired")
+	}
+	if nbf, ok := numericDate(claims["nbf"]); ok && now.Add(v.cfg.Leeway).Before(nbf) {
+		return errors.New("token not valid yet")
+	}
+	return nil
+}
+
+// jwtHeader is the JOSE header of a token.
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+}
+
+// algorithm verifies the signatures of a JWS algorithm.
+type algorithm struct {
+	hash crypto.Hash
+	pss  bool
+
+	// curveBits is the size of the curve of ECDSA algorithms.
+	curveBits int
+}
+
+// verify verifies the signature of the signing input with the key.
+func (a algorithm) verify(key crypto.PublicKey, input string, sig []byte) error {
+	h := a.hash.New()
+	h.Write([]byte(input))
+	digest := h.Sum(nil)
+
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if a.curveBits != 0 {
+			return errors.New("key type does not match the algorithm")
+		}
+		if a.pss {
+			return rsa.VerifyPSS(k, a.hash, digest, sig, nil) //nolint:wrapcheck // wrapped by the caller
+		}
+		return rsa.VerifyPKCS1v15(k, a.hash, digest, sig) //nolint:wrapcheck // wrapped by the caller
+	case *ecdsa.PublicKey:
+		if k.Curve.Params().BitSize != a.curveBits {
+			return errors.New("key curve does not match the algorithm")
+		}
+		size := (a.curveBits + 7) / 8 //nolint:gomnd // bits to bytes
+		if len(sig) != 2*size {
+			return errors.New("invalid signature length")
+		}
+		r := new(big.Int).SetBytes(sig[:size])
+		s := new(big.Int).SetBytes(sig[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return errors.New("invalid signature")
+		}
+		return nil
+	default:
+		return fmt.Errorf("key of type %T does not match the algorithm", key)
+	}
+}
+
+// decodeSegment decodes a base64url encoded json segment of a token.
+func decodeSegment(seg string, v any) error {
+	b, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by the caller
+	}
+	dec := json.NewDecoder(bytes.NewReader(b))
+	dec.UseNumber()
+	return dec.Decode(v) //nolint:wrapcheck // wrapped by the caller
+}
+
+// numericDate converts a NumericDate claim to a time.
+func numericDate(v any) (time.Time, bool) {
+	n, ok := v.(json.Number)
+	if !ok {
+		return time.Time{}, false
+	}
+	f, err := n.Float64()
+	if err != nil {
+		return time.Time{}, false
+	}
+	sec := int64(f)
+	return time.Unix(sec, int64((f-float64(sec))*float64(time.Second))), true
+}
+
+// hasAudience reports whether the "aud" claim, which is either a string or an
+// array of strings, contains the audience.
+func hasAudience(v any, audience string) bool {
+	switch aud := v.(type) {
+	case string:
+		return aud == audience
+	case []any:
+		for _, a := range aud {
+			if a == audience {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// scopes returns the scopes granted by the token, which are either a space
+// separated "scope" claim, or a "scp" array.
+func scopes(claims map[string]any) []string {
+	if s, ok := claims["scope"]; ok {
+		return stringList(s)
+	}
+	return stringList(claims["scp"])
+}
+
+// stringList converts a claim, which is either a space separated string or an
+// array of strings, to a list.
+func stringList(v any) []string {
+	switch v := v.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		var res []string
+		for _, s := range v {
+			if s, ok := s.(string); ok {
+				res = append(res, s)
+			}
+		}
+		return res
+	default:
+		return nil
+	}
+}
+
+// algorithms are the supported JWS algorithms. Symmetric algorithms and "none"
+// are deliberately not supported.
+var algorithms = map[string]algorithm{
+	"RS256": {hash: crypto.SHA256},
+	"RS384": {hash: crypto.SHA384},
+	"RS512": {hash: crypto.SHA512},
+	"PS256": {hash: crypto.SHA256, pss: true},
+	"PS384": {hash: crypto.SHA384, pss: true},
+	"PS512": {hash: crypto.SHA512, pss: true},
+	"ES256": {hash: crypto.SHA256, curveBits: 256},
+	"ES384": {hash: crypto.SHA384, curveBits: 384},
+	"ES512": {hash: crypto.SHA512, curveBits: 521},
+}
@@ -0,0 +1,338 @@
+package auth
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestJWTVerifier(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	ecKey := mustECKey(t)
+	rsaKey := mustRSAKey(t)
+	jwks := newJWKSServer(t, map[string]crypto.PublicKey{"ec": &ecKey.PublicKey, "rsa": &rsaKey.PublicKey})
+
+	claims := func(mod func(map[string]any)) map[string]any {
+		c := map[string]any{
+			"iss":   "https://issuer",
+			"aud":   "api",
+			"sub":   "user-1",
+			"exp":   now.Add(time.Hour).Unix(),
+			"roles": []string{"admin"},
+			"scope": "read write",
+		}
+		if mod != nil {
+			mod(c)
+		}
+		return c
+	}
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{"es256", signJWT(t, "ES256", "ec", ecKey, claims(nil)), nil},
+		{"rs256", signJWT(t, "RS256", "rsa", rsaKey, claims(nil)), nil},
+		{"ps256", signJWT(t, "PS256", "rsa", rsaKey, claims(nil)), nil},
+		{"audience list", signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]any) {
+			c["aud"] = []string{"other", "api"}
+		})), nil},
+		{"expired within leeway", signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]any) {
+			c["exp"] = now.Add(-30 * time.Second).Unix()
+		})), nil},
+		{"expired", signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]any) {
+			c["exp"] = now.Add(-2 * time.Minute).Unix()
+		})), ErrUnauthorized},
+		{"without expiry", signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]any) {
+			delete(c, "exp")
+		})), ErrUnauthorized},
+		{"not valid yet", signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]any) {
+			c["nbf"] = now.Add(2 * time.Minute).Unix()
+		})), ErrUnauthorized},
+		{"wrong issuer", signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]any) {
+			c["iss"] = "https://evil"
+		})), ErrUnauthorized},
+		{"wrong audience", signJWT(t, "ES256", "ec", ecKey, claims(func(c map[string]any) {
+			c["aud"] = "other"
+		})), ErrUnauthorized},
+		{"forged with another key", signJWT(t, "ES256", "ec", mustECKey(t), claims(nil)), ErrUnauthorized},
+		{"algorithm of another key type", signJWT(t, "RS256", "ec", rsaKey, claims(nil)), ErrUnauthorized},
+		{"unknown key", signJWT(t, "ES256", "other", ecKey, claims(nil)), ErrUnauthorized},
+		{"tampered claims", tamper(signJWT(t, "ES256", "ec", ecKey, claims(nil)), claims(func(c map[string]any) {
+			c["roles"] = []string{"root"}
+		})), ErrUnauthorized},
+		{"alg none", unsigned("none", claims(nil)), ErrUnauthorized},
+		{"symmetric alg", unsigned("HS256", claims(nil)), ErrUnauthorized},
+		{"malformed", "not.a-token", ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewJWTVerifier(JWTConfig{
+				Issuer:              "https://issuer",
+				Audience:            "api",
+				JWKSURL:             jwks.URL,
+				JWKSRefreshInterval: time.Hour,
+				Leeway:              time.Minute,
+			})
+			v.UseClock(servicetest.NewFakeClock(now))
+
+			p, err := v.Verify(context.Background(), tt.token)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if p.Subject != "user-1" || p.Issuer != "https://issuer" {
+				t.Errorf("got principal %+v, want user-1 of https://issuer", p)
+			}
+			if len(p.Roles) != 1 || p.Roles[0] != "admin" || len(p.Scopes) != 2 {
+				t.Errorf("got roles %v and scopes %v, want [admin] and [read write]", p.Roles, p.Scopes)
+			}
+		})
+	}
+}
+
+func TestJWTVerifierKeyRotation(t *testing.T) {
+	c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	oldKey, newKey := mustECKey(t), mustECKey(t)
+	jwks := newJWKSServer(t, map[string]crypto.PublicKey{"old": &oldKey.PublicKey})
+	v := NewJWTVerifier(JWTConfig{
+		Issuer:              "https://issuer",
+		JWKSURL:             jwks.URL,
+		JWKSRefreshInterval: time.Hour,
+	})
+	v.UseClock(c)
+	token := func(kid string, key *ecdsa.PrivateKey) string {
+		return signJWT(t, "ES256", kid, key, map[string]any{
+			"iss": "https://issuer",
+			"exp": c.Now().Add(time.Hour).Unix(),
+		})
+	}
+
+	tests := []struct {
+		name      string
+		advance   time.Duration
+		token     string
+		wantErr   error
+		wantFetch int32
+	}{
+		{"first token fetches the key set", 0, token("old", oldKey), nil, 1},
+		{"cached key", time.Second, token("old", oldKey), nil, 1},
+		{"rotated key within the throttle", 0, token("new", newKey), ErrUnauthorized, 1},
+		{"rotated key after the throttle", minRefreshInterval, token("new", newKey), nil, 2},
+		{"stale cache is refreshed", time.Hour + time.Second, token("old", oldKey), ErrUnauthorized, 3},
+	}
+	for _, tt := range tests {
+		// The cases run in order, sharing the verifier.
+		if tt.name == "rotated key within the throttle" {
+			jwks.set(map[string]crypto.PublicKey{"new": &newKey.PublicKey})
+		}
+		c.Advance(tt.advance)
+		if _, err := v.Verify(context.Background(), tt.token); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if got := jwks.fetches.Load(); got != tt.wantFetch {
+			t.Errorf("%s: got %d fetches of the key set, want %d", tt.name, got, tt.wantFetch)
+		}
+	}
+}
+
+func TestJWTVerifierConcurrentFetch(t *testing.T) {
+	key := mustECKey(t)
+	jwks := newJWKSServer(t, map[string]crypto.PublicKey{"k": &key.PublicKey})
+	v := NewJWTVerifier(JWTConfig{Issuer: "https://issuer", JWKSURL: jwks.URL, JWKSRefreshInterval: time.Hour})
+	token := signJWT(t, "ES256", "k", key, map[string]any{
+		"iss": "https://issuer",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := v.Verify(context.Background(), token); err != nil {
+				t.Errorf("verify: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+	if got := jwks.fetches.Load(); got != 1 {
+		t.Errorf("got %d fetches of the key set, want the concurrent fetches collapsed into 1", got)
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	key := mustECKey(t)
+	jwks := newJWKSServer(t, map[string]crypto.PublicKey{"k": &key.PublicKey})
+	v := NewJWTVerifier(JWTConfig{Issuer: "https://issuer", JWKSURL: jwks.URL, JWKSRefreshInterval: time.Hour})
+	valid := signJWT(t, "ES256", "k", key, map[string]any{
+		"iss": "https://issuer",
+		"sub": "user-1",
+		"exp": time.Now().Add(time.Hour).Unix(),
+	})
+
+	tests := []struct {
+		name          string
+		authorization string
+		want          int
+	}{
+		{"valid", "Bearer " + valid, http.StatusOK},
+		{"lowercase scheme", "bearer " + valid, http.StatusOK},
+		{"missing", "", http.StatusUnauthorized},
+		{"wrong scheme", "Basic " + valid, http.StatusUnauthorized},
+		{"forged", "Bearer " + signJWT(t, "ES256", "k", mustECKey(t), map[string]any{"iss": "https://issuer"}), http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := Middleware(v)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if p, ok := PrincipalFrom(r.Context()); !ok || p.Subject != "user-1" {
+					t.Errorf("got principal %+v, want user-1", p)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.authorization != "" {
+				req.Header.Set("Authorization", tt.authorization)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+// jwksServer serves a JSON Web Key Set, counting the fetches.
+type jwksServer struct {
+	*httptest.Server
+	fetches atomic.Int32
+
+	mu   sync.Mutex
+	keys map[string]crypto.PublicKey
+}
+
+func newJWKSServer(t *testing.T, keys map[string]crypto.PublicKey) *jwksServer {
+	t.Helper()
+	s := &jwksServer{keys: keys}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		s.fetches.Add(1)
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		var set struct {
+			Keys []jwk `json:"keys"`
+		}
+		for kid, k := range s.keys {
+			set.Keys = append(set.Keys, toJWK(kid, k))
+		}
+		json.NewEncoder(w).Encode(set) //nolint:errcheck,errchkjson // test server
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func (s *jwksServer) set(keys map[string]crypto.PublicKey) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = keys
+}
+
+func toJWK(kid string, k crypto.PublicKey) jwk {
+	enc := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	switch k := k.(type) {
+	case *rsa.PublicKey:
+		return jwk{Kty: "RSA", Kid: kid, Use: "sig", N: enc(k.N), E: enc(big.NewInt(int64(k.E)))}
+	case *ecdsa.PublicKey:
+		return jwk{Kty: "EC", Kid: kid, Crv: "P-256", X: enc(k.X), Y: enc(k.Y)}
+	default:
+		panic("unsupported key")
+	}
+}
+
+// signJWT signs the claims with the key. The algorithms used by the tests are
+// ES256, RS256 and PS256.
+func signJWT(t *testing.T, alg, kid string, key crypto.Signer, claims map[string]any) string {
+	t.Helper()
+	input := segment(t, map[string]string{"alg": alg, "kid": kid, "typ": "JWT"}) + "." + segment(t, claims)
+	digest := sha256.Sum256([]byte(input))
+
+	var sig []byte
+	var err error
+	switch k := key.(type) {
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, k, digest[:])
+		sig = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	case *rsa.PrivateKey:
+		if alg == "PS256" {
+			sig, err = rsa.SignPSS(rand.Reader, k, crypto.SHA256, digest[:], nil)
+		} else {
+			sig, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		}
+	}
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
+
+// tamper replaces the claims of the token, keeping its signature.
+func tamper(token string, claims map[string]any) string {
+	parts := strings.Split(token, ".")
+	b, _ := json.Marshal(claims) //nolint:errchkjson // cannot fail
+	return parts[0] + "." + base64.RawURLEncoding.EncodeToString(b) + "." + parts[2]
+}
+
+// unsigned returns a token of the given algorithm with an empty signature.
+func unsigned(alg string, claims map[string]any) string {
+	h, _ := json.Marshal(map[string]string{"alg": alg}) //nolint:errchkjson // cannot fail
+	c, _ := json.Marshal(claims)                        //nolint:errchkjson // cannot fail
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c) + "."
+}
+
+func segment(t *testing.T, v any) string {
+	t.Helper()
+	b, err := json.Marshal(v)
+	if err != nil {
+		t.Fatalf("encode segment: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func mustECKey(t *testing.T) *ecdsa.PrivateKey {
+	t.Helper()
+	k, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return k
+}
+
+func mustRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	k, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	return k
+}
@@ -0,0 +1,242 @@
+package auth
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+
+	"github.com/eventscompass/service-template/src/internal/httperr"
+)
+
+// Policy holds authorization rules for the routes and rpcs of the service, for
+// cases that are not covered by declaring a [Requirement] per route. Policies
+// are written as json:
+//
+//	{
+//		"default": "deny",
+//		"rules": [
+//			{"methods": ["GET"], "path": "/venues/**", "scopes": ["venues:read"]},
+//			{"path": "/venues/**", "roles": ["editor", "admin"]},
+//			{"path": "/users/{id}/**", "owner": "id"},
+//			{"rpc": "/venues.v1.Venues/*", "roles": ["admin"]},
+//			{"path": "/internal/**", "deny": true}
+//		]
+//	}
+//
+// The first rule matching the request decides. A path segment "*" matches any
+// single segment, "{name}" matches any single segment and captures it, and a
+// trailing "**" matches the rest of the path. Rpcs are matched by their full
+// method name in the same way. The "owner" of a rule names a captured segment
+// that must be equal to the subject of the caller. Requests that match no rule
+// are denied, unless the default is "allow".
+type Policy struct {
+	Default string       `json:"default"`
+	Rules   []PolicyRule `json:"rules"`
+}
+
+// PolicyRule is a single rule of a [Policy].
+type PolicyRule struct {
+	// Methods restricts the rule to the given http methods.
+	// Empty means any method.
+	Methods []string `json:"methods,omitempty"`
+
+	// Path is the path pattern of the rule for http requests.
+	Path string `json:"path,omitempty"`
+
+	// RPC is the method pattern of the rule for grpc calls.
+	RPC string `json:"rpc,omitempty"`
+
+	// Requirement has to be satisfied by the caller.
+	Requirement
+
+	// Owner is the captured path segment that must be equal to
+	// the subject of the caller.
+	Owner string `json:"owner,omitempty"`
+
+	// Deny rejects all matching requests.
+	Deny bool `json:"deny,omitempty"`
+}
+
+// LoadPolicy reads the policy from the given json file. This function returns
+// [service.ErrNotFound] in case the file does not exist, and
+// [service.ErrBadRequest] in case the policy is invalid.
+func LoadPolicy(path string) (*Policy, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: policy file %q", service.ErrNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: read policy: %v", service.ErrUnexpected, err)
+	}
+	return ParsePolicy(data)
+}
+
+// ParsePolicy parses a json policy. This function returns
+// [service.ErrBadRequest] in case the policy is invalid.
+func ParsePolicy(data []byte) (*Policy, error) {
+	var p Policy
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&p); err != nil {
+		return nil, fmt.Errorf("%w: decode policy: %v", service.ErrBadRequest, err)
+	}
+	if p.Default != "" && p.Default != "allow" && p.Default != "deny" {
+		return nil, fmt.Errorf("%w: invalid policy default %q", service.ErrBadRequest, p.Default)
+	}
+	for i, r := range p.Rules {
+		if (r.Path == "") == (r.RPC == "") {
+			return nil, fmt.Errorf("%w: policy rule %d must have either a path or an rpc",
+				service.ErrBadRequest, i)
+		}
+		if r.Owner != "" && !strings.Contains(r.Path, "{"+r.Owner+"}") {
+			return nil, fmt.Errorf("%w: policy rule %d does not capture the owner %q",
+				service.ErrBadRequest, i, r.Owner)
+		}
+	}
+	return &p, nil
+}
+
+// Check authorizes the principal of ctx to perform a request with the given
+// http method and path. This function returns [ErrUnauthorized] in case ctx
+// carries no principal, and [service.ErrNotAllowed] in case the policy denies
+// the request.
+func (p *Policy) Check(ctx context.Context, method, path string) error {
+	for _, r := range p.Rules {
+		if r.Path == "" || (len(r.Methods) > 0 && !containsFold(r.Methods, method)) {
+			continue
+		}
+		if params, ok := matchPattern(r.Path, path); ok {
+			return r.check(ctx, params)
+		}
+	}
+	return p.fallback()
+}
+
+// CheckRPC authorizes the principal of ctx to call the rpc with the given full
+// method name. It returns the same errors as [Policy.Check].
+func (p *Policy) CheckRPC(ctx context.Context, fullMethod string) error {
+	for _, r := range p.Rules {
+		if r.RPC == "" {
+			continue
+		}
+		if params, ok := matchPattern(r.RPC, fullMethod); ok {
+			return r.check(ctx, params)
+		}
+	}
+	return p.fallback()
+}
+
+// Middleware returns an http middleware enforcing the policy. It must be
+// installed after one of the authentication middlewares.
+func (p *Policy) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := p.Check(r.Context(), r.Method, r.URL.Path); err != nil {
+				httperr.Write(r.Context(), w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UnaryServerInterceptor returns a grpc interceptor enforcing the policy. It
+// must be chained after one of the authentication interceptors.
+func (p *Policy) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if err := p.CheckRPC(ctx, info.FullMethod); err != nil {
+			return nil, grpcError(err)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming variant of
+// [Policy.UnaryServerInterceptor].
+func (p *Policy) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		if err := p.CheckRPC(ss.Context(), info.FullMethod); err != nil {
+			return grpcError(err)
+		}
+		return handler(srv, ss)
+	}
+}
+
+// fallback applies the default of the policy to a request that matched no
+// rule.
+func (p *Policy) fallback() error {
+	if p.Default == "allow" {
+		return nil
+	}
+	return fmt.Errorf("%w: denied by policy", service.ErrNotAllowed)
+}
+
+// check applies the rule to the principal of ctx.
+func (r PolicyRule) check(ctx context.Context, params map[string]string) error {
+	if r.Deny {
+		return fmt.Errorf("%w: denied by policy", service.ErrNotAllowed)
+	}
+	if err := Authorize(ctx, r.Requirement); err != nil {
+		return err
+	}
+	if r.Owner != "" {
+		if p, _ := PrincipalFrom(ctx); p.Subject != params[r.Owner] {
+			return fmt.Errorf("%w: caller does not own the resource", service.ErrNotAllowed)
+		}
+	}
+	return nil
+}
+
+// matchPattern matches the path against the pattern and returns the captured
+// segments.
+func matchPattern(pattern, path string) (map[string]string, bool) {
+	ps := strings.Split(strings.Trim(pattern, "/"), "/")
+	ss := strings.Split(strings.Trim(path, "/"), "/")
+	var params map[string]string
+	for i, p := range ps {
+		if p == "**" && i == len(ps)-1 {
+			return params, true
+		}
+		if i >= len(ss) {
+			return nil, false
+		}
+		switch {
+		case p == "*":
+		case strings.HasPrefix(p, "{") && strings.HasSuffix(p, "}"):
+			if params == nil {
+				params = make(map[string]string)
+			}
+			params[p[1:len(p)-1]] = ss[i]
+		case p != ss[i]:
+			return nil, false
+		}
+	}
+	return params, len(ps) == len(ss)
+}
+
+// containsFold reports whether the list contains the value, ignoring case.
+func containsFold(list []string, v string) bool {
+	for _, s := range list {
+		if strings.EqualFold(s, v) {
+			return true
+		}
+	}
+	return false
+}
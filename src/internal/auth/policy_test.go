@@ -0,0 +1,212 @@
+package auth
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+const testPolicy = `{
+	"rules": [
+		{"path": "/internal/**", "deny": true},
+		{"methods": ["GET"], "path": "/venues/**", "scopes": ["venues:read"]},
+		{"path": "/venues/**", "roles": ["editor", "admin"]},
+		{"path": "/users/{id}/**", "owner": "id"},
+		{"path": "/events/*/tickets", "scopes": ["tickets:read", "events:read"]},
+		{"rpc": "/venues.v1.Venues/GetVenue", "scopes": ["venues:read"]},
+		{"rpc": "/venues.v1.Venues/*", "roles": ["admin"]}
+	]
+}`
+
+func TestPolicyCheck(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	reader := &Principal{Subject: "u-1", Scopes: []string{"venues:read"}}
+	editor := &Principal{Subject: "u-2", Roles: []string{"editor"}}
+	admin := &Principal{Subject: "u-3", Roles: []string{"admin"}, Scopes: []string{"venues:read"}}
+	tests := []struct {
+		name      string
+		principal *Principal
+		method    string
+		path      string
+		wantErr   error
+	}{
+		{"scope grants reads", reader, http.MethodGet, "/venues/v-1", nil},
+		{"get rule decides before role rule", editor, http.MethodGet, "/venues/v-1", service.ErrNotAllowed},
+		{"role rule matches other methods", editor, http.MethodPost, "/venues", nil},
+		{"method is case insensitive", reader, "get", "/venues", nil},
+		{"scope does not grant writes", reader, http.MethodPost, "/venues", service.ErrNotAllowed},
+		{"deny rule decides first", admin, http.MethodGet, "/internal/debug", service.ErrNotAllowed},
+		{"owner", reader, http.MethodGet, "/users/u-1/orders", nil},
+		{"not the owner", editor, http.MethodGet, "/users/u-1/orders", service.ErrNotAllowed},
+		{"wildcard segment", &Principal{Scopes: []string{"tickets:read", "events:read"}},
+			http.MethodGet, "/events/e-1/tickets", nil},
+		{"wildcard segment needs all scopes", &Principal{Scopes: []string{"tickets:read"}},
+			http.MethodGet, "/events/e-1/tickets", service.ErrNotAllowed},
+		{"wildcard segment matches one segment", admin, http.MethodGet, "/events/e-1/x/tickets",
+			service.ErrNotAllowed},
+		{"scopes are not patterns", &Principal{Scopes: []string{"venues:*"}}, http.MethodGet, "/venues",
+			service.ErrNotAllowed},
+		{"no rule denies by default", admin, http.MethodGet, "/orders", service.ErrNotAllowed},
+		{"no principal", nil, http.MethodGet, "/venues", ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = WithPrincipal(ctx, tt.principal)
+			}
+			if err := p.Check(ctx, tt.method, tt.path); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyCheckRPC(t *testing.T) {
+	p, err := ParsePolicy([]byte(testPolicy))
+	if err != nil {
+		t.Fatalf("parse policy: %v", err)
+	}
+	tests := []struct {
+		name      string
+		principal *Principal
+		method    string
+		wantErr   error
+	}{
+		{"exact rule decides first", &Principal{Scopes: []string{"venues:read"}}, "/venues.v1.Venues/GetVenue", nil},
+		{"wildcard rule", &Principal{Roles: []string{"admin"}}, "/venues.v1.Venues/CreateVenue", nil},
+		{"wildcard rule denies", &Principal{Scopes: []string{"venues:read"}}, "/venues.v1.Venues/CreateVenue",
+			service.ErrNotAllowed},
+		{"path rules do not apply", &Principal{Roles: []string{"admin"}}, "/internal/Debug", service.ErrNotAllowed},
+		{"no rule denies by default", &Principal{Roles: []string{"admin"}}, "/users.v1.Users/GetUser",
+			service.ErrNotAllowed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := WithPrincipal(context.Background(), tt.principal)
+			if err := p.CheckRPC(ctx, tt.method); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPolicyDefault(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr error
+	}{
+		{"empty", `{}`, service.ErrNotAllowed},
+		{"deny", `{"default": "deny"}`, service.ErrNotAllowed},
+		{"allow", `{"default": "allow"}`, nil},
+		{"allow only unmatched", `{"default": "allow", "rules": [{"path": "/orders", "deny": true}]}`,
+			service.ErrNotAllowed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := ParsePolicy([]byte(tt.policy))
+			if err != nil {
+				t.Fatalf("parse policy: %v", err)
+			}
+			ctx := WithPrincipal(context.Background(), &Principal{Subject: "u-1"})
+			if err := p.Check(ctx, http.MethodGet, "/orders"); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestParsePolicy(t *testing.T) {
+	tests := []struct {
+		name    string
+		policy  string
+		wantErr error
+	}{
+		{"valid", testPolicy, nil},
+		{"malformed", `{"rules": [`, service.ErrBadRequest},
+		{"unknown field", `{"rules": [{"path": "/venues", "scope": ["venues:read"]}]}`, service.ErrBadRequest},
+		{"invalid default", `{"default": "maybe"}`, service.ErrBadRequest},
+		{"neither path nor rpc", `{"rules": [{"deny": true}]}`, service.ErrBadRequest},
+		{"path and rpc", `{"rules": [{"path": "/venues", "rpc": "/venues.v1.Venues/*"}]}`, service.ErrBadRequest},
+		{"owner not captured", `{"rules": [{"path": "/users/{id}", "owner": "user"}]}`, service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := ParsePolicy([]byte(tt.policy)); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestLoadPolicy(t *testing.T) {
+	dir := t.TempDir()
+	valid := filepath.Join(dir, "valid.json")
+	invalid := filepath.Join(dir, "invalid.json")
+	if err := os.WriteFile(valid, []byte(testPolicy), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	if err := os.WriteFile(invalid, []byte(`{"default": "maybe"}`), 0o600); err != nil {
+		t.Fatalf("write policy: %v", err)
+	}
+	tests := []struct {
+		name    string
+		path    string
+		wantErr error
+	}{
+		{"valid", valid, nil},
+		{"invalid", invalid, service.ErrBadRequest},
+		{"missing", filepath.Join(dir, "missing.json"), service.ErrNotFound},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := LoadPolicy(tt.path); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAuthorize(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		req       Requirement
+		wantErr   error
+	}{
+		{"authenticated", &Principal{}, Requirement{}, nil},
+		{"not authenticated", nil, Requirement{}, ErrUnauthorized},
+		{"any role", &Principal{Roles: []string{"editor"}}, RequireRoles("admin", "editor"), nil},
+		{"no role", &Principal{Roles: []string{"viewer"}}, RequireRoles("admin", "editor"), service.ErrNotAllowed},
+		{"all scopes", &Principal{Scopes: []string{"a", "b"}}, RequireScopes("a", "b"), nil},
+		{"missing scope", &Principal{Scopes: []string{"a"}}, RequireScopes("a", "b"), service.ErrNotAllowed},
+		{"roles and scopes", &Principal{Roles: []string{"admin"}},
+			Requirement{Roles: []string{"admin"}, Scopes: []string{"a"}}, service.ErrNotAllowed},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = WithPrincipal(ctx, tt.principal)
+			}
+			if err := Authorize(ctx, tt.req); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,205 @@
+package auth
+
+import (
+	"container/heap"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+// HMACConfig encapsulates the configuration for verifying signed requests.
+type HMACConfig struct {
+	// Header is the request header carrying the signature.
+	Header string `env:"AUTH_HMAC_HEADER" envDefault:"X-Signature"`
+
+	// Secrets are the active signing secrets, formatted as
+	// "<caller>:<secret>". A caller may have several secrets
+	// while a secret is being rotated.
+	Secrets []string `env:"AUTH_HMAC_SECRETS,notEmpty"`
+
+	// Tolerance is the maximum age of a signed request. Older
+	// requests are rejected as replays.
+	Tolerance time.Duration `env:"AUTH_HMAC_TOLERANCE" envDefault:"5m"`
+
+	// MaxBodySize limits the size of the signed body.
+	MaxBodySize int64 `env:"AUTH_HMAC_MAX_BODY_SIZE" envDefault:"1048576"`
+}
+
+// SignatureVerifier verifies requests signed with a shared secret, e.g. by
+// webhook senders and partners. The signature header has the form
+//
+//	t=<unix timestamp>,v1=<hex hmac>
+//
+// where the hmac is the HMAC-SHA256 of "<timestamp>.<body>". The header may
+// contain several v1 values, so that the sender can sign with an old and a new
+// secret during a rotation. Every replica accepts a signature only once within
+// the tolerance window.
+type SignatureVerifier struct {
+	cfg     HMACConfig
+	secrets []hmacSecret
+	clock   clock.Clock
+
+	mu   sync.Mutex
+	seen map[string]time.Time
+	exp  expiryHeap // the keys of seen, the earliest expiring first
+}
+
+var _ WebhookVerifier = (*SignatureVerifier)(nil)
+
+// NewSignatureVerifier creates a new [SignatureVerifier]. This function returns
+// [service.ErrBadRequest] in case a secret is malformed.
+func NewSignatureVerifier(cfg HMACConfig) (*SignatureVerifier, error) {
+	v := &SignatureVerifier{cfg: cfg, clock: clock.Real, seen: make(map[string]time.Time)}
+	for _, s := range cfg.Secrets {
+		caller, secret, ok := strings.Cut(s, ":")
+		if !ok || caller == "" || secret == "" {
+			return nil, fmt.Errorf("%w: malformed hmac secret", service.ErrBadRequest)
+		}
+		v.secrets = append(v.secrets, hmacSecret{caller: caller, key: []byte(secret)})
+	}
+	return v, nil
+}
+
+// UseClock makes the middleware of the verifier use the given clock for the
+// time the requests are received, e.g. a fake clock in tests. UseClock must be
+// called before [SignatureVerifier.Middleware].
+func (v *SignatureVerifier) UseClock(c clock.Clock) {
+	v.clock = clock.Or(c)
+}
+
+// Middleware returns an http middleware that verifies the signature of every
+// request. The caller owning the matching secret is put into the request
+// context as principal. Requests with a missing, invalid, or expired signature
+// are rejected with 401.
+func (v *SignatureVerifier) Middleware() func(http.Handler) http.Handler {
+	return WebhookMiddleware(v, v.cfg.MaxBodySize, v.clock)
+}
+
+// VerifyWebhook implements the [WebhookVerifier] interface, see
+// [SignatureVerifier.Verify].
+func (v *SignatureVerifier) VerifyWebhook(
+	h http.Header,
+	body []byte,
+	now time.Time,
+) (*Principal, error) {
+	return v.Verify(h.Get(v.cfg.Header), body, now)
+}
+
+// Verify verifies the signature header of a request with the given body,
+// received at the given time. This function returns [ErrUnauthorized] in case
+// the signature is missing, invalid, expired, or was already used.
+func (v *SignatureVerifier) Verify(header string, body []byte, now time.Time) (*Principal, error) {
+	var (
+		ts   string
+		sigs [][]byte
+	)
+	for _, part := range strings.Split(header, ",") {
+		k, val, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			ts = val
+		case "v1":
+			if sig, err := hex.DecodeString(val); err == nil {
+				sigs = append(sigs, sig)
+			}
+		}
+	}
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil || len(sigs) == 0 {
+		return nil, fmt.Errorf("%w: missing or malformed signature", ErrUnauthorized)
+	}
+	signed := time.Unix(sec, 0)
+	if d := now.Sub(signed); d > v.cfg.Tolerance || d < -v.cfg.Tolerance {
+		return nil, fmt.Errorf("%w: signature timestamp outside the tolerance", ErrUnauthorized)
+	}
+
+	for _, s := range v.secrets {
+		expected := sign(s.key, ts, body)
+		for _, sig := range sigs {
+			if !hmac.Equal(sig, expected) {
+				continue
+			}
+			if !v.firstUse(expected, signed.Add(v.cfg.Tolerance), now) {
+				return nil, fmt.Errorf("%w: signature was already used", ErrUnauthorized)
+			}
+			return &Principal{Subject: s.caller, Issuer: hmacIssuer}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+}
+
+// SignatureHeader returns the signature header for a request with the given
+// body, signed with the secret at the given time. It is meant for clients and
+// tests.
+func SignatureHeader(secret string, body []byte, t time.Time) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(sign([]byte(secret), ts, body))
+}
+
+// firstUse records the signature until it expires, and reports whether it was
+// not seen before. Only the expired signatures are pruned, in the order they
+// expire, thus a call costs O(log n) amortized.
+func (v *SignatureVerifier) firstUse(sig []byte, expires, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	for len(v.exp) > 0 && now.After(v.exp[0].expires) {
+		delete(v.seen, heap.Pop(&v.exp).(expiry).key) //nolint:forcetypeassert // the heap holds expiries
+	}
+	key := string(sig)
+	if _, ok := v.seen[key]; ok {
+		return false
+	}
+	v.seen[key] = expires
+	heap.Push(&v.exp, expiry{key: key, expires: expires})
+	return true
+}
+
+// expiry is the expiration time of a seen signature.
+type expiry struct {
+	key     string
+	expires time.Time
+}
+
+// expiryHeap orders the seen signatures by their expiration time, see
+// [container/heap].
+type expiryHeap []expiry
+
+func (h expiryHeap) Len() int           { return len(h) }
+func (h expiryHeap) Less(i, j int) bool { return h[i].expires.Before(h[j].expires) }
+func (h expiryHeap) Swap(i, j int)      { h[i], h[j] = h[j], h[i] }
+func (h *expiryHeap) Push(x any)        { *h = append(*h, x.(expiry)) } //nolint:forcetypeassert // see heap.Push
+
+func (h *expiryHeap) Pop() any {
+	old := *h
+	x := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return x
+}
+
+// hmacSecret is a secret of a caller.
+type hmacSecret struct {
+	caller string
+	key    []byte
+}
+
+// sign computes the signature of the body at the given timestamp.
+func sign(key []byte, ts string, body []byte) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return mac.Sum(nil)
+}
+
+// hmacIssuer is the issuer of the principals authenticated by signatures.
+const hmacIssuer = "hmac"
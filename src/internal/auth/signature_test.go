@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestNewSignatureVerifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		secret  string
+		wantErr error
+	}{
+		{"valid", "partner:secret", nil},
+		{"secret with colon", "partner:sec:ret", nil},
+		{"missing caller", ":secret", service.ErrBadRequest},
+		{"missing secret", "partner:", service.ErrBadRequest},
+		{"missing separator", "secret", service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewSignatureVerifier(HMACConfig{Secrets: []string{tt.secret}}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"event":"paid"}`)
+	ts := strconv.FormatInt(now.Unix(), 10)
+
+	tests := []struct {
+		name       string
+		header     string
+		body       []byte
+		wantCaller string
+		wantErr    error
+	}{
+		{"valid", SignatureHeader("secret-a", body, now), body, "a", nil},
+		{"second caller", SignatureHeader("secret-b", body, now), body, "b", nil},
+		{"rotated secret", SignatureHeader("old-a", body, now), body, "a", nil},
+		{
+			"several signatures",
+			SignatureHeader("unknown", body, now) + "," + strings.Split(SignatureHeader("secret-a", body, now), ",")[1],
+			body, "a", nil,
+		},
+		{"within the tolerance", SignatureHeader("secret-a", body, now.Add(-4*time.Minute)), body, "a", nil},
+		{"unknown secret", SignatureHeader("unknown", body, now), body, "", ErrUnauthorized},
+		{"tampered body", SignatureHeader("secret-a", body, now), []byte(`{"event":"refunded"}`), "", ErrUnauthorized},
+		{"expired", SignatureHeader("secret-a", body, now.Add(-6*time.Minute)), body, "", ErrUnauthorized},
+		{"from the future", SignatureHeader("secret-a", body, now.Add(6*time.Minute)), body, "", ErrUnauthorized},
+		{"tampered timestamp", "t=" + strconv.FormatInt(now.Unix()+1, 10) + "," +
+			strings.Split(SignatureHeader("secret-a", body, now), ",")[1], body, "", ErrUnauthorized},
+		{"missing timestamp", "v1=" + strings.Repeat("00", 32), body, "", ErrUnauthorized},
+		{"missing signature", "t=" + ts, body, "", ErrUnauthorized},
+		{"malformed signature", "t=" + ts + ",v1=zz", body, "", ErrUnauthorized},
+		{"empty", "", body, "", ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewSignatureVerifier(HMACConfig{
+				Secrets:   []string{"a:secret-a", "a:old-a", "b:secret-b"},
+				Tolerance: 5 * time.Minute,
+			})
+			if err != nil {
+				t.Fatalf("create verifier: %v", err)
+			}
+			p, err := v.Verify(tt.header, tt.body, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Subject != tt.wantCaller || p.Issuer != hmacIssuer) {
+				t.Errorf("got principal %+v, want caller %s", p, tt.wantCaller)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifierReplay(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("body")
+	header := SignatureHeader("secret", body, now)
+
+	tests := []struct {
+		name    string
+		header  string
+		at      time.Time
+		wantErr error
+	}{
+		{"first use", header, now, nil},
+		{"replay", header, now.Add(time.Second), ErrUnauthorized},
+		{"replay at the end of the tolerance", header, now.Add(5 * time.Minute), ErrUnauthorized},
+		{"new signature", SignatureHeader("secret", body, now.Add(time.Second)), now.Add(time.Second), nil},
+		{"replay after the tolerance", header, now.Add(5*time.Minute + time.Second), ErrUnauthorized},
+	}
+	v, _ := NewSignatureVerifier(HMACConfig{Secrets: []string{"a:secret"}, Tolerance: 5 * time.Minute})
+	for _, tt := range tests {
+		// The cases run in order, sharing the seen signatures.
+		if _, err := v.Verify(tt.header, body, tt.at); !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+	}
+}
+
+func TestSignatureVerifierPruning(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v, _ := NewSignatureVerifier(HMACConfig{Secrets: []string{"a:secret"}, Tolerance: time.Minute})
+	for i := 0; i < 10; i++ {
+		signed := now.Add(time.Duration(i) * time.Second)
+		body := []byte(strconv.Itoa(i))
+		if _, err := v.Verify(SignatureHeader("secret", body, signed), body, signed); err != nil {
+			t.Fatalf("verify: %v", err)
+		}
+	}
+
+	tests := []struct {
+		name string
+		at   time.Time
+		want int // of the first ten signatures
+	}{
+		{"none expired", now.Add(time.Minute), 10},
+		{"some expired", now.Add(time.Minute + 4*time.Second + time.Millisecond), 5},
+		{"all expired", now.Add(2 * time.Minute), 0},
+	}
+	for i, tt := range tests {
+		// Every verification prunes the expired signatures, and records
+		// its own, which expire after the first ten.
+		body := []byte("probe" + strconv.Itoa(i))
+		if _, err := v.Verify(SignatureHeader("secret", body, tt.at), body, tt.at); err != nil {
+			t.Fatalf("%s: verify: %v", tt.name, err)
+		}
+		v.mu.Lock()
+		got, heapLen := len(v.seen), len(v.exp)
+		v.mu.Unlock()
+		if want := tt.want + i + 1; got != want || heapLen != want {
+			t.Errorf("%s: got %d seen signatures and %d expiries, want %d", tt.name, got, heapLen, want)
+		}
+	}
+}
+
+func TestSignatureVerifierMiddleware(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v, _ := NewSignatureVerifier(HMACConfig{
+		Header:      "X-Signature",
+		Secrets:     []string{"a:secret"},
+		Tolerance:   5 * time.Minute,
+		MaxBodySize: 16,
+	})
+	v.UseClock(servicetest.NewFakeClock(now))
+	tests := []struct {
+		name   string
+		body   string
+		header func(body string) string
+		want   int
+	}{
+		{"valid", "hello", func(b string) string { return SignatureHeader("secret", []byte(b), now) }, http.StatusOK},
+		{"bad signature", "hello", func(b string) string { return SignatureHeader("wrong", []byte(b), now) }, http.StatusUnauthorized},
+		{"missing signature", "hello", func(string) string { return "" }, http.StatusUnauthorized},
+		{"expired signature", "hello", func(b string) string {
+			return SignatureHeader("secret", []byte(b), now.Add(-6*time.Minute))
+		}, http.StatusUnauthorized},
+		{"body too large", strings.Repeat("x", 17), func(b string) string {
+			return SignatureHeader("secret", []byte(b), now)
+		}, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := v.Middleware()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				// The verified body is passed on.
+				if b, _ := io.ReadAll(r.Body); string(b) != tt.body {
+					t.Errorf("got body %q, want %q", b, tt.body)
+				}
+				if p, ok := PrincipalFrom(r.Context()); !ok || p.Subject != "a" {
+					t.Errorf("got principal %+v, want a", p)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(tt.body))
+			req.Header.Set("X-Signature", tt.header(tt.body))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package auth
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/httperr"
+)
+
+// WebhookVerifier verifies the signature of an inbound webhook request, see
+// [WebhookMiddleware]. [SignatureVerifier] is a webhook verifier as well.
+type WebhookVerifier interface {
+	// VerifyWebhook returns the principal of the sender of a
+	// request with the given headers and body, received at the
+	// given time. Returns [ErrUnauthorized] in case the signature
+	// is missing or invalid.
+	VerifyWebhook(_ http.Header, body []byte, now time.Time) (*Principal, error)
+}
+
+// WebhookMiddleware returns an http middleware that verifies the signature of
+// every request with the verifier. The body is read up to maxBodySize bytes,
+// verified, and passed on to the next handler. The sender is put into the
+// request context as principal. Requests with a missing or invalid signature
+// are rejected with 401, oversized requests with 400. The requests are
+// received at the time of c, or of [clock.Real] if c is nil.
+func WebhookMiddleware(
+	v WebhookVerifier,
+	maxBodySize int64,
+	c clock.Clock,
+) func(http.Handler) http.Handler {
+	c = clock.Or(c)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			body, err := io.ReadAll(io.LimitReader(r.Body, maxBodySize+1))
+			if err != nil {
+				httperr.Write(ctx, w, fmt.Errorf("%w: read body: %v", service.ErrBadRequest, err))
+				return
+			}
+			if int64(len(body)) > maxBodySize {
+				httperr.Write(ctx, w, fmt.Errorf("%w: body too large", service.ErrBadRequest))
+				return
+			}
+			p, err := v.VerifyWebhook(r.Header, body, c.Now())
+			if err != nil {
+				httperr.Write(ctx, w, err)
+				return
+			}
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			next.ServeHTTP(w, r.WithContext(WithPrincipal(ctx, p)))
+		})
+	}
+}
+
+// NewStripeVerifier returns a verifier for webhooks signed like Stripe's, i.e.
+// with a "Stripe-Signature" header in the format of [SignatureVerifier]. The
+// secrets are the signing secrets of the endpoint ("whsec_..."), several while
+// a secret is being rolled. The principal has "stripe" as subject.
+func NewStripeVerifier(tolerance time.Duration, secrets ...string) *SignatureVerifier {
+	v := &SignatureVerifier{
+		cfg:   HMACConfig{Header: "Stripe-Signature", Tolerance: tolerance, MaxBodySize: 1 << 20},
+		clock: clock.Real,
+		seen:  make(map[string]time.Time),
+	}
+	for _, s := range secrets {
+		v.secrets = append(v.secrets, hmacSecret{caller: "stripe", key: []byte(s)})
+	}
+	return v
+}
+
+// GitHubVerifier verifies webhooks signed like GitHub's, i.e. with the header
+//
+//	X-Hub-Signature-256: sha256=<hex hmac of the body>
+//
+// The signature does not include a timestamp, thus replays cannot be detected
+// by the signature: handlers deduplicate deliveries by the "delivery" claim,
+// which holds the X-GitHub-Delivery header. The "event" claim holds the
+// X-GitHub-Event header.
+type GitHubVerifier struct {
+	secrets [][]byte
+}
+
+var _ WebhookVerifier = (*GitHubVerifier)(nil)
+
+// NewGitHubVerifier creates a new [GitHubVerifier] accepting signatures of any
+// of the secrets.
+func NewGitHubVerifier(secrets ...string) *GitHubVerifier {
+	v := &GitHubVerifier{}
+	for _, s := range secrets {
+		v.secrets = append(v.secrets, []byte(s))
+	}
+	return v
+}
+
+// VerifyWebhook implements the [WebhookVerifier] interface. This function
+// returns [ErrUnauthorized] in case the signature is missing or invalid.
+func (v *GitHubVerifier) VerifyWebhook(
+	h http.Header,
+	body []byte,
+	_ time.Time,
+) (*Principal, error) {
+	sig, ok := strings.CutPrefix(h.Get("X-Hub-Signature-256"), "sha256=")
+	if !ok {
+		return nil, fmt.Errorf("%w: missing or malformed signature", ErrUnauthorized)
+	}
+	got, err := hex.DecodeString(sig)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing or malformed signature", ErrUnauthorized)
+	}
+	for _, key := range v.secrets {
+		mac := hmac.New(sha256.New, key)
+		mac.Write(body)
+		if hmac.Equal(got, mac.Sum(nil)) {
+			return &Principal{
+				Subject: "github",
+				Issuer:  webhookIssuer,
+				Claims: map[string]any{
+					"delivery": h.Get("X-GitHub-Delivery"),
+					"event":    h.Get("X-GitHub-Event"),
+				},
+			}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+}
+
+// TimestampedHMACConfig configures a [TimestampedHMACVerifier] for a webhook
+// sender.
+type TimestampedHMACConfig struct {
+	// Sender is the subject of the principal.
+	Sender string
+
+	// Secrets are the signing secrets of the sender.
+	Secrets []string
+
+	// SignatureHeader is the header carrying the signature,
+	// TimestampHeader the header carrying the unix timestamp.
+	SignatureHeader string
+	TimestampHeader string
+
+	// Prefix is stripped from the signature, e.g. "sha256=".
+	Prefix string
+
+	// Base64 reports whether the signature is base64 encoded
+	// instead of hex encoded.
+	Base64 bool
+
+	// Tolerance is the maximum age of a request.
+	Tolerance time.Duration
+}
+
+// TimestampedHMACVerifier verifies webhooks carrying the signature and the
+// timestamp in separate headers, where the signature is the HMAC-SHA256 of
+// "<timestamp>.<body>". This covers most senders that are not supported by a
+// dedicated verifier.
+type TimestampedHMACVerifier struct {
+	cfg TimestampedHMACConfig
+}
+
+var _ WebhookVerifier = (*TimestampedHMACVerifier)(nil)
+
+// NewTimestampedHMACVerifier creates a new [TimestampedHMACVerifier]. This
+// function returns [service.ErrBadRequest] in case the configuration lacks the
+// secrets or the headers.
+func NewTimestampedHMACVerifier(cfg TimestampedHMACConfig) (*TimestampedHMACVerifier, error) {
+	if len(cfg.Secrets) == 0 || cfg.SignatureHeader == "" || cfg.TimestampHeader == "" {
+		return nil, fmt.Errorf("%w: webhook secrets and headers are required", service.ErrBadRequest)
+	}
+	return &TimestampedHMACVerifier{cfg: cfg}, nil
+}
+
+// VerifyWebhook implements the [WebhookVerifier] interface. This function
+// returns [ErrUnauthorized] in case the signature is missing, invalid, or
+// expired.
+func (v *TimestampedHMACVerifier) VerifyWebhook(
+	h http.Header,
+	body []byte,
+	now time.Time,
+) (*Principal, error) {
+	ts := h.Get(v.cfg.TimestampHeader)
+	sec, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("%w: missing or malformed timestamp", ErrUnauthorized)
+	}
+	if d := now.Sub(time.Unix(sec, 0)); d > v.cfg.Tolerance || d < -v.cfg.Tolerance {
+		return nil, fmt.Errorf("%w: signature timestamp outside the tolerance", ErrUnauthorized)
+	}
+
+	sig := strings.TrimPrefix(h.Get(v.cfg.SignatureHeader), v.cfg.Prefix)
+	var got []byte
+	if v.cfg.Base64 {
+		got, err = base64.StdEncoding.DecodeString(sig)
+	} else {
+		got, err = hex.DecodeString(sig)
+	}
+	if err != nil || len(got) == 0 {
+		return nil, fmt.Errorf("%w: missing or malformed signature", ErrUnauthorized)
+	}
+	for _, s := range v.cfg.Secrets {
+		if hmac.Equal(got, sign([]byte(s), ts, body)) {
+			return &Principal{Subject: v.cfg.Sender, Issuer: webhookIssuer}, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: invalid signature", ErrUnauthorized)
+}
+
+// webhookIssuer is the issuer of the principals authenticated by webhook
+// signatures.
+const webhookIssuer = "webhook"
@@ -0,0 +1,201 @@
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+func TestGitHubVerifier(t *testing.T) {
+	body := []byte(`{"action":"opened"}`)
+	signature := func(secret string, body []byte) string {
+		mac := hmac.New(sha256.New, []byte(secret))
+		mac.Write(body)
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+
+	tests := []struct {
+		name      string
+		signature string
+		body      []byte
+		wantErr   error
+	}{
+		{"valid", signature("secret", body), body, nil},
+		{"rolled secret", signature("old", body), body, nil},
+		{"wrong secret", signature("wrong", body), body, ErrUnauthorized},
+		{"tampered body", signature("secret", body), []byte(`{"action":"closed"}`), ErrUnauthorized},
+		{"sha1 signature", "sha1=" + strings.TrimPrefix(signature("secret", body), "sha256="), body, ErrUnauthorized},
+		{"malformed hex", "sha256=zz", body, ErrUnauthorized},
+		{"missing", "", body, ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := http.Header{}
+			h.Set("X-Hub-Signature-256", tt.signature)
+			h.Set("X-GitHub-Delivery", "d-1")
+			h.Set("X-GitHub-Event", "pull_request")
+			p, err := NewGitHubVerifier("secret", "old").VerifyWebhook(h, tt.body, time.Now())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Subject != "github" || p.Claims["delivery"] != "d-1" || p.Claims["event"] != "pull_request") {
+				t.Errorf("got principal %+v, want github with the delivery and event claims", p)
+			}
+		})
+	}
+}
+
+func TestStripeVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte(`{"type":"charge.succeeded"}`)
+	v := NewStripeVerifier(5*time.Minute, "whsec_new", "whsec_old")
+
+	tests := []struct {
+		name    string
+		header  string
+		at      time.Time
+		wantErr error
+	}{
+		{"valid", SignatureHeader("whsec_new", body, now), now, nil},
+		{"rolled secret", SignatureHeader("whsec_old", body, now.Add(time.Second)), now, nil},
+		{"replay", SignatureHeader("whsec_new", body, now), now.Add(time.Minute), ErrUnauthorized},
+		{"expired", SignatureHeader("whsec_new", body, now.Add(-10*time.Minute)), now, ErrUnauthorized},
+		{"wrong secret", SignatureHeader("whsec_other", body, now), now, ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		// The cases run in order, sharing the seen signatures.
+		h := http.Header{}
+		h.Set("Stripe-Signature", tt.header)
+		p, err := v.VerifyWebhook(h, body, tt.at)
+		if !errors.Is(err, tt.wantErr) {
+			t.Errorf("%s: got error %v, want %v", tt.name, err, tt.wantErr)
+		}
+		if err == nil && p.Subject != "stripe" {
+			t.Errorf("%s: got principal %+v, want stripe", tt.name, p)
+		}
+	}
+}
+
+func TestNewTimestampedHMACVerifier(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     TimestampedHMACConfig
+		wantErr error
+	}{
+		{"valid", TimestampedHMACConfig{Secrets: []string{"s"}, SignatureHeader: "X-Sig", TimestampHeader: "X-Ts"}, nil},
+		{"no secrets", TimestampedHMACConfig{SignatureHeader: "X-Sig", TimestampHeader: "X-Ts"}, service.ErrBadRequest},
+		{"no signature header", TimestampedHMACConfig{Secrets: []string{"s"}, TimestampHeader: "X-Ts"}, service.ErrBadRequest},
+		{"no timestamp header", TimestampedHMACConfig{Secrets: []string{"s"}, SignatureHeader: "X-Sig"}, service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewTimestampedHMACVerifier(tt.cfg); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestTimestampedHMACVerifier(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	body := []byte("payload")
+	ts := strconv.FormatInt(now.Unix(), 10)
+	mac := sign([]byte("secret"), ts, body)
+
+	tests := []struct {
+		name      string
+		base64    bool
+		timestamp string
+		signature string
+		wantErr   error
+	}{
+		{"hex", false, ts, "v1=" + hex.EncodeToString(mac), nil},
+		{"base64", true, ts, "v1=" + base64.StdEncoding.EncodeToString(mac), nil},
+		{"wrong encoding", true, ts, "v1=" + hex.EncodeToString(mac), ErrUnauthorized},
+		{"wrong secret", false, ts, "v1=" + hex.EncodeToString(sign([]byte("wrong"), ts, body)), ErrUnauthorized},
+		{"tampered timestamp", false, strconv.FormatInt(now.Unix()-1, 10), "v1=" + hex.EncodeToString(mac), ErrUnauthorized},
+		{"expired", false, strconv.FormatInt(now.Unix()-600, 10), "v1=" + hex.EncodeToString(mac), ErrUnauthorized},
+		{"missing timestamp", false, "", "v1=" + hex.EncodeToString(mac), ErrUnauthorized},
+		{"missing signature", false, ts, "", ErrUnauthorized},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewTimestampedHMACVerifier(TimestampedHMACConfig{
+				Sender:          "partner",
+				Secrets:         []string{"secret"},
+				SignatureHeader: "X-Signature",
+				TimestampHeader: "X-Timestamp",
+				Prefix:          "v1=",
+				Base64:          tt.base64,
+				Tolerance:       5 * time.Minute,
+			})
+			if err != nil {
+				t.Fatalf("create verifier: %v", err)
+			}
+			h := http.Header{}
+			h.Set("X-Signature", tt.signature)
+			h.Set("X-Timestamp", tt.timestamp)
+			p, err := v.VerifyWebhook(h, body, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (p.Subject != "partner" || p.Issuer != webhookIssuer) {
+				t.Errorf("got principal %+v, want partner", p)
+			}
+		})
+	}
+}
+
+func TestWebhookMiddleware(t *testing.T) {
+	v := NewGitHubVerifier("secret")
+	signature := func(body string) string {
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write([]byte(body))
+		return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	}
+	tests := []struct {
+		name      string
+		body      string
+		signature string
+		want      int
+	}{
+		{"valid", "hello", signature("hello"), http.StatusOK},
+		{"at the size limit", strings.Repeat("x", 8), signature(strings.Repeat("x", 8)), http.StatusOK},
+		{"invalid", "hello", signature("other"), http.StatusUnauthorized},
+		{"too large", strings.Repeat("x", 9), signature(strings.Repeat("x", 9)), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			h := WebhookMiddleware(v, 8, nil)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				if b, _ := io.ReadAll(r.Body); string(b) != tt.body {
+					t.Errorf("got body %q, want %q", b, tt.body)
+				}
+				if p, ok := PrincipalFrom(r.Context()); !ok || p.Subject != "github" {
+					t.Errorf("got principal %+v, want github", p)
+				}
+			}))
+			req := httptest.NewRequest(http.MethodPost, "/webhooks/github", strings.NewReader(tt.body))
+			req.Header.Set("X-Hub-Signature-256", tt.signature)
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+// Package autotune tunes the go runtime to the limits of the container of the
+// service. By default GOMAXPROCS is the number of cpus of the node, thus a
+// service limited to a fraction of them runs more threads than its quota
+// allows and is throttled by the kernel, and the garbage collector, unaware
+// of the memory limit, lets the heap grow until the service is oom killed.
+//
+// [Apply] reads the cpu quota and the memory limit from the cgroup of the
+// container, see [info.CgroupLimits], and sets GOMAXPROCS and GOMEMLIMIT
+// accordingly. Values set explicitly with the GOMAXPROCS and GOMEMLIMIT
+// environment variables take precedence.
+package autotune
+
+import (
+	"log/slog"
+	"math"
+	"os"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/eventscompass/service-template/src/internal/info"
+)
+
+// Config encapsulates the configuration of the runtime tuning.
+type Config struct {
+	// MaxProcs sets GOMAXPROCS to the cpu quota of the container,
+	// rounded down, at least 1.
+	MaxProcs bool `env:"RUNTIME_AUTO_MAXPROCS" envDefault:"true"`
+
+	// MemoryLimitRatio sets GOMEMLIMIT to this fraction of the
+	// memory limit of the container, leaving the rest for the
+	// memory not managed by the runtime. Zero disables it.
+	MemoryLimitRatio float64 `env:"RUNTIME_MEMORY_LIMIT_RATIO" envDefault:"0.9"`
+}
+
+// Apply tunes the runtime to the limits of the container and logs the chosen
+// values. It does nothing outside of a container with limits. It is usually
+// called once on Init, before any work is started.
+func Apply(cfg Config) {
+	procs, memLimit := runtime.GOMAXPROCS(0), debug.SetMemoryLimit(-1)
+	cpu, memory := info.CgroupLimits()
+
+	if _, set := os.LookupEnv("GOMAXPROCS"); cfg.MaxProcs && !set && cpu > 0 {
+		procs = min(max(int(math.Floor(cpu)), 1), runtime.NumCPU())
+		runtime.GOMAXPROCS(procs)
+	}
+	if _, set := os.LookupEnv("GOMEMLIMIT"); cfg.MemoryLimitRatio > 0 && !set && memory > 0 {
+		memLimit = int64(float64(memory) * min(cfg.MemoryLimitRatio, 1))
+		debug.SetMemoryLimit(memLimit)
+	}
+
+	attrs := []any{slog.Int("gomaxprocs", procs), slog.Int("cpus", runtime.NumCPU())}
+	if memLimit != math.MaxInt64 {
+		attrs = append(attrs, slog.Int64("gomemlimit", memLimit))
+	}
+	slog.Info("tuned the go runtime", attrs...)
+}
@@ -0,0 +1,87 @@
+// Package budget divides the deadline of a request among the steps of its
+// handler.
+//
+// A handler that queries the database, calls a downstream service, and
+// publishes an event should not give each step a fixed timeout: the steps
+// together may outlive the request, and a slow first step leaves no time for
+// the others. Instead, the remaining time of the request is split:
+//
+//	steps := budget.Split(ctx, 0.3, 0.5, 0.2)
+//	dbCtx, cancel := steps[0].Context(ctx)
+//	defer cancel()
+//
+// The steps end at fixed points within the remaining time, thus a step that
+// finishes early leaves its unused time to the following steps.
+package budget
+
+import (
+	"context"
+	"time"
+)
+
+// Step is a part of the time budget of a request.
+type Step struct {
+	deadline time.Time
+	ok       bool
+}
+
+// Split divides the time remaining until the deadline of ctx into consecutive
+// steps of the given fractions. If the fractions add up to more than 1, they
+// are scaled down to fit. If ctx has no deadline, the steps have no deadline
+// either.
+func Split(ctx context.Context, fractions ...float64) []Step {
+	steps := make([]Step, len(fractions))
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return steps
+	}
+
+	var sum float64
+	for _, f := range fractions {
+		sum += max(f, 0)
+	}
+	scale := 1 / max(sum, 1)
+
+	now := time.Now()
+	remaining := max(deadline.Sub(now), 0)
+	var elapsed float64
+	for i, f := range fractions {
+		elapsed += max(f, 0) * scale
+		steps[i] = Step{deadline: now.Add(time.Duration(elapsed * float64(remaining))), ok: true}
+	}
+	return steps
+}
+
+// Context returns a copy of ctx that is cancelled at the end of the step. The
+// step never ends after the deadline of ctx.
+func (s Step) Context(ctx context.Context) (context.Context, context.CancelFunc) {
+	if !s.ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, s.deadline)
+}
+
+// Deadline returns the end of the step. The second result is false if the
+// step has no deadline.
+func (s Step) Deadline() (time.Time, bool) { return s.deadline, s.ok }
+
+// Remaining returns the time left until the deadline of ctx. The second result
+// is false if ctx has no deadline.
+func Remaining(ctx context.Context) (time.Duration, bool) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return 0, false
+	}
+	return max(time.Until(deadline), 0), true
+}
+
+// WithReserve returns a copy of ctx whose deadline leaves the given time in
+// reserve, e.g. for writing the response or an error after the steps timed
+// out. If ctx has no deadline, the copy has no deadline either.
+func WithReserve(ctx context.Context, reserve time.Duration) (context.Context, context.CancelFunc) {
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		return context.WithCancel(ctx)
+	}
+	return context.WithDeadline(ctx, deadline.Add(-reserve))
+}
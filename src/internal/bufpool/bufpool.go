@@ -0,0 +1,41 @@
+// Package bufpool pools the byte buffers of the hot paths of the service, e.g.
+// reading request bodies and encoding responses, so that every request does
+// not allocate, and grow, buffers of its own:
+//
+//	buf := bufpool.Get()
+//	defer bufpool.Put(buf)
+//	if _, err := buf.ReadFrom(r.Body); err != nil {
+//		...
+//	}
+//
+// A buffer must not be used, nor the slices returned by its Bytes method, after
+// it was put back. Thus data that outlives the call must be copied out first,
+// e.g. the messages passed to [service.MessageBus.Publish], which the bus may
+// keep after Publish returns.
+package bufpool
+
+import (
+	"bytes"
+	"sync"
+)
+
+// Get returns an empty buffer from the pool.
+func Get() *bytes.Buffer {
+	b := pool.Get().(*bytes.Buffer) //nolint:forcetypeassert // only buffers are pooled
+	b.Reset()
+	return b
+}
+
+// Put returns the buffer to the pool. Buffers that grew beyond [MaxSize] are
+// dropped, so that a few large payloads do not pin their memory in the pool.
+func Put(b *bytes.Buffer) {
+	if b == nil || b.Cap() > MaxSize {
+		return
+	}
+	pool.Put(b)
+}
+
+// MaxSize is the capacity of the largest buffers kept in the pool.
+const MaxSize = 1 << 16 // 64 KiB
+
+var pool = sync.Pool{New: func() any { return new(bytes.Buffer) }}
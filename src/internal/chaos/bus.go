@@ -0,0 +1,49 @@
+package chaos
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Bus wraps the message bus, injecting faults into the published and the
+// received messages. Publishing fails with [service.ErrConnectionClosed] as an
+// injected error, and dropped messages are silently discarded, like messages
+// lost by the broker.
+func Bus(bus service.MessageBus) service.MessageBus {
+	return &faultyBus{MessageBus: bus}
+}
+
+// faultyBus injects faults into a message bus.
+type faultyBus struct {
+	service.MessageBus
+}
+
+var _ service.MessageBus = (*faultyBus)(nil)
+
+// Publish implements the [service.MessageBus] interface.
+func (b *faultyBus) Publish(ctx context.Context, topic string, msg []byte) error {
+	if err := Inject(ctx, "bus_publish"); err != nil {
+		return fmt.Errorf("%w: %v", service.ErrConnectionClosed, err)
+	}
+	if drop(ctx, "bus_publish") {
+		return nil
+	}
+	return b.MessageBus.Publish(ctx, topic, msg) //nolint:wrapcheck // transparent bus
+}
+
+// Subscribe implements the [service.MessageBus] interface.
+func (b *faultyBus) Subscribe(ctx context.Context, topic string, h service.EventHandler) error {
+	return b.MessageBus.Subscribe(ctx, topic, func(ctx context.Context, msg []byte) { //nolint:wrapcheck // transparent bus
+		if drop(ctx, "bus_subscribe") {
+			return
+		}
+		if err := Inject(ctx, "bus_subscribe"); err != nil {
+			// The handler cannot fail a message, thus an injected
+			// error drops it as well.
+			return
+		}
+		h(ctx, msg)
+	})
+}
@@ -0,0 +1,285 @@
+// Package chaos injects faults into the service, so that teams can verify that
+// their timeouts, retries, and fallbacks work before a real outage does.
+//
+// Fault injection is disabled unless CHAOS_ENABLED is set, and must never be
+// enabled in production. When enabled, latency, errors, and dropped messages
+// are injected at the configured rates into:
+//
+//   - the incoming requests, see [Middleware] and [UnaryServerInterceptor];
+//   - the outgoing calls of the client package, see [Transport] and
+//     [UnaryClientInterceptor];
+//   - the message bus, see [Bus].
+//
+// If CHAOS_ALLOW_HEADER is set, a request may override the configured faults
+// with the X-Chaos header, e.g. "latency=500ms, latency_rate=1, error_rate=0.2".
+// The override applies to the request and to all the calls made on its behalf.
+package chaos
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// ErrInjected is returned by operations that failed because of an injected
+// fault.
+var ErrInjected = errors.New("injected fault")
+
+// Config encapsulates the configuration of the fault injection.
+type Config struct {
+	// Enabled enables the fault injection.
+	Enabled bool `env:"CHAOS_ENABLED" envDefault:"false"`
+
+	// AllowHeader lets requests override the faults with the
+	// X-Chaos header.
+	AllowHeader bool `env:"CHAOS_ALLOW_HEADER" envDefault:"false"`
+
+	Faults
+}
+
+// Faults are the faults to inject. The rates are between 0 and 1.
+type Faults struct {
+	// Latency is added to the fraction LatencyRate of the
+	// operations.
+	Latency     time.Duration `env:"CHAOS_LATENCY" envDefault:"0"`
+	LatencyRate float64       `env:"CHAOS_LATENCY_RATE" envDefault:"0"`
+
+	// ErrorRate is the fraction of the operations that fail.
+	ErrorRate float64 `env:"CHAOS_ERROR_RATE" envDefault:"0"`
+
+	// DropRate is the fraction of the bus messages that are
+	// silently dropped.
+	DropRate float64 `env:"CHAOS_DROP_RATE" envDefault:"0"`
+}
+
+// Configure configures the fault injection. It is usually called once on Init.
+// This function returns [service.ErrBadRequest] in case a rate is not between 0
+// and 1.
+func Configure(cfg Config) error {
+	if err := cfg.Faults.validate(); err != nil {
+		return err
+	}
+	if cfg.Enabled {
+		slog.Warn("fault injection is enabled",
+			slog.Duration("latency", cfg.Latency),
+			slog.Float64("latency_rate", cfg.LatencyRate),
+			slog.Float64("error_rate", cfg.ErrorRate),
+			slog.Float64("drop_rate", cfg.DropRate),
+			slog.Bool("allow_header", cfg.AllowHeader),
+		)
+	}
+	current.Store(&cfg)
+	return nil
+}
+
+// Middleware is an http middleware injecting faults into the requests.
+// Requests failed by an injected fault get 503.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cfg := load()
+		if !cfg.Enabled {
+			next.ServeHTTP(w, r)
+			return
+		}
+		ctx := r.Context()
+		if h := r.Header.Get(header); h != "" && cfg.AllowHeader {
+			f, err := ParseFaults(h)
+			if err != nil {
+				service.HTTPError(ctx, w, err)
+				return
+			}
+			ctx = NewContext(ctx, f)
+		}
+		if err := Inject(ctx, "http"); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable) // 503
+			return
+		}
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// UnaryServerInterceptor returns a grpc interceptor injecting faults into the
+// calls. Calls failed by an injected fault get codes.Unavailable.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if err := Inject(ctx, "grpc"); err != nil {
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Transport returns an http transport injecting faults into the outgoing
+// requests.
+func Transport(next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		if err := Inject(req.Context(), "http_client"); err != nil {
+			return nil, err
+		}
+		return next.RoundTrip(req) //nolint:wrapcheck // transparent transport
+	})
+}
+
+// UnaryClientInterceptor returns a grpc interceptor injecting faults into the
+// outgoing calls. Calls failed by an injected fault get codes.Unavailable.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if err := Inject(ctx, "grpc_client"); err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// Inject injects the faults of ctx into an operation of the given kind: it
+// sleeps for the injected latency, and returns an error wrapping [ErrInjected]
+// if the operation should fail. It returns nil right away if the fault
+// injection is disabled.
+func Inject(ctx context.Context, kind string) error {
+	cfg := load()
+	if !cfg.Enabled {
+		return nil
+	}
+	f := faultsFrom(ctx, cfg)
+	if f.Latency > 0 && chance(f.LatencyRate) {
+		injected.Inc(kind, "latency")
+		t := time.NewTimer(f.Latency)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			return ctx.Err() //nolint:wrapcheck // caller gave up
+		case <-t.C:
+		}
+	}
+	if chance(f.ErrorRate) {
+		injected.Inc(kind, "error")
+		return fmt.Errorf("%w: %s", ErrInjected, kind)
+	}
+	return nil
+}
+
+// NewContext returns a copy of ctx carrying faults that override the
+// configured ones.
+func NewContext(ctx context.Context, f Faults) context.Context {
+	return context.WithValue(ctx, faultsKey{}, f)
+}
+
+// ParseFaults parses the value of the X-Chaos header, a comma separated list
+// of "latency", "latency_rate", "error_rate", and "drop_rate" settings. This
+// function returns [service.ErrBadRequest] in case the value is malformed.
+func ParseFaults(s string) (Faults, error) {
+	var f Faults
+	for _, part := range strings.Split(s, ",") {
+		k, v, ok := strings.Cut(strings.TrimSpace(part), "=")
+		if !ok {
+			return Faults{}, fmt.Errorf("%w: malformed fault %q", service.ErrBadRequest, part)
+		}
+		var err error
+		switch k {
+		case "latency":
+			f.Latency, err = time.ParseDuration(v)
+		case "latency_rate":
+			f.LatencyRate, err = strconv.ParseFloat(v, 64)
+		case "error_rate":
+			f.ErrorRate, err = strconv.ParseFloat(v, 64)
+		case "drop_rate":
+			f.DropRate, err = strconv.ParseFloat(v, 64)
+		default:
+			err = errors.New("unknown fault")
+		}
+		if err != nil {
+			return Faults{}, fmt.Errorf("%w: fault %q: %v", service.ErrBadRequest, k, err)
+		}
+	}
+	return f, f.validate()
+}
+
+// validate checks that the rates are between 0 and 1.
+func (f Faults) validate() error {
+	for _, r := range []float64{f.LatencyRate, f.ErrorRate, f.DropRate} {
+		if r < 0 || r > 1 {
+			return fmt.Errorf("%w: fault rate %v is not between 0 and 1", service.ErrBadRequest, r)
+		}
+	}
+	return nil
+}
+
+// drop reports whether a bus message should be dropped.
+func drop(ctx context.Context, kind string) bool {
+	cfg := load()
+	if !cfg.Enabled || !chance(faultsFrom(ctx, cfg).DropRate) {
+		return false
+	}
+	injected.Inc(kind, "drop")
+	return true
+}
+
+// load returns the current configuration.
+func load() *Config {
+	if cfg := current.Load(); cfg != nil {
+		return cfg
+	}
+	return &Config{}
+}
+
+// faultsFrom returns the faults of ctx, or the configured ones.
+func faultsFrom(ctx context.Context, cfg *Config) Faults {
+	if f, ok := ctx.Value(faultsKey{}).(Faults); ok {
+		return f
+	}
+	return cfg.Faults
+}
+
+// chance returns true with the given probability.
+func chance(rate float64) bool {
+	return rate > 0 && rand.Float64() < rate //nolint:gosec // not security relevant
+}
+
+// roundTripper adapts a function to the [http.RoundTripper] interface.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// faultsKey is the context key of the faults of a request.
+type faultsKey struct{}
+
+// header is the request header overriding the faults.
+const header = "X-Chaos"
+
+var (
+	// current is the current configuration, see [Configure].
+	current atomic.Pointer[Config]
+
+	// injected counts the injected faults.
+	injected = metrics.NewCounter(
+		"chaos_injected_faults_total",
+		"Number of faults injected for resilience testing.",
+		"kind", "fault",
+	)
+)
@@ -0,0 +1,96 @@
+// Package cli dispatches the subcommands of the service binary, so that the
+// operational tasks of a service, e.g. migrating its database, ship with the
+// service instead of ad-hoc binaries:
+//
+//	service serve
+//	service migrate
+//	service check-config
+//
+// The first command is the default one, run when the binary is started
+// without arguments, e.g. "serve".
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"syscall"
+	"text/tabwriter"
+)
+
+// Command is a subcommand of the service binary.
+type Command struct {
+	// Name is the name of the command on the command line.
+	Name string
+
+	// Summary is the one line description shown in the usage.
+	Summary string
+
+	// Run runs the command with the arguments following its name.
+	// The context is cancelled once the process receives a stop
+	// signal.
+	Run func(ctx context.Context, args []string) error
+}
+
+// Main runs the command named by the first argument of the process, or the
+// first command if there are no arguments, and exits with status 1 in case it
+// fails, or status 2 in case there is no such command.
+func Main(cmds ...Command) {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	err := Run(ctx, os.Args[1:], cmds...)
+	stop()
+	switch {
+	case errors.Is(err, errUsage):
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, "error:", err)
+		os.Exit(1)
+	}
+}
+
+// Run runs the command named by the first argument, or the first command if
+// there are no arguments. The usage is printed for "help", "-h" and
+// "--help", and for unknown commands, in which case an error is returned.
+func Run(ctx context.Context, args []string, cmds ...Command) error {
+	if len(cmds) == 0 {
+		return errors.New("no commands")
+	}
+	if len(args) == 0 {
+		return cmds[0].Run(ctx, nil)
+	}
+	switch args[0] {
+	case "help", "-h", "-help", "--help":
+		usage(os.Stdout, cmds)
+		return nil
+	}
+	for _, c := range cmds {
+		if c.Name == args[0] {
+			return c.Run(ctx, args[1:])
+		}
+	}
+	fmt.Fprintf(os.Stderr, "unknown command %q\n\n", args[0])
+	usage(os.Stderr, cmds)
+	return errUsage
+}
+
+// usage prints the commands.
+func usage(w io.Writer, cmds []Command) {
+	fmt.Fprintf(w, "Usage: %s [command] [arguments]\n\nCommands:\n", filepath.Base(os.Args[0]))
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+	for i, c := range cmds {
+		summary := c.Summary
+		if i == 0 {
+			summary += " (default)"
+		}
+		fmt.Fprintf(tw, "  %s\t%s\n", c.Name, summary)
+	}
+	tw.Flush() //nolint:errcheck,gosec // best effort
+}
+
+// errUsage is returned by [Run] for unknown commands, after printing the
+// usage.
+var errUsage = errors.New("unknown command")
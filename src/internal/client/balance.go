@@ -0,0 +1,213 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc/resolver"
+)
+
+// Balancer spreads the calls to a dependency over its instances, round robin.
+// The instances are resolved on first use, and resolved again in the
+// background once they are older than the refresh interval. If resolving
+// fails, the last known instances are kept.
+type Balancer struct {
+	name     string
+	r        Resolver
+	interval time.Duration
+
+	mu         sync.Mutex
+	addrs      []string
+	resolved   time.Time
+	refreshing bool
+
+	next atomic.Uint64
+}
+
+// NewBalancer creates a new [Balancer] for the named dependency.
+func NewBalancer(name string, r Resolver, interval time.Duration) *Balancer {
+	if interval <= 0 {
+		interval = defaultRefreshInterval
+	}
+	return &Balancer{name: name, r: r, interval: interval}
+}
+
+// Pick returns the address of the instance to call next. This function returns
+// [service.ErrNotFound] in case the dependency has no instances, and the
+// errors of the resolver otherwise.
+func (b *Balancer) Pick(ctx context.Context) (string, error) {
+	addrs, err := b.Addresses(ctx)
+	if err != nil {
+		return "", err
+	}
+	n := b.next.Add(1) - 1
+	return addrs[n%uint64(len(addrs))], nil
+}
+
+// Addresses returns the addresses of the instances, see [Balancer.Pick].
+func (b *Balancer) Addresses(ctx context.Context) ([]string, error) {
+	b.mu.Lock()
+	addrs := b.addrs
+	if len(addrs) > 0 && time.Since(b.resolved) >= b.interval && !b.refreshing {
+		b.refreshing = true
+		go b.refresh()
+	}
+	b.mu.Unlock()
+	if len(addrs) > 0 {
+		return addrs, nil
+	}
+	return b.Refresh(ctx)
+}
+
+// Refresh resolves the instances again. This function returns
+// [service.ErrNotFound] in case the dependency has no instances, and the
+// errors of the resolver otherwise.
+func (b *Balancer) Refresh(ctx context.Context) ([]string, error) {
+	addrs, err := b.r.Resolve(ctx)
+	if err == nil && len(addrs) == 0 {
+		err = fmt.Errorf("%w: no instances of %s", service.ErrNotFound, b.name)
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refreshing = false
+	if err != nil {
+		if len(b.addrs) > 0 {
+			// Keep the last known instances, and retry once they
+			// are due again.
+			b.resolved = time.Now()
+		}
+		return nil, err
+	}
+	b.addrs, b.resolved = addrs, time.Now()
+	return addrs, nil
+}
+
+// refresh resolves the instances in the background.
+func (b *Balancer) refresh() {
+	ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+	defer cancel()
+	if _, err := b.Refresh(ctx); err != nil {
+		slog.Warn("failed to resolve dependency instances",
+			slog.String("dependency", b.name),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// BalancedTransport returns an http transport sending every request to the
+// instance picked by the balancer. The url of the request keeps naming the
+// dependency, e.g. "http://payments/v1/charges", and is used as host header.
+func BalancedTransport(b *Balancer, next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		addr, err := b.Pick(req.Context())
+		if err != nil {
+			return nil, err
+		}
+		r := req.Clone(req.Context())
+		if r.Host == "" {
+			r.Host = req.URL.Host
+		}
+		r.URL.Host = addr
+		return next.RoundTrip(r) //nolint:wrapcheck // transparent transport
+	})
+}
+
+// grpcResolverBuilder plugs a [Balancer] into grpc, which balances the calls
+// over the resolved instances itself.
+type grpcResolverBuilder struct{ b *Balancer }
+
+var _ resolver.Builder = grpcResolverBuilder{}
+
+// Build implements the [resolver.Builder] interface.
+func (g grpcResolverBuilder) Build(
+	_ resolver.Target,
+	cc resolver.ClientConn,
+	_ resolver.BuildOptions,
+) (resolver.Resolver, error) {
+	r := &grpcResolver{b: g.b, cc: cc, now: make(chan struct{}, 1), done: make(chan struct{})}
+	go r.watch()
+	return r, nil
+}
+
+// Scheme implements the [resolver.Builder] interface.
+func (grpcResolverBuilder) Scheme() string { return discoveryScheme }
+
+// grpcResolver pushes the instances of a dependency to a grpc connection.
+type grpcResolver struct {
+	b    *Balancer
+	cc   resolver.ClientConn
+	now  chan struct{}
+	done chan struct{}
+}
+
+// ResolveNow implements the [resolver.Resolver] interface. grpc calls it when
+// connections fail.
+func (r *grpcResolver) ResolveNow(resolver.ResolveNowOptions) {
+	select {
+	case r.now <- struct{}{}:
+	default:
+	}
+}
+
+// Close implements the [resolver.Resolver] interface.
+func (r *grpcResolver) Close() { close(r.done) }
+
+// watch resolves the instances periodically and on demand, at most once per
+// [minResolveInterval].
+func (r *grpcResolver) watch() {
+	ticker := time.NewTicker(r.b.interval)
+	defer ticker.Stop()
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), resolveTimeout)
+		addrs, err := r.b.Refresh(ctx)
+		cancel()
+		if err != nil {
+			r.cc.ReportError(err)
+		} else {
+			var state resolver.State
+			for _, a := range addrs {
+				state.Addresses = append(state.Addresses, resolver.Address{Addr: a})
+			}
+			r.cc.UpdateState(state) //nolint:errcheck,gosec // reported by the connection
+		}
+
+		select {
+		case <-r.done:
+			return
+		case <-time.After(minResolveInterval):
+		}
+		select {
+		case <-r.done:
+			return
+		case <-r.now:
+		case <-ticker.C:
+		}
+	}
+}
+
+const (
+	// discoveryScheme is the scheme of the grpc targets resolved by a
+	// [Balancer].
+	discoveryScheme = "discovery"
+
+	// roundRobinConfig is the grpc service config balancing the calls
+	// over all instances.
+	roundRobinConfig = `{"loadBalancingConfig":[{"round_robin":{}}]}`
+
+	// defaultRefreshInterval is the default interval at which the
+	// instances are resolved again.
+	defaultRefreshInterval = 30 * time.Second
+
+	// minResolveInterval rate limits the resolutions requested by grpc.
+	minResolveInterval = time.Second
+
+	// resolveTimeout bounds a single resolution.
+	resolveTimeout = 10 * time.Second
+)
@@ -0,0 +1,314 @@
+// Package client creates the http and grpc clients that the service uses to
+// call its dependencies.
+//
+// Every dependency gets its own clients, named after the dependency, which
+// are guarded by a [resilience.Breaker]. Thus a failing dependency is not called
+// until it recovers, instead of blocking the workers of the service on
+// timeouts. Calls that are safe to repeat are retried with [resilience.Retry].
+//
+// The instances of a dependency can be discovered instead of configured, see
+// [DiscoveryConfig]. The calls are then balanced over the instances, and
+// retries go to the next instance.
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/chaos"
+	"github.com/eventscompass/service-template/src/internal/resilience"
+)
+
+// Config encapsulates the configuration of the clients of a dependency. It is
+// usually embedded with a prefix naming the dependency, e.g.
+//
+//	Payments client.Config `envPrefix:"PAYMENTS_"`
+type Config struct {
+	// Timeout limits the duration of a single call.
+	Timeout time.Duration `env:"CLIENT_TIMEOUT" envDefault:"10s"`
+
+	Breaker   resilience.BreakerConfig
+	Retry     resilience.Policy
+	Hedge     HedgeConfig
+	Discovery DiscoveryConfig
+}
+
+// NewHTTP creates an http client for the named dependency. Responses with a
+// 5xx status count as failures of the dependency. Requests with idempotent
+// methods are retried, and GET requests are hedged if enabled, see
+// [HedgeTransport]. The timeout applies to every attempt. With a discovery
+// target, the requests are balanced over the instances of the dependency, see
+// [BalancedTransport]; a malformed target fails every request.
+func NewHTTP(name string, cfg Config) *http.Client {
+	return NewHTTPWithTransport(name, cfg, http.DefaultTransport)
+}
+
+// NewHTTPWithTransport creates an http client for the named dependency like
+// [NewHTTP], sending the requests with the base transport, e.g. one with a tls
+// configuration for mTLS.
+func NewHTTPWithTransport(name string, cfg Config, base http.RoundTripper) *http.Client {
+	t := chaos.Transport(base)
+	switch r, err := NewResolver(cfg.Discovery); {
+	case err != nil:
+		slog.Error("invalid client discovery target",
+			slog.String("dependency", name),
+			slog.String("error", err.Error()),
+		)
+		t = roundTripper(func(*http.Request) (*http.Response, error) { return nil, err })
+	case r != nil:
+		t = BalancedTransport(NewBalancer(name, r, cfg.Discovery.RefreshInterval), t)
+	}
+	if cfg.Timeout > 0 {
+		t = timeoutTransport(cfg.Timeout, t)
+	}
+	t = Transport(resilience.NewBreaker(name, cfg.Breaker), t)
+	if cfg.Hedge.Enabled {
+		t = HedgeTransport(name, cfg.Hedge, t)
+	}
+	return &http.Client{Transport: RetryTransport(cfg.Retry, t)}
+}
+
+// Transport returns an http transport guarding the calls of next with the
+// breaker. Rejected calls return an error wrapping [resilience.ErrOpen].
+func Transport(b *resilience.Breaker, next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		done, err := b.Allow()
+		if err != nil {
+			return nil, err //nolint:wrapcheck // documented error
+		}
+		resp, err := next.RoundTrip(req)
+		if err != nil {
+			done(!resilience.IsFailure(err))
+			return nil, err //nolint:wrapcheck // transparent transport
+		}
+		done(resp.StatusCode < http.StatusInternalServerError)
+		return resp, nil
+	})
+}
+
+// RetryTransport returns an http transport retrying requests with idempotent
+// methods, which fail with a transient error or with 502, 503 or 504.
+func RetryTransport(p resilience.Policy, next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		replayable := req.Body == nil || req.Body == http.NoBody || req.GetBody != nil
+		if !idempotentMethods[req.Method] || !replayable {
+			return next.RoundTrip(req) //nolint:wrapcheck // transparent transport
+		}
+		var resp *http.Response
+		err := resilience.Retry(req.Context(), p, func(ctx context.Context) error {
+			attempt := req
+			if resp != nil {
+				resp.Body.Close() //nolint:errcheck,gosec // discarded response
+				resp = nil
+			}
+			if attempt.Body != nil && attempt.Body != http.NoBody {
+				// Every attempt needs a fresh body, as the
+				// previous one was consumed.
+				body, err := req.GetBody()
+				if err != nil {
+					return resilience.Permanent(err)
+				}
+				attempt = req.Clone(ctx)
+				attempt.Body = body
+			}
+			var err error
+			if resp, err = next.RoundTrip(attempt); err != nil {
+				return err //nolint:wrapcheck // transparent transport
+			}
+			if retryStatus[resp.StatusCode] {
+				return errRetryStatus
+			}
+			return nil
+		})
+		if errors.Is(err, errRetryStatus) {
+			return resp, nil // the last response is returned as is
+		}
+		if err != nil {
+			if resp != nil {
+				resp.Body.Close() //nolint:errcheck,gosec // discarded response
+			}
+			return nil, err //nolint:wrapcheck // transparent transport
+		}
+		return resp, nil
+	})
+}
+
+// DialGRPC creates a grpc client connection to the named dependency. Calls
+// failing with codes that indicate an unhealthy server count as failures of
+// the dependency. Calls failing with codes.Unavailable are retried, as the
+// server did not process them. The timeout applies to every attempt. With a
+// discovery target, the target argument is ignored and the calls are balanced
+// round robin over the instances of the dependency, which are resolved again
+// periodically and whenever a connection fails.
+func DialGRPC(
+	ctx context.Context,
+	name, target string,
+	cfg Config,
+	opts ...grpc.DialOption,
+) (*grpc.ClientConn, error) {
+	r, err := NewResolver(cfg.Discovery)
+	if err != nil {
+		return nil, err
+	}
+	if r != nil {
+		target = discoveryScheme + ":///" + name
+		opts = append([]grpc.DialOption{
+			grpc.WithResolvers(grpcResolverBuilder{NewBalancer(name, r, cfg.Discovery.RefreshInterval)}),
+			grpc.WithDefaultServiceConfig(roundRobinConfig),
+		}, opts...)
+	}
+
+	b := resilience.NewBreaker(name, cfg.Breaker)
+	opts = append([]grpc.DialOption{
+		grpc.WithChainUnaryInterceptor(
+			RetryUnaryClientInterceptor(cfg.Retry),
+			UnaryClientInterceptor(b),
+			timeoutInterceptor(cfg.Timeout),
+			chaos.UnaryClientInterceptor(),
+		),
+	}, opts...)
+	conn, err := grpc.DialContext(ctx, target, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: dial %s: %v", service.ErrUnexpected, name, err)
+	}
+	return conn, nil
+}
+
+// UnaryClientInterceptor returns a grpc interceptor guarding the calls with the
+// breaker. Rejected calls fail with codes.Unavailable.
+func UnaryClientInterceptor(b *resilience.Breaker) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		done, err := b.Allow()
+		if err != nil {
+			return status.Error(codes.Unavailable, err.Error())
+		}
+		err = invoker(ctx, method, req, reply, cc, opts...)
+		done(!isGRPCFailure(err))
+		return err
+	}
+}
+
+// RetryUnaryClientInterceptor returns a grpc interceptor retrying the calls
+// that fail with codes.Unavailable.
+func RetryUnaryClientInterceptor(p resilience.Policy) grpc.UnaryClientInterceptor {
+	if p.Retryable == nil {
+		p.Retryable = func(err error) bool { return status.Code(err) == codes.Unavailable }
+	}
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		return resilience.Retry(ctx, p, func(ctx context.Context) error {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		})
+	}
+}
+
+// timeoutInterceptor bounds the duration of every call.
+func timeoutInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// isGRPCFailure reports whether the error of a call indicates an unhealthy
+// server. Errors caused by the request, e.g. codes.NotFound, do not.
+func isGRPCFailure(err error) bool {
+	if err == nil || errors.Is(err, context.Canceled) {
+		return false
+	}
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.Internal,
+		codes.Unknown, codes.ResourceExhausted, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+// timeoutTransport bounds the duration of every request, until the response
+// body is closed.
+func timeoutTransport(timeout time.Duration, next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		ctx, cancel := context.WithTimeout(req.Context(), timeout)
+		resp, err := next.RoundTrip(req.WithContext(ctx))
+		if err != nil {
+			cancel()
+			return nil, err //nolint:wrapcheck // transparent transport
+		}
+		resp.Body = &cancelBody{ReadCloser: resp.Body, cancel: cancel}
+		return resp, nil
+	})
+}
+
+// cancelBody cancels the context of a request once its response body is
+// closed.
+type cancelBody struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (b *cancelBody) Close() error {
+	defer b.cancel()
+	return b.ReadCloser.Close() //nolint:wrapcheck // transparent body
+}
+
+// roundTripper adapts a function to the [http.RoundTripper] interface.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+var (
+	// errRetryStatus signals a response with a retryable status.
+	errRetryStatus = errors.New("retryable response status")
+
+	// idempotentMethods can be retried safely.
+	idempotentMethods = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodPut:     true,
+		http.MethodDelete:  true,
+	}
+
+	// retryStatus are response statuses of requests that may succeed when
+	// retried.
+	retryStatus = map[int]bool{
+		http.StatusBadGateway:         true,
+		http.StatusServiceUnavailable: true,
+		http.StatusGatewayTimeout:     true,
+	}
+)
@@ -0,0 +1,206 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// DiscoveryConfig encapsulates the configuration of the client-side service
+// discovery of a dependency. Without target, the clients call the address
+// they are given.
+type DiscoveryConfig struct {
+	// Target names the instances of the dependency, one of
+	//
+	//	srv://_grpc._tcp.payments.default.svc.cluster.local
+	//	dns://payments-headless.default.svc.cluster.local:8080
+	//	consul://payments?tag=v2
+	//
+	// srv resolves DNS SRV records, dns resolves the A records
+	// of a name, e.g. of a kubernetes headless service, and
+	// consul asks the consul agent for the healthy instances.
+	Target string `env:"CLIENT_DISCOVERY_TARGET"`
+
+	// RefreshInterval is the interval at which the target is
+	// resolved again.
+	RefreshInterval time.Duration `env:"CLIENT_DISCOVERY_REFRESH_INTERVAL" envDefault:"30s"`
+
+	// ConsulAddr and ConsulToken locate the consul agent.
+	ConsulAddr  string `env:"CONSUL_HTTP_ADDR" envDefault:"http://localhost:8500"`
+	ConsulToken string `env:"CONSUL_HTTP_TOKEN"`
+}
+
+// Resolver resolves the addresses of the instances of a dependency.
+type Resolver interface {
+	// Resolve returns the "host:port" addresses of the instances,
+	// in a stable order.
+	Resolve(context.Context) ([]string, error)
+}
+
+// NewResolver creates the [Resolver] of the target. Returns nil if the config
+// has no target. This function returns [service.ErrBadRequest] in case the
+// target is malformed.
+func NewResolver(cfg DiscoveryConfig) (Resolver, error) {
+	if cfg.Target == "" {
+		return nil, nil //nolint:nilnil // discovery is optional
+	}
+	u, err := url.Parse(cfg.Target)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("%w: discovery target %q", service.ErrBadRequest, cfg.Target)
+	}
+	switch u.Scheme {
+	case "srv":
+		return SRVResolver(u.Host), nil
+	case "dns":
+		host, port, err := net.SplitHostPort(u.Host)
+		if err != nil {
+			return nil, fmt.Errorf("%w: discovery target %q needs a port", service.ErrBadRequest, cfg.Target)
+		}
+		return &DNSResolver{Host: host, Port: port}, nil
+	case "consul":
+		return &ConsulResolver{
+			Addr:    cfg.ConsulAddr,
+			Token:   cfg.ConsulToken,
+			Service: u.Host,
+			Tag:     u.Query().Get("tag"),
+			client:  &http.Client{Timeout: 10 * time.Second},
+		}, nil
+	default:
+		return nil, fmt.Errorf("%w: unknown discovery scheme %q", service.ErrBadRequest, u.Scheme)
+	}
+}
+
+// SRVResolver resolves the DNS SRV records of the name, e.g.
+// "_grpc._tcp.payments.default.svc.cluster.local". The records are ordered by
+// priority, the weights are ignored.
+type SRVResolver string
+
+var _ Resolver = SRVResolver("")
+
+// Resolve implements the [Resolver] interface.
+func (s SRVResolver) Resolve(ctx context.Context) ([]string, error) {
+	_, srvs, err := net.DefaultResolver.LookupSRV(ctx, "", "", string(s))
+	if err != nil {
+		return nil, lookupError(string(s), err)
+	}
+	addrs := make([]string, 0, len(srvs))
+	for _, srv := range srvs {
+		host := strings.TrimSuffix(srv.Target, ".")
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(int(srv.Port))))
+	}
+	return addrs, nil
+}
+
+// DNSResolver resolves the ip addresses of the host, e.g. of a kubernetes
+// headless service, which has a record for every ready pod.
+type DNSResolver struct {
+	Host string
+	Port string
+}
+
+var _ Resolver = (*DNSResolver)(nil)
+
+// Resolve implements the [Resolver] interface.
+func (d *DNSResolver) Resolve(ctx context.Context) ([]string, error) {
+	ips, err := net.DefaultResolver.LookupHost(ctx, d.Host)
+	if err != nil {
+		return nil, lookupError(d.Host, err)
+	}
+	sort.Strings(ips)
+	addrs := make([]string, 0, len(ips))
+	for _, ip := range ips {
+		addrs = append(addrs, net.JoinHostPort(ip, d.Port))
+	}
+	return addrs, nil
+}
+
+// ConsulResolver resolves the instances of a service, which pass their health
+// checks, from the consul agent.
+// https://developer.hashicorp.com/consul/api-docs/health#list-service-instances-for-service
+type ConsulResolver struct {
+	Addr    string
+	Token   string
+	Service string
+	Tag     string
+
+	client *http.Client
+}
+
+var _ Resolver = (*ConsulResolver)(nil)
+
+// Resolve implements the [Resolver] interface.
+func (c *ConsulResolver) Resolve(ctx context.Context) ([]string, error) {
+	addr := c.Addr
+	if !strings.Contains(addr, "://") {
+		addr = "http://" + addr
+	}
+	q := url.Values{"passing": {"true"}}
+	if c.Tag != "" {
+		q.Set("tag", c.Tag)
+	}
+	u := strings.TrimSuffix(addr, "/") + "/v1/health/service/" + url.PathEscape(c.Service) +
+		"?" + q.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: create request: %v", service.ErrUnexpected, err)
+	}
+	if c.Token != "" {
+		req.Header.Set("X-Consul-Token", c.Token)
+	}
+	client := c.client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", service.ErrConnectionClosed, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // intentional
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("%w: consul: %s: %s",
+			service.ErrUnexpected, resp.Status, strings.TrimSpace(string(msg)))
+	}
+
+	var entries []struct {
+		Node struct {
+			Address string `json:"Address"`
+		} `json:"Node"`
+		Service struct {
+			Address string `json:"Address"`
+			Port    int    `json:"Port"`
+		} `json:"Service"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&entries); err != nil {
+		return nil, fmt.Errorf("%w: decode consul response: %v", service.ErrUnexpected, err)
+	}
+	addrs := make([]string, 0, len(entries))
+	for _, e := range entries {
+		host := e.Service.Address
+		if host == "" { // the service runs on the address of the node
+			host = e.Node.Address
+		}
+		addrs = append(addrs, net.JoinHostPort(host, strconv.Itoa(e.Service.Port)))
+	}
+	sort.Strings(addrs)
+	return addrs, nil
+}
+
+// lookupError classifies the error of a dns lookup. Unknown names have no
+// instances, other errors are transient.
+func lookupError(name string, err error) error {
+	if dnsErr, ok := err.(*net.DNSError); ok && dnsErr.IsNotFound { //nolint:errorlint // returned as is
+		return fmt.Errorf("%w: no instances of %s", service.ErrNotFound, name)
+	}
+	return fmt.Errorf("%w: resolve %s: %v", service.ErrConnectionClosed, name, err)
+}
@@ -0,0 +1,192 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// HedgeConfig encapsulates the configuration of request hedging.
+type HedgeConfig struct {
+	// Enabled enables hedging of GET and HEAD requests.
+	Enabled bool `env:"CLIENT_HEDGE" envDefault:"false"`
+
+	// Delay is how long to wait for the first attempt before a
+	// second one is sent. If zero, the p95 of the observed
+	// latencies is used.
+	Delay time.Duration `env:"CLIENT_HEDGE_DELAY" envDefault:"0"`
+
+	// MinDelay bounds the delay from below, so that a fast
+	// dependency is not hit with twice the requests.
+	MinDelay time.Duration `env:"CLIENT_HEDGE_MIN_DELAY" envDefault:"10ms"`
+}
+
+// HedgeTransport returns an http transport hedging GET and HEAD requests to
+// the named dependency: if the first attempt takes longer than the hedge delay,
+// a second attempt is sent, and the response that arrives first is returned.
+// The other attempt is cancelled. This cuts the tail latency caused by a slow
+// replica of the dependency, at the cost of a few additional requests.
+func HedgeTransport(name string, cfg HedgeConfig, next http.RoundTripper) http.RoundTripper {
+	lat := &latencies{}
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		if req.Method != http.MethodGet && req.Method != http.MethodHead ||
+			req.Body != nil && req.Body != http.NoBody {
+			return next.RoundTrip(req) //nolint:wrapcheck // transparent transport
+		}
+		delay := cfg.Delay
+		if delay <= 0 {
+			delay = lat.p95()
+		}
+		if delay <= 0 {
+			// Not enough samples yet.
+			return lat.observe(next, req)
+		}
+		return hedge(name, max(delay, cfg.MinDelay), lat, next, req)
+	})
+}
+
+// hedge sends the request, and a second attempt after the delay unless the
+// first attempt completed. The latency of the request is recorded from the
+// start of the first attempt.
+func hedge(
+	name string,
+	delay time.Duration,
+	lat *latencies,
+	next http.RoundTripper,
+	req *http.Request,
+) (*http.Response, error) {
+	type result struct {
+		resp    *http.Response
+		err     error
+		attempt int
+	}
+	start := time.Now()
+	results := make(chan result, 2) //nolint:gomnd // two attempts
+	var cancels []context.CancelFunc
+	send := func() {
+		ctx, cancel := context.WithCancel(req.Context())
+		cancels = append(cancels, cancel)
+		attempt := len(cancels) - 1
+		go func() {
+			resp, err := next.RoundTrip(req.Clone(ctx))
+			results <- result{resp: resp, err: err, attempt: attempt}
+		}()
+	}
+
+	send()
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	pending := 1
+	var first result
+	select {
+	case first = <-results:
+		pending--
+	case <-t.C:
+		hedged.Inc(name)
+		send()
+		pending++
+		first = <-results
+		pending--
+	}
+
+	// The first successful response wins. If the first attempt failed, the
+	// other attempt may still succeed.
+	if first.err != nil && pending > 0 {
+		cancels[first.attempt]()
+		first = <-results
+		pending--
+	}
+	// Cancel the losing attempt right away, it may not return otherwise.
+	for i, cancel := range cancels {
+		if i != first.attempt {
+			cancel()
+		}
+	}
+	if pending > 0 {
+		go func() {
+			// Discard the response of the losing attempt.
+			if loser := <-results; loser.resp != nil {
+				loser.resp.Body.Close() //nolint:errcheck,gosec // discarded response
+			}
+		}()
+	}
+	if first.err != nil {
+		cancels[first.attempt]()
+		return nil, first.err
+	}
+	// The latency is the one seen by the caller, not the one of the winning
+	// attempt, which would make the delay shrink with every hedged request.
+	lat.record(time.Since(start))
+	first.resp.Body = &cancelBody{ReadCloser: first.resp.Body, cancel: cancels[first.attempt]}
+	return first.resp, nil
+}
+
+// latencies keeps the latencies of the recent requests to a dependency.
+type latencies struct {
+	mu      sync.Mutex
+	samples [latencySamples]time.Duration
+	n       int // number of recorded samples
+	cached  time.Duration
+	stale   int // samples recorded since cached was computed
+}
+
+// observe sends the request and records its latency.
+func (l *latencies) observe(next http.RoundTripper, req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := next.RoundTrip(req)
+	if err == nil {
+		l.record(time.Since(start))
+	}
+	return resp, err //nolint:wrapcheck // transparent transport
+}
+
+// record records the latency of a request.
+func (l *latencies) record(d time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.samples[l.n%latencySamples] = d
+	l.n++
+	l.stale++
+}
+
+// p95 returns the 95th percentile of the recent latencies, or zero if there
+// are too few samples. The percentile is recomputed every few samples only.
+func (l *latencies) p95() time.Duration {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.n < minLatencySamples {
+		return 0
+	}
+	if l.cached == 0 || l.stale >= recomputeSamples {
+		sorted := make([]time.Duration, min(l.n, latencySamples))
+		copy(sorted, l.samples[:])
+		sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+		l.cached = sorted[len(sorted)*95/100]
+		l.stale = 0
+	}
+	return l.cached
+}
+
+const (
+	// latencySamples is the number of recent latencies kept per dependency.
+	latencySamples = 200
+
+	// minLatencySamples is the number of latencies needed for estimating
+	// the hedge delay.
+	minLatencySamples = 20
+
+	// recomputeSamples is the number of new samples after which the
+	// percentile is recomputed.
+	recomputeSamples = 10
+)
+
+// hedged counts the hedged requests.
+var hedged = metrics.NewCounter(
+	"client_hedged_requests_total",
+	"Number of requests for which a second attempt was sent.",
+	"dependency",
+)
@@ -0,0 +1,126 @@
+package client
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestHedge(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	respond := func(body string) func(*http.Request) (*http.Response, error) {
+		return func(*http.Request) (*http.Response, error) {
+			return &http.Response{StatusCode: http.StatusOK, Body: io.NopCloser(strings.NewReader(body))}, nil
+		}
+	}
+	// hang blocks the attempt until it is cancelled.
+	hang := func(req *http.Request) (*http.Response, error) {
+		<-req.Context().Done()
+		return nil, req.Context().Err()
+	}
+	failAfterDelay := func(*http.Request) (*http.Response, error) {
+		time.Sleep(2 * delay)
+		return nil, errors.New("connection reset")
+	}
+	tests := []struct {
+		name         string
+		attempts     []func(*http.Request) (*http.Response, error)
+		wantBody     string
+		wantErr      bool
+		wantAttempts int32
+		// wantCancelled lists the attempts that must be cancelled once
+		// the response of the request is closed.
+		wantCancelled []int
+		wantSamples   int
+	}{
+		{
+			name:         "first attempt in time",
+			attempts:     []func(*http.Request) (*http.Response, error){respond("first")},
+			wantBody:     "first",
+			wantAttempts: 1,
+			wantSamples:  1,
+		},
+		{
+			name:          "hedged attempt wins",
+			attempts:      []func(*http.Request) (*http.Response, error){hang, respond("second")},
+			wantBody:      "second",
+			wantAttempts:  2,
+			wantCancelled: []int{0},
+			wantSamples:   1,
+		},
+		{
+			name:         "first attempt fails after hedging",
+			attempts:     []func(*http.Request) (*http.Response, error){failAfterDelay, respond("second")},
+			wantBody:     "second",
+			wantAttempts: 2,
+			wantSamples:  1,
+		},
+		{
+			name:         "both attempts fail",
+			attempts:     []func(*http.Request) (*http.Response, error){failAfterDelay, failAfterDelay},
+			wantErr:      true,
+			wantAttempts: 2,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var n atomic.Int32
+			cancelled := make([]chan struct{}, len(tt.attempts))
+			for i := range cancelled {
+				cancelled[i] = make(chan struct{})
+			}
+			next := roundTripper(func(req *http.Request) (*http.Response, error) {
+				i := n.Add(1) - 1
+				go func() {
+					<-req.Context().Done()
+					close(cancelled[i])
+				}()
+				return tt.attempts[i](req)
+			})
+
+			lat := &latencies{}
+			start := time.Now()
+			resp, err := hedge("venues", delay, lat, next, httptest.NewRequest(http.MethodGet, "/venues", nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, want error %t", err, tt.wantErr)
+			}
+			if err == nil {
+				body, _ := io.ReadAll(resp.Body)
+				resp.Body.Close() //nolint:errcheck // test response
+				if string(body) != tt.wantBody {
+					t.Errorf("got body %q, want %q", body, tt.wantBody)
+				}
+			}
+			if got := n.Load(); got != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", got, tt.wantAttempts)
+			}
+			for _, i := range tt.wantCancelled {
+				select {
+				case <-cancelled[i]:
+				case <-time.After(time.Second):
+					t.Errorf("got attempt %d still running, want it cancelled", i)
+				}
+			}
+
+			// The latency is recorded once per request, from the start of
+			// the first attempt.
+			lat.mu.Lock()
+			defer lat.mu.Unlock()
+			if lat.n != tt.wantSamples {
+				t.Fatalf("got %d latency samples, want %d", lat.n, tt.wantSamples)
+			}
+			if tt.wantAttempts > 1 && lat.n > 0 && lat.samples[0] < delay {
+				t.Errorf("got latency %s of a hedged request, want at least the delay %s", lat.samples[0], delay)
+			}
+			if lat.n > 0 && lat.samples[0] > time.Since(start) {
+				t.Errorf("got latency %s, want at most %s", lat.samples[0], time.Since(start))
+			}
+		})
+	}
+}
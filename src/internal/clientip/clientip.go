@@ -0,0 +1,229 @@
+// Package clientip resolves the ip address of the client that made a request.
+//
+// Behind load balancers and ingresses the remote address of a connection is
+// the address of the last proxy. Proxies append the address they received the
+// request from to the X-Forwarded-For header, but clients can put arbitrary
+// values into that header. Thus the header is only trusted as far as it was
+// written by the configured trusted proxies: the client is the right-most
+// address that is not a trusted proxy.
+//
+// The resolved address is put into the request context by [Middleware] and
+// should be used for anything that depends on the client address, e.g. rate
+// limiting, logging, and allowlists.
+package clientip
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+// Config encapsulates the configuration for resolving the client address.
+type Config struct {
+	// TrustedProxies lists the addresses or CIDRs of the proxies
+	// in front of the service, e.g. "10.0.0.0/8". If empty, the
+	// forwarding headers are ignored.
+	TrustedProxies []string `env:"TRUSTED_PROXIES"`
+}
+
+// Resolver resolves the client address of requests.
+type Resolver struct {
+	trusted []netip.Prefix
+}
+
+// NewResolver creates a new [Resolver]. This function returns
+// [service.ErrBadRequest] in case a trusted proxy is not a valid address or
+// CIDR.
+func NewResolver(cfg Config) (*Resolver, error) {
+	trusted, err := ParsePrefixes(cfg.TrustedProxies)
+	if err != nil {
+		return nil, fmt.Errorf("trusted proxies: %w", err)
+	}
+	return &Resolver{trusted: trusted}, nil
+}
+
+// Resolve returns the client address of the request, given its remote address
+// and the values of its X-Forwarded-For and X-Real-IP headers.
+func (r *Resolver) Resolve(remoteAddr string, forwardedFor []string, realIP string) netip.Addr {
+	client := parseAddr(remoteAddr)
+	if !client.IsValid() || !r.isTrusted(client) {
+		return client
+	}
+
+	// Walk the hops from the closest proxy to the client.
+	var hops []string
+	for _, h := range forwardedFor {
+		hops = append(hops, strings.Split(h, ",")...)
+	}
+	if len(hops) == 0 && realIP != "" {
+		hops = []string{realIP}
+	}
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseAddr(strings.TrimSpace(hops[i]))
+		if !hop.IsValid() {
+			break // the header is malformed from here on
+		}
+		client = hop
+		if !r.isTrusted(hop) {
+			break
+		}
+	}
+	return client
+}
+
+// Middleware returns an http middleware that resolves the client address of
+// every request and puts it into the request context.
+func (r *Resolver) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+			addr := r.Resolve(req.RemoteAddr,
+				req.Header.Values("X-Forwarded-For"), req.Header.Get("X-Real-IP"))
+			next.ServeHTTP(w, req.WithContext(NewContext(req.Context(), addr)))
+		})
+	}
+}
+
+// UnaryServerInterceptor returns a grpc interceptor that resolves the client
+// address of every call and puts it into the context.
+func (r *Resolver) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		return handler(NewContext(ctx, r.resolveGRPC(ctx)), req)
+	}
+}
+
+// NewContext returns a copy of ctx carrying the client address, see
+// [reqctx.WithClientIP].
+func NewContext(ctx context.Context, addr netip.Addr) context.Context {
+	return reqctx.WithClientIP(ctx, addr)
+}
+
+// FromContext returns the client address carried by ctx. It is the same as
+// [reqctx.ClientIPFrom].
+func FromContext(ctx context.Context) (netip.Addr, bool) {
+	return reqctx.ClientIPFrom(ctx)
+}
+
+// Allowlist returns an http middleware that rejects requests from clients
+// outside of the given prefixes with 403. It must be installed after
+// [Resolver.Middleware].
+func Allowlist(prefixes []netip.Prefix) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := checkAllowed(r.Context(), prefixes); err != nil {
+				service.HTTPError(r.Context(), w, err)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AllowlistUnary is the grpc variant of [Allowlist]. It must be chained after
+// [Resolver.UnaryServerInterceptor].
+func AllowlistUnary(prefixes []netip.Prefix) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if err := checkAllowed(ctx, prefixes); err != nil {
+			return nil, status.Error(codes.PermissionDenied, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ParsePrefixes parses a list of addresses or CIDRs. Single addresses are
+// converted to single-address prefixes. This function returns
+// [service.ErrBadRequest] in case any of the entries is invalid.
+func ParsePrefixes(entries []string) ([]netip.Prefix, error) {
+	res := make([]netip.Prefix, 0, len(entries))
+	for _, e := range entries {
+		e = strings.TrimSpace(e)
+		if strings.Contains(e, "/") {
+			p, err := netip.ParsePrefix(e)
+			if err != nil {
+				return nil, fmt.Errorf("%w: %v", service.ErrBadRequest, err)
+			}
+			res = append(res, p.Masked())
+			continue
+		}
+		a, err := netip.ParseAddr(e)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", service.ErrBadRequest, err)
+		}
+		a = a.Unmap()
+		res = append(res, netip.PrefixFrom(a, a.BitLen()))
+	}
+	return res, nil
+}
+
+// resolveGRPC resolves the client address of a grpc call.
+func (r *Resolver) resolveGRPC(ctx context.Context) netip.Addr {
+	var remote string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		remote = p.Addr.String()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	var realIP string
+	if vs := md.Get("x-real-ip"); len(vs) > 0 {
+		realIP = vs[0]
+	}
+	return r.Resolve(remote, md.Get("x-forwarded-for"), realIP)
+}
+
+// isTrusted reports whether the address belongs to a trusted proxy.
+func (r *Resolver) isTrusted(addr netip.Addr) bool {
+	return contains(r.trusted, addr)
+}
+
+// checkAllowed returns [service.ErrNotAllowed] if the client address of ctx is
+// not within the prefixes.
+func checkAllowed(ctx context.Context, prefixes []netip.Prefix) error {
+	addr, ok := FromContext(ctx)
+	if !ok || !contains(prefixes, addr) {
+		return fmt.Errorf("%w: client address %v is not allowed", service.ErrNotAllowed, addr)
+	}
+	return nil
+}
+
+// contains reports whether any of the prefixes contains the address.
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, p := range prefixes {
+		if p.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAddr parses an address with an optional port. Returns the zero address
+// if the address is invalid.
+func parseAddr(s string) netip.Addr {
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	a, err := netip.ParseAddr(strings.Trim(s, "[]"))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return a.Unmap()
+}
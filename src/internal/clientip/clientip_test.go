@@ -0,0 +1,215 @@
+package clientip
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestResolve(t *testing.T) {
+	r, err := NewResolver(Config{TrustedProxies: []string{"10.0.0.0/8", "2001:db8::1"}})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor []string
+		realIP       string
+		want         string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:51234",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "spoofed header from an untrusted peer",
+			remoteAddr:   "203.0.113.7:51234",
+			forwardedFor: []string{"198.51.100.1"},
+			realIP:       "198.51.100.2",
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "one trusted proxy",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "trusted proxy chain",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"203.0.113.7, 10.0.0.3", "10.0.0.2"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "spoofed hops before the client",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"198.51.100.1, 10.0.0.9, 203.0.113.7, 10.0.0.2"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:         "only trusted hops",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"10.0.0.3, 10.0.0.2"},
+			want:         "10.0.0.3",
+		},
+		{
+			name:         "malformed hop",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"203.0.113.7, not-an-ip, 10.0.0.2"},
+			want:         "10.0.0.2",
+		},
+		{
+			name:         "malformed closest hop",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"203.0.113.7, "},
+			want:         "10.0.0.1",
+		},
+		{
+			name:         "hops with ports",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"[2001:db8::7]:443, 10.0.0.2:8080"},
+			want:         "2001:db8::7",
+		},
+		{
+			name:         "ipv4 mapped hop",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"::ffff:203.0.113.7"},
+			want:         "203.0.113.7",
+		},
+		{
+			name:       "real ip without forwarded for",
+			remoteAddr: "[2001:db8::1]:80",
+			realIP:     "203.0.113.7",
+			want:       "203.0.113.7",
+		},
+		{
+			name:         "forwarded for over real ip",
+			remoteAddr:   "10.0.0.1:80",
+			forwardedFor: []string{"203.0.113.7"},
+			realIP:       "198.51.100.1",
+			want:         "203.0.113.7",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got := r.Resolve(tt.remoteAddr, tt.forwardedFor, tt.realIP)
+			if got != netip.MustParseAddr(tt.want) {
+				t.Errorf("got %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveWithoutTrustedProxies(t *testing.T) {
+	r, err := NewResolver(Config{})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	got := r.Resolve("10.0.0.1:80", []string{"203.0.113.7"}, "203.0.113.8")
+	if want := netip.MustParseAddr("10.0.0.1"); got != want {
+		t.Errorf("got %v, want %v", got, want)
+	}
+}
+
+func TestNewResolver(t *testing.T) {
+	tests := []struct {
+		name    string
+		proxies []string
+		wantErr error
+	}{
+		{"addresses and cidrs", []string{"10.0.0.1", " 192.168.0.0/16", "::1"}, nil},
+		{"invalid address", []string{"10.0.0.256"}, service.ErrBadRequest},
+		{"invalid cidr", []string{"10.0.0.0/33"}, service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewResolver(Config{TrustedProxies: tt.proxies}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMiddlewareAllowlist(t *testing.T) {
+	r, err := NewResolver(Config{TrustedProxies: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	allowed, err := ParsePrefixes([]string{"203.0.113.0/24"})
+	if err != nil {
+		t.Fatalf("parse prefixes: %v", err)
+	}
+	h := r.Middleware()(Allowlist(allowed)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {})))
+	tests := []struct {
+		name         string
+		remoteAddr   string
+		forwardedFor string
+		want         int
+	}{
+		{"allowed client behind a proxy", "10.0.0.1:80", "203.0.113.7", http.StatusOK},
+		{"other client behind a proxy", "10.0.0.1:80", "198.51.100.1", http.StatusForbidden},
+		{"spoofed allowed client", "198.51.100.1:80", "203.0.113.7", http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			req.Header.Set("X-Forwarded-For", tt.forwardedFor)
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+			if w.Code != tt.want {
+				t.Errorf("got status %d, want %d", w.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	r, err := NewResolver(Config{TrustedProxies: []string{"10.0.0.0/8"}})
+	if err != nil {
+		t.Fatalf("new resolver: %v", err)
+	}
+	tests := []struct {
+		name string
+		peer string
+		want string
+	}{
+		{"trusted peer", "10.0.0.1", "203.0.113.7"},
+		{"untrusted peer", "198.51.100.1", "198.51.100.1"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{
+				Addr: &net.TCPAddr{IP: net.ParseIP(tt.peer), Port: 51234},
+			})
+			ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-forwarded-for", "203.0.113.7"))
+			var got netip.Addr
+			_, err := r.UnaryServerInterceptor()(ctx, nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, _ any) (any, error) {
+					got, _ = FromContext(ctx)
+					return nil, nil
+				})
+			if err != nil {
+				t.Fatalf("interceptor: %v", err)
+			}
+			if got != netip.MustParseAddr(tt.want) {
+				t.Errorf("got client address %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
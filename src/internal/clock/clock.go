@@ -0,0 +1,77 @@
+// Package clock abstracts the time, so that the time based behavior of the
+// service, e.g. scheduled jobs, retries, and quotas, can be tested
+// deterministically with the fake clock of the servicetest package.
+//
+// Components default to [Real] and accept another clock with a UseClock
+// method or a Clock field. Deadlines of contexts are always measured in real
+// time.
+package clock
+
+import (
+	"context"
+	"time"
+)
+
+// Clock tells the time and creates timers.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+
+	// NewTimer creates a timer that fires once d has passed.
+	NewTimer(d time.Duration) Timer
+}
+
+// Timer is a single event timer, see [time.Timer].
+type Timer interface {
+	// C returns the channel on which the time is delivered when
+	// the timer fires.
+	C() <-chan time.Time
+
+	// Stop prevents the timer from firing. It returns false if
+	// the timer already fired or was stopped.
+	Stop() bool
+}
+
+// Real is the clock of the system.
+var Real Clock = realClock{}
+
+// Or returns c, or [Real] if c is nil.
+func Or(c Clock) Clock {
+	if c == nil {
+		return Real
+	}
+	return c
+}
+
+// Since returns the time elapsed on the clock since t.
+func Since(c Clock, t time.Time) time.Duration { return c.Now().Sub(t) }
+
+// Until returns the duration on the clock until t.
+func Until(c Clock, t time.Time) time.Duration { return t.Sub(c.Now()) }
+
+// Sleep pauses until d has passed on the clock. This function returns the
+// error of ctx in case ctx is done first.
+func Sleep(ctx context.Context, c Clock, d time.Duration) error {
+	t := c.NewTimer(d)
+	select {
+	case <-ctx.Done():
+		t.Stop()
+		return ctx.Err() //nolint:wrapcheck // caller gave up
+	case <-t.C():
+		return nil
+	}
+}
+
+// realClock is the clock of the system.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+func (realClock) NewTimer(d time.Duration) Timer { return realTimer{time.NewTimer(d)} }
+
+// realTimer adapts a [time.Timer] to the [Timer] interface.
+type realTimer struct{ t *time.Timer }
+
+func (t realTimer) C() <-chan time.Time { return t.t.C }
+
+func (t realTimer) Stop() bool { return t.t.Stop() }
@@ -0,0 +1,450 @@
+// Package cloudevents wraps the messages of the bus in CloudEvents 1.0, so
+// that consumers outside of the services, e.g. the event gateways and the
+// serverless functions, understand them:
+//
+//	err := cloudevents.Publish(ctx, bus, cloudevents.Binary, codec.JSON, topic,
+//		cloudevents.Event{Source: "/venues", Type: "venue.created"}, venue)
+//
+//	func (s *ServiceName) Events() map[string]service.EventHandler {
+//		return map[string]service.EventHandler{
+//			topic: cloudevents.Handler(s.onVenueCreated),
+//		}
+//	}
+//
+// In the [Structured] mode the attributes and the data of the event are
+// encoded together as the json body of the message. In the [Binary] mode the
+// data is the body, and the attributes are carried by the headers of the
+// message, following the AMQP binding of the specification, see
+// [delivery.WithMetadata]. Consumers handle both modes alike, see [Unwrap].
+//
+// https://github.com/cloudevents/spec/blob/v1.0.2/cloudevents/spec.md
+package cloudevents
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"mime"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/eventscompass/service-template/src/internal/codec"
+	"github.com/eventscompass/service-template/src/internal/delivery"
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+// SpecVersion is the version of the specification of the events.
+const SpecVersion = "1.0"
+
+// ContentType is the content type of the messages of the [Structured] mode.
+const ContentType = "application/cloudevents+json"
+
+// HeaderPrefix prefixes the attributes carried by the headers of the messages
+// of the [Binary] mode, e.g. "cloudEvents_id".
+const HeaderPrefix = "cloudEvents_"
+
+// Mode is the way an event is encoded in a message.
+type Mode int
+
+// The modes of the specification.
+const (
+	// Structured encodes the event as a json object holding its
+	// attributes and its data.
+	Structured Mode = iota
+
+	// Binary encodes the data of the event as the body of the
+	// message, and its attributes as headers.
+	Binary
+)
+
+// Event is a CloudEvent. The specification version is always [SpecVersion].
+type Event struct {
+	// ID identifies the event within its source. Empty generates a
+	// random id on [Publish].
+	ID string
+
+	// Source identifies the context in which the event happened, e.g.
+	// "/venues". It is required.
+	Source string
+
+	// Type is the type of the event, e.g. "venue.created". Empty uses
+	// the full name of the proto message of the data on [Publish].
+	Type string
+
+	// Subject is the subject of the event within its source, e.g. the
+	// id of the venue.
+	Subject string
+
+	// Time is the time the event happened. Zero uses the time of
+	// [Publish].
+	Time time.Time
+
+	// DataContentType is the content type of the data, set by
+	// [Publish] to the content type of its codec.
+	DataContentType string
+
+	// DataSchema is the uri of the schema of the data.
+	DataSchema string
+
+	// Extensions are the extension attributes of the event, e.g.
+	// "tenant". The names consist of lower-case letters and digits.
+	Extensions map[string]string
+
+	// Data is the encoded data of the event.
+	Data []byte
+}
+
+// Publish encodes the data with the codec and publishes it to the topic, as
+// the data of the event encoded in the mode. This function returns
+// [service.ErrBadRequest] in case the event is invalid or the data cannot be
+// encoded, and the errors of the bus otherwise.
+func Publish[T any](
+	ctx context.Context,
+	bus service.MessageBus,
+	mode Mode,
+	c codec.Codec,
+	topic string,
+	e Event,
+	data T,
+) error {
+	var err error
+	if e.Data, err = c.Marshal(data); err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	if m, ok := any(data).(proto.Message); ok && e.Type == "" {
+		e.Type = string(proto.MessageName(m))
+	}
+	if e.ID == "" {
+		if e.ID, err = newID(); err != nil {
+			return fmt.Errorf("publish %s: %w", topic, err)
+		}
+	}
+	if e.Time.IsZero() {
+		e.Time = time.Now().UTC()
+	}
+	e.DataContentType = c.ContentType()
+	return PublishEvent(ctx, bus, mode, topic, e)
+}
+
+// PublishEvent publishes the event to the topic, encoded in the mode, e.g. an
+// event relayed from another source. This function returns
+// [service.ErrBadRequest] in case the event is invalid, and the errors of the
+// bus otherwise.
+func PublishEvent(
+	ctx context.Context,
+	bus service.MessageBus,
+	mode Mode,
+	topic string,
+	e Event,
+) error {
+	if err := e.Validate(); err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	if mode == Binary {
+		ctx = delivery.WithMetadata(ctx, delivery.Metadata{
+			Headers:     e.headers(),
+			ContentType: e.DataContentType,
+		})
+		return bus.Publish(ctx, topic, e.Data) //nolint:wrapcheck // the errors of the bus
+	}
+	msg, err := e.MarshalJSON()
+	if err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	ctx = delivery.WithMetadata(ctx, delivery.Metadata{ContentType: ContentType})
+	return bus.Publish(ctx, topic, msg) //nolint:wrapcheck // the errors of the bus
+}
+
+// Validate validates the attributes of the event. This function returns
+// [service.ErrBadRequest] in case a required attribute is missing, or an
+// extension is misnamed.
+func (e Event) Validate() error {
+	switch {
+	case e.ID == "":
+		return fmt.Errorf("%w: cloudevent without id", service.ErrBadRequest)
+	case e.Source == "":
+		return fmt.Errorf("%w: cloudevent without source", service.ErrBadRequest)
+	case e.Type == "":
+		return fmt.Errorf("%w: cloudevent without type", service.ErrBadRequest)
+	}
+	for name := range e.Extensions {
+		if !validName(name) || contextAttributes[name] {
+			return fmt.Errorf("%w: invalid cloudevent extension %q", service.ErrBadRequest, name)
+		}
+	}
+	return nil
+}
+
+// MarshalJSON implements the [json.Marshaler] interface, encoding the event in
+// the [Structured] mode. Json data is embedded as is, other data is encoded
+// as base64.
+func (e Event) MarshalJSON() ([]byte, error) {
+	obj := make(map[string]any, len(e.Extensions)+len(contextAttributes)) //nolint:gomnd // the attributes
+	for k, v := range e.Extensions {
+		obj[k] = v
+	}
+	for k, v := range e.attributes() {
+		obj[k] = v
+	}
+	if e.DataContentType != "" {
+		obj["datacontenttype"] = e.DataContentType
+	}
+	if e.Data != nil {
+		if isJSON(e.DataContentType) && json.Valid(e.Data) {
+			obj["data"] = json.RawMessage(e.Data)
+		} else {
+			obj["data_base64"] = base64.StdEncoding.EncodeToString(e.Data)
+		}
+	}
+	b, err := json.Marshal(obj)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encode cloudevent: %v", service.ErrBadRequest, err)
+	}
+	return b, nil
+}
+
+// UnmarshalJSON implements the [json.Unmarshaler] interface, decoding an event
+// encoded in the [Structured] mode. This function returns
+// [service.ErrBadRequest] in case the event is malformed or invalid.
+func (e *Event) UnmarshalJSON(b []byte) error {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return fmt.Errorf("%w: decode cloudevent: %v", service.ErrBadRequest, err)
+	}
+	attrs := make(map[string]string, len(obj))
+	for k, raw := range obj {
+		if k == "data" {
+			continue
+		}
+		var s string
+		if err := json.Unmarshal(raw, &s); err != nil {
+			s = string(raw) // e.g. an integer or boolean extension
+		}
+		attrs[k] = s
+	}
+	ev, err := fromAttributes(attrs)
+	if err != nil {
+		return err
+	}
+	if s, ok := attrs["data_base64"]; ok {
+		if ev.Data, err = base64.StdEncoding.DecodeString(s); err != nil {
+			return fmt.Errorf("%w: decode cloudevent data: %v", service.ErrBadRequest, err)
+		}
+	} else if raw, ok := obj["data"]; ok {
+		ev.Data = raw
+		if !isJSON(ev.DataContentType) {
+			var s string
+			if err := json.Unmarshal(raw, &s); err == nil {
+				ev.Data = []byte(s) // e.g. text/plain data
+			}
+		}
+	}
+	*e = ev
+	return nil
+}
+
+// Parse returns the event wrapped in the message, in either mode. Returns
+// false if the message is not a CloudEvent. This function returns
+// [service.ErrBadRequest] in case the event is malformed or invalid.
+func Parse(m *delivery.Message) (Event, bool, error) {
+	if mt, _, _ := mime.ParseMediaType(m.ContentType); mt == ContentType {
+		var e Event
+		if err := json.Unmarshal(m.Body, &e); err != nil {
+			return Event{}, true, err //nolint:wrapcheck // see UnmarshalJSON
+		}
+		return e, true, nil
+	}
+	if _, ok := m.Headers[HeaderPrefix+"specversion"]; !ok {
+		return Event{}, false, nil
+	}
+	attrs := make(map[string]string, len(m.Headers))
+	for k, v := range m.Headers {
+		if name, ok := strings.CutPrefix(k, HeaderPrefix); ok {
+			attrs[name] = v
+		}
+	}
+	if m.ContentType != "" {
+		attrs["datacontenttype"] = m.ContentType
+	}
+	e, err := fromAttributes(attrs)
+	if err != nil {
+		return Event{}, true, err
+	}
+	e.Data = m.Body
+	return e, true, nil
+}
+
+// Unwrap returns a handler unwrapping the CloudEvents before passing their
+// data to h, which reads the event with [FromContext]. Other messages are
+// passed to h unchanged. CloudEvents that are malformed fail with
+// [service.ErrBadRequest], see [delivery.Fail].
+func Unwrap(h service.EventHandler) service.EventHandler {
+	return delivery.Handler(func(ctx context.Context, m *delivery.Message) {
+		e, ok, err := Parse(m)
+		switch {
+		case err != nil:
+			slog.ErrorContext(ctx, "failed to decode cloudevent",
+				slog.String("topic", m.Topic),
+				slog.String("error", err.Error()),
+			)
+			delivery.Fail(ctx, err)
+		case ok:
+			h(eventKey.With(ctx, e), e.Data)
+		default:
+			h(ctx, m.Body)
+		}
+	})
+}
+
+// Handler returns a handler unwrapping the CloudEvents, see [Unwrap], and
+// decoding their data with the codec named by their content type, json by
+// default, before passing them to h. The errors of h are reported with
+// [delivery.Fail]. Messages that are not CloudEvents, or whose data cannot be
+// decoded, fail with [service.ErrBadRequest].
+func Handler[T any](h func(context.Context, Event, T) error) service.EventHandler {
+	return Unwrap(func(ctx context.Context, data []byte) {
+		e, ok := FromContext(ctx)
+		if !ok {
+			delivery.Fail(ctx, fmt.Errorf("%w: message is not a cloudevent", service.ErrBadRequest))
+			return
+		}
+		c := codec.JSON
+		if mt, _, _ := mime.ParseMediaType(e.DataContentType); mt != "" && !isJSON(mt) {
+			var err error
+			if c, err = codec.Lookup(mt); err != nil {
+				delivery.Fail(ctx, fmt.Errorf("%w: cloudevent %s: %v", service.ErrBadRequest, e.ID, err))
+				return
+			}
+		}
+		codec.TypedHandler(c, func(ctx context.Context, v T) error { return h(ctx, e, v) })(ctx, data)
+	})
+}
+
+// FromContext returns the event unwrapped by [Unwrap]. Returns false if the
+// message handled with ctx is not a CloudEvent.
+func FromContext(ctx context.Context) (Event, bool) {
+	return eventKey.From(ctx)
+}
+
+// attributes returns the context attributes of the event, but the content type
+// of the data, which the modes carry differently.
+func (e Event) attributes() map[string]string {
+	attrs := map[string]string{
+		"specversion": SpecVersion,
+		"id":          e.ID,
+		"source":      e.Source,
+		"type":        e.Type,
+	}
+	if e.Subject != "" {
+		attrs["subject"] = e.Subject
+	}
+	if !e.Time.IsZero() {
+		attrs["time"] = e.Time.Format(time.RFC3339Nano)
+	}
+	if e.DataSchema != "" {
+		attrs["dataschema"] = e.DataSchema
+	}
+	return attrs
+}
+
+// headers returns the headers of the event in the [Binary] mode.
+func (e Event) headers() map[string]string {
+	headers := make(map[string]string, len(e.Extensions)+len(contextAttributes))
+	for k, v := range e.Extensions {
+		headers[HeaderPrefix+k] = v
+	}
+	for k, v := range e.attributes() {
+		headers[HeaderPrefix+k] = v
+	}
+	return headers
+}
+
+// fromAttributes returns the event of the attributes. This function returns
+// [service.ErrBadRequest] in case the event is invalid.
+func fromAttributes(attrs map[string]string) (Event, error) {
+	if v := attrs["specversion"]; v != SpecVersion {
+		return Event{}, fmt.Errorf("%w: unsupported cloudevent version %q", service.ErrBadRequest, v)
+	}
+	e := Event{
+		ID:              attrs["id"],
+		Source:          attrs["source"],
+		Type:            attrs["type"],
+		Subject:         attrs["subject"],
+		DataContentType: attrs["datacontenttype"],
+		DataSchema:      attrs["dataschema"],
+	}
+	if s, ok := attrs["time"]; ok {
+		t, err := time.Parse(time.RFC3339Nano, s)
+		if err != nil {
+			return Event{}, fmt.Errorf("%w: cloudevent time: %v", service.ErrBadRequest, err)
+		}
+		e.Time = t
+	}
+	for k, v := range attrs {
+		if !contextAttributes[k] && k != "data_base64" {
+			if e.Extensions == nil {
+				e.Extensions = make(map[string]string)
+			}
+			e.Extensions[k] = v
+		}
+	}
+	if err := e.Validate(); err != nil {
+		return Event{}, err
+	}
+	return e, nil
+}
+
+// validName reports whether the name is a valid attribute name.
+func validName(name string) bool {
+	if name == "" || len(name) > 20 { //nolint:gomnd // see the specification
+		return false
+	}
+	for _, r := range name {
+		if (r < 'a' || r > 'z') && (r < '0' || r > '9') {
+			return false
+		}
+	}
+	return true
+}
+
+// isJSON reports whether the content type is json, e.g. "application/json" or
+// "application/vnd.venue+json". Empty is json, see the specification.
+func isJSON(contentType string) bool {
+	mt, _, _ := mime.ParseMediaType(contentType)
+	return mt == "" || mt == "application/json" || mt == "text/json" || strings.HasSuffix(mt, "+json")
+}
+
+// newID generates a random event id.
+func newID() (string, error) {
+	b := make([]byte, 16) //nolint:gomnd // 128 bits
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w: generate cloudevent id: %v", service.ErrUnexpected, err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+var (
+	// contextAttributes are the context attributes of the
+	// specification, which extensions must not reuse.
+	contextAttributes = map[string]bool{
+		"specversion":     true,
+		"id":              true,
+		"source":          true,
+		"type":            true,
+		"subject":         true,
+		"time":            true,
+		"datacontenttype": true,
+		"dataschema":      true,
+		"data":            true,
+	}
+
+	// eventKey is the context key of the event unwrapped by Unwrap.
+	eventKey = reqctx.NewKey[Event]("cloudevent")
+)
@@ -0,0 +1,113 @@
+// Package codec encodes the payloads of api responses and events. The codecs
+// are registered by content type, so that rest handlers negotiate the encoding
+// of their responses with the client, see [Negotiate], and events can be
+// published in a compact encoding, see [Publish]:
+//
+//	func (s *ServiceName) getEvent(w http.ResponseWriter, r *http.Request) {
+//		...
+//		codec.Write(w, r, http.StatusOK, event)
+//	}
+//
+// JSON is the default codec. [MessagePack] trades readability for less cpu
+// and smaller payloads on high-volume internal endpoints. Both use the json
+// struct tags, thus the same types work with either codec. [Proto] encodes
+// the generated types of protobuf schemas, which are the preferred way to
+// define events shared with other services, see [PublishEnvelope].
+package codec
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sync"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Codec encodes and decodes values of a content type.
+type Codec interface {
+	// ContentType returns the media type of the encoding, e.g.
+	// "application/json".
+	ContentType() string
+
+	// Marshal encodes the value.
+	Marshal(v any) ([]byte, error)
+
+	// Unmarshal decodes the data into the value pointed to by v.
+	// The data must not be retained after Unmarshal returns,
+	// since it may be a pooled buffer, see package bufpool.
+	Unmarshal(data []byte, v any) error
+}
+
+// bufferEncoder is implemented by the codecs that encode into a buffer, which
+// saves [Write] the copy of the encoded value.
+type bufferEncoder interface {
+	encodeTo(b *bytes.Buffer, v any) error
+}
+
+// JSON is the json [Codec].
+var JSON Codec = jsonCodec{}
+
+// Register registers the codec for its content type, replacing the codec
+// registered before for the same type. JSON, [MessagePack], and [Proto] are
+// registered by default.
+func Register(c Codec) {
+	mu.Lock()
+	defer mu.Unlock()
+	codecs[c.ContentType()] = c
+}
+
+// Lookup returns the codec registered for the media type. This function
+// returns [service.ErrNotFound] in case no codec is registered for the type.
+func Lookup(contentType string) (Codec, error) {
+	mu.RLock()
+	defer mu.RUnlock()
+	c, ok := codecs[contentType]
+	if !ok {
+		return nil, fmt.Errorf("%w: codec for %q", service.ErrNotFound, contentType)
+	}
+	return c, nil
+}
+
+// jsonCodec encodes values with encoding/json.
+type jsonCodec struct{}
+
+// ContentType implements the [Codec] interface.
+func (jsonCodec) ContentType() string { return "application/json" }
+
+// Marshal implements the [Codec] interface. This function returns
+// [service.ErrBadRequest] in case the value cannot be encoded.
+func (jsonCodec) Marshal(v any) ([]byte, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encode json: %v", service.ErrBadRequest, err)
+	}
+	return b, nil
+}
+
+// encodeTo implements the [bufferEncoder] interface.
+func (jsonCodec) encodeTo(b *bytes.Buffer, v any) error {
+	if err := json.NewEncoder(b).Encode(v); err != nil {
+		return fmt.Errorf("%w: encode json: %v", service.ErrBadRequest, err)
+	}
+	b.Truncate(b.Len() - 1) // the newline of Encode
+	return nil
+}
+
+// Unmarshal implements the [Codec] interface. This function returns
+// [service.ErrBadRequest] in case the data is malformed.
+func (jsonCodec) Unmarshal(data []byte, v any) error {
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%w: decode json: %v", service.ErrBadRequest, err)
+	}
+	return nil
+}
+
+var (
+	mu     sync.RWMutex
+	codecs = map[string]Codec{
+		JSON.ContentType():        JSON,
+		MessagePack.ContentType(): MessagePack,
+		Proto.ContentType():       Proto,
+	}
+)
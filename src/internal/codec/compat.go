@@ -0,0 +1,122 @@
+package codec
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protodesc"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+	"google.golang.org/protobuf/types/descriptorpb"
+)
+
+// CheckCompatibility reports the changes of a protobuf schema file that break
+// consumers of its old version. For every message of the old file, the new
+// file must keep the message, and keep every field with its number, name, kind
+// and cardinality, or reserve the number of a removed field. Names matter as
+// well, since they are used by the json encoding. New fields and messages are
+// always compatible. A test guards the event schemas with
+//
+//	files, err := codec.LoadDescriptors("testdata/events.v1.binpb")
+//	...
+//	old, err := files.FindFileByPath("events.proto")
+//	...
+//	err = codec.CheckCompatibility(old, eventsv1.File_events_proto)
+//
+// where the descriptors of the released schemas are written with
+// "protoc --descriptor_set_out". This function returns [service.ErrBadRequest]
+// listing the breaking changes.
+func CheckCompatibility(old, updated protoreflect.FileDescriptor) error {
+	c := &compatChecker{visited: make(map[protoreflect.FullName]bool)}
+	c.messages(old.Messages(), updated.Messages())
+	if len(c.problems) > 0 {
+		return fmt.Errorf("%w: incompatible schema %s: %s",
+			service.ErrBadRequest, old.Path(), strings.Join(c.problems, "; "))
+	}
+	return nil
+}
+
+// LoadDescriptors reads the schema files of a serialized
+// [descriptorpb.FileDescriptorSet], as written by "protoc --descriptor_set_out"
+// or "buf build". This function returns [service.ErrNotFound] in case the file
+// does not exist, and [service.ErrBadRequest] in case it is malformed.
+func LoadDescriptors(path string) (*protoregistry.Files, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("%w: descriptors %s", service.ErrNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: read descriptors: %v", service.ErrUnexpected, err)
+	}
+	var set descriptorpb.FileDescriptorSet
+	if err := proto.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", service.ErrBadRequest, path, err)
+	}
+	files, err := protodesc.NewFiles(&set)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", service.ErrBadRequest, path, err)
+	}
+	return files, nil
+}
+
+// compatChecker collects the breaking changes between two schemas.
+type compatChecker struct {
+	visited  map[protoreflect.FullName]bool
+	problems []string
+}
+
+// messages compares the old messages with the updated ones of the same name.
+func (c *compatChecker) messages(old, updated protoreflect.MessageDescriptors) {
+	for i := 0; i < old.Len(); i++ {
+		om := old.Get(i)
+		um := updated.ByName(om.Name())
+		if um == nil {
+			c.problemf("message %s removed", om.FullName())
+			continue
+		}
+		c.message(om, um)
+	}
+}
+
+// message compares the fields and the nested messages of the message.
+func (c *compatChecker) message(old, updated protoreflect.MessageDescriptor) {
+	if c.visited[old.FullName()] {
+		return
+	}
+	c.visited[old.FullName()] = true
+
+	fields := old.Fields()
+	for i := 0; i < fields.Len(); i++ {
+		of := fields.Get(i)
+		uf := updated.Fields().ByNumber(of.Number())
+		switch {
+		case uf == nil && updated.ReservedRanges().Has(of.Number()):
+		case uf == nil:
+			c.problemf("field %s (%d) removed without reserving its number", of.FullName(), of.Number())
+		case uf.Name() != of.Name():
+			c.problemf("field %s (%d) renamed to %s", of.FullName(), of.Number(), uf.Name())
+		case uf.Kind() != of.Kind():
+			c.problemf("field %s changed from %s to %s", of.FullName(), of.Kind(), uf.Kind())
+		case uf.Cardinality() != of.Cardinality() || uf.IsMap() != of.IsMap():
+			c.problemf("field %s changed cardinality", of.FullName())
+		case of.Message() != nil && of.Message().FullName() != uf.Message().FullName():
+			c.problemf("field %s changed from %s to %s",
+				of.FullName(), of.Message().FullName(), uf.Message().FullName())
+		case of.Enum() != nil && of.Enum().FullName() != uf.Enum().FullName():
+			c.problemf("field %s changed from %s to %s",
+				of.FullName(), of.Enum().FullName(), uf.Enum().FullName())
+		case of.Message() != nil && !of.IsMap():
+			c.message(of.Message(), uf.Message())
+		}
+	}
+	c.messages(old.Messages(), updated.Messages())
+}
+
+// problemf records a breaking change.
+func (c *compatChecker) problemf(format string, args ...any) {
+	c.problems = append(c.problems, fmt.Sprintf(format, args...))
+}
@@ -0,0 +1,179 @@
+package codec
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/protobuf/proto"
+
+	eventsv1 "github.com/eventscompass/service-template/pkg/events/v1"
+	"github.com/eventscompass/service-template/src/internal/delivery"
+)
+
+// Publish encodes the event with the codec and publishes it to the topic. The
+// message bus carries no content type, thus producers and consumers of a topic
+// have to agree on its codec. This function returns [service.ErrBadRequest] in
+// case the event cannot be encoded, and the errors of the bus otherwise.
+func Publish[T any](
+	ctx context.Context,
+	bus service.MessageBus,
+	c Codec,
+	topic string,
+	event T,
+) error {
+	msg, err := c.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	if err := bus.Publish(ctx, topic, msg); err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	return nil
+}
+
+// Handler returns an event handler decoding the messages with the codec before
+// passing them to h, like [TypedHandler] does.
+func Handler[T any](c Codec, h func(context.Context, T)) service.EventHandler {
+	return TypedHandler(c, func(ctx context.Context, event T) error {
+		h(ctx, event)
+		return nil
+	})
+}
+
+// TypedHandler returns an event handler decoding the messages with the codec
+// before passing them to fn, e.g. with [JSON] or [Proto]:
+//
+//	codec.TypedHandler(codec.JSON, func(ctx context.Context, v *venue) error {
+//		return s.project(ctx, v)
+//	})
+//
+// The errors of fn are reported to the bus with [delivery.Fail], thus the
+// message is retried. Messages that cannot be decoded are logged and fail with
+// [service.ErrBadRequest], which is not retryable, thus they are dead-lettered
+// at once.
+func TypedHandler[T any](c Codec, fn func(context.Context, T) error) service.EventHandler {
+	return func(ctx context.Context, msg []byte) {
+		var event T
+		if err := c.Unmarshal(msg, &event); err != nil {
+			slog.ErrorContext(ctx, "failed to decode event",
+				slog.String("codec", c.ContentType()),
+				slog.String("error", err.Error()),
+			)
+			delivery.Fail(ctx, err)
+			return
+		}
+		if err := fn(ctx, event); err != nil {
+			delivery.Fail(ctx, err)
+		}
+	}
+}
+
+// Meta describes an event received in an envelope.
+type Meta struct {
+	// ContentType is the media type with which the event was
+	// encoded.
+	ContentType string
+
+	// Type is the name of the event, e.g. the full name of its
+	// proto message.
+	Type string
+
+	// Version is the schema version of the event.
+	Version uint32
+
+	// Headers carry context with the event, e.g. the tenant.
+	Headers map[string]string
+}
+
+// PublishEnvelope encodes the event with the codec and publishes it to the
+// topic, wrapped in an [eventsv1.Envelope] naming the content type, the type
+// and the schema version of the event. Consumers handle the events with
+// [EnvelopeHandler], which does not need to know the codec up front, thus
+// producers can change codecs and schema versions without breaking their
+// consumers. The type defaults to the full name of proto messages. This
+// function returns [service.ErrBadRequest] in case the event cannot be
+// encoded, and the errors of the bus otherwise.
+func PublishEnvelope[T any](
+	ctx context.Context,
+	bus service.MessageBus,
+	c Codec,
+	topic string,
+	meta Meta,
+	event T,
+) error {
+	data, err := c.Marshal(event)
+	if err != nil {
+		return fmt.Errorf("publish %s: %w", topic, err)
+	}
+	if m, ok := any(event).(proto.Message); ok && meta.Type == "" {
+		meta.Type = string(proto.MessageName(m))
+	}
+	meta.ContentType = c.ContentType()
+	return PublishEncoded(ctx, bus, topic, meta, data)
+}
+
+// PublishEncoded publishes an event that is already encoded with the codec
+// named by the content type of the metadata, e.g. an event read from the event
+// store, wrapped in an envelope like [PublishEnvelope] does. This function
+// returns the errors of the bus.
+func PublishEncoded(
+	ctx context.Context,
+	bus service.MessageBus,
+	topic string,
+	meta Meta,
+	data []byte,
+) error {
+	return Publish(ctx, bus, Proto, topic, &eventsv1.Envelope{
+		ContentType: meta.ContentType,
+		Type:        meta.Type,
+		Version:     meta.Version,
+		Data:        data,
+		Headers:     meta.Headers,
+	})
+}
+
+// EnvelopeHandler returns an event handler opening the envelopes published with
+// [PublishEnvelope], and decoding the events with the codec named by the
+// envelope. The handler receives the metadata of the envelope, e.g. to upgrade
+// events of old schema versions. Messages that cannot be decoded are logged and
+// fail, like with [TypedHandler].
+func EnvelopeHandler[T any](h func(context.Context, Meta, T)) service.EventHandler {
+	return func(ctx context.Context, msg []byte) {
+		meta, c, data, err := OpenEnvelope(msg)
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to decode event",
+				slog.String("type", meta.Type),
+				slog.String("error", err.Error()),
+			)
+			delivery.Fail(ctx, err)
+			return
+		}
+		Handler(c, func(ctx context.Context, event T) { h(ctx, meta, event) })(ctx, data)
+	}
+}
+
+// OpenEnvelope opens an envelope published with [PublishEnvelope], returning
+// its metadata, the codec named by it and the encoded event, for consumers
+// that transform the event before decoding it, e.g. to upgrade old schema
+// versions. This function returns [service.ErrBadRequest] in case the
+// envelope is malformed, and [service.ErrNotFound] in case its codec is not
+// registered.
+func OpenEnvelope(msg []byte) (Meta, Codec, []byte, error) {
+	var env eventsv1.Envelope
+	if err := Proto.Unmarshal(msg, &env); err != nil {
+		return Meta{}, nil, nil, fmt.Errorf("open envelope: %w", err)
+	}
+	meta := Meta{
+		ContentType: env.GetContentType(),
+		Type:        env.GetType(),
+		Version:     env.GetVersion(),
+		Headers:     env.GetHeaders(),
+	}
+	c, err := Lookup(meta.ContentType)
+	if err != nil {
+		return meta, nil, nil, err
+	}
+	return meta, c, env.GetData(), nil
+}
@@ -0,0 +1,118 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/bufpool"
+)
+
+// Negotiate returns the registered codec preferred by the Accept header of the
+// request. It returns JSON if the request accepts any type, or none of the
+// registered ones.
+func Negotiate(r *http.Request) Codec {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return JSON
+	}
+	for _, mt := range acceptedTypes(accept) {
+		if mt == "*/*" || mt == "application/*" {
+			return JSON
+		}
+		if c, err := Lookup(mt); err == nil {
+			return c
+		}
+	}
+	return JSON
+}
+
+// Decode decodes the body of the request into the value pointed to by v, with
+// the codec of the Content-Type header. Requests without content type are
+// decoded as json. This function returns [service.ErrBadRequest] in case the
+// body is malformed or of an unsupported type.
+func Decode(r *http.Request, v any) error {
+	c := JSON
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		mt, _, err := mime.ParseMediaType(ct)
+		if err != nil {
+			return fmt.Errorf("%w: content type: %v", service.ErrBadRequest, err)
+		}
+		if c, err = Lookup(mt); err != nil {
+			return fmt.Errorf("%w: unsupported content type %q", service.ErrBadRequest, mt)
+		}
+	}
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+	if _, err := buf.ReadFrom(r.Body); err != nil {
+		return fmt.Errorf("%w: read body: %v", service.ErrBadRequest, err)
+	}
+	return c.Unmarshal(buf.Bytes(), v) //nolint:wrapcheck // documented by the codecs
+}
+
+// Write writes the value as the response, encoded with the codec negotiated
+// with the client, see [Negotiate]. Encoding errors are written with
+// [service.HTTPError].
+func Write(w http.ResponseWriter, r *http.Request, status int, v any) {
+	c := Negotiate(r)
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+	b, err := encode(c, buf, v)
+	if err != nil {
+		service.HTTPError(r.Context(), w, err)
+		return
+	}
+	w.Header().Set("Content-Type", c.ContentType())
+	w.Header().Add("Vary", "Accept")
+	w.WriteHeader(status)
+	w.Write(b) //nolint:errcheck,gosec // the client is gone
+}
+
+// encode encodes the value with the codec, into the buffer if the codec
+// supports it.
+func encode(c Codec, buf *bytes.Buffer, v any) ([]byte, error) {
+	if e, ok := c.(bufferEncoder); ok {
+		if err := e.encodeTo(buf, v); err != nil {
+			return nil, err
+		}
+		return buf.Bytes(), nil
+	}
+	return c.Marshal(v) //nolint:wrapcheck // documented by the codecs
+}
+
+// acceptedTypes returns the media types of the Accept header, ordered by their
+// quality. Types with quality 0 are dropped.
+func acceptedTypes(accept string) []string {
+	type accepted struct {
+		typ string
+		q   float64
+	}
+	var res []accepted
+	for _, part := range strings.Split(accept, ",") {
+		mt, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if v, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			res = append(res, accepted{mt, q})
+		}
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].q > res[j].q })
+	types := make([]string, len(res))
+	for i, a := range res {
+		types[i] = a.typ
+	}
+	return types
+}
@@ -0,0 +1,55 @@
+package codec
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/eventscompass/service-framework/service"
+	"github.com/vmihailenco/msgpack/v5"
+
+	"github.com/eventscompass/service-template/src/internal/bufpool"
+)
+
+// MessagePack is the MessagePack [Codec]. Struct fields are named after their
+// json tags, and omitempty is honoured, thus the encoded maps have the same
+// keys as the json encoding.
+var MessagePack Codec = msgpackCodec{}
+
+// msgpackCodec encodes values with github.com/vmihailenco/msgpack.
+type msgpackCodec struct{}
+
+// ContentType implements the [Codec] interface.
+func (msgpackCodec) ContentType() string { return "application/msgpack" }
+
+// Marshal implements the [Codec] interface. This function returns
+// [service.ErrBadRequest] in case the value cannot be encoded.
+func (c msgpackCodec) Marshal(v any) ([]byte, error) {
+	buf := bufpool.Get()
+	defer bufpool.Put(buf)
+	if err := c.encodeTo(buf, v); err != nil {
+		return nil, err
+	}
+	return bytes.Clone(buf.Bytes()), nil
+}
+
+// encodeTo implements the [bufferEncoder] interface.
+func (msgpackCodec) encodeTo(b *bytes.Buffer, v any) error {
+	enc := msgpack.NewEncoder(b)
+	enc.SetCustomStructTag("json")
+	enc.UseCompactInts(true)
+	if err := enc.Encode(v); err != nil {
+		return fmt.Errorf("%w: encode msgpack: %v", service.ErrBadRequest, err)
+	}
+	return nil
+}
+
+// Unmarshal implements the [Codec] interface. This function returns
+// [service.ErrBadRequest] in case the data is malformed.
+func (msgpackCodec) Unmarshal(data []byte, v any) error {
+	dec := msgpack.NewDecoder(bytes.NewReader(data))
+	dec.SetCustomStructTag("json")
+	if err := dec.Decode(v); err != nil {
+		return fmt.Errorf("%w: decode msgpack: %v", service.ErrBadRequest, err)
+	}
+	return nil
+}
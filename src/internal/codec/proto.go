@@ -0,0 +1,67 @@
+package codec
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/protobuf/proto"
+)
+
+// Proto is the protobuf [Codec]. It encodes values that are proto messages,
+// e.g. the generated types of the event schemas in pkg/events. Unmarshal also
+// accepts pointers to nil message pointers, as used by [Handler].
+var Proto Codec = protoCodec{}
+
+// protoCodec encodes proto messages in the binary wire format.
+type protoCodec struct{}
+
+// ContentType implements the [Codec] interface.
+func (protoCodec) ContentType() string { return "application/x-protobuf" }
+
+// Marshal implements the [Codec] interface. This function returns
+// [service.ErrBadRequest] in case the value is not a proto message or cannot be
+// encoded.
+func (protoCodec) Marshal(v any) ([]byte, error) {
+	m, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("%w: encode protobuf: %T is not a proto message", service.ErrBadRequest, v)
+	}
+	b, err := proto.Marshal(m)
+	if err != nil {
+		return nil, fmt.Errorf("%w: encode protobuf: %v", service.ErrBadRequest, err)
+	}
+	return b, nil
+}
+
+// Unmarshal implements the [Codec] interface. This function returns
+// [service.ErrBadRequest] in case v is not a proto message or the data is
+// malformed.
+func (protoCodec) Unmarshal(data []byte, v any) error {
+	m, ok := v.(proto.Message)
+	if !ok {
+		m, ok = allocMessage(v)
+	}
+	if !ok {
+		return fmt.Errorf("%w: decode protobuf: %T is not a proto message", service.ErrBadRequest, v)
+	}
+	if err := proto.Unmarshal(data, m); err != nil {
+		return fmt.Errorf("%w: decode protobuf: %v", service.ErrBadRequest, err)
+	}
+	return nil
+}
+
+// allocMessage allocates the message pointed to by v, if v is a pointer to a
+// message pointer.
+func allocMessage(v any) (proto.Message, bool) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Pointer {
+		return nil, false
+	}
+	elem := rv.Elem()
+	if elem.IsNil() {
+		elem.Set(reflect.New(elem.Type().Elem()))
+	}
+	m, ok := elem.Interface().(proto.Message)
+	return m, ok
+}
@@ -0,0 +1,167 @@
+// Package csrf protects browser-facing services against cross-site request
+// forgery with the double-submit cookie pattern.
+//
+// Every response sets a random token in a cookie readable by the page. Requests
+// with unsafe methods must echo the token in a header or form field. A
+// cross-site attacker can make the browser send the cookie, but cannot read it,
+// and thus cannot echo it.
+package csrf
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Config encapsulates the configuration for the csrf protection.
+type Config struct {
+	// CookieName is the name of the cookie holding the token.
+	CookieName string `env:"CSRF_COOKIE_NAME" envDefault:"csrf_token"`
+
+	// Header is the request header echoing the token, used by
+	// scripts.
+	Header string `env:"CSRF_HEADER" envDefault:"X-CSRF-Token"`
+
+	// FormField is the form field echoing the token, used by
+	// html forms.
+	FormField string `env:"CSRF_FORM_FIELD" envDefault:"csrf_token"`
+
+	// ExemptPaths are not protected, e.g. webhooks that are
+	// authenticated otherwise. A trailing "*" matches any
+	// suffix.
+	ExemptPaths []string `env:"CSRF_EXEMPT_PATHS"`
+
+	// SameSite is the SameSite attribute of the cookie, one of
+	// "lax", "strict" or "none".
+	SameSite string `env:"CSRF_SAME_SITE" envDefault:"lax"`
+
+	// Secure restricts the cookie to https. It should only be
+	// disabled for local development.
+	Secure bool `env:"CSRF_COOKIE_SECURE" envDefault:"true"`
+
+	// MaxAge is the lifetime of the token.
+	MaxAge time.Duration `env:"CSRF_COOKIE_MAX_AGE" envDefault:"12h"`
+}
+
+// Protect returns an http middleware enforcing the csrf protection. Requests
+// with unsafe methods to non-exempt paths, which do not echo the token of the
+// cookie, are rejected with 403. This function returns [service.ErrBadRequest]
+// in case the SameSite setting is invalid.
+func Protect(cfg Config) (func(http.Handler) http.Handler, error) {
+	sameSite, ok := sameSiteModes[strings.ToLower(cfg.SameSite)]
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid SameSite mode %q", service.ErrBadRequest, cfg.SameSite)
+	}
+	if sameSite == http.SameSiteNoneMode && !cfg.Secure {
+		return nil, fmt.Errorf("%w: SameSite=None requires secure cookies", service.ErrBadRequest)
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			var token string
+			if c, err := r.Cookie(cfg.CookieName); err == nil && len(c.Value) == encodedTokenLen {
+				token = c.Value
+			}
+
+			if !safeMethods[r.Method] && !exempt(cfg.ExemptPaths, r.URL.Path) {
+				echoed := r.Header.Get(cfg.Header)
+				if echoed == "" && cfg.FormField != "" {
+					echoed = r.PostFormValue(cfg.FormField)
+				}
+				if token == "" ||
+					subtle.ConstantTimeCompare([]byte(echoed), []byte(token)) != 1 {
+					service.HTTPError(ctx, w,
+						fmt.Errorf("%w: csrf token missing or invalid", service.ErrNotAllowed))
+					return
+				}
+			}
+
+			if token == "" {
+				var err error
+				if token, err = newToken(); err != nil {
+					service.HTTPError(ctx, w, err)
+					return
+				}
+				http.SetCookie(w, &http.Cookie{
+					Name:   cfg.CookieName,
+					Value:  token,
+					Path:   "/",
+					MaxAge: int(cfg.MaxAge.Seconds()),
+					Secure: cfg.Secure,
+					// The page must be able to read the token in
+					// order to echo it.
+					HttpOnly: false,
+					SameSite: sameSite,
+				})
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(ctx, tokenKey{}, token)))
+		})
+	}, nil
+}
+
+// Token returns the csrf token of the request, which has to be embedded into
+// html forms. Returns an empty string if the request did not pass through the
+// middleware.
+func Token(ctx context.Context) string {
+	t, _ := ctx.Value(tokenKey{}).(string)
+	return t
+}
+
+// exempt reports whether the path matches any of the exempt paths.
+func exempt(paths []string, path string) bool {
+	for _, p := range paths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+// newToken returns a new random token.
+func newToken() (string, error) {
+	b := make([]byte, tokenLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w: generate csrf token: %v", service.ErrUnexpected, err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// tokenKey is the context key of the token.
+type tokenKey struct{}
+
+const (
+	// tokenLen is the number of random bytes of a token.
+	tokenLen = 32
+
+	// encodedTokenLen is the length of an encoded token. Cookies of a
+	// different length were not set by us and are replaced.
+	encodedTokenLen = (tokenLen*8 + 5) / 6
+)
+
+var (
+	// safeMethods do not change state and thus need no protection.
+	safeMethods = map[string]bool{
+		http.MethodGet:     true,
+		http.MethodHead:    true,
+		http.MethodOptions: true,
+		http.MethodTrace:   true,
+	}
+
+	sameSiteModes = map[string]http.SameSite{
+		"lax":    http.SameSiteLaxMode,
+		"strict": http.SameSiteStrictMode,
+		"none":   http.SameSiteNoneMode,
+	}
+)
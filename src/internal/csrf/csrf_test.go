@@ -0,0 +1,128 @@
+package csrf
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+func TestProtectConfig(t *testing.T) {
+	tests := []struct {
+		name     string
+		sameSite string
+		secure   bool
+		wantErr  error
+	}{
+		{"lax", "lax", false, nil},
+		{"strict uppercase", "Strict", true, nil},
+		{"none secure", "none", true, nil},
+		{"none insecure", "none", false, service.ErrBadRequest},
+		{"unknown", "loose", true, service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Protect(Config{SameSite: tt.sameSite, Secure: tt.secure}); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestProtect(t *testing.T) {
+	token, _ := newToken()
+	other, _ := newToken()
+
+	tests := []struct {
+		name       string
+		method     string
+		path       string
+		cookie     string
+		header     string
+		form       string
+		want       int
+		wantCookie bool // whether a new token is issued
+	}{
+		{"safe method without token", http.MethodGet, "/", "", "", "", http.StatusOK, true},
+		{"safe method with token", http.MethodGet, "/", token, "", "", http.StatusOK, false},
+		{"header echo", http.MethodPost, "/", token, token, "", http.StatusOK, false},
+		{"form echo", http.MethodPost, "/", token, "", token, http.StatusOK, false},
+		{"token mismatch", http.MethodPost, "/", token, other, "", http.StatusForbidden, false},
+		{"form token mismatch", http.MethodPut, "/", token, "", other, http.StatusForbidden, false},
+		{"missing echo", http.MethodDelete, "/", token, "", "", http.StatusForbidden, false},
+		{"missing cookie", http.MethodPost, "/", "", token, "", http.StatusForbidden, false},
+		{"forged short cookie", http.MethodPost, "/", "abc", "abc", "", http.StatusForbidden, false},
+		{"forged short cookie replaced", http.MethodGet, "/", "abc", "", "", http.StatusOK, true},
+		{"exempt path", http.MethodPost, "/webhooks/stripe", "", "", "", http.StatusOK, true},
+		{"exempt exact path", http.MethodPost, "/callback", "", "", "", http.StatusOK, true},
+		{"not exempt", http.MethodPost, "/callback/other", "", "", "", http.StatusForbidden, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			protect, err := Protect(Config{
+				CookieName:  "csrf_token",
+				Header:      "X-CSRF-Token",
+				FormField:   "csrf_token",
+				ExemptPaths: []string{"/webhooks/*", "/callback"},
+				SameSite:    "lax",
+				Secure:      true,
+				MaxAge:      time.Hour,
+			})
+			if err != nil {
+				t.Fatalf("create middleware: %v", err)
+			}
+			var ctxToken string
+			h := protect(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				ctxToken = Token(r.Context())
+			}))
+
+			var body *strings.Reader
+			if tt.form != "" {
+				body = strings.NewReader(url.Values{"csrf_token": {tt.form}}.Encode())
+			} else {
+				body = strings.NewReader("")
+			}
+			req := httptest.NewRequest(tt.method, tt.path, body)
+			if tt.form != "" {
+				req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			}
+			if tt.cookie != "" {
+				req.AddCookie(&http.Cookie{Name: "csrf_token", Value: tt.cookie})
+			}
+			if tt.header != "" {
+				req.Header.Set("X-CSRF-Token", tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != tt.want {
+				t.Fatalf("got status %d, want %d", rec.Code, tt.want)
+			}
+			cookies := rec.Result().Cookies()
+			if got := len(cookies) == 1; got != tt.wantCookie {
+				t.Fatalf("got cookies %v, want a new token %v", cookies, tt.wantCookie)
+			}
+			if tt.want != http.StatusOK {
+				return
+			}
+			want := tt.cookie
+			if tt.wantCookie {
+				c := cookies[0]
+				if len(c.Value) != encodedTokenLen || c.HttpOnly || !c.Secure || c.SameSite != http.SameSiteLaxMode {
+					t.Errorf("got cookie %+v, want a readable, secure, lax token", c)
+				}
+				want = c.Value
+			}
+			if ctxToken != want {
+				t.Errorf("got token %q in the context, want %q", ctxToken, want)
+			}
+		})
+	}
+}
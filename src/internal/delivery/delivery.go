@@ -0,0 +1,258 @@
+// Package delivery reports the outcome of handling a message to the message
+// bus that delivered it. The handlers of the framework, [service.EventHandler],
+// return nothing, thus a handler that fails to handle a message reports it
+// with [Fail], so that the bus retries the message, and sets it aside once the
+// retries are exhausted instead of dropping it:
+//
+//	func (s *ServiceName) onVenueCreated(ctx context.Context, msg []byte) {
+//		if err := s.project(ctx, msg); err != nil {
+//			delivery.Fail(ctx, err)
+//		}
+//	}
+//
+// A handler that panics fails too. Handlers that settle the messages
+// themselves, or read their headers and delivery metadata, get the message as
+// a [Message] by wrapping them with [Handler]:
+//
+//	delivery.Handler(func(ctx context.Context, m *delivery.Message) {
+//		if !s.ready() {
+//			m.Nack(true) // delivered again, to this or another replica
+//			return
+//		}
+//		// ...
+//	})
+//
+// The messages a handler does not settle are acknowledged once it returns,
+// unless it failed. Handlers called outside of a bus reporting the outcome,
+// e.g. in tests, ignore [Fail] and the settlements.
+//
+// Messages are published with headers and a content type by [Publish], e.g.
+// the tenant of the request, instead of smuggling them inside the body:
+//
+//	err := delivery.Publish(ctx, bus, topic, body, delivery.Metadata{
+//		Headers:     tenant.Inject(ctx, nil),
+//		ContentType: "application/json",
+//	})
+//
+// The correlation id of a handled message, see [HeaderCorrelationID], is
+// carried over to the messages published by its handler, and is the request
+// id of its context, see [reqctx.RequestIDFrom].
+package delivery
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+// ErrRejected is the error of the messages rejected with [Message.Nack]
+// without requeueing them.
+var ErrRejected = errors.New("rejected by the handler")
+
+// HeaderCorrelationID is the header correlating a message with the message
+// whose handler published it, e.g. the id of the request that started the
+// chain of events.
+const HeaderCorrelationID = "x-correlation-id"
+
+// Metadata is the metadata of a message besides its body.
+type Metadata struct {
+	// Headers are the headers of the message, e.g. the trace context.
+	Headers map[string]string
+
+	// ContentType is the content type of the body, if the publisher
+	// set one.
+	ContentType string
+}
+
+// WithMetadata returns a context publishing the messages with the metadata,
+// e.g. the attributes of a binary CloudEvent. The headers are merged with the
+// ones of ctx, if any.
+func WithMetadata(ctx context.Context, md Metadata) context.Context {
+	prev, _ := metadataKey.From(ctx)
+	headers := make(map[string]string, len(prev.Headers)+len(md.Headers))
+	for k, v := range prev.Headers {
+		headers[k] = v
+	}
+	for k, v := range md.Headers {
+		headers[k] = v
+	}
+	if md.ContentType == "" {
+		md.ContentType = prev.ContentType
+	}
+	md.Headers = headers
+	return metadataKey.With(ctx, md)
+}
+
+// Publish publishes the body to the topic with the metadata, and with the
+// metadata of ctx, see [WithMetadata]. This function returns the errors of
+// the bus.
+func Publish(
+	ctx context.Context,
+	bus service.MessageBus,
+	topic string,
+	body []byte,
+	md Metadata,
+) error {
+	return bus.Publish(WithMetadata(ctx, md), topic, body) //nolint:wrapcheck // the errors of the bus
+}
+
+// MetadataFrom returns the metadata of the messages published with ctx, see
+// [WithMetadata]. The buses publish the metadata with the messages.
+func MetadataFrom(ctx context.Context) Metadata {
+	md, _ := metadataKey.From(ctx)
+	return md
+}
+
+// Message is a message delivered by the bus, see [Handler].
+type Message struct {
+	// Topic is the topic the message was published to.
+	Topic string
+
+	// Body is the payload of the message.
+	Body []byte
+
+	Metadata
+
+	// Redelivered tells that the broker delivered the message before,
+	// e.g. to a replica that stopped before acknowledging it.
+	Redelivered bool
+
+	// Attempt is the number of the attempt to handle the message,
+	// starting at 1, see [Handle].
+	Attempt int
+
+	outcome *outcome // nil outside of Handle
+}
+
+// Ack acknowledges the message, thus it is not delivered again, even if the
+// handler fails after.
+func (m *Message) Ack() { m.settle(Acked) }
+
+// Nack rejects the message. With requeue the message is returned to its queue
+// and delivered again, without being retried first. Otherwise the message is
+// handled like a message failing on every attempt, i.e. it is dead-lettered,
+// see [ErrRejected].
+func (m *Message) Nack(requeue bool) {
+	if requeue {
+		m.settle(Requeued)
+	} else {
+		m.settle(Rejected)
+	}
+}
+
+// settle settles the message, unless it is settled already.
+func (m *Message) settle(s Settlement) {
+	if m.outcome == nil {
+		return
+	}
+	m.outcome.mu.Lock()
+	defer m.outcome.mu.Unlock()
+	if m.outcome.settlement == Unsettled {
+		m.outcome.settlement = s
+	}
+}
+
+// Settlement is how a handler settled a message, see [Handle].
+type Settlement int
+
+// The settlements of a message.
+const (
+	// Unsettled messages are acknowledged once the handler returns,
+	// or retried in case it failed.
+	Unsettled Settlement = iota
+
+	// Acked messages were acknowledged with [Message.Ack].
+	Acked
+
+	// Requeued messages are returned to their queue, see
+	// [Message.Nack].
+	Requeued
+
+	// Rejected messages are dead-lettered, see [Message.Nack].
+	Rejected
+)
+
+// Handler adapts a handler of messages to the handlers of the framework. The
+// handler gets the message delivered by the bus, see [Handle], or a message
+// with only the body if it is called outside of a bus.
+func Handler(h func(ctx context.Context, m *Message)) service.EventHandler {
+	return func(ctx context.Context, msg []byte) {
+		m, ok := messageKey.From(ctx)
+		if !ok {
+			m = &Message{Body: msg, Attempt: 1}
+		}
+		h(ctx, m)
+	}
+}
+
+// Fail reports that the handler of the message delivered with ctx failed. The
+// first error reported is kept.
+func Fail(ctx context.Context, err error) {
+	m, ok := messageKey.From(ctx)
+	if !ok || m.outcome == nil || err == nil {
+		return
+	}
+	m.outcome.mu.Lock()
+	defer m.outcome.mu.Unlock()
+	if m.outcome.err == nil {
+		m.outcome.err = err
+	}
+}
+
+// Handle calls the handler with the body of the message, and returns how the
+// handler settled the message and the error it reported with [Fail], or
+// [ErrRejected] for a message it rejected. The messages published by the
+// handler carry the correlation id of the message, which is also the request
+// id of the context of the handler. This function returns
+// [service.ErrUnexpected] in case the handler panics before acknowledging the
+// message.
+func Handle(ctx context.Context, h service.EventHandler, m *Message) (s Settlement, err error) {
+	o := &outcome{}
+	m.outcome = o
+	defer func() {
+		m.outcome = nil
+		if r := recover(); r != nil {
+			if s, _ = o.result(); s != Acked {
+				err = fmt.Errorf("%w: handler panicked: %v", service.ErrUnexpected, r)
+			}
+		}
+	}()
+	ctx = messageKey.With(ctx, m)
+	if id := m.Headers[HeaderCorrelationID]; id != "" {
+		ctx = WithMetadata(ctx, Metadata{Headers: map[string]string{HeaderCorrelationID: id}})
+		ctx = reqctx.WithRequestID(ctx, id)
+	}
+	h(ctx, m.Body)
+	return o.result()
+}
+
+// outcome is the outcome of handling a message, see [Handle].
+type outcome struct {
+	mu         sync.Mutex
+	settlement Settlement
+	err        error
+}
+
+// result returns the settlement and the error of the handler.
+func (o *outcome) result() (Settlement, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.settlement == Rejected && o.err == nil {
+		return o.settlement, ErrRejected
+	}
+	return o.settlement, o.err
+}
+
+var (
+	// messageKey is the context key of the message being handled.
+	messageKey = reqctx.NewKey[*Message]("delivery_message")
+
+	// metadataKey is the context key of the metadata of the
+	// published messages.
+	metadataKey = reqctx.NewKey[Metadata]("delivery_metadata")
+)
@@ -0,0 +1,183 @@
+package delivery
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+func TestHandle(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name           string
+		h              func(ctx context.Context, m *Message)
+		wantSettlement Settlement
+		wantErr        error
+	}{
+		{
+			name:           "handled",
+			h:              func(context.Context, *Message) {},
+			wantSettlement: Unsettled,
+		},
+		{
+			name:           "failed",
+			h:              func(ctx context.Context, _ *Message) { Fail(ctx, errFailed) },
+			wantSettlement: Unsettled,
+			wantErr:        errFailed,
+		},
+		{
+			name: "keeps the first failure",
+			h: func(ctx context.Context, _ *Message) {
+				Fail(ctx, errFailed)
+				Fail(ctx, errors.New("other"))
+			},
+			wantSettlement: Unsettled,
+			wantErr:        errFailed,
+		},
+		{
+			name:           "nil failure",
+			h:              func(ctx context.Context, _ *Message) { Fail(ctx, nil) },
+			wantSettlement: Unsettled,
+		},
+		{
+			name:           "acked",
+			h:              func(_ context.Context, m *Message) { m.Ack() },
+			wantSettlement: Acked,
+		},
+		{
+			name:           "requeued",
+			h:              func(_ context.Context, m *Message) { m.Nack(true) },
+			wantSettlement: Requeued,
+		},
+		{
+			name:           "rejected",
+			h:              func(_ context.Context, m *Message) { m.Nack(false) },
+			wantSettlement: Rejected,
+			wantErr:        ErrRejected,
+		},
+		{
+			name: "rejected after a failure",
+			h: func(ctx context.Context, m *Message) {
+				Fail(ctx, errFailed)
+				m.Nack(false)
+			},
+			wantSettlement: Rejected,
+			wantErr:        errFailed,
+		},
+		{
+			name: "keeps the first settlement",
+			h: func(_ context.Context, m *Message) {
+				m.Ack()
+				m.Nack(true)
+			},
+			wantSettlement: Acked,
+		},
+		{
+			name:           "panics",
+			h:              func(context.Context, *Message) { panic("boom") },
+			wantSettlement: Unsettled,
+			wantErr:        service.ErrUnexpected,
+		},
+		{
+			name: "panics after the ack",
+			h: func(_ context.Context, m *Message) {
+				m.Ack()
+				panic("boom")
+			},
+			wantSettlement: Acked,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			m := &Message{Topic: "t", Body: []byte("body"), Attempt: 1}
+			s, err := Handle(context.Background(), Handler(tt.h), m)
+			if s != tt.wantSettlement {
+				t.Errorf("got settlement %v, want %v", s, tt.wantSettlement)
+			}
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			// The message cannot be settled after Handle returned.
+			m.Nack(true)
+		})
+	}
+}
+
+func TestHandleConcurrentSettlements(t *testing.T) {
+	h := Handler(func(ctx context.Context, m *Message) {
+		var wg sync.WaitGroup
+		for i := 0; i < 10; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				switch i % 3 {
+				case 0:
+					m.Ack()
+				case 1:
+					m.Nack(i%2 == 0)
+				default:
+					Fail(ctx, errors.New("failed"))
+				}
+			}(i)
+		}
+		wg.Wait()
+	})
+	s, _ := Handle(context.Background(), h, &Message{Attempt: 1})
+	if s == Unsettled {
+		t.Errorf("got settlement %v, want the first settlement of the handler", s)
+	}
+}
+
+func TestHandleCorrelationID(t *testing.T) {
+	var (
+		requestID string
+		md        Metadata
+	)
+	h := func(ctx context.Context, _ []byte) {
+		requestID, _ = reqctx.RequestIDFrom(ctx)
+		md = MetadataFrom(ctx)
+	}
+	m := &Message{Metadata: Metadata{Headers: map[string]string{HeaderCorrelationID: "c-1"}}}
+	if _, err := Handle(context.Background(), h, m); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if requestID != "c-1" {
+		t.Errorf("got request id %q, want c-1", requestID)
+	}
+	if got := md.Headers[HeaderCorrelationID]; got != "c-1" {
+		t.Errorf("got published correlation id %q, want c-1", got)
+	}
+}
+
+func TestHandlerOutsideBus(t *testing.T) {
+	var got *Message
+	h := Handler(func(ctx context.Context, m *Message) {
+		got = m
+		m.Ack()
+		m.Nack(false)
+		Fail(ctx, errors.New("ignored"))
+	})
+	h(context.Background(), []byte("body"))
+	if got == nil || string(got.Body) != "body" || got.Attempt != 1 {
+		t.Errorf("got message %+v, want the body on the first attempt", got)
+	}
+}
+
+func TestWithMetadata(t *testing.T) {
+	ctx := WithMetadata(context.Background(), Metadata{
+		Headers:     map[string]string{"a": "1", "b": "1"},
+		ContentType: "application/json",
+	})
+	ctx = WithMetadata(ctx, Metadata{Headers: map[string]string{"b": "2"}})
+
+	md := MetadataFrom(ctx)
+	if md.Headers["a"] != "1" || md.Headers["b"] != "2" || md.ContentType != "application/json" {
+		t.Errorf("got metadata %+v, want the merged headers and the content type", md)
+	}
+}
@@ -0,0 +1,222 @@
+// Package di wires the components of the service from their constructors, so
+// that Init declares what every component needs instead of building them by
+// hand in the right order:
+//
+//	di.Provide(c, func(ctx context.Context) (*sql.DB, error) {
+//		return store.Open(ctx, cfg.Store)
+//	})
+//	di.Provide(c, func(ctx context.Context) (venues.Repository, error) {
+//		db, err := di.Get[*sql.DB](ctx, c)
+//		if err != nil {
+//			return nil, err
+//		}
+//		return venues.NewSQLRepository(db), nil
+//	})
+//	repo, err := di.Get[venues.Repository](ctx, c)
+//
+// The components are identified by their type, and built once, on first use,
+// thus in the order of their dependencies. Components implementing [io.Closer]
+// are closed by [Container.Close] in the reverse order, i.e. before the
+// components they depend on. Tests replace components with [Override].
+package di
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"sync"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Container holds the constructors and the built components of the service.
+// The zero value is not usable, see [New]. Components may be requested
+// concurrently; they are built one at a time.
+type Container struct {
+	build sync.Mutex // serializes the builds
+
+	mu        sync.Mutex
+	providers map[reflect.Type]*provider
+	built     []*provider // in the order they were built
+}
+
+// provider builds a component.
+type provider struct {
+	typ  reflect.Type
+	ctor func(ctx context.Context) (any, error)
+
+	// owned tells whether the container closes the component,
+	// override whether it replaces the one of the service.
+	owned, override bool
+
+	done  bool
+	value any
+	err   error
+}
+
+// New creates a new, empty [Container].
+func New() *Container {
+	return &Container{providers: make(map[reflect.Type]*provider)}
+}
+
+// Provide registers the constructor of the components of type T, replacing
+// the previous one. The constructor gets the dependencies of the component
+// with [Get], passing on its ctx. Provide has no effect if T is overridden,
+// see [Override].
+func Provide[T any](c *Container, ctor func(ctx context.Context) (T, error)) {
+	typ := typeOf[T]()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.providers[typ]; ok && p.override {
+		return
+	}
+	c.providers[typ] = &provider{
+		typ:   typ,
+		ctor:  func(ctx context.Context) (any, error) { return ctor(ctx) },
+		owned: true,
+	}
+}
+
+// Value registers an already built component of type T, e.g. the
+// configuration. Values are not closed by the container.
+func Value[T any](c *Container, v T) {
+	typ := typeOf[T]()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if p, ok := c.providers[typ]; ok && p.override {
+		return
+	}
+	c.providers[typ] = &provider{typ: typ, ctor: func(context.Context) (any, error) { return v, nil }}
+}
+
+// Override registers the component of type T in place of the one that the
+// service provides, e.g. a fake in tests. Overrides are registered before the
+// service registers its constructors, and are never closed by the container:
+//
+//	s := &ServiceName{Deps: di.New()}
+//	di.Override[venues.Repository](s.Deps, venues.NewMemoryRepository())
+func Override[T any](c *Container, v T) {
+	typ := typeOf[T]()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.providers[typ] = &provider{
+		typ:      typ,
+		ctor:     func(context.Context) (any, error) { return v, nil },
+		override: true,
+	}
+}
+
+// Get returns the component of type T, building it and its dependencies if
+// needed. Constructors call Get with the ctx they were called with. A failed
+// build is not retried. This function returns [service.ErrNotFound] in case
+// no constructor of T, or of one of its dependencies, is registered,
+// [service.ErrUnexpected] in case the dependencies are cyclic, and the errors
+// of the constructors otherwise.
+func Get[T any](ctx context.Context, c *Container) (T, error) {
+	var zero T
+	v, err := c.get(ctx, typeOf[T]())
+	if err != nil {
+		return zero, err
+	}
+	if v == nil { // e.g. a nil interface
+		return zero, nil
+	}
+	return v.(T), nil //nolint:forcetypeassert // built by the constructor of T
+}
+
+// get returns the component of the type, building it if needed.
+func (c *Container) get(ctx context.Context, typ reflect.Type) (any, error) {
+	// The stack of the components being built is carried by the
+	// context of the constructors. Outside of a constructor, the builds
+	// are serialized.
+	stack, nested := ctx.Value(stackKey{}).([]reflect.Type)
+	if !nested {
+		c.build.Lock()
+		defer c.build.Unlock()
+	}
+	for _, t := range stack {
+		if t == typ {
+			return nil, fmt.Errorf("%w: cyclic dependencies: %s",
+				service.ErrUnexpected, path(append(stack, typ)))
+		}
+	}
+
+	c.mu.Lock()
+	p, ok := c.providers[typ]
+	c.mu.Unlock()
+	if !ok {
+		if len(stack) > 0 {
+			return nil, fmt.Errorf("%w: no constructor of %s, needed by %s",
+				service.ErrNotFound, typ, path(stack))
+		}
+		return nil, fmt.Errorf("%w: no constructor of %s", service.ErrNotFound, typ)
+	}
+	if p.done {
+		return p.value, p.err
+	}
+
+	ctx = context.WithValue(ctx, stackKey{}, append(stack[:len(stack):len(stack)], typ))
+	p.value, p.err = p.ctor(ctx)
+	p.done = true
+	if p.err != nil {
+		p.err = fmt.Errorf("build %s: %w", typ, p.err)
+		return nil, p.err
+	}
+	c.mu.Lock()
+	c.built = append(c.built, p)
+	c.mu.Unlock()
+	return p.value, nil
+}
+
+// Close closes the built components that implement [io.Closer], in the
+// reverse order they were built, so that components are closed before their
+// dependencies. Overrides and values are not closed. This function returns
+// [service.ErrUnexpected] for every component that fails to close.
+func (c *Container) Close() error {
+	c.mu.Lock()
+	built := c.built
+	c.built = nil
+	c.mu.Unlock()
+
+	var errs []error
+	for i := len(built) - 1; i >= 0; i-- {
+		p := built[i]
+		closer, ok := p.value.(io.Closer)
+		if !ok || !p.owned || isNil(p.value) {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("%w: close %s: %v", service.ErrUnexpected, p.typ, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// isNil reports whether the component is a nil pointer, e.g. an optional
+// component that is not configured.
+func isNil(v any) bool {
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() { //nolint:exhaustive // only nillable kinds
+	case reflect.Pointer, reflect.Interface, reflect.Map, reflect.Slice, reflect.Func, reflect.Chan:
+		return rv.IsNil()
+	}
+	return false
+}
+
+// typeOf returns the type of T, which may be an interface.
+func typeOf[T any]() reflect.Type { return reflect.TypeOf((*T)(nil)).Elem() }
+
+// path formats a stack of components, e.g. "*sql.DB -> venues.Repository".
+func path(stack []reflect.Type) string {
+	names := make([]string, len(stack))
+	for i, t := range stack {
+		names[i] = t.String()
+	}
+	return strings.Join(names, " -> ")
+}
+
+// stackKey is the context key of the stack of the components being built.
+type stackKey struct{}
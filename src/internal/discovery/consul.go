@@ -0,0 +1,152 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// ConsulConfig encapsulates the configuration for the Consul registry. The
+// variables are the ones of the consul cli.
+type ConsulConfig struct {
+	// Addr is the address of the local consul agent.
+	Addr string `env:"CONSUL_HTTP_ADDR" envDefault:"http://localhost:8500"`
+
+	// Token is the acl token used for the registration, if any.
+	Token string `env:"CONSUL_HTTP_TOKEN"`
+}
+
+// ConsulRegistrar is a [Registrar] backed by the service catalog of a consul
+// agent. The instance is registered with a ttl check, which the worker passes
+// or fails depending on the health of the instance. Consul removes instances
+// whose check was critical for a minute.
+// https://developer.hashicorp.com/consul/api-docs/agent/service
+type ConsulRegistrar struct {
+	client *http.Client
+	cfg    ConsulConfig
+}
+
+var _ Registrar = (*ConsulRegistrar)(nil)
+
+// NewConsulRegistrar creates a new [ConsulRegistrar].
+func NewConsulRegistrar(cfg ConsulConfig) *ConsulRegistrar {
+	if !strings.Contains(cfg.Addr, "://") {
+		cfg.Addr = "http://" + cfg.Addr
+	}
+	cfg.Addr = strings.TrimSuffix(cfg.Addr, "/")
+	return &ConsulRegistrar{client: &http.Client{Timeout: 10 * time.Second}, cfg: cfg}
+}
+
+// Register implements the [Registrar] interface.
+func (c *ConsulRegistrar) Register(ctx context.Context, inst Instance, ttl time.Duration) error {
+	reg := consulService{
+		ID:      inst.ID,
+		Name:    inst.Name,
+		Address: inst.Address,
+		Port:    inst.Port,
+		Tags:    inst.Tags,
+		Meta:    inst.Meta,
+		Check: consulCheck{
+			CheckID:                        checkID(inst),
+			Name:                           "service health",
+			TTL:                            ttl.String(),
+			DeregisterCriticalServiceAfter: deregisterCriticalAfter.String(),
+		},
+	}
+	body, err := json.Marshal(reg)
+	if err != nil {
+		return fmt.Errorf("%w: encode registration: %v", service.ErrUnexpected, err)
+	}
+	return c.put(ctx, "/v1/agent/service/register", body)
+}
+
+// Refresh implements the [Registrar] interface.
+func (c *ConsulRegistrar) Refresh(ctx context.Context, inst Instance, healthy bool) error {
+	status, output := "passing", "all checks pass"
+	if !healthy {
+		status, output = "critical", "health checks failing"
+	}
+	body, err := json.Marshal(map[string]string{"Status": status, "Output": output})
+	if err != nil {
+		return fmt.Errorf("%w: encode check update: %v", service.ErrUnexpected, err)
+	}
+	return c.put(ctx, "/v1/agent/check/update/"+url.PathEscape(checkID(inst)), body)
+}
+
+// Deregister implements the [Registrar] interface.
+func (c *ConsulRegistrar) Deregister(ctx context.Context, inst Instance) error {
+	return c.put(ctx, "/v1/agent/service/deregister/"+url.PathEscape(inst.ID), nil)
+}
+
+// put sends a request to the agent api. Returns [service.ErrNotFound] in case
+// the agent does not know the service or check.
+func (c *ConsulRegistrar) put(ctx context.Context, path string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, c.cfg.Addr+path, bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("%w: create request: %v", service.ErrUnexpected, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if c.cfg.Token != "" {
+		req.Header.Set("X-Consul-Token", c.cfg.Token)
+	}
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", service.ErrConnectionClosed, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // intentional
+
+	switch {
+	case resp.StatusCode == http.StatusOK:
+		return nil
+	case resp.StatusCode == http.StatusNotFound:
+		return fmt.Errorf("%w: consul: %s", service.ErrNotFound, path)
+	// Older agents report unknown checks as internal errors.
+	case resp.StatusCode == http.StatusInternalServerError && strings.Contains(path, "/check/"):
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		if bytes.Contains(msg, []byte("Unknown check")) {
+			return fmt.Errorf("%w: consul: %s", service.ErrNotFound, bytes.TrimSpace(msg))
+		}
+		return fmt.Errorf("%w: consul: %s: %s", service.ErrUnexpected, resp.Status, bytes.TrimSpace(msg))
+	default:
+		return consulError(resp)
+	}
+}
+
+// consulService is the registration of a service with the agent.
+type consulService struct {
+	ID      string            `json:"ID"`
+	Name    string            `json:"Name"`
+	Address string            `json:"Address"`
+	Port    int               `json:"Port"`
+	Tags    []string          `json:"Tags,omitempty"`
+	Meta    map[string]string `json:"Meta,omitempty"`
+	Check   consulCheck       `json:"Check"`
+}
+
+type consulCheck struct {
+	CheckID                        string `json:"CheckID"`
+	Name                           string `json:"Name"`
+	TTL                            string `json:"TTL"`
+	DeregisterCriticalServiceAfter string `json:"DeregisterCriticalServiceAfter"`
+}
+
+func consulError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%w: consul: %s: %s",
+		service.ErrUnexpected, resp.Status, bytes.TrimSpace(msg))
+}
+
+// checkID returns the id of the ttl check of the instance.
+func checkID(inst Instance) string { return "service:" + inst.ID }
+
+// deregisterCriticalAfter is the time after which consul removes an instance
+// whose check is critical, e.g. because the process crashed.
+const deregisterCriticalAfter = time.Minute
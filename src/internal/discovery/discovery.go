@@ -0,0 +1,290 @@
+// Package discovery registers the service with a service registry, e.g. Consul
+// or etcd, so that clients can discover its instances.
+//
+// The registration is managed by a background worker, see [Worker]. The
+// worker registers the instance once the listeners of the service accept
+// connections, keeps the registration alive while the service runs, and
+// deregisters the instance on shutdown. The health of the instance, as
+// reported by the checks of the health package, is propagated to the
+// registry, thus unhealthy instances are not handed out to clients.
+package discovery
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/health"
+	"github.com/eventscompass/service-template/src/internal/workers"
+)
+
+// Config encapsulates the configuration for the service registration.
+type Config struct {
+	// Backend is the service registry, either "consul" or
+	// "etcd". Empty disables the registration.
+	Backend string `env:"DISCOVERY_BACKEND"`
+
+	// Name is the name under which the service is registered.
+	// Instances of the same service must use the same name.
+	Name string `env:"DISCOVERY_SERVICE_NAME"`
+
+	// ID uniquely identifies this instance. Defaults to the name
+	// of the service followed by the hostname, which is the pod
+	// name inside kubernetes.
+	ID string `env:"DISCOVERY_INSTANCE_ID"`
+
+	// Address is the address advertised to clients. Defaults to
+	// the first non-loopback ip address of the host.
+	Address string `env:"DISCOVERY_ADDRESS"`
+
+	// Tags are attached to the registration, e.g. to select
+	// instances by version.
+	Tags []string `env:"DISCOVERY_TAGS"`
+
+	// TTL is the time after which the registry drops an instance
+	// that is not refreshed, e.g. because the process crashed.
+	TTL time.Duration `env:"DISCOVERY_TTL" envDefault:"15s"`
+
+	// Listen and GRPCListen are the listeners of the service,
+	// see [service.RESTConfig] and [service.GRPCConfig]. The
+	// port of the rest listener is registered, the port of the
+	// grpc listener is attached as "grpc_port" metadata.
+	Listen     string `env:"HTTP_SERVER_LISTEN" envDefault:":10080"`
+	GRPCListen string `env:"GRPC_SERVER_LISTEN" envDefault:":10090"`
+
+	Consul ConsulConfig
+	Etcd   EtcdConfig
+}
+
+// Instance is a registered instance of the service.
+type Instance struct {
+	ID      string            `json:"id"`
+	Name    string            `json:"name"`
+	Address string            `json:"address"`
+	Port    int               `json:"port"`
+	Tags    []string          `json:"tags,omitempty"`
+	Meta    map[string]string `json:"meta,omitempty"`
+}
+
+// Registrar registers instances of the service with a registry.
+type Registrar interface {
+	// Register registers the instance. The registration expires
+	// after ttl, unless refreshed.
+	Register(_ context.Context, _ Instance, ttl time.Duration) error
+
+	// Refresh keeps the registration of the instance alive and
+	// reports whether the instance is healthy. Returns
+	// [service.ErrNotFound] in case the registration expired, in
+	// which case the instance is registered again.
+	Refresh(_ context.Context, _ Instance, healthy bool) error
+
+	// Deregister removes the registration of the instance.
+	Deregister(context.Context, Instance) error
+}
+
+// New creates the [Registrar] of the configured backend. Returns nil if the
+// registration is disabled. This function returns [service.ErrBadRequest] in
+// case the backend is unknown or the ttl is not positive.
+func New(cfg Config) (Registrar, error) {
+	if cfg.Backend != "" && cfg.TTL <= 0 {
+		return nil, fmt.Errorf("%w: discovery ttl must be positive", service.ErrBadRequest)
+	}
+	switch cfg.Backend {
+	case "":
+		return nil, nil //nolint:nilnil // the registration is optional
+	case "consul":
+		return NewConsulRegistrar(cfg.Consul), nil
+	case "etcd":
+		return NewEtcdRegistrar(cfg.Etcd), nil
+	default:
+		return nil, fmt.Errorf("%w: unknown discovery backend %q", service.ErrBadRequest, cfg.Backend)
+	}
+}
+
+// NewInstance returns the instance described by the configuration, filling in
+// the defaults. This function returns [service.ErrBadRequest] in case the
+// service name is missing or a listener is malformed.
+func NewInstance(cfg Config) (Instance, error) {
+	if cfg.Name == "" {
+		return Instance{}, fmt.Errorf("%w: discovery service name is required", service.ErrBadRequest)
+	}
+	port, err := listenPort(cfg.Listen)
+	if err != nil {
+		return Instance{}, err
+	}
+	inst := Instance{
+		ID:      cfg.ID,
+		Name:    cfg.Name,
+		Address: cfg.Address,
+		Port:    port,
+		Tags:    cfg.Tags,
+		Meta:    make(map[string]string),
+	}
+	if cfg.GRPCListen != "" {
+		grpcPort, err := listenPort(cfg.GRPCListen)
+		if err != nil {
+			return Instance{}, err
+		}
+		inst.Meta["grpc_port"] = strconv.Itoa(grpcPort)
+	}
+	if inst.ID == "" {
+		host, _ := os.Hostname() //nolint:errcheck // the name suffices
+		inst.ID = cfg.Name + "-" + host
+	}
+	if inst.Address == "" {
+		inst.Address = hostAddress()
+	}
+	return inst, nil
+}
+
+// Worker returns the background worker registering the instance with the
+// registrar. The instance is registered once the listeners of the service
+// accept connections, and deregistered when the worker is stopped. Every third
+// of the ttl the registration is refreshed with the result of the readiness
+// checks of the service, see [health.Of].
+func Worker(cfg Config, r Registrar, inst Instance) workers.Worker {
+	return workers.Worker{
+		Name:    "service-registration",
+		Restart: workers.RestartOnFailure,
+		Run: func(ctx context.Context) error {
+			if err := awaitListeners(ctx, cfg.Listen, cfg.GRPCListen); err != nil {
+				return nil //nolint:nilerr // stopped before the service started
+			}
+
+			registered := false
+			ticker := time.NewTicker(cfg.TTL / 3)
+			defer ticker.Stop()
+			for {
+				if !registered {
+					if err := r.Register(ctx, inst, cfg.TTL); err != nil && ctx.Err() == nil {
+						slog.Warn("failed to register service instance",
+							slog.String("instance", inst.ID),
+							slog.String("error", err.Error()),
+						)
+					} else if err == nil {
+						registered = true
+						slog.Info("registered service instance",
+							slog.String("instance", inst.ID),
+							slog.String("backend", cfg.Backend),
+						)
+					}
+				}
+				if registered {
+					err := r.Refresh(ctx, inst, healthy(ctx))
+					if err != nil && ctx.Err() == nil {
+						slog.Warn("failed to refresh service registration",
+							slog.String("instance", inst.ID),
+							slog.String("error", err.Error()),
+						)
+						registered = false
+					}
+				}
+
+				select {
+				case <-ctx.Done():
+					if !registered {
+						return nil
+					}
+					// Deregister right away, so that clients stop calling
+					// the instance while its servers shut down.
+					//nolint:contextcheck // ctx is already cancelled
+					dctx, cancel := context.WithTimeout(context.Background(), deregisterTimeout)
+					defer cancel()
+					if err := r.Deregister(dctx, inst); err != nil {
+						slog.Warn("failed to deregister service instance",
+							slog.String("instance", inst.ID),
+							slog.String("error", err.Error()),
+						)
+					}
+					return nil
+				case <-ticker.C:
+				}
+			}
+		},
+	}
+}
+
+// healthy reports whether all readiness checks of the service pass.
+func healthy(ctx context.Context) bool {
+	for _, err := range health.Of(ctx).Check(ctx) {
+		if err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// awaitListeners blocks until the given listeners accept connections. The
+// framework binds the listeners after Init, thus the worker cannot be told
+// when they are bound.
+func awaitListeners(ctx context.Context, listens ...string) error {
+	ticker := time.NewTicker(dialInterval)
+	defer ticker.Stop()
+	for _, l := range listens {
+		if l == "" {
+			continue
+		}
+		host, port, _ := net.SplitHostPort(l) //nolint:errcheck // validated by NewInstance
+		if host == "" {
+			host = "localhost"
+		}
+		addr := net.JoinHostPort(host, port)
+		for {
+			var d net.Dialer
+			conn, err := d.DialContext(ctx, "tcp", addr)
+			if err == nil {
+				conn.Close() //nolint:errcheck,gosec // probe only
+				break
+			}
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("await listener: %w", ctx.Err())
+			case <-ticker.C:
+			}
+		}
+	}
+	return nil
+}
+
+// listenPort returns the port of a listen address, e.g. ":10080".
+func listenPort(listen string) (int, error) {
+	_, p, err := net.SplitHostPort(listen)
+	if err != nil {
+		return 0, fmt.Errorf("%w: listen address %q: %v", service.ErrBadRequest, listen, err)
+	}
+	port, err := strconv.Atoi(p)
+	if err != nil {
+		return 0, fmt.Errorf("%w: listen port %q: %v", service.ErrBadRequest, p, err)
+	}
+	return port, nil
+}
+
+// hostAddress returns the first non-loopback ip address of the host, falling
+// back to the hostname.
+func hostAddress() string {
+	addrs, err := net.InterfaceAddrs()
+	if err == nil {
+		for _, a := range addrs {
+			if ip, ok := a.(*net.IPNet); ok && !ip.IP.IsLoopback() && ip.IP.To4() != nil {
+				return ip.IP.String()
+			}
+		}
+	}
+	host, _ := os.Hostname() //nolint:errcheck // best effort
+	return host
+}
+
+const (
+	// dialInterval is the interval at which the listeners are
+	// probed until they accept connections.
+	dialInterval = 500 * time.Millisecond
+
+	// deregisterTimeout bounds the deregistration on shutdown.
+	deregisterTimeout = 5 * time.Second
+)
@@ -0,0 +1,169 @@
+package discovery
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// EtcdConfig encapsulates the configuration for the etcd registry.
+type EtcdConfig struct {
+	// Endpoint is the address of the etcd cluster.
+	Endpoint string `env:"ETCD_ENDPOINT" envDefault:"http://localhost:2379"`
+
+	// Prefix is the key prefix under which the instances are
+	// stored, as <prefix>/<name>/<id>.
+	Prefix string `env:"ETCD_PREFIX" envDefault:"/services"`
+}
+
+// EtcdRegistrar is a [Registrar] backed by etcd, using the json gateway of the
+// v3 api. The instance is stored as json under a key attached to a lease,
+// which the worker keeps alive while the instance is healthy. Unhealthy
+// instances are withdrawn until they recover, and the key of a crashed
+// instance disappears once the lease expires.
+// https://etcd.io/docs/v3.5/dev-guide/api_grpc_gateway/
+type EtcdRegistrar struct {
+	client *http.Client
+	cfg    EtcdConfig
+
+	mu     sync.Mutex
+	leases map[string]string // lease id by instance id
+}
+
+var _ Registrar = (*EtcdRegistrar)(nil)
+
+// NewEtcdRegistrar creates a new [EtcdRegistrar].
+func NewEtcdRegistrar(cfg EtcdConfig) *EtcdRegistrar {
+	if !strings.Contains(cfg.Endpoint, "://") {
+		cfg.Endpoint = "http://" + cfg.Endpoint
+	}
+	cfg.Endpoint = strings.TrimSuffix(cfg.Endpoint, "/")
+	cfg.Prefix = strings.TrimSuffix(cfg.Prefix, "/")
+	return &EtcdRegistrar{
+		client: &http.Client{Timeout: 10 * time.Second},
+		cfg:    cfg,
+		leases: make(map[string]string),
+	}
+}
+
+// Register implements the [Registrar] interface.
+func (e *EtcdRegistrar) Register(ctx context.Context, inst Instance, ttl time.Duration) error {
+	var grant struct {
+		ID string `json:"ID"`
+	}
+	ttlSeconds := int64(math.Ceil(ttl.Seconds()))
+	if err := e.post(ctx, "/v3/lease/grant", map[string]any{"TTL": ttlSeconds}, &grant); err != nil {
+		return err
+	}
+
+	value, err := json.Marshal(inst)
+	if err != nil {
+		return fmt.Errorf("%w: encode instance: %v", service.ErrUnexpected, err)
+	}
+	put := map[string]string{
+		"key":   base64.StdEncoding.EncodeToString([]byte(e.key(inst))),
+		"value": base64.StdEncoding.EncodeToString(value),
+		"lease": grant.ID,
+	}
+	if err := e.post(ctx, "/v3/kv/put", put, nil); err != nil {
+		return err
+	}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.leases[inst.ID] = grant.ID
+	return nil
+}
+
+// Refresh implements the [Registrar] interface. An unhealthy instance is
+// withdrawn by revoking its lease, and registered again once it recovers.
+func (e *EtcdRegistrar) Refresh(ctx context.Context, inst Instance, healthy bool) error {
+	e.mu.Lock()
+	id, ok := e.leases[inst.ID]
+	e.mu.Unlock()
+	switch {
+	case !ok && healthy:
+		return fmt.Errorf("%w: instance %s is not registered", service.ErrNotFound, inst.ID)
+	case !ok:
+		return nil
+	case !healthy:
+		return e.Deregister(ctx, inst)
+	}
+
+	var res struct {
+		Result struct {
+			TTL string `json:"TTL"`
+		} `json:"result"`
+	}
+	if err := e.post(ctx, "/v3/lease/keepalive", map[string]string{"ID": id}, &res); err != nil {
+		return err
+	}
+	if res.Result.TTL == "" || res.Result.TTL == "0" { // the lease expired
+		e.mu.Lock()
+		delete(e.leases, inst.ID)
+		e.mu.Unlock()
+		return fmt.Errorf("%w: lease of instance %s expired", service.ErrNotFound, inst.ID)
+	}
+	return nil
+}
+
+// Deregister implements the [Registrar] interface. Revoking the lease deletes
+// the key of the instance.
+func (e *EtcdRegistrar) Deregister(ctx context.Context, inst Instance) error {
+	e.mu.Lock()
+	id, ok := e.leases[inst.ID]
+	delete(e.leases, inst.ID)
+	e.mu.Unlock()
+	if !ok {
+		return nil
+	}
+	return e.post(ctx, "/v3/lease/revoke", map[string]string{"ID": id}, nil)
+}
+
+// key returns the key under which the instance is stored.
+func (e *EtcdRegistrar) key(inst Instance) string {
+	return e.cfg.Prefix + "/" + inst.Name + "/" + inst.ID
+}
+
+// post sends a request to the json gateway and decodes the response into res,
+// unless nil.
+func (e *EtcdRegistrar) post(ctx context.Context, path string, body, res any) error {
+	b, err := json.Marshal(body)
+	if err != nil {
+		return fmt.Errorf("%w: encode request: %v", service.ErrUnexpected, err)
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.cfg.Endpoint+path,
+		bytes.NewReader(b))
+	if err != nil {
+		return fmt.Errorf("%w: create request: %v", service.ErrUnexpected, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", service.ErrConnectionClosed, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // intentional
+
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%w: etcd: %s: %s",
+			service.ErrUnexpected, resp.Status, bytes.TrimSpace(msg))
+	}
+	if res == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(res); err != nil {
+		return fmt.Errorf("%w: decode etcd response: %v", service.ErrUnexpected, err)
+	}
+	return nil
+}
@@ -0,0 +1,169 @@
+// Package encryption provides field-level encryption for sensitive data (PII)
+// that is stored by the service.
+//
+// Values are encrypted with AES-GCM. The ciphertext carries the id of the key
+// used for encrypting, thus keys can be rotated: new values are encrypted with
+// the primary key, while old values can still be decrypted with any of the
+// configured keys.
+package encryption
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Config encapsulates the configuration of the encryption keys. The keys are
+// secrets and should be provided by the secrets provider of the environment,
+// e.g. as kubernetes secrets mapped to environment variables.
+type Config struct {
+	// Keys is a list of key ids and base64 encoded 32-byte AES
+	// keys, e.g. "2024-01:c2VjcmV0...,2024-06:b3RoZXI...".
+	Keys []string `env:"ENCRYPTION_KEYS,notEmpty"`
+
+	// PrimaryKey is the id of the key used for encrypting new
+	// values.
+	PrimaryKey string `env:"ENCRYPTION_PRIMARY_KEY,notEmpty"`
+}
+
+// Keyring encrypts and decrypts values with a set of keys.
+type Keyring struct {
+	primary string
+	aeads   map[string]cipher.AEAD
+}
+
+// NewKeyring creates a new [Keyring] from the given config. This function
+// returns [service.ErrBadRequest] in case any of the keys is invalid or the
+// primary key is missing.
+func NewKeyring(cfg Config) (*Keyring, error) {
+	k := &Keyring{primary: cfg.PrimaryKey, aeads: make(map[string]cipher.AEAD)}
+	for _, entry := range cfg.Keys {
+		id, encoded, ok := strings.Cut(entry, separator)
+		if !ok || id == "" {
+			return nil, fmt.Errorf("%w: invalid key entry, expected id:key",
+				service.ErrBadRequest)
+		}
+		key, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w: decode key %q: %v", service.ErrBadRequest, id, err)
+		}
+		if len(key) != keySize {
+			return nil, fmt.Errorf("%w: key %q must be %d bytes long",
+				service.ErrBadRequest, id, keySize)
+		}
+		block, err := aes.NewCipher(key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", service.ErrBadRequest, id, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: key %q: %v", service.ErrUnexpected, id, err)
+		}
+		k.aeads[id] = aead
+	}
+	if _, ok := k.aeads[k.primary]; !ok {
+		return nil, fmt.Errorf("%w: primary key %q is not configured",
+			service.ErrBadRequest, k.primary)
+	}
+	return k, nil
+}
+
+// Encrypt encrypts the plaintext with the primary key. The additional data is
+// authenticated but not encrypted, e.g. the id of the row, so that encrypted
+// values cannot be swapped between rows. The same additional data must be
+// provided for decrypting.
+func (k *Keyring) Encrypt(plaintext, additionalData []byte) (string, error) {
+	aead := k.aeads[k.primary]
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return "", fmt.Errorf("%w: generate nonce: %v", service.ErrUnexpected, err)
+	}
+	sealed := aead.Seal(nonce, nonce, plaintext, additionalData)
+	return version + separator + k.primary + separator +
+		base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts a value produced by [Keyring.Encrypt]. This function returns
+// [service.ErrNotFound] in case the value was encrypted with a key that is not
+// configured, and [service.ErrBadRequest] in case the value is malformed or was
+// tampered with.
+func (k *Keyring) Decrypt(ciphertext string, additionalData []byte) ([]byte, error) {
+	id, sealed, err := parse(ciphertext)
+	if err != nil {
+		return nil, err
+	}
+	aead, ok := k.aeads[id]
+	if !ok {
+		return nil, fmt.Errorf("%w: encryption key %q", service.ErrNotFound, id)
+	}
+	if len(sealed) < aead.NonceSize() {
+		return nil, fmt.Errorf("%w: ciphertext too short", service.ErrBadRequest)
+	}
+	nonce, sealed := sealed[:aead.NonceSize()], sealed[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, sealed, additionalData)
+	if err != nil {
+		return nil, fmt.Errorf("%w: decrypt: %v", service.ErrBadRequest, err)
+	}
+	return plaintext, nil
+}
+
+// NeedsRotation reports whether the value was encrypted with a key other than
+// the primary key and should be re-encrypted.
+func (k *Keyring) NeedsRotation(ciphertext string) bool {
+	id, _, err := parse(ciphertext)
+	return err == nil && id != k.primary
+}
+
+// Rotate re-encrypts the value with the primary key. Values that are already
+// encrypted with the primary key are returned unchanged. See [Keyring.Decrypt]
+// for the errors returned by this function.
+func (k *Keyring) Rotate(ciphertext string, additionalData []byte) (string, error) {
+	if !k.NeedsRotation(ciphertext) {
+		if _, _, err := parse(ciphertext); err != nil {
+			return "", err
+		}
+		return ciphertext, nil
+	}
+	plaintext, err := k.Decrypt(ciphertext, additionalData)
+	if err != nil {
+		return "", err
+	}
+	return k.Encrypt(plaintext, additionalData)
+}
+
+// IsEncrypted reports whether the value looks like a value produced by
+// [Keyring.Encrypt].
+func IsEncrypted(value string) bool {
+	_, _, err := parse(value)
+	return err == nil
+}
+
+// parse splits the ciphertext into key id and sealed data.
+func parse(ciphertext string) (string, []byte, error) {
+	parts := strings.SplitN(ciphertext, separator, 3) //nolint:gomnd // version, id, data
+	if len(parts) != 3 || parts[0] != version {
+		return "", nil, fmt.Errorf("%w: unknown ciphertext format", service.ErrBadRequest)
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(parts[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: decode ciphertext: %v", service.ErrBadRequest, err)
+	}
+	return parts[1], sealed, nil
+}
+
+const (
+	// version is the prefix of the ciphertext format.
+	version = "enc1"
+
+	// separator separates the parts of the ciphertext.
+	separator = ":"
+
+	// keySize is the size of the keys, selecting AES-256.
+	keySize = 32
+)
@@ -0,0 +1,144 @@
+package encryption
+
+import (
+	"encoding/base64"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+var (
+	key1 = "k1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", keySize)))
+	key2 = "k2:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("2", keySize)))
+)
+
+func TestNewKeyring(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{"valid", Config{Keys: []string{key1, key2}, PrimaryKey: "k2"}, nil},
+		{"missing primary key", Config{Keys: []string{key1}, PrimaryKey: "k2"}, service.ErrBadRequest},
+		{"missing id", Config{Keys: []string{strings.TrimPrefix(key1, "k1")}, PrimaryKey: ""}, service.ErrBadRequest},
+		{"invalid base64", Config{Keys: []string{"k1:not base64"}, PrimaryKey: "k1"}, service.ErrBadRequest},
+		{"short key", Config{Keys: []string{"k1:" + base64.StdEncoding.EncodeToString([]byte("short"))}, PrimaryKey: "k1"}, service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewKeyring(tt.cfg); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestKeyringDecrypt(t *testing.T) {
+	k := newKeyring(t, "k1", key1, key2)
+	ciphertext, err := k.Encrypt([]byte("alice@example.com"), []byte("row-1"))
+	if err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		keyring    *Keyring
+		ciphertext string
+		ad         string
+		wantErr    error
+	}{
+		{"valid", k, ciphertext, "row-1", nil},
+		{"rotated primary key", newKeyring(t, "k2", key1, key2), ciphertext, "row-1", nil},
+		{"removed key", newKeyring(t, "k2", key2), ciphertext, "row-1", service.ErrNotFound},
+		{"other row", k, ciphertext, "row-2", service.ErrBadRequest},
+		{"tampered", k, tamper(ciphertext), "row-1", service.ErrBadRequest},
+		{"swapped key id", k, strings.Replace(ciphertext, ":k1:", ":k2:", 1), "row-1", service.ErrBadRequest},
+		{"truncated", k, "enc1:k1:AAAA", "row-1", service.ErrBadRequest},
+		{"unknown version", k, strings.Replace(ciphertext, "enc1", "enc9", 1), "row-1", service.ErrBadRequest},
+		{"plaintext", k, "alice@example.com", "row-1", service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.keyring.Decrypt(tt.ciphertext, []byte(tt.ad))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && string(got) != "alice@example.com" {
+				t.Errorf("got %q, want the plaintext", got)
+			}
+		})
+	}
+}
+
+func TestKeyringEncrypt(t *testing.T) {
+	k := newKeyring(t, "k1", key1)
+	a, _ := k.Encrypt([]byte("secret"), nil)
+	b, _ := k.Encrypt([]byte("secret"), nil)
+	if a == b {
+		t.Error("got the same ciphertext twice, want random nonces")
+	}
+	if strings.Contains(a, "secret") || !strings.HasPrefix(a, "enc1:k1:") || !IsEncrypted(a) {
+		t.Errorf("got ciphertext %q, want an enc1 value of k1", a)
+	}
+}
+
+func TestKeyringRotate(t *testing.T) {
+	old := newKeyring(t, "k1", key1, key2)
+	k := newKeyring(t, "k2", key1, key2)
+	stale, _ := old.Encrypt([]byte("secret"), []byte("row-1"))
+	current, _ := k.Encrypt([]byte("secret"), []byte("row-1"))
+
+	tests := []struct {
+		name          string
+		ciphertext    string
+		wantRotation  bool
+		wantUnchanged bool
+		wantErr       error
+	}{
+		{"stale key", stale, true, false, nil},
+		{"primary key", current, false, true, nil},
+		{"malformed", "garbage", false, false, service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if got := k.NeedsRotation(tt.ciphertext); got != tt.wantRotation {
+				t.Errorf("got needs rotation %v, want %v", got, tt.wantRotation)
+			}
+			got, err := k.Rotate(tt.ciphertext, []byte("row-1"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			if (got == tt.ciphertext) != tt.wantUnchanged || k.NeedsRotation(got) {
+				t.Errorf("got ciphertext %q, want it encrypted with the primary key", got)
+			}
+			if plaintext, err := k.Decrypt(got, []byte("row-1")); err != nil || string(plaintext) != "secret" {
+				t.Errorf("got %q, %v after the rotation, want the plaintext", plaintext, err)
+			}
+		})
+	}
+}
+
+func newKeyring(t *testing.T, primary string, keys ...string) *Keyring {
+	t.Helper()
+	k, err := NewKeyring(Config{Keys: keys, PrimaryKey: primary})
+	if err != nil {
+		t.Fatalf("create keyring: %v", err)
+	}
+	return k
+}
+
+// tamper flips a bit of the sealed data of the ciphertext.
+func tamper(ciphertext string) string {
+	i := strings.LastIndex(ciphertext, separator) + 1
+	sealed, _ := base64.RawStdEncoding.DecodeString(ciphertext[i:])
+	sealed[len(sealed)-1] ^= 1
+	return ciphertext[:i] + base64.RawStdEncoding.EncodeToString(sealed)
+}
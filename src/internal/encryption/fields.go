@@ -0,0 +1,92 @@
+package encryption
+
+import (
+	"fmt"
+	"reflect"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// EncryptFields encrypts in place the fields of the struct pointed to by v that
+// are tagged with `encrypt:"true"`. Only string and *string fields can be
+// tagged. Nested and embedded structs are traversed as well. Every tagged
+// field is encrypted, also if its value looks like a ciphertext already,
+// otherwise such a plaintext would be stored as is and fail to decrypt, thus
+// the struct must hold the plaintexts, e.g. as returned by
+// [Keyring.DecryptFields].
+//
+//	type Attendee struct {
+//		ID    string
+//		Email string `encrypt:"true"`
+//	}
+//
+// Call this method before writing the struct to the store, and call
+// [Keyring.DecryptFields] after reading it.
+func (k *Keyring) EncryptFields(v any, additionalData []byte) error {
+	return walk(v, func(s string) (string, error) {
+		return k.Encrypt([]byte(s), additionalData)
+	})
+}
+
+// DecryptFields decrypts in place the tagged fields of the struct pointed to by
+// v. Fields that are not encrypted, e.g. values written before the field was
+// tagged, are left unchanged. See [Keyring.Decrypt] for the errors returned by
+// this function.
+func (k *Keyring) DecryptFields(v any, additionalData []byte) error {
+	return walk(v, func(s string) (string, error) {
+		if !IsEncrypted(s) {
+			return s, nil
+		}
+		b, err := k.Decrypt(s, additionalData)
+		return string(b), err
+	})
+}
+
+// walk applies fn to every tagged string field of the struct pointed to by v.
+func walk(v any, fn func(string) (string, error)) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() || rv.Elem().Kind() != reflect.Struct {
+		return fmt.Errorf("%w: expected a pointer to a struct, got %T",
+			service.ErrUnexpected, v)
+	}
+	return walkStruct(rv.Elem(), fn)
+}
+
+func walkStruct(rv reflect.Value, fn func(string) (string, error)) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		field, value := rt.Field(i), rv.Field(i)
+		if !field.IsExported() {
+			continue
+		}
+
+		if tag := field.Tag.Get(tagName); tag == "" || tag == "-" || tag == "false" {
+			if value.Kind() == reflect.Struct {
+				if err := walkStruct(value, fn); err != nil {
+					return err
+				}
+			}
+			continue
+		}
+
+		if value.Kind() == reflect.Pointer && value.Type().Elem().Kind() == reflect.String {
+			if value.IsNil() {
+				continue
+			}
+			value = value.Elem()
+		}
+		if value.Kind() != reflect.String {
+			return fmt.Errorf("%w: field %s of type %s cannot be encrypted",
+				service.ErrUnexpected, field.Name, field.Type)
+		}
+		res, err := fn(value.String())
+		if err != nil {
+			return fmt.Errorf("field %s: %w", field.Name, err)
+		}
+		value.SetString(res)
+	}
+	return nil
+}
+
+// tagName is the struct tag marking the fields that have to be encrypted.
+const tagName = "encrypt"
@@ -0,0 +1,128 @@
+package encryption
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+type address struct {
+	Street string `encrypt:"true"`
+	City   string
+}
+
+type attendee struct {
+	ID      string
+	Email   string  `encrypt:"true"`
+	Phone   *string `encrypt:"true"`
+	Notes   *string `encrypt:"true"`
+	Skipped string  `encrypt:"false"`
+	Address address
+	address
+}
+
+func TestEncryptFields(t *testing.T) {
+	k := newKeyring(t, "k1", key1)
+	phone := "+100"
+	a := attendee{
+		ID:      "a-1",
+		Email:   "alice@example.com",
+		Phone:   &phone,
+		Skipped: "plain",
+		Address: address{Street: "Main St 1", City: "Springfield"},
+		address: address{Street: "unexported"},
+	}
+	if err := k.EncryptFields(&a, []byte(a.ID)); err != nil {
+		t.Fatalf("encrypt fields: %v", err)
+	}
+	for name, v := range map[string]string{"Email": a.Email, "Phone": *a.Phone, "Address.Street": a.Address.Street} {
+		if !IsEncrypted(v) {
+			t.Errorf("got %s %q, want it encrypted", name, v)
+		}
+	}
+	if a.ID != "a-1" || a.Skipped != "plain" || a.Address.City != "Springfield" || a.address.Street != "unexported" || a.Notes != nil {
+		t.Errorf("got untagged fields changed: %+v", a)
+	}
+
+	if err := k.DecryptFields(&a, []byte(a.ID)); err != nil {
+		t.Fatalf("decrypt fields: %v", err)
+	}
+	if a.Email != "alice@example.com" || *a.Phone != "+100" || a.Address.Street != "Main St 1" {
+		t.Errorf("got %+v after decrypting, want the plaintexts", a)
+	}
+}
+
+func TestEncryptFieldsLookalike(t *testing.T) {
+	// A plaintext shaped like a ciphertext, e.g. written by a client, is
+	// encrypted like any other value and decrypted back as is.
+	k := newKeyring(t, "k1", key1)
+	other, _ := k.Encrypt([]byte("mallory@example.com"), []byte("a-2"))
+	for _, email := range []string{other, "enc1:k1:AAAA"} {
+		a := attendee{ID: "a-1", Email: email}
+		if err := k.EncryptFields(&a, []byte(a.ID)); err != nil {
+			t.Fatalf("encrypt fields: %v", err)
+		}
+		if a.Email == email {
+			t.Errorf("got email %q stored as is, want it encrypted", email)
+		}
+		if err := k.DecryptFields(&a, []byte(a.ID)); err != nil {
+			t.Fatalf("decrypt fields: %v", err)
+		}
+		if a.Email != email {
+			t.Errorf("got email %q after decrypting, want %q", a.Email, email)
+		}
+	}
+}
+
+func TestDecryptFields(t *testing.T) {
+	k := newKeyring(t, "k1", key1)
+	encrypted, _ := k.Encrypt([]byte("alice@example.com"), []byte("a-1"))
+	tests := []struct {
+		name      string
+		email     string
+		ad        string
+		wantEmail string
+		wantErr   error
+	}{
+		{"encrypted", encrypted, "a-1", "alice@example.com", nil},
+		{"written before the tag", "alice@example.com", "a-1", "alice@example.com", nil},
+		{"moved from another row", encrypted, "a-2", "", service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			a := attendee{Email: tt.email}
+			err := k.DecryptFields(&a, []byte(tt.ad))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && a.Email != tt.wantEmail {
+				t.Errorf("got email %q, want %q", a.Email, tt.wantEmail)
+			}
+		})
+	}
+}
+
+func TestWalkInvalid(t *testing.T) {
+	k := newKeyring(t, "k1", key1)
+	tests := []struct {
+		name string
+		v    any
+	}{
+		{"not a pointer", attendee{}},
+		{"nil pointer", (*attendee)(nil)},
+		{"not a struct", new(string)},
+		{"tagged int", &struct {
+			N int `encrypt:"true"`
+		}{}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if err := k.EncryptFields(tt.v, nil); !errors.Is(err, service.ErrUnexpected) {
+				t.Errorf("got error %v, want %v", err, service.ErrUnexpected)
+			}
+		})
+	}
+}
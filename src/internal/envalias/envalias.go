@@ -0,0 +1,103 @@
+// Package envalias keeps deprecated names of environment variables working, so
+// that variables can be renamed without breaking the deployed services at
+// once. The deprecated names of a field are listed in its envDeprecated tag,
+// next to the env tag of the new name:
+//
+//	Port int `env:"MESSAGE_BUS_SERVER_PORT" envDeprecated:"MESSAGE_BUS_PORT"`
+//
+// [Environ] resolves the environment before it is parsed: a variable set only
+// under a deprecated name is copied to the new name, and reported, so that
+// the service warns about it, see [Log]. The new name wins if both are set.
+// The deprecated names are prefixed like the new name, i.e. by the envPrefix
+// tags of the enclosing fields and by the prefix of the parse.
+package envalias
+
+import (
+	"log/slog"
+	"os"
+	"reflect"
+	"strings"
+)
+
+// Use is a variable that was set under a deprecated name.
+type Use struct {
+	// Deprecated is the name the variable was set under, and
+	// Replacement its new name.
+	Deprecated, Replacement string
+
+	// Ignored tells that the variable was also set under its new name,
+	// thus the deprecated one was ignored.
+	Ignored bool
+}
+
+// Environ returns the environment of the process for parsing v, a pointer to a
+// configuration struct, with the prefix. The values of the deprecated names
+// of its fields are copied to the new names, and the uses of deprecated names
+// are returned in the order of the fields.
+func Environ(v any, prefix string) (map[string]string, []Use) {
+	environ := make(map[string]string)
+	for _, kv := range os.Environ() {
+		if k, val, ok := strings.Cut(kv, "="); ok {
+			environ[k] = val
+		}
+	}
+	var uses []Use
+	walk(reflect.TypeOf(v), prefix, func(name string, deprecated []string) {
+		for _, old := range deprecated {
+			val, ok := environ[old]
+			if !ok {
+				continue
+			}
+			_, set := environ[name]
+			uses = append(uses, Use{Deprecated: old, Replacement: name, Ignored: set})
+			if !set {
+				environ[name] = val
+			}
+		}
+	})
+	return environ, uses
+}
+
+// Log warns about the uses of deprecated names.
+func Log(uses []Use) {
+	for _, u := range uses {
+		msg := "environment variable is deprecated"
+		if u.Ignored {
+			msg = "environment variable is deprecated and ignored, as its replacement is set"
+		}
+		slog.Warn(msg,
+			slog.String("name", u.Deprecated),
+			slog.String("replacement", u.Replacement),
+		)
+	}
+}
+
+// walk calls fn with the prefixed names of the fields of the struct type t
+// that have deprecated names, descending into the nested structs like
+// env.Parse does.
+func walk(t reflect.Type, prefix string, fn func(name string, deprecated []string)) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return
+	}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("env"), ",")
+		if name != "" {
+			if tag := f.Tag.Get("envDeprecated"); tag != "" {
+				old := strings.Split(tag, ",")
+				for j := range old {
+					old[j] = prefix + strings.TrimSpace(old[j])
+				}
+				fn(prefix+name, old)
+			}
+			continue
+		}
+		walk(f.Type, prefix+f.Tag.Get("envPrefix"), fn)
+	}
+}
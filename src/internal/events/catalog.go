@@ -0,0 +1,30 @@
+package events
+
+import (
+	eventsv1 "github.com/eventscompass/service-template/pkg/events/v1"
+	"github.com/eventscompass/service-template/src/internal/codec"
+)
+
+// The events of the service. Replace them with the events of the service, and
+// keep the topics and versions in pkg/events.
+var (
+	// ExampleCreated is published when an example is created.
+	ExampleCreated = Define[*eventsv1.ExampleCreated](
+		"", eventsv1.TopicExamples, eventsv1.ExampleCreatedVersion, codec.Proto,
+	)
+
+	// VenueCreated is published when a venue is created.
+	VenueCreated = Define[*eventsv1.VenueCreated](
+		"", eventsv1.TopicVenues, eventsv1.VenueCreatedVersion, codec.Proto,
+	)
+
+	// VenueUpdated is published when a venue is updated.
+	VenueUpdated = Define[*eventsv1.VenueUpdated](
+		"", eventsv1.TopicVenues, eventsv1.VenueUpdatedVersion, codec.Proto,
+	)
+
+	// VenueDeleted is published when a venue is deleted.
+	VenueDeleted = Define[*eventsv1.VenueDeleted](
+		"", eventsv1.TopicVenues, eventsv1.VenueDeletedVersion, codec.Proto,
+	)
+)
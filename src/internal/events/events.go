@@ -0,0 +1,288 @@
+// Package events is the catalog of the events of the service: every event has
+// a typed definition naming its topic, type and schema version, which
+// producers and consumers share instead of repeating topic names and codecs:
+//
+//	err := events.ExampleCreated.Publish(ctx, bus, &eventsv1.ExampleCreated{...}, nil)
+//
+//	func (s *ServiceName) Events() map[string]service.EventHandler {
+//		return events.Handlers(
+//			events.ExampleCreated.Handler(s.onExampleCreated),
+//		)
+//	}
+//
+// Events are published in envelopes, see [codec.PublishEnvelope]. Consumers
+// upgrade events of older schema versions with the upcasters of the
+// definition before decoding them, see [Event.Upcaster], thus producers and
+// consumers can be deployed independently while the schema evolves. The
+// schemas and topic constants live in pkg/events, so that other services can
+// import them.
+package events
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sort"
+	"sync"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/eventscompass/service-template/src/internal/codec"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Upcaster upgrades the encoded data of an event by one schema version.
+type Upcaster func(c codec.Codec, data []byte) ([]byte, error)
+
+// Upcast returns an [Upcaster] decoding the data as Old, converting it with fn,
+// and encoding the result, which is the next version of the event.
+func Upcast[Old, New any](fn func(Old) (New, error)) Upcaster {
+	return func(c codec.Codec, data []byte) ([]byte, error) {
+		var old Old
+		if err := c.Unmarshal(data, &old); err != nil {
+			return nil, err //nolint:wrapcheck // wrapped by the caller
+		}
+		updated, err := fn(old)
+		if err != nil {
+			return nil, err
+		}
+		return c.Marshal(updated) //nolint:wrapcheck // wrapped by the caller
+	}
+}
+
+// Event is the definition of an event of type T.
+type Event[T any] struct {
+	// Type is the name of the event, e.g. the full name of its
+	// proto message.
+	Type string
+
+	// Topic is the topic of the event.
+	Topic string
+
+	// Version is the current schema version of the event.
+	Version uint32
+
+	codec     codec.Codec
+	upcasters map[uint32]Upcaster // by the version they upgrade from
+}
+
+// Define defines an event of the given type, published on the topic with the
+// current schema version and encoded with the codec. An empty type defaults to
+// the full name of T if it is a proto message, or to the name of T otherwise;
+// name the type explicitly if the go type changes between versions. The
+// definition is added to the catalog, see [All].
+func Define[T any](typ, topic string, version uint32, c codec.Codec) *Event[T] {
+	if typ == "" {
+		var zero T
+		typ = fmt.Sprintf("%T", zero)
+		if m, ok := any(zero).(proto.Message); ok {
+			typ = string(m.ProtoReflect().Descriptor().FullName())
+		}
+	}
+	e := &Event[T]{
+		Type:      typ,
+		Topic:     topic,
+		Version:   version,
+		codec:     c,
+		upcasters: make(map[uint32]Upcaster),
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	catalog = append(catalog, Descriptor{
+		Type:        typ,
+		Topic:       topic,
+		Version:     version,
+		ContentType: c.ContentType(),
+	})
+	return e
+}
+
+// Upcaster registers the upcaster upgrading events of the given version to
+// the next one. Events of version 1 are upgraded to the current version by
+// the chain of upcasters from versions 1, 2 and so on. Upcaster must be called
+// while defining the event, it returns the event for chaining.
+func (e *Event[T]) Upcaster(from uint32, u Upcaster) *Event[T] {
+	e.upcasters[from] = u
+	return e
+}
+
+// Publish publishes the event in an envelope with the type and the current
+// version of the definition. The headers carry context with the event, e.g. the
+// tenant. This function returns [service.ErrBadRequest] in case the event
+// cannot be encoded, and the errors of the bus otherwise.
+func (e *Event[T]) Publish(
+	ctx context.Context,
+	bus service.MessageBus,
+	event T,
+	headers map[string]string,
+) error {
+	meta := codec.Meta{Type: e.Type, Version: e.Version, Headers: headers}
+	return codec.PublishEnvelope(ctx, bus, e.codec, e.Topic, meta, event)
+}
+
+// Encode encodes the event with the codec of the definition, returning the
+// metadata that the event has to be published with, e.g. by services
+// persisting their events before publishing them. This function returns
+// [service.ErrBadRequest] in case the event cannot be encoded.
+func (e *Event[T]) Encode(event T, headers map[string]string) (codec.Meta, []byte, error) {
+	data, err := e.codec.Marshal(event)
+	if err != nil {
+		return codec.Meta{}, nil, fmt.Errorf("encode %s: %w", e.Type, err)
+	}
+	meta := codec.Meta{
+		ContentType: e.codec.ContentType(),
+		Type:        e.Type,
+		Version:     e.Version,
+		Headers:     headers,
+	}
+	return meta, data, nil
+}
+
+// Decode upgrades an event encoded with [Event.Encode] to the current version
+// and decodes it, e.g. when replaying persisted events. This function returns
+// [service.ErrBadRequest] in case the event is not of the type of the
+// definition or cannot be decoded, and [service.ErrNotFound] in case its codec
+// is not registered.
+func (e *Event[T]) Decode(meta codec.Meta, data []byte) (T, error) {
+	var event T
+	c, err := codec.Lookup(meta.ContentType)
+	if err != nil {
+		return event, err //nolint:wrapcheck // names the content type
+	}
+	if data, err = e.upgrade(meta, c, data); err != nil {
+		return event, err
+	}
+	if err := c.Unmarshal(data, &event); err != nil {
+		return event, fmt.Errorf("decode %s: %w", e.Type, err)
+	}
+	return event, nil
+}
+
+// Handler returns the handler of the events of the topic, see [Handlers]. The
+// events are upgraded to the current version before they are decoded. Events
+// of other types or newer versions are logged and dropped, and events that
+// cannot be decoded fail, see [codec.TypedHandler].
+func (e *Event[T]) Handler(h func(context.Context, codec.Meta, T)) Subscription {
+	return Subscription{Topic: e.Topic, Type: e.Type, Handler: func(ctx context.Context, msg []byte) {
+		meta, c, data, err := codec.OpenEnvelope(msg)
+		if err == nil {
+			data, err = e.upgrade(meta, c, data)
+		}
+		if err != nil {
+			droppedEvents.Inc(e.Type)
+			slog.ErrorContext(ctx, "dropping event",
+				slog.String("topic", e.Topic),
+				slog.String("type", meta.Type),
+				slog.Uint64("version", uint64(meta.Version)),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		meta.Version = e.Version
+		codec.Handler(c, func(ctx context.Context, event T) { h(ctx, meta, event) })(ctx, data)
+	}}
+}
+
+// upgrade upgrades the data of an event to the current version. This function
+// returns [service.ErrBadRequest] in case the event is not of the type of the
+// definition, or cannot be upgraded.
+func (e *Event[T]) upgrade(meta codec.Meta, c codec.Codec, data []byte) ([]byte, error) {
+	if meta.Type != e.Type {
+		return nil, fmt.Errorf("%w: event of type %s, want %s", service.ErrBadRequest, meta.Type, e.Type)
+	}
+	if meta.Version > e.Version {
+		return nil, fmt.Errorf("%w: event version %d is newer than %d",
+			service.ErrBadRequest, meta.Version, e.Version)
+	}
+	version := max(meta.Version, 1) // envelopes without version carry the first one
+	for ; version < e.Version; version++ {
+		u, ok := e.upcasters[version]
+		if !ok {
+			return nil, fmt.Errorf("%w: no upcaster from version %d", service.ErrBadRequest, version)
+		}
+		var err error
+		if data, err = u(c, data); err != nil {
+			return nil, fmt.Errorf("%w: upcast from version %d: %v", service.ErrBadRequest, version, err)
+		}
+	}
+	return data, nil
+}
+
+// Subscription is the handler of the events of a topic.
+type Subscription struct {
+	Topic   string
+	Type    string
+	Handler service.EventHandler
+}
+
+// Handlers returns the event handlers of the subscriptions by topic, as
+// returned by the Events method of the service. Several events published on
+// the same topic are dispatched by their type.
+func Handlers(subs ...Subscription) map[string]service.EventHandler {
+	byTopic := make(map[string][]Subscription)
+	for _, s := range subs {
+		byTopic[s.Topic] = append(byTopic[s.Topic], s)
+	}
+	res := make(map[string]service.EventHandler, len(byTopic))
+	for topic, subs := range byTopic {
+		if len(subs) == 1 {
+			res[topic] = subs[0].Handler
+			continue
+		}
+		res[topic] = dispatch(subs)
+	}
+	return res
+}
+
+// dispatch returns a handler passing every event to the subscriptions of its
+// type. Events of other types are dropped.
+func dispatch(subs []Subscription) service.EventHandler {
+	return func(ctx context.Context, msg []byte) {
+		meta, _, _, err := codec.OpenEnvelope(msg)
+		for _, s := range subs {
+			if err != nil || s.Type == meta.Type {
+				s.Handler(ctx, msg)
+				return
+			}
+		}
+		droppedEvents.Inc(meta.Type)
+		slog.WarnContext(ctx, "dropping event of unknown type", slog.String("type", meta.Type))
+	}
+}
+
+// Descriptor describes an event of the catalog.
+type Descriptor struct {
+	Type        string `json:"type"`
+	Topic       string `json:"topic"`
+	Version     uint32 `json:"version"`
+	ContentType string `json:"content_type"`
+}
+
+// All returns the descriptors of all defined events, sorted by topic and type,
+// e.g. for documenting the events of the service.
+func All() []Descriptor {
+	mu.Lock()
+	defer mu.Unlock()
+	res := append([]Descriptor(nil), catalog...)
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Topic != res[j].Topic {
+			return res[i].Topic < res[j].Topic
+		}
+		return res[i].Type < res[j].Type
+	})
+	return res
+}
+
+var (
+	mu      sync.Mutex
+	catalog []Descriptor
+
+	// droppedEvents counts the events that could not be handled.
+	droppedEvents = metrics.NewCounter(
+		"events_dropped_total",
+		"Number of received events that were dropped because they could not be decoded or upgraded.",
+		"type",
+	)
+)
@@ -0,0 +1,272 @@
+// Package eventstore persists the events of event-sourced aggregates. The
+// events of an aggregate form a stream, which is only ever appended to; the
+// state of the aggregate is rebuilt by replaying its stream, starting from the
+// latest snapshot:
+//
+//	var v venue
+//	version, err := eventstore.Load(ctx, s, "venue-"+id, v.restore, v.apply)
+//	...
+//	e, err := eventstore.New(events.VenueRenamed, &eventsv1.VenueRenamed{...}, nil)
+//	...
+//	_, err = s.Append(ctx, "venue-"+id, version, e)
+//
+// Appends are optimistically concurrent: they fail with [ErrConflict] if the
+// stream was appended to since it was loaded, in which case the command is
+// retried with the fresh state.
+//
+// The persisted events are published to the message bus by a [Publisher],
+// which follows the store in the order of the events. Consumers receive them
+// in the envelopes of [codec.PublishEnvelope], thus they are handled like any
+// other event of the catalog, see package events.
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/codec"
+	"github.com/eventscompass/service-template/src/internal/events"
+)
+
+// The expected versions of [Store.Append] that are not a version of the
+// stream.
+const (
+	// Any appends regardless of the version of the stream.
+	Any int64 = -1
+
+	// NoStream appends only if the stream has no events yet.
+	NoStream int64 = 0
+)
+
+// ErrConflict is returned when appending to a stream whose version is not the
+// expected one, because it was appended to concurrently.
+var ErrConflict = errors.New("stream was appended to concurrently")
+
+// Event is a persisted event.
+type Event struct {
+	// Stream is the stream of the event, e.g. "venue-42".
+	Stream string
+
+	// Version is the position of the event in its stream, starting
+	// at 1. Set by [Store.Append].
+	Version int64
+
+	// Position is the position of the event in the store, which
+	// orders the events of all streams. Set by [Store.Append].
+	Position int64
+
+	// Topic is the topic that the event is published on.
+	Topic string
+
+	// Type is the name of the event, e.g. the full name of its
+	// proto message.
+	Type string
+
+	// SchemaVersion is the schema version of the event.
+	SchemaVersion uint32
+
+	// ContentType is the media type with which the event was
+	// encoded.
+	ContentType string
+
+	// Data is the encoded event.
+	Data []byte
+
+	// Headers carry context with the event, e.g. the tenant.
+	Headers map[string]string
+
+	// RecordedAt is the time the event was appended. Set by
+	// [Store.Append].
+	RecordedAt time.Time
+}
+
+// New encodes the event as defined by the catalog, ready to be appended. This
+// function returns [service.ErrBadRequest] in case the event cannot be
+// encoded.
+func New[T any](def *events.Event[T], event T, headers map[string]string) (Event, error) {
+	meta, data, err := def.Encode(event, headers)
+	if err != nil {
+		return Event{}, err //nolint:wrapcheck // names the event
+	}
+	return Event{
+		Topic:         def.Topic,
+		Type:          meta.Type,
+		SchemaVersion: meta.Version,
+		ContentType:   meta.ContentType,
+		Data:          data,
+		Headers:       headers,
+	}, nil
+}
+
+// Meta returns the metadata of the event, e.g. for decoding it with
+// [events.Event.Decode]. The headers also carry the stream, the version, the
+// position and the time of the event, see [StreamHeader].
+func (e Event) Meta() codec.Meta {
+	headers := make(map[string]string, len(e.Headers)+4) //nolint:gomnd // the store headers
+	for k, v := range e.Headers {
+		headers[k] = v
+	}
+	headers[StreamHeader] = e.Stream
+	headers[VersionHeader] = strconv.FormatInt(e.Version, 10)
+	headers[PositionHeader] = strconv.FormatInt(e.Position, 10)
+	headers[RecordedAtHeader] = e.RecordedAt.UTC().Format(time.RFC3339Nano)
+	return codec.Meta{
+		ContentType: e.ContentType,
+		Type:        e.Type,
+		Version:     e.SchemaVersion,
+		Headers:     headers,
+	}
+}
+
+// Received returns the event published with the metadata by a [Publisher],
+// e.g. for consumers that handle persisted and received events alike. The
+// stream, the version, the position and the time are taken from the headers;
+// they are zero for events that were not published from a store.
+func Received(topic string, meta codec.Meta, data []byte) Event {
+	e := Event{
+		Topic:         topic,
+		Type:          meta.Type,
+		SchemaVersion: meta.Version,
+		ContentType:   meta.ContentType,
+		Data:          data,
+	}
+	for k, v := range meta.Headers {
+		switch k {
+		case StreamHeader:
+			e.Stream = v
+		case VersionHeader:
+			e.Version, _ = strconv.ParseInt(v, 10, 64)
+		case PositionHeader:
+			e.Position, _ = strconv.ParseInt(v, 10, 64)
+		case RecordedAtHeader:
+			e.RecordedAt, _ = time.Parse(time.RFC3339Nano, v)
+		default:
+			if e.Headers == nil {
+				e.Headers = make(map[string]string, len(meta.Headers))
+			}
+			e.Headers[k] = v
+		}
+	}
+	return e
+}
+
+// The headers of the published events locating them in the store, e.g. for
+// consumers that deduplicate events or track their position.
+const (
+	StreamHeader     = "eventstore-stream"
+	VersionHeader    = "eventstore-version"
+	PositionHeader   = "eventstore-position"
+	RecordedAtHeader = "eventstore-recorded-at"
+)
+
+// Snapshot is the state of an aggregate at a version of its stream, which
+// saves replaying the events up to that version.
+type Snapshot struct {
+	Stream  string
+	Version int64
+
+	// Data is the encoded state of the aggregate.
+	Data []byte
+
+	TakenAt time.Time
+}
+
+// Store is an append-only store of event streams.
+type Store interface {
+	// Append appends the events to the stream if the stream is at
+	// the expected version, which is [NoStream] for new streams
+	// and [Any] to skip the check. The events are appended
+	// atomically and returned with their versions and positions.
+	// This function returns [ErrConflict] in case the stream is
+	// not at the expected version.
+	Append(_ context.Context, stream string, expected int64, events ...Event) ([]Event, error)
+
+	// Read returns the events of the stream from the given
+	// version on, in order. Reading a stream without events
+	// returns no events.
+	Read(_ context.Context, stream string, from int64) ([]Event, error)
+
+	// ReadAll returns up to limit events of all streams after the
+	// given position, in order.
+	ReadAll(_ context.Context, after int64, limit int) ([]Event, error)
+
+	// Head returns the position of the last event of the store,
+	// which is 0 if the store has no events.
+	Head(_ context.Context) (int64, error)
+
+	// SaveSnapshot saves the snapshot of the stream, replacing the
+	// older snapshots.
+	SaveSnapshot(_ context.Context, s Snapshot) error
+
+	// LoadSnapshot returns the latest snapshot of the stream. This
+	// function returns [service.ErrNotFound] in case the stream
+	// has no snapshot.
+	LoadSnapshot(_ context.Context, stream string) (Snapshot, error)
+}
+
+// Checkpoints persist the positions up to which the followers of a [Store]
+// have processed its events, e.g. the [Publisher].
+type Checkpoints interface {
+	// Checkpoint returns the position of the follower with the
+	// name, which is 0 if the follower never saved one.
+	Checkpoint(_ context.Context, name string) (int64, error)
+
+	// SaveCheckpoint saves the position of the follower.
+	SaveCheckpoint(_ context.Context, name string, position int64) error
+}
+
+// Load rebuilds the state of an aggregate from its stream: restore restores
+// the state from the latest snapshot, if the stream has one, and apply applies
+// the later events in order. Pass a nil restore for aggregates without
+// snapshots. Load returns the version of the stream, which is the expected
+// version for appending the events of the next command. This function returns
+// the errors of restore and apply as is.
+func Load(
+	ctx context.Context,
+	s Store,
+	stream string,
+	restore func(Snapshot) error,
+	apply func(Event) error,
+) (int64, error) {
+	var version int64
+	if restore != nil {
+		snap, err := s.LoadSnapshot(ctx, stream)
+		switch {
+		case errors.Is(err, service.ErrNotFound):
+		case err != nil:
+			return 0, err //nolint:wrapcheck // errors of the store
+		default:
+			if err := restore(snap); err != nil {
+				return 0, err
+			}
+			version = snap.Version
+		}
+	}
+
+	evs, err := s.Read(ctx, stream, version+1)
+	if err != nil {
+		return 0, err //nolint:wrapcheck // errors of the store
+	}
+	for _, e := range evs {
+		if err := apply(e); err != nil {
+			return 0, err
+		}
+		version = e.Version
+	}
+	return version, nil
+}
+
+// checkVersion returns [ErrConflict] in case the current version of the stream
+// is not the expected one.
+func checkVersion(stream string, current, expected int64) error {
+	if expected != Any && current != expected {
+		return fmt.Errorf("%w: stream %s is at version %d, want %d",
+			ErrConflict, stream, current, expected)
+	}
+	return nil
+}
@@ -0,0 +1,145 @@
+package eventstore
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// MemoryStore is a [Store] kept in memory, which also keeps the
+// [Checkpoints]. It is useful for tests and for running a single replica
+// locally. The events are lost on restart.
+type MemoryStore struct {
+	mu          sync.Mutex
+	events      []Event // by position
+	streams     map[string][]int
+	snapshots   map[string]Snapshot
+	checkpoints map[string]int64
+}
+
+var (
+	_ Store       = (*MemoryStore)(nil)
+	_ Checkpoints = (*MemoryStore)(nil)
+)
+
+// NewMemoryStore creates a new [MemoryStore].
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		streams:     make(map[string][]int),
+		snapshots:   make(map[string]Snapshot),
+		checkpoints: make(map[string]int64),
+	}
+}
+
+// Append implements the [Store] interface.
+func (s *MemoryStore) Append(
+	_ context.Context,
+	stream string,
+	expected int64,
+	evs ...Event,
+) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	current := int64(len(s.streams[stream]))
+	if err := checkVersion(stream, current, expected); err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC()
+	res := make([]Event, len(evs))
+	for i, e := range evs {
+		e.Stream, e.Version, e.RecordedAt = stream, current+int64(i)+1, now
+		e.Position = int64(len(s.events)) + 1
+		s.streams[stream] = append(s.streams[stream], len(s.events))
+		s.events = append(s.events, clone(e))
+		res[i] = e
+	}
+	return res, nil
+}
+
+// Read implements the [Store] interface.
+func (s *MemoryStore) Read(_ context.Context, stream string, from int64) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	idx := s.streams[stream]
+	from = min(max(from, 1), int64(len(idx))+1)
+	res := make([]Event, 0, int64(len(idx))-from+1)
+	for _, i := range idx[from-1:] {
+		res = append(res, clone(s.events[i]))
+	}
+	return res, nil
+}
+
+// ReadAll implements the [Store] interface.
+func (s *MemoryStore) ReadAll(_ context.Context, after int64, limit int) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	after = min(max(after, 0), int64(len(s.events)))
+	end := min(after+int64(limit), int64(len(s.events)))
+	res := make([]Event, 0, end-after)
+	for _, e := range s.events[after:end] {
+		res = append(res, clone(e))
+	}
+	return res, nil
+}
+
+// Head implements the [Store] interface.
+func (s *MemoryStore) Head(_ context.Context) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.events)), nil
+}
+
+// SaveSnapshot implements the [Store] interface.
+func (s *MemoryStore) SaveSnapshot(_ context.Context, snap Snapshot) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if old, ok := s.snapshots[snap.Stream]; !ok || old.Version < snap.Version {
+		snap.Data = append([]byte(nil), snap.Data...)
+		s.snapshots[snap.Stream] = snap
+	}
+	return nil
+}
+
+// LoadSnapshot implements the [Store] interface.
+func (s *MemoryStore) LoadSnapshot(_ context.Context, stream string) (Snapshot, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	snap, ok := s.snapshots[stream]
+	if !ok {
+		return Snapshot{}, fmt.Errorf("%w: snapshot of %s", service.ErrNotFound, stream)
+	}
+	snap.Data = append([]byte(nil), snap.Data...)
+	return snap, nil
+}
+
+// Checkpoint implements the [Checkpoints] interface.
+func (s *MemoryStore) Checkpoint(_ context.Context, name string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.checkpoints[name], nil
+}
+
+// SaveCheckpoint implements the [Checkpoints] interface.
+func (s *MemoryStore) SaveCheckpoint(_ context.Context, name string, position int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.checkpoints[name] = position
+	return nil
+}
+
+// clone returns a copy of the event that does not share its data and headers.
+func clone(e Event) Event {
+	e.Data = append([]byte(nil), e.Data...)
+	if e.Headers != nil {
+		headers := make(map[string]string, len(e.Headers))
+		for k, v := range e.Headers {
+			headers[k] = v
+		}
+		e.Headers = headers
+	}
+	return e
+}
@@ -0,0 +1,148 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestMemoryStoreAppend(t *testing.T) {
+	tests := []struct {
+		name string
+		// existing is the number of events of the stream before the
+		// append.
+		existing     int
+		expected     int64
+		wantErr      error
+		wantVersions []int64
+	}{
+		{"new stream", 0, NoStream, nil, []int64{1, 2}},
+		{"new stream exists", 1, NoStream, ErrConflict, nil},
+		{"expected version", 2, 2, nil, []int64{3, 4}},
+		{"stale version", 3, 2, ErrConflict, nil},
+		{"version ahead", 1, 2, ErrConflict, nil},
+		{"any version", 3, Any, nil, []int64{4, 5}},
+		{"any version of new stream", 0, Any, nil, []int64{1, 2}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s := NewMemoryStore()
+			for i := 0; i < tt.existing; i++ {
+				if _, err := s.Append(ctx, "venue-1", Any, Event{Type: "existing"}); err != nil {
+					t.Fatalf("append existing event: %v", err)
+				}
+			}
+			// Another stream must not affect the versions.
+			if _, err := s.Append(ctx, "venue-2", Any, Event{Type: "other"}); err != nil {
+				t.Fatalf("append other event: %v", err)
+			}
+
+			evs, err := s.Append(ctx, "venue-1", tt.expected, Event{Type: "a"}, Event{Type: "b"})
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if len(evs) != len(tt.wantVersions) {
+				t.Fatalf("got %d events, want %d", len(evs), len(tt.wantVersions))
+			}
+			for i, e := range evs {
+				if e.Version != tt.wantVersions[i] || e.Stream != "venue-1" {
+					t.Errorf("got event %d at %s version %d, want venue-1 version %d",
+						i, e.Stream, e.Version, tt.wantVersions[i])
+				}
+			}
+			stored, _ := s.Read(ctx, "venue-1", 1) //nolint:errcheck // memory store
+			if want := tt.existing + len(tt.wantVersions); len(stored) != want {
+				t.Errorf("got %d stored events, want %d", len(stored), want)
+			}
+		})
+	}
+}
+
+func TestMemoryStoreAppendConcurrently(t *testing.T) {
+	// Writers that loaded the same version race to append; exactly one of
+	// them must win, the others must reload and retry.
+	ctx := context.Background()
+	s := NewMemoryStore()
+	if _, err := s.Append(ctx, "venue-1", NoStream, Event{Type: "created"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	const writers = 10
+	var (
+		wg        sync.WaitGroup
+		mu        sync.Mutex
+		won       int
+		conflicts int
+	)
+	for i := 0; i < writers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.Append(ctx, "venue-1", 1, Event{Type: "renamed"})
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				won++
+			case errors.Is(err, ErrConflict):
+				conflicts++
+			default:
+				t.Errorf("got error %v, want %v", err, ErrConflict)
+			}
+		}()
+	}
+	wg.Wait()
+	if won != 1 || conflicts != writers-1 {
+		t.Errorf("got %d appends and %d conflicts, want 1 and %d", won, conflicts, writers-1)
+	}
+	if v, err := Load(ctx, s, "venue-1", nil, func(Event) error { return nil }); v != 2 || err != nil {
+		t.Errorf("got version %d, %v, want 2", v, err)
+	}
+}
+
+func TestLoadAppendRetry(t *testing.T) {
+	// A command loads the stream, another one appends to it, and the
+	// command succeeds after reloading the fresh state.
+	ctx := context.Background()
+	s := NewMemoryStore()
+	if _, err := s.Append(ctx, "venue-1", NoStream, Event{Type: "created"}); err != nil {
+		t.Fatalf("append: %v", err)
+	}
+	if err := s.SaveSnapshot(ctx, Snapshot{Stream: "venue-1", Version: 1, Data: []byte("created")}); err != nil {
+		t.Fatalf("save snapshot: %v", err)
+	}
+
+	var applied []string
+	load := func() int64 {
+		applied = nil
+		v, err := Load(ctx, s, "venue-1",
+			func(snap Snapshot) error {
+				applied = append(applied, string(snap.Data))
+				return nil
+			},
+			func(e Event) error {
+				applied = append(applied, e.Type)
+				return nil
+			})
+		if err != nil {
+			t.Fatalf("load: %v", err)
+		}
+		return v
+	}
+	version := load()
+	if _, err := s.Append(ctx, "venue-1", version, Event{Type: "renamed"}); err != nil {
+		t.Fatalf("append concurrent command: %v", err)
+	}
+	if _, err := s.Append(ctx, "venue-1", version, Event{Type: "moved"}); !errors.Is(err, ErrConflict) {
+		t.Fatalf("got error %v, want %v", err, ErrConflict)
+	}
+	version = load()
+	if version != 2 || len(applied) != 2 || applied[0] != "created" || applied[1] != "renamed" {
+		t.Errorf("got version %d with %v, want version 2 with [created renamed]", version, applied)
+	}
+	if _, err := s.Append(ctx, "venue-1", version, Event{Type: "moved"}); err != nil {
+		t.Errorf("got error %v after reloading, want nil", err)
+	}
+}
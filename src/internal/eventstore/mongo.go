@@ -0,0 +1,250 @@
+package eventstore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// MongoStore is a [Store] backed by mongodb collections, which also keeps the
+// [Checkpoints]. The events are documents of the "events" collection, whose id
+// is their position; the positions are allocated from a counter document of
+// the "event_counters" collection. Call [MongoStore.CreateIndexes] once, e.g.
+// in the Init method of the service, to create the indexes the store relies
+// on.
+//
+// Appends run in transactions, thus the deployment must be a replica set or a
+// sharded cluster. Concurrent appends conflict on the counter document, which
+// serializes them, so that the positions are committed in order and the
+// followers reading by position never skip an event.
+type MongoStore struct {
+	db          *mongo.Database
+	events      *mongo.Collection
+	snapshots   *mongo.Collection
+	checkpoints *mongo.Collection
+	counters    *mongo.Collection
+}
+
+var (
+	_ Store       = (*MongoStore)(nil)
+	_ Checkpoints = (*MongoStore)(nil)
+)
+
+// NewMongoStore creates a new [MongoStore] using the collections of the
+// database.
+func NewMongoStore(db *mongo.Database) *MongoStore {
+	return &MongoStore{
+		db:          db,
+		events:      db.Collection("events"),
+		snapshots:   db.Collection("event_snapshots"),
+		checkpoints: db.Collection("event_checkpoints"),
+		counters:    db.Collection("event_counters"),
+	}
+}
+
+// CreateIndexes creates the unique index of the versions of the streams, if
+// it does not exist yet. The index rejects concurrent appends of the same
+// version, and serves [MongoStore.Read].
+func (s *MongoStore) CreateIndexes(ctx context.Context) error {
+	_, err := s.events.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "stream", Value: 1}, {Key: "version", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	return nil
+}
+
+// mongoEvent is the document of an [Event], with the same fields.
+type mongoEvent struct {
+	Stream        string            `bson:"stream"`
+	Version       int64             `bson:"version"`
+	Position      int64             `bson:"_id"`
+	Topic         string            `bson:"topic"`
+	Type          string            `bson:"type"`
+	SchemaVersion uint32            `bson:"schema_version"`
+	ContentType   string            `bson:"content_type"`
+	Data          []byte            `bson:"data"`
+	Headers       map[string]string `bson:"headers,omitempty"`
+	RecordedAt    time.Time         `bson:"recorded_at"`
+}
+
+// Append implements the [Store] interface.
+func (s *MongoStore) Append(
+	ctx context.Context,
+	stream string,
+	expected int64,
+	evs ...Event,
+) ([]Event, error) {
+	sess, err := s.db.Client().StartSession()
+	if err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	defer sess.EndSession(ctx)
+
+	var res []Event
+	_, err = sess.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		var last mongoEvent
+		opts := options.FindOne().SetSort(bson.D{{Key: "version", Value: -1}})
+		err := s.events.FindOne(sc, bson.M{"stream": stream}, opts).Decode(&last)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, err //nolint:wrapcheck // wrapped below
+		}
+		if err := checkVersion(stream, last.Version, expected); err != nil {
+			return nil, err
+		}
+		if len(evs) == 0 {
+			return nil, nil
+		}
+
+		var counter struct {
+			Position int64 `bson:"position"`
+		}
+		n := int64(len(evs))
+		err = s.counters.FindOneAndUpdate(sc,
+			bson.M{"_id": "events"},
+			bson.M{"$inc": bson.M{"position": n}},
+			options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+		).Decode(&counter)
+		if err != nil {
+			return nil, err //nolint:wrapcheck // wrapped below
+		}
+
+		now := time.Now().UTC()
+		res = make([]Event, len(evs))
+		docs := make([]any, len(evs))
+		for i, e := range evs {
+			e.Stream, e.Version, e.RecordedAt = stream, last.Version+int64(i)+1, now
+			e.Position = counter.Position - n + int64(i) + 1
+			res[i], docs[i] = e, mongoEvent(e)
+		}
+		_, err = s.events.InsertMany(sc, docs)
+		return nil, err //nolint:wrapcheck // wrapped below
+	})
+	switch {
+	case errors.Is(err, ErrConflict):
+		return nil, err
+	case mongo.IsDuplicateKeyError(err):
+		return nil, fmt.Errorf("%w: stream %s", ErrConflict, stream)
+	case err != nil:
+		return nil, service.Unexpected(ctx, err)
+	}
+	return res, nil
+}
+
+// Read implements the [Store] interface.
+func (s *MongoStore) Read(ctx context.Context, stream string, from int64) ([]Event, error) {
+	return s.find(ctx,
+		bson.M{"stream": stream, "version": bson.M{"$gte": from}},
+		options.Find().SetSort(bson.D{{Key: "version", Value: 1}}),
+	)
+}
+
+// ReadAll implements the [Store] interface.
+func (s *MongoStore) ReadAll(ctx context.Context, after int64, limit int) ([]Event, error) {
+	return s.find(ctx,
+		bson.M{"_id": bson.M{"$gt": after}},
+		options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}).SetLimit(int64(limit)),
+	)
+}
+
+// Head implements the [Store] interface.
+func (s *MongoStore) Head(ctx context.Context) (int64, error) {
+	var last mongoEvent
+	opts := options.FindOne().SetSort(bson.D{{Key: "_id", Value: -1}}).SetProjection(bson.M{"_id": 1})
+	err := s.events.FindOne(ctx, bson.M{}, opts).Decode(&last)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, service.Unexpected(ctx, err)
+	}
+	return last.Position, nil
+}
+
+// find returns the events matching the filter.
+func (s *MongoStore) find(
+	ctx context.Context,
+	filter bson.M,
+	opts *options.FindOptions,
+) ([]Event, error) {
+	cur, err := s.events.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	var docs []mongoEvent
+	if err := cur.All(ctx, &docs); err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	res := make([]Event, len(docs))
+	for i, d := range docs {
+		res[i] = Event(d)
+	}
+	return res, nil
+}
+
+// SaveSnapshot implements the [Store] interface.
+func (s *MongoStore) SaveSnapshot(ctx context.Context, snap Snapshot) error {
+	_, err := s.snapshots.UpdateOne(ctx,
+		bson.M{"_id": snap.Stream, "version": bson.M{"$lt": snap.Version}},
+		bson.M{"$set": bson.M{
+			"version":  snap.Version,
+			"data":     snap.Data,
+			"taken_at": snap.TakenAt.UTC(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	if mongo.IsDuplicateKeyError(err) {
+		return nil // a newer snapshot exists
+	}
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	return nil
+}
+
+// LoadSnapshot implements the [Store] interface.
+func (s *MongoStore) LoadSnapshot(ctx context.Context, stream string) (Snapshot, error) {
+	var doc struct {
+		Version int64     `bson:"version"`
+		Data    []byte    `bson:"data"`
+		TakenAt time.Time `bson:"taken_at"`
+	}
+	err := s.snapshots.FindOne(ctx, bson.M{"_id": stream}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return Snapshot{}, fmt.Errorf("%w: snapshot of %s", service.ErrNotFound, stream)
+	}
+	if err != nil {
+		return Snapshot{}, service.Unexpected(ctx, err)
+	}
+	return Snapshot{Stream: stream, Version: doc.Version, Data: doc.Data, TakenAt: doc.TakenAt}, nil
+}
+
+// Checkpoint implements the [Checkpoints] interface.
+func (s *MongoStore) Checkpoint(ctx context.Context, name string) (int64, error) {
+	var doc struct {
+		Position int64 `bson:"position"`
+	}
+	err := s.checkpoints.FindOne(ctx, bson.M{"_id": name}).Decode(&doc)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, service.Unexpected(ctx, err)
+	}
+	return doc.Position, nil
+}
+
+// SaveCheckpoint implements the [Checkpoints] interface.
+func (s *MongoStore) SaveCheckpoint(ctx context.Context, name string, position int64) error {
+	_, err := s.checkpoints.UpdateOne(ctx,
+		bson.M{"_id": name},
+		bson.M{"$set": bson.M{"position": position, "updated_at": time.Now().UTC()}},
+		options.Update().SetUpsert(true),
+	)
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	return nil
+}
@@ -0,0 +1,156 @@
+package eventstore
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/codec"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/workers"
+)
+
+// PublisherConfig encapsulates the configuration of a [Publisher].
+type PublisherConfig struct {
+	// PollInterval is the interval at which the store is polled
+	// for new events.
+	PollInterval time.Duration `env:"EVENTSTORE_POLL_INTERVAL" envDefault:"1s"`
+
+	// BatchSize is the maximum number of events read at once.
+	BatchSize int `env:"EVENTSTORE_BATCH_SIZE" envDefault:"100"`
+}
+
+// Publisher publishes the persisted events to the message bus, in the order
+// of their positions, on the topics they were appended with. The position of
+// the last published event is saved as checkpoint named after the publisher.
+//
+// The events are published at least once: the publisher picks up from its
+// checkpoint when restarted, thus it publishes again the events published
+// after the checkpoint was last saved. Consumers deduplicate events by the
+// [PositionHeader] where this matters. Only one replica must run the
+// publisher of a store, e.g. the leader, see package leader, since every
+// replica would publish every event otherwise.
+type Publisher struct {
+	name        string
+	cfg         PublisherConfig
+	store       Store
+	checkpoints Checkpoints
+	bus         service.MessageBus
+}
+
+// NewPublisher creates a new [Publisher] of the events of the store.
+func NewPublisher(
+	name string,
+	cfg PublisherConfig,
+	s Store,
+	cp Checkpoints,
+	bus service.MessageBus,
+) *Publisher {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	return &Publisher{name: name, cfg: cfg, store: s, checkpoints: cp, bus: bus}
+}
+
+// Run publishes the new events of the store. This is a blocking function that
+// polls the store until ctx is cancelled. This function returns the errors of
+// the checkpoints in case the checkpoint cannot be loaded.
+func (p *Publisher) Run(ctx context.Context) error {
+	position, err := p.checkpoints.Checkpoint(ctx, p.name)
+	if err != nil {
+		return err //nolint:wrapcheck // errors of the checkpoints
+	}
+
+	ticker := time.NewTicker(p.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		position = p.publishNew(ctx, position)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Worker returns the background worker running [Publisher.Run].
+func (p *Publisher) Worker() workers.Worker {
+	return workers.Worker{Name: "eventstore-" + p.name, Run: p.Run, Restart: workers.RestartOnFailure}
+}
+
+// publishNew publishes the events after the position, until all events are
+// published or publishing fails, and returns the position of the last
+// published event.
+func (p *Publisher) publishNew(ctx context.Context, position int64) int64 {
+	for ctx.Err() == nil {
+		evs, err := p.store.ReadAll(ctx, position, p.cfg.BatchSize)
+		if err != nil {
+			slog.Error("failed to read events",
+				slog.String("publisher", p.name), slog.String("error", err.Error()))
+			return position
+		}
+
+		published, failed := position, false
+		for _, e := range evs {
+			if err := codec.PublishEncoded(ctx, p.bus, e.Topic, e.Meta(), e.Data); err != nil {
+				publishFailures.Inc(e.Topic)
+				slog.Error("failed to publish event",
+					slog.String("publisher", p.name),
+					slog.String("stream", e.Stream),
+					slog.Int64("position", e.Position),
+					slog.String("error", err.Error()),
+				)
+				failed = true
+				break
+			}
+			publishedEvents.Inc(e.Topic)
+			published = e.Position
+		}
+		if published > position {
+			// A checkpoint that failed to save is saved with the
+			// next batch; until then, a restart publishes the
+			// batch again.
+			if err := p.checkpoints.SaveCheckpoint(ctx, p.name, published); err != nil {
+				slog.Error("failed to save checkpoint",
+					slog.String("publisher", p.name), slog.String("error", err.Error()))
+			}
+			position = published
+		}
+		if failed || len(evs) < p.cfg.BatchSize {
+			return position
+		}
+	}
+	return position
+}
+
+const (
+	// defaultPollInterval is the poll interval of publishers
+	// configured without one.
+	defaultPollInterval = time.Second
+
+	// defaultBatchSize is the batch size of publishers configured
+	// without one.
+	defaultBatchSize = 100
+)
+
+var (
+	// publishedEvents counts the events published from the store.
+	publishedEvents = metrics.NewCounter(
+		"eventstore_published_total",
+		"Number of persisted events published to the message bus.",
+		"topic",
+	)
+
+	// publishFailures counts the failed attempts to publish events
+	// from the store.
+	publishFailures = metrics.NewCounter(
+		"eventstore_publish_failures_total",
+		"Number of failed attempts to publish persisted events to the message bus.",
+		"topic",
+	)
+)
@@ -0,0 +1,242 @@
+package eventstore
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/store"
+)
+
+// SQLStore is a [Store] backed by postgres tables, which also keeps the
+// [Checkpoints]. The tables must be created by the migrations of the service:
+//
+//	CREATE TABLE events (
+//		position       BIGSERIAL PRIMARY KEY,
+//		stream         TEXT NOT NULL,
+//		version        BIGINT NOT NULL,
+//		topic          TEXT NOT NULL,
+//		type           TEXT NOT NULL,
+//		schema_version INTEGER NOT NULL,
+//		content_type   TEXT NOT NULL,
+//		data           BYTEA NOT NULL,
+//		headers        JSONB,
+//		recorded_at    TIMESTAMPTZ NOT NULL,
+//		UNIQUE (stream, version)
+//	);
+//	CREATE TABLE event_snapshots (
+//		stream   TEXT PRIMARY KEY,
+//		version  BIGINT NOT NULL,
+//		data     BYTEA NOT NULL,
+//		taken_at TIMESTAMPTZ NOT NULL
+//	);
+//	CREATE TABLE event_checkpoints (
+//		name       TEXT PRIMARY KEY,
+//		position   BIGINT NOT NULL,
+//		updated_at TIMESTAMPTZ NOT NULL
+//	);
+//
+// Appends are serialized by an advisory lock, so that the positions of the
+// events are committed in order and the followers reading by position never
+// skip an event whose transaction committed late.
+type SQLStore struct {
+	db *sql.DB
+}
+
+var (
+	_ Store       = (*SQLStore)(nil)
+	_ Checkpoints = (*SQLStore)(nil)
+)
+
+// NewSQLStore creates a new [SQLStore].
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Append implements the [Store] interface.
+func (s *SQLStore) Append(
+	ctx context.Context,
+	stream string,
+	expected int64,
+	evs ...Event,
+) ([]Event, error) {
+	now := time.Now().UTC()
+	res := make([]Event, len(evs))
+	err := store.InTx(ctx, s.db, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, "SELECT pg_advisory_xact_lock($1)", appendLockKey); err != nil {
+			return service.Unexpected(ctx, err)
+		}
+		var current int64
+		row := tx.QueryRowContext(ctx,
+			"SELECT COALESCE(MAX(version), 0) FROM events WHERE stream = $1", stream)
+		if err := row.Scan(&current); err != nil {
+			return service.Unexpected(ctx, err)
+		}
+		if err := checkVersion(stream, current, expected); err != nil {
+			return err
+		}
+
+		for i, e := range evs {
+			e.Stream, e.Version, e.RecordedAt = stream, current+int64(i)+1, now
+			headers, err := json.Marshal(e.Headers)
+			if err != nil {
+				return fmt.Errorf("%w: encode headers: %v", service.ErrBadRequest, err)
+			}
+			err = tx.QueryRowContext(ctx, `
+				INSERT INTO events (
+					stream, version, topic, type, schema_version, content_type, data, headers, recorded_at
+				)
+				VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+				RETURNING position`,
+				e.Stream, e.Version, e.Topic, e.Type, e.SchemaVersion, e.ContentType, e.Data,
+				string(headers), e.RecordedAt,
+			).Scan(&e.Position)
+			if isUniqueViolation(err) {
+				return fmt.Errorf("%w: stream %s", ErrConflict, stream)
+			}
+			if err != nil {
+				return service.Unexpected(ctx, err)
+			}
+			res[i] = e
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err //nolint:wrapcheck // wrapped by fn
+	}
+	return res, nil
+}
+
+// Read implements the [Store] interface.
+func (s *SQLStore) Read(ctx context.Context, stream string, from int64) ([]Event, error) {
+	return s.query(ctx,
+		"SELECT "+eventColumns+" FROM events WHERE stream = $1 AND version >= $2 ORDER BY version",
+		stream, from)
+}
+
+// ReadAll implements the [Store] interface.
+func (s *SQLStore) ReadAll(ctx context.Context, after int64, limit int) ([]Event, error) {
+	return s.query(ctx,
+		"SELECT "+eventColumns+" FROM events WHERE position > $1 ORDER BY position LIMIT $2",
+		after, limit)
+}
+
+// Head implements the [Store] interface.
+func (s *SQLStore) Head(ctx context.Context) (int64, error) {
+	var position int64
+	err := s.db.QueryRowContext(ctx, "SELECT COALESCE(MAX(position), 0) FROM events").Scan(&position)
+	if err != nil {
+		return 0, service.Unexpected(ctx, err)
+	}
+	return position, nil
+}
+
+// query returns the events selected by the query.
+func (s *SQLStore) query(ctx context.Context, query string, args ...any) ([]Event, error) {
+	rows, err := s.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	defer rows.Close() //nolint:errcheck // intentional
+
+	var res []Event
+	for rows.Next() {
+		var (
+			e       Event
+			headers []byte
+		)
+		if err := rows.Scan(&e.Position, &e.Stream, &e.Version, &e.Topic, &e.Type, &e.SchemaVersion,
+			&e.ContentType, &e.Data, &headers, &e.RecordedAt); err != nil {
+			return nil, service.Unexpected(ctx, err)
+		}
+		if len(headers) > 0 {
+			if err := json.Unmarshal(headers, &e.Headers); err != nil {
+				return nil, service.Unexpected(ctx, err)
+			}
+		}
+		res = append(res, e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	return res, nil
+}
+
+// SaveSnapshot implements the [Store] interface.
+func (s *SQLStore) SaveSnapshot(ctx context.Context, snap Snapshot) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_snapshots (stream, version, data, taken_at)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (stream) DO UPDATE SET version = $2, data = $3, taken_at = $4
+		WHERE event_snapshots.version < $2`,
+		snap.Stream, snap.Version, snap.Data, snap.TakenAt.UTC(),
+	)
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	return nil
+}
+
+// LoadSnapshot implements the [Store] interface.
+func (s *SQLStore) LoadSnapshot(ctx context.Context, stream string) (Snapshot, error) {
+	snap := Snapshot{Stream: stream}
+	err := s.db.QueryRowContext(ctx,
+		"SELECT version, data, taken_at FROM event_snapshots WHERE stream = $1", stream,
+	).Scan(&snap.Version, &snap.Data, &snap.TakenAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Snapshot{}, fmt.Errorf("%w: snapshot of %s", service.ErrNotFound, stream)
+	}
+	if err != nil {
+		return Snapshot{}, service.Unexpected(ctx, err)
+	}
+	return snap, nil
+}
+
+// Checkpoint implements the [Checkpoints] interface.
+func (s *SQLStore) Checkpoint(ctx context.Context, name string) (int64, error) {
+	var position int64
+	err := s.db.QueryRowContext(ctx,
+		"SELECT position FROM event_checkpoints WHERE name = $1", name,
+	).Scan(&position)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, service.Unexpected(ctx, err)
+	}
+	return position, nil
+}
+
+// SaveCheckpoint implements the [Checkpoints] interface.
+func (s *SQLStore) SaveCheckpoint(ctx context.Context, name string, position int64) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO event_checkpoints (name, position, updated_at)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO UPDATE SET position = $2, updated_at = $3`,
+		name, position, time.Now().UTC(),
+	)
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	return nil
+}
+
+// isUniqueViolation reports whether the insert violated a unique constraint.
+// The postgres drivers expose the SQLSTATE code of their errors.
+func isUniqueViolation(err error) bool {
+	var e interface{ SQLState() string }
+	return errors.As(err, &e) && e.SQLState() == "23505" // unique_violation
+}
+
+const (
+	// eventColumns are the columns of an [Event], in the order of
+	// [SQLStore.query].
+	eventColumns = "position, stream, version, topic, type, schema_version, content_type, " +
+		"data, headers, recorded_at"
+
+	// appendLockKey is the key of the advisory lock serializing the
+	// appends.
+	appendLockKey int64 = 0x6576656e7473 // "events"
+)
@@ -0,0 +1,389 @@
+// Package filter parses the filtering and sorting query parameters of the list
+// endpoints, e.g. "?filter=status:eq:active&sort=-created_at", into a [Spec]
+// that the repositories turn into sql.
+//
+// Clients may only filter and sort by the fields of a [Schema], which maps
+// the names of the api to the columns of the table, thus arbitrary columns
+// are never exposed. The values are parsed by the type of the field and bound
+// as query arguments:
+//
+//	var venueFields = filter.Schema{
+//		"status":     {Column: "status", Type: filter.String},
+//		"capacity":   {Column: "capacity", Type: filter.Int, Sortable: true},
+//		"created_at": {Column: "created_at", Type: filter.Time, Sortable: true},
+//	}
+//
+//	spec, err := venueFields.Parse(r.URL.Query())
+//	...
+//	err = spec.Apply(&q, "id")
+//
+// In-memory repositories and fakes filter their items with [Spec.Match]
+// instead.
+package filter
+
+import (
+	"cmp"
+	"fmt"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/store"
+)
+
+// Type is the type of the values of a field.
+type Type int
+
+// The types of the fields.
+const (
+	String Type = iota
+	Int
+	Float
+	Bool
+	Time // rfc 3339
+)
+
+// Op is a comparison operator of a filter condition.
+type Op string
+
+// The operators of the filter conditions. The values of [In] are separated by
+// "|", e.g. "status:in:active|pending". [Contains] matches substrings of
+// string fields, case insensitively.
+const (
+	Eq       Op = "eq"
+	Ne       Op = "ne"
+	Lt       Op = "lt"
+	Le       Op = "le"
+	Gt       Op = "gt"
+	Ge       Op = "ge"
+	In       Op = "in"
+	Contains Op = "contains"
+)
+
+// Field is a field that clients may filter, and possibly sort, by.
+type Field struct {
+	// Column is the sql expression of the field, usually a column.
+	// Sortable fields must be plain columns.
+	Column string
+
+	Type Type
+
+	// Ops restricts the operators allowed on the field. Empty
+	// allows all operators that apply to the type.
+	Ops []Op
+
+	// Sortable allows sorting by the field.
+	Sortable bool
+}
+
+// Schema lists the fields of a resource by their name in the api.
+type Schema map[string]Field
+
+// Condition is a parsed filter condition.
+type Condition struct {
+	Field  string
+	Column string
+	Op     Op
+	Values []any
+}
+
+// SortField is a parsed sort field.
+type SortField struct {
+	Field  string
+	Column string
+	Desc   bool
+}
+
+// Spec is the parsed filtering and sorting of a request.
+type Spec struct {
+	// Conditions are the filter conditions, all of which must
+	// match.
+	Conditions []Condition
+
+	// Sort are the sort fields, in order of precedence.
+	Sort []SortField
+}
+
+// Parse parses the "filter" and "sort" query parameters. Filters are
+// "field:op:value" conditions, separated by commas or given as separate
+// parameters; sort fields are separated by commas and prefixed with "-" for
+// descending order. This function returns [service.ErrBadRequest] in case the
+// parameters are malformed, or refer to fields or operators the schema does
+// not allow.
+func (s Schema) Parse(q url.Values) (Spec, error) {
+	var spec Spec
+	for _, param := range q["filter"] {
+		for _, expr := range strings.Split(param, ",") {
+			if expr = strings.TrimSpace(expr); expr == "" {
+				continue
+			}
+			c, err := s.parseCondition(expr)
+			if err != nil {
+				return Spec{}, err
+			}
+			spec.Conditions = append(spec.Conditions, c)
+		}
+	}
+	if len(spec.Conditions) > maxConditions {
+		return Spec{}, fmt.Errorf("%w: at most %d filter conditions",
+			service.ErrBadRequest, maxConditions)
+	}
+
+	for _, param := range q["sort"] {
+		for _, name := range strings.Split(param, ",") {
+			if name = strings.TrimSpace(name); name == "" {
+				continue
+			}
+			name, desc := strings.CutPrefix(name, "-")
+			name = strings.TrimPrefix(name, "+")
+			f, ok := s[name]
+			if !ok || !f.Sortable {
+				return Spec{}, fmt.Errorf("%w: cannot sort by %q", service.ErrBadRequest, name)
+			}
+			if slices.ContainsFunc(spec.Sort, func(sf SortField) bool { return sf.Field == name }) {
+				return Spec{}, fmt.Errorf("%w: duplicate sort field %q", service.ErrBadRequest, name)
+			}
+			spec.Sort = append(spec.Sort, SortField{Field: name, Column: f.Column, Desc: desc})
+		}
+	}
+	if len(spec.Sort) > maxSortFields {
+		return Spec{}, fmt.Errorf("%w: at most %d sort fields", service.ErrBadRequest, maxSortFields)
+	}
+	return spec, nil
+}
+
+// parseCondition parses a "field:op:value" condition. The value may contain
+// colons, e.g. times.
+func (s Schema) parseCondition(expr string) (Condition, error) {
+	parts := strings.SplitN(expr, ":", 3)
+	if len(parts) != 3 {
+		return Condition{}, fmt.Errorf("%w: filter %q is not field:op:value", service.ErrBadRequest, expr)
+	}
+	name, op, raw := parts[0], Op(parts[1]), parts[2]
+	f, ok := s[name]
+	if !ok {
+		return Condition{}, fmt.Errorf("%w: cannot filter by %q", service.ErrBadRequest, name)
+	}
+	if !f.allows(op) {
+		return Condition{}, fmt.Errorf("%w: operator %q is not allowed on %q",
+			service.ErrBadRequest, op, name)
+	}
+
+	raws := []string{raw}
+	if op == In {
+		raws = strings.Split(raw, "|")
+		if len(raws) > maxInValues {
+			return Condition{}, fmt.Errorf("%w: at most %d values for %q",
+				service.ErrBadRequest, maxInValues, name)
+		}
+	}
+	c := Condition{Field: name, Column: f.Column, Op: op, Values: make([]any, 0, len(raws))}
+	for _, r := range raws {
+		v, err := f.Type.parse(r)
+		if err != nil {
+			return Condition{}, fmt.Errorf("%w: invalid value %q for %q", service.ErrBadRequest, r, name)
+		}
+		c.Values = append(c.Values, v)
+	}
+	return c, nil
+}
+
+// allows reports whether the operator is allowed on the field.
+func (f Field) allows(op Op) bool {
+	if len(f.Ops) > 0 && !slices.Contains(f.Ops, op) {
+		return false
+	}
+	switch op {
+	case Eq, Ne, In:
+		return true
+	case Lt, Le, Gt, Ge:
+		return f.Type != Bool
+	case Contains:
+		return f.Type == String
+	default:
+		return false
+	}
+}
+
+// parse parses a value of the type.
+func (t Type) parse(s string) (any, error) {
+	switch t {
+	case Int:
+		return strconv.ParseInt(s, 10, 64)
+	case Float:
+		return strconv.ParseFloat(s, 64)
+	case Bool:
+		return strconv.ParseBool(s)
+	case Time:
+		return time.Parse(time.RFC3339Nano, s)
+	default:
+		return s, nil
+	}
+}
+
+// SQL returns the conditions of the spec as sql condition, with placeholders
+// numbered from offset+1, and their arguments. Returns "" if the spec has no
+// conditions.
+func (s Spec) SQL(offset int) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	next := func(v any) string {
+		args = append(args, v)
+		return "$" + strconv.Itoa(offset+len(args))
+	}
+	for _, c := range s.Conditions {
+		switch c.Op {
+		case In:
+			placeholders := make([]string, len(c.Values))
+			for i, v := range c.Values {
+				placeholders[i] = next(v)
+			}
+			conds = append(conds, c.Column+" IN ("+strings.Join(placeholders, ", ")+")")
+		case Contains:
+			pattern := "%" + likeEscaper.Replace(c.Values[0].(string)) + "%" //nolint:forcetypeassert // string fields
+			conds = append(conds, c.Column+" ILIKE "+next(pattern))
+		default:
+			conds = append(conds, c.Column+" "+sqlOps[c.Op]+" "+next(c.Values[0]))
+		}
+	}
+	return strings.Join(conds, " AND "), args
+}
+
+// Apply adds the conditions and the order of the spec to the list query, see
+// [store.List]. The key columns of the table, e.g. "id", are appended to the
+// order, so that it is unique; they also order the rows if the spec has no
+// sort fields. Keyset paging compares whole rows, thus the sort fields must
+// share the direction. This function returns [service.ErrBadRequest] in case
+// they do not.
+func (s Spec) Apply(q *store.ListQuery, key ...string) error {
+	if len(s.Sort) > 0 {
+		desc := s.Sort[0].Desc
+		order := make([]string, 0, len(s.Sort)+len(key))
+		for _, sf := range s.Sort {
+			if sf.Desc != desc {
+				return fmt.Errorf("%w: sort fields must share the direction", service.ErrBadRequest)
+			}
+			order = append(order, sf.Column)
+		}
+		q.OrderBy, q.Desc = order, desc
+	}
+	if cond, args := s.SQL(len(q.Args)); cond != "" {
+		if strings.TrimSpace(q.Where) != "" {
+			cond = "(" + q.Where + ") AND " + cond
+		}
+		q.Where = cond
+		q.Args = append(q.Args, args...)
+	}
+	for _, k := range key {
+		if !slices.Contains(q.OrderBy, k) {
+			q.OrderBy = append(q.OrderBy, k)
+		}
+	}
+	return nil
+}
+
+// Match reports whether an item matches the conditions of the spec, like the
+// rows matching [Spec.SQL], e.g. for in-memory repositories and fakes. The
+// item is given by the values of its fields, by their name in the api, typed
+// like the parsed values: string, int64, float64, bool or [time.Time]. Fields
+// without a value do not match.
+func (s Spec) Match(values map[string]any) bool {
+	for _, c := range s.Conditions {
+		v, ok := values[c.Field]
+		if !ok || !c.match(v) {
+			return false
+		}
+	}
+	return true
+}
+
+// match reports whether the value of the field matches the condition.
+func (c Condition) match(v any) bool {
+	switch c.Op {
+	case In:
+		return slices.ContainsFunc(c.Values, func(w any) bool {
+			n, ok := compare(v, w)
+			return ok && n == 0
+		})
+	case Contains:
+		s, ok := v.(string)
+		sub, _ := c.Values[0].(string)
+		return ok && strings.Contains(strings.ToLower(s), strings.ToLower(sub))
+	}
+	n, ok := compare(v, c.Values[0])
+	if !ok {
+		return false
+	}
+	switch c.Op {
+	case Eq:
+		return n == 0
+	case Ne:
+		return n != 0
+	case Lt:
+		return n < 0
+	case Le:
+		return n <= 0
+	case Gt:
+		return n > 0
+	case Ge:
+		return n >= 0
+	default:
+		return false
+	}
+}
+
+// compare compares two values of the same type. It reports false in case the
+// types differ, or are not ordered; booleans only compare equal or not.
+func compare(a, b any) (int, bool) {
+	switch a := a.(type) {
+	case string:
+		if b, ok := b.(string); ok {
+			return strings.Compare(a, b), true
+		}
+	case int64:
+		if b, ok := b.(int64); ok {
+			return cmp.Compare(a, b), true
+		}
+	case float64:
+		if b, ok := b.(float64); ok {
+			return cmp.Compare(a, b), true
+		}
+	case bool:
+		if b, ok := b.(bool); ok {
+			if a == b {
+				return 0, true
+			}
+			return 1, true
+		}
+	case time.Time:
+		if b, ok := b.(time.Time); ok {
+			return a.Compare(b), true
+		}
+	}
+	return 0, false
+}
+
+const (
+	// maxConditions is the maximum number of filter conditions.
+	maxConditions = 20
+
+	// maxSortFields is the maximum number of sort fields.
+	maxSortFields = 5
+
+	// maxInValues is the maximum number of values of an [In] condition.
+	maxInValues = 100
+)
+
+var (
+	// sqlOps are the sql operators of the comparison operators.
+	sqlOps = map[Op]string{Eq: "=", Ne: "<>", Lt: "<", Le: "<=", Gt: ">", Ge: ">="}
+
+	// likeEscaper escapes the wildcards of a LIKE pattern.
+	likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+)
@@ -0,0 +1,115 @@
+package filter
+
+import (
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+var testFields = Schema{
+	"city":       {Column: "city", Type: String},
+	"name":       {Column: "name", Type: String, Ops: []Op{Eq, Contains}},
+	"capacity":   {Column: "capacity", Type: Int, Sortable: true},
+	"open":       {Column: "open", Type: Bool},
+	"created_at": {Column: "created_at", Type: Time, Sortable: true},
+}
+
+func TestSchemaParse(t *testing.T) {
+	tests := []struct {
+		name    string
+		query   string
+		wantSQL string
+		wantErr error
+	}{
+		{"empty", "", "", nil},
+		{"eq", "filter=city:eq:Sofia", "city = $1", nil},
+		{"conditions", "filter=city:eq:Sofia,capacity:ge:100&filter=open:eq:true", "city = $1 AND capacity >= $2 AND open = $3", nil},
+		{"in", "filter=city:in:Sofia|Varna", "city IN ($1, $2)", nil},
+		{"contains", "filter=name:contains:arena", "name ILIKE $1", nil},
+		{"time with colons", "filter=created_at:lt:2024-01-01T00:00:00Z", "created_at < $1", nil},
+		{"sort", "sort=-capacity,created_at", "", nil},
+		{"unknown field", "filter=owner:eq:x", "", service.ErrBadRequest},
+		{"disallowed operator", "filter=name:ne:x", "", service.ErrBadRequest},
+		{"contains on int", "filter=capacity:contains:1", "", service.ErrBadRequest},
+		{"lt on bool", "filter=open:lt:true", "", service.ErrBadRequest},
+		{"invalid value", "filter=capacity:eq:many", "", service.ErrBadRequest},
+		{"malformed", "filter=city", "", service.ErrBadRequest},
+		{"unsortable field", "sort=city", "", service.ErrBadRequest},
+		{"duplicate sort field", "sort=capacity,-capacity", "", service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			q, err := url.ParseQuery(tt.query)
+			if err != nil {
+				t.Fatalf("parse query: %v", err)
+			}
+			spec, err := testFields.Parse(q)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got, _ := spec.SQL(0); got != tt.wantSQL {
+				t.Errorf("got sql %q, want %q", got, tt.wantSQL)
+			}
+		})
+	}
+}
+
+func TestSpecMatch(t *testing.T) {
+	item := map[string]any{
+		"city":       "Sofia",
+		"name":       "Arena Armeec",
+		"capacity":   int64(12000),
+		"open":       true,
+		"created_at": time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+	}
+	tests := []struct {
+		filter string
+		want   bool
+	}{
+		{"", true},
+		{"city:eq:Sofia", true},
+		{"city:eq:sofia", false},
+		{"city:ne:Varna", true},
+		{"city:in:Varna|Sofia", true},
+		{"city:in:Varna|Plovdiv", false},
+		{"name:contains:ARENA", true},
+		{"name:contains:hall", false},
+		{"capacity:ge:12000", true},
+		{"capacity:gt:12000", false},
+		{"capacity:lt:20000,city:eq:Sofia", true},
+		{"capacity:lt:20000,city:eq:Varna", false},
+		{"open:eq:false", false},
+		{"open:ne:false", true},
+		{"created_at:le:2024-01-01T00:00:00Z", true},
+		{"created_at:gt:2024-01-01T00:00:00Z", false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.filter, func(t *testing.T) {
+			spec, err := testFields.Parse(url.Values{"filter": {tt.filter}})
+			if err != nil {
+				t.Fatalf("parse: %v", err)
+			}
+			if got := spec.Match(item); got != tt.want {
+				t.Errorf("got match %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSpecMatchMissingValue(t *testing.T) {
+	spec, err := testFields.Parse(url.Values{"filter": {"city:ne:Sofia"}})
+	if err != nil {
+		t.Fatalf("parse: %v", err)
+	}
+	if spec.Match(map[string]any{"name": "Arena"}) {
+		t.Error("got an item without the field matching")
+	}
+	if spec.Match(map[string]any{"city": 1}) {
+		t.Error("got an item with a value of another type matching")
+	}
+}
@@ -0,0 +1,211 @@
+// Package fixtures records the messages received from the message bus to
+// fixture files, and replays them into event handlers, so that regression
+// tests run on realistic event data.
+//
+// In development, wrap the message bus of the service on Init:
+//
+//	bus = fixtures.Record(bus, cfg.Fixtures)
+//
+// and copy the recorded files of interest into the testdata of the tests, see
+// servicetest.ReplayFixtures. Fixtures can also be built by hand with [New].
+// Never record in production: the payloads are written to disk as they are.
+package fixtures
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Config encapsulates the configuration of the recorder.
+type Config struct {
+	// Dir is the directory into which the messages are recorded.
+	// Empty disables the recording.
+	Dir string `env:"FIXTURES_RECORD_DIR"`
+
+	// Limit is the maximum number of messages recorded per topic.
+	// Zero means no limit.
+	Limit int `env:"FIXTURES_RECORD_LIMIT" envDefault:"100"`
+}
+
+// Fixture is a recorded message.
+type Fixture struct {
+	Topic string `json:"topic"`
+
+	// Headers are the headers of the message. The message bus
+	// does not carry headers yet, thus recorded fixtures have
+	// none.
+	Headers map[string]string `json:"headers,omitempty"`
+
+	// Payload holds json payloads as they are, Data holds all
+	// other payloads.
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Data    []byte          `json:"data,omitempty"`
+
+	RecordedAt time.Time `json:"recorded_at,omitempty"`
+}
+
+// New builds a fixture for the topic with the json encoding of payload. This
+// function returns [service.ErrBadRequest] in case payload cannot be encoded.
+func New(topic string, payload any) (Fixture, error) {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return Fixture{}, fmt.Errorf("%w: encode fixture payload: %v", service.ErrBadRequest, err)
+	}
+	return Fixture{Topic: topic, Payload: b}, nil
+}
+
+// Message returns the message as it was received from the bus.
+func (f Fixture) Message() []byte {
+	if len(f.Payload) > 0 {
+		return f.Payload
+	}
+	return f.Data
+}
+
+// Record wraps the message bus, recording the received messages to
+// <cfg.Dir>/<topic>.ndjson, one fixture per line. It returns bus as is if the
+// recording is disabled. Recording never fails the handling of a message.
+func Record(bus service.MessageBus, cfg Config) service.MessageBus {
+	if cfg.Dir == "" {
+		return bus
+	}
+	slog.Warn("recording bus messages", slog.String("dir", cfg.Dir))
+	return &recordingBus{MessageBus: bus, cfg: cfg, counts: make(map[string]int)}
+}
+
+// Load reads the fixtures of a file written by [Record]. This function returns
+// [service.ErrNotFound] in case the file does not exist, and
+// [service.ErrBadRequest] in case it is malformed.
+func Load(path string) ([]Fixture, error) {
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, fmt.Errorf("%w: fixtures %s", service.ErrNotFound, path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: read fixtures: %v", service.ErrUnexpected, err)
+	}
+
+	var res []Fixture
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	sc.Buffer(nil, maxLine)
+	for n := 1; sc.Scan(); n++ {
+		line := bytes.TrimSpace(sc.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+		var f Fixture
+		if err := json.Unmarshal(line, &f); err != nil {
+			return nil, fmt.Errorf("%w: %s:%d: %v", service.ErrBadRequest, path, n, err)
+		}
+		res = append(res, f)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", service.ErrBadRequest, path, err)
+	}
+	return res, nil
+}
+
+// Replay calls the handler of the topic of every fixture with its message, in
+// order. This function returns [service.ErrNotFound] in case there is no
+// handler for a topic.
+func Replay(
+	ctx context.Context,
+	fixtures []Fixture,
+	handlers map[string]service.EventHandler,
+) error {
+	for _, f := range fixtures {
+		h, ok := handlers[f.Topic]
+		if !ok {
+			return fmt.Errorf("%w: no handler for topic %q", service.ErrNotFound, f.Topic)
+		}
+		h(ctx, f.Message())
+	}
+	return nil
+}
+
+// recordingBus records the received messages.
+type recordingBus struct {
+	service.MessageBus
+	cfg Config
+
+	mu     sync.Mutex
+	counts map[string]int
+}
+
+var _ service.MessageBus = (*recordingBus)(nil)
+
+// Subscribe implements the [service.MessageBus] interface.
+func (b *recordingBus) Subscribe(ctx context.Context, topic string, h service.EventHandler) error {
+	return b.MessageBus.Subscribe(ctx, topic, func(ctx context.Context, msg []byte) { //nolint:wrapcheck // transparent bus
+		b.record(topic, msg)
+		h(ctx, msg)
+	})
+}
+
+// record appends the message to the fixtures of the topic.
+func (b *recordingBus) record(topic string, msg []byte) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.cfg.Limit > 0 && b.counts[topic] >= b.cfg.Limit {
+		return
+	}
+
+	f := Fixture{Topic: topic, RecordedAt: time.Now().UTC()}
+	if json.Valid(msg) {
+		f.Payload = msg
+	} else {
+		f.Data = msg
+	}
+	line, err := json.Marshal(f)
+	if err != nil {
+		return
+	}
+	if err := appendLine(filepath.Join(b.cfg.Dir, fileName(topic)), line); err != nil {
+		slog.Warn("failed to record message",
+			slog.String("topic", topic),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	b.counts[topic]++
+}
+
+// appendLine appends the line to the file.
+func appendLine(path string, line []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gosec // dev data
+		return err //nolint:wrapcheck // logged by the caller
+	}
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err //nolint:wrapcheck // logged by the caller
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()  //nolint:errcheck,gosec // the write error is reported
+		return err //nolint:wrapcheck // logged by the caller
+	}
+	return f.Close() //nolint:wrapcheck // logged by the caller
+}
+
+// fileName returns the name of the fixture file of the topic.
+func fileName(topic string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '/' || r == '\\' || r == ':' {
+			return '_'
+		}
+		return r
+	}, topic) + ".ndjson"
+}
+
+// maxLine is the maximum size of a recorded message.
+const maxLine = 16 << 20
@@ -0,0 +1,138 @@
+// Package flight deduplicates concurrent identical calls, e.g. the cache misses
+// of a popular key, so that they collapse into a single upstream call whose
+// result is shared by all the callers:
+//
+//	settings, err := p.flight.Do(ctx, tenant, func(ctx context.Context) (*Settings, error) {
+//		return p.provider.Settings(ctx, tenant)
+//	})
+//
+// Unlike golang.org/x/sync/singleflight, the calls are context-aware: a caller
+// whose context is done stops waiting without affecting the others, and the
+// upstream call is cancelled once no caller waits for it anymore.
+package flight
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Group deduplicates the calls for the same key. The zero value is not usable,
+// create groups with [NewGroup].
+type Group[K comparable, V any] struct {
+	name string
+
+	mu    sync.Mutex
+	calls map[K]*call[V]
+}
+
+// NewGroup creates a new [Group]. The name of the group is used for labeling
+// the metrics.
+func NewGroup[K comparable, V any](name string) *Group[K, V] {
+	return &Group[K, V]{name: name, calls: make(map[K]*call[V])}
+}
+
+// Do calls fn, unless a call for the same key is in flight already, in which
+// case it waits for that call and returns its result. The context passed to
+// fn carries the values of the context of the first caller, but is cancelled
+// only once all the callers stopped waiting. Do returns ctx.Err() in case ctx
+// is done before the call returns. This function returns
+// [service.ErrUnexpected] in case fn panics.
+func (g *Group[K, V]) Do(
+	ctx context.Context,
+	key K,
+	fn func(ctx context.Context) (V, error),
+) (V, error) {
+	g.mu.Lock()
+	c, ok := g.calls[key]
+	if ok {
+		c.waiters++
+		g.mu.Unlock()
+		dedupedCalls.Inc(g.name)
+	} else {
+		callCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+		c = &call[V]{done: make(chan struct{}), waiters: 1, cancel: cancel}
+		g.calls[key] = c
+		g.mu.Unlock()
+		calls.Inc(g.name)
+		go g.run(callCtx, key, c, fn)
+	}
+
+	select {
+	case <-c.done:
+		return c.val, c.err
+	case <-ctx.Done():
+		g.mu.Lock()
+		if c.waiters--; c.waiters == 0 {
+			// Nobody waits for the call anymore. The next caller
+			// starts a new one instead of joining a cancelled one.
+			c.cancel()
+			if g.calls[key] == c {
+				delete(g.calls, key)
+			}
+		}
+		g.mu.Unlock()
+		var zero V
+		return zero, ctx.Err() //nolint:wrapcheck // context errors are not wrapped
+	}
+}
+
+// Forget makes the next call for the key start a new call, instead of joining
+// the one in flight, e.g. after the value for the key changed.
+func (g *Group[K, V]) Forget(key K) {
+	g.mu.Lock()
+	delete(g.calls, key)
+	g.mu.Unlock()
+}
+
+// run runs the call and publishes its result.
+func (g *Group[K, V]) run(
+	ctx context.Context,
+	key K,
+	c *call[V],
+	fn func(ctx context.Context) (V, error),
+) {
+	defer func() {
+		if r := recover(); r != nil {
+			c.err = fmt.Errorf("%w: call panicked: %v", service.ErrUnexpected, r)
+		}
+		g.mu.Lock()
+		if g.calls[key] == c {
+			delete(g.calls, key)
+		}
+		g.mu.Unlock()
+		c.cancel()
+		close(c.done)
+	}()
+	c.val, c.err = fn(ctx)
+}
+
+// call is a call in flight. The result is written before done is closed.
+type call[V any] struct {
+	done    chan struct{}
+	val     V
+	err     error
+	waiters int // guarded by the mutex of the group
+	cancel  context.CancelFunc
+}
+
+var (
+	// calls counts the upstream calls made by the groups.
+	calls = metrics.NewCounter(
+		"flight_calls_total",
+		"Number of upstream calls made by the group.",
+		"group",
+	)
+
+	// dedupedCalls counts the callers that joined a call in flight
+	// instead of making their own.
+	dedupedCalls = metrics.NewCounter(
+		"flight_deduplicated_calls_total",
+		"Number of calls that joined an upstream call in flight.",
+		"group",
+	)
+)
@@ -0,0 +1,199 @@
+package flight
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+func TestGroupDo(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name    string
+		fn      func(ctx context.Context) (int, error)
+		want    int
+		wantErr error
+	}{
+		{
+			name: "value",
+			fn:   func(context.Context) (int, error) { return 42, nil },
+			want: 42,
+		},
+		{
+			name:    "error",
+			fn:      func(context.Context) (int, error) { return 0, errFailed },
+			wantErr: errFailed,
+		},
+		{
+			name:    "panic",
+			fn:      func(context.Context) (int, error) { panic("boom") },
+			wantErr: service.ErrUnexpected,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGroup[string, int]("test")
+			got, err := g.Do(context.Background(), "key", tt.fn)
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("got %d, want %d", got, tt.want)
+			}
+			if n := len(g.calls); n != 0 {
+				t.Errorf("got %d calls in flight after the call, want 0", n)
+			}
+		})
+	}
+}
+
+func TestGroupDoCollapses(t *testing.T) {
+	const callers = 20
+	tests := []struct {
+		name      string
+		keys      int
+		wantCalls int32
+	}{
+		{"same key", 1, 1},
+		{"distinct keys", callers, callers},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			g := NewGroup[int, int]("test")
+			var calls atomic.Int32
+			release := make(chan struct{})
+			fn := func(key int) func(context.Context) (int, error) {
+				return func(context.Context) (int, error) {
+					calls.Add(1)
+					<-release
+					return key, nil
+				}
+			}
+
+			var wg sync.WaitGroup
+			for i := 0; i < callers; i++ {
+				wg.Add(1)
+				go func(key int) {
+					defer wg.Done()
+					got, err := g.Do(context.Background(), key, fn(key))
+					if err != nil || got != key {
+						t.Errorf("got %d, %v, want %d", got, err, key)
+					}
+				}(i % tt.keys)
+			}
+			waitFor(t, func() bool { return waiters(g) == callers })
+			close(release)
+			wg.Wait()
+			if got := calls.Load(); got != tt.wantCalls {
+				t.Errorf("got %d upstream calls, want %d", got, tt.wantCalls)
+			}
+		})
+	}
+}
+
+func TestGroupDoCancel(t *testing.T) {
+	g := NewGroup[string, int]("test")
+	release := make(chan struct{})
+	upstream := make(chan context.Context, 2)
+	fn := func(ctx context.Context) (int, error) {
+		upstream <- ctx
+		select {
+		case <-release:
+			return 1, nil
+		case <-ctx.Done():
+			return 0, ctx.Err()
+		}
+	}
+
+	// A caller stopping to wait does not affect the other callers.
+	type ctxKey struct{}
+	first, cancelFirst := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "first"))
+	second, cancelSecond := context.WithCancel(context.Background())
+	defer cancelSecond()
+	errs := make(chan error, 2)
+	go func() {
+		_, err := g.Do(first, "key", fn)
+		errs <- err
+	}()
+	callCtx := <-upstream
+	if got := callCtx.Value(ctxKey{}); got != "first" {
+		t.Errorf("got value %v in the upstream context, want the value of the first caller", got)
+	}
+	go func() {
+		_, err := g.Do(second, "key", fn)
+		errs <- err
+	}()
+	waitFor(t, func() bool { return waiters(g) == 2 })
+	cancelFirst()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v for the cancelled caller, want %v", err, context.Canceled)
+	}
+	if callCtx.Err() != nil {
+		t.Fatal("got the upstream call cancelled while a caller waits")
+	}
+
+	// Once no caller waits, the upstream call is cancelled and the next
+	// caller starts a new one.
+	cancelSecond()
+	if err := <-errs; !errors.Is(err, context.Canceled) {
+		t.Errorf("got error %v for the cancelled caller, want %v", err, context.Canceled)
+	}
+	select {
+	case <-callCtx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("got the upstream call running without callers")
+	}
+	close(release)
+	got, err := g.Do(context.Background(), "key", fn)
+	if err != nil || got != 1 {
+		t.Errorf("got %d, %v from a new call, want 1", got, err)
+	}
+}
+
+func TestGroupForget(t *testing.T) {
+	g := NewGroup[string, int]("test")
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	go g.Do(context.Background(), "key", func(context.Context) (int, error) { //nolint:errcheck // the stale call
+		started <- struct{}{}
+		<-release
+		return 1, nil
+	})
+	<-started
+	g.Forget("key")
+	got, err := g.Do(context.Background(), "key", func(context.Context) (int, error) { return 2, nil })
+	if err != nil || got != 2 {
+		t.Errorf("got %d, %v after forgetting the key, want 2", got, err)
+	}
+	close(release)
+}
+
+// waiters returns the number of callers waiting for the calls of the group.
+func waiters[K comparable, V any](g *Group[K, V]) int {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	n := 0
+	for _, c := range g.calls {
+		n += c.waiters
+	}
+	return n
+}
+
+// waitFor waits until cond holds.
+func waitFor(t *testing.T, cond func() bool) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !cond() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the condition")
+		}
+		time.Sleep(time.Millisecond)
+	}
+}
@@ -0,0 +1,339 @@
+package graphql
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Complexity estimates the cost of executing the operation of the query: every
+// selected field costs 1, and the fields selected below a list field are
+// multiplied by the page size requested with a "first", "last", or "limit"
+// argument. Fragments count for every spread. If the query cannot be parsed,
+// the complexity is 0 and the error is left to the executor.
+func Complexity(query, operationName string, variables map[string]any) int {
+	_, n := analyze(query, operationName, variables)
+	return n
+}
+
+// analyze returns the kind and the complexity of the operation of the query.
+// The kind is empty if the query cannot be parsed.
+func analyze(query, operationName string, variables map[string]any) (string, int) {
+	p := &parser{tokens: tokenize(query), variables: variables}
+	doc, ok := p.document()
+	if !ok {
+		return "", 0
+	}
+	for i := range doc.operations {
+		op := &doc.operations[i]
+		if operationName == "" || op.name == operationName {
+			return op.kind, doc.complexity(&op.set, make(map[string]bool))
+		}
+	}
+	return "", 0
+}
+
+// document is a parsed query document.
+type document struct {
+	operations []operation
+	fragments  map[string]*selectionSet
+}
+
+// operation is an operation of a document.
+type operation struct {
+	kind string // query, mutation, or subscription
+	name string
+	set  selectionSet
+}
+
+// selectionSet is the selected fields and fragments of a selection.
+type selectionSet struct {
+	fields  []field
+	spreads []string
+	inline  []selectionSet
+}
+
+// field is a selected field.
+type field struct {
+	multiplier int
+	set        *selectionSet
+}
+
+// complexity returns the complexity of the selection set. The visiting
+// fragments guard against fragment cycles, which are rejected by the
+// validation anyway.
+func (d *document) complexity(s *selectionSet, visiting map[string]bool) int {
+	n := 0
+	for _, f := range s.fields {
+		n++
+		if f.set != nil {
+			n += f.multiplier * d.complexity(f.set, visiting)
+		}
+	}
+	for _, name := range s.spreads {
+		frag, ok := d.fragments[name]
+		if !ok || visiting[name] {
+			continue
+		}
+		visiting[name] = true
+		n += d.complexity(frag, visiting)
+		delete(visiting, name)
+	}
+	for i := range s.inline {
+		n += d.complexity(&s.inline[i], visiting)
+	}
+	return n
+}
+
+// parser parses the parts of a query document relevant for the complexity.
+type parser struct {
+	tokens    []string
+	pos       int
+	variables map[string]any
+}
+
+// document parses the whole document.
+func (p *parser) document() (*document, bool) {
+	doc := &document{fragments: make(map[string]*selectionSet)}
+	for p.pos < len(p.tokens) {
+		switch tok := p.peek(); tok {
+		case "{":
+			set, ok := p.selectionSet()
+			if !ok {
+				return nil, false
+			}
+			doc.operations = append(doc.operations, operation{kind: "query", set: *set})
+		case "fragment":
+			p.next()
+			name := p.next()
+			if p.next() != "on" {
+				return nil, false
+			}
+			p.next() // type condition
+			p.directives()
+			set, ok := p.selectionSet()
+			if !ok {
+				return nil, false
+			}
+			doc.fragments[name] = set
+		case "query", "mutation", "subscription":
+			p.next()
+			op := operation{kind: tok}
+			if isName(p.peek()) {
+				op.name = p.next()
+			}
+			if p.peek() == "(" {
+				p.skipGroup("(", ")")
+			}
+			p.directives()
+			set, ok := p.selectionSet()
+			if !ok {
+				return nil, false
+			}
+			op.set = *set
+			doc.operations = append(doc.operations, op)
+		default:
+			return nil, false
+		}
+	}
+	return doc, true
+}
+
+// selectionSet parses a selection set including its braces.
+func (p *parser) selectionSet() (*selectionSet, bool) {
+	if p.next() != "{" {
+		return nil, false
+	}
+	set := &selectionSet{}
+	for {
+		switch tok := p.peek(); {
+		case tok == "}":
+			p.next()
+			return set, true
+		case tok == "":
+			return nil, false
+		case tok == "...":
+			p.next()
+			if isName(p.peek()) && p.peek() != "on" {
+				set.spreads = append(set.spreads, p.next())
+				p.directives()
+				continue
+			}
+			if p.peek() == "on" {
+				p.next()
+				p.next()
+			}
+			p.directives()
+			inline, ok := p.selectionSet()
+			if !ok {
+				return nil, false
+			}
+			set.inline = append(set.inline, *inline)
+		case isName(tok):
+			p.next()
+			if p.peek() == ":" { // alias
+				p.next()
+				p.next()
+			}
+			f := field{multiplier: 1}
+			if p.peek() == "(" {
+				f.multiplier = p.arguments()
+			}
+			p.directives()
+			if p.peek() == "{" {
+				child, ok := p.selectionSet()
+				if !ok {
+					return nil, false
+				}
+				f.set = child
+			}
+			set.fields = append(set.fields, f)
+		default:
+			return nil, false
+		}
+	}
+}
+
+// arguments parses the arguments of a field and returns the requested page
+// size, or 1.
+func (p *parser) arguments() int {
+	multiplier := 1
+	p.next() // (
+	for depth := 1; depth > 0 && p.pos < len(p.tokens); {
+		tok := p.next()
+		switch tok {
+		case "(", "[", "{":
+			depth++
+		case ")", "]", "}":
+			depth--
+		default:
+			if depth != 1 || !pageArgs[tok] || p.peek() != ":" {
+				continue
+			}
+			p.next()
+			if n := p.intValue(p.next()); n > multiplier {
+				multiplier = n
+			}
+		}
+	}
+	return multiplier
+}
+
+// intValue returns the value of an int literal or variable, or 0.
+func (p *parser) intValue(tok string) int {
+	if strings.HasPrefix(tok, "$") {
+		switch v := p.variables[tok[1:]].(type) {
+		case float64:
+			return int(v)
+		case int:
+			return v
+		default:
+			return 0
+		}
+	}
+	n, _ := strconv.Atoi(tok) //nolint:errcheck // invalid counts as 0
+	return n
+}
+
+// directives skips the directives at the current position.
+func (p *parser) directives() {
+	for p.peek() == "@" {
+		p.next()
+		p.next()
+		if p.peek() == "(" {
+			p.skipGroup("(", ")")
+		}
+	}
+}
+
+// skipGroup skips the balanced group starting at the current position.
+func (p *parser) skipGroup(open, closing string) {
+	for depth := 0; p.pos < len(p.tokens); {
+		switch p.next() {
+		case open:
+			depth++
+		case closing:
+			depth--
+		}
+		if depth == 0 {
+			return
+		}
+	}
+}
+
+func (p *parser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *parser) next() string {
+	tok := p.peek()
+	p.pos++
+	return tok
+}
+
+// tokenize splits the query into tokens. Strings are reduced to a placeholder
+// token, comments and insignificant characters are dropped. Variables are
+// kept with their "$" prefix.
+func tokenize(q string) []string {
+	var tokens []string
+	for i := 0; i < len(q); {
+		c := q[i]
+		switch {
+		case c == '#':
+			for i < len(q) && q[i] != '\n' {
+				i++
+			}
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',':
+			i++
+		case strings.HasPrefix(q[i:], `"""`):
+			end := strings.Index(q[i+3:], `"""`)
+			if end < 0 {
+				return tokens
+			}
+			tokens = append(tokens, `""`)
+			i += end + 6
+		case c == '"':
+			i++
+			for i < len(q) && q[i] != '"' {
+				if q[i] == '\\' {
+					i++
+				}
+				i++
+			}
+			tokens = append(tokens, `""`)
+			i++
+		case strings.HasPrefix(q[i:], "..."):
+			tokens = append(tokens, "...")
+			i += 3
+		case c == '$' || c == '-' || c == '_' || isAlnum(c):
+			j := i + 1
+			for j < len(q) && (q[j] == '_' || q[j] == '.' || isAlnum(q[j])) {
+				j++
+			}
+			tokens = append(tokens, q[i:j])
+			i = j
+		default:
+			tokens = append(tokens, q[i:i+1])
+			i++
+		}
+	}
+	return tokens
+}
+
+// isName reports whether the token is a name.
+func isName(tok string) bool {
+	if tok == "" {
+		return false
+	}
+	c := tok[0]
+	return c == '_' || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z')
+}
+
+func isAlnum(c byte) bool {
+	return (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || (c >= '0' && c <= '9')
+}
+
+// pageArgs are the arguments requesting a page size.
+var pageArgs = map[string]bool{"first": true, "last": true, "limit": true}
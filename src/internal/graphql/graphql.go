@@ -0,0 +1,351 @@
+// Package graphql serves a graphql api on the rest listener of the service.
+//
+// Services serving graphql implement [Service], and mount the handler on the
+// mux returned by their REST method:
+//
+//	func (s *ServiceName) GraphQL() (string, any) { return schema, &resolver{s} }
+//
+//	mux := http.NewServeMux()
+//	if err := graphql.Mount(mux, s, s.cfg.GraphQL); err != nil { ... }
+//
+// The handler is a plain [http.Handler], thus the middleware of the rest api,
+// e.g. auth.Middleware and quota.Middleware, applies to it like to any other
+// route when the mux is wrapped. Resolvers read the principal of the caller
+// from the context as usual. Queries are limited in depth and complexity, see
+// [Complexity], and clients may send automatic persisted queries, i.e. the
+// sha256 hash of a query in place of the query.
+package graphql
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	gql "github.com/graph-gophers/graphql-go"
+	gqlerrors "github.com/graph-gophers/graphql-go/errors"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Config encapsulates the configuration of the graphql api.
+type Config struct {
+	// Path is the route on which the api is mounted.
+	Path string `env:"GRAPHQL_PATH" envDefault:"/graphql"`
+
+	// MaxDepth is the maximum nesting of selections in a query.
+	// Zero means no limit.
+	MaxDepth int `env:"GRAPHQL_MAX_DEPTH" envDefault:"10"`
+
+	// MaxComplexity is the maximum complexity of an operation,
+	// see [Complexity]. Zero means no limit.
+	MaxComplexity int `env:"GRAPHQL_MAX_COMPLEXITY" envDefault:"1000"`
+
+	// MaxParallelism is the maximum number of resolvers of a
+	// single operation running concurrently.
+	MaxParallelism int `env:"GRAPHQL_MAX_PARALLELISM" envDefault:"10"`
+
+	// MaxBodyBytes is the maximum size of a request body.
+	MaxBodyBytes int64 `env:"GRAPHQL_MAX_BODY_BYTES" envDefault:"1048576"`
+
+	// Introspection enables the introspection queries used by
+	// tools like graphiql.
+	Introspection bool `env:"GRAPHQL_INTROSPECTION" envDefault:"true"`
+
+	// PersistedQueriesOnly rejects all queries that were not
+	// registered with [Handler.Register]. Clients then send the
+	// hashes of the queries only.
+	PersistedQueriesOnly bool `env:"GRAPHQL_PERSISTED_QUERIES_ONLY"`
+
+	// PersistedQueriesCacheSize is the number of automatic
+	// persisted queries kept in memory. Registered queries do
+	// not count against the limit.
+	PersistedQueriesCacheSize int `env:"GRAPHQL_PERSISTED_QUERIES_CACHE_SIZE" envDefault:"1000"`
+}
+
+// Service is implemented by services serving a graphql api. GraphQL returns
+// the schema of the api in the graphql schema language, and the root resolver,
+// see github.com/graph-gophers/graphql-go for how resolvers map to the schema.
+type Service interface {
+	GraphQL() (schema string, resolver any)
+}
+
+// Handler serves graphql requests over http, as POST requests with a json body
+// or as GET requests with the query in the url. GET requests cannot run
+// mutations.
+type Handler struct {
+	cfg    Config
+	schema *gql.Schema
+
+	// registered holds the queries registered by the service,
+	// persisted the queries registered by clients.
+	mu         sync.RWMutex
+	registered map[string]string
+	persisted  map[string]string
+	order      []string
+}
+
+var _ http.Handler = (*Handler)(nil)
+
+// NewHandler creates a new [Handler] for the schema and its root resolver. This
+// function returns [service.ErrBadRequest] in case the schema is invalid or does
+// not match the resolver.
+func NewHandler(cfg Config, schema string, resolver any) (*Handler, error) {
+	opts := []gql.SchemaOpt{
+		gql.MaxParallelism(cfg.MaxParallelism),
+		gql.Logger(panicLogger{}),
+		gql.UseFieldResolvers(),
+	}
+	if cfg.MaxDepth > 0 {
+		opts = append(opts, gql.MaxDepth(cfg.MaxDepth))
+	}
+	if !cfg.Introspection {
+		opts = append(opts, gql.DisableIntrospection())
+	}
+	s, err := gql.ParseSchema(schema, resolver, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse graphql schema: %v", service.ErrBadRequest, err)
+	}
+	return &Handler{
+		cfg:        cfg,
+		schema:     s,
+		registered: make(map[string]string),
+		persisted:  make(map[string]string),
+	}, nil
+}
+
+// Mount mounts the handler for the graphql api of the service on cfg.Path of
+// the mux. It does nothing if s does not implement [Service]. This function
+// returns [service.ErrBadRequest] in case the schema of the service is
+// invalid.
+func Mount(mux *http.ServeMux, s any, cfg Config) error {
+	gs, ok := s.(Service)
+	if !ok {
+		return nil
+	}
+	schema, resolver := gs.GraphQL()
+	h, err := NewHandler(cfg, schema, resolver)
+	if err != nil {
+		return err
+	}
+	mux.Handle(cfg.Path, h)
+	return nil
+}
+
+// Register registers a persisted query and returns its hash, which clients send
+// in place of the query. Registered queries are never evicted. This function
+// returns [service.ErrBadRequest] in case the query is invalid.
+func (h *Handler) Register(query string) (string, error) {
+	if errs := h.schema.Validate(query); len(errs) > 0 {
+		return "", fmt.Errorf("%w: invalid persisted query: %v", service.ErrBadRequest, errs[0])
+	}
+	hash := Hash(query)
+	h.mu.Lock()
+	h.registered[hash] = query
+	h.mu.Unlock()
+	return hash, nil
+}
+
+// Hash returns the hash of a persisted query, i.e. the hex encoded sha256 hash.
+func Hash(query string) string {
+	sum := sha256.Sum256([]byte(query))
+	return hex.EncodeToString(sum[:])
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	start := time.Now()
+	req, err := h.decode(w, r)
+	if err != nil {
+		service.HTTPError(r.Context(), w, err)
+		return
+	}
+	op := req.OperationName
+	if op == "" {
+		op = "anonymous"
+	}
+
+	if qerr := h.resolve(req); qerr != nil {
+		operationsTotal.Inc(op, "rejected")
+		writeResponse(w, http.StatusOK, &gql.Response{Errors: []*gqlerrors.QueryError{qerr}})
+		return
+	}
+	kind, complexity := analyze(req.Query, req.OperationName, req.Variables)
+	if r.Method == http.MethodGet && kind != "" && kind != "query" {
+		operationsTotal.Inc(op, "rejected")
+		w.Header().Set("Allow", http.MethodPost)
+		writeResponse(w, http.StatusMethodNotAllowed, &gql.Response{Errors: []*gqlerrors.QueryError{
+			queryError("only queries can be sent with GET requests", "METHOD_NOT_ALLOWED"),
+		}})
+		return
+	}
+	if h.cfg.MaxComplexity > 0 && complexity > h.cfg.MaxComplexity {
+		operationsTotal.Inc(op, "rejected")
+		writeResponse(w, http.StatusOK, &gql.Response{Errors: []*gqlerrors.QueryError{
+			queryError(
+				fmt.Sprintf("query complexity %d exceeds the limit of %d", complexity, h.cfg.MaxComplexity),
+				"COMPLEXITY_LIMIT_EXCEEDED",
+			),
+		}})
+		return
+	}
+
+	res := h.schema.Exec(r.Context(), req.Query, req.OperationName, req.Variables)
+	outcome := "ok"
+	if len(res.Errors) > 0 {
+		outcome = "error"
+		slog.DebugContext(r.Context(), "graphql operation failed",
+			slog.String("operation", op),
+			slog.String("error", res.Errors[0].Error()),
+		)
+	}
+	operationsTotal.Inc(op, outcome)
+	operationDuration.ObserveSince(start, op)
+	writeResponse(w, http.StatusOK, res)
+}
+
+// request is a graphql request.
+type request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+	Extensions    struct {
+		PersistedQuery *struct {
+			Version    int    `json:"version"`
+			SHA256Hash string `json:"sha256Hash"`
+		} `json:"persistedQuery"`
+	} `json:"extensions"`
+}
+
+// decode decodes the graphql request from the body of POST requests or from the
+// url of GET requests. This function returns [service.ErrBadRequest] in case
+// the request is malformed, and [service.ErrNotAllowed] in case of other
+// methods.
+func (h *Handler) decode(w http.ResponseWriter, r *http.Request) (*request, error) {
+	var req request
+	switch r.Method {
+	case http.MethodPost:
+		body := http.MaxBytesReader(w, r.Body, h.cfg.MaxBodyBytes)
+		if err := json.NewDecoder(body).Decode(&req); err != nil {
+			return nil, fmt.Errorf("%w: decode graphql request: %v", service.ErrBadRequest, err)
+		}
+	case http.MethodGet:
+		q := r.URL.Query()
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if v := q.Get("variables"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Variables); err != nil {
+				return nil, fmt.Errorf("%w: decode graphql variables: %v", service.ErrBadRequest, err)
+			}
+		}
+		if v := q.Get("extensions"); v != "" {
+			if err := json.Unmarshal([]byte(v), &req.Extensions); err != nil {
+				return nil, fmt.Errorf("%w: decode graphql extensions: %v", service.ErrBadRequest, err)
+			}
+		}
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		return nil, fmt.Errorf("%w: method %s", service.ErrNotAllowed, r.Method)
+	}
+	return &req, nil
+}
+
+// resolve replaces the hash of a persisted query with the query, or persists the
+// query if the request carries both. Requests without a hash pass unchanged,
+// unless only persisted queries are allowed.
+func (h *Handler) resolve(req *request) *gqlerrors.QueryError {
+	pq := req.Extensions.PersistedQuery
+	if pq == nil {
+		if h.cfg.PersistedQueriesOnly {
+			return queryError("PersistedQueryNotSupported", "PERSISTED_QUERY_REQUIRED")
+		}
+		return nil
+	}
+
+	h.mu.RLock()
+	query, ok := h.registered[pq.SHA256Hash]
+	if !ok {
+		query, ok = h.persisted[pq.SHA256Hash]
+	}
+	h.mu.RUnlock()
+
+	switch {
+	case ok:
+		req.Query = query
+		return nil
+	case req.Query == "":
+		return queryError("PersistedQueryNotFound", "PERSISTED_QUERY_NOT_FOUND")
+	case h.cfg.PersistedQueriesOnly:
+		return queryError("PersistedQueryNotSupported", "PERSISTED_QUERY_NOT_SUPPORTED")
+	case Hash(req.Query) != pq.SHA256Hash:
+		return queryError("provided sha does not match query", "INVALID_PERSISTED_QUERY")
+	}
+	h.persist(pq.SHA256Hash, req.Query)
+	return nil
+}
+
+// persist stores an automatic persisted query, evicting the oldest query once
+// the cache is full.
+func (h *Handler) persist(hash, query string) {
+	if h.cfg.PersistedQueriesCacheSize <= 0 {
+		return
+	}
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.persisted[hash]; ok {
+		return
+	}
+	if len(h.order) >= h.cfg.PersistedQueriesCacheSize {
+		delete(h.persisted, h.order[0])
+		h.order = h.order[1:]
+	}
+	h.persisted[hash] = query
+	h.order = append(h.order, hash)
+}
+
+// queryError returns a graphql error with the given code as extension.
+func queryError(msg, code string) *gqlerrors.QueryError {
+	return &gqlerrors.QueryError{Message: msg, Extensions: map[string]any{"code": code}}
+}
+
+// writeResponse writes the graphql response as json.
+func writeResponse(w http.ResponseWriter, status int, res *gql.Response) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(res) //nolint:errcheck,errchkjson // the client is gone
+}
+
+// panicLogger logs the panics of resolvers. The panic is reported to the
+// client as a graphql error.
+type panicLogger struct{}
+
+// LogPanic implements the log.Logger interface of graphql-go.
+func (panicLogger) LogPanic(ctx context.Context, value any) {
+	slog.ErrorContext(ctx, "graphql resolver panicked",
+		slog.String("error", fmt.Sprint(value)),
+		slog.String("stack", string(debug.Stack())),
+	)
+}
+
+// The operation names are chosen by the clients. Services exposed to
+// untrusted clients should allow persisted queries only, which bounds the
+// number of label values.
+var (
+	operationsTotal = metrics.NewCounter(
+		"graphql_operations_total",
+		"Number of graphql operations by outcome.",
+		"operation", "outcome",
+	)
+	operationDuration = metrics.NewHistogram(
+		"graphql_operation_duration_seconds",
+		"Duration of graphql operations in seconds.",
+		nil,
+		"operation",
+	)
+)
@@ -0,0 +1,188 @@
+// Package health keeps track of the health of the service dependencies. The
+// components of the service register named checks, e.g. a database ping, and
+// the service is considered ready only if all of the checks pass.
+//
+// Every service has a registry of readiness checks of its own, which is
+// carried by the context passed to its Init, see [WithRegistry], thus the
+// components register their checks with the context they are created with,
+// see [Register]. The registry is served on /readyz, and fails once the
+// service shuts down, see [Registry.Drain]. Outside of a service the checks
+// go to the [Default] registry. The liveness checks are registered in the
+// [Liveness] registry, served on /healthz; they should only fail if the
+// process is broken beyond repair, e.g. deadlocked, as the process is
+// restarted once they fail. Both are served by the admin server.
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+// Default is the registry of the readiness checks used by the package level
+// functions for contexts carrying no registry.
+var Default = NewRegistry()
+
+// Liveness is the registry of the liveness checks. It has no checks by
+// default, thus the service is alive as long as it serves requests.
+var Liveness = NewRegistry()
+
+// Checker checks the health of a single dependency. It returns a non-nil error
+// if the dependency is unhealthy.
+type Checker func(ctx context.Context) error
+
+// Pinger is implemented by clients that can verify their connection to a
+// remote server, e.g. [database/sql.DB].
+type Pinger interface {
+	PingContext(ctx context.Context) error
+}
+
+// Ping returns a [Checker] that pings the given client.
+func Ping(p Pinger) Checker {
+	return p.PingContext
+}
+
+// Registry holds a set of named health checks.
+type Registry struct {
+	mu     sync.RWMutex
+	checks map[string]Checker
+
+	// timeout bounds the duration of a single check.
+	timeout time.Duration
+
+	// draining fails every check, see [Registry.Drain].
+	draining atomic.Bool
+}
+
+// NewRegistry creates a new empty [Registry].
+func NewRegistry() *Registry {
+	return &Registry{
+		checks:  make(map[string]Checker),
+		timeout: defaultTimeout,
+	}
+}
+
+// Register adds a named check to the registry. Registering a check with the
+// same name again replaces the previous check.
+func (r *Registry) Register(name string, c Checker) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checks[name] = c
+}
+
+// Unregister removes the named check from the registry.
+func (r *Registry) Unregister(name string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.checks, name)
+}
+
+// Drain makes the registry fail from now on, regardless of the checks, e.g.
+// once the service shuts down, so that it receives no new requests while it
+// finishes the ongoing ones.
+func (r *Registry) Drain() { r.draining.Store(true) }
+
+// Check runs all registered checks concurrently and returns the result of each
+// check by name. A nil result means that the check passed.
+func (r *Registry) Check(ctx context.Context) map[string]error {
+	r.mu.RLock()
+	checks := make(map[string]Checker, len(r.checks))
+	for name, c := range r.checks {
+		checks[name] = c
+	}
+	r.mu.RUnlock()
+
+	var (
+		mu  sync.Mutex
+		wg  sync.WaitGroup
+		res = make(map[string]error, len(checks))
+	)
+	for n, c := range checks {
+		name, check := n, c
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			ctx, cancel := context.WithTimeout(ctx, r.timeout)
+			defer cancel()
+			err := check(ctx)
+
+			mu.Lock()
+			res[name] = err
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if r.draining.Load() {
+		res[drainingCheckName] = errors.New("the service is shutting down")
+	}
+	return res
+}
+
+// ServeHTTP implements the [http.Handler] interface. It runs all checks and
+// responds with 200 if all of them pass, and with 503 otherwise. The body of
+// the response reports the result of every check.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	res := r.Check(req.Context())
+	status, report := http.StatusOK, make(map[string]string, len(res))
+	for name, err := range res {
+		report[name] = "ok"
+		if err != nil {
+			status = http.StatusServiceUnavailable
+			report[name] = err.Error()
+		}
+	}
+	writeReport(w, status, report)
+}
+
+// WithRegistry returns a copy of ctx carrying the readiness registry of the
+// service.
+func WithRegistry(ctx context.Context, r *Registry) context.Context {
+	return registryKey.With(ctx, r)
+}
+
+// RegistryFrom returns the readiness registry carried by ctx. Returns false if
+// ctx carries none.
+func RegistryFrom(ctx context.Context) (*Registry, bool) {
+	return registryKey.From(ctx)
+}
+
+// Of returns the readiness registry carried by ctx, or [Default] if none.
+func Of(ctx context.Context) *Registry {
+	if r, ok := RegistryFrom(ctx); ok {
+		return r
+	}
+	return Default
+}
+
+// Register adds a named check to the readiness registry of ctx, see [Of].
+func Register(ctx context.Context, name string, c Checker) { Of(ctx).Register(name, c) }
+
+// Unregister removes the named check from the readiness registry of ctx, see
+// [Of].
+func Unregister(ctx context.Context, name string) { Of(ctx).Unregister(name) }
+
+// writeReport writes the result of the checks as a json object.
+func writeReport(w http.ResponseWriter, status int, report map[string]string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(struct { //nolint:errcheck,errchkjson // best effort
+		Checks map[string]string `json:"checks"`
+	}{report})
+}
+
+// registryKey is the context key of the readiness registry of the service.
+var registryKey = reqctx.NewKey[*Registry]("health_registry")
+
+// drainingCheckName is the name of the failed check reported once the
+// registry drains.
+const drainingCheckName = "shutdown"
+
+// defaultTimeout is the default time limit for a single check.
+const defaultTimeout = 5 * time.Second
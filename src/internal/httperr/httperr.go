@@ -0,0 +1,96 @@
+// Package httperr writes the errors of the rest handlers to the responses.
+//
+// The service framework maps its own errors to responses with
+// [service.HTTPError], e.g. [service.ErrNotFound] to 404. The packages of the
+// service define the errors the framework has no equivalent for with [New],
+// which registers the response of the error:
+//
+//	var ErrTooManyRequests = httperr.New("too many requests", httperr.Response{
+//		Status: http.StatusTooManyRequests, // 429
+//		Log:    "client exhausted its quota",
+//	})
+//
+// The handlers write every error with [Write], thus the errors of all the
+// packages are mapped alike, whichever package the handler belongs to.
+package httperr
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"sync"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Response is the response written for an error, see [New].
+type Response struct {
+	// Status is the status code of the response.
+	Status int
+
+	// Header is added to the headers of the response, e.g. a
+	// Retry-After header.
+	Header http.Header
+
+	// Log is the message logged with the error, at Level.
+	Log   string
+	Level slog.Level
+}
+
+// New returns an error with the given message, which [Write] maps to the
+// response. It is meant for declaring the errors of a package.
+func New(msg string, resp Response) error {
+	err := errors.New(msg) //nolint:goerr113 // the errors are declared with New
+	Register(err, resp)
+	return err
+}
+
+// Register registers the response of the errors wrapping err, e.g. of an error
+// declared by another module. The errors registered first take precedence.
+func Register(err error, resp Response) {
+	mu.Lock()
+	defer mu.Unlock()
+	registered = append(registered, mapping{err: err, resp: resp})
+}
+
+// Write writes the error to the response writer: the registered errors, see
+// [New], are mapped to their responses, and the other errors like
+// [service.HTTPError] does.
+func Write(ctx context.Context, w http.ResponseWriter, err error) {
+	resp, ok := lookup(err)
+	if !ok {
+		service.HTTPError(ctx, w, err)
+		return
+	}
+	for k, vs := range resp.Header {
+		for _, v := range vs {
+			w.Header().Add(k, v)
+		}
+	}
+	http.Error(w, err.Error(), resp.Status)
+	slog.Log(ctx, resp.Level, resp.Log, slog.String("error", err.Error()))
+}
+
+// lookup returns the response of the first registered error that err wraps.
+func lookup(err error) (Response, bool) {
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, m := range registered {
+		if errors.Is(err, m.err) {
+			return m.resp, true
+		}
+	}
+	return Response{}, false
+}
+
+// mapping maps an error to its response.
+type mapping struct {
+	err  error
+	resp Response
+}
+
+var (
+	mu         sync.RWMutex
+	registered []mapping
+)
@@ -0,0 +1,41 @@
+package httperr
+
+import (
+	"errors"
+	"net/http"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+var (
+	errTeapot = New("teapot", Response{
+		Status: http.StatusTeapot,
+		Header: http.Header{"Retry-After": {"5"}},
+		Log:    "client asked a teapot",
+	})
+	errShadowed = New("shadowed", Response{Status: http.StatusGone})
+)
+
+func TestWrite(t *testing.T) {
+	// The response of the error registered first is kept.
+	Register(errShadowed, Response{Status: http.StatusConflict})
+
+	servicetest.AssertHTTPErrors(t, Write, []servicetest.HTTPErrorCase{
+		{Err: errTeapot, Want: servicetest.ErrorResponse{
+			Status: http.StatusTeapot,
+			Body:   "teapot",
+			Header: http.Header{"Retry-After": {"5"}},
+		}},
+		{Err: errShadowed, Want: servicetest.ErrorResponse{Status: http.StatusGone}},
+		{Err: errors.Join(errTeapot, service.ErrBadRequest), Want: servicetest.ErrorResponse{
+			Status: http.StatusTeapot,
+		}},
+	})
+}
+
+func TestWriteFramework(t *testing.T) {
+	servicetest.AssertHTTPErrors(t, Write, servicetest.HTTPErrors)
+}
@@ -0,0 +1,73 @@
+package i18n
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/httperr"
+)
+
+// HTTPError writes the error to the response writer like [httperr.Write],
+// with the message translated to the locale of the request. The messages are
+// looked up by the kind of the error, e.g. "error.not_found", see [Builtin];
+// the original error is still logged. Errors of other kinds, and requests that
+// were not localized, keep the message of the error.
+func HTTPError(ctx context.Context, w http.ResponseWriter, err error) {
+	l, ok := From(ctx)
+	key := errorKey(err)
+	if !ok || key == "" {
+		httperr.Write(ctx, w, err)
+		return
+	}
+	msg := l.T(key)
+	if msg == key {
+		httperr.Write(ctx, w, err)
+		return
+	}
+	service.HTTPError(ctx, &localizedWriter{ResponseWriter: w, msg: msg}, err)
+}
+
+// errorKey returns the message key of the kind of the error.
+func errorKey(err error) string {
+	for _, k := range errorKeys {
+		if errors.Is(err, k.err) {
+			return k.key
+		}
+	}
+	return ""
+}
+
+// localizedWriter replaces the body written by [service.HTTPError] with the
+// localized message, keeping its status code and headers.
+type localizedWriter struct {
+	http.ResponseWriter
+	msg     string
+	written bool
+}
+
+func (w *localizedWriter) Write([]byte) (int, error) {
+	if w.written {
+		return 0, nil
+	}
+	w.written = true
+	return w.ResponseWriter.Write([]byte(w.msg + "\n")) //nolint:wrapcheck // transparent writer
+}
+
+// errorKeys are the message keys of the errors of the framework, in the order
+// of precedence of [service.HTTPError].
+var errorKeys = []struct {
+	err error
+	key string
+}{
+	{context.Canceled, "error.canceled"},
+	{context.DeadlineExceeded, "error.timeout"},
+	{service.ErrBadRequest, "error.bad_request"},
+	{service.ErrSpaceFull, "error.space_full"},
+	{service.ErrNotAllowed, "error.not_allowed"},
+	{service.ErrNotFound, "error.not_found"},
+	{service.ErrAlreadyExists, "error.already_exists"},
+	{service.ErrUnexpected, "error.unexpected"},
+}
@@ -0,0 +1,343 @@
+// Package i18n localizes the responses of the service to the language of the
+// caller.
+//
+// The translations are kept in a [Catalog] loaded from json files, one per
+// locale, usually embedded into the binary:
+//
+//	//go:embed locales/*.json
+//	var locales embed.FS
+//
+//	catalog, err := i18n.NewCatalog(i18n.Builtin, locales)
+//
+// A file maps message keys to texts, or to plural forms selected by count,
+// see [N]. Placeholders like "{name}" are replaced by the arguments:
+//
+//	{
+//		"greeting": "Hello, {name}!",
+//		"items": {"one": "{count} item", "other": "{count} items"}
+//	}
+//
+// The http middleware negotiates the locale of every request from the
+// Accept-Language header, see [Middleware], and handlers translate with [T]
+// and [N]. Errors are written with localized messages by [HTTPError].
+package i18n
+
+import (
+	"context"
+	"embed"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+// Config encapsulates the configuration of the locale negotiation.
+type Config struct {
+	// DefaultLocale is the locale of the requests that accept
+	// none of the locales of the catalog.
+	DefaultLocale string `env:"I18N_DEFAULT_LOCALE" envDefault:"en"`
+
+	// QueryParam is the query parameter overriding the
+	// Accept-Language header, e.g. "?lang=de". Empty disables it.
+	QueryParam string `env:"I18N_QUERY_PARAM" envDefault:"lang"`
+}
+
+// Builtin holds the translations of the messages of the template itself, e.g.
+// the error messages of [HTTPError].
+//
+//go:embed locales/*.json
+var Builtin embed.FS
+
+// Catalog holds the messages of all locales.
+type Catalog struct {
+	messages map[string]map[string]message // by key by locale
+}
+
+// message is a translated message, either a text or plural forms.
+type message struct {
+	text   string
+	plural map[string]string // by plural category
+}
+
+// NewCatalog loads the messages of the json files in the root directory of the
+// file systems, or in their "locales" directory. The files are named by
+// locale, e.g. "de.json" or "pt-BR.json". Messages of later file systems
+// override those of earlier ones. This function returns
+// [service.ErrBadRequest] in case a file is malformed.
+func NewCatalog(fsyss ...fs.FS) (*Catalog, error) {
+	c := &Catalog{messages: make(map[string]map[string]message)}
+	for _, fsys := range fsyss {
+		files, err := fs.Glob(fsys, "*.json")
+		if err != nil {
+			return nil, fmt.Errorf("%w: list translations: %v", service.ErrBadRequest, err)
+		}
+		nested, _ := fs.Glob(fsys, "locales/*.json")
+		for _, f := range append(files, nested...) {
+			if err := c.load(fsys, f); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return c, nil
+}
+
+// load adds the messages of the file to the catalog.
+func (c *Catalog) load(fsys fs.FS, file string) error {
+	data, err := fs.ReadFile(fsys, file)
+	if err != nil {
+		return fmt.Errorf("%w: read translations: %v", service.ErrBadRequest, err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("%w: parse translations %s: %v", service.ErrBadRequest, file, err)
+	}
+
+	locale := normalize(strings.TrimSuffix(path.Base(file), ".json"))
+	msgs := c.messages[locale]
+	if msgs == nil {
+		msgs = make(map[string]message, len(raw))
+		c.messages[locale] = msgs
+	}
+	for key, v := range raw {
+		var m message
+		if err := json.Unmarshal(v, &m.text); err != nil {
+			if err := json.Unmarshal(v, &m.plural); err != nil || m.plural["other"] == "" {
+				return fmt.Errorf("%w: message %q of %s must be a text or plural forms with %q",
+					service.ErrBadRequest, key, file, "other")
+			}
+		}
+		msgs[key] = m
+	}
+	return nil
+}
+
+// Locales returns the locales of the catalog, sorted.
+func (c *Catalog) Locales() []string {
+	res := make([]string, 0, len(c.messages))
+	for l := range c.messages {
+		res = append(res, l)
+	}
+	sort.Strings(res)
+	return res
+}
+
+// Localizer translates the messages of a catalog to a locale.
+type Localizer struct {
+	catalog  *Catalog
+	locale   string
+	fallback string
+}
+
+// Localizer returns a [Localizer] translating to the locale. Messages missing
+// in the locale are taken from its base language, e.g. "de" for "de-AT", and
+// then from the fallback locale.
+func (c *Catalog) Localizer(locale, fallback string) *Localizer {
+	return &Localizer{catalog: c, locale: normalize(locale), fallback: normalize(fallback)}
+}
+
+// Locale returns the locale of the localizer.
+func (l *Localizer) Locale() string { return l.locale }
+
+// T returns the message with the key, with the placeholders replaced by the
+// arguments, which are alternating names and values:
+//
+//	l.T("greeting", "name", user.Name)
+//
+// Missing messages are returned as the key.
+func (l *Localizer) T(key string, args ...any) string {
+	m, _ := l.lookup(key)
+	text := m.text
+	if m.plural != nil {
+		text = m.plural["other"]
+	}
+	if text == "" {
+		return key
+	}
+	return replace(text, args)
+}
+
+// N returns the plural form of the message with the key for count, see [T].
+// The count replaces the "{count}" placeholder.
+func (l *Localizer) N(key string, count int, args ...any) string {
+	m, locale := l.lookup(key)
+	text := m.text
+	if m.plural != nil {
+		text = m.plural[pluralCategory(locale, count)]
+		if text == "" {
+			text = m.plural["other"]
+		}
+	}
+	if text == "" {
+		return key
+	}
+	return replace(text, append([]any{"count", count}, args...))
+}
+
+// lookup returns the message with the key and the locale it was found in.
+func (l *Localizer) lookup(key string) (message, string) {
+	for _, locale := range []string{l.locale, base(l.locale), l.fallback} {
+		if m, ok := l.catalog.messages[locale][key]; ok {
+			return m, locale
+		}
+	}
+	return message{}, l.locale
+}
+
+// Negotiate returns the locale of the catalog that best matches the
+// Accept-Language header, or def if none matches.
+func (c *Catalog) Negotiate(acceptLanguage, def string) string {
+	for _, tag := range parseAcceptLanguage(acceptLanguage) {
+		if tag == "*" {
+			break
+		}
+		if _, ok := c.messages[tag]; ok {
+			return tag
+		}
+		if _, ok := c.messages[base(tag)]; ok {
+			return base(tag)
+		}
+		for _, l := range c.Locales() {
+			if base(l) == base(tag) {
+				return l
+			}
+		}
+	}
+	return normalize(def)
+}
+
+// WithLocalizer returns a copy of ctx carrying the localizer, and its locale
+// for [reqctx.LocaleFrom].
+func WithLocalizer(ctx context.Context, l *Localizer) context.Context {
+	return localizerKey.With(reqctx.WithLocale(ctx, l.Locale()), l)
+}
+
+// From returns the localizer carried by ctx, see [Middleware]. Returns false if
+// the request was not localized.
+func From(ctx context.Context) (*Localizer, bool) {
+	l, ok := localizerKey.From(ctx)
+	return l, ok && l != nil
+}
+
+// T translates the message with the key to the locale of the request, see
+// [Localizer.T]. Returns the key if the request was not localized.
+func T(ctx context.Context, key string, args ...any) string {
+	if l, ok := From(ctx); ok {
+		return l.T(key, args...)
+	}
+	return key
+}
+
+// N translates the plural form of the message with the key to the locale of
+// the request, see [Localizer.N].
+func N(ctx context.Context, key string, count int, args ...any) string {
+	if l, ok := From(ctx); ok {
+		return l.N(key, count, args...)
+	}
+	return key
+}
+
+// Middleware returns an http middleware putting a [Localizer] for the
+// negotiated locale of every request into the request context, and setting
+// the Content-Language header of the response.
+func Middleware(c *Catalog, cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			accept := r.Header.Get("Accept-Language")
+			if cfg.QueryParam != "" {
+				if lang := r.URL.Query().Get(cfg.QueryParam); lang != "" {
+					accept = lang
+				}
+			}
+			l := c.Localizer(c.Negotiate(accept, cfg.DefaultLocale), cfg.DefaultLocale)
+			w.Header().Set("Content-Language", l.Locale())
+			w.Header().Add("Vary", "Accept-Language")
+			next.ServeHTTP(w, r.WithContext(WithLocalizer(r.Context(), l)))
+		})
+	}
+}
+
+// UnaryServerInterceptor returns a grpc interceptor putting a [Localizer] for
+// the locale negotiated from the "accept-language" metadata into the context.
+func UnaryServerInterceptor(c *Catalog, cfg Config) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		var accept string
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			accept = strings.Join(md.Get("accept-language"), ",")
+		}
+		l := c.Localizer(c.Negotiate(accept, cfg.DefaultLocale), cfg.DefaultLocale)
+		return handler(WithLocalizer(ctx, l), req)
+	}
+}
+
+// parseAcceptLanguage returns the normalized language tags of the header,
+// ordered by decreasing quality. Tags with quality 0 are dropped.
+func parseAcceptLanguage(header string) []string {
+	type weighted struct {
+		tag string
+		q   float64
+	}
+	var tags []weighted
+	for _, part := range strings.Split(header, ",") {
+		tag, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		q := 1.0
+		if v, ok := strings.CutPrefix(strings.TrimSpace(params), "q="); ok {
+			parsed, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				continue
+			}
+			q = parsed
+		}
+		if tag = normalize(tag); tag != "" && q > 0 {
+			tags = append(tags, weighted{tag: tag, q: q})
+		}
+	}
+	sort.SliceStable(tags, func(i, j int) bool { return tags[i].q > tags[j].q })
+	res := make([]string, len(tags))
+	for i, t := range tags {
+		res[i] = t.tag
+	}
+	return res
+}
+
+// normalize returns the canonical form of a language tag, e.g. "pt-br" for
+// "pt_BR".
+func normalize(tag string) string {
+	return strings.ToLower(strings.ReplaceAll(strings.TrimSpace(tag), "_", "-"))
+}
+
+// base returns the base language of a tag, e.g. "pt" for "pt-br".
+func base(tag string) string {
+	b, _, _ := strings.Cut(tag, "-")
+	return b
+}
+
+// replace replaces the "{name}" placeholders of the text with the values of
+// the alternating names and values of args.
+func replace(text string, args []any) string {
+	if len(args) < 2 || !strings.Contains(text, "{") {
+		return text
+	}
+	pairs := make([]string, 0, len(args))
+	for i := 0; i+1 < len(args); i += 2 {
+		pairs = append(pairs, "{"+fmt.Sprint(args[i])+"}", fmt.Sprint(args[i+1]))
+	}
+	return strings.NewReplacer(pairs...).Replace(text)
+}
+
+// localizerKey is the context key of the localizer.
+var localizerKey = reqctx.NewKey[*Localizer]("localizer")
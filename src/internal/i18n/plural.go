@@ -0,0 +1,69 @@
+package i18n
+
+// pluralCategory returns the CLDR plural category of the count in the locale:
+// "zero", "one", "two", "few", "many" or "other". Only the rules for integers
+// of the common languages are implemented, other languages use the english
+// rule. https://cldr.unicode.org/index/cldr-spec/plural-rules
+func pluralCategory(locale string, n int) string {
+	if n < 0 {
+		n = -n
+	}
+	mod10, mod100 := n%10, n%100
+	switch base(locale) {
+	case "ja", "ko", "zh", "vi", "th", "id", "ms", "tr":
+		return "other"
+
+	case "fr", "pt":
+		if n == 0 || n == 1 {
+			return "one"
+		}
+
+	case "ru", "uk", "be", "sr", "hr", "bs":
+		switch {
+		case mod10 == 1 && mod100 != 11:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+
+	case "pl":
+		switch {
+		case n == 1:
+			return "one"
+		case mod10 >= 2 && mod10 <= 4 && (mod100 < 12 || mod100 > 14):
+			return "few"
+		default:
+			return "many"
+		}
+
+	case "cs", "sk":
+		switch {
+		case n == 1:
+			return "one"
+		case n >= 2 && n <= 4:
+			return "few"
+		}
+
+	case "ar":
+		switch {
+		case n == 0:
+			return "zero"
+		case n == 1:
+			return "one"
+		case n == 2:
+			return "two"
+		case mod100 >= 3 && mod100 <= 10:
+			return "few"
+		case mod100 >= 11:
+			return "many"
+		}
+
+	default:
+		if n == 1 {
+			return "one"
+		}
+	}
+	return "other"
+}
@@ -0,0 +1,127 @@
+// Package info describes the running instance of the service: its build and,
+// inside kubernetes, the pod it runs in. The description is attached to the
+// logs and metrics of the service, see [Enrich], so that telemetry explains
+// where it comes from, and served on the admin listener, see [Handler].
+package info
+
+import (
+	"log/slog"
+	"net/http"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/eventscompass/service-template/src/internal/admin"
+	"github.com/eventscompass/service-template/src/internal/logs"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Info describes the running instance of the service.
+type Info struct {
+	Build Build `json:"build"`
+
+	// Kubernetes is nil outside of a kubernetes cluster.
+	Kubernetes *Kubernetes `json:"kubernetes,omitempty"`
+}
+
+// Build describes the binary of the service.
+type Build struct {
+	// Path is the main module path of the binary.
+	Path string `json:"path,omitempty"`
+
+	// Version is the module version, "(devel)" for local builds.
+	Version string `json:"version,omitempty"`
+
+	// Revision is the vcs revision the binary was built from.
+	Revision string `json:"revision,omitempty"`
+
+	// GoVersion is the go version used to build the binary.
+	GoVersion string `json:"go_version"`
+}
+
+// Detect describes the running instance.
+func Detect() Info {
+	return Info{Build: detectBuild(), Kubernetes: DetectKubernetes()}
+}
+
+// Attributes returns the description as resource attributes, named after the
+// OpenTelemetry semantic conventions, e.g. "k8s.pod.name".
+// https://opentelemetry.io/docs/specs/semconv/resource/k8s/
+func (i Info) Attributes() map[string]string {
+	attrs := make(map[string]string)
+	set := func(k, v string) {
+		if v != "" {
+			attrs[k] = v
+		}
+	}
+	set("service.version", i.Build.Version)
+	set("process.runtime.version", i.Build.GoVersion)
+	if k := i.Kubernetes; k != nil {
+		set("k8s.pod.name", k.Pod)
+		set("k8s.namespace.name", k.Namespace)
+		set("k8s.node.name", k.Node)
+		set("k8s.container.name", k.Container)
+	}
+	return attrs
+}
+
+// Enrich attaches the description to the logs and metrics of the service. The
+// kubernetes metadata is added to every record of the default logger, and
+// exported as labels of the "target_info" metric, following the OpenTelemetry
+// convention for resource attributes in prometheus. The resource limits of
+// the container are exported as metrics of their own.
+func Enrich(i Info) {
+	if k := i.Kubernetes; k != nil {
+		logs.Wrap(func(h slog.Handler) slog.Handler {
+			return h.WithAttrs([]slog.Attr{
+				slog.String("k8s.pod.name", k.Pod),
+				slog.String("k8s.namespace.name", k.Namespace),
+				slog.String("k8s.node.name", k.Node),
+			})
+		})
+		if k.CPULimit > 0 {
+			cpuLimitGauge.Set(k.CPULimit)
+		}
+		if k.MemoryLimit > 0 {
+			memoryLimitGauge.Set(float64(k.MemoryLimit))
+		}
+	}
+
+	attrs := i.Attributes()
+	targetInfo := metrics.NewGauge("target_info", "Resource attributes of the service instance.",
+		"service_version", "k8s_pod_name", "k8s_namespace_name", "k8s_node_name")
+	targetInfo.Set(1,
+		attrs["service.version"],
+		attrs["k8s.pod.name"],
+		attrs["k8s.namespace.name"],
+		attrs["k8s.node.name"],
+	)
+}
+
+// Handler returns an admin handler serving the description, see
+// [admin.Server.Handle].
+func Handler(i Info) http.Handler {
+	return admin.JSON(func() any { return i })
+}
+
+// detectBuild reads the build information embedded in the binary.
+func detectBuild() Build {
+	b := Build{GoVersion: runtime.Version()}
+	bi, ok := debug.ReadBuildInfo()
+	if !ok {
+		return b
+	}
+	b.Path, b.Version = bi.Main.Path, bi.Main.Version
+	for _, s := range bi.Settings {
+		if s.Key == "vcs.revision" {
+			b.Revision = s.Value
+		}
+	}
+	return b
+}
+
+var (
+	cpuLimitGauge = metrics.NewGauge("container_cpu_limit_cores",
+		"The cpu limit of the container, in cores.")
+	memoryLimitGauge = metrics.NewGauge("container_memory_limit_bytes",
+		"The memory limit of the container, in bytes.")
+)
@@ -0,0 +1,164 @@
+package info
+
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Kubernetes describes the pod the service runs in. The pod name, the node and
+// the container name are taken from the environment, which the deployment
+// sets with the downward api:
+//
+//	env:
+//	  - name: POD_NAME
+//	    valueFrom: {fieldRef: {fieldPath: metadata.name}}
+//	  - name: POD_NAMESPACE
+//	    valueFrom: {fieldRef: {fieldPath: metadata.namespace}}
+//	  - name: NODE_NAME
+//	    valueFrom: {fieldRef: {fieldPath: spec.nodeName}}
+//
+// Without them, the pod name falls back to the hostname and the namespace to
+// the one of the service account. The resource limits are read from the
+// cgroup of the container.
+type Kubernetes struct {
+	Pod       string `json:"pod"`
+	Namespace string `json:"namespace"`
+	Node      string `json:"node,omitempty"`
+	Container string `json:"container,omitempty"`
+
+	// CPULimit is the cpu limit of the container in cores, zero
+	// if the container is not limited.
+	CPULimit float64 `json:"cpu_limit,omitempty"`
+
+	// MemoryLimit is the memory limit of the container in bytes,
+	// zero if the container is not limited.
+	MemoryLimit int64 `json:"memory_limit,omitempty"`
+}
+
+// DetectKubernetes describes the pod the service runs in. Returns nil if the
+// service is not running inside a kubernetes cluster.
+func DetectKubernetes() *Kubernetes {
+	if os.Getenv("KUBERNETES_SERVICE_HOST") == "" {
+		return nil
+	}
+	k := &Kubernetes{
+		Pod:       os.Getenv("POD_NAME"),
+		Namespace: os.Getenv("POD_NAMESPACE"),
+		Node:      os.Getenv("NODE_NAME"),
+		Container: os.Getenv("CONTAINER_NAME"),
+	}
+	if k.Pod == "" {
+		k.Pod, _ = os.Hostname() //nolint:errcheck // best effort
+	}
+	if k.Namespace == "" {
+		ns, _ := os.ReadFile(serviceAccountDir + "/namespace") //nolint:errcheck // best effort
+		k.Namespace = strings.TrimSpace(string(ns))
+	}
+	k.CPULimit, k.MemoryLimit = CgroupLimits()
+	return k
+}
+
+// CgroupLimits reads the cpu and memory limits of the container from the
+// cgroup of the process, see [cgroupPath], trying cgroup v2 first. Zero means
+// unlimited.
+func CgroupLimits() (cpu float64, memory int64) {
+	// cgroup v2: "<quota> <period>" or "max <period>".
+	if f := readCgroupFields("", "cpu.max"); len(f) == 2 {
+		quota, qerr := strconv.ParseFloat(f[0], 64)
+		period, perr := strconv.ParseFloat(f[1], 64)
+		if qerr == nil && perr == nil && period > 0 {
+			cpu = quota / period
+		}
+	} else if f := readCgroupFields("cpu", "cpu.cfs_quota_us"); len(f) == 1 {
+		// cgroup v1: a quota of -1 means unlimited.
+		quota, qerr := strconv.ParseFloat(f[0], 64)
+		p := readCgroupFields("cpu", "cpu.cfs_period_us")
+		if qerr == nil && quota > 0 && len(p) == 1 {
+			if period, err := strconv.ParseFloat(p[0], 64); err == nil && period > 0 {
+				cpu = quota / period
+			}
+		}
+	}
+
+	f := readCgroupFields("", "memory.max")
+	if len(f) != 1 {
+		f = readCgroupFields("memory", "memory.limit_in_bytes")
+	}
+	// "max" in v2, a huge number close to MaxInt64 in v1.
+	if len(f) == 1 {
+		if v, err := strconv.ParseInt(f[0], 10, 64); err == nil && v < unlimitedMemory {
+			memory = v
+		}
+	}
+	return cpu, memory
+}
+
+// readCgroupFields reads the fields of a file of the cgroup of the process,
+// for the cgroup v1 controller, or from the unified cgroup v2 hierarchy if the
+// controller is empty. Inside a container the cgroup of the process is
+// usually mounted at the root of the hierarchy, thus the root is read if the
+// cgroup path does not exist. Returns nil if the file cannot be read.
+func readCgroupFields(controller, name string) []string {
+	root := filepath.Join(cgroupDir, controller)
+	if controller == "" {
+		if _, err := os.Stat(filepath.Join(root, "cgroup.controllers")); err != nil {
+			return nil // cgroup v2 is not mounted
+		}
+	}
+	procCgroup, err := os.ReadFile("/proc/self/cgroup")
+	if err != nil {
+		return nil
+	}
+	if path, ok := cgroupPath(procCgroup, controller); ok {
+		if f := readFields(filepath.Join(root, path, name)); f != nil {
+			return f
+		}
+	}
+	return readFields(filepath.Join(root, name))
+}
+
+// cgroupPath returns the path of the cgroup of the process for the cgroup v1
+// controller, or for the unified cgroup v2 hierarchy if the controller is
+// empty, as listed in /proc/self/cgroup, e.g. "4:memory:/kubepods/pod1".
+func cgroupPath(procCgroup []byte, controller string) (string, bool) {
+	for _, line := range strings.Split(string(procCgroup), "\n") {
+		parts := strings.SplitN(line, ":", 3)
+		if len(parts) != 3 {
+			continue
+		}
+		if controller == "" && parts[0] == "0" && parts[1] == "" {
+			return parts[2], true
+		}
+		for _, c := range strings.Split(parts[1], ",") {
+			if controller != "" && c == controller {
+				return parts[2], true
+			}
+		}
+	}
+	return "", false
+}
+
+// readFields reads the whitespace separated fields of a file. Returns nil if
+// the file cannot be read.
+func readFields(path string) []string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	return strings.Fields(string(b))
+}
+
+const (
+	// serviceAccountDir is where kubernetes mounts the credentials of the
+	// service account inside the pod.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// cgroupDir is where the cgroup hierarchies are mounted.
+	cgroupDir = "/sys/fs/cgroup"
+
+	// unlimitedMemory is the threshold above which a cgroup v1 memory
+	// limit means unlimited.
+	unlimitedMemory = 1 << 62
+)
@@ -0,0 +1,34 @@
+package info
+
+import "testing"
+
+func TestCgroupPath(t *testing.T) {
+	v1 := []byte("12:memory:/kubepods/burstable/pod1/c1\n" +
+		"4:cpu,cpuacct:/kubepods/burstable/pod1/c1\n" +
+		"1:name=systemd:/kubepods/burstable/pod1/c1\n")
+	v2 := []byte("0::/kubepods.slice/pod1.slice/c1.scope\n")
+
+	tests := []struct {
+		name       string
+		procCgroup []byte
+		controller string
+		want       string
+		wantOK     bool
+	}{
+		{"v2 unified", v2, "", "/kubepods.slice/pod1.slice/c1.scope", true},
+		{"v1 memory", v1, "memory", "/kubepods/burstable/pod1/c1", true},
+		{"v1 joined controllers", v1, "cpu", "/kubepods/burstable/pod1/c1", true},
+		{"v1 without unified", v1, "", "", false},
+		{"v2 without controller", v2, "memory", "", false},
+		{"malformed", []byte("garbage\n"), "", "", false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := cgroupPath(tt.procCgroup, tt.controller)
+			if got != tt.want || ok != tt.wantOK {
+				t.Errorf("cgroupPath(%q) = %q, %v, want %q, %v", tt.controller, got, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
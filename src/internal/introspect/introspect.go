@@ -0,0 +1,194 @@
+// Package introspect takes snapshots of the state of a running service: its
+// subscriptions, routes, grpc methods, health and configuration. Tests use the
+// snapshots to assert how the service is wired, e.g.
+//
+//	if !introspect.Of(ctx, svc, cfg).Subscribed("events.created") { ... }
+//
+// and the snapshot is served on the admin listener for debugging, see
+// [Handler].
+package introspect
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"reflect"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/admin"
+	"github.com/eventscompass/service-template/src/internal/health"
+)
+
+// Snapshot is the state of a service.
+type Snapshot struct {
+	// Subscriptions are the topics the service subscribes to.
+	Subscriptions []string `json:"subscriptions"`
+
+	// Routes are the routes of the rest handler, if it lists
+	// them, see [RouteLister].
+	Routes []string `json:"routes,omitempty"`
+
+	// GRPCMethods are the full names of the grpc methods, e.g.
+	// "/events.v1.Events/GetEvent".
+	GRPCMethods []string `json:"grpc_methods,omitempty"`
+
+	// Health holds the result of every readiness check of
+	// the service, see [health.Of], "ok" if the check passed.
+	Health map[string]string `json:"health"`
+
+	// Config is the configuration of the service with the
+	// secrets redacted, see [Redact].
+	Config any `json:"config,omitempty"`
+}
+
+// RouteLister is implemented by rest handlers that can list their routes.
+type RouteLister interface {
+	Routes() []string
+}
+
+// Of takes a snapshot of the service, which must be initialized. The cfg is the
+// configuration of the service, it is redacted in the snapshot.
+func Of(ctx context.Context, s service.CloudService, cfg any) Snapshot {
+	snap := Snapshot{Health: make(map[string]string)}
+	for topic := range s.Events() {
+		snap.Subscriptions = append(snap.Subscriptions, topic)
+	}
+	sort.Strings(snap.Subscriptions)
+
+	if rl, ok := s.REST().(RouteLister); ok {
+		snap.Routes = rl.Routes()
+	}
+	if srv := s.GRPC(); srv != nil {
+		for name, info := range srv.GetServiceInfo() {
+			for _, m := range info.Methods {
+				snap.GRPCMethods = append(snap.GRPCMethods, "/"+name+"/"+m.Name)
+			}
+		}
+		sort.Strings(snap.GRPCMethods)
+	}
+	for name, err := range health.Of(ctx).Check(ctx) {
+		snap.Health[name] = "ok"
+		if err != nil {
+			snap.Health[name] = err.Error()
+		}
+	}
+	if cfg != nil {
+		snap.Config = Redact(cfg)
+	}
+	return snap
+}
+
+// Subscribed reports whether the service subscribes to the topic.
+func (s Snapshot) Subscribed(topic string) bool { return slices.Contains(s.Subscriptions, topic) }
+
+// Serves reports whether the service serves the full grpc method name.
+func (s Snapshot) Serves(method string) bool { return slices.Contains(s.GRPCMethods, method) }
+
+// Healthy reports whether all health checks passed.
+func (s Snapshot) Healthy() bool {
+	for _, v := range s.Health {
+		if v != "ok" {
+			return false
+		}
+	}
+	return true
+}
+
+// Handler returns an admin handler serving the snapshot of the service, with
+// the checks of its readiness registry, see [admin.Server.Handle].
+func Handler(s service.CloudService, cfg any, ready *health.Registry) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := health.WithRegistry(r.Context(), ready)
+		admin.JSON(func() any { return Of(ctx, s, cfg) }).ServeHTTP(w, r)
+	})
+}
+
+// Redact returns the configuration as a map, with the values of the secret
+// fields replaced by "[redacted]". A field is secret if it is tagged with
+// `secret:"true"`, or if its name contains "password", "secret", "token", or
+// "key". Nested structs are redacted recursively.
+func Redact(cfg any) any {
+	return redact(reflect.ValueOf(cfg))
+}
+
+// redact converts the value, redacting secret struct fields.
+func redact(v reflect.Value) any {
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if !v.IsValid() || !v.CanInterface() {
+		return nil
+	}
+	// Values like durations and times are shown as strings.
+	if s, ok := v.Interface().(fmt.Stringer); ok {
+		return s.String()
+	}
+	switch v.Kind() {
+	case reflect.Struct:
+	case reflect.Slice, reflect.Array:
+		res := make([]any, v.Len())
+		for i := range res {
+			res[i] = redact(v.Index(i))
+		}
+		return res
+	default:
+		return v.Interface()
+	}
+
+	res := make(map[string]any, v.NumField())
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		switch {
+		case isSecret(f):
+			res[f.Name] = redacted
+		case f.Anonymous && indirect(f.Type).Kind() == reflect.Struct:
+			if m, ok := redact(v.Field(i)).(map[string]any); ok {
+				for k, val := range m {
+					res[k] = val
+				}
+			}
+		default:
+			res[f.Name] = redact(v.Field(i))
+		}
+	}
+	return res
+}
+
+// isSecret reports whether the struct field holds a secret.
+func isSecret(f reflect.StructField) bool {
+	if f.Tag.Get("secret") == "true" {
+		return true
+	}
+	name := strings.ToLower(f.Name)
+	for _, s := range secretNames {
+		if strings.Contains(name, s) {
+			return true
+		}
+	}
+	return false
+}
+
+// indirect returns the type pointed to by t, or t itself.
+func indirect(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Pointer {
+		return t.Elem()
+	}
+	return t
+}
+
+// redacted replaces the values of secret fields.
+const redacted = "[redacted]"
+
+// secretNames are the parts of field names that mark secrets.
+var secretNames = []string{"password", "secret", "token", "key"}
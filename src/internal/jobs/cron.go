@@ -0,0 +1,181 @@
+package jobs
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Schedule computes the activation times of a job.
+type Schedule interface {
+	// Next returns the first activation time strictly after t.
+	Next(t time.Time) time.Time
+}
+
+// ParseSchedule parses a cron spec. The standard five fields are supported:
+//
+//	┌───────────── minute (0-59)
+//	│ ┌───────────── hour (0-23)
+//	│ │ ┌───────────── day of the month (1-31)
+//	│ │ │ ┌───────────── month (1-12)
+//	│ │ │ │ ┌───────────── day of the week (0-6, sunday is 0)
+//	│ │ │ │ │
+//	* * * * *
+//
+// Every field accepts values, ranges (1-5), lists (1,3,5), steps (*/15, 0-30/5)
+// and the wildcard (*). In addition the descriptors @yearly, @monthly, @weekly,
+// @daily, @hourly and "@every <duration>" are supported. The schedule is
+// evaluated in UTC. This function returns [service.ErrBadRequest] in case the
+// spec is invalid.
+func ParseSchedule(spec string) (Schedule, error) {
+	spec = strings.TrimSpace(spec)
+	if d, ok := strings.CutPrefix(spec, "@every "); ok {
+		every, err := time.ParseDuration(strings.TrimSpace(d))
+		if err != nil || every < time.Second {
+			return nil, fmt.Errorf("%w: invalid interval %q", service.ErrBadRequest, d)
+		}
+		return interval(every), nil
+	}
+	if s, ok := descriptors[spec]; ok {
+		spec = s
+	}
+
+	fields := strings.Fields(spec)
+	if len(fields) != len(fieldBounds) {
+		return nil, fmt.Errorf("%w: cron spec %q must have %d fields",
+			service.ErrBadRequest, spec, len(fieldBounds))
+	}
+	var c cron
+	sets := []*uint64{&c.minute, &c.hour, &c.dom, &c.month, &c.dow}
+	for i, f := range fields {
+		bits, err := parseField(f, fieldBounds[i])
+		if err != nil {
+			return nil, fmt.Errorf("%w: cron spec %q: %v", service.ErrBadRequest, spec, err)
+		}
+		*sets[i] = bits
+	}
+	c.domStar = strings.HasPrefix(fields[2], "*")
+	c.dowStar = strings.HasPrefix(fields[4], "*")
+	// Sunday can also be written as 7.
+	if c.dow&(1<<7) != 0 {
+		c.dow |= 1
+	}
+	return &c, nil
+}
+
+// cron is a parsed cron spec. Every field is a bit set of the allowed values.
+type cron struct {
+	minute, hour, dom, month, dow uint64
+
+	// domStar and dowStar record whether the day fields are unrestricted.
+	// If both are restricted, a day matches if either of them matches.
+	domStar, dowStar bool
+}
+
+// Next implements the [Schedule] interface.
+func (c *cron) Next(t time.Time) time.Time {
+	t = t.UTC().Truncate(time.Minute).Add(time.Minute)
+	// Every valid spec activates at least once within five years, e.g.
+	// "0 0 29 2 *" activates only on leap years.
+	limit := t.AddDate(5, 0, 0) //nolint:gomnd // see above
+	for t.Before(limit) {
+		switch {
+		case c.month&(1<<uint(t.Month())) == 0:
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		case !c.dayMatches(t):
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, time.UTC)
+		case c.hour&(1<<uint(t.Hour())) == 0:
+			t = t.Truncate(time.Hour).Add(time.Hour)
+		case c.minute&(1<<uint(t.Minute())) == 0:
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+func (c *cron) dayMatches(t time.Time) bool {
+	dom := c.dom&(1<<uint(t.Day())) != 0
+	dow := c.dow&(1<<uint(t.Weekday())) != 0
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// interval is a schedule activating at a fixed interval.
+type interval time.Duration
+
+// Next implements the [Schedule] interface.
+func (i interval) Next(t time.Time) time.Time {
+	d := time.Duration(i)
+	return t.Truncate(d).Add(d)
+}
+
+// parseField parses a single field of a cron spec into a bit set.
+func parseField(field string, b bounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		expr, stepStr, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			if step, err = strconv.Atoi(stepStr); err != nil || step <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepStr)
+			}
+		}
+
+		lo, hi := b.lo, b.hi
+		switch {
+		case expr == "*":
+		case strings.Contains(expr, "-"):
+			loStr, hiStr, _ := strings.Cut(expr, "-")
+			var err1, err2 error
+			lo, err1 = strconv.Atoi(loStr)
+			hi, err2 = strconv.Atoi(hiStr)
+			if err1 != nil || err2 != nil {
+				return 0, fmt.Errorf("invalid range %q", expr)
+			}
+		default:
+			v, err := strconv.Atoi(expr)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value %q", expr)
+			}
+			lo, hi = v, v
+			if hasStep {
+				hi = b.hi
+			}
+		}
+		if lo < b.lo || hi > b.hi || lo > hi {
+			return 0, fmt.Errorf("%q out of range [%d, %d]", part, b.lo, b.hi)
+		}
+		for v := lo; v <= hi; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+// bounds are the minimum and maximum values of a cron field.
+type bounds struct{ lo, hi int }
+
+var (
+	// fieldBounds are the bounds of the cron fields in order. Day of the
+	// week allows 7 as an alias for sunday.
+	fieldBounds = []bounds{{0, 59}, {0, 23}, {1, 31}, {1, 12}, {0, 7}}
+
+	// descriptors map the predefined schedules to cron specs.
+	descriptors = map[string]string{
+		"@yearly":   "0 0 1 1 *",
+		"@annually": "0 0 1 1 *",
+		"@monthly":  "0 0 1 * *",
+		"@weekly":   "0 0 * * 0",
+		"@daily":    "0 0 * * *",
+		"@midnight": "0 0 * * *",
+		"@hourly":   "0 * * * *",
+	}
+)
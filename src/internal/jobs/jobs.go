@@ -0,0 +1,375 @@
+// Package jobs runs scheduled background jobs of the service.
+//
+// Jobs are scheduled with cron specs, see [ParseSchedule]. A job is never run
+// concurrently with itself: if a run is still in progress when the next one is
+// due, the next run is skipped.
+//
+// Singleton jobs are run by a single replica. If the scheduler uses a
+// [Locker], the replicas compete for a lock on every tick and only the winner
+// runs the job. This holds even while the leadership changes hands, e.g.
+// during a rolling deploy, as long as the clocks of the replicas are skewed by
+// less than half of the interval between two ticks.
+package jobs
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Config encapsulates the configuration of the scheduler.
+type Config struct {
+	// DrainTimeout is the grace period given to running jobs to
+	// finish once the scheduler is stopped. Jobs still running
+	// afterwards have their context cancelled and are abandoned.
+	DrainTimeout time.Duration `env:"JOBS_DRAIN_TIMEOUT" envDefault:"30s"`
+}
+
+// ScheduledJob describes a job that is run periodically.
+type ScheduledJob struct {
+	// Name uniquely identifies the job.
+	Name string
+
+	// Spec is the cron spec defining when the job runs.
+	Spec string
+
+	// Handler performs the work of the job.
+	Handler func(ctx context.Context) error
+
+	// Timeout limits the duration of a single run. Zero means no
+	// limit.
+	Timeout time.Duration
+
+	// Jitter delays every run by a random duration in [0, Jitter),
+	// so that replicas do not hit shared dependencies at the same
+	// time. Singleton jobs acquire their lock before the jitter,
+	// so the jitter may exceed the lifetime of the lock.
+	Jitter time.Duration
+
+	// Singleton jobs are run only by the leader replica.
+	Singleton bool
+}
+
+// Leader reports whether this replica is the leader, see [leader.Elector].
+type Leader interface {
+	IsLeader() bool
+}
+
+// Locker is a distributed lock shared by the replicas, see [leader.Locker].
+type Locker interface {
+	// TryLock acquires the lock with the given name for the
+	// given holder, or renews it if the holder already owns the
+	// lock. The lock expires after ttl. Returns true if the
+	// holder owns the lock.
+	TryLock(_ context.Context, name, holder string, ttl time.Duration) (bool, error)
+}
+
+// Scheduler runs scheduled jobs.
+type Scheduler struct {
+	cfg    Config
+	jobs   []*job
+	leader Leader
+
+	locker   Locker
+	identity string
+
+	clock clock.Clock
+}
+
+// NewScheduler creates a new [Scheduler] for the given jobs. Singleton jobs
+// are run only if l reports that this replica is the leader. If l is nil, the
+// replica is assumed to be the only one. This function returns
+// [service.ErrBadRequest] in case any of the jobs is invalid.
+func NewScheduler(cfg Config, l Leader, jobs ...ScheduledJob) (*Scheduler, error) {
+	s := &Scheduler{cfg: cfg, leader: l, clock: clock.Real}
+	seen := make(map[string]bool, len(jobs))
+	for _, j := range jobs {
+		if j.Name == "" || j.Handler == nil {
+			return nil, fmt.Errorf("%w: job must have a name and a handler",
+				service.ErrBadRequest)
+		}
+		if seen[j.Name] {
+			return nil, fmt.Errorf("%w: duplicate job %q", service.ErrBadRequest, j.Name)
+		}
+		seen[j.Name] = true
+		sched, err := ParseSchedule(j.Spec)
+		if err != nil {
+			return nil, fmt.Errorf("job %q: %w", j.Name, err)
+		}
+		s.jobs = append(s.jobs, &job{ScheduledJob: j, schedule: sched})
+	}
+	return s, nil
+}
+
+// UseLocker makes the scheduler acquire a lock from l on every tick of a
+// singleton job, so that the job is run by exactly one replica per tick. The
+// identity must be unique for every replica. If a locker is used, the leader
+// passed to [NewScheduler] is ignored for singleton jobs. UseLocker must be
+// called before [Scheduler.Run].
+func (s *Scheduler) UseLocker(l Locker, identity string) {
+	s.locker, s.identity = l, identity
+}
+
+// UseClock makes the scheduler use the given clock for the schedules and the
+// drain timeout, e.g. a fake clock in tests. UseClock must be called before
+// [Scheduler.Run].
+func (s *Scheduler) UseClock(c clock.Clock) {
+	s.clock = clock.Or(c)
+}
+
+// JobStatus describes the state of a scheduled job.
+type JobStatus struct {
+	Name      string `json:"name"`
+	Spec      string `json:"spec"`
+	Singleton bool   `json:"singleton"`
+	Running   bool   `json:"running"`
+
+	// NextRun is the next time the job is scheduled to run.
+	NextRun time.Time `json:"next_run"`
+
+	// LastRun is the start time of the last run. It is zero if
+	// the job did not run yet.
+	LastRun      time.Time     `json:"last_run,omitempty"`
+	LastDuration time.Duration `json:"last_duration,omitempty"`
+	LastOutcome  string        `json:"last_outcome,omitempty"`
+	LastError    string        `json:"last_error,omitempty"`
+}
+
+// Status returns the state of all jobs of the scheduler.
+func (s *Scheduler) Status() []JobStatus {
+	res := make([]JobStatus, len(s.jobs))
+	for i, j := range s.jobs {
+		j.statusMu.Lock()
+		res[i] = j.status
+		j.statusMu.Unlock()
+		res[i].Name, res[i].Spec, res[i].Singleton = j.Name, j.Spec, j.Singleton
+	}
+	return res
+}
+
+// Run runs the jobs according to their schedules until ctx is cancelled. This
+// is a blocking function. Once ctx is cancelled no new runs are started, and
+// the running jobs are given the configured drain timeout to finish. Jobs that
+// do not finish in time are cancelled and abandoned.
+func (s *Scheduler) Run(ctx context.Context) error {
+	// The jobs must not be cancelled together with ctx, otherwise they
+	// would not be able to finish during the drain.
+	runCtx, cancel := context.WithCancel(context.WithoutCancel(ctx))
+	defer cancel()
+
+	var loops, running sync.WaitGroup
+	for _, j := range s.jobs {
+		j := j
+		loops.Add(1)
+		go func() {
+			defer loops.Done()
+			s.loop(ctx, runCtx, j, &running)
+		}()
+	}
+	loops.Wait()
+
+	done := make(chan struct{})
+	go func() {
+		running.Wait()
+		close(done)
+	}()
+	timer := s.clock.NewTimer(s.cfg.DrainTimeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return nil
+	case <-timer.C():
+	}
+
+	for _, st := range s.Status() {
+		if st.Running {
+			slog.Error("abandoning job, drain timeout exceeded",
+				slog.String("job", st.Name),
+				slog.Time("started", st.LastRun),
+			)
+		}
+	}
+	return nil
+}
+
+// loop waits for the activation times of the job and runs it with runCtx until
+// ctx is cancelled.
+func (s *Scheduler) loop(ctx, runCtx context.Context, j *job, running *sync.WaitGroup) {
+	for {
+		next := j.schedule.Next(s.clock.Now())
+		if next.IsZero() {
+			slog.Warn("job will never run again", slog.String("job", j.Name))
+			return
+		}
+		j.setStatus(func(st *JobStatus) { st.NextRun = next })
+		if clock.Sleep(ctx, s.clock, clock.Until(s.clock, next)) != nil {
+			return
+		}
+
+		// The lock is acquired at the tick rather than after the jitter,
+		// otherwise a jitter longer than the lifetime of the lock would
+		// let a replica with a longer jitter run the tick again.
+		if j.Singleton && !s.acquire(ctx, j, next) {
+			continue
+		}
+		if j.Jitter > 0 {
+			jitter := time.Duration(rand.Int63n(int64(j.Jitter))) //nolint:gosec // no need for crypto
+			if clock.Sleep(ctx, s.clock, jitter) != nil {
+				return
+			}
+		}
+		if !j.mu.TryLock() { // the previous run is still in progress
+			slog.Warn("skipping job run, previous run still in progress",
+				slog.String("job", j.Name))
+			runsTotal.Inc(j.Name, outcomeSkipped)
+			j.setStatus(func(st *JobStatus) { st.LastOutcome = outcomeSkipped })
+			continue
+		}
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			defer j.mu.Unlock()
+			j.run(runCtx, s.clock)
+		}()
+	}
+}
+
+// acquire reports whether this replica should run the singleton job for the
+// tick at the given time.
+func (s *Scheduler) acquire(ctx context.Context, j *job, tick time.Time) bool {
+	if s.locker == nil {
+		return s.leader == nil || s.leader.IsLeader()
+	}
+
+	// The lock is not released after the run. It has to outlive the tick,
+	// so that replicas reaching the tick a bit later don't run the job
+	// again, and it has to expire before the next tick, so that any
+	// replica can take over if this one dies.
+	ttl := j.schedule.Next(tick).Sub(tick) / 2
+	ok, err := s.locker.TryLock(ctx, lockName(j.Name), s.identity, ttl)
+	if err != nil {
+		// Skipping the tick is safer than running the job twice.
+		slog.Warn("skipping job run, failed to acquire lock",
+			slog.String("job", j.Name),
+			slog.String("error", err.Error()),
+		)
+		return false
+	}
+	return ok
+}
+
+// job is a scheduled job together with its parsed schedule.
+type job struct {
+	ScheduledJob
+	schedule Schedule
+
+	// mu is held while the job is running.
+	mu sync.Mutex
+
+	statusMu sync.Mutex
+	status   JobStatus
+}
+
+// setStatus updates the status of the job.
+func (j *job) setStatus(update func(st *JobStatus)) {
+	j.statusMu.Lock()
+	defer j.statusMu.Unlock()
+	update(&j.status)
+}
+
+// run runs the job once, recovering from panics.
+func (j *job) run(ctx context.Context, c clock.Clock) {
+	if j.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, j.Timeout)
+		defer cancel()
+	}
+
+	start := c.Now()
+	j.setStatus(func(st *JobStatus) {
+		st.Running, st.LastRun = true, start
+	})
+	err := func() (err error) {
+		defer func() {
+			if msg := recover(); msg != nil {
+				err = fmt.Errorf("%w: panic: %v", service.ErrUnexpected, msg)
+			}
+		}()
+		return j.Handler(ctx)
+	}()
+	duration := clock.Since(c, start)
+	runDuration.Observe(duration.Seconds(), j.Name)
+	j.setStatus(func(st *JobStatus) {
+		st.Running, st.LastDuration = false, duration
+		st.LastOutcome, st.LastError = outcomeSuccess, ""
+		if err != nil {
+			st.LastOutcome, st.LastError = outcomeFailure, err.Error()
+		}
+	})
+
+	if err != nil {
+		runsTotal.Inc(j.Name, outcomeFailure)
+		slog.Error("job failed",
+			slog.String("job", j.Name),
+			slog.Duration("duration", duration),
+			slog.String("error", err.Error()),
+		)
+		return
+	}
+	runsTotal.Inc(j.Name, outcomeSuccess)
+	lastSuccess.Set(float64(c.Now().Unix()), j.Name)
+	slog.Info("job finished",
+		slog.String("job", j.Name),
+		slog.Duration("duration", duration),
+	)
+}
+
+// lockName returns the name of the lock of the job. The name is a valid
+// kubernetes object name, so that it can be used with [leader.LeaseLocker].
+func lockName(job string) string {
+	name := strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '-', r == '.':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r + 'a' - 'A'
+		default:
+			return '-'
+		}
+	}, job)
+	return strings.TrimRight("job-"+name, "-.")
+}
+
+const (
+	outcomeSuccess = "success"
+	outcomeFailure = "failure"
+	outcomeSkipped = "skipped"
+)
+
+var (
+	runsTotal = metrics.NewCounter(
+		"jobs_runs_total",
+		"Number of job runs by outcome.",
+		"job", "outcome",
+	)
+	runDuration = metrics.NewHistogram(
+		"jobs_run_duration_seconds",
+		"Duration of job runs in seconds.",
+		[]float64{.1, .5, 1, 5, 10, 30, 60, 300, 900, 3600},
+		"job",
+	)
+	lastSuccess = metrics.NewGauge(
+		"jobs_last_success_timestamp_seconds",
+		"Unix time of the last successful run of the job.",
+		"job",
+	)
+)
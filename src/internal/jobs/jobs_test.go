@@ -0,0 +1,104 @@
+package jobs
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/leader"
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestSchedulerSingleton(t *testing.T) {
+	const ticks = 3
+	tests := []struct {
+		name      string
+		singleton bool
+		wantRuns  int32
+	}{
+		{"singleton", true, ticks},
+		{"not singleton", false, 2 * ticks},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			l := leader.NewMemoryLocker()
+			l.UseClock(c)
+			var runs atomic.Int32
+			job := ScheduledJob{
+				Name:      "cleanup",
+				Spec:      "@every 1m",
+				Handler:   func(context.Context) error { runs.Add(1); return nil },
+				Singleton: tt.singleton,
+			}
+
+			// Two replicas share the locker.
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{}, 2)
+			var replicas []*Scheduler
+			for _, identity := range []string{"a", "b"} {
+				s, err := NewScheduler(Config{}, nil, job)
+				if err != nil {
+					t.Fatalf("new scheduler: %v", err)
+				}
+				s.UseClock(c)
+				s.UseLocker(l, identity)
+				replicas = append(replicas, s)
+				go func() {
+					s.Run(ctx) //nolint:errcheck // cannot fail
+					done <- struct{}{}
+				}()
+			}
+			for i := 0; i < ticks; i++ {
+				c.WaitForTimers(2)
+				c.Advance(time.Minute)
+				// Both replicas wait for the next tick once they decided
+				// on this one.
+				c.WaitForTimers(2)
+				for _, s := range replicas {
+					finished(t, s.jobs[0])
+				}
+			}
+			cancel()
+			<-done
+			<-done
+			if got := runs.Load(); got != tt.wantRuns {
+				t.Errorf("got %d runs in %d ticks, want %d", got, ticks, tt.wantRuns)
+			}
+		})
+	}
+}
+
+// finished waits until the job is not running.
+func finished(t *testing.T, j *job) {
+	t.Helper()
+	deadline := time.Now().Add(5 * time.Second)
+	for !j.mu.TryLock() {
+		if time.Now().After(deadline) {
+			t.Fatal("timed out waiting for the run to finish")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	j.mu.Unlock()
+}
+
+func TestLockName(t *testing.T) {
+	tests := []struct {
+		job  string
+		want string
+	}{
+		{"cleanup", "job-cleanup"},
+		{"Sync Venues", "job-sync-venues"},
+		{"export.daily_", "job-export.daily"},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.job, func(t *testing.T) {
+			if got := lockName(tt.job); got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
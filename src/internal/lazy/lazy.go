@@ -0,0 +1,222 @@
+// Package lazy initializes the components of the service out of Init, so that
+// a service with heavy optional dependencies, e.g. a search index or a model
+// loaded from object storage, starts serving its independent endpoints without
+// waiting for them:
+//
+//	s.index = lazy.Background(ctx, "search_index", openIndex)
+//	...
+//	idx, err := s.index.Get(r.Context())
+//
+// A component created with [New] is initialized on its first use. A component
+// created with [Background] is initialized right away in the background, and
+// gates the readiness of the service: its health check fails until it is
+// initialized, thus the service receives traffic once it is complete. The
+// endpoints depending on a component can be gated individually instead, see
+// [Component.Gate].
+package lazy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/flight"
+	"github.com/eventscompass/service-template/src/internal/health"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Component is a component of the service initialized out of Init.
+type Component[T any] struct {
+	name   string
+	init   func(ctx context.Context) (T, error)
+	flight *flight.Group[struct{}, T]
+
+	// background components are initialized by [Component.initBackground]
+	// only.
+	background bool
+
+	// ready is closed once the component is initialized, val is written
+	// before.
+	ready chan struct{}
+	val   T
+
+	mu      sync.Mutex
+	lastErr error // the error of the last failed initialization
+}
+
+// New creates a [Component] initialized on the first call of
+// [Component.Get]. A failed initialization is attempted again on the next
+// call.
+func New[T any](name string, init func(ctx context.Context) (T, error)) *Component[T] {
+	return &Component[T]{
+		name:   name,
+		init:   init,
+		flight: flight.NewGroup[struct{}, T]("lazy_" + name),
+		ready:  make(chan struct{}),
+	}
+}
+
+// Background creates a [Component] and initializes it in the background,
+// retrying with an exponential backoff until it succeeds or ctx is done. A
+// check with the name of the component is registered in the readiness
+// registry of ctx, see [health.Register], which fails until the component is
+// initialized.
+func Background[T any](
+	ctx context.Context,
+	name string,
+	init func(ctx context.Context) (T, error),
+) *Component[T] {
+	c := New(name, init)
+	c.background = true
+	health.Register(ctx, name, c.check)
+	go c.initBackground(ctx)
+	return c
+}
+
+// Get returns the component, initializing it if needed. Concurrent calls
+// share a single initialization. Get waits for the initialization of a
+// background component, retries included. This function returns [service.ErrTimeOut] in case
+// ctx is done before the component is initialized, and the error of the
+// initialization otherwise.
+func (c *Component[T]) Get(ctx context.Context) (T, error) {
+	select {
+	case <-c.ready:
+		return c.val, nil
+	default:
+	}
+
+	if c.background {
+		select {
+		case <-c.ready:
+			return c.val, nil
+		case <-ctx.Done():
+			var zero T
+			return zero, fmt.Errorf("%w: wait for %s: %v", service.ErrTimeOut, c.name, c.check(ctx))
+		}
+	}
+
+	v, err := c.flight.Do(ctx, struct{}{}, c.initialize)
+	if err != nil && ctx.Err() != nil {
+		return v, fmt.Errorf("%w: wait for %s: %v", service.ErrTimeOut, c.name, ctx.Err())
+	}
+	return v, err
+}
+
+// Ready reports whether the component is initialized.
+func (c *Component[T]) Ready() bool {
+	select {
+	case <-c.ready:
+		return true
+	default:
+		return false
+	}
+}
+
+// Gate returns a handler responding with 503 until the component is
+// initialized, so that the endpoints depending on it fail fast while the
+// others are served.
+func (c *Component[T]) Gate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !c.Ready() {
+			w.Header().Set("Retry-After", "1")
+			http.Error(w, c.check(r.Context()).Error(), http.StatusServiceUnavailable) // 503
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// initialize initializes the component, unless it is initialized already.
+func (c *Component[T]) initialize(ctx context.Context) (T, error) {
+	if c.Ready() { // initialized by the previous flight
+		return c.val, nil
+	}
+
+	start := time.Now()
+	v, err := c.init(ctx)
+	if err != nil {
+		c.mu.Lock()
+		c.lastErr = err
+		c.mu.Unlock()
+		failures.Inc(c.name)
+		return v, fmt.Errorf("init %s: %w", c.name, err)
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	// A flight abandoned by its callers may still be running when the
+	// next one starts, the first one to return wins.
+	if c.Ready() {
+		return c.val, nil
+	}
+	c.val = v
+	close(c.ready)
+	initDuration.ObserveSince(start, c.name)
+	slog.Info("initialized component",
+		slog.String("component", c.name), slog.Duration("took", time.Since(start)))
+	return v, nil
+}
+
+// initBackground initializes the component, retrying until it succeeds.
+func (c *Component[T]) initBackground(ctx context.Context) {
+	delay := minBackoff
+	for {
+		_, err := c.flight.Do(ctx, struct{}{}, c.initialize)
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		slog.Warn("failed to initialize component",
+			slog.String("component", c.name),
+			slog.Duration("retry_in", delay),
+			slog.String("error", err.Error()),
+		)
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay = min(delay*2, maxBackoff)
+	}
+}
+
+// check is the health check of a background component.
+func (c *Component[T]) check(context.Context) error {
+	if c.Ready() {
+		return nil
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.lastErr != nil {
+		return fmt.Errorf("%s is not initialized: %w", c.name, c.lastErr)
+	}
+	return errors.New(c.name + " is initializing")
+}
+
+const (
+	// minBackoff and maxBackoff bound the delay between the attempts to
+	// initialize a background component.
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+var (
+	// initDuration observes the time taken to initialize the components.
+	initDuration = metrics.NewHistogram(
+		"lazy_init_duration_seconds",
+		"Time taken to initialize the component.",
+		[]float64{.01, .1, 1, 10, 60},
+		"component",
+	)
+
+	// failures counts the failed initializations of the components.
+	failures = metrics.NewCounter(
+		"lazy_init_failures_total",
+		"Number of failed initializations of the component.",
+		"component",
+	)
+)
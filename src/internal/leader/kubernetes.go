@@ -0,0 +1,262 @@
+package leader
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+// LeaseLocker is a [Locker] backed by Kubernetes Lease objects. The name of the
+// lock is used as the name of the Lease inside the namespace of the pod.
+// https://kubernetes.io/docs/concepts/architecture/leases/
+//
+// The service account of the pod must be allowed to get, create and update
+// leases in its namespace.
+type LeaseLocker struct {
+	client    *http.Client
+	host      string
+	tokenFile string
+	namespace string
+	clock     clock.Clock
+}
+
+var _ Locker = (*LeaseLocker)(nil)
+
+// NewLeaseLocker creates a new [LeaseLocker] using the in-cluster credentials
+// of the pod. This function returns [service.ErrNotFound] in case the service
+// is not running inside a kubernetes cluster.
+func NewLeaseLocker() (*LeaseLocker, error) {
+	host, port := os.Getenv("KUBERNETES_SERVICE_HOST"), os.Getenv("KUBERNETES_SERVICE_PORT")
+	if host == "" || port == "" {
+		return nil, fmt.Errorf("%w: not running inside kubernetes", service.ErrNotFound)
+	}
+
+	if _, err := os.Stat(serviceAccountDir + "/token"); err != nil {
+		return nil, fmt.Errorf("%w: service account token: %v", service.ErrNotFound, err)
+	}
+	namespace, err := os.ReadFile(serviceAccountDir + "/namespace")
+	if err != nil {
+		return nil, fmt.Errorf("%w: read namespace: %v", service.ErrNotFound, err)
+	}
+	ca, err := os.ReadFile(serviceAccountDir + "/ca.crt")
+	if err != nil {
+		return nil, fmt.Errorf("%w: read ca certificate: %v", service.ErrNotFound, err)
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(ca) {
+		return nil, fmt.Errorf("%w: invalid ca certificate", service.ErrUnexpected)
+	}
+
+	return &LeaseLocker{
+		client: &http.Client{
+			Timeout: 10 * time.Second,
+			Transport: &http.Transport{
+				TLSClientConfig: &tls.Config{RootCAs: pool, MinVersion: tls.VersionTLS12},
+			},
+		},
+		host:      "https://" + net.JoinHostPort(host, port),
+		tokenFile: serviceAccountDir + "/token",
+		namespace: strings.TrimSpace(string(namespace)),
+		clock:     clock.Real,
+	}, nil
+}
+
+// UseClock makes the locker use the given clock for the acquire and renew
+// times of the leases and for expiring them, e.g. a fake clock in tests.
+// UseClock must be called before the locker is used.
+func (l *LeaseLocker) UseClock(c clock.Clock) {
+	l.clock = clock.Or(c)
+}
+
+// TryLock implements the [Locker] interface.
+func (l *LeaseLocker) TryLock(
+	ctx context.Context,
+	name string,
+	holder string,
+	ttl time.Duration,
+) (bool, error) {
+	now := l.clock.Now()
+	ls, err := l.get(ctx, name)
+	if err != nil {
+		return false, err
+	}
+
+	if ls == nil { // the lease does not exist yet
+		ls = &lease{APIVersion: "coordination.k8s.io/v1", Kind: "Lease"}
+		ls.Metadata.Name = name
+		ls.Spec = leaseSpec{
+			HolderIdentity:       holder,
+			LeaseDurationSeconds: seconds(ttl),
+			AcquireTime:          microTime(now),
+			RenewTime:            microTime(now),
+		}
+		return l.write(ctx, http.MethodPost, l.url(""), ls)
+	}
+
+	spec := &ls.Spec
+	if spec.HolderIdentity != holder && spec.HolderIdentity != "" {
+		renewed, err := time.Parse(microTimeFormat, spec.RenewTime)
+		expired := err != nil ||
+			now.After(renewed.Add(time.Duration(spec.LeaseDurationSeconds)*time.Second))
+		if !expired {
+			return false, nil
+		}
+	}
+	if spec.HolderIdentity != holder {
+		spec.HolderIdentity = holder
+		spec.AcquireTime = microTime(now)
+		spec.LeaseTransitions++
+	}
+	spec.LeaseDurationSeconds = seconds(ttl)
+	spec.RenewTime = microTime(now)
+
+	// The update carries the resource version of the lease that we read.
+	// If another replica updated the lease in the meantime, the api server
+	// rejects the update with a conflict.
+	return l.write(ctx, http.MethodPut, l.url(name), ls)
+}
+
+// Unlock implements the [Locker] interface.
+func (l *LeaseLocker) Unlock(ctx context.Context, name, holder string) error {
+	ls, err := l.get(ctx, name)
+	if err != nil || ls == nil || ls.Spec.HolderIdentity != holder {
+		return err
+	}
+	ls.Spec.HolderIdentity = ""
+	ls.Spec.LeaseDurationSeconds = 1
+	_, err = l.write(ctx, http.MethodPut, l.url(name), ls)
+	return err
+}
+
+// get fetches the lease with the given name. Returns nil if the lease does not
+// exist.
+func (l *LeaseLocker) get(ctx context.Context, name string) (*lease, error) {
+	resp, err := l.do(ctx, http.MethodGet, l.url(name), nil)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // intentional
+
+	switch resp.StatusCode {
+	case http.StatusOK:
+	case http.StatusNotFound:
+		return nil, nil //nolint:nilnil // a missing lease is not an error
+	default:
+		return nil, statusError(resp)
+	}
+	var res lease
+	if err := json.NewDecoder(resp.Body).Decode(&res); err != nil {
+		return nil, fmt.Errorf("%w: decode lease: %v", service.ErrUnexpected, err)
+	}
+	return &res, nil
+}
+
+// write creates or updates the lease. Returns false if the write was rejected
+// because of a concurrent modification.
+func (l *LeaseLocker) write(ctx context.Context, method, url string, ls *lease) (bool, error) {
+	body, err := json.Marshal(ls)
+	if err != nil {
+		return false, fmt.Errorf("%w: encode lease: %v", service.ErrUnexpected, err)
+	}
+	resp, err := l.do(ctx, method, url, body)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close() //nolint:errcheck // intentional
+
+	switch resp.StatusCode {
+	case http.StatusOK, http.StatusCreated:
+		return true, nil
+	case http.StatusConflict: // someone else was faster
+		return false, nil
+	default:
+		return false, statusError(resp)
+	}
+}
+
+func (l *LeaseLocker) do(
+	ctx context.Context,
+	method, url string,
+	body []byte,
+) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("%w: create request: %v", service.ErrUnexpected, err)
+	}
+	// The token is read for every request, since the kubelet rotates the
+	// projected service account tokens, and the old ones expire.
+	token, err := os.ReadFile(l.tokenFile)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read service account token: %v", service.ErrUnexpected, err)
+	}
+	req.Header.Set("Authorization", "Bearer "+strings.TrimSpace(string(token)))
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := l.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", service.ErrConnectionClosed, err)
+	}
+	return resp, nil
+}
+
+func (l *LeaseLocker) url(name string) string {
+	u := l.host + "/apis/coordination.k8s.io/v1/namespaces/" + l.namespace + "/leases"
+	if name != "" {
+		u += "/" + name
+	}
+	return u
+}
+
+// lease is the subset of the kubernetes Lease object used for the election.
+type lease struct {
+	APIVersion string `json:"apiVersion"`
+	Kind       string `json:"kind"`
+	Metadata   struct {
+		Name            string `json:"name"`
+		ResourceVersion string `json:"resourceVersion,omitempty"`
+	} `json:"metadata"`
+	Spec leaseSpec `json:"spec"`
+}
+
+type leaseSpec struct {
+	HolderIdentity       string `json:"holderIdentity"`
+	LeaseDurationSeconds int32  `json:"leaseDurationSeconds"`
+	AcquireTime          string `json:"acquireTime,omitempty"`
+	RenewTime            string `json:"renewTime,omitempty"`
+	LeaseTransitions     int32  `json:"leaseTransitions"`
+}
+
+func statusError(resp *http.Response) error {
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return fmt.Errorf("%w: kubernetes api: %s: %s",
+		service.ErrUnexpected, resp.Status, bytes.TrimSpace(msg))
+}
+
+func microTime(t time.Time) string { return t.UTC().Format(microTimeFormat) }
+
+func seconds(d time.Duration) int32 {
+	return int32(math.Ceil(d.Seconds()))
+}
+
+const (
+	// serviceAccountDir is where kubernetes mounts the credentials of the
+	// service account inside the pod.
+	serviceAccountDir = "/var/run/secrets/kubernetes.io/serviceaccount"
+
+	// microTimeFormat is the format of the kubernetes MicroTime type.
+	microTimeFormat = "2006-01-02T15:04:05.000000Z07:00"
+)
@@ -0,0 +1,102 @@
+package leader
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestLeaseLockerTokenRotation(t *testing.T) {
+	// The api server accepts only the current token, which the kubelet
+	// rotates in the token file.
+	var current atomic.Value
+	current.Store("token-1")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer "+current.Load().(string) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.Method == http.MethodGet {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	l := &LeaseLocker{
+		client:    srv.Client(),
+		host:      srv.URL,
+		tokenFile: tokenFile,
+		namespace: "default",
+		clock:     clock.Real,
+	}
+	for _, token := range []string{"token-1", "token-2"} {
+		current.Store(token)
+		if err := os.WriteFile(tokenFile, []byte(token+"\n"), 0o600); err != nil {
+			t.Fatalf("write token: %v", err)
+		}
+		if ok, err := l.TryLock(context.Background(), "lock", "a", time.Minute); !ok || err != nil {
+			t.Errorf("TryLock with %s = %v, %v, want true", token, ok, err)
+		}
+	}
+}
+
+func TestLeaseLockerExpiry(t *testing.T) {
+	// The api server stores a single lease, as written by the lockers.
+	var (
+		mu     sync.Mutex
+		stored *lease
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch {
+		case r.Method == http.MethodGet && stored == nil:
+			w.WriteHeader(http.StatusNotFound)
+		case r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(stored) //nolint:errcheck,errchkjson // test server
+		default:
+			stored = &lease{}
+			json.NewDecoder(r.Body).Decode(stored) //nolint:errcheck // test server
+			w.WriteHeader(http.StatusOK)
+		}
+	}))
+	defer srv.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("token"), 0o600); err != nil {
+		t.Fatalf("write token: %v", err)
+	}
+	clk := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := &LeaseLocker{client: srv.Client(), host: srv.URL, tokenFile: tokenFile, namespace: "default"}
+	l.UseClock(clk)
+
+	ctx := context.Background()
+	if ok, err := l.TryLock(ctx, "lock", "a", time.Minute); !ok || err != nil {
+		t.Fatalf("got TryLock of a %v, %v, want true", ok, err)
+	}
+	clk.Advance(59 * time.Second)
+	if ok, err := l.TryLock(ctx, "lock", "b", time.Minute); ok || err != nil {
+		t.Errorf("got TryLock of b %v, %v before the lease expired, want false", ok, err)
+	}
+	clk.Advance(2 * time.Second)
+	if ok, err := l.TryLock(ctx, "lock", "b", time.Minute); !ok || err != nil {
+		t.Errorf("got TryLock of b %v, %v after the lease expired, want true", ok, err)
+	}
+	if stored.Spec.HolderIdentity != "b" || stored.Spec.LeaseTransitions != 1 ||
+		stored.Spec.AcquireTime != microTime(clk.Now()) {
+		t.Errorf("got lease %+v, want acquired by b at %s", stored.Spec, clk.Now())
+	}
+}
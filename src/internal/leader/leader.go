@@ -0,0 +1,246 @@
+// Package leader implements leader election between the replicas of a service.
+// Only the replica holding the leadership should run singleton background work,
+// e.g. scheduled jobs or projection runners.
+//
+// The election is lock based. Every replica periodically tries to acquire (or
+// renew) a lock with a limited lifetime. The replica holding the lock is the
+// leader. If the leader dies, the lock expires and another replica takes over.
+package leader
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Config encapsulates the configuration for the leader election.
+type Config struct {
+	// Name is the name of the lock for which the replicas
+	// compete. Replicas of the same service must use the same
+	// name.
+	Name string `env:"LEADER_ELECTION_NAME" envDefault:"leader"`
+
+	// Identity uniquely identifies this replica. Defaults to the
+	// hostname, which is the pod name inside kubernetes.
+	Identity string `env:"LEADER_ELECTION_IDENTITY"`
+
+	// LeaseDuration is the lifetime of the lock. The other
+	// replicas take over once the leader did not renew the lock
+	// for this long.
+	LeaseDuration time.Duration `env:"LEADER_ELECTION_LEASE_DURATION" envDefault:"15s"`
+
+	// RenewDeadline is how long the leader keeps trying to renew
+	// the lock before it steps down. It must be shorter than
+	// LeaseDuration, so that the leader stops leading before
+	// another replica can take over.
+	RenewDeadline time.Duration `env:"LEADER_ELECTION_RENEW_DEADLINE" envDefault:"10s"`
+
+	// RetryPeriod is the interval at which the lock is acquired
+	// or renewed. It must be shorter than RenewDeadline.
+	RetryPeriod time.Duration `env:"LEADER_ELECTION_RETRY_PERIOD" envDefault:"2s"`
+}
+
+// Locker is the lock that the replicas compete for.
+type Locker interface {
+	// TryLock acquires the lock with the given name for the
+	// given holder, or renews it if the holder already owns the
+	// lock. The lock expires after ttl, unless renewed. Returns
+	// true if the holder owns the lock.
+	TryLock(_ context.Context, name, holder string, ttl time.Duration) (bool, error)
+
+	// Unlock releases the lock if it is owned by the holder.
+	Unlock(_ context.Context, name, holder string) error
+}
+
+// Callbacks are invoked when the replica gains or loses the leadership.
+type Callbacks struct {
+	// OnStartedLeading is called in a separate goroutine when
+	// the replica becomes the leader. The context is cancelled
+	// when the leadership is lost.
+	OnStartedLeading func(ctx context.Context)
+
+	// OnStoppedLeading is called when the replica loses the
+	// leadership.
+	OnStoppedLeading func()
+}
+
+// Elector elects a leader among the replicas of a service.
+type Elector struct {
+	cfg    Config
+	locker Locker
+	cb     Callbacks
+	clock  clock.Clock
+
+	mu       sync.Mutex
+	isLeader bool
+}
+
+// NewElector creates a new [Elector]. The election starts when calling
+// [Elector.Run].
+func NewElector(cfg Config, l Locker, cb Callbacks) *Elector {
+	if cfg.Identity == "" {
+		cfg.Identity, _ = os.Hostname()
+	}
+	return &Elector{cfg: cfg, locker: l, cb: cb, clock: clock.Real}
+}
+
+// UseClock makes the elector use the given clock for the retry period and the
+// renew deadline, e.g. a fake clock in tests. UseClock must be called before
+// [Elector.Run].
+func (e *Elector) UseClock(c clock.Clock) {
+	e.clock = clock.Or(c)
+}
+
+// IsLeader reports whether this replica currently holds the leadership.
+func (e *Elector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.isLeader
+}
+
+// Identity returns the identity of this replica.
+func (e *Elector) Identity() string { return e.cfg.Identity }
+
+// Run takes part in the election until ctx is cancelled. This is a blocking
+// function. When the function returns, the leadership is released. This
+// function returns [service.ErrUnexpected] in case the durations of the config
+// are not ordered as retry period < renew deadline < lease duration.
+func (e *Elector) Run(ctx context.Context) error {
+	if e.cfg.RetryPeriod <= 0 || e.cfg.RenewDeadline <= e.cfg.RetryPeriod ||
+		e.cfg.LeaseDuration <= e.cfg.RenewDeadline {
+		return fmt.Errorf("%w: lease duration must exceed the renew deadline, "+
+			"which must exceed the retry period", service.ErrUnexpected)
+	}
+	leaderGauge.Set(0, e.cfg.Name, e.cfg.Identity)
+
+	var (
+		stop      context.CancelFunc
+		lastRenew time.Time
+	)
+	for {
+		ok, err := e.tryLock(ctx, stop != nil, lastRenew)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Warn("failed to acquire leader lock",
+				slog.String("lock", e.cfg.Name),
+				slog.String("error", err.Error()),
+			)
+			// Keep the leadership until the renew deadline, the lock
+			// might still be ours. The deadline is before the lease
+			// expires, thus the leader stops before another replica
+			// takes over.
+			if stop != nil && clock.Since(e.clock, lastRenew) >= e.cfg.RenewDeadline {
+				e.stepDown(stop)
+				stop = nil
+			}
+		case ok:
+			lastRenew = e.clock.Now()
+			if stop == nil {
+				stop = e.becomeLeader(ctx)
+			}
+		case stop != nil:
+			e.stepDown(stop)
+			stop = nil
+		}
+
+		t := e.clock.NewTimer(e.cfg.RetryPeriod)
+		select {
+		case <-ctx.Done():
+			t.Stop()
+			if stop != nil {
+				e.stepDown(stop)
+				// Release the lock so that another replica can take
+				// over without waiting for the lease to expire.
+				//nolint:contextcheck // ctx is already cancelled
+				if err := e.locker.Unlock(context.Background(),
+					e.cfg.Name, e.cfg.Identity); err != nil {
+					slog.Warn("failed to release leader lock",
+						slog.String("lock", e.cfg.Name),
+						slog.String("error", err.Error()),
+					)
+				}
+			}
+			return nil
+		case <-t.C():
+		}
+	}
+}
+
+// tryLock acquires or renews the lock. A renewal is given up at the renew
+// deadline, so that a locker that hangs does not keep the leader leading after
+// the lease expired.
+func (e *Elector) tryLock(ctx context.Context, leading bool, lastRenew time.Time) (bool, error) {
+	if leading {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx,
+			clock.Until(e.clock, lastRenew.Add(e.cfg.RenewDeadline)))
+		defer cancel()
+	}
+	return e.locker.TryLock(ctx, e.cfg.Name, e.cfg.Identity, e.cfg.LeaseDuration)
+}
+
+// becomeLeader marks the replica as leader and starts the leader callback.
+func (e *Elector) becomeLeader(ctx context.Context) context.CancelFunc {
+	e.setLeader(true)
+	slog.Info("became leader",
+		slog.String("lock", e.cfg.Name),
+		slog.String("identity", e.cfg.Identity),
+	)
+
+	leaderCtx, cancel := context.WithCancel(ctx)
+	if e.cb.OnStartedLeading != nil {
+		go e.cb.OnStartedLeading(leaderCtx)
+	}
+	return cancel
+}
+
+// stepDown cancels the leader context and marks the replica as follower.
+func (e *Elector) stepDown(stop context.CancelFunc) {
+	stop()
+	e.setLeader(false)
+	slog.Info("stopped leading",
+		slog.String("lock", e.cfg.Name),
+		slog.String("identity", e.cfg.Identity),
+	)
+	if e.cb.OnStoppedLeading != nil {
+		e.cb.OnStoppedLeading()
+	}
+}
+
+func (e *Elector) setLeader(isLeader bool) {
+	e.mu.Lock()
+	e.isLeader = isLeader
+	e.mu.Unlock()
+
+	if isLeader {
+		leaderGauge.Set(1, e.cfg.Name, e.cfg.Identity)
+		transitions.Inc(e.cfg.Name, e.cfg.Identity)
+	} else {
+		leaderGauge.Set(0, e.cfg.Name, e.cfg.Identity)
+	}
+}
+
+var (
+	// leaderGauge is 1 for the replica that is currently the leader and 0
+	// for all others. Summing by identity shows the current leader.
+	leaderGauge = metrics.NewGauge(
+		"leader_election_is_leader",
+		"Whether this replica is the current leader.",
+		"lock", "identity",
+	)
+
+	// transitions counts how many times this replica became the leader.
+	transitions = metrics.NewCounter(
+		"leader_election_transitions_total",
+		"Number of times this replica became the leader.",
+		"lock", "identity",
+	)
+)
@@ -0,0 +1,256 @@
+package leader
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestMemoryLocker(t *testing.T) {
+	tests := []struct {
+		name    string
+		holder  string
+		advance time.Duration
+		want    bool
+	}{
+		{"renewed by the holder", "a", 0, true},
+		{"rejected while held", "b", 0, false},
+		{"rejected before the expiry", "b", 9 * time.Second, false},
+		{"taken over after the expiry", "b", 10 * time.Second, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			l := NewMemoryLocker()
+			l.UseClock(c)
+			ctx := context.Background()
+			if ok, _ := l.TryLock(ctx, "lock", "a", 10*time.Second); !ok {
+				t.Fatal("got the lock rejected, want it acquired")
+			}
+			c.Advance(tt.advance)
+			if ok, err := l.TryLock(ctx, "lock", tt.holder, 10*time.Second); ok != tt.want || err != nil {
+				t.Errorf("TryLock(%q) = %v, %v, want %v", tt.holder, ok, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestMemoryLockerUnlock(t *testing.T) {
+	tests := []struct {
+		name   string
+		holder string
+		want   bool // whether another holder can take the lock afterwards
+	}{
+		{"by the holder", "a", true},
+		{"by another holder", "b", false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			l := NewMemoryLocker()
+			ctx := context.Background()
+			l.TryLock(ctx, "lock", "a", time.Minute) //nolint:errcheck // cannot fail
+			if err := l.Unlock(ctx, "lock", tt.holder); err != nil {
+				t.Fatalf("unlock: %v", err)
+			}
+			if ok, _ := l.TryLock(ctx, "lock", "c", time.Minute); ok != tt.want {
+				t.Errorf("got %v taking over the lock, want %v", ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestElectorConfig(t *testing.T) {
+	tests := []struct {
+		name  string
+		lease time.Duration
+		renew time.Duration
+		retry time.Duration
+	}{
+		{"no retry period", 2 * time.Second, time.Second, 0},
+		{"no renew deadline", 2 * time.Second, 0, time.Second},
+		{"renew deadline equal to retry", 2 * time.Second, time.Second, time.Second},
+		{"renew deadline shorter than retry", 3 * time.Second, time.Second, 2 * time.Second},
+		{"lease equal to renew deadline", 2 * time.Second, 2 * time.Second, time.Second},
+		{"lease shorter than renew deadline", 2 * time.Second, 3 * time.Second, time.Second},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Config{
+				Name:          "lock",
+				Identity:      "a",
+				LeaseDuration: tt.lease,
+				RenewDeadline: tt.renew,
+				RetryPeriod:   tt.retry,
+			}
+			e := NewElector(cfg, NewMemoryLocker(), Callbacks{})
+			if err := e.Run(context.Background()); !errors.Is(err, service.ErrUnexpected) {
+				t.Errorf("got error %v, want %v", err, service.ErrUnexpected)
+			}
+		})
+	}
+}
+
+func TestElectorFailover(t *testing.T) {
+	c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	l := NewMemoryLocker()
+	l.UseClock(c)
+
+	started := make(chan string, 2)
+	start := func(identity string) (*Elector, context.CancelFunc, <-chan struct{}) {
+		cfg := testConfig
+		cfg.Identity = identity
+		e := NewElector(cfg, l, Callbacks{
+			OnStartedLeading: func(context.Context) { started <- identity },
+		})
+		e.UseClock(c)
+		ctx, cancel := context.WithCancel(context.Background())
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			e.Run(ctx) //nolint:errcheck // the config is valid
+		}()
+		return e, cancel, done
+	}
+
+	a, stopA, doneA := start("a")
+	c.WaitForTimers(1)
+	b, stopB, doneB := start("b")
+	defer func() { stopB(); <-doneB }()
+	c.WaitForTimers(2)
+	if !a.IsLeader() || b.IsLeader() {
+		t.Fatalf("got leaders a=%v b=%v, want a", a.IsLeader(), b.IsLeader())
+	}
+
+	// The leader releases the lock when it stops, so that the follower
+	// takes over on its next retry.
+	stopA()
+	<-doneA
+	if a.IsLeader() {
+		t.Error("got a leading after it stopped")
+	}
+	c.Advance(time.Second)
+	c.WaitForTimers(1)
+	if !b.IsLeader() {
+		t.Error("got b following, want it leading")
+	}
+	for _, want := range []string{"a", "b"} {
+		if got := <-started; got != want {
+			t.Errorf("got OnStartedLeading for %s, want %s", got, want)
+		}
+	}
+}
+
+func TestElectorLockErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		failFor time.Duration
+		want    bool
+	}{
+		{"keeps leading within the renew deadline", 5 * time.Second, true},
+		{"steps down at the renew deadline", 7 * time.Second, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			l := &failingLocker{Locker: NewMemoryLocker()}
+			stopped := make(chan struct{}, 1)
+			e := NewElector(testConfig, l, Callbacks{
+				OnStartedLeading: func(ctx context.Context) {
+					<-ctx.Done()
+					stopped <- struct{}{}
+				},
+			})
+			e.UseClock(c)
+			ctx, cancel := context.WithCancel(context.Background())
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				e.Run(ctx) //nolint:errcheck // the config is valid
+			}()
+			defer func() { cancel(); <-done }()
+
+			c.WaitForTimers(1)
+			l.failing.Store(true)
+			for i := time.Duration(0); i < tt.failFor; i += time.Second {
+				c.Advance(time.Second)
+				c.WaitForTimers(1)
+			}
+			if got := e.IsLeader(); got != tt.want {
+				t.Errorf("got leading %v, want %v", got, tt.want)
+			}
+			if !tt.want {
+				<-stopped // the leader context is cancelled
+			}
+		})
+	}
+}
+
+func TestElectorLockHangs(t *testing.T) {
+	// The renewal is given up at the renew deadline, thus the leader steps
+	// down before its lease expires also if the locker does not return.
+	l := &failingLocker{Locker: NewMemoryLocker()}
+	stopped := make(chan struct{})
+	cfg := Config{
+		Name:          "lock",
+		Identity:      "a",
+		LeaseDuration: time.Second,
+		RenewDeadline: 100 * time.Millisecond,
+		RetryPeriod:   10 * time.Millisecond,
+	}
+	e := NewElector(cfg, l, Callbacks{OnStoppedLeading: func() { close(stopped) }})
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		e.Run(ctx) //nolint:errcheck // the config is valid
+	}()
+	defer func() { cancel(); <-done }()
+
+	for !e.IsLeader() {
+		time.Sleep(time.Millisecond)
+	}
+	l.hanging.Store(true)
+	select {
+	case <-stopped:
+	case <-time.After(cfg.LeaseDuration):
+		t.Fatal("got the leader leading after its lease expired")
+	}
+}
+
+// testConfig is the config of the elector tests that use the fake clock.
+var testConfig = Config{
+	Name:          "lock",
+	Identity:      "a",
+	LeaseDuration: 10 * time.Second,
+	RenewDeadline: 7 * time.Second,
+	RetryPeriod:   time.Second,
+}
+
+// failingLocker is a [Locker] failing to lock while failing is set, and
+// blocking until ctx is done while hanging is set.
+type failingLocker struct {
+	Locker
+	failing atomic.Bool
+	hanging atomic.Bool
+}
+
+func (l *failingLocker) TryLock(ctx context.Context, name, holder string, ttl time.Duration) (bool, error) {
+	if l.failing.Load() {
+		return false, errors.New("unavailable")
+	}
+	if l.hanging.Load() {
+		<-ctx.Done()
+		return false, ctx.Err()
+	}
+	return l.Locker.TryLock(ctx, name, holder, ttl)
+}
@@ -0,0 +1,68 @@
+package leader
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+// MemoryLocker is a [Locker] that keeps the locks in memory. It can only be
+// used to elect a leader between components of the same process, which is
+// useful for tests and for running a single replica locally.
+type MemoryLocker struct {
+	mu    sync.Mutex
+	locks map[string]memoryLock
+	clock clock.Clock
+}
+
+var _ Locker = (*MemoryLocker)(nil)
+
+// NewMemoryLocker creates a new [MemoryLocker].
+func NewMemoryLocker() *MemoryLocker {
+	return &MemoryLocker{locks: make(map[string]memoryLock), clock: clock.Real}
+}
+
+// UseClock makes the locker use the given clock for expiring the locks, e.g. a
+// fake clock in tests.
+func (l *MemoryLocker) UseClock(c clock.Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock.Or(c)
+}
+
+// TryLock implements the [Locker] interface.
+func (l *MemoryLocker) TryLock(
+	_ context.Context,
+	name string,
+	holder string,
+	ttl time.Duration,
+) (bool, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.clock.Now()
+	if lock, ok := l.locks[name]; ok && lock.holder != holder && now.Before(lock.expires) {
+		return false, nil
+	}
+	l.locks[name] = memoryLock{holder: holder, expires: now.Add(ttl)}
+	return true, nil
+}
+
+// Unlock implements the [Locker] interface.
+func (l *MemoryLocker) Unlock(_ context.Context, name, holder string) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if lock, ok := l.locks[name]; ok && lock.holder == holder {
+		delete(l.locks, name)
+	}
+	return nil
+}
+
+// memoryLock is a lock held by a [MemoryLocker].
+type memoryLock struct {
+	holder  string
+	expires time.Time
+}
@@ -0,0 +1,120 @@
+// Package lifecycle runs a [service.CloudService] from start up to shutdown.
+//
+// [service.Start] initializes the service and serves it until a stop signal,
+// but never releases what Init acquired, only logs its failures, and closes
+// the listeners the moment the signal arrives. [Start] serves the service
+// with [Run] instead, which returns the failures, takes the service out of
+// rotation before the listeners close, see [Config.ShutdownDelay], and then
+// shuts the service down if it implements [Shutdowner], so that the database
+// clients, the bus connections and the listeners are released
+// deterministically on SIGTERM instead of being abandoned on exit.
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/health"
+	"github.com/eventscompass/service-template/src/internal/middleware"
+)
+
+// Config encapsulates the configuration of the lifecycle of the service.
+type Config struct {
+	// ShutdownGracePeriod is the time given to the service to
+	// release its resources once it is stopped, e.g. for the
+	// background workers to return, see [Shutdown].
+	ShutdownGracePeriod time.Duration `env:"SHUTDOWN_GRACE_PERIOD" envDefault:"30s"`
+
+	// ShutdownDelay keeps the service serving once it receives a
+	// stop signal, while its readiness fails, so that the load
+	// balancers take it out of rotation before the listeners close,
+	// e.g. for the period of the readiness probe.
+	ShutdownDelay time.Duration `env:"SHUTDOWN_DELAY" envDefault:"0s"`
+}
+
+// Shutdowner is implemented by services that release resources once they
+// stop, e.g. close their database clients and bus connections.
+type Shutdowner interface {
+	// Shutdown releases the resources of the service. It is called
+	// once the servers of the service are shut down, even if the
+	// service failed to initialize, thus it must handle partially
+	// initialized services. The resources should be released before
+	// the ctx is done.
+	Shutdown(ctx context.Context) error
+}
+
+// Start runs the service with [Run], with its rest handler wrapped with its
+// middleware stack, see [middleware.Apply], until it receives a stop signal,
+// and then shuts it down, see [Shutdown]. On the stop signal the readiness
+// checks fail, see [health.Registry.Drain], and the service keeps serving
+// for the shutdown delay before its servers are stopped. The cfg is read once
+// the service is initialized, thus it may be parsed by Init. The errors of
+// [Run] and of the shutdown are returned joined, so that the binary exits
+// with a non-zero status.
+func Start(s service.CloudService, cfg *Config) error {
+	sig, stop := signal.NotifyContext(context.Background(), stopSignals...)
+	defer stop()
+	ready := health.NewRegistry()
+	ctx, cancel := context.WithCancel(health.WithRegistry(context.Background(), ready))
+	defer cancel()
+
+	go func() {
+		select {
+		case <-sig.Done():
+		case <-ctx.Done(): // the service failed
+			return
+		}
+		slog.Info("received stop signal")
+		ready.Drain()
+		if cfg.ShutdownDelay > 0 {
+			slog.Info("draining the service before shutdown", slog.Duration("delay", cfg.ShutdownDelay))
+			select {
+			case <-time.After(cfg.ShutdownDelay):
+			case <-ctx.Done():
+			}
+		}
+		cancel()
+	}()
+
+	err := Run(ctx, middleware.Apply(s))
+	cancel()
+	return errors.Join(err, Shutdown(s, cfg.ShutdownGracePeriod))
+}
+
+// Shutdown shuts down the service, if it implements [Shutdowner], giving it
+// the grace period to release its resources. This function returns
+// [service.ErrTimeOut] in case the service did not shut down in time, and the
+// errors of the service otherwise.
+func Shutdown(s service.CloudService, grace time.Duration) error {
+	sd, ok := s.(Shutdowner)
+	if !ok {
+		return nil
+	}
+	ctx := context.Background()
+	if grace > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, grace)
+		defer cancel()
+	}
+
+	slog.Info("shutting down the service")
+	done := make(chan error, 1)
+	go func() { done <- sd.Shutdown(ctx) }()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return fmt.Errorf("%w: shut down the service: %v", service.ErrTimeOut, ctx.Err())
+	}
+}
+
+// stopSignals are the signals that stop [Start].
+var stopSignals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
@@ -0,0 +1,158 @@
+package lifecycle
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/caarlos0/env/v6"
+	"github.com/eventscompass/service-framework/service"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/eventscompass/service-template/src/internal/health"
+	"github.com/eventscompass/service-template/src/internal/listen"
+)
+
+// Run initializes the service and serves it until ctx is done, like
+// [service.Start] does until a stop signal: the rest and grpc servers are
+// started on the addresses of [service.RESTConfig] and [service.GRPCConfig],
+// and the events of the service are subscribed to. The listeners are bound
+// with [listen.Listen], thus they are inherited from systemd or bound with
+// SO_REUSEPORT like the other listeners of the service. The Init of the
+// service gets ctx, thus its workers are stopped with the servers. Unless ctx
+// carries one already, it is given a new readiness registry, see
+// [health.WithRegistry], so that every service run has checks of its own.
+//
+// Unlike [service.Start], Run returns its failures: the error of Init,
+// [service.ErrBadRequest] in case the environment variables of the servers
+// are malformed, and [service.ErrUnexpected] in case a server or a
+// subscription failed, or Init panicked. The service is not shut down, see
+// [Shutdown].
+func Run(ctx context.Context, s service.CloudService) error {
+	if _, ok := health.RegistryFrom(ctx); !ok {
+		ctx = health.WithRegistry(ctx, health.NewRegistry())
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if err := initService(ctx, s); err != nil {
+		return err
+	}
+
+	// The servers and the subscriptions run in an error group. If any of
+	// them fails, the ctx of the group is cancelled and the others stop.
+	g, gctx := errgroup.WithContext(ctx)
+	fail := func(err error) error {
+		cancel()
+		g.Wait() //nolint:errcheck,gosec // the servers started so far are stopped
+		return err
+	}
+	if h := s.REST(); h != nil {
+		if err := serveREST(gctx, g, h); err != nil {
+			return fail(err)
+		}
+	}
+	if srv := s.GRPC(); srv != nil {
+		var cfg service.GRPCConfig
+		if err := env.Parse(&cfg); err != nil {
+			return fail(fmt.Errorf("%w: parse grpc environment variables: %v", service.ErrBadRequest, err))
+		}
+		l, err := listen.Listen("grpc", cfg.Listen)
+		if err != nil {
+			return fail(fmt.Errorf("grpc server: %w", err))
+		}
+		slog.Info("starting grpc server", slog.String("port", cfg.Listen))
+		g.Go(func() error {
+			if err := srv.Serve(l); err != nil {
+				return fmt.Errorf("%w: serve grpc: %v", service.ErrUnexpected, err)
+			}
+			return nil
+		})
+		g.Go(func() error {
+			<-gctx.Done()
+			slog.Info("shutting down grpc server")
+			srv.GracefulStop()
+			return nil
+		})
+	}
+	if events := s.Events(); events != nil {
+		bus := s.Bus()
+		if bus == nil {
+			return fail(fmt.Errorf("%w: message bus not initialized", service.ErrUnexpected))
+		}
+		for topic, h := range events {
+			topic, h := topic, h
+			slog.Info("subscribing for events", slog.String("topic", topic))
+			g.Go(func() error {
+				if err := bus.Subscribe(gctx, topic, h); err != nil {
+					return fmt.Errorf("%w: subscription to %s: %v", service.ErrUnexpected, topic, err)
+				}
+				return nil
+			})
+		}
+	}
+	// Block until ctx is done, also if the service serves nothing.
+	g.Go(func() error {
+		<-gctx.Done()
+		return nil
+	})
+	return g.Wait() //nolint:wrapcheck // wrapped by the goroutines
+}
+
+// initService calls the Init of the service. This function returns
+// [service.ErrUnexpected] in case Init panics.
+func initService(ctx context.Context, s service.CloudService) (err error) {
+	defer func() {
+		if msg := recover(); msg != nil {
+			err = fmt.Errorf("%w: init service: panic: %v", service.ErrUnexpected, msg)
+		}
+	}()
+	if err := s.Init(ctx); err != nil {
+		return fmt.Errorf("init service: %w", err)
+	}
+	return nil
+}
+
+// serveREST starts the rest server in the group, and shuts it down once ctx is
+// done.
+func serveREST(ctx context.Context, g *errgroup.Group, h http.Handler) error {
+	var cfg service.RESTConfig
+	if err := env.Parse(&cfg); err != nil {
+		return fmt.Errorf("%w: parse rest environment variables: %v", service.ErrBadRequest, err)
+	}
+	l, err := listen.Listen("rest", cfg.Listen)
+	if err != nil {
+		return fmt.Errorf("rest server: %w", err)
+	}
+
+	// The timeouts of the server are deadlines of the connection, which do
+	// not stop the handler, thus the handler is stopped by a timeout of its
+	// own, like service.Start does. The write timeout leaves a margin for
+	// writing the timeout response.
+	srv := &http.Server{
+		WriteTimeout:      cfg.WriteTimeout + timeoutMargin,
+		ReadTimeout:       cfg.ReadTimeout,
+		ReadHeaderTimeout: cfg.ReadHeaderTimeout,
+		Addr:              cfg.Listen,
+		Handler:           http.TimeoutHandler(h, cfg.WriteTimeout, "timeout"),
+	}
+	slog.Info("starting rest server", slog.String("port", cfg.Listen))
+	g.Go(func() error {
+		if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+			return fmt.Errorf("%w: serve rest: %v", service.ErrUnexpected, err)
+		}
+		return nil
+	})
+	g.Go(func() error {
+		<-ctx.Done()
+		slog.Info("shutting down rest server")
+		return srv.Shutdown(context.Background()) //nolint:contextcheck,wrapcheck // intentional
+	})
+	return nil
+}
+
+// timeoutMargin is the time given to the rest handlers to write the timeout
+// response, see serveREST.
+const timeoutMargin = 2 * time.Second
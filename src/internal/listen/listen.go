@@ -0,0 +1,137 @@
+// Package listen binds the listeners of the servers run by the template, i.e.
+// the rest, grpc, admin and streaming servers, for zero-downtime restarts on
+// bare metal:
+//
+//   - with systemd socket activation, the sockets are bound by systemd and
+//     inherited by every version of the process, thus connections queue up
+//     while the process restarts instead of being refused;
+//   - with LISTEN_REUSEPORT, the sockets are bound with SO_REUSEPORT, thus a
+//     new version of the process binds the ports alongside the old one, which
+//     drains its connections once it is stopped.
+package listen
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Config encapsulates the configuration for binding the listeners.
+type Config struct {
+	// ReusePort binds the listeners with SO_REUSEPORT, unless
+	// they are inherited from systemd.
+	ReusePort bool `env:"LISTEN_REUSEPORT" envDefault:"false"`
+}
+
+// Configure configures the binding of the listeners. It is usually called once
+// on Init, before the servers start.
+func Configure(cfg Config) {
+	if cfg.ReusePort {
+		slog.Info("binding listeners with SO_REUSEPORT")
+	}
+	current.Store(&cfg)
+}
+
+// Listen returns the tcp listener for the named server on the address, e.g.
+// ":10070". A socket inherited from systemd is used if its name, as set by
+// FileDescriptorName= in the socket unit, is the name of the server, or if it
+// is bound to the port of the address. Otherwise a new socket is bound. This
+// function returns [service.ErrUnexpected] in case the socket cannot be bound.
+func Listen(name, addr string) (net.Listener, error) {
+	if f := inherited(name, addr); f != nil {
+		l, err := net.FileListener(f) // duplicates the socket, f stays usable
+		if err != nil {
+			return nil, fmt.Errorf("%w: inherited socket %s: %v", service.ErrUnexpected, f.Name(), err)
+		}
+		slog.Info("using inherited socket",
+			slog.String("server", name), slog.String("addr", l.Addr().String()))
+		return l, nil
+	}
+
+	lc := net.ListenConfig{}
+	if cfg := current.Load(); cfg != nil && cfg.ReusePort {
+		lc.Control = reusePort
+	}
+	l, err := lc.Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("%w: listen on %s: %v", service.ErrUnexpected, addr, err)
+	}
+	return l, nil
+}
+
+// inherited returns the socket inherited from systemd for the server, or nil.
+func inherited(name, addr string) *os.File {
+	filesOnce.Do(func() { files = activationFiles() })
+	_, port, _ := net.SplitHostPort(addr) //nolint:errcheck // bound to fail on Listen
+	for _, f := range files {
+		if f.Name() == name {
+			return f
+		}
+	}
+	for _, f := range files {
+		// Unnamed sockets are matched by their port.
+		l, err := net.FileListener(f)
+		if err != nil {
+			continue
+		}
+		_, lport, _ := net.SplitHostPort(l.Addr().String()) //nolint:errcheck // listener address
+		l.Close()                                           //nolint:errcheck,gosec // probe only
+		if lport == port {
+			return f
+		}
+	}
+	return nil
+}
+
+// activationFiles returns the sockets passed by systemd, following the
+// protocol of sd_listen_fds(3): the sockets are the file descriptors starting
+// at 3, their number is in LISTEN_FDS, and LISTEN_PID is the pid they are
+// meant for. The variables are unset, so that child processes do not take the
+// sockets for theirs.
+func activationFiles() []*os.File {
+	defer func() {
+		os.Unsetenv("LISTEN_PID")     //nolint:errcheck,gosec // best effort
+		os.Unsetenv("LISTEN_FDS")     //nolint:errcheck,gosec // best effort
+		os.Unsetenv("LISTEN_FDNAMES") //nolint:errcheck,gosec // best effort
+	}()
+	pid, err := strconv.Atoi(os.Getenv("LISTEN_PID"))
+	if err != nil || pid != os.Getpid() {
+		return nil
+	}
+	n, err := strconv.Atoi(os.Getenv("LISTEN_FDS"))
+	if err != nil || n <= 0 {
+		return nil
+	}
+	names := strings.Split(os.Getenv("LISTEN_FDNAMES"), ":")
+	res := make([]*os.File, 0, n)
+	for i := 0; i < n; i++ {
+		fd := listenFdsStart + i
+		closeOnExec(fd)
+		name := "LISTEN_FD_" + strconv.Itoa(fd)
+		if i < len(names) && names[i] != "" {
+			name = names[i]
+		}
+		res = append(res, os.NewFile(uintptr(fd), name))
+	}
+	return res
+}
+
+// listenFdsStart is the first file descriptor passed by systemd.
+const listenFdsStart = 3
+
+var (
+	// current is the configuration set with [Configure].
+	current atomic.Pointer[Config]
+
+	// files are the sockets inherited from systemd.
+	files     []*os.File
+	filesOnce sync.Once
+)
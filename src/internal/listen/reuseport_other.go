@@ -0,0 +1,17 @@
+//go:build !unix
+
+package listen
+
+import (
+	"errors"
+	"syscall"
+)
+
+// reusePort fails, since SO_REUSEPORT is not supported on this platform.
+func reusePort(_, _ string, _ syscall.RawConn) error {
+	return errors.New("SO_REUSEPORT is not supported on this platform")
+}
+
+// closeOnExec is a no-op, since socket activation is not supported on this
+// platform.
+func closeOnExec(int) {}
@@ -0,0 +1,24 @@
+//go:build unix
+
+package listen
+
+import (
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// reusePort sets SO_REUSEPORT on the socket before it is bound.
+func reusePort(_, _ string, c syscall.RawConn) error {
+	var serr error
+	err := c.Control(func(fd uintptr) {
+		serr = unix.SetsockoptInt(int(fd), unix.SOL_SOCKET, unix.SO_REUSEPORT, 1)
+	})
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by Listen
+	}
+	return serr //nolint:wrapcheck // wrapped by Listen
+}
+
+// closeOnExec keeps an inherited socket from leaking into child processes.
+func closeOnExec(fd int) { unix.CloseOnExec(fd) }
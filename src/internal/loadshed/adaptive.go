@@ -0,0 +1,164 @@
+package loadshed
+
+import (
+	"math"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	svcmetrics "github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// AdaptiveConfig encapsulates the configuration of an [AdaptiveLimiter].
+type AdaptiveConfig struct {
+	// InitialLimit is the concurrency limit on startup. It should
+	// be low, so that the limiter learns the latency without
+	// queueing. The limit grows quickly from there.
+	InitialLimit int `env:"LOADSHED_ADAPTIVE_INITIAL_LIMIT" envDefault:"20"`
+
+	// MinLimit and MaxLimit bound the concurrency limit. Zero
+	// means no upper bound.
+	MinLimit int `env:"LOADSHED_ADAPTIVE_MIN_LIMIT" envDefault:"10"`
+	MaxLimit int `env:"LOADSHED_ADAPTIVE_MAX_LIMIT" envDefault:"1000"`
+
+	// Window is the duration over which the latencies are
+	// averaged before the limit is adjusted.
+	Window time.Duration `env:"LOADSHED_ADAPTIVE_WINDOW" envDefault:"1s"`
+
+	// Smoothing is the weight of a new limit, between 0 and 1.
+	// Lower values make the limit change slower.
+	Smoothing float64 `env:"LOADSHED_ADAPTIVE_SMOOTHING" envDefault:"0.2"`
+
+	// Tolerance is the factor by which the latency may exceed the
+	// lowest latency before the limit shrinks.
+	Tolerance float64 `env:"LOADSHED_ADAPTIVE_TOLERANCE" envDefault:"2"`
+}
+
+// AdaptiveLimiter limits the number of concurrent requests to a limit that is
+// tuned continuously from the observed latency, following the gradient
+// algorithm of Netflix' concurrency-limits.
+//
+// The limiter compares the average latency of the last window with the lowest
+// latency observed recently, which approximates the latency without queueing.
+// While the latency stays within the tolerance, the limit grows by a small
+// queue allowance, probing for more capacity. Once requests start to queue up
+// in the service and the latency rises, the limit shrinks proportionally to the
+// increase. Thus the limit settles around the concurrency the service can
+// handle without queueing, without having to configure it upfront.
+type AdaptiveLimiter struct {
+	cfg   AdaptiveConfig
+	clock clock.Clock
+
+	mu          sync.Mutex
+	limit       float64
+	inFlight    int
+	maxInFlight int // within the current window
+	minRTT      float64
+	windows     int // since minRTT was reset
+	windowStart time.Time
+	windowSum   time.Duration
+	windowCount int
+}
+
+// NewAdaptiveLimiter creates a new [AdaptiveLimiter].
+func NewAdaptiveLimiter(cfg AdaptiveConfig) *AdaptiveLimiter {
+	l := &AdaptiveLimiter{cfg: cfg, clock: clock.Real, windowStart: time.Now()}
+	l.limit = l.clamp(float64(cfg.InitialLimit))
+	concurrencyLimit.Set(l.limit)
+	return l
+}
+
+// UseClock makes the limiter use the given clock for measuring the latencies
+// and the windows, e.g. a fake clock in tests. The current window starts anew.
+func (l *AdaptiveLimiter) UseClock(c clock.Clock) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.clock = clock.Or(c)
+	l.windowStart = l.clock.Now()
+}
+
+// TryAcquire admits a request if the number of requests in flight is below the
+// limit. The caller must call release once the request is done, which records
+// the latency of the request.
+func (l *AdaptiveLimiter) TryAcquire() (release func(), ok bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.inFlight >= int(l.limit) {
+		return nil, false
+	}
+	l.inFlight++
+	l.maxInFlight = max(l.maxInFlight, l.inFlight)
+
+	c := l.clock
+	start := c.Now()
+	var once sync.Once
+	return func() { once.Do(func() { l.record(clock.Since(c, start)) }) }, true
+}
+
+// Limit returns the current concurrency limit.
+func (l *AdaptiveLimiter) Limit() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return int(l.limit)
+}
+
+// record records the latency of a completed request, and adjusts the limit
+// once the window is complete.
+func (l *AdaptiveLimiter) record(latency time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.inFlight--
+	l.windowSum += latency
+	l.windowCount++
+
+	now := l.clock.Now()
+	if now.Sub(l.windowStart) < l.cfg.Window || l.windowCount < minWindowSamples {
+		return
+	}
+	shortRTT := float64(l.windowSum) / float64(l.windowCount)
+	appLimited := l.maxInFlight < int(l.limit)/2
+	l.windowStart, l.windowSum, l.windowCount, l.maxInFlight = now, 0, 0, l.inFlight
+
+	// The lowest latency is forgotten regularly, so that the limiter
+	// follows lasting changes, e.g. a slower database.
+	if l.windows++; l.minRTT == 0 || shortRTT < l.minRTT || l.windows > minRTTWindows {
+		l.minRTT, l.windows = shortRTT, 0
+	}
+
+	// The gradient is 1 while the latency is within the tolerance, and
+	// falls towards 0.5 when requests queue up.
+	tolerance := math.Max(l.cfg.Tolerance, 1)
+	gradient := math.Max(0.5, math.Min(1, tolerance*l.minRTT/shortRTT)) //nolint:gomnd // bounds
+	newLimit := l.limit*gradient + math.Sqrt(l.limit)
+	if appLimited && newLimit > l.limit {
+		// The service did not use the limit, so it is unknown whether
+		// it could handle more.
+		return
+	}
+	l.limit = l.clamp((1-l.cfg.Smoothing)*l.limit + l.cfg.Smoothing*newLimit)
+	concurrencyLimit.Set(l.limit)
+}
+
+// clamp bounds the limit by the configured minimum and maximum.
+func (l *AdaptiveLimiter) clamp(limit float64) float64 {
+	if l.cfg.MaxLimit > 0 {
+		limit = math.Min(limit, float64(l.cfg.MaxLimit))
+	}
+	return math.Max(limit, math.Max(float64(l.cfg.MinLimit), 1))
+}
+
+const (
+	// minWindowSamples is the minimum number of requests within a window
+	// that are needed for adjusting the limit.
+	minWindowSamples = 10
+
+	// minRTTWindows is the number of windows after which the lowest latency
+	// is reset.
+	minRTTWindows = 100
+)
+
+// concurrencyLimit exposes the current limit of the adaptive limiter.
+var concurrencyLimit = svcmetrics.NewGauge(
+	"loadshed_concurrency_limit",
+	"Current concurrency limit of the adaptive limiter.",
+)
@@ -0,0 +1,97 @@
+package loadshed
+
+import (
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestAdaptiveLimiter(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  AdaptiveConfig
+		// latencies are the latencies of the windows. Every window has
+		// as many requests in flight as the limit allows, unless
+		// concurrency is set.
+		latencies   []time.Duration
+		concurrency int
+		want        func(before, after int) bool
+	}{
+		{
+			name:      "grows while the latency is steady",
+			latencies: []time.Duration{time.Second, time.Second, time.Second},
+			want:      func(before, after int) bool { return after > before },
+		},
+		{
+			name:      "grows within the tolerance",
+			latencies: []time.Duration{time.Second, time.Second, 1500 * time.Millisecond},
+			want:      func(before, after int) bool { return after > before },
+		},
+		{
+			name:      "shrinks when the latency rises",
+			latencies: []time.Duration{time.Second, time.Second, 5 * time.Second},
+			want:      func(before, after int) bool { return after < before },
+		},
+		{
+			name:        "keeps the limit if the service does not use it",
+			latencies:   []time.Duration{time.Second, time.Second, time.Second},
+			concurrency: 9,
+			want:        func(before, after int) bool { return after == before },
+		},
+		{
+			name:      "bounded by the max limit",
+			cfg:       AdaptiveConfig{MaxLimit: 22},
+			latencies: []time.Duration{time.Second, time.Second, time.Second, time.Second},
+			want:      func(_, after int) bool { return after == 22 },
+		},
+		{
+			name:      "bounded by the min limit",
+			cfg:       AdaptiveConfig{MinLimit: 18},
+			latencies: []time.Duration{time.Second, 10 * time.Second, 10 * time.Second, 10 * time.Second},
+			want:      func(_, after int) bool { return after == 18 },
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := AdaptiveConfig{InitialLimit: 20, MinLimit: 1, Window: time.Second, Smoothing: 0.5, Tolerance: 2}
+			if tt.cfg.MinLimit != 0 {
+				cfg.MinLimit = tt.cfg.MinLimit
+			}
+			cfg.MaxLimit = tt.cfg.MaxLimit
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			l := NewAdaptiveLimiter(cfg)
+			l.UseClock(c)
+
+			window := func(latency time.Duration) {
+				n := l.Limit()
+				if tt.concurrency != 0 {
+					n = tt.concurrency
+				}
+				var releases []func()
+				for i := 0; i < n; i++ {
+					release, ok := l.TryAcquire()
+					if !ok {
+						t.Fatalf("got request %d of %d rejected", i, n)
+					}
+					releases = append(releases, release)
+				}
+				c.Advance(latency)
+				for _, release := range releases {
+					release()
+				}
+			}
+			for _, latency := range tt.latencies {
+				window(latency)
+			}
+			// A window is evaluated by the first request completing after
+			// it, thus the last latency needs another window.
+			before := l.Limit()
+			window(tt.latencies[len(tt.latencies)-1])
+			if after := l.Limit(); !tt.want(before, after) {
+				t.Errorf("got limit %d after %d", after, before)
+			}
+		})
+	}
+}
@@ -0,0 +1,258 @@
+// Package loadshed protects the service from overload by rejecting excess
+// requests early.
+//
+// An overloaded service that accepts every request gets slower for all of its
+// callers. Instead, the [Shedder] admits only as many requests as the service
+// can handle and rejects the others with 503, so that the callers can retry on
+// another replica and the admitted requests keep their latency. The number of
+// concurrent requests is either a static limit, or is tuned from the observed
+// latency by an [AdaptiveLimiter].
+package loadshed
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/metrics"
+	"strings"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/httperr"
+	svcmetrics "github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// ErrOverloaded is returned when a request is rejected because the service is
+// overloaded. The callers are told to retry, with a 503 and a Retry-After
+// header, or with codes.Unavailable.
+var ErrOverloaded = httperr.New("service overloaded", httperr.Response{
+	Status: http.StatusServiceUnavailable, // 503
+	Header: http.Header{"Retry-After": {"1"}},
+	Log:    "rejected request",
+	Level:  slog.LevelDebug,
+})
+
+// Config encapsulates the configuration of the load shedding.
+type Config struct {
+	// MaxInFlight is the number of requests that are processed
+	// concurrently. Zero disables the limit. It is ignored if the
+	// adaptive limit is enabled.
+	MaxInFlight int `env:"LOADSHED_MAX_IN_FLIGHT" envDefault:"1000"`
+
+	// Adaptive replaces the static in-flight limit with an
+	// [AdaptiveLimiter]. Requests over the adaptive limit are
+	// rejected without waiting.
+	Adaptive      bool `env:"LOADSHED_ADAPTIVE" envDefault:"false"`
+	AdaptiveLimit AdaptiveConfig
+
+	// MaxQueueTime is how long a request waits for one of the
+	// in-flight slots before it is rejected.
+	MaxQueueTime time.Duration `env:"LOADSHED_MAX_QUEUE_TIME" envDefault:"100ms"`
+
+	// MaxHeapBytes rejects all requests while the heap is larger.
+	// Zero disables the check.
+	MaxHeapBytes uint64 `env:"LOADSHED_MAX_HEAP_BYTES" envDefault:"0"`
+
+	// ExemptPaths are never rejected, e.g. the health probes. A
+	// trailing "*" matches any suffix.
+	ExemptPaths []string `env:"LOADSHED_EXEMPT_PATHS"`
+}
+
+// Shedder admits requests while the service has capacity.
+type Shedder struct {
+	cfg      Config
+	clock    clock.Clock
+	slots    chan struct{}
+	adaptive *AdaptiveLimiter
+
+	mu        sync.Mutex
+	heapBytes uint64
+	sampled   time.Time
+}
+
+// NewShedder creates a new [Shedder].
+func NewShedder(cfg Config) *Shedder {
+	s := &Shedder{cfg: cfg, clock: clock.Real}
+	switch {
+	case cfg.Adaptive:
+		s.adaptive = NewAdaptiveLimiter(cfg.AdaptiveLimit)
+	case cfg.MaxInFlight > 0:
+		s.slots = make(chan struct{}, cfg.MaxInFlight)
+	}
+	return s
+}
+
+// UseClock makes the shedder use the given clock for the queue time, the heap
+// sampling and the adaptive limit, e.g. a fake clock in tests. UseClock must be
+// called before the shedder is used.
+func (s *Shedder) UseClock(c clock.Clock) {
+	s.clock = clock.Or(c)
+	if s.adaptive != nil {
+		s.adaptive.UseClock(c)
+	}
+}
+
+// Acquire admits a request. The caller must call release once the request is
+// done. This function returns [ErrOverloaded] in case the request is rejected.
+func (s *Shedder) Acquire(ctx context.Context) (release func(), err error) {
+	if s.cfg.MaxHeapBytes > 0 && s.heap() > s.cfg.MaxHeapBytes {
+		rejected.Inc("memory")
+		return nil, fmt.Errorf("%w: heap exceeds %d bytes", ErrOverloaded, s.cfg.MaxHeapBytes)
+	}
+	free, err := s.acquire(ctx)
+	if err != nil {
+		return nil, err
+	}
+	inFlight.Inc()
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			inFlight.Dec()
+			free()
+		})
+	}, nil
+}
+
+// acquire admits a request by the adaptive limit, by the static limit, or
+// without a limit, and returns the function releasing it.
+func (s *Shedder) acquire(ctx context.Context) (release func(), err error) {
+	if s.adaptive != nil {
+		release, ok := s.adaptive.TryAcquire()
+		if !ok {
+			rejected.Inc("concurrency_limit")
+			return nil, fmt.Errorf("%w: concurrency limit reached", ErrOverloaded)
+		}
+		return release, nil
+	}
+	if s.slots == nil {
+		return func() {}, nil
+	}
+
+	select {
+	case s.slots <- struct{}{}:
+	default:
+		// All slots are taken, wait for one to become free.
+		t := s.clock.NewTimer(s.cfg.MaxQueueTime)
+		defer t.Stop()
+		select {
+		case s.slots <- struct{}{}:
+		case <-t.C():
+			rejected.Inc("queue_time")
+			return nil, fmt.Errorf("%w: no capacity within %v", ErrOverloaded, s.cfg.MaxQueueTime)
+		case <-ctx.Done():
+			return nil, ctx.Err() //nolint:wrapcheck // caller gave up
+		}
+	}
+	return func() { <-s.slots }, nil
+}
+
+// Middleware returns an http middleware admitting the requests, see
+// [Shedder.Acquire]. Rejected requests get 503.
+func (s *Shedder) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if exempt(s.cfg.ExemptPaths, r.URL.Path) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			release, err := s.Acquire(r.Context())
+			if err != nil {
+				httperr.Write(r.Context(), w, err)
+				return
+			}
+			defer release()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UnaryServerInterceptor returns a grpc interceptor admitting the calls, see
+// [Shedder.Acquire]. Rejected calls fail with codes.Unavailable.
+func (s *Shedder) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		release, err := s.Acquire(ctx)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		defer release()
+		return handler(ctx, req)
+	}
+}
+
+// heap returns the size of the heap, sampled at most every sampleInterval.
+func (s *Shedder) heap() uint64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if clock.Since(s.clock, s.sampled) < sampleInterval {
+		return s.heapBytes
+	}
+	sample := []metrics.Sample{{Name: heapMetric}}
+	metrics.Read(sample)
+	if sample[0].Value.Kind() == metrics.KindUint64 {
+		s.heapBytes = sample[0].Value.Uint64()
+	}
+	s.sampled = s.clock.Now()
+	return s.heapBytes
+}
+
+// grpcError converts the error of [Shedder.Acquire] to a grpc status.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, ErrOverloaded):
+		return status.Error(codes.Unavailable, err.Error())
+	case errors.Is(err, context.DeadlineExceeded):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	default:
+		return status.Error(codes.Canceled, err.Error())
+	}
+}
+
+// exempt reports whether the path matches any of the exempt paths.
+func exempt(paths []string, path string) bool {
+	for _, p := range paths {
+		if prefix, ok := strings.CutSuffix(p, "*"); ok {
+			if strings.HasPrefix(path, prefix) {
+				return true
+			}
+		} else if p == path {
+			return true
+		}
+	}
+	return false
+}
+
+const (
+	// heapMetric is the runtime metric of the memory occupied by live and
+	// not yet collected heap objects.
+	heapMetric = "/memory/classes/heap/objects:bytes"
+
+	// sampleInterval limits how often the heap size is read.
+	sampleInterval = time.Second
+)
+
+var (
+	// inFlight counts the admitted requests in flight.
+	inFlight = svcmetrics.NewGauge(
+		"loadshed_in_flight_requests",
+		"Number of admitted requests in flight.",
+	)
+
+	// rejected counts the rejected requests.
+	rejected = svcmetrics.NewCounter(
+		"loadshed_rejected_total",
+		"Number of requests rejected because the service is overloaded.",
+		"reason",
+	)
+)
@@ -0,0 +1,215 @@
+package loadshed
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestShedderAcquire(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+		// wait acts while the second request waits for a slot.
+		wait    func(c *servicetest.FakeClock, release func(), cancel context.CancelFunc)
+		wantErr error
+	}{
+		{
+			name: "admitted once a slot is free",
+			cfg:  Config{MaxInFlight: 1, MaxQueueTime: time.Second},
+			wait: func(c *servicetest.FakeClock, release func(), _ context.CancelFunc) {
+				c.Advance(time.Second - time.Millisecond)
+				release()
+			},
+		},
+		{
+			name: "rejected after the queue time",
+			cfg:  Config{MaxInFlight: 1, MaxQueueTime: time.Second},
+			wait: func(c *servicetest.FakeClock, _ func(), _ context.CancelFunc) {
+				c.Advance(time.Second)
+			},
+			wantErr: ErrOverloaded,
+		},
+		{
+			name: "cancelled while queueing",
+			cfg:  Config{MaxInFlight: 1, MaxQueueTime: time.Second},
+			wait: func(_ *servicetest.FakeClock, _ func(), cancel context.CancelFunc) {
+				cancel()
+			},
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			s := NewShedder(tt.cfg)
+			s.UseClock(c)
+			first, err := s.Acquire(context.Background())
+			if err != nil {
+				t.Fatalf("acquire: %v", err)
+			}
+			defer first()
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			errc := make(chan error, 1)
+			go func() {
+				release, err := s.Acquire(ctx)
+				if err == nil {
+					release()
+				}
+				errc <- err
+			}()
+			c.WaitForTimers(1) // the second request waits for a slot
+			tt.wait(c, first, cancel)
+			if err := <-errc; !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestShedderInFlight(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  Config
+	}{
+		{"unlimited", Config{}},
+		{"static", Config{MaxInFlight: 10}},
+		{"adaptive", Config{Adaptive: true, AdaptiveLimit: AdaptiveConfig{InitialLimit: 10, MinLimit: 1, Window: time.Second}}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewShedder(tt.cfg)
+			before := gauge(t, "loadshed_in_flight_requests")
+			var releases []func()
+			for i := 0; i < 3; i++ {
+				release, err := s.Acquire(context.Background())
+				if err != nil {
+					t.Fatalf("acquire: %v", err)
+				}
+				releases = append(releases, release)
+			}
+			if got := gauge(t, "loadshed_in_flight_requests") - before; got != 3 {
+				t.Errorf("got %v requests in flight, want 3", got)
+			}
+			for _, release := range releases {
+				release()
+				release() // releasing twice has no effect
+			}
+			if got := gauge(t, "loadshed_in_flight_requests") - before; got != 0 {
+				t.Errorf("got %v requests in flight after the release, want 0", got)
+			}
+		})
+	}
+}
+
+func TestShedderAdaptiveLimit(t *testing.T) {
+	s := NewShedder(Config{Adaptive: true, AdaptiveLimit: AdaptiveConfig{InitialLimit: 2, MinLimit: 1, Window: time.Second}})
+	first, _ := s.Acquire(context.Background())
+	second, _ := s.Acquire(context.Background())
+	if _, err := s.Acquire(context.Background()); !errors.Is(err, ErrOverloaded) {
+		t.Errorf("got error %v over the limit, want %v", err, ErrOverloaded)
+	}
+	first()
+	second()
+	release, err := s.Acquire(context.Background())
+	if err != nil {
+		t.Fatalf("got error %v after the release, want nil", err)
+	}
+	release()
+}
+
+func TestShedderConcurrent(t *testing.T) {
+	s := NewShedder(Config{MaxInFlight: 4, MaxQueueTime: time.Minute})
+	var (
+		wg                sync.WaitGroup
+		mu                sync.Mutex
+		active, maxActive int
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			release, err := s.Acquire(context.Background())
+			if err != nil {
+				t.Errorf("acquire: %v", err)
+				return
+			}
+			defer release()
+			mu.Lock()
+			active++
+			maxActive = max(maxActive, active)
+			mu.Unlock()
+			time.Sleep(time.Millisecond)
+			mu.Lock()
+			active--
+			mu.Unlock()
+		}()
+	}
+	wg.Wait()
+	if maxActive > 4 {
+		t.Errorf("got %d requests in flight, want at most 4", maxActive)
+	}
+}
+
+func TestShedderMiddleware(t *testing.T) {
+	tests := []struct {
+		name string
+		path string
+		want int
+	}{
+		{"rejected", "/venues", http.StatusServiceUnavailable},
+		{"exempt", "/healthz", http.StatusOK},
+		{"exempt prefix", "/admin/pprof", http.StatusOK},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			// The heap is always larger than one byte.
+			s := NewShedder(Config{MaxHeapBytes: 1, ExemptPaths: []string{"/healthz", "/admin/*"}})
+			h := s.Middleware()(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, tt.path, nil))
+			if rec.Code != tt.want {
+				t.Errorf("got status %d, want %d", rec.Code, tt.want)
+			}
+			if tt.want == http.StatusServiceUnavailable && rec.Header().Get("Retry-After") == "" {
+				t.Error("got no Retry-After header")
+			}
+		})
+	}
+}
+
+// gauge returns the value of the unlabeled gauge of the default registry.
+func gauge(t *testing.T, name string) float64 {
+	t.Helper()
+	var buf bytes.Buffer
+	if _, err := metrics.Default.WriteTo(&buf); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	sc := bufio.NewScanner(&buf)
+	for sc.Scan() {
+		if v, ok := strings.CutPrefix(sc.Text(), name+" "); ok {
+			f, err := strconv.ParseFloat(v, 64)
+			if err != nil {
+				t.Fatalf("parse %s: %v", name, err)
+			}
+			return f
+		}
+	}
+	return 0
+}
@@ -0,0 +1,38 @@
+// Package logs wraps the handler of the default logger, e.g. to filter its
+// records or to add attributes to them.
+//
+// The builtin handler of [slog] writes to the [log] package, which writes to
+// the default logger once it is replaced, thus the builtin handler cannot be
+// wrapped: the records would be handled again and again. [Wrap] replaces it
+// with a text handler first. The packages of the service change the default
+// logger with [Wrap] only, so that the builtin handler is never wrapped.
+package logs
+
+import (
+	"log/slog"
+	"os"
+	"sync"
+)
+
+// Wrap replaces the default logger with a logger whose handler is the handler
+// of the default logger wrapped with wrap. The builtin handler is replaced
+// with a text handler writing to stderr before it is wrapped.
+func Wrap(wrap func(slog.Handler) slog.Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	h := slog.Default().Handler()
+	if h == builtin {
+		h = slog.NewTextHandler(os.Stderr, nil)
+	}
+	slog.SetDefault(slog.New(wrap(h)))
+}
+
+var (
+	// builtin is the builtin handler of the default logger, which is
+	// in use until the default logger is replaced.
+	builtin = slog.Default().Handler()
+
+	// mu serializes the calls of Wrap, which would otherwise lose
+	// each other's handlers.
+	mu sync.Mutex
+)
@@ -0,0 +1,360 @@
+// Package membus implements the [service.MessageBus] in process, so that the
+// tests of the service publish and consume events without a broker. The bus
+// records every published message, for the tests to assert on:
+//
+//	bus := membus.New()
+//	s := &main.ServiceName{Deps: di.New()}
+//	di.Override[service.MessageBus](s.Deps, bus)
+//	svc := servicetest.Start(t, s)
+//	// ...
+//	if got := bus.Published(eventsv1.TopicVenues); len(got) != 1 {
+//		t.Errorf("got %d venue events, want 1", len(got))
+//	}
+//
+// Like the queues of RabbitMQ, every subscription to a topic receives every
+// message published to it while it is subscribed; a message published to a
+// topic without subscriptions is only recorded. The messages are delivered to
+// the subscriptions synchronously by [New], before Publish returns, and
+// asynchronously by [NewBuffered], see [Bus.Flush]. The messages whose
+// handlers fail are recorded too, see [Bus.Failed].
+package membus
+
+import (
+	"context"
+	"fmt"
+	"sync"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/delivery"
+)
+
+// Message is a message published to the bus, with the metadata of the context
+// of Publish, see [delivery.WithMetadata].
+type Message struct {
+	Topic string
+	Body  []byte
+	delivery.Metadata
+}
+
+// Failure is a message whose handler failed, or did not acknowledge it, see
+// [Bus.Failed].
+type Failure struct {
+	Message
+	Err error
+
+	// Settlement is how the handler settled the message, e.g.
+	// [delivery.Requeued]. The bus does not deliver the requeued
+	// messages again.
+	Settlement delivery.Settlement
+}
+
+// Bus is the in-process [service.MessageBus]. The zero value is not usable,
+// see [New] and [NewBuffered].
+type Bus struct {
+	// buffer is the number of messages buffered by every
+	// subscription, zero delivers synchronously.
+	buffer int
+
+	mu        sync.Mutex
+	published []Message
+	failed    []Failure
+	subs      map[string][]*subscription // by topic
+	closed    bool
+	done      chan struct{} // closed by Close
+	changed   chan struct{} // closed and replaced on every change, see wait
+}
+
+var _ service.MessageBus = (*Bus)(nil)
+
+// subscription is a subscription to a topic.
+type subscription struct {
+	h     service.EventHandler
+	ctx   context.Context
+	queue chan Message // nil for synchronous delivery
+
+	// pending is the number of messages enqueued and not yet
+	// handled, guarded by the mutex of the bus.
+	pending int
+}
+
+// New creates a bus delivering the messages synchronously: Publish calls the
+// handlers of the subscriptions, one after another, and returns once they
+// return. The handlers are called with the context of their subscription.
+func New() *Bus { return newBus(0) }
+
+// NewBuffered creates a bus delivering the messages asynchronously, like a
+// broker does: every subscription buffers up to size messages and handles
+// them in order. Publish blocks while the buffer of a subscription is full.
+func NewBuffered(size int) *Bus { return newBus(max(size, 1)) }
+
+func newBus(buffer int) *Bus {
+	return &Bus{
+		buffer:  buffer,
+		subs:    make(map[string][]*subscription),
+		done:    make(chan struct{}),
+		changed: make(chan struct{}),
+	}
+}
+
+// Publish implements the [service.MessageBus] interface. The message is
+// copied, thus the caller may reuse it. This function returns
+// [service.ErrConnectionClosed] in case the bus is closed, and
+// [service.ErrTimeOut] in case ctx is done while the buffer of a subscription
+// is full.
+func (b *Bus) Publish(ctx context.Context, topic string, msg []byte) error {
+	m := Message{Topic: topic, Body: append([]byte(nil), msg...), Metadata: delivery.MetadataFrom(ctx)}
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return fmt.Errorf("%w: publish to %s: bus is closed", service.ErrConnectionClosed, topic)
+	}
+	b.published = append(b.published, m)
+	subs := append([]*subscription(nil), b.subs[topic]...)
+	for _, sub := range subs {
+		sub.pending++
+	}
+	b.notifyLocked()
+	b.mu.Unlock()
+
+	for _, sub := range subs {
+		if sub.queue == nil {
+			if sub.ctx.Err() == nil {
+				b.deliver(sub, m)
+			}
+			b.handled(sub)
+			continue
+		}
+		select {
+		case sub.queue <- m:
+		case <-sub.ctx.Done(): // the subscription ended
+			b.handled(sub)
+		case <-ctx.Done():
+			b.handled(sub)
+			return fmt.Errorf("%w: publish to %s: subscription buffer is full: %v",
+				service.ErrTimeOut, topic, ctx.Err())
+		}
+	}
+	return nil
+}
+
+// Subscribe implements the [service.MessageBus] interface. This is a blocking
+// function. This function returns [service.ErrConnectionClosed] in case the
+// bus is closed.
+func (b *Bus) Subscribe(ctx context.Context, topic string, h service.EventHandler) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	sub := &subscription{h: h, ctx: ctx}
+	if b.buffer > 0 {
+		sub.queue = make(chan Message, b.buffer)
+	}
+
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return fmt.Errorf("%w: subscribe to %s: bus is closed", service.ErrConnectionClosed, topic)
+	}
+	b.subs[topic] = append(b.subs[topic], sub)
+	b.notifyLocked()
+	b.mu.Unlock()
+	defer b.unsubscribe(topic, sub)
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-b.done:
+			return fmt.Errorf("%w: subscription to %s closed", service.ErrConnectionClosed, topic)
+		case m := <-sub.queue: // never ready for synchronous delivery
+			b.deliver(sub, m)
+			b.handled(sub)
+		}
+	}
+}
+
+// Close implements the [io.Closer] interface. It ends the subscriptions. The
+// published messages are kept, for the assertions of the tests.
+func (b *Bus) Close() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if !b.closed {
+		b.closed = true
+		close(b.done)
+		b.notifyLocked()
+	}
+	return nil
+}
+
+// Published returns the bodies of the messages published to the topic, in the
+// order they were published.
+func (b *Bus) Published(topic string) [][]byte {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var bodies [][]byte
+	for _, m := range b.published {
+		if m.Topic == topic {
+			bodies = append(bodies, m.Body)
+		}
+	}
+	return bodies
+}
+
+// Messages returns all the published messages, in the order they were
+// published.
+func (b *Bus) Messages() []Message {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Message(nil), b.published...)
+}
+
+// Topics returns the topics that messages were published to, in the order of
+// their first message.
+func (b *Bus) Topics() []string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var topics []string
+	seen := make(map[string]bool)
+	for _, m := range b.published {
+		if !seen[m.Topic] {
+			seen[m.Topic] = true
+			topics = append(topics, m.Topic)
+		}
+	}
+	return topics
+}
+
+// Failed returns the messages whose handlers failed, see [delivery.Fail], or
+// rejected them, see [delivery.Message.Nack], in the order they were handled.
+// Unlike RabbitMQ, the bus does not retry them.
+func (b *Bus) Failed() []Failure {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]Failure(nil), b.failed...)
+}
+
+// Reset forgets the published and the failed messages, e.g. between the
+// subtests sharing a service.
+func (b *Bus) Reset() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.published, b.failed = nil, nil
+}
+
+// WaitFor waits until n messages were published to the topic, e.g. by a
+// background worker, and returns them. This function returns
+// [service.ErrTimeOut] in case ctx is done before.
+func (b *Bus) WaitFor(ctx context.Context, topic string, n int) ([][]byte, error) {
+	var bodies [][]byte
+	err := b.wait(ctx, func() bool {
+		bodies = bodies[:0]
+		for _, m := range b.published {
+			if m.Topic == topic {
+				bodies = append(bodies, m.Body)
+			}
+		}
+		return len(bodies) >= n
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: wait for %d messages on %s, got %d",
+			service.ErrTimeOut, n, topic, len(bodies))
+	}
+	return bodies, nil
+}
+
+// WaitSubscribed waits until the topic has n subscriptions, e.g. once the
+// service started its subscriptions, so that the messages published next are
+// delivered to them. This function returns [service.ErrTimeOut] in case ctx
+// is done before.
+func (b *Bus) WaitSubscribed(ctx context.Context, topic string, n int) error {
+	if err := b.wait(ctx, func() bool { return len(b.subs[topic]) >= n }); err != nil {
+		return fmt.Errorf("%w: wait for %d subscriptions to %s", service.ErrTimeOut, n, topic)
+	}
+	return nil
+}
+
+// Flush waits until the subscriptions handled the messages published so far,
+// i.e. their buffers are empty and their handlers returned. Flush returns at
+// once if the bus delivers synchronously. This function returns
+// [service.ErrTimeOut] in case ctx is done before.
+func (b *Bus) Flush(ctx context.Context) error {
+	err := b.wait(ctx, func() bool {
+		for _, subs := range b.subs {
+			for _, sub := range subs {
+				if sub.pending > 0 {
+					return false
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return fmt.Errorf("%w: flush the subscriptions: %v", service.ErrTimeOut, err)
+	}
+	return nil
+}
+
+// wait waits until cond, called with the mutex held, holds.
+func (b *Bus) wait(ctx context.Context, cond func() bool) error {
+	for {
+		b.mu.Lock()
+		ok, changed := cond(), b.changed
+		b.mu.Unlock()
+		if ok {
+			return nil
+		}
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return ctx.Err() //nolint:wrapcheck // wrapped by the callers
+		}
+	}
+}
+
+// deliver calls the handler of the subscription with the message, and records
+// the message if the handler fails or rejects it, see [Bus.Failed].
+func (b *Bus) deliver(sub *subscription, m Message) {
+	s, err := delivery.Handle(sub.ctx, sub.h, &delivery.Message{
+		Topic:    m.Topic,
+		Body:     m.Body,
+		Metadata: m.Metadata,
+		Attempt:  1,
+	})
+	if s == delivery.Acked || (s == delivery.Unsettled && err == nil) {
+		return
+	}
+	b.mu.Lock()
+	b.failed = append(b.failed, Failure{Message: m, Err: err, Settlement: s})
+	b.mu.Unlock()
+}
+
+// handled records that the subscription handled, or dropped, a message.
+func (b *Bus) handled(sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	sub.pending--
+	b.notifyLocked()
+}
+
+// unsubscribe removes the subscription from the topic. The messages left in
+// its buffer are dropped.
+func (b *Bus) unsubscribe(topic string, sub *subscription) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	subs := b.subs[topic]
+	for i, s := range subs {
+		if s == sub {
+			b.subs[topic] = append(subs[:i:i], subs[i+1:]...)
+			break
+		}
+	}
+	if len(b.subs[topic]) == 0 {
+		delete(b.subs, topic)
+	}
+	b.notifyLocked()
+}
+
+// notifyLocked wakes up the waiters, see wait. The caller must hold the mutex.
+func (b *Bus) notifyLocked() {
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
@@ -0,0 +1,59 @@
+package metrics
+
+import (
+	"runtime"
+	"time"
+)
+
+// Collector updates metrics when they are scraped, e.g. from the statistics
+// that a library keeps, instead of on every change.
+type Collector interface {
+	// Collect updates the metrics of the collector in r. It is
+	// called on every scrape, before the metrics are written, thus
+	// it must be fast.
+	Collect(r *Registry)
+}
+
+// CollectorFunc is a function implementing the [Collector] interface.
+type CollectorFunc func(r *Registry)
+
+// Collect implements the [Collector] interface.
+func (f CollectorFunc) Collect(r *Registry) { f(r) }
+
+// Register registers the collectors with the registry.
+func (r *Registry) Register(cs ...Collector) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	// The collectors are copied on write, so that a scrape runs them
+	// without holding the lock.
+	r.collectors = append(r.collectors[:len(r.collectors):len(r.collectors)], cs...)
+}
+
+// Register registers the collectors with the [Default] registry.
+func Register(cs ...Collector) { Default.Register(cs...) }
+
+// RuntimeCollector returns a collector of the metrics of the go runtime: the
+// goroutines, the heap and the garbage collections, and of the process start
+// time, named after the metrics of the Prometheus go client.
+func RuntimeCollector() Collector {
+	start := float64(time.Now().Unix())
+	return CollectorFunc(func(r *Registry) {
+		var m runtime.MemStats
+		runtime.ReadMemStats(&m)
+		r.Gauge("go_goroutines", "Number of goroutines that currently exist.").
+			Set(float64(runtime.NumGoroutine()))
+		r.Gauge("go_memstats_heap_alloc_bytes", "Number of heap bytes allocated and still in use.").
+			Set(float64(m.HeapAlloc))
+		r.Gauge("go_memstats_heap_objects", "Number of allocated objects.").
+			Set(float64(m.HeapObjects))
+		r.Gauge("go_memstats_sys_bytes", "Number of bytes obtained from the system.").
+			Set(float64(m.Sys))
+		r.Gauge("go_memstats_last_gc_time_seconds",
+			"Number of seconds since 1970 of the last garbage collection.",
+		).Set(float64(m.LastGC) / 1e9)
+		r.Gauge("go_gc_cycles", "Number of completed garbage collection cycles.").
+			Set(float64(m.NumGC))
+		r.Gauge("process_start_time_seconds", "Start time of the process since unix epoch in seconds.").
+			Set(start)
+	})
+}
@@ -0,0 +1,337 @@
+// Package metrics provides a minimal registry of service metrics, which can be
+// exposed in the Prometheus text exposition format.
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+//
+// The metrics of the [Default] registry are served on the admin listener at
+// /metrics. The requests of the rest and grpc servers are measured by
+// [InstrumentHandler] and [UnaryServerInterceptor], and the metrics computed
+// at scrape time, e.g. the statistics of a connection pool, are updated by the
+// registered collectors, see [Register].
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// Default is the registry used by the package level constructors.
+	// Metrics registered here are exposed by [Handler].
+	Default = NewRegistry()
+
+	// DefaultBuckets are the default histogram buckets, tailored to measure
+	// the duration of requests in seconds.
+	DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+)
+
+// Registry holds a set of named metrics. Every metric name is registered only
+// once. Registering the same name again returns the already existing metric.
+type Registry struct {
+	mu         sync.Mutex
+	families   map[string]*family
+	collectors []Collector
+}
+
+// NewRegistry creates a new empty [Registry].
+func NewRegistry() *Registry {
+	return &Registry{families: make(map[string]*family)}
+}
+
+// Counter returns the counter registered with the given name, creating it if
+// it does not exist. The counter is partitioned by the given label names.
+func (r *Registry) Counter(name, help string, labels ...string) *Counter {
+	return &Counter{r.register(name, help, "counter", labels)}
+}
+
+// Gauge returns the gauge registered with the given name, creating it if it
+// does not exist. The gauge is partitioned by the given label names.
+func (r *Registry) Gauge(name, help string, labels ...string) *Gauge {
+	return &Gauge{r.register(name, help, "gauge", labels)}
+}
+
+// Histogram returns the histogram registered with the given name, creating it
+// if it does not exist. The histogram counts observations in the given upper
+// bounds, which must be sorted in increasing order. If no buckets are given
+// [DefaultBuckets] are used.
+func (r *Registry) Histogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	f := r.register(name, help, "histogram", labels)
+	f.mu.Lock()
+	if f.buckets == nil {
+		f.buckets = buckets
+	}
+	f.mu.Unlock()
+	return &Histogram{f}
+}
+
+// ServeHTTP implements the [http.Handler] interface. It writes all registered
+// metrics in the Prometheus text exposition format.
+func (r *Registry) ServeHTTP(w http.ResponseWriter, _ *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	r.WriteTo(w) //nolint:errcheck // the client will notice
+}
+
+// WriteTo writes all registered metrics to w in the Prometheus text exposition
+// format. The collectors of the registry are run first, see [Collector].
+func (r *Registry) WriteTo(w io.Writer) (int64, error) {
+	r.mu.Lock()
+	collectors := r.collectors
+	r.mu.Unlock()
+	for _, c := range collectors {
+		c.Collect(r)
+	}
+
+	r.mu.Lock()
+	names := make([]string, 0, len(r.families))
+	for name := range r.families {
+		names = append(names, name)
+	}
+	families := make([]*family, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		families = append(families, r.families[name])
+	}
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, f := range families {
+		f.write(&b)
+	}
+	n, err := io.WriteString(w, b.String())
+	return int64(n), err //nolint:wrapcheck // io.WriterTo contract
+}
+
+// Counter is a metric that only goes up.
+type Counter struct{ f *family }
+
+// NewCounter registers a counter in the [Default] registry.
+func NewCounter(name, help string, labels ...string) *Counter {
+	return Default.Counter(name, help, labels...)
+}
+
+// Inc increments the counter for the given label values by 1.
+func (c *Counter) Inc(labelValues ...string) { c.f.add(1, labelValues) }
+
+// Add increments the counter for the given label values by v. Negative values
+// are ignored.
+func (c *Counter) Add(v float64, labelValues ...string) {
+	if v > 0 {
+		c.f.add(v, labelValues)
+	}
+}
+
+// Gauge is a metric that can go up and down.
+type Gauge struct{ f *family }
+
+// NewGauge registers a gauge in the [Default] registry.
+func NewGauge(name, help string, labels ...string) *Gauge {
+	return Default.Gauge(name, help, labels...)
+}
+
+// Set sets the gauge for the given label values to v.
+func (g *Gauge) Set(v float64, labelValues ...string) { g.f.set(v, labelValues) }
+
+// Add adds v to the gauge for the given label values.
+func (g *Gauge) Add(v float64, labelValues ...string) { g.f.add(v, labelValues) }
+
+// Inc increments the gauge for the given label values by 1.
+func (g *Gauge) Inc(labelValues ...string) { g.f.add(1, labelValues) }
+
+// Dec decrements the gauge for the given label values by 1.
+func (g *Gauge) Dec(labelValues ...string) { g.f.add(-1, labelValues) }
+
+// Histogram is a metric that samples observations, e.g. request durations, and
+// counts them in configurable buckets.
+type Histogram struct{ f *family }
+
+// NewHistogram registers a histogram in the [Default] registry.
+func NewHistogram(name, help string, buckets []float64, labels ...string) *Histogram {
+	return Default.Histogram(name, help, buckets, labels...)
+}
+
+// Observe adds a single observation to the histogram for the given label
+// values.
+func (h *Histogram) Observe(v float64, labelValues ...string) { h.f.observe(v, labelValues) }
+
+// ObserveSince adds the number of seconds elapsed since start to the histogram
+// for the given label values.
+func (h *Histogram) ObserveSince(start time.Time, labelValues ...string) {
+	h.f.observe(time.Since(start).Seconds(), labelValues)
+}
+
+// Handler returns an [http.Handler] exposing the metrics of the [Default]
+// registry.
+func Handler() http.Handler { return Default }
+
+// register returns the family with the given name, creating it if needed.
+func (r *Registry) register(name, help, typ string, labels []string) *family {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if f, ok := r.families[name]; ok {
+		return f
+	}
+	f := &family{
+		name:   name,
+		help:   help,
+		typ:    typ,
+		labels: labels,
+		series: make(map[string]*series),
+	}
+	r.families[name] = f
+	return f
+}
+
+// family is a group of time series sharing the same metric name. Each series
+// is identified by its label values.
+type family struct {
+	name   string
+	help   string
+	typ    string
+	labels []string
+
+	mu      sync.Mutex
+	series  map[string]*series
+	buckets []float64 // only for histograms
+}
+
+// series is a single time series of a metric family.
+type series struct {
+	labelValues []string
+	value       float64 // the sum of observations for histograms
+
+	count  uint64   // number of observations, only for histograms
+	counts []uint64 // per-bucket counts, only for histograms
+}
+
+// get returns the series for the given label values, creating it if needed.
+// Missing label values are treated as empty, superfluous ones are dropped.
+// The caller must hold f.mu.
+func (f *family) get(labelValues []string) *series {
+	values := make([]string, len(f.labels))
+	copy(values, labelValues)
+	key := strings.Join(values, labelSeparator)
+	s, ok := f.series[key]
+	if !ok {
+		s = &series{labelValues: values}
+		f.series[key] = s
+	}
+	return s
+}
+
+func (f *family) add(v float64, labelValues []string) {
+	f.mu.Lock()
+	f.get(labelValues).value += v
+	f.mu.Unlock()
+}
+
+func (f *family) set(v float64, labelValues []string) {
+	f.mu.Lock()
+	f.get(labelValues).value = v
+	f.mu.Unlock()
+}
+
+func (f *family) observe(v float64, labelValues []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	s := f.get(labelValues)
+	if s.counts == nil {
+		s.counts = make([]uint64, len(f.buckets))
+	}
+	for i, upper := range f.buckets {
+		if v <= upper {
+			s.counts[i]++
+		}
+	}
+	s.count++
+	s.value += v
+}
+
+// write writes the family in the Prometheus text exposition format.
+func (f *family) write(b *strings.Builder) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	fmt.Fprintf(b, "# HELP %s %s\n", f.name, escapeHelp(f.help))
+	fmt.Fprintf(b, "# TYPE %s %s\n", f.name, f.typ)
+	keys := make([]string, 0, len(f.series))
+	for k := range f.series {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := f.series[k]
+		if f.typ != "histogram" {
+			fmt.Fprintf(b, "%s%s %s\n",
+				f.name, formatLabels(f.labels, s.labelValues), formatValue(s.value))
+			continue
+		}
+
+		names := append(append([]string{}, f.labels...), "le")
+		values := append(append([]string{}, s.labelValues...), "")
+		for i, upper := range f.buckets {
+			values[len(values)-1] = formatValue(upper)
+			var count uint64
+			if s.counts != nil {
+				count = s.counts[i]
+			}
+			fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(names, values), count)
+		}
+		values[len(values)-1] = "+Inf"
+		fmt.Fprintf(b, "%s_bucket%s %d\n", f.name, formatLabels(names, values), s.count)
+		fmt.Fprintf(b, "%s_sum%s %s\n",
+			f.name, formatLabels(f.labels, s.labelValues), formatValue(s.value))
+		fmt.Fprintf(b, "%s_count%s %d\n",
+			f.name, formatLabels(f.labels, s.labelValues), s.count)
+	}
+}
+
+// formatLabels formats the label pairs as `{name="value",...}`.
+func formatLabels(names, values []string) string {
+	if len(names) == 0 {
+		return ""
+	}
+	pairs := make([]string, len(names))
+	for i, name := range names {
+		pairs[i] = name + `="` + labelEscaper.Replace(values[i]) + `"`
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+// formatValue formats v as expected by the Prometheus text format.
+func formatValue(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	default:
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+}
+
+func escapeHelp(s string) string { return helpEscaper.Replace(s) }
+
+// labelSeparator is used to build the key of a series from its label values.
+const labelSeparator = "\xff"
+
+var (
+	// helpEscaper escapes the characters that are not allowed in a help text.
+	helpEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+
+	// labelEscaper escapes the characters that are not allowed in a label
+	// value.
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
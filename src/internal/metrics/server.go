@@ -0,0 +1,145 @@
+package metrics
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+// InstrumentHandler measures the requests served by h: their number by method
+// and status code, their duration, and the requests in flight. The metrics
+// are labeled with the server, e.g. "rest". The routes are not labeled, as
+// the paths of the requests are unbounded.
+func InstrumentHandler(h http.Handler, server string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		httpInFlight.Inc(server)
+		defer httpInFlight.Dec(server)
+
+		sw := &statusWriter{ResponseWriter: w}
+		h.ServeHTTP(sw, r)
+		if sw.code == 0 { // nothing written
+			sw.code = http.StatusOK
+		}
+		httpRequests.Inc(server, r.Method, strconv.Itoa(sw.code))
+		httpDuration.ObserveSince(start, server, r.Method)
+	})
+}
+
+// UnaryServerInterceptor measures the unary calls served by a grpc server:
+// their number by method and status code, their duration, and the calls in
+// flight.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		done := observeGRPC(info.FullMethod)
+		resp, err := handler(ctx, req)
+		done(err)
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor measures the streams served by a grpc server, like
+// [UnaryServerInterceptor] does. The duration of a stream is its lifetime.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		done := observeGRPC(info.FullMethod)
+		err := handler(srv, ss)
+		done(err)
+		return err
+	}
+}
+
+// observeGRPC starts measuring a call of the method, and returns the function
+// ending the measurement with the outcome of the call.
+func observeGRPC(method string) func(err error) {
+	start := time.Now()
+	grpcInFlight.Inc(method)
+	return func(err error) {
+		grpcInFlight.Dec(method)
+		grpcRequests.Inc(method, status.Code(err).String())
+		grpcDuration.ObserveSince(start, method)
+	}
+}
+
+// statusWriter records the status code of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	code int
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if w.code == 0 {
+		w.code = code
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(b []byte) (int, error) {
+	if w.code == 0 {
+		w.code = http.StatusOK
+	}
+	return w.ResponseWriter.Write(b) //nolint:wrapcheck // transparent writer
+}
+
+// Unwrap returns the wrapped writer, for [http.ResponseController].
+func (w *statusWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+var (
+	// httpRequests counts the served http requests.
+	httpRequests = NewCounter(
+		"http_server_requests_total",
+		"Number of served http requests.",
+		"server", "method", "code",
+	)
+
+	// httpDuration observes the duration of the served http requests.
+	httpDuration = NewHistogram(
+		"http_server_request_duration_seconds",
+		"Duration of the served http requests in seconds.",
+		DefaultBuckets,
+		"server", "method",
+	)
+
+	// httpInFlight is the number of http requests being served.
+	httpInFlight = NewGauge(
+		"http_server_requests_in_flight",
+		"Number of http requests being served.",
+		"server",
+	)
+
+	// grpcRequests counts the served grpc calls.
+	grpcRequests = NewCounter(
+		"grpc_server_handled_total",
+		"Number of served grpc calls.",
+		"method", "code",
+	)
+
+	// grpcDuration observes the duration of the served grpc calls.
+	grpcDuration = NewHistogram(
+		"grpc_server_handling_seconds",
+		"Duration of the served grpc calls in seconds.",
+		DefaultBuckets,
+		"method",
+	)
+
+	// grpcInFlight is the number of grpc calls being served.
+	grpcInFlight = NewGauge(
+		"grpc_server_in_flight",
+		"Number of grpc calls being served.",
+		"method",
+	)
+)
@@ -0,0 +1,96 @@
+// Package middleware composes the http middleware of a [service.CloudService].
+//
+// The cross-cutting concerns of the rest api, e.g. tracing, metrics, panic
+// recovery and authentication, are middleware wrapping the handler returned
+// by REST. Instead of wrapping the handler by hand in every service, the
+// service declares its middleware stack by implementing [Stacker], and
+// lifecycle.Start applies the stack around the handler, see [Apply].
+package middleware
+
+import (
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Middleware wraps an http handler, e.g. to authenticate the requests before
+// they reach it. The middleware of the template packages, e.g.
+// auth.Middleware or loadshed.Shedder.Middleware, are of this type.
+type Middleware func(http.Handler) http.Handler
+
+// Stacker is implemented by services that wrap their rest handler with
+// middleware.
+type Stacker interface {
+	// Middleware returns the middleware stack of the rest handler.
+	// The first middleware is the outermost one, i.e. it sees the
+	// requests first and the responses last.
+	Middleware() []Middleware
+}
+
+// Chain wraps h with the middleware, the first middleware being the outermost
+// one. Nil middleware are skipped.
+func Chain(h http.Handler, mws ...Middleware) http.Handler {
+	for i := len(mws) - 1; i >= 0; i-- {
+		if mws[i] != nil {
+			h = mws[i](h)
+		}
+	}
+	return h
+}
+
+// Apply returns the service with its rest handler wrapped with its middleware
+// stack, if it implements [Stacker], and the service as is otherwise. The
+// stack is applied when the handler is asked for, i.e. after Init, thus the
+// middleware may use the components built on Init.
+func Apply(s service.CloudService) service.CloudService {
+	st, ok := s.(Stacker)
+	if !ok {
+		return s
+	}
+	return &stacked{CloudService: s, stack: st}
+}
+
+// Recover recovers the panics of the handler, logs them with their stack
+// trace, and responds with 500, so that a panicking request does not take its
+// connection down with it. The panics of [http.ErrAbortHandler] are passed
+// on, as they abort the response on purpose.
+func Recover(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			msg := recover()
+			if msg == nil {
+				return
+			}
+			if msg == http.ErrAbortHandler { //nolint:errorlint,goerr113 // compared as the net/http server does
+				panic(msg)
+			}
+			slog.ErrorContext(r.Context(), "panic in rest handler",
+				slog.Any("message", msg),
+				slog.String("method", r.Method),
+				slog.String("path", r.URL.Path),
+				slog.String("stack", string(debug.Stack())),
+			)
+			err := fmt.Errorf("%w: panic: %v", service.ErrUnexpected, msg)
+			service.HTTPError(r.Context(), w, err)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
+
+// stacked wraps the rest handler of a service with its middleware stack.
+type stacked struct {
+	service.CloudService
+
+	stack Stacker
+}
+
+func (s *stacked) REST() http.Handler {
+	h := s.CloudService.REST()
+	if h == nil {
+		return nil
+	}
+	return Chain(h, s.stack.Middleware()...)
+}
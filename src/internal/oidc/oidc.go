@@ -0,0 +1,336 @@
+// Package oidc integrates the service with an OpenID Connect identity provider.
+//
+// The provider is configured from the environment and its endpoints are found
+// with OIDC discovery, see [Discover]. Apis verify the access tokens issued by
+// the provider with [Provider.Verifier]. Browser-facing services log users in
+// with the authorization code flow, see [Provider.LoginHandler] and
+// [Provider.CallbackHandler].
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/auth"
+	"github.com/eventscompass/service-template/src/internal/httperr"
+)
+
+// Config encapsulates the configuration for the identity provider.
+type Config struct {
+	// IssuerURL is the url of the identity provider. The
+	// discovery document is served below this url.
+	IssuerURL string `env:"OIDC_ISSUER_URL,notEmpty"`
+
+	// ClientID and ClientSecret are the credentials of the
+	// service for the authorization code flow.
+	ClientID     string `env:"OIDC_CLIENT_ID"`
+	ClientSecret string `env:"OIDC_CLIENT_SECRET"`
+
+	// RedirectURL is the url of the callback handler of the
+	// service, registered with the identity provider.
+	RedirectURL string `env:"OIDC_REDIRECT_URL"`
+
+	// Scopes are requested during the authorization code flow.
+	Scopes []string `env:"OIDC_SCOPES" envDefault:"openid,profile,email"`
+
+	// Audience is the expected audience of the access tokens
+	// presented to the apis of the service.
+	Audience string `env:"OIDC_AUDIENCE"`
+
+	// Leeway is the tolerated clock skew when verifying tokens.
+	Leeway time.Duration `env:"OIDC_LEEWAY" envDefault:"1m"`
+}
+
+// Metadata are the fields of the discovery document used by the service.
+type Metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// Tokens are the tokens returned by the token endpoint.
+type Tokens struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	RefreshToken string `json:"refresh_token"`
+	IDToken      string `json:"id_token"`
+	ExpiresIn    int    `json:"expires_in"`
+}
+
+// Provider is an OpenID Connect identity provider.
+type Provider struct {
+	cfg      Config
+	meta     Metadata
+	client   *http.Client
+	verifier *auth.JWTVerifier
+}
+
+// Discover fetches the discovery document of the identity provider and creates
+// a new [Provider]. This function returns [service.ErrBadRequest] in case the
+// discovery document does not belong to the configured issuer.
+func Discover(ctx context.Context, cfg Config) (*Provider, error) {
+	p := &Provider{cfg: cfg, client: &http.Client{Timeout: requestTimeout}}
+	u := strings.TrimSuffix(cfg.IssuerURL, "/") + "/.well-known/openid-configuration"
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: create request: %v", service.ErrUnexpected, err)
+	}
+	if err := p.do(req, &p.meta); err != nil {
+		return nil, fmt.Errorf("discover provider: %w", err)
+	}
+	if strings.TrimSuffix(p.meta.Issuer, "/") != strings.TrimSuffix(cfg.IssuerURL, "/") {
+		return nil, fmt.Errorf("%w: discovered issuer %q does not match %q",
+			service.ErrBadRequest, p.meta.Issuer, cfg.IssuerURL)
+	}
+
+	p.verifier = auth.NewJWTVerifier(auth.JWTConfig{
+		Issuer:              p.meta.Issuer,
+		Audience:            cfg.Audience,
+		JWKSURL:             p.meta.JWKSURI,
+		JWKSRefreshInterval: jwksRefreshInterval,
+		Leeway:              cfg.Leeway,
+	})
+	return p, nil
+}
+
+// Metadata returns the discovery document of the provider.
+func (p *Provider) Metadata() Metadata { return p.meta }
+
+// Verifier returns the verifier for the access tokens presented to the apis of
+// the service, to be used with [auth.Middleware].
+func (p *Provider) Verifier() *auth.JWTVerifier { return p.verifier }
+
+// AuthCodeURL returns the url of the authorization endpoint, to which the user
+// is redirected to log in. The code verifier is used for PKCE and has to be
+// passed to [Provider.Exchange].
+func (p *Provider) AuthCodeURL(state, nonce, codeVerifier string) string {
+	challenge := sha256.Sum256([]byte(codeVerifier))
+	q := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(p.cfg.Scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {base64.RawURLEncoding.EncodeToString(challenge[:])},
+		"code_challenge_method": {"S256"},
+	}
+	sep := "?"
+	if strings.Contains(p.meta.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return p.meta.AuthorizationEndpoint + sep + q.Encode()
+}
+
+// Exchange exchanges the authorization code for tokens. This function returns
+// [auth.ErrUnauthorized] in case the provider rejects the code.
+func (p *Provider) Exchange(ctx context.Context, code, codeVerifier string) (*Tokens, error) {
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {codeVerifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.meta.TokenEndpoint,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("%w: create request: %v", service.ErrUnexpected, err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	var t Tokens
+	if err := p.do(req, &t); err != nil {
+		return nil, fmt.Errorf("exchange code: %w", err)
+	}
+	return &t, nil
+}
+
+// VerifyIDToken verifies the id token returned by [Provider.Exchange] and
+// returns the logged in user. This function returns [auth.ErrUnauthorized] in
+// case the token is invalid or does not carry the expected nonce.
+func (p *Provider) VerifyIDToken(
+	ctx context.Context,
+	idToken, nonce string,
+) (*auth.Principal, error) {
+	user, err := p.verifier.WithAudience(p.cfg.ClientID).Verify(ctx, idToken)
+	if err != nil {
+		return nil, fmt.Errorf("verify id token: %w", err)
+	}
+	got, _ := user.Claims["nonce"].(string)
+	if subtle.ConstantTimeCompare([]byte(got), []byte(nonce)) != 1 {
+		return nil, fmt.Errorf("%w: id token nonce mismatch", auth.ErrUnauthorized)
+	}
+	return user, nil
+}
+
+// LoginHandler returns a handler that starts the authorization code flow by
+// redirecting the user to the identity provider. The state of the flow is kept
+// in a short-lived cookie.
+func (p *Provider) LoginHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		f, err := newFlow()
+		if err != nil {
+			service.HTTPError(r.Context(), w, err)
+			return
+		}
+		b, _ := json.Marshal(f) //nolint:errchkjson // cannot fail
+		http.SetCookie(w, &http.Cookie{
+			Name:     flowCookie,
+			Value:    base64.RawURLEncoding.EncodeToString(b),
+			Path:     "/",
+			MaxAge:   int(flowTimeout.Seconds()),
+			Secure:   true,
+			HttpOnly: true,
+			// The callback is a top level navigation from the
+			// identity provider, thus Strict would drop the cookie.
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, p.AuthCodeURL(f.State, f.Nonce, f.Verifier), http.StatusFound)
+	})
+}
+
+// CallbackHandler returns the handler for the redirect url. It completes the
+// authorization code flow and passes the tokens and the logged in user to
+// onLogin, which typically creates a session and redirects the user.
+func (p *Provider) CallbackHandler(
+	onLogin func(w http.ResponseWriter, r *http.Request, t *Tokens, user *auth.Principal),
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		user, t, err := p.callback(w, r)
+		if err != nil {
+			httperr.Write(ctx, w, err)
+			return
+		}
+		onLogin(w, r, t, user)
+	})
+}
+
+// callback validates the callback request and exchanges the code.
+func (p *Provider) callback(
+	w http.ResponseWriter,
+	r *http.Request,
+) (*auth.Principal, *Tokens, error) {
+	ctx := r.Context()
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		return nil, nil, fmt.Errorf("%w: login failed: %s: %s",
+			auth.ErrUnauthorized, e, q.Get("error_description"))
+	}
+
+	c, err := r.Cookie(flowCookie)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: missing login state", service.ErrBadRequest)
+	}
+	// The flow cookie is single use.
+	http.SetCookie(w, &http.Cookie{Name: flowCookie, Path: "/", MaxAge: -1})
+
+	var f flow
+	b, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err == nil {
+		err = json.Unmarshal(b, &f)
+	}
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: malformed login state: %v", service.ErrBadRequest, err)
+	}
+	if subtle.ConstantTimeCompare([]byte(q.Get("state")), []byte(f.State)) != 1 {
+		return nil, nil, fmt.Errorf("%w: login state mismatch", service.ErrBadRequest)
+	}
+
+	t, err := p.Exchange(ctx, q.Get("code"), f.Verifier)
+	if err != nil {
+		return nil, nil, err
+	}
+	user, err := p.VerifyIDToken(ctx, t.IDToken, f.Nonce)
+	if err != nil {
+		return nil, nil, err
+	}
+	return user, t, nil
+}
+
+// do sends the request and decodes the json response into v.
+func (p *Provider) do(req *http.Request, v any) error {
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("%w: %v", service.ErrUnexpected, err)
+	}
+	defer resp.Body.Close() //nolint:errcheck // intentional
+
+	body := io.LimitReader(resp.Body, maxResponseSize)
+	if resp.StatusCode != http.StatusOK {
+		var e struct {
+			Error       string `json:"error"`
+			Description string `json:"error_description"`
+		}
+		_ = json.NewDecoder(body).Decode(&e)
+		if e.Error == "invalid_grant" {
+			return fmt.Errorf("%w: %s", auth.ErrUnauthorized, e.Description)
+		}
+		slog.Warn("identity provider request failed",
+			slog.String("url", req.URL.String()),
+			slog.String("status", resp.Status),
+			slog.String("error", e.Error),
+		)
+		return fmt.Errorf("%w: %s: %s", service.ErrUnexpected, resp.Status, e.Error)
+	}
+	if err := json.NewDecoder(body).Decode(v); err != nil {
+		return fmt.Errorf("%w: decode response: %v", service.ErrUnexpected, err)
+	}
+	return nil
+}
+
+// flow is the state of an authorization code flow, kept in a cookie between
+// the login and the callback.
+type flow struct {
+	State    string `json:"s"`
+	Nonce    string `json:"n"`
+	Verifier string `json:"v"`
+}
+
+// newFlow starts a new flow with random state, nonce and code verifier.
+func newFlow() (flow, error) {
+	var (
+		f   flow
+		buf [3 * 32]byte // 256 bits each
+	)
+	if _, err := rand.Read(buf[:]); err != nil {
+		return f, fmt.Errorf("%w: generate login state: %v", service.ErrUnexpected, err)
+	}
+	f.State = base64.RawURLEncoding.EncodeToString(buf[:32])
+	f.Nonce = base64.RawURLEncoding.EncodeToString(buf[32:64])
+	f.Verifier = base64.RawURLEncoding.EncodeToString(buf[64:])
+	return f, nil
+}
+
+const (
+	// flowCookie is the name of the cookie holding the state of the flow.
+	flowCookie = "oidc_flow"
+
+	// flowTimeout limits the time the user has to log in.
+	flowTimeout = 10 * time.Minute
+
+	// requestTimeout limits the duration of requests to the provider.
+	requestTimeout = 10 * time.Second
+
+	// jwksRefreshInterval is how often the key set of the provider is fetched.
+	jwksRefreshInterval = time.Hour
+
+	// maxResponseSize limits the size of the responses of the provider.
+	maxResponseSize = 1 << 20
+)
@@ -0,0 +1,242 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/auth"
+)
+
+func TestCallbackHandler(t *testing.T) {
+	tests := []struct {
+		name string
+		// callback modifies the query and the flow cookie of the callback
+		// request, which are valid by default.
+		callback   func(q url.Values, f *flow)
+		idNonce    func(nonce string) string
+		wantStatus int
+	}{
+		{
+			name:       "valid",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "state mismatch",
+			callback:   func(q url.Values, _ *flow) { q.Set("state", "forged") },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "missing state",
+			callback:   func(q url.Values, _ *flow) { q.Del("state") },
+			wantStatus: http.StatusBadRequest,
+		},
+		{
+			name:       "code verifier mismatch",
+			callback:   func(_ url.Values, f *flow) { f.Verifier = "forged" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "nonce mismatch",
+			idNonce:    func(string) string { return "replayed" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name:       "missing nonce",
+			idNonce:    func(string) string { return "" },
+			wantStatus: http.StatusUnauthorized,
+		},
+		{
+			name: "provider error",
+			callback: func(q url.Values, _ *flow) {
+				q.Set("error", "access_denied")
+				q.Del("code")
+			},
+			wantStatus: http.StatusUnauthorized,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			op := newTestProvider(t)
+			if tt.idNonce != nil {
+				op.idNonce = tt.idNonce
+			}
+			p, err := Discover(context.Background(), Config{
+				IssuerURL:   op.URL,
+				ClientID:    "client",
+				RedirectURL: "https://service/callback",
+				Scopes:      []string{"openid"},
+			})
+			if err != nil {
+				t.Fatalf("discover: %v", err)
+			}
+
+			// Log in, and let the provider redirect back with a code.
+			rec := httptest.NewRecorder()
+			p.LoginHandler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/login", nil))
+			login := rec.Result()
+			login.Body.Close() //nolint:errcheck // recorded response
+			authURL, err := url.Parse(login.Header.Get("Location"))
+			if err != nil || login.StatusCode != http.StatusFound {
+				t.Fatalf("got login %s to %q, want a redirect", login.Status, login.Header.Get("Location"))
+			}
+			q := url.Values{"code": {op.authorize(t, authURL.Query())}, "state": {authURL.Query().Get("state")}}
+			cookie := login.Cookies()[0]
+			if tt.callback != nil {
+				var f flow
+				b, _ := base64.RawURLEncoding.DecodeString(cookie.Value)
+				json.Unmarshal(b, &f) //nolint:errcheck,errchkjson // set by the login handler
+				tt.callback(q, &f)
+				b, _ = json.Marshal(f) //nolint:errchkjson // cannot fail
+				cookie.Value = base64.RawURLEncoding.EncodeToString(b)
+			}
+
+			req := httptest.NewRequest(http.MethodGet, "/callback?"+q.Encode(), nil)
+			req.AddCookie(cookie)
+			rec = httptest.NewRecorder()
+			var user *auth.Principal
+			p.CallbackHandler(func(w http.ResponseWriter, _ *http.Request, _ *Tokens, u *auth.Principal) {
+				user = u
+				w.WriteHeader(http.StatusOK)
+			}).ServeHTTP(rec, req)
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d (body %q)", rec.Code, tt.wantStatus, rec.Body.String())
+			}
+			if tt.wantStatus == http.StatusOK && (user == nil || user.Subject != "user-1") {
+				t.Errorf("got user %+v, want user-1", user)
+			}
+		})
+	}
+}
+
+func TestCallbackHandlerMissingState(t *testing.T) {
+	op := newTestProvider(t)
+	p, err := Discover(context.Background(), Config{IssuerURL: op.URL, ClientID: "client"})
+	if err != nil {
+		t.Fatalf("discover: %v", err)
+	}
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+	}{
+		{"no cookie", nil},
+		{"malformed cookie", &http.Cookie{Name: flowCookie, Value: "not base64!"}},
+		{"malformed state", &http.Cookie{Name: flowCookie, Value: base64.RawURLEncoding.EncodeToString([]byte("{"))}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/callback?code=c&state=s", nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			rec := httptest.NewRecorder()
+			p.CallbackHandler(func(http.ResponseWriter, *http.Request, *Tokens, *auth.Principal) {
+				t.Error("got login without a valid state")
+			}).ServeHTTP(rec, req)
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("got status %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+// testProvider is an identity provider implementing the authorization code
+// flow with PKCE.
+type testProvider struct {
+	*httptest.Server
+	key *ecdsa.PrivateKey
+
+	// idNonce returns the nonce of the id token issued for the nonce of
+	// the authorization request.
+	idNonce func(nonce string) string
+
+	// codes maps the issued codes to their authorization requests.
+	codes map[string]url.Values
+}
+
+func newTestProvider(t *testing.T) *testProvider {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	op := &testProvider{key: key, idNonce: func(n string) string { return n }, codes: map[string]url.Values{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(Metadata{ //nolint:errcheck,errchkjson // test server
+			Issuer:                op.URL,
+			AuthorizationEndpoint: op.URL + "/authorize",
+			TokenEndpoint:         op.URL + "/token",
+			JWKSURI:               op.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, _ *http.Request) {
+		enc := base64.RawURLEncoding.EncodeToString
+		json.NewEncoder(w).Encode(map[string]any{"keys": []map[string]string{{ //nolint:errcheck,errchkjson // test server
+			"kty": "EC", "kid": "k1", "crv": "P-256", "x": enc(key.X.Bytes()), "y": enc(key.Y.Bytes()),
+		}}})
+	})
+	mux.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		authz, ok := op.codes[r.PostFormValue("code")]
+		verifier := sha256.Sum256([]byte(r.PostFormValue("code_verifier")))
+		if !ok || base64.RawURLEncoding.EncodeToString(verifier[:]) != authz.Get("code_challenge") {
+			w.WriteHeader(http.StatusBadRequest)
+			json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"}) //nolint:errcheck,errchkjson // test server
+			return
+		}
+		claims := map[string]any{
+			"iss": op.URL,
+			"aud": authz.Get("client_id"),
+			"sub": "user-1",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		if n := op.idNonce(authz.Get("nonce")); n != "" {
+			claims["nonce"] = n
+		}
+		json.NewEncoder(w).Encode(Tokens{ //nolint:errcheck,errchkjson // test server
+			AccessToken: "access",
+			TokenType:   "Bearer",
+			IDToken:     op.sign(t, claims),
+		})
+	})
+	op.Server = httptest.NewServer(mux)
+	t.Cleanup(op.Close)
+	return op
+}
+
+// authorize validates the authorization request and issues a code.
+func (op *testProvider) authorize(t *testing.T, q url.Values) string {
+	t.Helper()
+	if q.Get("code_challenge_method") != "S256" || q.Get("code_challenge") == "" || q.Get("nonce") == "" {
+		t.Fatalf("got authorization request %v, want a nonce and a S256 code challenge", q)
+	}
+	code := "code-" + q.Get("state")
+	op.codes[code] = q
+	return code
+}
+
+// sign signs the claims with ES256.
+func (op *testProvider) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	h, _ := json.Marshal(map[string]string{"alg": "ES256", "kid": "k1"}) //nolint:errchkjson // cannot fail
+	c, _ := json.Marshal(claims)                                         //nolint:errchkjson // cannot fail
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+	digest := sha256.Sum256([]byte(input))
+	r, s, err := ecdsa.Sign(rand.Reader, op.key, digest[:])
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	sig := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	return input + "." + base64.RawURLEncoding.EncodeToString(sig)
+}
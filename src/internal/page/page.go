@@ -0,0 +1,326 @@
+// Package page paginates the list endpoints of the service, so that all
+// services page the same way.
+//
+// Clients page either by offset, "?limit=20&offset=40", or by opaque cursors
+// returned with every page, "?limit=20&cursor=...". Cursors encode the key of
+// the first or last row of a page, thus paging is stable while rows are
+// inserted, and deep pages are as fast as the first one:
+//
+//	req, err := page.Parse(r, cfg.Page)
+//	if err != nil {
+//		service.HTTPError(ctx, w, err)
+//		return
+//	}
+//	q := store.ListQuery{Table: "venues", Columns: cols, OrderBy: []string{"created_at", "id"}}
+//	p, err := page.List(ctx, db, req, q, scanVenue, func(v Venue) []any {
+//		return []any{v.CreatedAt, v.ID}
+//	})
+//	...
+//	page.Write(w, r, p)
+//
+// Responses carry the items, the cursors of the adjacent pages, and the total
+// if requested, see [Page]. The adjacent pages are linked in the Link header
+// as well.
+package page
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/store"
+)
+
+// Config encapsulates the configuration of the page sizes.
+type Config struct {
+	// DefaultLimit is the size of the pages if the request does
+	// not specify it.
+	DefaultLimit int `env:"PAGE_DEFAULT_LIMIT" envDefault:"20"`
+
+	// MaxLimit is the maximum size of the pages.
+	MaxLimit int `env:"PAGE_MAX_LIMIT" envDefault:"100"`
+}
+
+// Request is the page requested by a client.
+type Request struct {
+	// Limit is the size of the page.
+	Limit int
+
+	// Offset is the number of rows to skip, for offset paging.
+	Offset int
+
+	// ByOffset selects offset paging. It is set if the request
+	// has an offset parameter.
+	ByOffset bool
+
+	// Cursor is the position of the page, for cursor paging. Nil
+	// requests the first page.
+	Cursor *Cursor
+
+	// Total requests the total number of rows. Offset paging
+	// always returns it.
+	Total bool
+}
+
+// Parse parses the paging query parameters of the request: limit, offset,
+// cursor and total. This function returns [service.ErrBadRequest] in case the
+// parameters are malformed or conflicting.
+func Parse(r *http.Request, cfg Config) (Request, error) {
+	q := r.URL.Query()
+	req := Request{Limit: cfg.DefaultLimit}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return Request{}, fmt.Errorf("%w: limit must be a positive integer", service.ErrBadRequest)
+		}
+		req.Limit = n
+	}
+	if cfg.MaxLimit > 0 {
+		req.Limit = min(req.Limit, cfg.MaxLimit)
+	}
+	if v := q.Get("offset"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return Request{}, fmt.Errorf("%w: offset must be a non-negative integer", service.ErrBadRequest)
+		}
+		req.Offset, req.ByOffset = n, true
+	}
+	if v := q.Get("cursor"); v != "" {
+		if req.ByOffset {
+			return Request{}, fmt.Errorf("%w: offset and cursor are exclusive", service.ErrBadRequest)
+		}
+		c, err := DecodeCursor(v)
+		if err != nil {
+			return Request{}, err
+		}
+		req.Cursor = &c
+	}
+	if v := q.Get("total"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return Request{}, fmt.Errorf("%w: total must be a boolean", service.ErrBadRequest)
+		}
+		req.Total = b
+	}
+	return req, nil
+}
+
+// Cursor is the position of a page: the key of the row the page starts after,
+// or ends before.
+type Cursor struct {
+	// Key holds the values of the order columns of the row. The
+	// values of decoded cursors are json values, numbers are
+	// decoded as [json.Number].
+	Key []any `json:"k"`
+
+	// Before is set for cursors of previous pages.
+	Before bool `json:"b,omitempty"`
+}
+
+// Encode encodes the cursor as opaque url-safe string. Cursors are not
+// encrypted, clients must not rely on their contents.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor decodes a cursor encoded with [Cursor.Encode]. This function
+// returns [service.ErrBadRequest] in case the cursor is malformed.
+func DecodeCursor(s string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("%w: malformed cursor", service.ErrBadRequest)
+	}
+	var c Cursor
+	d := json.NewDecoder(bytes.NewReader(data))
+	d.UseNumber()
+	if err := d.Decode(&c); err != nil || len(c.Key) == 0 {
+		return Cursor{}, fmt.Errorf("%w: malformed cursor", service.ErrBadRequest)
+	}
+	return c, nil
+}
+
+// Page is a page of items.
+type Page[T any] struct {
+	Items []T `json:"items"`
+
+	// Next and Prev are the cursors, or offsets, of the adjacent
+	// pages. They are empty on the last and first page.
+	Next string `json:"next,omitempty"`
+	Prev string `json:"prev,omitempty"`
+
+	// Total is the total number of items, if requested.
+	Total *int64 `json:"total,omitempty"`
+
+	// offset tells whether next and prev are offsets.
+	offset bool
+}
+
+// List lists the page of the query, see [store.List]. The limit, offset and
+// position of the query are set from the request; key returns the values of
+// the order columns of an item, which make up the cursors. This function
+// returns [service.ErrBadRequest] in case the cursor does not fit the query.
+func List[T any](
+	ctx context.Context,
+	db store.Querier,
+	req Request,
+	q store.ListQuery,
+	scan func(*sql.Rows) (T, error),
+	key func(T) []any,
+) (Page[T], error) {
+	// One more row than requested tells whether there is a next page.
+	q.Limit = req.Limit + 1
+	q.Offset = req.Offset
+	if c := req.Cursor; c != nil {
+		if len(c.Key) != len(q.OrderBy) {
+			return Page[T]{}, fmt.Errorf("%w: cursor does not fit the list", service.ErrBadRequest)
+		}
+		if c.Before {
+			q.Before = c.Key
+		} else {
+			q.After = c.Key
+		}
+	}
+	items, err := store.List(ctx, db, q, scan)
+	if err != nil {
+		return Page[T]{}, err
+	}
+
+	more := len(items) > req.Limit
+	if more && q.Before != nil {
+		items = items[1:] // the extra row precedes the page
+	} else if more {
+		items = items[:req.Limit]
+	}
+	p := newPage(req, items, more, key)
+	if req.Total || p.offset {
+		n, err := store.Count(ctx, db, q.Table, q.Where, q.Args...)
+		if err != nil {
+			return Page[T]{}, err
+		}
+		p.Total = &n
+	}
+	return p, nil
+}
+
+// Slice pages the items of an in-memory list, like [List] pages the rows of a
+// query, e.g. for in-memory repositories and fakes. The items must be sorted
+// by their keys; cmp compares the key of an item with the key of a cursor,
+// whose values are json values, see [Cursor]. This function returns
+// [service.ErrBadRequest] in case the cursor does not fit the list, i.e. cmp
+// fails.
+func Slice[T any](
+	items []T,
+	req Request,
+	key func(T) []any,
+	cmp func(T, []any) (int, error),
+) (Page[T], error) {
+	lo, hi := min(req.Offset, len(items)), len(items)
+	if c := req.Cursor; c != nil {
+		// The position of the first item following the cursor, or
+		// not preceding it for cursors of previous pages.
+		pos := len(items)
+		for i, item := range items {
+			n, err := cmp(item, c.Key)
+			if err != nil {
+				return Page[T]{}, fmt.Errorf("%w: cursor does not fit the list: %v", service.ErrBadRequest, err)
+			}
+			if n > 0 || (n == 0 && c.Before) {
+				pos = i
+				break
+			}
+		}
+		lo = pos
+		if c.Before {
+			lo, hi = max(pos-req.Limit, 0), pos
+		}
+	}
+
+	var more bool
+	if req.Cursor != nil && req.Cursor.Before {
+		more = lo > 0
+	} else {
+		more = hi-lo > req.Limit
+		hi = min(hi, lo+req.Limit)
+	}
+	p := newPage(req, slices.Clone(items[lo:hi]), more, key)
+	if req.Total || p.offset {
+		n := int64(len(items))
+		p.Total = &n
+	}
+	return p, nil
+}
+
+// newPage returns the page of the items, linking the adjacent pages. more
+// tells whether there are items beyond the page, in the direction of the
+// request.
+func newPage[T any](req Request, items []T, more bool, key func(T) []any) Page[T] {
+	p := Page[T]{Items: items}
+	switch {
+	case req.ByOffset:
+		p.offset = true
+		if req.Offset > 0 {
+			p.Prev = strconv.Itoa(max(req.Offset-req.Limit, 0))
+		}
+		if more {
+			p.Next = strconv.Itoa(req.Offset + req.Limit)
+		}
+	case len(items) > 0:
+		first, last := key(items[0]), key(items[len(items)-1])
+		backward := req.Cursor != nil && req.Cursor.Before
+		if more || backward {
+			p.Next = Cursor{Key: last}.Encode()
+		}
+		if (more && backward) || (!backward && req.Cursor != nil) {
+			p.Prev = Cursor{Key: first, Before: true}.Encode()
+		}
+	}
+	return p
+}
+
+// Write writes the page as json, and links the adjacent pages in the Link
+// header, relative to the request. The total is also set as X-Total-Count
+// header.
+func Write[T any](w http.ResponseWriter, r *http.Request, p Page[T]) {
+	if p.Items == nil {
+		p.Items = []T{} // always an array
+	}
+	var links []string
+	for _, l := range []struct{ rel, value string }{{"next", p.Next}, {"prev", p.Prev}} {
+		if l.value != "" {
+			links = append(links, fmt.Sprintf("<%s>; rel=%q", link(r, p.offset, l.value), l.rel))
+		}
+	}
+	if len(links) > 0 {
+		w.Header().Set("Link", strings.Join(links, ", "))
+	}
+	if p.Total != nil {
+		w.Header().Set("X-Total-Count", strconv.FormatInt(*p.Total, 10))
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p) //nolint:errcheck,errchkjson // best effort
+}
+
+// link returns the url of the request for the page at the cursor, or offset.
+func link(r *http.Request, offset bool, value string) string {
+	q := r.URL.Query()
+	q.Del("cursor")
+	q.Del("offset")
+	if offset {
+		q.Set("offset", value)
+	} else {
+		q.Set("cursor", value)
+	}
+	u := url.URL{Path: r.URL.Path, RawQuery: q.Encode()}
+	return u.String()
+}
@@ -0,0 +1,110 @@
+package partition
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisMembership is a [Membership] kept in redis, see [store.OpenRedis]. The
+// members of a group are stored in a sorted set, scored by the expiry of their
+// membership.
+type RedisMembership struct {
+	client redis.UniversalClient
+}
+
+var _ Membership = (*RedisMembership)(nil)
+
+// NewRedisMembership creates a new [RedisMembership].
+func NewRedisMembership(c redis.UniversalClient) *RedisMembership {
+	return &RedisMembership{client: c}
+}
+
+// Heartbeat implements the [Membership] interface.
+func (m *RedisMembership) Heartbeat(
+	ctx context.Context,
+	group, member string,
+	ttl time.Duration,
+) ([]string, error) {
+	now := time.Now()
+	key := groupKey(group)
+	var members *redis.StringSliceCmd
+	_, err := m.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		p.ZAdd(ctx, key, redis.Z{Score: float64(now.Add(ttl).UnixMilli()), Member: member})
+		p.ZRemRangeByScore(ctx, key, "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+		members = p.ZRange(ctx, key, 0, -1)
+		p.PExpire(ctx, key, ttl)
+		return nil
+	})
+	if err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	return members.Val(), nil
+}
+
+// Leave implements the [Membership] interface.
+func (m *RedisMembership) Leave(ctx context.Context, group, member string) error {
+	if err := m.client.ZRem(ctx, groupKey(group), member).Err(); err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	return nil
+}
+
+// MemoryMembership is a [Membership] kept in memory. It can only coordinate
+// consumers of the same process, which is useful for tests and for running a
+// single replica locally.
+type MemoryMembership struct {
+	mu     sync.Mutex
+	groups map[string]map[string]time.Time // expiry by member by group
+}
+
+var _ Membership = (*MemoryMembership)(nil)
+
+// NewMemoryMembership creates a new [MemoryMembership].
+func NewMemoryMembership() *MemoryMembership {
+	return &MemoryMembership{groups: make(map[string]map[string]time.Time)}
+}
+
+// Heartbeat implements the [Membership] interface.
+func (m *MemoryMembership) Heartbeat(
+	_ context.Context,
+	group, member string,
+	ttl time.Duration,
+) ([]string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	g := m.groups[group]
+	if g == nil {
+		g = make(map[string]time.Time)
+		m.groups[group] = g
+	}
+	g[member] = now.Add(ttl)
+	res := make([]string, 0, len(g))
+	for name, expires := range g {
+		if now.After(expires) {
+			delete(g, name)
+			continue
+		}
+		res = append(res, name)
+	}
+	sort.Strings(res)
+	return res, nil
+}
+
+// Leave implements the [Membership] interface.
+func (m *MemoryMembership) Leave(_ context.Context, group, member string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	delete(m.groups[group], member)
+	return nil
+}
+
+// groupKey returns the redis key of the members of the group.
+func groupKey(group string) string { return "partition:" + group + ":members" }
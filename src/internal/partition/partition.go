@@ -0,0 +1,354 @@
+// Package partition splits the partitions of a topic among the replicas of a
+// service, so that every message is consumed by one replica only, in order per
+// partition, instead of every replica consuming everything.
+//
+// The message bus of the framework addresses topics only, thus a partitioned
+// topic is a set of topics, one per partition, e.g. "orders.0" to "orders.15",
+// which maps to the subjects of JetStream or to one topic per partition on
+// other buses, see [Topic]. Publishers pick the partition by the key of the
+// message, see [Publish].
+//
+// The replicas of a consumer group announce themselves by heartbeats in a
+// shared [Membership], e.g. redis. Every replica computes the same assignment
+// from the live members and subscribes to its own partitions, see [Consumer].
+// When replicas come or go, the partitions are rebalanced: revoked partitions
+// are unsubscribed and reported to [Callbacks.OnRevoked], e.g. to flush state
+// kept per partition, before other replicas take them over. Since every
+// replica notices changes on its own heartbeat, a partition may be consumed
+// twice for up to one heartbeat interval while moving. Handlers must be
+// idempotent, as with any at-least-once delivery.
+package partition
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"log/slog"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Config encapsulates the configuration of a consumer group.
+type Config struct {
+	// Group names the consumer group. Replicas of the same
+	// service must use the same group.
+	Group string `env:"PARTITION_GROUP"`
+
+	// Identity uniquely identifies this replica. Defaults to the
+	// hostname, which is the pod name inside kubernetes.
+	Identity string `env:"PARTITION_IDENTITY"`
+
+	// HeartbeatInterval is the interval at which the replica
+	// renews its membership and checks the assignment.
+	HeartbeatInterval time.Duration `env:"PARTITION_HEARTBEAT_INTERVAL" envDefault:"3s"`
+
+	// MemberTTL is the time after which a replica that stopped
+	// renewing its membership is considered gone. It should be a
+	// few heartbeat intervals.
+	MemberTTL time.Duration `env:"PARTITION_MEMBER_TTL" envDefault:"10s"`
+}
+
+// Topic is a partitioned topic.
+type Topic struct {
+	// Name is the name of the topic, the partitions are named
+	// "<name>.<partition>".
+	Name string
+
+	// Partitions is the number of partitions. It must not change
+	// while the topic is in use, as keys would move between
+	// partitions.
+	Partitions int
+}
+
+// Partition returns the name of the topic of the partition.
+func (t Topic) Partition(p int) string { return t.Name + "." + strconv.Itoa(p) }
+
+// For returns the name of the topic of the partition of the key. Messages with
+// the same key go to the same partition, thus they are consumed in order.
+func (t Topic) For(key string) string {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	return t.Partition(int(h.Sum32() % uint32(t.Partitions)))
+}
+
+// Publish publishes the message to the partition of the key. This function
+// returns the errors of the bus.
+func Publish(ctx context.Context, bus service.MessageBus, t Topic, key string, msg []byte) error {
+	return bus.Publish(ctx, t.For(key), msg) //nolint:wrapcheck // documented errors
+}
+
+// Membership keeps track of the live replicas of consumer groups.
+type Membership interface {
+	// Heartbeat renews the membership of the member in the group
+	// for ttl, and returns the live members of the group.
+	Heartbeat(_ context.Context, group, member string, ttl time.Duration) ([]string, error)
+
+	// Leave removes the member from the group.
+	Leave(_ context.Context, group, member string) error
+}
+
+// Callbacks are invoked when partitions are assigned to or revoked from the
+// replica. The partitions are sorted.
+type Callbacks struct {
+	// OnAssigned is called before the replica starts consuming the
+	// assigned partitions.
+	OnAssigned func(_ context.Context, partitions []int)
+
+	// OnRevoked is called once the replica stopped consuming the
+	// revoked partitions, e.g. to flush state kept per partition.
+	// Other replicas may take over the partitions once it returns.
+	OnRevoked func(_ context.Context, partitions []int)
+}
+
+// Assign returns the partitions of the member, given the live members of the
+// group. The partitions are dealt round robin to the members in sorted order,
+// thus every replica computes the same assignment.
+func Assign(members []string, member string, partitions int) []int {
+	sorted := slices.Clone(members)
+	sort.Strings(sorted)
+	sorted = slices.Compact(sorted)
+	i := slices.Index(sorted, member)
+	if i < 0 {
+		return nil
+	}
+	var res []int
+	for p := i; p < partitions; p += len(sorted) {
+		res = append(res, p)
+	}
+	return res
+}
+
+// Consumer consumes the partitions of a topic assigned to the replica.
+type Consumer struct {
+	cfg   Config
+	bus   service.MessageBus
+	m     Membership
+	topic Topic
+	h     service.EventHandler
+	cb    Callbacks
+
+	mu       sync.Mutex
+	assigned map[int]*subscription
+}
+
+// NewConsumer creates a new [Consumer], which subscribes the handler to the
+// partitions assigned to the replica. The consumption starts when calling
+// [Consumer.Run].
+func NewConsumer(
+	cfg Config,
+	bus service.MessageBus,
+	m Membership,
+	t Topic,
+	h service.EventHandler,
+	cb Callbacks,
+) *Consumer {
+	if cfg.Identity == "" {
+		cfg.Identity, _ = os.Hostname()
+	}
+	return &Consumer{
+		cfg:      cfg,
+		bus:      bus,
+		m:        m,
+		topic:    t,
+		h:        h,
+		cb:       cb,
+		assigned: make(map[int]*subscription),
+	}
+}
+
+// Assigned returns the partitions the replica currently consumes.
+func (c *Consumer) Assigned() []int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	res := make([]int, 0, len(c.assigned))
+	for p := range c.assigned {
+		res = append(res, p)
+	}
+	sort.Ints(res)
+	return res
+}
+
+// Run takes part in the consumer group until ctx is cancelled. This is a
+// blocking function, usually run as a worker. When the function returns, the
+// partitions are revoked and the replica leaves the group. This function
+// returns [service.ErrBadRequest] in case the configuration is invalid.
+func (c *Consumer) Run(ctx context.Context) error {
+	if c.cfg.Group == "" || c.topic.Partitions <= 0 {
+		return fmt.Errorf("%w: consumer group and partitions are required", service.ErrBadRequest)
+	}
+	if c.cfg.HeartbeatInterval <= 0 || c.cfg.MemberTTL <= c.cfg.HeartbeatInterval {
+		return fmt.Errorf("%w: member ttl must exceed the heartbeat interval", service.ErrBadRequest)
+	}
+
+	var (
+		pending   []int // assigned on the last heartbeat, but not yet consumed
+		lastAlive = time.Now()
+	)
+	ticker := time.NewTicker(c.cfg.HeartbeatInterval)
+	defer ticker.Stop()
+	for {
+		members, err := c.m.Heartbeat(ctx, c.cfg.Group, c.cfg.Identity, c.cfg.MemberTTL)
+		switch {
+		case err != nil && ctx.Err() == nil:
+			slog.Warn("failed to renew consumer group membership",
+				slog.String("group", c.cfg.Group),
+				slog.String("error", err.Error()),
+			)
+			// The other replicas take over once the membership
+			// expires, stop consuming before that.
+			if time.Since(lastAlive) >= c.cfg.MemberTTL-c.cfg.HeartbeatInterval {
+				c.rebalance(ctx, nil, nil)
+				pending = nil
+			}
+		case err == nil:
+			lastAlive = time.Now()
+			want := Assign(members, c.cfg.Identity, c.topic.Partitions)
+			// Newly assigned partitions are consumed from the next
+			// heartbeat on, by which time their previous owners
+			// noticed the change as well.
+			var start []int
+			for _, p := range want {
+				if c.consumes(p) || slices.Contains(pending, p) {
+					start = append(start, p)
+				}
+			}
+			c.rebalance(ctx, want, start)
+			pending = want
+		}
+
+		select {
+		case <-ctx.Done():
+			c.rebalance(ctx, nil, nil)
+			//nolint:contextcheck // ctx is already cancelled
+			if err := c.m.Leave(context.Background(), c.cfg.Group, c.cfg.Identity); err != nil {
+				slog.Warn("failed to leave consumer group",
+					slog.String("group", c.cfg.Group),
+					slog.String("error", err.Error()),
+				)
+			}
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// consumes reports whether the replica consumes the partition.
+func (c *Consumer) consumes(p int) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.assigned[p] != nil
+}
+
+// rebalance stops consuming the partitions that are not wanted anymore, and
+// starts consuming the partitions to start.
+func (c *Consumer) rebalance(ctx context.Context, want, start []int) {
+	c.mu.Lock()
+	var revoked []int
+	var stopped []*subscription
+	for p, s := range c.assigned {
+		if !slices.Contains(want, p) {
+			revoked = append(revoked, p)
+			stopped = append(stopped, s)
+			delete(c.assigned, p)
+		}
+	}
+	c.mu.Unlock()
+
+	if len(revoked) > 0 {
+		for _, s := range stopped {
+			s.stop()
+		}
+		sort.Ints(revoked)
+		slog.Info("partitions revoked",
+			slog.String("group", c.cfg.Group),
+			slog.String("topic", c.topic.Name),
+			slog.Any("partitions", revoked),
+		)
+		if c.cb.OnRevoked != nil {
+			//nolint:contextcheck // flushing must outlive a cancelled ctx
+			c.cb.OnRevoked(context.WithoutCancel(ctx), revoked)
+		}
+	}
+
+	var assigned []int
+	for _, p := range start {
+		if !c.consumes(p) {
+			assigned = append(assigned, p)
+		}
+	}
+	if len(assigned) > 0 {
+		slog.Info("partitions assigned",
+			slog.String("group", c.cfg.Group),
+			slog.String("topic", c.topic.Name),
+			slog.Any("partitions", assigned),
+		)
+		if c.cb.OnAssigned != nil {
+			c.cb.OnAssigned(ctx, assigned)
+		}
+		c.mu.Lock()
+		for _, p := range assigned {
+			c.assigned[p] = c.subscribe(ctx, p)
+		}
+		c.mu.Unlock()
+	}
+	assignedGauge.Set(float64(len(c.Assigned())), c.cfg.Group, c.topic.Name)
+}
+
+// subscribe consumes the partition until the subscription is stopped.
+// Subscriptions failing with an error are retried every second.
+func (c *Consumer) subscribe(ctx context.Context, p int) *subscription {
+	ctx, cancel := context.WithCancel(ctx)
+	s := &subscription{cancel: cancel, done: make(chan struct{})}
+	topic := c.topic.Partition(p)
+	go func() {
+		defer close(s.done)
+		for {
+			err := c.bus.Subscribe(ctx, topic, c.h)
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				slog.Warn("partition subscription failed",
+					slog.String("topic", topic),
+					slog.String("error", err.Error()),
+				)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(resubscribeDelay):
+			}
+		}
+	}()
+	return s
+}
+
+// subscription is the subscription to an assigned partition.
+type subscription struct {
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+// stop cancels the subscription and waits for it to return.
+func (s *subscription) stop() {
+	s.cancel()
+	<-s.done
+}
+
+// resubscribeDelay is the delay before a failed subscription is retried.
+const resubscribeDelay = time.Second
+
+// assignedGauge is the number of partitions consumed by the replica.
+var assignedGauge = metrics.NewGauge(
+	"partition_assigned",
+	"Number of partitions of the topic consumed by this replica.",
+	"group", "topic",
+)
@@ -0,0 +1,394 @@
+// Package projection maintains the read models of a service from its events.
+// A [Projection] applies every event to its read model, e.g. a table the list
+// endpoints query, and a [Runner] feeds it the events in order, saving its
+// position as checkpoint, so that a restarted replica picks up where it
+// stopped:
+//
+//	venues := projection.Projection{
+//		Name: "venues",
+//		Handle: projection.Dispatch(
+//			projection.On(events.VenueCreated, s.onVenueCreated),
+//			projection.On(events.VenueRenamed, s.onVenueRenamed),
+//		),
+//		Reset: s.truncateVenues,
+//	}
+//	r := projection.NewRunner(cfg.Projection, es, es, venues)
+//
+// The runner follows the event store, see [Runner.Run], or consumes the events
+// published from a store by other services, see [Runner.Handler]. A read model
+// whose schema or logic changed is rebuilt by replaying the store from its
+// first event, see [Runner.Rebuild].
+package projection
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/codec"
+	"github.com/eventscompass/service-template/src/internal/events"
+	"github.com/eventscompass/service-template/src/internal/eventstore"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/workers"
+)
+
+// Config encapsulates the configuration of a [Runner].
+type Config struct {
+	// PollInterval is the interval at which the event store is
+	// polled for new events.
+	PollInterval time.Duration `env:"PROJECTION_POLL_INTERVAL" envDefault:"1s"`
+
+	// BatchSize is the maximum number of events read at once. The
+	// checkpoint is saved after every batch.
+	BatchSize int `env:"PROJECTION_BATCH_SIZE" envDefault:"100"`
+}
+
+// Projection maintains a read model.
+type Projection struct {
+	// Name identifies the projection, e.g. in its checkpoint and
+	// metrics.
+	Name string
+
+	// Handle applies the event to the read model. The events are
+	// handled in order; an event that fails is handled again, and
+	// the projection does not advance until it succeeds. Events
+	// are handled at least once, thus Handle must be idempotent,
+	// e.g. by upserting rows.
+	Handle func(context.Context, eventstore.Event) error
+
+	// Reset clears the read model before it is rebuilt. Nil if the
+	// projection cannot be rebuilt.
+	Reset func(context.Context) error
+}
+
+// Route is the handler of the events of a type, see [Dispatch].
+type Route struct {
+	typ    string
+	handle func(context.Context, eventstore.Event) error
+}
+
+// On returns the route decoding the events of the definition, upgraded to
+// the current version, and passing them to fn.
+func On[T any](def *events.Event[T], fn func(context.Context, eventstore.Event, T) error) Route {
+	return Route{typ: def.Type, handle: func(ctx context.Context, e eventstore.Event) error {
+		event, err := def.Decode(e.Meta(), e.Data)
+		if err != nil {
+			return err //nolint:wrapcheck // names the event
+		}
+		return fn(ctx, e, event)
+	}}
+}
+
+// Dispatch returns the handler passing every event to the route of its type.
+// Events of other types are skipped, since the stores and topics carry the
+// events of all read models.
+func Dispatch(routes ...Route) func(context.Context, eventstore.Event) error {
+	byType := make(map[string]Route, len(routes))
+	for _, r := range routes {
+		byType[r.typ] = r
+	}
+	return func(ctx context.Context, e eventstore.Event) error {
+		if r, ok := byType[e.Type]; ok {
+			return r.handle(ctx, e)
+		}
+		return nil
+	}
+}
+
+// Runner feeds the events to the projections.
+type Runner struct {
+	cfg         Config
+	store       eventstore.Store
+	checkpoints eventstore.Checkpoints
+	projections map[string]*projection
+	order       []*projection
+}
+
+// projection is the state of a [Projection] in the runner.
+type projection struct {
+	Projection
+
+	mu       sync.Mutex // serializes handling
+	loaded   bool
+	position int64
+}
+
+// NewRunner creates a new [Runner] of the projections. The positions of the
+// projections are saved in the checkpoints as "projection-" followed by their
+// name. The store may be nil for runners that only consume events from the
+// bus, which cannot rebuild their projections.
+func NewRunner(
+	cfg Config,
+	s eventstore.Store,
+	cp eventstore.Checkpoints,
+	ps ...Projection,
+) *Runner {
+	if cfg.PollInterval <= 0 {
+		cfg.PollInterval = defaultPollInterval
+	}
+	if cfg.BatchSize <= 0 {
+		cfg.BatchSize = defaultBatchSize
+	}
+	r := &Runner{
+		cfg:         cfg,
+		store:       s,
+		checkpoints: cp,
+		projections: make(map[string]*projection, len(ps)),
+	}
+	for _, p := range ps {
+		state := &projection{Projection: p}
+		r.projections[p.Name] = state
+		r.order = append(r.order, state)
+	}
+	return r
+}
+
+// Run feeds the new events of the store to the projections. This is a
+// blocking function that polls the store until ctx is cancelled. Only one
+// replica must run the projections of a read model shared by the replicas,
+// e.g. the leader, see package leader. This function returns
+// [service.ErrNotFound] in case the runner has no store.
+func (r *Runner) Run(ctx context.Context) error {
+	if r.store == nil {
+		return fmt.Errorf("%w: no event store for projections", service.ErrNotFound)
+	}
+	ticker := time.NewTicker(r.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		for _, p := range r.order {
+			if err := r.catchUp(ctx, p); err != nil && ctx.Err() == nil {
+				slog.Error("failed to project events",
+					slog.String("projection", p.Name), slog.String("error", err.Error()))
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Worker returns the background worker running [Runner.Run].
+func (r *Runner) Worker() workers.Worker {
+	return workers.Worker{Name: "projections", Run: r.Run, Restart: workers.RestartOnFailure}
+}
+
+// Rebuild resets the read model of the projection and replays all events of
+// the store. The projection is not fed other events until the rebuild is
+// done. This function returns [service.ErrNotFound] in case there is no such
+// projection or the runner has no store, [service.ErrNotAllowed] in case the
+// projection cannot be reset, and the errors of the projection otherwise.
+func (r *Runner) Rebuild(ctx context.Context, name string) error {
+	p, ok := r.projections[name]
+	if !ok {
+		return fmt.Errorf("%w: projection %s", service.ErrNotFound, name)
+	}
+	if r.store == nil {
+		return fmt.Errorf("%w: no event store for rebuilding %s", service.ErrNotFound, name)
+	}
+	if p.Reset == nil {
+		return fmt.Errorf("%w: projection %s cannot be reset", service.ErrNotAllowed, name)
+	}
+
+	slog.Info("rebuilding projection", slog.String("projection", name))
+	start := time.Now()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := p.Reset(ctx); err != nil {
+		return fmt.Errorf("reset %s: %w", name, err)
+	}
+	if err := r.checkpoints.SaveCheckpoint(ctx, checkpointName(name), 0); err != nil {
+		return err //nolint:wrapcheck // errors of the checkpoints
+	}
+	p.loaded, p.position = true, 0
+	if err := r.catchUpLocked(ctx, p); err != nil {
+		return err
+	}
+	rebuildDuration.ObserveSince(start, name)
+	slog.Info("rebuilt projection",
+		slog.String("projection", name), slog.Int64("position", p.position))
+	return nil
+}
+
+// Handler returns the handler feeding the events of a topic, published from
+// an event store, to the projection, e.g. for the read models of events
+// owned by other services. Events at or before the position of the projection
+// are duplicates and skipped, which relies on the [eventstore.Publisher]
+// publishing in order; events that fail are logged and dropped, since the bus
+// does not redeliver them. Events without position are handled without
+// checkpoint.
+func (r *Runner) Handler(name, topic string) service.EventHandler {
+	p := r.projections[name]
+	return func(ctx context.Context, msg []byte) {
+		meta, _, data, err := codec.OpenEnvelope(msg)
+		if err == nil {
+			err = r.handleReceived(ctx, p, eventstore.Received(topic, meta, data))
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "failed to project event",
+				slog.String("projection", name),
+				slog.String("type", meta.Type),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// handleReceived handles an event received from the bus.
+func (r *Runner) handleReceived(ctx context.Context, p *projection, e eventstore.Event) error {
+	if p == nil {
+		return fmt.Errorf("%w: projection", service.ErrNotFound)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if err := r.load(ctx, p); err != nil {
+		return err
+	}
+	if e.Position > 0 && e.Position <= p.position {
+		return nil
+	}
+	if err := r.handle(ctx, p, e); err != nil {
+		return err
+	}
+	if e.Position > 0 {
+		if err := r.checkpoints.SaveCheckpoint(ctx, checkpointName(p.Name), e.Position); err != nil {
+			return err //nolint:wrapcheck // errors of the checkpoints
+		}
+		p.position = e.Position
+	}
+	return nil
+}
+
+// catchUp feeds the events after the position of the projection to it, until
+// it reached the head of the store or an event fails.
+func (r *Runner) catchUp(ctx context.Context, p *projection) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return r.catchUpLocked(ctx, p)
+}
+
+// catchUpLocked is [Runner.catchUp] for callers holding the lock of the
+// projection.
+func (r *Runner) catchUpLocked(ctx context.Context, p *projection) error {
+	if err := r.load(ctx, p); err != nil {
+		return err
+	}
+	head, err := r.store.Head(ctx)
+	if err != nil {
+		return err //nolint:wrapcheck // errors of the store
+	}
+	defer func() { lagEvents.Set(float64(max(head-p.position, 0)), p.Name) }()
+
+	for p.position < head {
+		evs, err := r.store.ReadAll(ctx, p.position, r.cfg.BatchSize)
+		if err != nil {
+			return err //nolint:wrapcheck // errors of the store
+		}
+		if len(evs) == 0 {
+			return nil
+		}
+
+		position := p.position
+		for _, e := range evs {
+			if err = r.handle(ctx, p, e); err != nil {
+				break
+			}
+			position = e.Position
+		}
+		if position > p.position {
+			if err := r.checkpoints.SaveCheckpoint(ctx, checkpointName(p.Name), position); err != nil {
+				return err //nolint:wrapcheck // errors of the checkpoints
+			}
+			p.position = position
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// load loads the position of the projection from its checkpoint, once.
+func (r *Runner) load(ctx context.Context, p *projection) error {
+	if p.loaded {
+		return nil
+	}
+	position, err := r.checkpoints.Checkpoint(ctx, checkpointName(p.Name))
+	if err != nil {
+		return err //nolint:wrapcheck // errors of the checkpoints
+	}
+	p.loaded, p.position = true, position
+	return nil
+}
+
+// handle applies the event to the projection.
+func (r *Runner) handle(ctx context.Context, p *projection, e eventstore.Event) error {
+	if err := p.Handle(ctx, e); err != nil {
+		failures.Inc(p.Name)
+		return fmt.Errorf("project %s at position %d: %w", e.Type, e.Position, err)
+	}
+	projected.Inc(p.Name)
+	if !e.RecordedAt.IsZero() {
+		lagSeconds.Set(time.Since(e.RecordedAt).Seconds(), p.Name)
+	}
+	return nil
+}
+
+// checkpointName returns the name of the checkpoint of the projection.
+func checkpointName(name string) string { return "projection-" + name }
+
+const (
+	// defaultPollInterval is the poll interval of runners configured
+	// without one.
+	defaultPollInterval = time.Second
+
+	// defaultBatchSize is the batch size of runners configured
+	// without one.
+	defaultBatchSize = 100
+)
+
+var (
+	// projected counts the events applied to the read models.
+	projected = metrics.NewCounter(
+		"projection_events_total",
+		"Number of events applied to the read models.",
+		"projection",
+	)
+
+	// failures counts the events that the projections failed to
+	// apply.
+	failures = metrics.NewCounter(
+		"projection_failures_total",
+		"Number of events that could not be applied to the read models.",
+		"projection",
+	)
+
+	// lagEvents is the number of events of the store that the
+	// projections did not apply yet.
+	lagEvents = metrics.NewGauge(
+		"projection_lag_events",
+		"Number of events of the event store that are not applied to the read model yet.",
+		"projection",
+	)
+
+	// lagSeconds is the time between recording and projecting the
+	// last applied event.
+	lagSeconds = metrics.NewGauge(
+		"projection_lag_seconds",
+		"Seconds between recording and applying the last event applied to the read model.",
+		"projection",
+	)
+
+	// rebuildDuration observes the duration of the rebuilds.
+	rebuildDuration = metrics.NewHistogram(
+		"projection_rebuild_duration_seconds",
+		"Duration of the rebuilds of the read models.",
+		[]float64{1, 10, 60, 300, 1800, 3600},
+		"projection",
+	)
+)
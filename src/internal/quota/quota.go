@@ -0,0 +1,269 @@
+// Package quota limits the number of requests per caller, e.g. per api key,
+// user or tenant.
+//
+// Every caller has a set of limits, e.g. per minute and per day. The requests
+// are counted in fixed windows kept in a shared [Store], so that all replicas
+// enforce the same quota. Responses carry the standard X-RateLimit-* headers of
+// the most restrictive limit.
+package quota
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/httperr"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+// ErrTooManyRequests is returned when the caller exhausted its quota. Rejected
+// calls get 429 from the rest api and codes.ResourceExhausted from the grpc
+// api.
+var ErrTooManyRequests = httperr.New("too many requests", httperr.Response{
+	Status: http.StatusTooManyRequests, // 429
+	Log:    "client exhausted its quota",
+})
+
+// Config encapsulates the configuration of the default quotas.
+type Config struct {
+	// PerMinute is the number of requests a caller may make per
+	// minute. Zero disables the limit.
+	PerMinute int64 `env:"QUOTA_PER_MINUTE" envDefault:"600"`
+
+	// PerDay is the number of requests a caller may make per
+	// day. Zero disables the limit.
+	PerDay int64 `env:"QUOTA_PER_DAY" envDefault:"100000"`
+}
+
+// Limits returns the limits configured by cfg.
+func (cfg Config) Limits() []Limit {
+	var res []Limit
+	if cfg.PerMinute > 0 {
+		res = append(res, Limit{Name: "minute", Max: cfg.PerMinute, Window: time.Minute})
+	}
+	if cfg.PerDay > 0 {
+		res = append(res, Limit{Name: "day", Max: cfg.PerDay, Window: 24 * time.Hour})
+	}
+	return res
+}
+
+// Limit is the maximum number of requests within a window.
+type Limit struct {
+	// Name identifies the limit, e.g. "minute".
+	Name   string
+	Max    int64
+	Window time.Duration
+}
+
+// Store counts the requests of the callers.
+type Store interface {
+	// Incr increments the counter with the given key and
+	// returns the new value. The counter is removed at expires.
+	Incr(_ context.Context, key string, expires time.Time) (int64, error)
+}
+
+// Result is the state of the most restrictive limit of a caller after a
+// request.
+type Result struct {
+	Limit     int64
+	Remaining int64
+	Reset     time.Time
+}
+
+// Limiter enforces the quotas of the callers.
+type Limiter struct {
+	store  Store
+	limits []Limit
+	clock  clock.Clock
+	per    func(context.Context) ([]Limit, bool)
+}
+
+// NewLimiter creates a new [Limiter] enforcing the given limits on every
+// caller.
+func NewLimiter(s Store, limits ...Limit) *Limiter {
+	return &Limiter{store: s, limits: limits, clock: clock.Real}
+}
+
+// UseClock makes the limiter use the given clock for the windows, e.g. a fake
+// clock in tests. UseClock must be called before the limiter is used.
+func (l *Limiter) UseClock(c clock.Clock) {
+	l.clock = clock.Or(c)
+}
+
+// UseLimits makes the limiter enforce the limits returned by f for the
+// context of a request instead of the given limits, e.g. the limits of the
+// plan of the tenant, see [tenant.QuotaLimits]. The given limits apply if f
+// returns false. UseLimits must be called before the limiter is used.
+func (l *Limiter) UseLimits(f func(context.Context) ([]Limit, bool)) {
+	l.per = f
+}
+
+// Allow counts a request of the caller. This function returns
+// [ErrTooManyRequests] in case any of the limits is exceeded. The result is
+// returned in both cases.
+func (l *Limiter) Allow(ctx context.Context, caller string) (Result, error) {
+	now := l.clock.Now()
+	limits := l.limits
+	if l.per != nil {
+		if per, ok := l.per(ctx); ok {
+			limits = per
+		}
+	}
+	var (
+		res      Result
+		exceeded *Limit
+	)
+	for i, lim := range limits {
+		start := now.Truncate(lim.Window)
+		reset := start.Add(lim.Window)
+		key := "quota:" + lim.Name + ":" + caller + ":" + strconv.FormatInt(start.Unix(), 10)
+		n, err := l.store.Incr(ctx, key, reset)
+		if err != nil {
+			return Result{}, err
+		}
+
+		remaining := max(lim.Max-n, 0)
+		if i == 0 || remaining < res.Remaining {
+			res = Result{Limit: lim.Max, Remaining: remaining, Reset: reset}
+		}
+		if n > lim.Max && exceeded == nil {
+			exceeded = &limits[i]
+		}
+	}
+	if exceeded != nil {
+		rejected.Inc(exceeded.Name)
+		return res, fmt.Errorf("%w: %s quota of %d requests exceeded",
+			ErrTooManyRequests, exceeded.Name, exceeded.Max)
+	}
+	return res, nil
+}
+
+// Middleware returns an http middleware enforcing the quotas. The caller of a
+// request is identified by key; requests for which key returns false are not
+// limited. If the store is unavailable, the requests are let through.
+func Middleware(
+	l *Limiter,
+	key func(*http.Request) (string, bool),
+) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			caller, ok := key(r)
+			if !ok {
+				next.ServeHTTP(w, r)
+				return
+			}
+			res, err := l.Allow(ctx, caller)
+			switch {
+			case errors.Is(err, ErrTooManyRequests):
+				setHeaders(w.Header(), res, true, l.clock.Now())
+				httperr.Write(ctx, w, err)
+				return
+			case err != nil:
+				logStoreError(err)
+			default:
+				setHeaders(w.Header(), res, false, l.clock.Now())
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// UnaryServerInterceptor returns a grpc interceptor enforcing the quotas. The
+// caller of a call is identified by key, and the X-RateLimit-* values are sent
+// as response headers.
+func UnaryServerInterceptor(
+	l *Limiter,
+	key func(context.Context) (string, bool),
+) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		caller, ok := key(ctx)
+		if !ok {
+			return handler(ctx, req)
+		}
+		res, err := l.Allow(ctx, caller)
+		if err != nil && !errors.Is(err, ErrTooManyRequests) {
+			logStoreError(err)
+			return handler(ctx, req)
+		}
+
+		h := http.Header{}
+		setHeaders(h, res, err != nil, l.clock.Now())
+		md := metadata.MD{}
+		for k, vs := range h {
+			md.Set(k, vs...)
+		}
+		grpc.SetHeader(ctx, md) //nolint:errcheck,gosec // best effort
+		if err != nil {
+			return nil, status.Error(codes.ResourceExhausted, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+// ByPrincipal identifies the caller of a request by its authenticated
+// principal, see [reqctx.PrincipalFrom].
+func ByPrincipal(r *http.Request) (string, bool) { return PrincipalKey(r.Context()) }
+
+// PrincipalKey identifies the caller of a call by the principal of ctx.
+func PrincipalKey(ctx context.Context) (string, bool) {
+	p, ok := reqctx.PrincipalFrom(ctx)
+	if !ok {
+		return "", false
+	}
+	return p.Issuer + "/" + p.Subject, true
+}
+
+// ByClientIP identifies the caller of a request by its client address, see
+// [reqctx.ClientIPFrom]. This is useful for limiting anonymous callers.
+func ByClientIP(r *http.Request) (string, bool) { return ClientIPKey(r.Context()) }
+
+// ClientIPKey identifies the caller of a call by the client address of ctx.
+func ClientIPKey(ctx context.Context) (string, bool) {
+	addr, ok := reqctx.ClientIPFrom(ctx)
+	if !ok {
+		return "", false
+	}
+	return "ip/" + addr.String(), true
+}
+
+// setHeaders sets the X-RateLimit-* headers of the result at now, and the
+// Retry-After header if the request was rejected.
+func setHeaders(h http.Header, res Result, limited bool, now time.Time) {
+	reset := strconv.FormatInt(int64(res.Reset.Sub(now).Round(time.Second).Seconds()), 10)
+	h.Set("X-RateLimit-Limit", strconv.FormatInt(res.Limit, 10))
+	h.Set("X-RateLimit-Remaining", strconv.FormatInt(res.Remaining, 10))
+	h.Set("X-RateLimit-Reset", reset)
+	if limited {
+		h.Set("Retry-After", reset)
+	}
+}
+
+// logStoreError logs that the quota could not be enforced.
+func logStoreError(err error) {
+	slog.Warn("failed to enforce quota, letting request through",
+		slog.String("error", err.Error()))
+}
+
+// rejected counts the requests rejected because of exhausted quotas.
+var rejected = metrics.NewCounter(
+	"quota_rejected_total",
+	"Number of requests rejected because of an exhausted quota.",
+	"limit",
+)
@@ -0,0 +1,208 @@
+package quota
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestLimiterAllow(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	limits := []Limit{
+		{Name: "minute", Max: 2, Window: time.Minute},
+		{Name: "hour", Max: 3, Window: time.Hour},
+	}
+	type call struct {
+		caller        string
+		advance       time.Duration
+		wantRemaining int64
+		wantReset     time.Time
+		wantErr       error
+	}
+	tests := []struct {
+		name  string
+		calls []call
+	}{
+		{
+			name: "most restrictive limit",
+			calls: []call{
+				{caller: "a", wantRemaining: 1, wantReset: now.Add(30 * time.Second)},
+				{caller: "a", wantRemaining: 0, wantReset: now.Add(30 * time.Second)},
+				{caller: "a", wantRemaining: 0, wantReset: now.Add(30 * time.Second), wantErr: ErrTooManyRequests},
+			},
+		},
+		{
+			name: "callers are counted apart",
+			calls: []call{
+				{caller: "a", wantRemaining: 1, wantReset: now.Add(30 * time.Second)},
+				{caller: "a", wantRemaining: 0, wantReset: now.Add(30 * time.Second)},
+				{caller: "b", wantRemaining: 1, wantReset: now.Add(30 * time.Second)},
+			},
+		},
+		{
+			name: "next window",
+			calls: []call{
+				{caller: "a", wantRemaining: 1, wantReset: now.Add(30 * time.Second)},
+				{caller: "a", wantRemaining: 0, wantReset: now.Add(30 * time.Second)},
+				{caller: "a", advance: 30 * time.Second, wantRemaining: 0, wantReset: now.Add(59*time.Minute + 30*time.Second)},
+				{caller: "a", wantRemaining: 0, wantReset: now.Add(90 * time.Second), wantErr: ErrTooManyRequests},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			clk := servicetest.NewFakeClock(now)
+			store := NewMemoryStore()
+			store.UseClock(clk)
+			l := NewLimiter(store, limits...)
+			l.UseClock(clk)
+			for i, c := range tt.calls {
+				clk.Advance(c.advance)
+				res, err := l.Allow(context.Background(), c.caller)
+				if !errors.Is(err, c.wantErr) {
+					t.Errorf("call %d: got error %v, want %v", i, err, c.wantErr)
+				}
+				if res.Remaining != c.wantRemaining || !res.Reset.Equal(c.wantReset) {
+					t.Errorf("call %d: got %d remaining until %s, want %d until %s",
+						i, res.Remaining, res.Reset, c.wantRemaining, c.wantReset)
+				}
+			}
+		})
+	}
+}
+
+func TestLimiterUseLimits(t *testing.T) {
+	l := NewLimiter(NewMemoryStore(), Limit{Name: "minute", Max: 1, Window: time.Minute})
+	l.UseLimits(func(ctx context.Context) ([]Limit, bool) {
+		if p, ok := reqctx.PrincipalFrom(ctx); ok && p.Subject == "premium" {
+			return []Limit{{Name: "minute", Max: 100, Window: time.Minute}}, true
+		}
+		return nil, false
+	})
+	tests := []struct {
+		name      string
+		subject   string
+		wantLimit int64
+		wantErr   error
+	}{
+		{"default limits", "basic", 1, ErrTooManyRequests},
+		{"limits of the caller", "premium", 100, nil},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := reqctx.WithPrincipal(context.Background(), &reqctx.Principal{Subject: tt.subject})
+			l.Allow(ctx, tt.subject) //nolint:errcheck // counts the first request
+			res, err := l.Allow(ctx, tt.subject)
+			if res.Limit != tt.wantLimit || !errors.Is(err, tt.wantErr) {
+				t.Errorf("got limit %d, %v, want %d, %v", res.Limit, err, tt.wantLimit, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 30, 0, time.UTC)
+	tests := []struct {
+		name       string
+		store      Store
+		requests   int
+		key        func(*http.Request) (string, bool)
+		wantStatus int
+		wantHeader http.Header
+	}{
+		{
+			name:       "allowed",
+			store:      NewMemoryStore(),
+			requests:   1,
+			key:        func(*http.Request) (string, bool) { return "a", true },
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{
+				"X-Ratelimit-Limit":     {"1"},
+				"X-Ratelimit-Remaining": {"0"},
+				"X-Ratelimit-Reset":     {"30"},
+			},
+		},
+		{
+			name:       "rejected",
+			store:      NewMemoryStore(),
+			requests:   2,
+			key:        func(*http.Request) (string, bool) { return "a", true },
+			wantStatus: http.StatusTooManyRequests,
+			wantHeader: http.Header{
+				"X-Ratelimit-Remaining": {"0"},
+				"Retry-After":           {"30"},
+			},
+		},
+		{
+			name:       "no caller",
+			store:      NewMemoryStore(),
+			requests:   2,
+			key:        func(*http.Request) (string, bool) { return "", false },
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{"X-Ratelimit-Limit": nil},
+		},
+		{
+			name:       "store unavailable",
+			store:      failingStore{},
+			requests:   2,
+			key:        func(*http.Request) (string, bool) { return "a", true },
+			wantStatus: http.StatusOK,
+			wantHeader: http.Header{"X-Ratelimit-Limit": nil},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			clk := servicetest.NewFakeClock(now)
+			if s, ok := tt.store.(*MemoryStore); ok {
+				s.UseClock(clk)
+			}
+			l := NewLimiter(tt.store, Limit{Name: "minute", Max: 1, Window: time.Minute})
+			l.UseClock(clk)
+			h := Middleware(l, tt.key)(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+			var rec *httptest.ResponseRecorder
+			for i := 0; i < tt.requests; i++ {
+				rec = httptest.NewRecorder()
+				h.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/venues", nil))
+			}
+			servicetest.AssertHTTPResponse(t, rec.Result(), servicetest.ErrorResponse{
+				Status: tt.wantStatus,
+				Header: tt.wantHeader,
+			})
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	clk := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	store := NewMemoryStore()
+	store.UseClock(clk)
+	l := NewLimiter(store, Limit{Name: "minute", Max: 1, Window: time.Minute})
+	l.UseClock(clk)
+	intercept := UnaryServerInterceptor(l, func(context.Context) (string, bool) { return "a", true })
+	handler := func(context.Context, any) (any, error) { return "ok", nil }
+	info := &grpc.UnaryServerInfo{FullMethod: "/venues.v1.Venues/GetVenue"}
+	if _, err := intercept(context.Background(), nil, info, handler); err != nil {
+		t.Fatalf("got error %v, want the first call allowed", err)
+	}
+	_, err := intercept(context.Background(), nil, info, handler)
+	servicetest.AssertGRPCError(t, err, codes.ResourceExhausted, "minute quota")
+}
+
+// failingStore is a [Store] that is unavailable.
+type failingStore struct{}
+
+func (failingStore) Incr(context.Context, string, time.Time) (int64, error) {
+	return 0, errors.New("connection refused")
+}
@@ -0,0 +1,87 @@
+package quota
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"github.com/redis/go-redis/v9"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+// RedisStore is a [Store] keeping the counters in redis, see
+// [store.OpenRedis].
+type RedisStore struct {
+	client redis.UniversalClient
+}
+
+var _ Store = (*RedisStore)(nil)
+
+// NewRedisStore creates a new [RedisStore].
+func NewRedisStore(c redis.UniversalClient) *RedisStore {
+	return &RedisStore{client: c}
+}
+
+// Incr implements the [Store] interface.
+func (s *RedisStore) Incr(ctx context.Context, key string, expires time.Time) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := s.client.TxPipelined(ctx, func(p redis.Pipeliner) error {
+		incr = p.Incr(ctx, key)
+		p.ExpireAt(ctx, key, expires)
+		return nil
+	})
+	if err != nil {
+		return 0, service.Unexpected(ctx, err)
+	}
+	return incr.Val(), nil
+}
+
+// MemoryStore is a [Store] keeping the counters in memory. The quotas are
+// enforced per replica, which is only useful for tests and for running a single
+// replica locally.
+type MemoryStore struct {
+	mu       sync.Mutex
+	counters map[string]memoryCounter
+	clock    clock.Clock
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new [MemoryStore].
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{counters: make(map[string]memoryCounter), clock: clock.Real}
+}
+
+// UseClock makes the store use the given clock for expiring the counters, e.g.
+// a fake clock in tests.
+func (s *MemoryStore) UseClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock.Or(c)
+}
+
+// Incr implements the [Store] interface.
+func (s *MemoryStore) Incr(_ context.Context, key string, expires time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.clock.Now()
+	for k, c := range s.counters {
+		if now.After(c.expires) {
+			delete(s.counters, k)
+		}
+	}
+	c := s.counters[key]
+	c.n++
+	c.expires = expires
+	s.counters[key] = c
+	return c.n, nil
+}
+
+// memoryCounter is a counter of a [MemoryStore].
+type memoryCounter struct {
+	n       int64
+	expires time.Time
+}
@@ -0,0 +1,170 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"go.opentelemetry.io/otel/propagation"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/tracing"
+)
+
+// BatchConfig encapsulates the configuration of batched subscriptions.
+type BatchConfig struct {
+	// Size is the maximum number of messages of a batch.
+	Size int `env:"MESSAGE_BUS_BATCH_SIZE" envDefault:"100"`
+
+	// Window is the maximum time a batch waits to fill up, starting
+	// with its first message.
+	Window time.Duration `env:"MESSAGE_BUS_BATCH_WINDOW" envDefault:"1s"`
+}
+
+// Message is a message received from the bus.
+type Message struct {
+	Topic string
+	Body  []byte
+}
+
+// BatchHandler is a callback function, which is executed with the batches of
+// messages received by a batched subscription, e.g. to write them to a
+// database with a single bulk operation. The messages of a batch are
+// delivered again in case the handler returns an error.
+type BatchHandler func(ctx context.Context, msgs []Message) error
+
+// SubscribeBatch subscribes to the topic like [Bus.Subscribe] does, but calls
+// the handler with batches of messages. A batch is handled once it holds
+// [BatchConfig.Size] messages, or once [BatchConfig.Window] elapsed since its
+// first message, whichever comes first. The size of the batches is capped by
+// the prefetch of the topic, see [Config.Prefetch]. The messages of a batch
+// are acknowledged together once the handler returns, or returned to the
+// queue in case the handler fails. This is a blocking function. The
+// subscription is set up again once the bus reconnects. This function returns
+// [service.ErrConnectionClosed] in case the subscription cannot be set up, or
+// it is closed by the broker or by [Bus.Close].
+func (b *Bus) SubscribeBatch(ctx context.Context, topic string, h BatchHandler) error {
+	return b.resubscribe(ctx, topic, func(c *connection) error {
+		return b.subscribeBatch(ctx, c, topic, h)
+	})
+}
+
+// subscribeBatch subscribes to the topic over the connection, see
+// [Bus.SubscribeBatch].
+func (b *Bus) subscribeBatch(
+	ctx context.Context,
+	c *connection,
+	topic string,
+	h BatchHandler,
+) error {
+	size, window := max(b.cfg.Batch.Size, 1), b.cfg.Batch.Window
+	if prefetch := b.topicPrefetch(topic); prefetch > 0 {
+		size = min(size, prefetch)
+	}
+
+	ch, err := c.sub.Channel()
+	if err != nil {
+		return fmt.Errorf("%w: open channel: %v", service.ErrConnectionClosed, err)
+	}
+	defer ch.Close() //nolint:errcheck // intentional
+
+	// The broker must deliver a full batch before any of its messages is
+	// acknowledged, thus the batches are capped by the prefetch, and the
+	// prefetch is one batch.
+	if err := b.setPrefetch(ch, topic, size); err != nil {
+		return err
+	}
+	deliveries, err := b.consume(ctx, ch, topic)
+	if err != nil {
+		return err
+	}
+
+	timer := time.NewTimer(window)
+	timer.Stop()
+	defer timer.Stop()
+
+	var (
+		batch   = make([]Message, 0, size)
+		headers = make([]propagation.TextMapCarrier, 0, size)
+		last    uint64 // the delivery tag of the last message of the batch
+	)
+	flush := func() {
+		timer.Stop()
+		if len(batch) == 0 { // the timer fired while the batch was flushed
+			return
+		}
+		batchSize.Observe(float64(len(batch)))
+		hctx, span := tracing.StartConsumeBatch(ctx, topic, headers)
+		err := h(hctx, batch)
+		tracing.End(span, err)
+		if err != nil {
+			slog.Error("failed to handle batch",
+				slog.String("topic", topic),
+				slog.Int("messages", len(batch)),
+				slog.String("error", err.Error()),
+			)
+			batchFailures.Inc()
+			err = ch.Nack(last, true, true)
+			logAckError(topic, err)
+		} else {
+			logAckError(topic, ch.Ack(last, true))
+		}
+		// The handler may keep the messages, thus the batch is not
+		// reused.
+		batch = make([]Message, 0, size)
+		headers = headers[:0]
+	}
+
+	for {
+		// Unacknowledged messages are delivered again once the channel
+		// is closed, thus a partial batch is not flushed on return.
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-timer.C:
+			flush()
+		case d, ok := <-deliveries:
+			if !ok {
+				if ctx.Err() != nil {
+					return nil
+				}
+				return fmt.Errorf("%w: subscription to %s closed", service.ErrConnectionClosed, topic)
+			}
+			if len(batch) == 0 {
+				timer.Reset(window)
+			}
+			consumedMessages.Inc(topic)
+			batch = append(batch, Message{Topic: d.RoutingKey, Body: d.Body})
+			headers = append(headers, headerCarrier(d.Headers))
+			last = d.DeliveryTag
+			if len(batch) >= size {
+				flush()
+			}
+		}
+	}
+}
+
+// logAckError logs the error acknowledging messages, if any.
+func logAckError(topic string, err error) {
+	if err != nil {
+		slog.Error("failed to acknowledge messages",
+			slog.String("topic", topic), slog.String("error", err.Error()))
+	}
+}
+
+var (
+	// batchSize observes the number of messages of the handled batches.
+	batchSize = metrics.NewHistogram(
+		"rabbitmq_batch_size",
+		"Number of messages of the handled batches.",
+		[]float64{1, 10, 50, 100, 500, 1000},
+	)
+
+	// batchFailures counts the batches returned to the queue.
+	batchFailures = metrics.NewCounter(
+		"rabbitmq_batch_failures_total",
+		"Number of batches that failed to be handled.",
+	)
+)
@@ -0,0 +1,217 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/eventscompass/service-template/src/internal/delivery"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// BufferConfig encapsulates the configuration of the buffered publisher.
+type BufferConfig struct {
+	// Size is the number of messages buffered before publishing
+	// blocks. Zero publishes every message synchronously.
+	Size int `env:"MESSAGE_BUS_BUFFER_SIZE" envDefault:"0"`
+
+	// BatchSize is the maximum number of messages flushed at once.
+	BatchSize int `env:"MESSAGE_BUS_BUFFER_BATCH_SIZE" envDefault:"100"`
+
+	// FlushInterval is the maximum time a message waits in the
+	// buffer.
+	FlushInterval time.Duration `env:"MESSAGE_BUS_BUFFER_FLUSH_INTERVAL" envDefault:"100ms"`
+
+	// FlushTimeout is the time given to flush the buffer on
+	// [Buffered.Close], after which the buffered messages are lost.
+	FlushTimeout time.Duration `env:"MESSAGE_BUS_BUFFER_FLUSH_TIMEOUT" envDefault:"10s"`
+}
+
+// Buffered is a [service.MessageBus] that publishes asynchronously, e.g. for
+// high-frequency telemetry events, where waiting for the broker on every
+// message costs more than a message lost now and then. Publish only enqueues
+// the message; the buffer is flushed in the background in batches, which are
+// published concurrently. Publish blocks while the buffer is full, so that
+// the publishers slow down to the pace of the broker instead of growing the
+// buffer unbounded. Messages that fail to be published are logged and
+// dropped. Subscriptions are passed through to the wrapped bus.
+type Buffered struct {
+	service.MessageBus
+	cfg   BufferConfig
+	queue chan bufferedMessage
+	done  chan struct{}
+
+	// ctx is the context of the background publishes, cancelled when
+	// the flush on close times out.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// mu guards closed. Publishing holds a read lock, so that the queue
+	// is not closed while a message is being sent.
+	mu     sync.RWMutex
+	closed bool
+}
+
+var _ service.MessageBus = (*Buffered)(nil)
+
+// NewBuffered wraps the bus with a [Buffered] publisher and starts flushing
+// it in the background. The buffer must be closed with [Buffered.Close].
+func NewBuffered(bus service.MessageBus, cfg BufferConfig) *Buffered {
+	ctx, cancel := context.WithCancel(context.Background())
+	b := &Buffered{
+		MessageBus: bus,
+		cfg:        cfg,
+		queue:      make(chan bufferedMessage, max(cfg.Size, 1)),
+		done:       make(chan struct{}),
+		ctx:        ctx,
+		cancel:     cancel,
+	}
+	go b.flush()
+	return b
+}
+
+// Publish implements the [service.MessageBus] interface. It enqueues the
+// message, which must not be modified afterwards, and returns before the
+// message is published. This function returns [service.ErrTimeOut] in case
+// ctx is done while the buffer is full, and [service.ErrNotAllowed] in case
+// the publisher is closed.
+func (b *Buffered) Publish(ctx context.Context, topic string, msg []byte) error {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+	if b.closed {
+		return fmt.Errorf("%w: publish to %s: buffered publisher is closed", service.ErrNotAllowed, topic)
+	}
+
+	m := bufferedMessage{
+		topic: topic,
+		msg:   msg,
+		span:  trace.SpanContextFromContext(ctx),
+		md:    delivery.MetadataFrom(ctx),
+	}
+	select {
+	case b.queue <- m:
+		bufferDepth.Inc()
+		return nil
+	default:
+	}
+	bufferFull.Inc()
+	select {
+	case b.queue <- m:
+		bufferDepth.Inc()
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("%w: publish to %s: buffer is full: %v", service.ErrTimeOut, topic, ctx.Err())
+	}
+}
+
+// Close implements the [io.Closer] interface. It stops accepting messages,
+// flushes the buffer, waiting up to [BufferConfig.FlushTimeout], and closes
+// the wrapped bus.
+func (b *Buffered) Close() error {
+	b.mu.Lock()
+	if b.closed {
+		b.mu.Unlock()
+		return nil
+	}
+	b.closed = true
+	close(b.queue)
+	b.mu.Unlock()
+
+	timer := time.NewTimer(b.cfg.FlushTimeout)
+	defer timer.Stop()
+	var err error
+	select {
+	case <-b.done:
+	case <-timer.C:
+		b.cancel() // fail the remaining publishes fast
+		<-b.done
+		err = fmt.Errorf("%w: flush buffered messages within %s", service.ErrTimeOut, b.cfg.FlushTimeout)
+	}
+	b.cancel()
+	return errors.Join(err, b.MessageBus.Close())
+}
+
+// flush publishes the buffered messages in batches until the queue is closed
+// and drained.
+func (b *Buffered) flush() {
+	defer close(b.done)
+	size := max(b.cfg.BatchSize, 1)
+	ticker := time.NewTicker(b.cfg.FlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]bufferedMessage, 0, size)
+	for {
+		select {
+		case m, ok := <-b.queue:
+			if !ok {
+				b.publish(batch)
+				return
+			}
+			bufferDepth.Dec()
+			if batch = append(batch, m); len(batch) >= size {
+				b.publish(batch)
+				batch = batch[:0]
+			}
+		case <-ticker.C:
+			b.publish(batch)
+			batch = batch[:0]
+		}
+	}
+}
+
+// publish publishes the messages of a batch concurrently and waits for them.
+func (b *Buffered) publish(batch []bufferedMessage) {
+	var wg sync.WaitGroup
+	for _, m := range batch {
+		m := m
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			// The message is published after its request returned, thus
+			// only the trace and the metadata of the request are kept.
+			ctx := delivery.WithMetadata(trace.ContextWithSpanContext(b.ctx, m.span), m.md)
+			if err := b.MessageBus.Publish(ctx, m.topic, m.msg); err != nil {
+				bufferDropped.Inc()
+				slog.Error("failed to publish buffered message",
+					slog.String("topic", m.topic), slog.String("error", err.Error()))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// bufferedMessage is a message waiting in the buffer of a [Buffered].
+type bufferedMessage struct {
+	topic string
+	msg   []byte
+	span  trace.SpanContext // of the publisher, see the tracing package
+	md    delivery.Metadata
+}
+
+var (
+	// bufferDepth is the number of messages waiting in the buffer.
+	bufferDepth = metrics.NewGauge(
+		"rabbitmq_buffer_depth",
+		"Number of buffered messages waiting to be published.",
+	)
+
+	// bufferFull counts the publishes that found the buffer full and had
+	// to wait, i.e. the backpressure on the publishers.
+	bufferFull = metrics.NewCounter(
+		"rabbitmq_buffer_full_total",
+		"Number of publishes that waited for a full buffer.",
+	)
+
+	// bufferDropped counts the buffered messages that failed to be
+	// published.
+	bufferDropped = metrics.NewCounter(
+		"rabbitmq_buffer_dropped_total",
+		"Number of buffered messages that failed to be published.",
+	)
+)
@@ -0,0 +1,225 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/eventscompass/service-template/src/internal/admin"
+	"github.com/eventscompass/service-template/src/internal/delivery"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/resilience"
+)
+
+// DeadLetterConfig encapsulates the configuration of the retries of the
+// messages whose handlers fail, see [delivery.Fail], and of the dead-letter
+// topic that the messages are republished to once the retries are exhausted.
+type DeadLetterConfig struct {
+	// Topic is the dead-letter topic. A durable queue of the same
+	// name is bound to it on Dial, which keeps the dead-lettered
+	// messages until they are inspected or replayed. Empty drops the
+	// messages once the retries are exhausted.
+	Topic string `env:"MESSAGE_BUS_DEAD_LETTER_TOPIC"`
+
+	// Attempts is the number of times a message is handled before it
+	// is dead-lettered, including the first one. Messages failing
+	// with an error that is not retryable, e.g. a malformed message
+	// failing with [service.ErrBadRequest], are dead-lettered at
+	// once, see [resilience.IsRetryable].
+	Attempts int `env:"MESSAGE_BUS_HANDLER_ATTEMPTS" envDefault:"3"`
+
+	// InitialBackoff is the delay before the first retry. Every
+	// following retry doubles the delay, up to MaxBackoff. The
+	// subscription handles no other message in the meantime.
+	InitialBackoff time.Duration `env:"MESSAGE_BUS_HANDLER_INITIAL_BACKOFF" envDefault:"100ms"`
+	MaxBackoff     time.Duration `env:"MESSAGE_BUS_HANDLER_MAX_BACKOFF" envDefault:"2s"`
+}
+
+// The headers describing the failure of a dead-lettered message.
+const (
+	// HeaderDeadLetterTopic is the topic the message was published to.
+	HeaderDeadLetterTopic = "x-dead-letter-topic"
+
+	// HeaderDeadLetterError is the error of the last attempt.
+	HeaderDeadLetterError = "x-dead-letter-error"
+
+	// HeaderDeadLetterAttempts is the number of attempts.
+	HeaderDeadLetterAttempts = "x-dead-letter-attempts"
+
+	// HeaderDeadLetterTime is the time the message was dead-lettered,
+	// formatted as RFC 3339.
+	HeaderDeadLetterTime = "x-dead-letter-time"
+)
+
+// handle handles a message delivered to the subscription to the topic,
+// retrying it as configured, and dead-letters the message once the retries are
+// exhausted. The message is acknowledged once it is handled or dead-lettered,
+// and returned to the queue in case the subscription is cancelled before. The
+// messages settled by the handler, see [delivery.Message], are not retried.
+func (b *Bus) handle(
+	ctx context.Context,
+	topic string,
+	h service.EventHandler,
+	d amqp.Delivery,
+) error {
+	cfg := b.cfg.DeadLetter
+	m := newMessage(topic, d)
+	var (
+		settlement delivery.Settlement
+		herr       error
+	)
+	err := resilience.Retry(ctx, resilience.Policy{
+		MaxAttempts:    max(cfg.Attempts, 1),
+		InitialBackoff: cfg.InitialBackoff,
+		MaxBackoff:     cfg.MaxBackoff,
+	}, func(ctx context.Context) error {
+		m.Attempt++
+		settlement, herr = delivery.Handle(ctx, h, m)
+		if settlement != delivery.Unsettled {
+			return nil
+		}
+		return herr
+	})
+	switch settlement {
+	case delivery.Acked:
+		return d.Ack(false) //nolint:wrapcheck // logged by the caller
+	case delivery.Requeued:
+		return d.Nack(false, true) //nolint:wrapcheck // logged by the caller
+	case delivery.Rejected:
+		err = herr
+	}
+	switch {
+	case err == nil:
+		return d.Ack(false) //nolint:wrapcheck // logged by the caller
+	case ctx.Err() != nil:
+		return d.Nack(false, true) //nolint:wrapcheck // logged by the caller
+	}
+
+	handlerFailures.Inc(topic)
+	slog.ErrorContext(ctx, "failed to handle message",
+		slog.String("topic", topic),
+		slog.Int("attempts", m.Attempt),
+		slog.String("error", err.Error()),
+	)
+	if cfg.Topic == "" {
+		return d.Ack(false) //nolint:wrapcheck // logged by the caller
+	}
+	if err := b.deadLetter(ctx, topic, d, err, m.Attempt); err != nil {
+		slog.ErrorContext(ctx, "failed to dead-letter message, returning it to the queue",
+			slog.String("topic", topic),
+			slog.String("error", err.Error()),
+		)
+		return d.Nack(false, true) //nolint:wrapcheck // logged by the caller
+	}
+	deadLettered.Inc(topic)
+	return d.Ack(false) //nolint:wrapcheck // logged by the caller
+}
+
+// newMessage returns the message handed to the handlers, see
+// [delivery.Handler]. The headers that are not strings are formatted.
+func newMessage(topic string, d amqp.Delivery) *delivery.Message {
+	headers := make(map[string]string, len(d.Headers))
+	for k, v := range d.Headers {
+		if s, ok := v.(string); ok {
+			headers[k] = s
+		} else {
+			headers[k] = fmt.Sprint(v)
+		}
+	}
+	return &delivery.Message{
+		Topic:       topic,
+		Body:        d.Body,
+		Metadata:    delivery.Metadata{Headers: headers, ContentType: d.ContentType},
+		Redelivered: d.Redelivered,
+	}
+}
+
+// deadLetter republishes the message to the dead-letter topic, with its
+// headers and the headers describing the failure.
+func (b *Bus) deadLetter(
+	ctx context.Context,
+	topic string,
+	d amqp.Delivery,
+	cause error,
+	attempts int,
+) error {
+	headers := make(amqp.Table, len(d.Headers)+4) //nolint:gomnd // the failure headers
+	for k, v := range d.Headers {
+		headers[k] = v
+	}
+	headers[HeaderDeadLetterTopic] = topic
+	headers[HeaderDeadLetterError] = cause.Error()
+	headers[HeaderDeadLetterAttempts] = int32(attempts) //nolint:gosec // bounded by the config
+	headers[HeaderDeadLetterTime] = time.Now().UTC().Format(time.RFC3339)
+	return b.publish(ctx, b.cfg.DeadLetter.Topic, amqp.Publishing{
+		Headers:      headers,
+		ContentType:  d.ContentType,
+		DeliveryMode: amqp.Persistent,
+		Body:         d.Body,
+	})
+}
+
+// declareDeadLetterQueue declares the durable queue of the dead-letter topic,
+// if any.
+func (b *Bus) declareDeadLetterQueue(c *connection) error {
+	topic := b.cfg.DeadLetter.Topic
+	if topic == "" {
+		return nil
+	}
+	ch, err := c.pub.Channel()
+	if err != nil {
+		return fmt.Errorf("%w: open channel: %v", service.ErrConnectionClosed, err)
+	}
+	defer ch.Close() //nolint:errcheck // intentional
+	if _, err := ch.QueueDeclare(topic, true, false, false, false, nil); err != nil {
+		return fmt.Errorf("%w: declare dead-letter queue %s: %v", service.ErrConnectionClosed, topic, err)
+	}
+	if err := ch.QueueBind(topic, topic, b.cfg.Exchange, false, nil); err != nil {
+		return fmt.Errorf("%w: bind dead-letter queue %s: %v", service.ErrConnectionClosed, topic, err)
+	}
+	return nil
+}
+
+// registerQuarantine registers the queue of the dead-letter topic with the
+// quarantine of the admin server, see [admin.RegisterQuarantine].
+func (b *Bus) registerQuarantine() {
+	topic := b.cfg.DeadLetter.Topic
+	admin.RegisterQuarantine("message_bus", func(context.Context) (any, error) {
+		ch, err := b.current().pub.Channel()
+		if err != nil {
+			return nil, fmt.Errorf("%w: open channel: %v", service.ErrConnectionClosed, err)
+		}
+		defer ch.Close() //nolint:errcheck // intentional
+		q, err := ch.QueueDeclarePassive(topic, true, false, false, false, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: inspect dead-letter queue %s: %v",
+				service.ErrConnectionClosed, topic, err)
+		}
+		return struct {
+			Queue    string `json:"queue"`
+			Messages int    `json:"messages"`
+		}{q.Name, q.Messages}, nil
+	})
+}
+
+var (
+	// handlerFailures counts the messages whose handlers failed on
+	// every attempt.
+	handlerFailures = metrics.NewCounter(
+		"rabbitmq_handler_failures_total",
+		"Number of messages whose handlers failed on every attempt.",
+		"topic",
+	)
+
+	// deadLettered counts the messages republished to the dead-letter
+	// topic.
+	deadLettered = metrics.NewCounter(
+		"rabbitmq_dead_lettered_messages_total",
+		"Number of messages republished to the dead-letter topic.",
+		"topic",
+	)
+)
@@ -0,0 +1,270 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/eventscompass/service-template/src/internal/delivery"
+)
+
+func TestBusHandleRetries(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name string
+		// failures is the number of attempts failing with err.
+		failures     int
+		err          error
+		deadLetter   string
+		publishErr   error
+		wantAttempts int
+		wantOutcome  string
+		wantDead     bool
+	}{
+		{
+			name:         "handled",
+			wantAttempts: 1,
+			wantOutcome:  "ack",
+		},
+		{
+			name:         "handled on retry",
+			failures:     2,
+			err:          errFailed,
+			wantAttempts: 3,
+			wantOutcome:  "ack",
+		},
+		{
+			name:         "dropped without a dead-letter topic",
+			failures:     3,
+			err:          errFailed,
+			wantAttempts: 3,
+			wantOutcome:  "ack",
+		},
+		{
+			name:         "dead-lettered once the retries are exhausted",
+			failures:     3,
+			err:          errFailed,
+			deadLetter:   "dead",
+			wantAttempts: 3,
+			wantOutcome:  "ack",
+			wantDead:     true,
+		},
+		{
+			name:         "dead-lettered at once if not retryable",
+			failures:     1,
+			err:          fmt.Errorf("%w: malformed", service.ErrBadRequest),
+			deadLetter:   "dead",
+			wantAttempts: 1,
+			wantOutcome:  "ack",
+			wantDead:     true,
+		},
+		{
+			name:         "requeued if the dead-letter topic fails",
+			failures:     3,
+			err:          errFailed,
+			deadLetter:   "dead",
+			publishErr:   amqp.ErrClosed,
+			wantAttempts: 3,
+			wantOutcome:  "requeue",
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &fakeBroker{publishErr: tt.publishErr}
+			b := newTestBus(broker, Config{Exchange: "events", DeadLetter: DeadLetterConfig{
+				Topic:          tt.deadLetter,
+				Attempts:       3,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			}})
+			attempts := 0
+			h := func(ctx context.Context, _ []byte) {
+				if attempts++; attempts <= tt.failures {
+					delivery.Fail(ctx, tt.err)
+				}
+			}
+			a := &fakeAcker{}
+			d := amqp.Delivery{
+				Acknowledger: a,
+				Headers:      amqp.Table{"x-tenant": "t1"},
+				ContentType:  "application/json",
+				Body:         []byte("body"),
+			}
+			if err := b.handle(context.Background(), "venues.created", h, d); err != nil {
+				t.Fatalf("handle: %v", err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if got := a.outcome(); got != tt.wantOutcome {
+				t.Errorf("got outcome %q, want %q", got, tt.wantOutcome)
+			}
+
+			msgs := broker.published()
+			if got := len(msgs) == 1; got != tt.wantDead {
+				t.Fatalf("got %d dead-lettered messages, want dead-lettered %v", len(msgs), tt.wantDead)
+			}
+			if !tt.wantDead {
+				return
+			}
+			m := msgs[0].msg
+			if msgs[0].key != "dead" || string(m.Body) != "body" || m.ContentType != "application/json" {
+				t.Errorf("got %q (%s) published to %s, want the message published to dead", m.Body, m.ContentType, msgs[0].key)
+			}
+			want := map[string]any{
+				"x-tenant":               "t1",
+				HeaderDeadLetterTopic:    "venues.created",
+				HeaderDeadLetterError:    tt.err.Error(),
+				HeaderDeadLetterAttempts: int32(tt.wantAttempts),
+			}
+			for k, v := range want {
+				if m.Headers[k] != v {
+					t.Errorf("got header %s %v, want %v", k, m.Headers[k], v)
+				}
+			}
+			if _, err := time.Parse(time.RFC3339, fmt.Sprint(m.Headers[HeaderDeadLetterTime])); err != nil {
+				t.Errorf("got invalid header %s: %v", HeaderDeadLetterTime, err)
+			}
+		})
+	}
+}
+
+func TestBusHandleCancelled(t *testing.T) {
+	broker := &fakeBroker{}
+	b := newTestBus(broker, Config{DeadLetter: DeadLetterConfig{
+		Topic:          "dead",
+		Attempts:       3,
+		InitialBackoff: time.Hour,
+		MaxBackoff:     time.Hour,
+	}})
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	h := func(ctx context.Context, _ []byte) {
+		delivery.Fail(ctx, errors.New("failed"))
+		cancel() // e.g. the service stops while the message waits for a retry
+	}
+	a := &fakeAcker{}
+	if err := b.handle(ctx, "venues.created", h, amqp.Delivery{Acknowledger: a}); err != nil {
+		t.Fatalf("handle: %v", err)
+	}
+	if got := a.outcome(); got != "requeue" {
+		t.Errorf("got outcome %q, want requeue", got)
+	}
+	if msgs := broker.published(); len(msgs) != 0 {
+		t.Errorf("got %d dead-lettered messages, want none", len(msgs))
+	}
+}
+
+func TestBusHandleSettlements(t *testing.T) {
+	tests := []struct {
+		name         string
+		h            func(ctx context.Context, m *delivery.Message)
+		wantAttempts int
+		wantOutcome  string
+		wantDead     bool
+	}{
+		{
+			name: "acked before failing",
+			h: func(ctx context.Context, m *delivery.Message) {
+				m.Ack()
+				delivery.Fail(ctx, errors.New("failed"))
+			},
+			wantAttempts: 1,
+			wantOutcome:  "ack",
+		},
+		{
+			name:         "requeued without retries",
+			h:            func(_ context.Context, m *delivery.Message) { m.Nack(true) },
+			wantAttempts: 1,
+			wantOutcome:  "requeue",
+		},
+		{
+			name:         "rejected without retries",
+			h:            func(_ context.Context, m *delivery.Message) { m.Nack(false) },
+			wantAttempts: 1,
+			wantOutcome:  "ack",
+			wantDead:     true,
+		},
+		{
+			name:         "retried after a panic",
+			h:            func(context.Context, *delivery.Message) { panic("boom") },
+			wantAttempts: 2,
+			wantOutcome:  "ack",
+			wantDead:     true,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			broker := &fakeBroker{}
+			b := newTestBus(broker, Config{DeadLetter: DeadLetterConfig{
+				Topic:          "dead",
+				Attempts:       2,
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			}})
+			attempts := 0
+			h := delivery.Handler(func(ctx context.Context, m *delivery.Message) {
+				attempts++
+				if m.Attempt != attempts || m.Topic != "venues.created" {
+					t.Errorf("got attempt %d of %s, want attempt %d of venues.created", m.Attempt, m.Topic, attempts)
+				}
+				tt.h(ctx, m)
+			})
+			a := &fakeAcker{}
+			if err := b.handle(context.Background(), "venues.created", h, amqp.Delivery{Acknowledger: a}); err != nil {
+				t.Fatalf("handle: %v", err)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if got := a.outcome(); got != tt.wantOutcome {
+				t.Errorf("got outcome %q, want %q", got, tt.wantOutcome)
+			}
+			if got := len(broker.published()) == 1; got != tt.wantDead {
+				t.Errorf("got dead-lettered %v, want %v", got, tt.wantDead)
+			}
+		})
+	}
+}
+
+// fakeAcker is an [amqp.Acknowledger] recording how a delivery is settled.
+type fakeAcker struct {
+	mu       sync.Mutex
+	outcomes []string
+}
+
+// outcome returns the settlement of the delivery, "ack", "requeue" or
+// "reject", or all of them, separated by commas, if it was settled more than
+// once.
+func (a *fakeAcker) outcome() string {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return strings.Join(a.outcomes, ",")
+}
+
+func (a *fakeAcker) settle(outcome string) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.outcomes = append(a.outcomes, outcome)
+	return nil
+}
+
+func (a *fakeAcker) Ack(uint64, bool) error { return a.settle("ack") }
+
+func (a *fakeAcker) Nack(_ uint64, _, requeue bool) error {
+	if requeue {
+		return a.settle("requeue")
+	}
+	return a.settle("reject")
+}
+
+func (a *fakeAcker) Reject(_ uint64, requeue bool) error { return a.Nack(0, false, requeue) }
@@ -0,0 +1,151 @@
+package rabbitmq
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// publishChannel is the part of an [amqp.Channel] used by the publishers.
+type publishChannel interface {
+	PublishWithDeferredConfirmWithContext(
+		ctx context.Context,
+		exchange, key string,
+		mandatory, immediate bool,
+		msg amqp.Publishing,
+	) (*amqp.DeferredConfirmation, error)
+	Confirm(noWait bool) error
+	IsClosed() bool
+	Close() error
+}
+
+// channelPool lends the channels of a connection to concurrent publishers.
+// The channels are opened on demand, up to the size of the pool, and kept
+// open while they are healthy.
+type channelPool struct {
+	channel func() (publishChannel, error) // opens a channel
+	confirm bool
+	slots   chan struct{}       // one per lent channel
+	idle    chan publishChannel // the returned open channels
+}
+
+// newChannelPool creates a new [channelPool] of the given size over the
+// connection. The channels are put in confirm mode if confirm is set.
+func newChannelPool(conn *amqp.Connection, size int, confirm bool) *channelPool {
+	return newPool(func() (publishChannel, error) {
+		ch, err := conn.Channel()
+		if err != nil {
+			return nil, err //nolint:wrapcheck // wrapped by open
+		}
+		return ch, nil
+	}, size, confirm)
+}
+
+// newPool creates a new [channelPool] of the given size, whose channels are
+// opened with the given function.
+func newPool(channel func() (publishChannel, error), size int, confirm bool) *channelPool {
+	size = max(size, 1)
+	return &channelPool{
+		channel: channel,
+		confirm: confirm,
+		slots:   make(chan struct{}, size),
+		idle:    make(chan publishChannel, size),
+	}
+}
+
+// get lends a channel, waiting for one to be returned if all channels are
+// lent. The channel must be returned with [channelPool.put]. This function
+// returns [service.ErrTimeOut] in case ctx is done before a channel is free,
+// and [service.ErrConnectionClosed] in case no channel can be opened.
+func (p *channelPool) get(ctx context.Context) (publishChannel, error) {
+	start := time.Now()
+	select {
+	case p.slots <- struct{}{}:
+	case <-ctx.Done():
+		return nil, fmt.Errorf("%w: wait for a publishing channel: %v", service.ErrTimeOut, ctx.Err())
+	}
+	channelWait.ObserveSince(start)
+	channelsInUse.Inc()
+
+	for {
+		select {
+		case ch := <-p.idle:
+			if !ch.IsClosed() {
+				return ch, nil
+			}
+		default:
+			return p.open()
+		}
+	}
+}
+
+// open opens a channel for a taken slot, releasing the slot in case the
+// channel cannot be opened.
+func (p *channelPool) open() (publishChannel, error) {
+	ch, err := p.channel()
+	if err == nil && p.confirm {
+		if err = ch.Confirm(false); err != nil {
+			ch.Close() //nolint:errcheck,gosec // intentional
+		}
+	}
+	if err != nil {
+		p.put(nil, false)
+		return nil, fmt.Errorf("%w: open publishing channel: %v", service.ErrConnectionClosed, err)
+	}
+	channelsOpened.Inc()
+	return ch, nil
+}
+
+// put returns a lent channel. Unhealthy channels, e.g. ones that failed to
+// publish, are closed instead of being reused.
+func (p *channelPool) put(ch publishChannel, healthy bool) {
+	if ch != nil {
+		if !healthy || ch.IsClosed() {
+			ch.Close() //nolint:errcheck,gosec // best effort
+		} else {
+			p.idle <- ch // never blocks, at most size channels are lent
+		}
+	}
+	<-p.slots
+	channelsInUse.Dec()
+}
+
+// close closes the idle channels. Lent channels are closed with their
+// connection.
+func (p *channelPool) close() {
+	for {
+		select {
+		case ch := <-p.idle:
+			ch.Close() //nolint:errcheck,gosec // best effort
+		default:
+			return
+		}
+	}
+}
+
+var (
+	// channelsInUse is the number of lent publishing channels.
+	channelsInUse = metrics.NewGauge(
+		"rabbitmq_publish_channels_in_use",
+		"Number of publishing channels in use.",
+	)
+
+	// channelsOpened counts the opened publishing channels, which
+	// grows beyond the size of the pool if channels fail.
+	channelsOpened = metrics.NewCounter(
+		"rabbitmq_publish_channels_opened_total",
+		"Number of opened publishing channels.",
+	)
+
+	// channelWait observes the time publishers wait for a channel.
+	channelWait = metrics.NewHistogram(
+		"rabbitmq_publish_channel_wait_seconds",
+		"Time publishers waited for a free publishing channel.",
+		[]float64{.0001, .001, .01, .1, 1},
+	)
+)
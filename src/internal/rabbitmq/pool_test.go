@@ -0,0 +1,273 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestChannelPoolGet(t *testing.T) {
+	tests := []struct {
+		name string
+		// reuse returns the lent channel to the pool.
+		reuse      func(p *channelPool, ch publishChannel)
+		wantReused bool
+	}{
+		{
+			name:       "reuses a healthy channel",
+			reuse:      func(p *channelPool, ch publishChannel) { p.put(ch, true) },
+			wantReused: true,
+		},
+		{
+			name:  "closes an unhealthy channel",
+			reuse: func(p *channelPool, ch publishChannel) { p.put(ch, false) },
+		},
+		{
+			name: "drops a channel closed while lent",
+			reuse: func(p *channelPool, ch publishChannel) {
+				ch.Close() //nolint:errcheck // fake
+				p.put(ch, true)
+			},
+		},
+		{
+			name: "drops a channel closed while idle",
+			reuse: func(p *channelPool, ch publishChannel) {
+				p.put(ch, true)
+				ch.Close() //nolint:errcheck // fake
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := &fakeBroker{}
+			p := newPool(b.channel, 1, false)
+			first, err := p.get(context.Background())
+			if err != nil {
+				t.Fatalf("get: %v", err)
+			}
+			tt.reuse(p, first)
+			second, err := p.get(context.Background())
+			if err != nil {
+				t.Fatalf("get again: %v", err)
+			}
+			if got := second == first; got != tt.wantReused {
+				t.Errorf("got reused %v, want %v", got, tt.wantReused)
+			}
+			if got := first.IsClosed(); got == tt.wantReused {
+				t.Errorf("got first channel closed %v, want %v", got, !tt.wantReused)
+			}
+		})
+	}
+}
+
+func TestChannelPoolOpen(t *testing.T) {
+	tests := []struct {
+		name        string
+		confirm     bool
+		openErr     error
+		confirmErr  error
+		wantErr     error
+		wantConfirm bool
+	}{
+		{"without confirms", false, nil, nil, nil, false},
+		{"with confirms", true, nil, nil, nil, true},
+		{"open fails", false, amqp.ErrClosed, nil, service.ErrConnectionClosed, false},
+		{"confirm fails", true, nil, amqp.ErrClosed, service.ErrConnectionClosed, true},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := &fakeBroker{openErr: tt.openErr, confirmErr: tt.confirmErr}
+			p := newPool(b.channel, 1, tt.confirm)
+			ch, err := p.get(context.Background())
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if got := len(b.opened()) == 1 && b.opened()[0].confirmed.Load(); got != tt.wantConfirm {
+				t.Errorf("got confirm mode %v, want %v", got, tt.wantConfirm)
+			}
+			if err != nil {
+				if tt.confirmErr != nil && !b.opened()[0].IsClosed() {
+					t.Error("got the channel failing to confirm open")
+				}
+				// The slot of the failed channel is released.
+				b.fail(nil, nil)
+				if ch, err = p.get(context.Background()); err != nil {
+					t.Fatalf("got error %v after a failed open, want nil", err)
+				}
+			}
+			p.put(ch, true)
+		})
+	}
+}
+
+func TestChannelPoolWait(t *testing.T) {
+	b := &fakeBroker{}
+	p := newPool(b.channel, 1, false)
+	lent, err := p.get(context.Background())
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if _, err := p.get(ctx); !errors.Is(err, service.ErrTimeOut) {
+		t.Errorf("got error %v while all channels are lent, want %v", err, service.ErrTimeOut)
+	}
+
+	got := make(chan publishChannel, 1)
+	go func() {
+		ch, err := p.get(context.Background())
+		if err != nil {
+			t.Errorf("get: %v", err)
+		}
+		got <- ch
+	}()
+	p.put(lent, true)
+	if ch := <-got; ch != lent {
+		t.Errorf("got channel %p for the waiting publisher, want the returned %p", ch, lent)
+	}
+}
+
+func TestChannelPoolConcurrent(t *testing.T) {
+	const (
+		size           = 3
+		unhealthyEvery = 7
+	)
+	b := &fakeBroker{}
+	p := newPool(b.channel, size, false)
+	var (
+		wg            sync.WaitGroup
+		lent, maxLent atomic.Int32
+	)
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ch, err := p.get(context.Background())
+			if err != nil {
+				t.Errorf("get: %v", err)
+				return
+			}
+			n := lent.Add(1)
+			for {
+				m := maxLent.Load()
+				if n <= m || maxLent.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(time.Millisecond)
+			lent.Add(-1)
+			p.put(ch, i%unhealthyEvery != 0)
+		}(i)
+	}
+	wg.Wait()
+	if got := maxLent.Load(); got > size {
+		t.Errorf("got %d channels lent at once, want at most %d", got, size)
+	}
+	open := 0
+	for _, ch := range b.opened() {
+		if !ch.IsClosed() {
+			open++
+		}
+	}
+	if open > size {
+		t.Errorf("got %d open channels, want at most %d", open, size)
+	}
+	p.close()
+	for _, ch := range b.opened() {
+		if !ch.IsClosed() {
+			t.Errorf("got channel %p open after closing the pool", ch)
+		}
+	}
+}
+
+// fakeBroker opens fake channels, see [newPool].
+type fakeBroker struct {
+	mu         sync.Mutex
+	channels   []*fakeChannel
+	openErr    error
+	confirmErr error
+	publishErr error
+}
+
+// channel opens a channel, or fails with the configured error.
+func (b *fakeBroker) channel() (publishChannel, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.openErr != nil {
+		return nil, b.openErr
+	}
+	ch := &fakeChannel{broker: b, confirmErr: b.confirmErr}
+	b.channels = append(b.channels, ch)
+	return ch, nil
+}
+
+// fail sets the errors of opening the channels and of publishing.
+func (b *fakeBroker) fail(openErr, publishErr error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.openErr, b.confirmErr, b.publishErr = openErr, nil, publishErr
+}
+
+// opened returns the channels opened so far.
+func (b *fakeBroker) opened() []*fakeChannel {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return append([]*fakeChannel(nil), b.channels...)
+}
+
+// published returns the messages published so far.
+func (b *fakeBroker) published() []published {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	var msgs []published
+	for _, ch := range b.channels {
+		msgs = append(msgs, ch.published...)
+	}
+	return msgs
+}
+
+// fakeChannel is a [publishChannel] recording the published messages.
+type fakeChannel struct {
+	broker     *fakeBroker
+	confirmErr error
+	confirmed  atomic.Bool
+	closed     atomic.Bool
+	published  []published // guarded by broker.mu
+}
+
+// published is a message published over a [fakeChannel].
+type published struct {
+	exchange, key string
+	msg           amqp.Publishing
+}
+
+func (ch *fakeChannel) PublishWithDeferredConfirmWithContext(_ context.Context, exchange, key string, _, _ bool, msg amqp.Publishing) (*amqp.DeferredConfirmation, error) {
+	ch.broker.mu.Lock()
+	defer ch.broker.mu.Unlock()
+	if ch.broker.publishErr != nil {
+		return nil, ch.broker.publishErr
+	}
+	ch.published = append(ch.published, published{exchange: exchange, key: key, msg: msg})
+	return nil, nil
+}
+
+func (ch *fakeChannel) Confirm(bool) error {
+	ch.confirmed.Store(true)
+	return ch.confirmErr
+}
+
+func (ch *fakeChannel) IsClosed() bool { return ch.closed.Load() }
+
+func (ch *fakeChannel) Close() error {
+	ch.closed.Store(true)
+	return nil
+}
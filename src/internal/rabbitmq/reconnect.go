@@ -0,0 +1,197 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	amqp "github.com/rabbitmq/amqp091-go"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/resilience"
+)
+
+// ReconnectConfig encapsulates the configuration of the reconnects of the bus
+// once its connection to the broker is lost, e.g. when the broker restarts.
+// The bus reconnects until it is closed, and the subscriptions are set up
+// again over the new connection, thus they do not fail the service.
+type ReconnectConfig struct {
+	// InitialBackoff is the delay before the first attempt to
+	// reconnect. Every following attempt doubles the delay, up to
+	// MaxBackoff.
+	InitialBackoff time.Duration `env:"MESSAGE_BUS_RECONNECT_INITIAL_BACKOFF" envDefault:"500ms"`
+	MaxBackoff     time.Duration `env:"MESSAGE_BUS_RECONNECT_MAX_BACKOFF" envDefault:"30s"`
+}
+
+// brokerConnection is the part of an [amqp.Connection] used by the bus.
+type brokerConnection interface {
+	Channel() (*amqp.Channel, error)
+	IsClosed() bool
+	Close() error
+}
+
+// connection is a connection of the bus to the broker, replaced once it is
+// lost, see [Bus.supervise].
+type connection struct {
+	pub  brokerConnection
+	sub  brokerConnection // pub, unless [Config.SeparateConnections]
+	pool *channelPool
+
+	lost     chan struct{} // closed once pub or sub is closed
+	replaced chan struct{} // closed once replaced, or the bus is closed
+}
+
+// connect opens the connections to the broker, and declares the exchange and
+// the dead-letter queue over them. This function returns
+// [service.ErrConnectionClosed] in case the broker cannot be reached.
+func (b *Bus) connect(ctx context.Context) (*connection, error) {
+	pub, err := dial(ctx, b.cfg.URL, "publish")
+	if err != nil {
+		return nil, err
+	}
+	sub := pub
+	if b.cfg.SeparateConnections {
+		if sub, err = dial(ctx, b.cfg.URL, "consume"); err != nil {
+			pub.Close() //nolint:errcheck,gosec // intentional
+			return nil, err
+		}
+	}
+	c := &connection{
+		pub:      pub,
+		sub:      sub,
+		pool:     newChannelPool(pub, b.cfg.PublishChannels, b.cfg.PublishConfirms),
+		lost:     make(chan struct{}),
+		replaced: make(chan struct{}),
+	}
+	var once sync.Once
+	for _, conn := range []*amqp.Connection{pub, sub} {
+		closed := conn.NotifyClose(make(chan *amqp.Error, 1))
+		go func() {
+			<-closed
+			once.Do(func() { close(c.lost) })
+		}()
+	}
+
+	if err := b.declareExchange(c); err != nil {
+		c.close() //nolint:errcheck,gosec // intentional
+		return nil, err
+	}
+	if err := b.declareDeadLetterQueue(c); err != nil {
+		c.close() //nolint:errcheck,gosec // intentional
+		return nil, err
+	}
+	return c, nil
+}
+
+// close closes the channels and the connections.
+func (c *connection) close() error {
+	c.pool.close()
+	err := c.pub.Close()
+	if c.sub != c.pub {
+		err = errors.Join(err, c.sub.Close())
+	}
+	if errors.Is(err, amqp.ErrClosed) {
+		return nil
+	}
+	return err //nolint:wrapcheck // wrapped by the callers
+}
+
+// isLost reports whether the connection is lost. The connections are marked
+// closed before their channels, thus a subscription ended by a lost
+// connection sees it lost.
+func (c *connection) isLost() bool { return c.pub.IsClosed() || c.sub.IsClosed() }
+
+// current returns the current connection of the bus.
+func (b *Bus) current() *connection {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.conn
+}
+
+// supervise replaces the connection of the bus once it is lost with one opened
+// by connect, see [Bus.connect], until the bus is closed. The new connection
+// is retried with a growing backoff, see [ReconnectConfig].
+func (b *Bus) supervise(connect func(ctx context.Context) (*connection, error)) {
+	for {
+		c := b.current()
+		select {
+		case <-b.ctx.Done():
+			return
+		case <-c.lost:
+		}
+		if b.ctx.Err() != nil { // lost on Close
+			return
+		}
+		slog.Warn("connection to the message bus lost, reconnecting")
+		c.close() //nolint:errcheck,gosec // the other connection, if any
+
+		var next *connection
+		err := resilience.Retry(b.ctx, resilience.Policy{
+			InitialBackoff: b.cfg.Reconnect.InitialBackoff,
+			MaxBackoff:     max(b.cfg.Reconnect.MaxBackoff, b.cfg.Reconnect.InitialBackoff),
+			Retryable:      func(error) bool { return true },
+		}, func(ctx context.Context) error {
+			var err error
+			next, err = connect(ctx)
+			return err
+		})
+		if err != nil { // the bus is closed
+			return
+		}
+
+		b.mu.Lock()
+		if b.closed { // closed while reconnecting
+			b.mu.Unlock()
+			next.close() //nolint:errcheck,gosec // intentional
+			return
+		}
+		b.conn = next
+		b.mu.Unlock()
+		close(c.replaced)
+		reconnects.Inc()
+		slog.Info("reconnected to the message bus")
+	}
+}
+
+// resubscribe runs the subscription over the current connection, and again
+// over the next one whenever the connection is lost, until ctx is done. This
+// function returns the errors of the subscription that are not caused by a
+// lost connection, and [service.ErrConnectionClosed] in case the bus is
+// closed.
+func (b *Bus) resubscribe(ctx context.Context, topic string, run func(c *connection) error) error {
+	for {
+		c := b.current()
+		err := run(c)
+		if err == nil || ctx.Err() != nil {
+			return err
+		}
+		if !errors.Is(err, service.ErrConnectionClosed) || !c.isLost() || b.isClosed() {
+			return err
+		}
+		slog.Warn("subscription lost, resubscribing once reconnected",
+			slog.String("topic", topic),
+			slog.String("error", err.Error()),
+		)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-c.replaced: // by the next connection, or closed with the bus
+		}
+	}
+}
+
+// isClosed reports whether the bus is closed.
+func (b *Bus) isClosed() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.closed
+}
+
+// reconnects counts the reconnects to the broker.
+var reconnects = metrics.NewCounter(
+	"rabbitmq_reconnects_total",
+	"Number of reconnects to the message bus after the connection was lost.",
+)
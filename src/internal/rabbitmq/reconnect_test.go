@@ -0,0 +1,277 @@
+package rabbitmq
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	amqp "github.com/rabbitmq/amqp091-go"
+)
+
+func TestBusResubscribe(t *testing.T) {
+	tests := []struct {
+		name string
+		// failures is the number of failing reconnects.
+		failures int
+		// block blocks the reconnects until the bus is closed.
+		block bool
+		// run subscribes over the connection, on the nth attempt.
+		run      func(b *Bus, c *connection, n int) error
+		wantErr  error
+		wantRuns int // zero is unchecked
+	}{
+		{
+			name: "returns the errors of the subscription",
+			run: func(*Bus, *connection, int) error {
+				return service.ErrBadRequest
+			},
+			wantErr:  service.ErrBadRequest,
+			wantRuns: 1,
+		},
+		{
+			name: "returns a subscription closed over a live connection",
+			run: func(*Bus, *connection, int) error {
+				return service.ErrConnectionClosed // e.g. the queue was deleted
+			},
+			wantErr:  service.ErrConnectionClosed,
+			wantRuns: 1,
+		},
+		{
+			name: "resubscribes once reconnected",
+			run: func(_ *Bus, c *connection, n int) error {
+				if n == 1 {
+					lose(c)
+					return service.ErrConnectionClosed
+				}
+				return nil
+			},
+			wantRuns: 2,
+		},
+		{
+			name:     "resubscribes after failed reconnects",
+			failures: 3,
+			run: func(_ *Bus, c *connection, n int) error {
+				if n < 3 {
+					lose(c)
+					return service.ErrConnectionClosed
+				}
+				return nil
+			},
+			wantRuns: 3,
+		},
+		{
+			name: "ends once the bus is closed",
+			run: func(b *Bus, c *connection, _ int) error {
+				lose(c)
+				b.Close() //nolint:errcheck // fake connections
+				return service.ErrConnectionClosed
+			},
+			wantErr:  service.ErrConnectionClosed,
+			wantRuns: 1,
+		},
+		{
+			name:  "ends once the bus is closed while reconnecting",
+			block: true,
+			run: func(b *Bus, c *connection, n int) error {
+				if n == 1 {
+					lose(c)
+					go b.Close() //nolint:errcheck // fake connections
+				}
+				return service.ErrConnectionClosed
+			},
+			wantErr: service.ErrConnectionClosed,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			b := newTestBus(&fakeBroker{}, Config{Reconnect: ReconnectConfig{
+				InitialBackoff: time.Millisecond,
+				MaxBackoff:     time.Millisecond,
+			}})
+			defer b.Close() //nolint:errcheck // fake connections
+			var attempts atomic.Int32
+			go b.supervise(func(ctx context.Context) (*connection, error) {
+				if tt.block {
+					<-ctx.Done()
+					return nil, ctx.Err()
+				}
+				if attempts.Add(1) <= int32(tt.failures) {
+					return nil, service.ErrConnectionClosed
+				}
+				return newTestConnection(&fakeBroker{}), nil
+			})
+
+			var (
+				runs int
+				prev *connection
+			)
+			err := b.resubscribe(context.Background(), "venues.created", func(c *connection) error {
+				runs++
+				if prev != nil && !tt.block {
+					if c == prev {
+						t.Errorf("got run %d over the lost connection", runs)
+					}
+					if !prev.pub.IsClosed() || !prev.sub.IsClosed() {
+						t.Errorf("got the lost connection open on run %d", runs)
+					}
+				}
+				prev = c
+				return tt.run(b, c, runs)
+			})
+			if !errors.Is(err, tt.wantErr) || (tt.wantErr == nil && err != nil) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantRuns != 0 && runs != tt.wantRuns {
+				t.Errorf("got %d runs, want %d", runs, tt.wantRuns)
+			}
+		})
+	}
+}
+
+func TestBusResubscribeCancelled(t *testing.T) {
+	b := newTestBus(&fakeBroker{}, Config{})
+	defer b.Close() //nolint:errcheck // fake connections
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- b.resubscribe(ctx, "venues.created", func(c *connection) error {
+			lose(c) // the bus does not reconnect
+			return service.ErrConnectionClosed
+		})
+	}()
+	cancel()
+	if err := <-done; err != nil && !errors.Is(err, service.ErrConnectionClosed) {
+		t.Errorf("got error %v, want nil or %v", err, service.ErrConnectionClosed)
+	}
+}
+
+func TestBusReconnectConcurrent(t *testing.T) {
+	broker := &fakeBroker{}
+	b := newTestBus(broker, Config{Exchange: "events", Reconnect: ReconnectConfig{
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     time.Millisecond,
+	}})
+	go b.supervise(func(context.Context) (*connection, error) {
+		return newTestConnection(broker), nil
+	})
+
+	// Subscriptions resubscribe while the connection is lost repeatedly,
+	// and publishers publish over whichever connection is current.
+	const (
+		subscriptions = 5
+		losses        = 5
+	)
+	ctx, cancel := context.WithCancel(context.Background())
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		runs = make(map[*connection]int) // the subscriptions by connection
+	)
+	for i := 0; i < subscriptions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := b.resubscribe(ctx, "venues.created", func(c *connection) error {
+				mu.Lock()
+				runs[c]++
+				mu.Unlock()
+				select {
+				case <-ctx.Done():
+					return nil
+				case <-c.sub.(*fakeConnection).closed:
+					return service.ErrConnectionClosed
+				}
+			})
+			if err != nil {
+				t.Errorf("resubscribe: %v", err)
+			}
+		}()
+	}
+	for i := 0; i < subscriptions; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for ctx.Err() == nil {
+				b.Publish(ctx, "venues.created", []byte("body")) //nolint:errcheck // may race the loss
+				time.Sleep(time.Millisecond)
+			}
+		}()
+	}
+
+	// subscribed waits until every subscription runs over the connection.
+	subscribed := func(c *connection) {
+		deadline := time.Now().Add(5 * time.Second)
+		for {
+			mu.Lock()
+			n := runs[c]
+			mu.Unlock()
+			if n == subscriptions {
+				return
+			}
+			if time.Now().After(deadline) {
+				t.Fatalf("got %d of %d subscriptions over the connection", n, subscriptions)
+			}
+			time.Sleep(time.Millisecond)
+		}
+	}
+	for i := 0; i < losses; i++ {
+		c := b.current()
+		subscribed(c)
+		lose(c)
+		select {
+		case <-c.replaced:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("got no reconnect after loss %d", i)
+		}
+	}
+	subscribed(b.current())
+	cancel()
+	wg.Wait()
+	if err := b.Close(); err != nil {
+		t.Errorf("close: %v", err)
+	}
+	if !b.current().pub.IsClosed() {
+		t.Error("got the connection open after closing the bus")
+	}
+}
+
+// lose loses the connection like the broker dropping it.
+func lose(c *connection) {
+	c.sub.Close() //nolint:errcheck // fake connection
+	select {
+	case <-c.lost:
+	default:
+		close(c.lost)
+	}
+}
+
+// fakeConnection is a [brokerConnection] without channels.
+type fakeConnection struct {
+	once   sync.Once
+	closed chan struct{}
+}
+
+func newFakeConnection() *fakeConnection {
+	return &fakeConnection{closed: make(chan struct{})}
+}
+
+func (c *fakeConnection) Channel() (*amqp.Channel, error) { return nil, amqp.ErrClosed }
+
+func (c *fakeConnection) IsClosed() bool {
+	select {
+	case <-c.closed:
+		return true
+	default:
+		return false
+	}
+}
+
+func (c *fakeConnection) Close() error {
+	c.once.Do(func() { close(c.closed) })
+	return nil
+}
@@ -0,0 +1,170 @@
+// Package reqctx carries the metadata of a request in its context: the request
+// id, the authenticated principal, the tenant, the locale and the client
+// address.
+//
+// The middleware and the interceptors of the service put the metadata into
+// the context, e.g. [auth.Middleware] the principal and [tenant.Middleware]
+// the tenant, and the handlers read it with the typed getters of this package,
+// instead of each package defining its own context keys:
+//
+//	if p, ok := reqctx.PrincipalFrom(ctx); ok && p.HasRole("admin") {
+//		// ...
+//	}
+//
+// The package depends on nothing but the standard library, thus every other
+// package of the service may use it. Values specific to a package, e.g. the
+// localizer of i18n, use a [Key] of their own.
+//
+// [auth.Middleware]: github.com/eventscompass/service-template/src/internal/auth.Middleware
+// [tenant.Middleware]: github.com/eventscompass/service-template/src/internal/tenant.Middleware
+package reqctx
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"slices"
+)
+
+// Key is a typed context key. Every call of [NewKey] returns a distinct key,
+// even for the same name and type.
+type Key[T any] struct {
+	k *key
+}
+
+// NewKey creates a new key of values of type T. The name is used in debug
+// output only.
+func NewKey[T any](name string) Key[T] {
+	return Key[T]{k: &key{name: name}}
+}
+
+// With returns a copy of ctx carrying v.
+func (k Key[T]) With(ctx context.Context, v T) context.Context {
+	return context.WithValue(ctx, k.k, v)
+}
+
+// From returns the value carried by ctx. Returns false if ctx carries none.
+func (k Key[T]) From(ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(k.k).(T)
+	return v, ok
+}
+
+// Principal is the authenticated caller of a request, see the auth package.
+type Principal struct {
+	// Subject uniquely identifies the caller within the issuer.
+	Subject string
+
+	// Issuer is the party that issued the credentials.
+	Issuer string
+
+	// Roles are the roles assigned to the caller.
+	Roles []string
+
+	// Scopes are the permissions granted to the caller.
+	Scopes []string
+
+	// Claims are all the claims of the credentials.
+	Claims map[string]any
+}
+
+// HasScope reports whether the principal was granted the given scope.
+func (p *Principal) HasScope(scope string) bool { return slices.Contains(p.Scopes, scope) }
+
+// HasRole reports whether the principal was assigned the given role.
+func (p *Principal) HasRole(role string) bool { return slices.Contains(p.Roles, role) }
+
+// WithRequestID returns a copy of ctx carrying the id of the request.
+func WithRequestID(ctx context.Context, id string) context.Context {
+	return requestIDKey.With(ctx, id)
+}
+
+// RequestIDFrom returns the id of the request carried by ctx. Returns false
+// if the request has no id.
+func RequestIDFrom(ctx context.Context) (string, bool) {
+	id, ok := requestIDKey.From(ctx)
+	return id, ok && id != ""
+}
+
+// WithPrincipal returns a copy of ctx carrying the principal.
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return principalKey.With(ctx, p)
+}
+
+// PrincipalFrom returns the principal carried by ctx. Returns false if the
+// request was not authenticated.
+func PrincipalFrom(ctx context.Context) (*Principal, bool) {
+	p, ok := principalKey.From(ctx)
+	return p, ok && p != nil
+}
+
+// WithTenant returns a copy of ctx carrying the tenant.
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return tenantKey.With(ctx, tenant)
+}
+
+// TenantFrom returns the tenant carried by ctx. Returns false if the request
+// has no tenant.
+func TenantFrom(ctx context.Context) (string, bool) {
+	t, ok := tenantKey.From(ctx)
+	return t, ok && t != ""
+}
+
+// WithLocale returns a copy of ctx carrying the locale, e.g. "de".
+func WithLocale(ctx context.Context, locale string) context.Context {
+	return localeKey.With(ctx, locale)
+}
+
+// LocaleFrom returns the locale carried by ctx. Returns false if the request
+// was not localized.
+func LocaleFrom(ctx context.Context) (string, bool) {
+	l, ok := localeKey.From(ctx)
+	return l, ok && l != ""
+}
+
+// WithClientIP returns a copy of ctx carrying the address of the client.
+func WithClientIP(ctx context.Context, addr netip.Addr) context.Context {
+	return clientIPKey.With(ctx, addr)
+}
+
+// ClientIPFrom returns the address of the client carried by ctx. Returns false
+// if the address was not resolved.
+func ClientIPFrom(ctx context.Context) (netip.Addr, bool) {
+	addr, ok := clientIPKey.From(ctx)
+	return addr, ok && addr.IsValid()
+}
+
+// Attrs returns the metadata carried by ctx as log attributes, e.g. for the
+// access log. Missing metadata is left out.
+func Attrs(ctx context.Context) []slog.Attr {
+	var attrs []slog.Attr
+	if id, ok := RequestIDFrom(ctx); ok {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	if p, ok := PrincipalFrom(ctx); ok {
+		attrs = append(attrs, slog.String("subject", p.Subject))
+	}
+	if t, ok := TenantFrom(ctx); ok {
+		attrs = append(attrs, slog.String("tenant", t))
+	}
+	if l, ok := LocaleFrom(ctx); ok {
+		attrs = append(attrs, slog.String("locale", l))
+	}
+	if addr, ok := ClientIPFrom(ctx); ok {
+		attrs = append(attrs, slog.String("client_ip", addr.String()))
+	}
+	return attrs
+}
+
+// key is the context key behind a [Key].
+type key struct{ name string }
+
+func (k *key) String() string { return "reqctx." + k.name }
+
+// The keys of the metadata of a request.
+var (
+	requestIDKey = NewKey[string]("request_id")
+	principalKey = NewKey[*Principal]("principal")
+	tenantKey    = NewKey[string]("tenant")
+	localeKey    = NewKey[string]("locale")
+	clientIPKey  = NewKey[netip.Addr]("client_ip")
+)
@@ -0,0 +1,131 @@
+// Package requestid identifies the requests of the rest api, so that
+// everything a request caused can be found by a single id: its log records,
+// its response, and the messages it published.
+//
+// [Middleware] takes the id from the X-Request-ID header set by the client or
+// by a proxy in front of the service, or generates a uuid if there is none,
+// and puts it into the request context, see [reqctx.RequestIDFrom]. The id is
+// returned in the X-Request-ID header of the response, and the messages
+// published while handling the request carry it as their correlation id, see
+// [delivery.HeaderCorrelationID]. The records of the loggers wrapped with
+// [LogHandler] get the id of the request they are logged for:
+//
+//	slog.InfoContext(ctx, "venue created") // ... request_id=...
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/delivery"
+	"github.com/eventscompass/service-template/src/internal/logs"
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+const (
+	// Header is the header carrying the id of a request, both in
+	// the request and in the response.
+	Header = "X-Request-ID"
+
+	// MaxLength is the maximum length of the request ids given by
+	// the clients.
+	MaxLength = 128
+)
+
+// Middleware is an http middleware identifying the requests, see the package
+// documentation. The id given by the client is kept if it is valid, see
+// [Valid], and replaced with a new one otherwise.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !Valid(id) {
+			var err error
+			if id, err = New(); err != nil {
+				service.HTTPError(r.Context(), w, err)
+				return
+			}
+		}
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
+
+// NewContext returns a copy of ctx carrying the id of the request, see
+// [reqctx.WithRequestID]. The messages published with the returned context
+// carry the id as their correlation id.
+func NewContext(ctx context.Context, id string) context.Context {
+	ctx = reqctx.WithRequestID(ctx, id)
+	return delivery.WithMetadata(ctx, delivery.Metadata{
+		Headers: map[string]string{delivery.HeaderCorrelationID: id},
+	})
+}
+
+// New generates a new request id, a random (version 4) uuid. This function
+// returns [service.ErrUnexpected] in case the random source fails.
+func New() (string, error) {
+	b := make([]byte, 16) //nolint:gomnd // 128 bits
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w: generate request id: %v", service.ErrUnexpected, err)
+	}
+	b[6] = b[6]&0x0f | 0x40 // version 4
+	b[8] = b[8]&0x3f | 0x80 // variant 10
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:]), nil
+}
+
+// Valid reports whether id can be used as a request id: it is not empty, it
+// is at most [MaxLength] bytes long, and it consists of printable ascii
+// characters other than space, thus it cannot forge log lines or headers.
+func Valid(id string) bool {
+	if id == "" || len(id) > MaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// LogHandler wraps the log handler, adding the id of the request to the
+// records logged with a context carrying one, e.g. with [slog.InfoContext].
+func LogHandler(h slog.Handler) slog.Handler { return &logHandler{Handler: h} }
+
+// EnrichLogs wraps the handler of the default logger with [LogHandler], unless
+// it is wrapped already. It is usually called on Init, before the servers are
+// started.
+func EnrichLogs() {
+	if _, ok := slog.Default().Handler().(*logHandler); ok {
+		return
+	}
+	logs.Wrap(LogHandler)
+}
+
+// logHandler adds the id of the request to the records, see [LogHandler].
+type logHandler struct {
+	slog.Handler
+}
+
+// Handle implements the [slog.Handler] interface.
+func (h *logHandler) Handle(ctx context.Context, r slog.Record) error {
+	if id, ok := reqctx.RequestIDFrom(ctx); ok {
+		r = r.Clone()
+		r.AddAttrs(slog.String("request_id", id))
+	}
+	return h.Handler.Handle(ctx, r) //nolint:wrapcheck // the errors of the wrapped handler
+}
+
+// WithAttrs implements the [slog.Handler] interface.
+func (h *logHandler) WithAttrs(attrs []slog.Attr) slog.Handler {
+	return &logHandler{Handler: h.Handler.WithAttrs(attrs)}
+}
+
+// WithGroup implements the [slog.Handler] interface.
+func (h *logHandler) WithGroup(name string) slog.Handler {
+	return &logHandler{Handler: h.Handler.WithGroup(name)}
+}
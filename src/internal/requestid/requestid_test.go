@@ -0,0 +1,77 @@
+package requestid
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/eventscompass/service-template/src/internal/delivery"
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+func TestMiddleware(t *testing.T) {
+	tests := []struct {
+		name     string
+		header   string
+		wantSame bool
+	}{
+		{"kept", "req-1", true},
+		{"generated", "", false},
+		{"too long", strings.Repeat("a", MaxLength+1), false},
+		{"forged log line", "a\nlevel=ERROR", false},
+		{"space", "a b", false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var ctxID, correlation string
+			h := Middleware(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				ctxID, _ = reqctx.RequestIDFrom(r.Context())
+				correlation = delivery.MetadataFrom(r.Context()).Headers[delivery.HeaderCorrelationID]
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.header != "" {
+				req.Header.Set(Header, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			got := rec.Header().Get(Header)
+			if tt.wantSame && got != tt.header {
+				t.Errorf("got request id %q, want %q", got, tt.header)
+			}
+			if !tt.wantSame && !uuidRe.MatchString(got) {
+				t.Errorf("got request id %q, want a generated uuid", got)
+			}
+			if ctxID != got || correlation != got {
+				t.Errorf("got id %q in the context and %q as correlation id, want %q", ctxID, correlation, got)
+			}
+		})
+	}
+}
+
+func TestLogHandler(t *testing.T) {
+	var buf bytes.Buffer
+	log := slog.New(LogHandler(slog.NewTextHandler(&buf, nil))).With("k", "v")
+
+	log.InfoContext(context.Background(), "without")
+	log.InfoContext(reqctx.WithRequestID(context.Background(), "req-1"), "with")
+
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("got %d records, want 2", len(lines))
+	}
+	if strings.Contains(lines[0], "request_id") {
+		t.Errorf("got %q, want no request id", lines[0])
+	}
+	if !strings.Contains(lines[1], "request_id=req-1") || !strings.Contains(lines[1], "k=v") {
+		t.Errorf("got %q, want the request id and the attributes of the logger", lines[1])
+	}
+}
+
+var uuidRe = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
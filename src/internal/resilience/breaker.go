@@ -0,0 +1,268 @@
+// Package resilience protects the service from failing dependencies.
+//
+// A [Breaker] stops calling a dependency that keeps failing, so that requests
+// fail fast instead of piling up on timeouts and exhausting the workers of the
+// service. [Retry] retries operations that failed because of transient errors.
+// [WithFallback] serves degraded responses while a dependency is unavailable.
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// ErrOpen is returned by a [Breaker] that rejects a call because the
+// dependency is failing.
+var ErrOpen = errors.New("circuit breaker is open")
+
+// BreakerConfig encapsulates the configuration of a [Breaker]. The variables
+// are usually prefixed with the name of the dependency, see the client
+// package.
+type BreakerConfig struct {
+	// FailureRate is the rate of failed calls within the window
+	// that opens the breaker.
+	FailureRate float64 `env:"BREAKER_FAILURE_RATE" envDefault:"0.5"`
+
+	// MinCalls is the minimum number of calls within the window
+	// before the failure rate is considered.
+	MinCalls int `env:"BREAKER_MIN_CALLS" envDefault:"20"`
+
+	// Window is the duration over which the failures are counted.
+	Window time.Duration `env:"BREAKER_WINDOW" envDefault:"30s"`
+
+	// OpenTimeout is how long the breaker stays open before it
+	// lets probe calls through.
+	OpenTimeout time.Duration `env:"BREAKER_OPEN_TIMEOUT" envDefault:"30s"`
+
+	// ProbeCalls is the number of successful probe calls that
+	// close the breaker again.
+	ProbeCalls int `env:"BREAKER_PROBE_CALLS" envDefault:"5"`
+}
+
+// State is the state of a [Breaker].
+type State int
+
+const (
+	// StateClosed lets all calls through.
+	StateClosed State = iota
+
+	// StateHalfOpen lets a limited number of probe calls through.
+	StateHalfOpen
+
+	// StateOpen rejects all calls.
+	StateOpen
+)
+
+// String implements the [fmt.Stringer] interface.
+func (s State) String() string {
+	switch s {
+	case StateClosed:
+		return "closed"
+	case StateHalfOpen:
+		return "half_open"
+	case StateOpen:
+		return "open"
+	default:
+		return fmt.Sprintf("State(%d)", int(s))
+	}
+}
+
+// Breaker is a circuit breaker guarding the calls to a dependency.
+//
+// While closed, the breaker counts the outcomes of the calls within a sliding
+// window. Once the failure rate exceeds the threshold, the breaker opens and
+// rejects all calls with [ErrOpen]. After the open timeout the breaker becomes
+// half-open and lets a few probe calls through: if they all succeed the breaker
+// closes, otherwise it opens again.
+type Breaker struct {
+	name string
+	cfg  BreakerConfig
+
+	mu         sync.Mutex
+	state      State
+	generation uint64
+	buckets    [windowBuckets]bucket
+	openedAt   time.Time
+	probes     int // probe calls in flight or succeeded
+	succeeded  int
+	clock      clock.Clock
+}
+
+// NewBreaker creates a new closed [Breaker]. The name identifies the
+// dependency in logs and metrics.
+func NewBreaker(name string, cfg BreakerConfig) *Breaker {
+	state.Set(float64(StateClosed), name)
+	return &Breaker{name: name, cfg: cfg, clock: clock.Real}
+}
+
+// UseClock makes the breaker use the given clock for the window and the open
+// timeout, e.g. a fake clock in tests.
+func (b *Breaker) UseClock(c clock.Clock) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.clock = clock.Or(c)
+}
+
+// Do calls fn unless the breaker is open. The outcome of fn is recorded by
+// [IsFailure]. This function returns [ErrOpen] in case the call was rejected,
+// and the error of fn otherwise.
+func (b *Breaker) Do(ctx context.Context, fn func(context.Context) error) error {
+	done, err := b.Allow()
+	if err != nil {
+		return err
+	}
+	err = fn(ctx)
+	done(!IsFailure(err))
+	return err
+}
+
+// Allow reports whether a call may proceed. If so, the caller must report the
+// outcome of the call with done. This function returns [ErrOpen] in case the
+// call is rejected.
+func (b *Breaker) Allow() (done func(success bool), err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	now := b.clock.Now()
+	if b.state == StateOpen && now.Sub(b.openedAt) >= b.cfg.OpenTimeout {
+		b.transition(StateHalfOpen, now)
+	}
+	switch b.state {
+	case StateOpen:
+		rejected.Inc(b.name)
+		return nil, fmt.Errorf("%w: %s", ErrOpen, b.name)
+	case StateHalfOpen:
+		if b.probes >= b.cfg.ProbeCalls {
+			rejected.Inc(b.name)
+			return nil, fmt.Errorf("%w: %s is being probed", ErrOpen, b.name)
+		}
+		b.probes++
+	}
+
+	generation := b.generation
+	return func(success bool) { b.record(generation, success) }, nil
+}
+
+// State returns the current state of the breaker.
+func (b *Breaker) State() State {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == StateOpen && clock.Since(b.clock, b.openedAt) >= b.cfg.OpenTimeout {
+		return StateHalfOpen
+	}
+	return b.state
+}
+
+// IsFailure reports whether the outcome of a call counts as a failure of the
+// dependency. Cancellations by the caller are not failures of the dependency.
+func IsFailure(err error) bool {
+	return err != nil && !errors.Is(err, context.Canceled)
+}
+
+// record records the outcome of a call allowed in the given generation.
+// Outcomes of calls allowed before the last state transition are ignored.
+func (b *Breaker) record(generation uint64, success bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if generation != b.generation {
+		return
+	}
+
+	now := b.clock.Now()
+	switch b.state {
+	case StateClosed:
+		bk := b.bucket(now)
+		bk.calls++
+		if !success {
+			bk.failures++
+		}
+		var calls, failures int
+		for _, bk := range b.buckets {
+			if now.Sub(bk.start) < b.cfg.Window {
+				calls += bk.calls
+				failures += bk.failures
+			}
+		}
+		if calls >= b.cfg.MinCalls && float64(failures) >= b.cfg.FailureRate*float64(calls) {
+			b.transition(StateOpen, now)
+		}
+	case StateHalfOpen:
+		if !success {
+			b.transition(StateOpen, now)
+			return
+		}
+		b.succeeded++
+		if b.succeeded >= b.cfg.ProbeCalls {
+			b.transition(StateClosed, now)
+		}
+	}
+}
+
+// bucket returns the bucket of the window counting the calls at now.
+func (b *Breaker) bucket(now time.Time) *bucket {
+	width := max(b.cfg.Window/windowBuckets, time.Millisecond)
+	start := now.Truncate(width)
+	bk := &b.buckets[(start.UnixNano()/int64(width))%windowBuckets]
+	if !bk.start.Equal(start) {
+		*bk = bucket{start: start}
+	}
+	return bk
+}
+
+// transition moves the breaker to the given state.
+func (b *Breaker) transition(to State, now time.Time) {
+	slog.Warn("circuit breaker changed state",
+		slog.String("dependency", b.name),
+		slog.String("from", b.state.String()),
+		slog.String("to", to.String()),
+	)
+	b.state = to
+	b.generation++
+	b.buckets = [windowBuckets]bucket{}
+	b.probes, b.succeeded = 0, 0
+	if to == StateOpen {
+		b.openedAt = now
+	}
+	state.Set(float64(to), b.name)
+	transitions.Inc(b.name, to.String())
+}
+
+// bucket counts the calls within a part of the window.
+type bucket struct {
+	start    time.Time
+	calls    int
+	failures int
+}
+
+// windowBuckets is the number of parts of the sliding window.
+const windowBuckets = 10
+
+var (
+	// state exposes the state of the breakers, see [State].
+	state = metrics.NewGauge(
+		"circuit_breaker_state",
+		"State of the circuit breaker: 0 closed, 1 half-open, 2 open.",
+		"dependency",
+	)
+
+	// transitions counts the state transitions of the breakers.
+	transitions = metrics.NewCounter(
+		"circuit_breaker_transitions_total",
+		"Number of state transitions of the circuit breaker.",
+		"dependency", "state",
+	)
+
+	// rejected counts the calls rejected by open breakers.
+	rejected = metrics.NewCounter(
+		"circuit_breaker_rejected_total",
+		"Number of calls rejected by the circuit breaker.",
+		"dependency",
+	)
+)
@@ -0,0 +1,193 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestBreaker(t *testing.T) {
+	errFailed := errors.New("failed")
+	type step struct {
+		advance   time.Duration
+		err       error // the outcome of the call
+		calls     int   // the number of calls, defaults to 1
+		wantErr   error
+		wantState State
+	}
+	tests := []struct {
+		name  string
+		steps []step
+	}{
+		{
+			name: "stays closed below the min calls",
+			steps: []step{
+				{err: errFailed, calls: 3, wantErr: errFailed, wantState: StateClosed},
+			},
+		},
+		{
+			name: "stays closed below the failure rate",
+			steps: []step{
+				{calls: 3, wantState: StateClosed},
+				{err: errFailed, calls: 2, wantErr: errFailed, wantState: StateClosed},
+			},
+		},
+		{
+			name: "opens at the failure rate",
+			steps: []step{
+				{calls: 2, wantState: StateClosed},
+				{err: errFailed, calls: 2, wantErr: errFailed, wantState: StateOpen},
+				{wantErr: ErrOpen, wantState: StateOpen},
+			},
+		},
+		{
+			name: "cancellations are no failures",
+			steps: []step{
+				{err: context.Canceled, calls: 4, wantErr: context.Canceled, wantState: StateClosed},
+			},
+		},
+		{
+			name: "failures leave the window",
+			steps: []step{
+				{err: errFailed, calls: 3, wantErr: errFailed, wantState: StateClosed},
+				{advance: 11 * time.Second, calls: 1, wantState: StateClosed},
+				{err: errFailed, calls: 1, wantErr: errFailed, wantState: StateClosed},
+			},
+		},
+		{
+			name: "rejects until the open timeout",
+			steps: []step{
+				{err: errFailed, calls: 4, wantErr: errFailed, wantState: StateOpen},
+				{advance: 4 * time.Second, wantErr: ErrOpen, wantState: StateOpen},
+			},
+		},
+		{
+			name: "closes after successful probes",
+			steps: []step{
+				{err: errFailed, calls: 4, wantErr: errFailed, wantState: StateOpen},
+				{advance: 5 * time.Second, wantState: StateHalfOpen},
+				{wantState: StateClosed},
+				{err: errFailed, wantErr: errFailed, wantState: StateClosed},
+			},
+		},
+		{
+			name: "opens again after a failed probe",
+			steps: []step{
+				{err: errFailed, calls: 4, wantErr: errFailed, wantState: StateOpen},
+				{advance: 5 * time.Second, err: errFailed, wantErr: errFailed, wantState: StateOpen},
+				{advance: 4 * time.Second, wantErr: ErrOpen, wantState: StateOpen},
+				{advance: time.Second, calls: 2, wantState: StateClosed},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			b := NewBreaker("test", BreakerConfig{
+				FailureRate: 0.5,
+				MinCalls:    4,
+				Window:      10 * time.Second,
+				OpenTimeout: 5 * time.Second,
+				ProbeCalls:  2,
+			})
+			b.UseClock(c)
+			for i, s := range tt.steps {
+				c.Advance(s.advance)
+				for j := 0; j < max(s.calls, 1); j++ {
+					err := b.Do(context.Background(), func(context.Context) error { return s.err })
+					if !errors.Is(err, s.wantErr) {
+						t.Fatalf("step %d: got error %v, want %v", i, err, s.wantErr)
+					}
+				}
+				if got := b.State(); got != s.wantState {
+					t.Fatalf("step %d: got state %v, want %v", i, got, s.wantState)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakerProbeLimit(t *testing.T) {
+	c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := NewBreaker("test", BreakerConfig{FailureRate: 0.5, MinCalls: 1, Window: time.Minute, OpenTimeout: time.Second, ProbeCalls: 2})
+	b.UseClock(c)
+	b.Do(context.Background(), func(context.Context) error { return errors.New("failed") }) //nolint:errcheck // opens
+	c.Advance(time.Second)
+
+	// Only ProbeCalls calls are let through while half-open.
+	var dones []func(bool)
+	for i := 0; i < 2; i++ {
+		done, err := b.Allow()
+		if err != nil {
+			t.Fatalf("probe %d: %v", i, err)
+		}
+		dones = append(dones, done)
+	}
+	if _, err := b.Allow(); !errors.Is(err, ErrOpen) {
+		t.Errorf("got error %v for a third probe, want %v", err, ErrOpen)
+	}
+	for _, done := range dones {
+		done(true)
+	}
+	if got := b.State(); got != StateClosed {
+		t.Errorf("got state %v, want %v", got, StateClosed)
+	}
+}
+
+func TestBreakerStaleOutcomes(t *testing.T) {
+	c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := NewBreaker("test", BreakerConfig{FailureRate: 0.5, MinCalls: 1, Window: time.Minute, OpenTimeout: time.Second, ProbeCalls: 1})
+	b.UseClock(c)
+
+	// A slow call allowed while closed finishes after the breaker opened
+	// and became half-open. Its outcome must not close the breaker.
+	slow, _ := b.Allow()
+	b.Do(context.Background(), func(context.Context) error { return errors.New("failed") }) //nolint:errcheck // opens
+	c.Advance(time.Second)
+	probe, err := b.Allow()
+	if err != nil {
+		t.Fatalf("probe: %v", err)
+	}
+	slow(true)
+	if got := b.State(); got != StateHalfOpen {
+		t.Errorf("got state %v after a stale outcome, want %v", got, StateHalfOpen)
+	}
+	probe(true)
+	if got := b.State(); got != StateClosed {
+		t.Errorf("got state %v after the probe, want %v", got, StateClosed)
+	}
+}
+
+func TestBreakerConcurrent(t *testing.T) {
+	c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	b := NewBreaker("test", BreakerConfig{FailureRate: 0.5, MinCalls: 10, Window: time.Minute, OpenTimeout: time.Second, ProbeCalls: 3})
+	b.UseClock(c)
+	errFailed := errors.New("failed")
+
+	run := func(n int, err error) {
+		var wg sync.WaitGroup
+		for i := 0; i < n; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				b.Do(context.Background(), func(context.Context) error { return err }) //nolint:errcheck // checked by the state
+			}()
+		}
+		wg.Wait()
+	}
+
+	run(100, errFailed)
+	if got := b.State(); got != StateOpen {
+		t.Fatalf("got state %v after concurrent failures, want %v", got, StateOpen)
+	}
+	c.Advance(time.Second)
+	run(100, nil)
+	if got := b.State(); got != StateClosed {
+		t.Errorf("got state %v after concurrent probes, want %v", got, StateClosed)
+	}
+}
@@ -0,0 +1,105 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync/atomic"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// WithFallback calls primary, and falls back to fallback if the dependency is
+// unavailable, i.e. its circuit breaker is open. The fallback may serve cached
+// or stale data, or a partial response. If the fallback is used, the response
+// is marked as degraded, see [MarkDegraded]. Other errors of primary are
+// returned as is.
+func WithFallback[T any](
+	ctx context.Context,
+	dependency string,
+	primary func(context.Context) (T, error),
+	fallback func(context.Context, error) (T, error),
+) (T, error) {
+	res, err := primary(ctx)
+	if err == nil || !IsUnavailable(err) {
+		return res, err
+	}
+	if res, err = fallback(ctx, err); err != nil {
+		return res, err
+	}
+	MarkDegraded(ctx, dependency)
+	return res, nil
+}
+
+// IsUnavailable reports whether the error indicates that a dependency is not
+// called because its circuit breaker is open.
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrOpen) || status.Code(err) == codes.Unavailable
+}
+
+// MarkDegraded marks the response of the request as degraded, because it was
+// served without the given dependency. Degraded http responses carry the
+// header "Degraded: true", which requires [DegradedMiddleware]. Degraded grpc
+// responses carry the same header as metadata.
+func MarkDegraded(ctx context.Context, dependency string) {
+	degraded.Inc(dependency)
+	if flag, ok := ctx.Value(degradedKey{}).(*atomic.Bool); ok {
+		flag.Store(true)
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(degradedHeader, "true")) //nolint:errcheck,gosec // not a grpc call
+}
+
+// DegradedMiddleware returns an http middleware that sets the "Degraded: true"
+// header on the responses marked with [MarkDegraded].
+func DegradedMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flag := &atomic.Bool{}
+		ctx := context.WithValue(r.Context(), degradedKey{}, flag)
+		next.ServeHTTP(&degradedWriter{ResponseWriter: w, flag: flag}, r.WithContext(ctx))
+	})
+}
+
+// degradedWriter sets the degraded header before the response is written.
+type degradedWriter struct {
+	http.ResponseWriter
+	flag        *atomic.Bool
+	wroteHeader bool
+}
+
+func (w *degradedWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.wroteHeader = true
+		if w.flag.Load() {
+			w.Header().Set(degradedHeader, "true")
+		}
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *degradedWriter) Write(b []byte) (int, error) {
+	if !w.wroteHeader {
+		w.WriteHeader(http.StatusOK)
+	}
+	return w.ResponseWriter.Write(b) //nolint:wrapcheck // transparent writer
+}
+
+// Unwrap returns the wrapped writer, for [http.ResponseController].
+func (w *degradedWriter) Unwrap() http.ResponseWriter { return w.ResponseWriter }
+
+// degradedKey is the context key of the degraded flag of a request.
+type degradedKey struct{}
+
+// degradedHeader marks degraded responses.
+const degradedHeader = "Degraded"
+
+// degraded counts the degraded responses.
+var degraded = metrics.NewCounter(
+	"degraded_responses_total",
+	"Number of responses served with a fallback because a dependency was unavailable.",
+	"dependency",
+)
@@ -0,0 +1,164 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/rand"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+// Policy configures how [Retry] retries an operation.
+type Policy struct {
+	// MaxAttempts is the maximum number of attempts, including the
+	// first one. Zero means no limit, bounded by MaxElapsed.
+	MaxAttempts int `env:"RETRY_MAX_ATTEMPTS" envDefault:"3"`
+
+	// InitialBackoff is the delay before the first retry. Every
+	// following retry doubles the delay, up to MaxBackoff. Zero
+	// backoffs are those of [DefaultPolicy], thus a zero policy
+	// does not retry in a busy loop.
+	InitialBackoff time.Duration `env:"RETRY_INITIAL_BACKOFF" envDefault:"100ms"`
+	MaxBackoff     time.Duration `env:"RETRY_MAX_BACKOFF" envDefault:"5s"`
+
+	// MaxElapsed bounds the total duration of all attempts. Zero
+	// means no limit, bounded by MaxAttempts.
+	MaxElapsed time.Duration `env:"RETRY_MAX_ELAPSED" envDefault:"30s"`
+
+	// Retryable classifies the errors of the operation. If nil,
+	// [IsRetryable] is used.
+	Retryable func(error) bool `env:"-"`
+
+	// Clock measures the backoff and the elapsed time. If nil,
+	// [clock.Real] is used.
+	Clock clock.Clock `env:"-"`
+}
+
+// DefaultPolicy is the policy used when nothing else is configured.
+var DefaultPolicy = Policy{
+	MaxAttempts:    3, //nolint:gomnd // see the env defaults
+	InitialBackoff: 100 * time.Millisecond,
+	MaxBackoff:     5 * time.Second,
+	MaxElapsed:     30 * time.Second,
+}
+
+// Retry calls fn until it succeeds, returns an error that is not retryable, or
+// the policy is exhausted. The delays between the attempts grow exponentially
+// and are randomized ("full jitter"), so that many clients failing at the same
+// time do not retry in lockstep. Retry returns the error of the last attempt,
+// or the error of ctx in case it is done while waiting. A policy with neither
+// MaxAttempts nor MaxElapsed retries until ctx is done.
+func Retry(ctx context.Context, p Policy, fn func(context.Context) error) error {
+	retryable := p.Retryable
+	if retryable == nil {
+		retryable = IsRetryable
+	}
+	if p.InitialBackoff <= 0 {
+		p.InitialBackoff = DefaultPolicy.InitialBackoff
+	}
+	if p.MaxBackoff <= 0 {
+		p.MaxBackoff = DefaultPolicy.MaxBackoff
+	}
+	p.MaxBackoff = max(p.MaxBackoff, p.InitialBackoff)
+	c := clock.Or(p.Clock)
+	start := c.Now()
+	backoff := p.InitialBackoff
+	for attempt := 1; ; attempt++ {
+		err := fn(ctx)
+		if err == nil || !retryable(err) || ctx.Err() != nil {
+			return err
+		}
+		if p.MaxAttempts > 0 && attempt >= p.MaxAttempts {
+			return err
+		}
+
+		delay := time.Duration(rand.Int63n(int64(backoff) + 1)) //nolint:gosec // jitter
+		if p.MaxElapsed > 0 && clock.Since(c, start)+delay > p.MaxElapsed {
+			return err
+		}
+		slog.Warn("attempt failed, retrying",
+			slog.Int("attempt", attempt),
+			slog.Duration("delay", delay),
+			slog.String("error", err.Error()),
+		)
+
+		if clock.Sleep(ctx, c, delay) != nil {
+			return fmt.Errorf("%w: %v", ctx.Err(), err) //nolint:errorlint // keep the last error
+		}
+		backoff = min(2*backoff, p.MaxBackoff)
+	}
+}
+
+// Permanent marks the error as not retryable.
+func Permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	return &permanentError{err: err}
+}
+
+// IsRetryable reports whether an operation that failed with the error may
+// succeed when retried. Cancellations, open circuit breakers, [Permanent]
+// errors, and errors caused by the request itself, e.g. [service.ErrBadRequest]
+// or codes.InvalidArgument, are not retryable. Errors may override the
+// classification by implementing
+//
+//	interface{ Retryable() bool }
+func IsRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+	var r interface{ Retryable() bool }
+	if errors.As(err, &r) {
+		return r.Retryable()
+	}
+	for _, target := range permanentErrors {
+		if errors.Is(err, target) {
+			return false
+		}
+	}
+	if s, ok := status.FromError(err); ok {
+		return !permanentCodes[s.Code()]
+	}
+	return true
+}
+
+// permanentError is an error that is not retryable, see [Permanent].
+type permanentError struct{ err error }
+
+func (e *permanentError) Error() string   { return e.err.Error() }
+func (e *permanentError) Unwrap() error   { return e.err }
+func (e *permanentError) Retryable() bool { return false }
+
+var (
+	// permanentErrors are not retryable.
+	permanentErrors = []error{
+		context.Canceled,
+		ErrOpen,
+		service.ErrBadRequest,
+		service.ErrNotFound,
+		service.ErrAlreadyExists,
+		service.ErrNotAllowed,
+	}
+
+	// permanentCodes are grpc codes that are not retryable.
+	permanentCodes = map[codes.Code]bool{
+		codes.OK:                 true,
+		codes.Canceled:           true,
+		codes.InvalidArgument:    true,
+		codes.NotFound:           true,
+		codes.AlreadyExists:      true,
+		codes.PermissionDenied:   true,
+		codes.Unauthenticated:    true,
+		codes.FailedPrecondition: true,
+		codes.OutOfRange:         true,
+		codes.Unimplemented:      true,
+	}
+)
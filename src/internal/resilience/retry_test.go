@@ -0,0 +1,167 @@
+package resilience
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+func TestRetryBackoff(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name         string
+		policy       Policy
+		wantAttempts int
+		// wantMaxDelays are the upper bounds of the delays between the
+		// attempts.
+		wantMaxDelays []time.Duration
+	}{
+		{
+			name:         "zero backoffs",
+			policy:       Policy{MaxAttempts: 5},
+			wantAttempts: 5,
+			wantMaxDelays: []time.Duration{
+				100 * time.Millisecond, 200 * time.Millisecond, 400 * time.Millisecond, 800 * time.Millisecond,
+			},
+		},
+		{
+			name:         "zero max backoff",
+			policy:       Policy{MaxAttempts: 4, InitialBackoff: time.Second},
+			wantAttempts: 4,
+			wantMaxDelays: []time.Duration{
+				time.Second, 2 * time.Second, 4 * time.Second,
+			},
+		},
+		{
+			name:         "max backoff below the initial backoff",
+			policy:       Policy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: time.Millisecond},
+			wantAttempts: 4,
+			wantMaxDelays: []time.Duration{
+				time.Second, time.Second, time.Second,
+			},
+		},
+		{
+			name:         "capped",
+			policy:       Policy{MaxAttempts: 4, InitialBackoff: time.Second, MaxBackoff: 3 * time.Second},
+			wantAttempts: 4,
+			wantMaxDelays: []time.Duration{
+				time.Second, 2 * time.Second, 3 * time.Second,
+			},
+		},
+		{
+			name:          "max elapsed",
+			policy:        Policy{InitialBackoff: time.Minute, MaxElapsed: time.Nanosecond},
+			wantAttempts:  1,
+			wantMaxDelays: nil,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			clk := &sleepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			tt.policy.Clock = clk
+			var attempts int
+			err := Retry(context.Background(), tt.policy, func(context.Context) error {
+				attempts++
+				return errFailed
+			})
+			if !errors.Is(err, errFailed) {
+				t.Errorf("got error %v, want %v", err, errFailed)
+			}
+			if attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, want %d", attempts, tt.wantAttempts)
+			}
+			if len(clk.delays) != len(tt.wantMaxDelays) {
+				t.Fatalf("got delays %v, want %d delays", clk.delays, len(tt.wantMaxDelays))
+			}
+			for i, d := range clk.delays {
+				if d > tt.wantMaxDelays[i] {
+					t.Errorf("got delay %s before retry %d, want at most %s", d, i+1, tt.wantMaxDelays[i])
+				}
+			}
+		})
+	}
+}
+
+func TestRetryZeroPolicy(t *testing.T) {
+	// Without limits, Retry retries until ctx is done, without busy
+	// looping in the meantime.
+	clk := &sleepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var attempts int
+	err := Retry(ctx, Policy{Clock: clk}, func(context.Context) error {
+		attempts++
+		if attempts == 10 {
+			cancel()
+		}
+		return errors.New("failed")
+	})
+	if attempts != 10 || err == nil {
+		t.Fatalf("got %d attempts, %v, want 10 and an error", attempts, err)
+	}
+	if elapsed := clock.Since(clk, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)); elapsed == 0 {
+		t.Errorf("got %d retries without waiting, want backoff", attempts-1)
+	}
+}
+
+func TestRetryNotRetryable(t *testing.T) {
+	tests := []struct {
+		name         string
+		err          error
+		wantAttempts int
+	}{
+		{"success", nil, 1},
+		{"permanent", Permanent(errors.New("failed")), 1},
+		{"canceled", context.Canceled, 1},
+		{"retryable", errors.New("failed"), 3},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			clk := &sleepClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+			var attempts int
+			err := Retry(context.Background(), Policy{MaxAttempts: 3, Clock: clk}, func(context.Context) error {
+				attempts++
+				return tt.err
+			})
+			if !errors.Is(err, tt.err) || attempts != tt.wantAttempts {
+				t.Errorf("got %d attempts, %v, want %d, %v", attempts, err, tt.wantAttempts, tt.err)
+			}
+		})
+	}
+}
+
+// sleepClock is a [clock.Clock] whose timers fire at once, advancing the
+// clock by their duration. It records the durations of the timers.
+type sleepClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	delays []time.Duration
+}
+
+func (c *sleepClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *sleepClock) NewTimer(d time.Duration) clock.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+	c.delays = append(c.delays, d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return firedTimer(ch)
+}
+
+// firedTimer is a [clock.Timer] that fired.
+type firedTimer chan time.Time
+
+func (t firedTimer) C() <-chan time.Time { return t }
+func (t firedTimer) Stop() bool          { return false }
@@ -0,0 +1,545 @@
+// Package saga coordinates workflows spanning several services, e.g. a
+// booking that reserves seats, charges the payment and notifies the customer,
+// without distributed transactions.
+//
+// A saga is a sequence of [Step]s. Every step has an action, and optionally a
+// compensation undoing it. If a step fails for good, the compensations of the
+// step and of all previous steps run in reverse order, leaving the system
+// consistent again. Steps either complete when their action returns, or await
+// the outcome of work done by another service, which is reported by the events
+// of the bus, see [Coordinator.Handler]:
+//
+//	booking := saga.New("booking", cfg, store,
+//		saga.Step[Booking]{Name: "reserve", Do: reserveSeats, Compensate: releaseSeats},
+//		saga.Step[Booking]{Name: "charge", Do: requestPayment, Compensate: refund, Await: true},
+//		saga.Step[Booking]{Name: "notify", Do: sendConfirmation},
+//	)
+//	err := booking.Start(ctx, bookingID, Booking{...})
+//
+// The state of every saga is persisted in a [Store] after every transition,
+// thus sagas continue after restarts. Failed actions are retried, awaited
+// steps time out, and compensations are retried by the background worker,
+// see [Coordinator.Worker]. Actions and compensations may run more than once
+// and must be idempotent; compensations must also tolerate actions that did
+// not take effect.
+package saga
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/workers"
+)
+
+// Config encapsulates the configuration of the sagas.
+type Config struct {
+	// PollInterval is the interval at which the store is polled
+	// for timed out steps and due retries.
+	PollInterval time.Duration `env:"SAGA_POLL_INTERVAL" envDefault:"5s"`
+
+	// StepTimeout is the time an awaited step waits for its
+	// outcome, unless the step sets its own timeout.
+	StepTimeout time.Duration `env:"SAGA_STEP_TIMEOUT" envDefault:"1m"`
+
+	// MaxAttempts is the number of times the action, or the
+	// compensation, of a step is attempted.
+	MaxAttempts int `env:"SAGA_MAX_ATTEMPTS" envDefault:"3"`
+
+	// Backoff is the delay before the first retry. Every
+	// following retry doubles the delay.
+	Backoff time.Duration `env:"SAGA_RETRY_BACKOFF" envDefault:"1s"`
+}
+
+// Step is a step of a saga operating on the data of type T.
+type Step[T any] struct {
+	// Name identifies the step, e.g. in the outcomes reported by
+	// other services.
+	Name string
+
+	// Do is the action of the step. Returning an error retries
+	// the action, until its attempts are exhausted.
+	Do func(_ context.Context, id string, data *T) error
+
+	// Compensate undoes the action. Nil if there is nothing to
+	// undo.
+	Compensate func(_ context.Context, id string, data *T) error
+
+	// Await makes the step wait for its outcome after the action
+	// returned, see [Coordinator.Complete] and [Coordinator.Fail].
+	// The action is retried if the outcome does not arrive in
+	// time.
+	Await bool
+
+	// Timeout overrides [Config.StepTimeout] for the step.
+	Timeout time.Duration
+}
+
+// Status is the status of a saga.
+type Status string
+
+// The statuses of a saga.
+const (
+	// Running sagas execute, or await, their steps.
+	Running Status = "running"
+
+	// Compensating sagas failed and undo their steps.
+	Compensating Status = "compensating"
+
+	// Completed sagas executed all of their steps.
+	Completed Status = "completed"
+
+	// Compensated sagas failed and undid their steps.
+	Compensated Status = "compensated"
+
+	// Failed sagas could not undo their steps and need manual
+	// intervention.
+	Failed Status = "failed"
+)
+
+// Done reports whether the saga reached a final status.
+func (s Status) Done() bool { return s == Completed || s == Compensated || s == Failed }
+
+// ErrConflict is returned by the stores when a saga was updated concurrently,
+// e.g. by another replica. It complements the errors defined by the service
+// framework, which has no error for this case.
+var ErrConflict = errors.New("saga was updated concurrently")
+
+// Coordinator drives the sagas of a definition.
+type Coordinator[T any] struct {
+	name  string
+	cfg   Config
+	store Store
+	steps []Step[T]
+	clock clock.Clock
+
+	// mu serializes the transitions within the replica, the
+	// versions of the records serialize them across replicas.
+	mu sync.Mutex
+}
+
+// New creates a new [Coordinator] of the saga with the given name and steps.
+func New[T any](name string, cfg Config, s Store, steps ...Step[T]) *Coordinator[T] {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	return &Coordinator[T]{name: name, cfg: cfg, store: s, steps: steps, clock: clock.Real}
+}
+
+// UseClock makes the coordinator use the given clock for timeouts and retries,
+// e.g. a fake clock in tests. UseClock must be called before the coordinator
+// is used.
+func (c *Coordinator[T]) UseClock(cl clock.Clock) {
+	c.clock = clock.Or(cl)
+}
+
+// Start starts a new saga with the given id and data, and executes its steps
+// up to the first awaited one. This function returns
+// [service.ErrAlreadyExists] in case a saga with the id exists.
+func (c *Coordinator[T]) Start(ctx context.Context, id string, data T) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("%w: encode saga data: %v", service.ErrBadRequest, err)
+	}
+	now := c.clock.Now()
+	rec := Record{
+		ID:        id,
+		Saga:      c.name,
+		Status:    Running,
+		Data:      raw,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+	if err := c.store.Create(ctx, &rec); err != nil {
+		return err
+	}
+	sagasTotal.Inc(c.name, "started")
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.drive(ctx, &rec)
+}
+
+// Get returns the record of the saga with the id, and its data. This function
+// returns [service.ErrNotFound] in case there is no such saga.
+func (c *Coordinator[T]) Get(ctx context.Context, id string) (Record, T, error) {
+	var data T
+	rec, err := c.store.Load(ctx, id)
+	if err != nil {
+		return Record{}, data, err
+	}
+	if err := json.Unmarshal(rec.Data, &data); err != nil {
+		return Record{}, data, fmt.Errorf("%w: decode saga data: %v", service.ErrUnexpected, err)
+	}
+	return rec, data, nil
+}
+
+// Complete reports the success of the awaited step of the saga, and continues
+// with the next steps. The optional update applies the outcome to the data of
+// the saga, e.g. the id of a payment. Outcomes of steps that are not awaited,
+// e.g. duplicates, are ignored. This function returns [service.ErrNotFound] in
+// case there is no such saga.
+func (c *Coordinator[T]) Complete(ctx context.Context, id, step string, update func(*T)) error {
+	return c.report(ctx, id, step, func(rec *Record, data *T) {
+		if update != nil {
+			update(data)
+		}
+		rec.Step++
+		rec.Attempt = 0
+	})
+}
+
+// Fail reports the failure of the awaited step of the saga, which compensates
+// the saga without retrying the step. Outcomes of steps that are not awaited
+// are ignored. This function returns [service.ErrNotFound] in case there is no
+// such saga.
+func (c *Coordinator[T]) Fail(ctx context.Context, id, step, reason string) error {
+	return c.report(ctx, id, step, func(rec *Record, _ *T) {
+		c.startCompensation(rec, fmt.Sprintf("step %s failed: %s", step, reason))
+	})
+}
+
+// report applies the outcome of the awaited step and drives the saga on.
+// Concurrent updates are retried, as the outcome may still apply.
+func (c *Coordinator[T]) report(
+	ctx context.Context,
+	id, step string,
+	apply func(*Record, *T),
+) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for attempt := 0; ; attempt++ {
+		rec, err := c.store.Load(ctx, id)
+		if err != nil {
+			return err
+		}
+		if rec.Status != Running || rec.Step >= len(c.steps) ||
+			c.steps[rec.Step].Name != step || !c.steps[rec.Step].Await {
+			slog.Debug("ignoring saga outcome",
+				slog.String("saga", c.name),
+				slog.String("id", id),
+				slog.String("step", step),
+			)
+			return nil
+		}
+		var data T
+		if err := json.Unmarshal(rec.Data, &data); err != nil {
+			return fmt.Errorf("%w: decode saga data: %v", service.ErrUnexpected, err)
+		}
+		apply(&rec, &data)
+		if rec.Data, err = json.Marshal(data); err != nil {
+			return fmt.Errorf("%w: encode saga data: %v", service.ErrUnexpected, err)
+		}
+		rec.Due = time.Time{}
+		err = c.save(ctx, &rec)
+		if errors.Is(err, ErrConflict) && attempt < maxConflictRetries {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return c.drive(ctx, &rec)
+	}
+}
+
+// Run retries the due steps and compensations of the sagas, and times out the
+// awaited steps, until ctx is cancelled. This is a blocking function. Due
+// sagas are claimed, thus replicas polling the same store do not drive the
+// same saga at once.
+func (c *Coordinator[T]) Run(ctx context.Context) error {
+	ticker := time.NewTicker(c.cfg.PollInterval)
+	defer ticker.Stop()
+	for {
+		c.driveDue(ctx)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// Worker returns the background worker running [Coordinator.Run].
+func (c *Coordinator[T]) Worker() workers.Worker {
+	return workers.Worker{Name: "saga-" + c.name, Run: c.Run, Restart: workers.RestartOnFailure}
+}
+
+// Handler returns the [service.EventHandler] reporting the outcomes of awaited
+// steps carried by the events of a topic. The function outcome extracts the
+// outcome from an event, and returns false for events that carry none.
+func (c *Coordinator[T]) Handler(outcome func(msg []byte) (Outcome[T], bool)) service.EventHandler {
+	return func(ctx context.Context, msg []byte) {
+		o, ok := outcome(msg)
+		if !ok {
+			return
+		}
+		var err error
+		if o.Err != nil {
+			err = c.Fail(ctx, o.ID, o.Step, o.Err.Error())
+		} else {
+			err = c.Complete(ctx, o.ID, o.Step, o.Update)
+		}
+		if err != nil {
+			slog.Error("failed to report saga outcome",
+				slog.String("saga", c.name),
+				slog.String("id", o.ID),
+				slog.String("step", o.Step),
+				slog.String("error", err.Error()),
+			)
+		}
+	}
+}
+
+// Outcome is the outcome of an awaited step, see [Coordinator.Handler].
+type Outcome[T any] struct {
+	// ID is the id of the saga, usually correlated from the event.
+	ID string
+
+	// Step is the name of the awaited step.
+	Step string
+
+	// Err is non-nil if the step failed.
+	Err error
+
+	// Update optionally applies the outcome to the data.
+	Update func(*T)
+}
+
+// driveDue drives the sagas that are due.
+func (c *Coordinator[T]) driveDue(ctx context.Context) {
+	lease := leaseIntervals * c.cfg.PollInterval
+	for ctx.Err() == nil {
+		due, err := c.store.Claim(ctx, c.name, c.clock.Now(), lease, pollBatchSize)
+		if err != nil {
+			slog.Error("failed to claim due sagas",
+				slog.String("saga", c.name),
+				slog.String("error", err.Error()),
+			)
+			return
+		}
+		for i := range due {
+			rec := due[i]
+			if rec.Status == Running && c.steps[rec.Step].Await && rec.Attempt >= c.cfg.MaxAttempts {
+				c.startCompensation(&rec, fmt.Sprintf("step %s timed out", c.steps[rec.Step].Name))
+			}
+			c.mu.Lock()
+			err := c.drive(ctx, &rec)
+			c.mu.Unlock()
+			if err != nil && !errors.Is(err, ErrConflict) {
+				slog.Error("failed to drive saga",
+					slog.String("saga", c.name),
+					slog.String("id", rec.ID),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+		if len(due) < pollBatchSize {
+			return
+		}
+	}
+}
+
+// drive executes the steps, or the compensations, of the saga until it awaits
+// an outcome, waits for a retry, or is done. The record is saved after every
+// transition.
+func (c *Coordinator[T]) drive(ctx context.Context, rec *Record) error {
+	var data T
+	if err := json.Unmarshal(rec.Data, &data); err != nil {
+		return fmt.Errorf("%w: decode saga data: %v", service.ErrUnexpected, err)
+	}
+	for {
+		var err error
+		switch rec.Status {
+		case Running:
+			err = c.step(ctx, rec, &data)
+		case Compensating:
+			err = c.compensate(ctx, rec, &data)
+		default:
+			return nil
+		}
+		if err := c.encode(rec, data); err != nil {
+			return err
+		}
+		if saveErr := c.save(ctx, rec); saveErr != nil {
+			return saveErr
+		}
+		if errors.Is(err, errWait) {
+			return nil
+		}
+	}
+}
+
+// step executes the current step of a running saga.
+func (c *Coordinator[T]) step(ctx context.Context, rec *Record, data *T) error {
+	if rec.Step >= len(c.steps) {
+		rec.Status, rec.Due = Completed, time.Time{}
+		sagasTotal.Inc(c.name, string(Completed))
+		return errWait
+	}
+	s := c.steps[rec.Step]
+	if rec.Attempt >= c.cfg.MaxAttempts {
+		c.startCompensation(rec, fmt.Sprintf("step %s failed: %s", s.Name, rec.Error))
+		return nil
+	}
+	rec.Attempt++
+	if err := call(ctx, s.Do, rec.ID, data); err != nil {
+		stepFailures.Inc(c.name, s.Name)
+		slog.Warn("saga step failed",
+			slog.String("saga", c.name),
+			slog.String("id", rec.ID),
+			slog.String("step", s.Name),
+			slog.Int("attempt", rec.Attempt),
+			slog.String("error", err.Error()),
+		)
+		rec.Error = err.Error()
+		rec.Due = c.clock.Now().Add(c.backoff(rec.Attempt))
+		return errWait
+	}
+	if s.Await {
+		timeout := s.Timeout
+		if timeout <= 0 {
+			timeout = c.cfg.StepTimeout
+		}
+		rec.Due = c.clock.Now().Add(timeout)
+		return errWait
+	}
+	rec.Step++
+	rec.Attempt, rec.Due = 0, time.Time{}
+	return nil
+}
+
+// compensate runs the compensation of the current step of a compensating saga.
+func (c *Coordinator[T]) compensate(ctx context.Context, rec *Record, data *T) error {
+	if rec.Step < 0 {
+		rec.Status, rec.Due = Compensated, time.Time{}
+		sagasTotal.Inc(c.name, string(Compensated))
+		slog.Info("saga compensated",
+			slog.String("saga", c.name),
+			slog.String("id", rec.ID),
+			slog.String("reason", rec.Error),
+		)
+		return errWait
+	}
+	s := c.steps[rec.Step]
+	if s.Compensate == nil {
+		rec.Step--
+		return nil
+	}
+	rec.Attempt++
+	if err := call(ctx, s.Compensate, rec.ID, data); err != nil {
+		stepFailures.Inc(c.name, s.Name+".compensate")
+		if rec.Attempt >= c.cfg.MaxAttempts {
+			rec.Status, rec.Due = Failed, time.Time{}
+			rec.Error = fmt.Sprintf("compensate step %s: %v", s.Name, err)
+			sagasTotal.Inc(c.name, string(Failed))
+			slog.Error("saga compensation failed, manual intervention required",
+				slog.String("saga", c.name),
+				slog.String("id", rec.ID),
+				slog.String("step", s.Name),
+				slog.String("error", err.Error()),
+			)
+			return errWait
+		}
+		rec.Due = c.clock.Now().Add(c.backoff(rec.Attempt))
+		return errWait
+	}
+	rec.Step--
+	rec.Attempt, rec.Due = 0, time.Time{}
+	return nil
+}
+
+// startCompensation switches the saga to compensating, starting with the
+// current step, whose action may have taken effect.
+func (c *Coordinator[T]) startCompensation(rec *Record, reason string) {
+	slog.Warn("compensating saga",
+		slog.String("saga", c.name),
+		slog.String("id", rec.ID),
+		slog.String("reason", reason),
+	)
+	rec.Status, rec.Error = Compensating, reason
+	rec.Step = min(rec.Step, len(c.steps)-1)
+	rec.Attempt, rec.Due = 0, time.Time{}
+}
+
+// encode stores the data in the record.
+func (c *Coordinator[T]) encode(rec *Record, data T) error {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("%w: encode saga data: %v", service.ErrUnexpected, err)
+	}
+	rec.Data = raw
+	return nil
+}
+
+// save persists the record.
+func (c *Coordinator[T]) save(ctx context.Context, rec *Record) error {
+	rec.UpdatedAt = c.clock.Now()
+	if err := c.store.Update(ctx, rec); err != nil {
+		return fmt.Errorf("save saga %s %s: %w", c.name, rec.ID, err)
+	}
+	return nil
+}
+
+// backoff returns the delay before the retry following the given attempt.
+func (c *Coordinator[T]) backoff(attempt int) time.Duration {
+	d := c.cfg.Backoff
+	for i := 1; i < attempt && d < maxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, maxBackoff)
+}
+
+// call executes an action or compensation, converting panics into errors.
+func call[T any](
+	ctx context.Context,
+	fn func(context.Context, string, *T) error,
+	id string,
+	data *T,
+) (err error) {
+	defer func() {
+		if msg := recover(); msg != nil {
+			err = fmt.Errorf("%w: panic: %v", service.ErrUnexpected, msg)
+		}
+	}()
+	return fn(ctx, id, data)
+}
+
+// errWait stops driving a saga until the next outcome or retry.
+var errWait = errors.New("wait")
+
+const (
+	// pollBatchSize is the maximum number of sagas claimed at once.
+	pollBatchSize = 100
+
+	// leaseIntervals is the number of poll intervals for which claimed sagas
+	// are reserved for the replica that claimed them.
+	leaseIntervals = 3
+
+	// maxConflictRetries is the number of times an outcome is applied again
+	// after a concurrent update.
+	maxConflictRetries = 3
+
+	// maxBackoff caps the delay between retries.
+	maxBackoff = 5 * time.Minute
+)
+
+var (
+	sagasTotal = metrics.NewCounter(
+		"sagas_total",
+		"Number of sagas by outcome.",
+		"saga", "outcome",
+	)
+	stepFailures = metrics.NewCounter(
+		"saga_step_failures_total",
+		"Number of failed actions and compensations of saga steps.",
+		"saga", "step",
+	)
+)
@@ -0,0 +1,136 @@
+package saga
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+// booking is the data of the sagas of the tests.
+type booking struct {
+	PaymentID string
+	Charges   int
+}
+
+func TestCoordinatorCompleteConflict(t *testing.T) {
+	tests := []struct {
+		name string
+		// conflicts is the number of updates preceded by a concurrent
+		// update, done by concurrent.
+		conflicts   int
+		concurrent  func(*Record)
+		wantErr     error
+		wantStatus  Status
+		wantCharges int
+		wantNotify  int
+	}{
+		{
+			name:        "no conflict",
+			wantStatus:  Completed,
+			wantCharges: 1,
+			wantNotify:  1,
+		},
+		{
+			name:        "retried",
+			conflicts:   1,
+			concurrent:  func(rec *Record) { rec.Due = rec.Due.Add(time.Minute) },
+			wantStatus:  Completed,
+			wantCharges: 1,
+			wantNotify:  1,
+		},
+		{
+			name:        "retried up to the limit",
+			conflicts:   maxConflictRetries,
+			concurrent:  func(rec *Record) { rec.Due = rec.Due.Add(time.Minute) },
+			wantStatus:  Completed,
+			wantCharges: 1,
+			wantNotify:  1,
+		},
+		{
+			name:       "retries exhausted",
+			conflicts:  maxConflictRetries + 1,
+			concurrent: func(rec *Record) { rec.Due = rec.Due.Add(time.Minute) },
+			wantErr:    ErrConflict,
+			wantStatus: Running,
+		},
+		{
+			name:      "outcome reported concurrently",
+			conflicts: 1,
+			concurrent: func(rec *Record) {
+				rec.Status, rec.Step = Completed, 3
+			},
+			wantStatus: Completed,
+		},
+		{
+			name:      "saga compensated concurrently",
+			conflicts: 1,
+			concurrent: func(rec *Record) {
+				rec.Status, rec.Step = Compensating, 1
+			},
+			wantStatus: Compensating,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			store := &conflictingStore{MemoryStore: NewMemoryStore(), concurrent: tt.concurrent}
+			var notified int
+			c := New("booking", Config{StepTimeout: time.Minute, MaxAttempts: 3}, store,
+				Step[booking]{Name: "reserve", Do: func(context.Context, string, *booking) error { return nil }},
+				Step[booking]{Name: "charge", Await: true, Do: func(context.Context, string, *booking) error { return nil }},
+				Step[booking]{Name: "notify", Do: func(context.Context, string, *booking) error {
+					notified++
+					return nil
+				}},
+			)
+			ctx := context.Background()
+			if err := c.Start(ctx, "b-1", booking{}); err != nil {
+				t.Fatalf("start saga: %v", err)
+			}
+
+			store.conflicts = tt.conflicts
+			err := c.Complete(ctx, "b-1", "charge", func(b *booking) {
+				b.PaymentID = "p-1"
+				b.Charges++
+			})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+			rec, data, err := c.Get(ctx, "b-1")
+			if err != nil {
+				t.Fatalf("get saga: %v", err)
+			}
+			if rec.Status != tt.wantStatus {
+				t.Errorf("got status %s, want %s", rec.Status, tt.wantStatus)
+			}
+			if data.Charges != tt.wantCharges || notified != tt.wantNotify {
+				t.Errorf("got %d charges and %d notifications, want %d and %d",
+					data.Charges, notified, tt.wantCharges, tt.wantNotify)
+			}
+		})
+	}
+}
+
+// conflictingStore is a [MemoryStore] updating the sagas concurrently, like
+// another replica would, before the next updates.
+type conflictingStore struct {
+	*MemoryStore
+	conflicts  int
+	concurrent func(*Record)
+}
+
+func (s *conflictingStore) Update(ctx context.Context, rec *Record) error {
+	if s.conflicts > 0 {
+		s.conflicts--
+		other, err := s.MemoryStore.Load(ctx, rec.ID)
+		if err != nil {
+			return err
+		}
+		s.concurrent(&other)
+		if err := s.MemoryStore.Update(ctx, &other); err != nil {
+			return err
+		}
+	}
+	return s.MemoryStore.Update(ctx, rec)
+}
@@ -0,0 +1,301 @@
+package saga
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Record is the persisted state of a saga.
+type Record struct {
+	ID     string
+	Saga   string
+	Status Status
+
+	// Step is the index of the current step, the one executed,
+	// awaited or compensated.
+	Step int
+
+	// Attempt is the number of attempts of the current action or
+	// compensation.
+	Attempt int
+
+	// Data is the json encoded data of the saga.
+	Data []byte
+
+	// Error is the reason of the last failure.
+	Error string
+
+	// Due is the time of the next retry or timeout. Zero if the
+	// saga waits for nothing.
+	Due time.Time
+
+	// Version is incremented by every update, see [ErrConflict].
+	Version int64
+
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
+
+// Store persists the state of the sagas.
+type Store interface {
+	// Create persists a new saga and sets its version. This
+	// function returns [service.ErrAlreadyExists] in case a saga
+	// with the same id exists.
+	Create(_ context.Context, rec *Record) error
+
+	// Load returns the saga with the id. This function returns
+	// [service.ErrNotFound] in case there is no such saga.
+	Load(_ context.Context, id string) (Record, error)
+
+	// Update persists the saga if its version is unchanged in the
+	// store, and increments it. This function returns
+	// [ErrConflict] in case the saga was updated concurrently.
+	Update(_ context.Context, rec *Record) error
+
+	// Claim returns up to limit running or compensating sagas of
+	// the given saga that are due at now. The due time of the
+	// returned sagas is moved by the lease, so that replicas
+	// polling the same store don't drive the same saga twice.
+	Claim(
+		_ context.Context,
+		saga string,
+		now time.Time,
+		lease time.Duration,
+		limit int,
+	) ([]Record, error)
+}
+
+// SQLStore is a [Store] backed by a postgres table. The table must be created
+// by the migrations of the service:
+//
+//	CREATE TABLE sagas (
+//		id         TEXT PRIMARY KEY,
+//		saga       TEXT NOT NULL,
+//		status     TEXT NOT NULL,
+//		step       INTEGER NOT NULL,
+//		attempt    INTEGER NOT NULL,
+//		data       BYTEA,
+//		error      TEXT NOT NULL DEFAULT '',
+//		due        TIMESTAMPTZ,
+//		version    BIGINT NOT NULL,
+//		created_at TIMESTAMPTZ NOT NULL,
+//		updated_at TIMESTAMPTZ NOT NULL
+//	);
+//	CREATE INDEX sagas_due ON sagas (saga, due) WHERE due IS NOT NULL;
+type SQLStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// NewSQLStore creates a new [SQLStore].
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Create implements the [Store] interface.
+func (s *SQLStore) Create(ctx context.Context, rec *Record) error {
+	res, err := s.db.ExecContext(ctx, `
+		INSERT INTO sagas (
+			id, saga, status, step, attempt, data, error, due, version, created_at, updated_at
+		)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, 1, $9, $10)
+		ON CONFLICT (id) DO NOTHING`,
+		rec.ID, rec.Saga, rec.Status, rec.Step, rec.Attempt, rec.Data, rec.Error,
+		nullTime(rec.Due), rec.CreatedAt.UTC(), rec.UpdatedAt.UTC(),
+	)
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return service.Unexpected(ctx, err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: saga %s", service.ErrAlreadyExists, rec.ID)
+	}
+	rec.Version = 1
+	return nil
+}
+
+// Load implements the [Store] interface.
+func (s *SQLStore) Load(ctx context.Context, id string) (Record, error) {
+	row := s.db.QueryRowContext(ctx, "SELECT "+recordColumns+" FROM sagas WHERE id = $1", id)
+	rec, err := scanRecord(row)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, fmt.Errorf("%w: saga %s", service.ErrNotFound, id)
+	}
+	if err != nil {
+		return Record{}, service.Unexpected(ctx, err)
+	}
+	return rec, nil
+}
+
+// Update implements the [Store] interface.
+func (s *SQLStore) Update(ctx context.Context, rec *Record) error {
+	res, err := s.db.ExecContext(ctx, `
+		UPDATE sagas SET status = $1, step = $2, attempt = $3, data = $4, error = $5, due = $6,
+			version = version + 1, updated_at = $7
+		WHERE id = $8 AND version = $9`,
+		rec.Status, rec.Step, rec.Attempt, rec.Data, rec.Error, nullTime(rec.Due),
+		rec.UpdatedAt.UTC(), rec.ID, rec.Version,
+	)
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return service.Unexpected(ctx, err)
+	} else if n == 0 {
+		return fmt.Errorf("%w: saga %s", ErrConflict, rec.ID)
+	}
+	rec.Version++
+	return nil
+}
+
+// Claim implements the [Store] interface.
+func (s *SQLStore) Claim(
+	ctx context.Context,
+	saga string,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]Record, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE sagas SET due = $1, version = version + 1
+		WHERE id IN (
+			SELECT id FROM sagas
+			WHERE saga = $2 AND due <= $3 AND status IN ($4, $5)
+			ORDER BY due
+			LIMIT $6
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+recordColumns,
+		now.Add(lease).UTC(), saga, now.UTC(), Running, Compensating, limit,
+	)
+	if err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	defer rows.Close() //nolint:errcheck // intentional
+
+	var res []Record
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, service.Unexpected(ctx, err)
+		}
+		res = append(res, rec)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	return res, nil
+}
+
+// scanRecord scans the [recordColumns] of a row.
+func scanRecord(row interface{ Scan(...any) error }) (Record, error) {
+	var (
+		rec Record
+		due sql.NullTime
+	)
+	err := row.Scan(&rec.ID, &rec.Saga, &rec.Status, &rec.Step, &rec.Attempt, &rec.Data,
+		&rec.Error, &due, &rec.Version, &rec.CreatedAt, &rec.UpdatedAt)
+	rec.Due = due.Time
+	return rec, err //nolint:wrapcheck // wrapped by the callers
+}
+
+// nullTime converts the zero time to NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t.UTC(), Valid: !t.IsZero()}
+}
+
+// MemoryStore is a [Store] kept in memory, which is useful for tests and for
+// running a single replica locally. The sagas are lost on restart.
+type MemoryStore struct {
+	mu      sync.Mutex
+	records map[string]Record
+}
+
+var _ Store = (*MemoryStore)(nil)
+
+// NewMemoryStore creates a new [MemoryStore].
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{records: make(map[string]Record)}
+}
+
+// Create implements the [Store] interface.
+func (s *MemoryStore) Create(_ context.Context, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, ok := s.records[rec.ID]; ok {
+		return fmt.Errorf("%w: saga %s", service.ErrAlreadyExists, rec.ID)
+	}
+	rec.Version = 1
+	s.records[rec.ID] = clone(*rec)
+	return nil
+}
+
+// Load implements the [Store] interface.
+func (s *MemoryStore) Load(_ context.Context, id string) (Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	rec, ok := s.records[id]
+	if !ok {
+		return Record{}, fmt.Errorf("%w: saga %s", service.ErrNotFound, id)
+	}
+	return clone(rec), nil
+}
+
+// Update implements the [Store] interface.
+func (s *MemoryStore) Update(_ context.Context, rec *Record) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if stored, ok := s.records[rec.ID]; !ok || stored.Version != rec.Version {
+		return fmt.Errorf("%w: saga %s", ErrConflict, rec.ID)
+	}
+	rec.Version++
+	s.records[rec.ID] = clone(*rec)
+	return nil
+}
+
+// Claim implements the [Store] interface.
+func (s *MemoryStore) Claim(
+	_ context.Context,
+	saga string,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]Record, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var due []Record
+	for _, rec := range s.records {
+		if rec.Saga == saga && !rec.Due.IsZero() && !rec.Due.After(now) &&
+			(rec.Status == Running || rec.Status == Compensating) {
+			due = append(due, rec)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].Due.Before(due[j].Due) })
+	res := make([]Record, 0, min(len(due), limit))
+	for _, rec := range due[:min(len(due), limit)] {
+		rec.Due = now.Add(lease)
+		rec.Version++
+		s.records[rec.ID] = rec
+		res = append(res, clone(rec))
+	}
+	return res, nil
+}
+
+// clone returns a copy of the record that does not share its data.
+func clone(rec Record) Record {
+	rec.Data = append([]byte(nil), rec.Data...)
+	return rec
+}
+
+// recordColumns are the columns of a [Record], in the order of [scanRecord].
+const recordColumns = "id, saga, status, step, attempt, data, error, due, version, " +
+	"created_at, updated_at"
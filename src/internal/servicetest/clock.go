@@ -0,0 +1,141 @@
+package servicetest
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+)
+
+// FakeClock is a [clock.Clock] that moves only when told to. Timers fire when
+// the clock is advanced past their deadline.
+//
+//	c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+//	scheduler.UseClock(c)
+//	go scheduler.Run(ctx)
+//	c.WaitForTimers(1) // the scheduler waits for the first tick
+//	c.Advance(time.Hour)
+type FakeClock struct {
+	mu      sync.Mutex
+	now     time.Time
+	timers  []*fakeTimer
+	changed chan struct{} // closed and replaced when timers change
+}
+
+var _ clock.Clock = (*FakeClock)(nil)
+
+// NewFakeClock creates a new [FakeClock] showing the given time.
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now, changed: make(chan struct{})}
+}
+
+// Now implements the [clock.Clock] interface.
+func (c *FakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// NewTimer implements the [clock.Clock] interface.
+func (c *FakeClock) NewTimer(d time.Duration) clock.Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, deadline: c.now.Add(d), ch: make(chan time.Time, 1)}
+	if d <= 0 {
+		t.ch <- c.now
+		return t
+	}
+	c.timers = append(c.timers, t)
+	c.notify()
+	return t
+}
+
+// Advance moves the clock forward by d, firing the timers that become due in
+// the order of their deadlines.
+func (c *FakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.set(c.now.Add(d))
+}
+
+// Set moves the clock to the given time, firing the timers that become due.
+// The clock never moves backwards.
+func (c *FakeClock) Set(now time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if now.After(c.now) {
+		c.set(now)
+	}
+}
+
+// Timers returns the number of timers that did not fire yet.
+func (c *FakeClock) Timers() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return len(c.timers)
+}
+
+// WaitForTimers blocks until at least n timers are pending, e.g. until the
+// code under test is waiting on the clock, so that the clock can be advanced
+// without a race.
+func (c *FakeClock) WaitForTimers(n int) {
+	for {
+		c.mu.Lock()
+		pending, changed := len(c.timers), c.changed
+		c.mu.Unlock()
+		if pending >= n {
+			return
+		}
+		<-changed
+	}
+}
+
+// set moves the clock to now and fires the due timers. It must be called with
+// the lock held.
+func (c *FakeClock) set(now time.Time) {
+	sort.SliceStable(c.timers, func(i, j int) bool {
+		return c.timers[i].deadline.Before(c.timers[j].deadline)
+	})
+	i := 0
+	for ; i < len(c.timers) && !c.timers[i].deadline.After(now); i++ {
+		c.timers[i].ch <- c.timers[i].deadline
+	}
+	if i > 0 {
+		c.timers = append(c.timers[:0], c.timers[i:]...)
+		c.notify()
+	}
+	c.now = now
+}
+
+// remove removes the timer, reporting whether it was pending.
+func (c *FakeClock) remove(t *fakeTimer) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for i, p := range c.timers {
+		if p == t {
+			c.timers = append(c.timers[:i], c.timers[i+1:]...)
+			c.notify()
+			return true
+		}
+	}
+	return false
+}
+
+// notify wakes up the goroutines waiting for the timers to change. It must be
+// called with the lock held.
+func (c *FakeClock) notify() {
+	close(c.changed)
+	c.changed = make(chan struct{})
+}
+
+// fakeTimer is a timer of a [FakeClock].
+type fakeTimer struct {
+	clock    *FakeClock
+	deadline time.Time
+	ch       chan time.Time
+}
+
+func (t *fakeTimer) C() <-chan time.Time { return t.ch }
+
+func (t *fakeTimer) Stop() bool { return t.clock.remove(t) }
@@ -0,0 +1,446 @@
+// Package contract implements consumer-driven contract tests between services.
+//
+// The consumer of an api records what it expects from the provider in its own
+// tests: the http and grpc calls it makes together with the responses it
+// relies on, and the bus messages it consumes. The recorded contract is
+// written to a json file, which is shared with the provider, e.g. through the
+// repository of the provider or an artifact of the ci pipeline:
+//
+//	b := contract.New(t, "web", "events")
+//	b.HTTP(contract.Interaction{
+//		Description: "get an event",
+//		Request:     contract.Request{Method: "GET", Path: "/events/1"},
+//		Response:    contract.Response{Status: 200, Body: contract.JSON(Event{ID: "1"})},
+//	})
+//	client := NewEventsClient(b.Server().URL) // the code under test
+//
+// The provider verifies in its tests that it fulfills all contracts of its
+// consumers:
+//
+//	c := contract.Load(t, "testdata/contracts/web-events.json")
+//	contract.VerifyHTTP(t, c, svc.REST())
+//
+// Responses and messages match the contract if they have the shape of the
+// recorded example: objects must have all the recorded fields, and values must
+// have the recorded json types. Additional fields are allowed, so that the
+// provider can evolve the api without breaking its consumers.
+package contract
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Contract holds the expectations of a consumer on a provider.
+type Contract struct {
+	Consumer     string            `json:"consumer"`
+	Provider     string            `json:"provider"`
+	Interactions []Interaction     `json:"interactions,omitempty"`
+	GRPC         []GRPCInteraction `json:"grpc,omitempty"`
+	Messages     []Message         `json:"messages,omitempty"`
+}
+
+// Interaction is an http request of the consumer and the response it expects.
+type Interaction struct {
+	Description string   `json:"description"`
+	Request     Request  `json:"request"`
+	Response    Response `json:"response"`
+}
+
+// Request is an http request of an [Interaction].
+type Request struct {
+	Method string            `json:"method"`
+	Path   string            `json:"path"` // including the query
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// Response is the http response expected in an [Interaction].
+type Response struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"`
+}
+
+// GRPCInteraction is a grpc call of the consumer and the response it expects.
+// The messages are encoded with protojson.
+type GRPCInteraction struct {
+	Description string `json:"description"`
+
+	// Method is the full method name, e.g.
+	// "/events.v1.Events/GetEvent".
+	Method   string          `json:"method"`
+	Request  json.RawMessage `json:"request"`
+	Response json.RawMessage `json:"response,omitempty"`
+
+	// Code is the expected status code, e.g. "NotFound". Empty
+	// means "OK".
+	Code string `json:"code,omitempty"`
+}
+
+// Message is a bus message consumed by the consumer.
+type Message struct {
+	Description string          `json:"description"`
+	Topic       string          `json:"topic"`
+	Payload     json.RawMessage `json:"payload"`
+}
+
+// Builder records the contract of a consumer in its tests.
+type Builder struct {
+	t    testing.TB
+	path string
+
+	mu       sync.Mutex
+	contract Contract
+	used     map[int]bool
+	server   *httptest.Server
+}
+
+// New creates a new [Builder] for the contract between the consumer and the
+// provider. The contract is written to <Dir>/<consumer>-<provider>.json when
+// the test finishes, unless the test failed.
+func New(t testing.TB, consumer, provider string) *Builder {
+	t.Helper()
+	b := &Builder{
+		t:        t,
+		path:     filepath.Join(Dir, consumer+"-"+provider+".json"),
+		contract: Contract{Consumer: consumer, Provider: provider},
+		used:     make(map[int]bool),
+	}
+	t.Cleanup(b.finish)
+	return b
+}
+
+// HTTP records an http interaction. The request is answered by the server
+// returned from [Builder.Server].
+func (b *Builder) HTTP(i Interaction) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.contract.Interactions = append(b.contract.Interactions, i)
+}
+
+// GRPC records a grpc interaction. The messages are encoded with protojson.
+func (b *Builder) GRPC(description, method string, req, resp proto.Message) {
+	b.t.Helper()
+	i := GRPCInteraction{Description: description, Method: method}
+	var err error
+	if i.Request, err = protojson.Marshal(req); err != nil {
+		b.t.Fatalf("contract: encode grpc request: %v", err)
+	}
+	if i.Response, err = protojson.Marshal(resp); err != nil {
+		b.t.Fatalf("contract: encode grpc response: %v", err)
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.contract.GRPC = append(b.contract.GRPC, i)
+}
+
+// Message records a message consumed from the topic. The example is usually
+// the typed event the consumer decodes; it is encoded as json.
+func (b *Builder) Message(description, topic string, example any) {
+	b.t.Helper()
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.contract.Messages = append(b.contract.Messages,
+		Message{Description: description, Topic: topic, Payload: JSON(example)})
+}
+
+// Server returns a server that plays the provider: it answers the recorded
+// http interactions with their responses. Requests that match no interaction
+// fail the test, and so do interactions that were never requested.
+func (b *Builder) Server() *httptest.Server {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.server == nil {
+		b.server = httptest.NewServer(http.HandlerFunc(b.serve))
+		b.t.Cleanup(b.server.Close)
+	}
+	return b.server
+}
+
+// serve answers a request with the response of the matching interaction.
+func (b *Builder) serve(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body) //nolint:errcheck // compared below
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for idx, i := range b.contract.Interactions {
+		if i.Request.Method != r.Method || i.Request.Path != r.URL.RequestURI() {
+			continue
+		}
+		if len(i.Request.Body) > 0 && match(i.Request.Body, body) != nil {
+			continue
+		}
+		b.used[idx] = true
+		for k, v := range i.Response.Header {
+			w.Header().Set(k, v)
+		}
+		if len(i.Response.Body) > 0 && w.Header().Get("Content-Type") == "" {
+			w.Header().Set("Content-Type", "application/json")
+		}
+		w.WriteHeader(i.Response.Status)
+		w.Write(i.Response.Body) //nolint:errcheck,gosec // test server
+		return
+	}
+	b.t.Errorf("contract: unexpected request %s %s", r.Method, r.URL.RequestURI())
+	http.Error(w, "no interaction in contract", http.StatusNotImplemented)
+}
+
+// finish checks that the recorded interactions were used, and writes the
+// contract.
+func (b *Builder) finish() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.server != nil {
+		for idx, i := range b.contract.Interactions {
+			if !b.used[idx] {
+				b.t.Errorf("contract: interaction %q was never requested", i.Description)
+			}
+		}
+	}
+	if b.t.Failed() {
+		return
+	}
+	data, err := json.MarshalIndent(b.contract, "", "  ")
+	if err != nil {
+		b.t.Errorf("contract: encode contract: %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(b.path), 0o755); err != nil { //nolint:gosec // test data
+		b.t.Errorf("contract: create contract dir: %v", err)
+		return
+	}
+	if err := os.WriteFile(b.path, append(data, '\n'), 0o644); err != nil { //nolint:gosec // test data
+		b.t.Errorf("contract: write contract: %v", err)
+	}
+}
+
+// Load reads a contract written by a consumer.
+func Load(t testing.TB, path string) Contract {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("contract: read contract: %v", err)
+	}
+	var c Contract
+	if err := json.Unmarshal(data, &c); err != nil {
+		t.Fatalf("contract: decode contract %s: %v", path, err)
+	}
+	return c
+}
+
+// VerifyHTTP replays the http interactions of the contract against the handler
+// of the provider, and checks that the responses match, each in a subtest.
+func VerifyHTTP(t *testing.T, c Contract, h http.Handler) {
+	t.Helper()
+	for _, i := range c.Interactions {
+		i := i
+		t.Run(c.Consumer+"/"+i.Description, func(t *testing.T) {
+			req := httptest.NewRequest(i.Request.Method, i.Request.Path, bytes.NewReader(i.Request.Body))
+			for k, v := range i.Request.Header {
+				req.Header.Set(k, v)
+			}
+			if len(i.Request.Body) > 0 && req.Header.Get("Content-Type") == "" {
+				req.Header.Set("Content-Type", "application/json")
+			}
+			rec := httptest.NewRecorder()
+			h.ServeHTTP(rec, req)
+
+			if rec.Code != i.Response.Status {
+				t.Errorf("status = %d, want %d (body %q)", rec.Code, i.Response.Status, rec.Body)
+			}
+			for k, v := range i.Response.Header {
+				if got := rec.Header().Get(k); got != v {
+					t.Errorf("header %s = %q, want %q", k, got, v)
+				}
+			}
+			if len(i.Response.Body) > 0 {
+				if err := match(i.Response.Body, rec.Body.Bytes()); err != nil {
+					t.Errorf("body does not match the contract: %v", err)
+				}
+			}
+		})
+	}
+}
+
+// VerifyGRPC replays the grpc interactions of the contract over the connection
+// to the provider, e.g. from [servicetest.StartGRPC], and checks that the
+// responses match, each in a subtest. The messages of every method are created
+// by types, usually with the constructors of the generated types:
+//
+//	contract.VerifyGRPC(t, c, conn, map[string]contract.Types{
+//		"/events.v1.Events/GetEvent": {Request: &pb.GetEventRequest{}, Response: &pb.Event{}},
+//	})
+func VerifyGRPC(t *testing.T, c Contract, conn grpc.ClientConnInterface, types map[string]Types) {
+	t.Helper()
+	for _, i := range c.GRPC {
+		i := i
+		t.Run(c.Consumer+"/"+i.Description, func(t *testing.T) {
+			typ, ok := types[i.Method]
+			if !ok {
+				t.Fatalf("no types for method %s", i.Method)
+			}
+			req := typ.Request.ProtoReflect().New().Interface()
+			resp := typ.Response.ProtoReflect().New().Interface()
+			if err := protojson.Unmarshal(i.Request, req); err != nil {
+				t.Fatalf("decode request: %v", err)
+			}
+
+			err := conn.Invoke(context.Background(), i.Method, req, resp)
+			want := i.Code
+			if want == "" {
+				want = "OK"
+			}
+			if got := status.Code(err).String(); got != want {
+				t.Fatalf("code = %s, want %s (%v)", got, want, err)
+			}
+			if err != nil || len(i.Response) == 0 {
+				return
+			}
+			got, err := protojson.MarshalOptions{EmitUnpopulated: true}.Marshal(resp)
+			if err != nil {
+				t.Fatalf("encode response: %v", err)
+			}
+			if err := match(i.Response, got); err != nil {
+				t.Errorf("response does not match the contract: %v", err)
+			}
+		})
+	}
+}
+
+// Types are the message types of a grpc method, see [VerifyGRPC].
+type Types struct {
+	Request, Response proto.Message
+}
+
+// VerifyMessages checks that the messages published by the provider match the
+// messages of the contract, each in a subtest. The provider builds a message
+// for the topic with produce, usually by running the code that publishes it
+// against a recording bus.
+func VerifyMessages(t *testing.T, c Contract, produce func(topic string) ([]byte, error)) {
+	t.Helper()
+	for _, m := range c.Messages {
+		m := m
+		t.Run(c.Consumer+"/"+m.Description, func(t *testing.T) {
+			got, err := produce(m.Topic)
+			if err != nil {
+				t.Fatalf("produce message for %s: %v", m.Topic, err)
+			}
+			if err := match(m.Payload, got); err != nil {
+				t.Errorf("message on %s does not match the contract: %v", m.Topic, err)
+			}
+		})
+	}
+}
+
+// JSON encodes the value as json, for the bodies of the interactions. It
+// panics if v cannot be encoded.
+func JSON(v any) json.RawMessage {
+	if raw, ok := v.(json.RawMessage); ok {
+		return raw
+	}
+	b, err := json.Marshal(v)
+	if err != nil {
+		panic(fmt.Sprintf("contract: encode json: %v", err))
+	}
+	return b
+}
+
+// Dir is the directory into which the contracts are written.
+var Dir = filepath.Join("testdata", "contracts")
+
+// match checks that got has the shape of the example want.
+func match(want json.RawMessage, got []byte) error {
+	var w, g any
+	if err := json.Unmarshal(want, &w); err != nil {
+		return fmt.Errorf("decode example: %w", err)
+	}
+	if err := json.Unmarshal(got, &g); err != nil {
+		return fmt.Errorf("decode %q: %w", got, err)
+	}
+	return matchValue("$", w, g)
+}
+
+// matchValue checks that got has the shape of want at the given json path.
+func matchValue(path string, want, got any) error {
+	switch w := want.(type) {
+	case map[string]any:
+		g, ok := got.(map[string]any)
+		if !ok {
+			return fmt.Errorf("%s: got %s, want object", path, kind(got))
+		}
+		keys := make([]string, 0, len(w))
+		for k := range w {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		var errs []string
+		for _, k := range keys {
+			gv, ok := g[k]
+			if !ok {
+				errs = append(errs, fmt.Sprintf("%s.%s: missing", path, k))
+				continue
+			}
+			if err := matchValue(path+"."+k, w[k], gv); err != nil {
+				errs = append(errs, err.Error())
+			}
+		}
+		if len(errs) > 0 {
+			return fmt.Errorf("%s", strings.Join(errs, "; "))
+		}
+		return nil
+	case []any:
+		g, ok := got.([]any)
+		if !ok {
+			return fmt.Errorf("%s: got %s, want array", path, kind(got))
+		}
+		if len(w) == 0 {
+			return nil
+		}
+		for i, gv := range g {
+			if err := matchValue(fmt.Sprintf("%s[%d]", path, i), w[0], gv); err != nil {
+				return err
+			}
+		}
+		return nil
+	default:
+		// A null in the example matches any value.
+		if want != nil && kind(want) != kind(got) {
+			return fmt.Errorf("%s: got %s, want %s", path, kind(got), kind(want))
+		}
+		return nil
+	}
+}
+
+// kind returns the json type of the decoded value.
+func kind(v any) string {
+	switch v.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	default:
+		return "object"
+	}
+}
@@ -0,0 +1,124 @@
+package servicetest
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// ErrorResponse describes an expected http error response.
+type ErrorResponse struct {
+	// Status is the status code of the response.
+	Status int
+
+	// Body is a substring of the body, ignored if empty.
+	Body string
+
+	// Header holds headers that the response must carry, e.g.
+	// "Retry-After". Other headers are ignored.
+	Header http.Header
+}
+
+// HTTPErrorCase pairs an error with the response it maps to.
+type HTTPErrorCase struct {
+	Err  error
+	Want ErrorResponse
+}
+
+// AssertHTTPResponse checks that the response matches the expected error
+// response. The body of the response is consumed and closed.
+func AssertHTTPResponse(t testing.TB, resp *http.Response, want ErrorResponse) {
+	t.Helper()
+	defer resp.Body.Close() //nolint:errcheck // intentional
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("servicetest: read the response body: %v", err)
+	}
+
+	if resp.StatusCode != want.Status {
+		t.Errorf("status = %d, want %d (body %q)", resp.StatusCode, want.Status, body)
+	}
+	if !strings.Contains(string(body), want.Body) {
+		t.Errorf("body = %q, want it to contain %q", body, want.Body)
+	}
+	for k, vs := range want.Header {
+		if got := resp.Header.Values(k); !slices.Equal(got, vs) {
+			t.Errorf("header %s = %q, want %q", k, got, vs)
+		}
+	}
+}
+
+// AssertHTTPError checks that writeError, e.g. [service.HTTPError], maps err to
+// the expected response.
+func AssertHTTPError(
+	t testing.TB,
+	writeError func(context.Context, http.ResponseWriter, error),
+	err error,
+	want ErrorResponse,
+) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	writeError(context.Background(), rec, err)
+	AssertHTTPResponse(t, rec.Result(), want)
+}
+
+// AssertHTTPErrors checks every case with [AssertHTTPError] in a subtest. It
+// is meant to lock in the error contract of a service:
+//
+//	servicetest.AssertHTTPErrors(t, httperr.Write, append(
+//		servicetest.HTTPErrors,
+//		servicetest.HTTPErrorCase{Err: auth.ErrUnauthorized, Want: ...},
+//	))
+func AssertHTTPErrors(
+	t *testing.T,
+	writeError func(context.Context, http.ResponseWriter, error),
+	cases []HTTPErrorCase,
+) {
+	t.Helper()
+	for _, c := range cases {
+		c := c
+		t.Run(c.Err.Error(), func(t *testing.T) {
+			AssertHTTPError(t, writeError, fmt.Errorf("%w: test", c.Err), c.Want)
+		})
+	}
+}
+
+// AssertGRPCError checks that err is a grpc status error with the given code,
+// whose message contains msg. An empty msg is not checked.
+func AssertGRPCError(t testing.TB, err error, code codes.Code, msg string) {
+	t.Helper()
+	st, ok := status.FromError(err)
+	if !ok {
+		t.Errorf("error %v is not a grpc status", err)
+		return
+	}
+	if st.Code() != code {
+		t.Errorf("code = %s, want %s (message %q)", st.Code(), code, st.Message())
+	}
+	if !strings.Contains(st.Message(), msg) {
+		t.Errorf("message = %q, want it to contain %q", st.Message(), msg)
+	}
+}
+
+// HTTPErrors is the error contract of [service.HTTPError]. The errors are
+// wrapped before they are mapped, thus the mapping must use [errors.Is].
+var HTTPErrors = []HTTPErrorCase{
+	{context.Canceled, ErrorResponse{Status: service.StatusClientClosedConnection}},
+	{context.DeadlineExceeded, ErrorResponse{Status: http.StatusServiceUnavailable}},
+	{service.ErrBadRequest, ErrorResponse{Status: http.StatusBadRequest, Body: "bad request"}},
+	{service.ErrSpaceFull, ErrorResponse{Status: http.StatusBadRequest}},
+	{service.ErrNotAllowed, ErrorResponse{Status: http.StatusForbidden}},
+	{service.ErrNotFound, ErrorResponse{Status: http.StatusNotFound}},
+	{service.ErrAlreadyExists, ErrorResponse{Status: http.StatusConflict}},
+	{service.ErrUnexpected, ErrorResponse{Status: http.StatusInternalServerError}},
+	{service.ErrTimeOut, ErrorResponse{Status: http.StatusInternalServerError}},
+}
@@ -0,0 +1,25 @@
+package servicetest
+
+import (
+	"context"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/fixtures"
+)
+
+// ReplayFixtures replays the fixtures of the file, e.g. recorded with
+// [fixtures.Record], into the event handlers of the service:
+//
+//	servicetest.ReplayFixtures(t, "testdata/events.created.ndjson", svc.Events())
+func ReplayFixtures(t testing.TB, path string, handlers map[string]service.EventHandler) {
+	t.Helper()
+	fs, err := fixtures.Load(path)
+	if err != nil {
+		t.Fatalf("servicetest: %v", err)
+	}
+	if err := fixtures.Replay(context.Background(), fs, handlers); err != nil {
+		t.Fatalf("servicetest: replay %s: %v", path, err)
+	}
+}
@@ -0,0 +1,172 @@
+package servicetest
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Normalizer replaces the volatile parts of a snapshot, e.g. timestamps and
+// generated ids, so that the snapshot is stable across runs.
+type Normalizer func([]byte) []byte
+
+// Golden compares got with the golden file testdata/<name>.golden. If the test
+// is run with the -update flag, the golden file is written instead. Timestamps
+// and uuids are always normalized, see [ReplaceTimestamps] and [ReplaceUUIDs].
+//
+//	go test ./... -run TestCreateEvent -update
+func Golden(t testing.TB, name string, got []byte, normalize ...Normalizer) {
+	t.Helper()
+	for _, n := range append([]Normalizer{ReplaceTimestamps, ReplaceUUIDs}, normalize...) {
+		got = n(got)
+	}
+
+	path := filepath.Join("testdata", name+".golden")
+	if *update {
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil { //nolint:gosec // test data
+			t.Fatalf("servicetest: create golden dir: %v", err)
+		}
+		if err := os.WriteFile(path, got, 0o644); err != nil { //nolint:gosec // test data
+			t.Fatalf("servicetest: write golden file: %v", err)
+		}
+		return
+	}
+	want, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("servicetest: read golden file, run with -update to create it: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("%s does not match, run with -update if the change is intended\n%s",
+			path, diff(string(want), string(got)))
+	}
+}
+
+// GoldenJSON is like [Golden] for json values. If v is a []byte or
+// [json.RawMessage], e.g. an event payload, it is indented, otherwise it is
+// marshalled. The object keys are sorted, thus the snapshot does not depend on
+// the field order.
+func GoldenJSON(t testing.TB, name string, v any, normalize ...Normalizer) {
+	t.Helper()
+	got, err := indentJSON(v)
+	if err != nil {
+		t.Fatalf("servicetest: encode json snapshot: %v", err)
+	}
+	Golden(t, name, got, normalize...)
+}
+
+// GoldenHTTP is like [Golden] for http responses. The snapshot holds the status,
+// the content type, and the body, which is indented if it is json. The body of
+// the response is consumed and closed.
+func GoldenHTTP(t testing.TB, name string, resp *http.Response, normalize ...Normalizer) {
+	t.Helper()
+	defer resp.Body.Close() //nolint:errcheck // intentional
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatalf("servicetest: read the response body: %v", err)
+	}
+	ct := resp.Header.Get("Content-Type")
+	if strings.Contains(ct, "json") {
+		if indented, err := indentJSON(body); err == nil {
+			body = indented
+		}
+	}
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%d %s\nContent-Type: %s\n\n",
+		resp.StatusCode, http.StatusText(resp.StatusCode), ct)
+	b.Write(body)
+	Golden(t, name, b.Bytes(), normalize...)
+}
+
+// GoldenProto is like [Golden] for protobuf messages, e.g. grpc responses. The
+// message is snapshotted as json.
+func GoldenProto(t testing.TB, name string, m proto.Message, normalize ...Normalizer) {
+	t.Helper()
+	// The output of protojson is deliberately unstable, it is re-indented
+	// to get a stable snapshot.
+	b, err := protojson.Marshal(m)
+	if err != nil {
+		t.Fatalf("servicetest: encode proto snapshot: %v", err)
+	}
+	GoldenJSON(t, name, b, normalize...)
+}
+
+// Replace returns a [Normalizer] replacing the matches of the regular
+// expression with repl, see [regexp.Regexp.ReplaceAll].
+func Replace(expr, repl string) Normalizer {
+	re := regexp.MustCompile(expr)
+	return func(b []byte) []byte { return re.ReplaceAll(b, []byte(repl)) }
+}
+
+// ReplaceTimestamps replaces RFC 3339 timestamps with "<timestamp>".
+func ReplaceTimestamps(b []byte) []byte { return timestampRe.ReplaceAll(b, []byte("<timestamp>")) }
+
+// ReplaceUUIDs replaces uuids with "<uuid>".
+func ReplaceUUIDs(b []byte) []byte { return uuidRe.ReplaceAll(b, []byte("<uuid>")) }
+
+// indentJSON encodes v as indented json with sorted object keys.
+func indentJSON(v any) ([]byte, error) {
+	var raw []byte
+	switch v := v.(type) {
+	case []byte:
+		raw = v
+	case json.RawMessage:
+		raw = v
+	default:
+		var err error
+		if raw, err = json.Marshal(v); err != nil {
+			return nil, err //nolint:wrapcheck // test helper
+		}
+	}
+	// Decoding into any and encoding again sorts the object keys.
+	var decoded any
+	d := json.NewDecoder(bytes.NewReader(raw))
+	d.UseNumber()
+	if err := d.Decode(&decoded); err != nil {
+		return nil, err //nolint:wrapcheck // test helper
+	}
+	b, err := json.MarshalIndent(decoded, "", "  ")
+	if err != nil {
+		return nil, err //nolint:wrapcheck // test helper
+	}
+	return append(b, '\n'), nil
+}
+
+// diff returns the lines of want and got that differ.
+func diff(want, got string) string {
+	wl, gl := strings.Split(want, "\n"), strings.Split(got, "\n")
+	var b strings.Builder
+	for i := 0; i < max(len(wl), len(gl)); i++ {
+		var w, g string
+		if i < len(wl) {
+			w = wl[i]
+		}
+		if i < len(gl) {
+			g = gl[i]
+		}
+		if w != g {
+			fmt.Fprintf(&b, "line %d:\n- %s\n+ %s\n", i+1, w, g)
+		}
+	}
+	return b.String()
+}
+
+var (
+	// update makes [Golden] write the golden files.
+	update = flag.Bool("update", false, "update the golden files")
+
+	timestampRe = regexp.MustCompile(
+		`\d{4}-\d{2}-\d{2}[Tt ]\d{2}:\d{2}:\d{2}(\.\d+)?([Zz]|[+-]\d{2}:\d{2})`)
+	uuidRe = regexp.MustCompile(
+		`[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`)
+)
@@ -0,0 +1,88 @@
+package servicetest
+
+import (
+	"context"
+	"net"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/test/bufconn"
+
+	"github.com/eventscompass/service-template/src/internal/lifecycle"
+)
+
+// StartGRPC initializes the service and serves its grpc server over an
+// in-memory connection, without starting the rest server or subscribing to
+// events. The grpc server is the one returned by the service, thus the calls
+// go through all of its interceptors. When the test finishes, the server is
+// stopped, the context of Init is cancelled, which stops the workers of the
+// service, and the service is shut down if it implements
+// [lifecycle.Shutdowner].
+//
+// The workers started by Init, e.g. the admin server, listen on free local
+// ports like with [Start], thus the tests using StartGRPC must not run in
+// parallel either.
+func StartGRPC(t testing.TB, s service.CloudService) *grpc.ClientConn {
+	t.Helper()
+	t.Setenv(EnvPrefix+"ADMIN_SERVER_LISTEN", freeAddr(t))
+	t.Setenv(EnvPrefix+"STREAM_SERVER_LISTEN", freeAddr(t))
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(func() {
+		cancel()
+		if err := lifecycle.Shutdown(s, ReadyTimeout); err != nil {
+			t.Errorf("servicetest: shut down the service: %v", err)
+		}
+	})
+	if err := s.Init(ctx); err != nil {
+		t.Fatalf("servicetest: init the service: %v", err)
+	}
+	srv := s.GRPC()
+	if srv == nil {
+		t.Fatal("servicetest: the service does not serve grpc requests")
+	}
+	return ServeGRPC(t, srv)
+}
+
+// ServeGRPC serves the grpc server over an in-memory connection and returns a
+// client connection to it. The server is stopped when the test finishes.
+func ServeGRPC(t testing.TB, srv *grpc.Server, opts ...grpc.DialOption) *grpc.ClientConn {
+	t.Helper()
+	lis := bufconn.Listen(bufferSize)
+	served := make(chan struct{})
+	go func() {
+		defer close(served)
+		srv.Serve(lis) //nolint:errcheck,gosec // returns once the server is stopped
+	}()
+	t.Cleanup(func() {
+		srv.Stop()
+		<-served
+	})
+
+	conn, err := DialBuffer(context.Background(), lis, opts...)
+	if err != nil {
+		t.Fatalf("servicetest: dial grpc server: %v", err)
+	}
+	t.Cleanup(func() { conn.Close() }) //nolint:errcheck,gosec // test teardown
+	return conn
+}
+
+// DialBuffer dials a grpc server served over the in-memory listener. The
+// connection is insecure unless the options provide credentials.
+func DialBuffer(
+	ctx context.Context,
+	lis *bufconn.Listener,
+	opts ...grpc.DialOption,
+) (*grpc.ClientConn, error) {
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	}, opts...)
+	return grpc.DialContext(ctx, "passthrough:///bufconn", opts...) //nolint:wrapcheck // test helper
+}
+
+// bufferSize is the size of the in-memory connection buffers.
+const bufferSize = 1 << 20
@@ -0,0 +1,162 @@
+package servicetest
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Op is a single operation driven by [Load] or [Bench], e.g. an http request or
+// the handling of an event. The argument is the number of the operation.
+type Op func(i int) error
+
+// LoadConfig configures a load test.
+type LoadConfig struct {
+	// Concurrency is the number of goroutines running the
+	// operations. Defaults to GOMAXPROCS.
+	Concurrency int
+
+	// Ops is the number of operations to run.
+	Ops int
+}
+
+// LoadResult reports the outcome of a load test.
+type LoadResult struct {
+	Ops      int
+	Errors   int
+	Duration time.Duration
+
+	// Throughput is the number of operations per second.
+	Throughput float64
+
+	P50, P90, P99, Max time.Duration
+
+	// AllocsPerOp and BytesPerOp are the heap allocations per
+	// operation, including those of the load test itself.
+	AllocsPerOp float64
+	BytesPerOp  float64
+}
+
+// String implements the [fmt.Stringer] interface.
+func (r LoadResult) String() string {
+	return fmt.Sprintf(
+		"%d ops (%d errors) in %v: %.0f ops/s, p50 %v, p90 %v, p99 %v, max %v, %.1f allocs/op, %.0f B/op",
+		r.Ops, r.Errors, r.Duration, r.Throughput,
+		r.P50, r.P90, r.P99, r.Max,
+		r.AllocsPerOp, r.BytesPerOp)
+}
+
+// Load runs the operations at the configured concurrency and measures their
+// latencies, e.g. to compare the performance of two versions of a handler.
+func Load(cfg LoadConfig, op Op) LoadResult { return load(cfg, op, func() {}) }
+
+// load runs the load test, calling started right before the first operation.
+func load(cfg LoadConfig, op Op, started func()) LoadResult {
+	conc := cfg.Concurrency
+	if conc <= 0 {
+		conc = runtime.GOMAXPROCS(0)
+	}
+	latencies := make([]time.Duration, cfg.Ops)
+	var next, errs atomic.Int64
+
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	started()
+	start := time.Now()
+
+	var wg sync.WaitGroup
+	for w := 0; w < conc; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := int(next.Add(1) - 1)
+				if i >= cfg.Ops {
+					return
+				}
+				opStart := time.Now()
+				if err := op(i); err != nil {
+					errs.Add(1)
+				}
+				latencies[i] = time.Since(opStart)
+			}
+		}()
+	}
+	wg.Wait()
+
+	elapsed := time.Since(start)
+	runtime.ReadMemStats(&after)
+	res := LoadResult{Ops: cfg.Ops, Errors: int(errs.Load()), Duration: elapsed}
+	if cfg.Ops == 0 {
+		return res
+	}
+	res.Throughput = float64(cfg.Ops) / elapsed.Seconds()
+	res.AllocsPerOp = float64(after.Mallocs-before.Mallocs) / float64(cfg.Ops)
+	res.BytesPerOp = float64(after.TotalAlloc-before.TotalAlloc) / float64(cfg.Ops)
+	sort.Slice(latencies, func(i, j int) bool { return latencies[i] < latencies[j] })
+	res.P50 = percentile(latencies, 0.5)
+	res.P90 = percentile(latencies, 0.9)
+	res.P99 = percentile(latencies, 0.99)
+	res.Max = latencies[len(latencies)-1]
+	return res
+}
+
+// Bench runs b.N operations at the given concurrency, and reports the latency
+// percentiles and the throughput next to the standard benchmark metrics:
+//
+//	func BenchmarkCreateEvent(b *testing.B) {
+//		servicetest.Bench(b, 16, servicetest.HTTPOp(handler, newRequest))
+//	}
+//
+// Zero concurrency defaults to GOMAXPROCS. Failed operations fail the
+// benchmark.
+func Bench(b *testing.B, concurrency int, op Op) {
+	b.Helper()
+	b.ReportAllocs()
+	res := load(LoadConfig{Concurrency: concurrency, Ops: b.N}, op, b.ResetTimer)
+	b.StopTimer()
+	if res.Errors > 0 {
+		b.Errorf("%d of %d operations failed", res.Errors, res.Ops)
+	}
+	b.ReportMetric(res.Throughput, "ops/s")
+	b.ReportMetric(float64(res.P50.Nanoseconds()), "p50-ns")
+	b.ReportMetric(float64(res.P99.Nanoseconds()), "p99-ns")
+}
+
+// HTTPOp returns an operation serving the request built by newRequest with the
+// handler. Responses with a 5xx status count as errors.
+func HTTPOp(h http.Handler, newRequest func(i int) *http.Request) Op {
+	return func(i int) error {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newRequest(i))
+		if rec.Code >= http.StatusInternalServerError {
+			return fmt.Errorf("status %d", rec.Code)
+		}
+		return nil
+	}
+}
+
+// EventOp returns an operation handling the message built by newMessage with
+// the event handler. Event handlers cannot fail, thus the operation never
+// returns an error.
+func EventOp(h service.EventHandler, newMessage func(i int) []byte) Op {
+	return func(i int) error {
+		h(context.Background(), newMessage(i))
+		return nil
+	}
+}
+
+// percentile returns the q-th percentile of the sorted latencies.
+func percentile(sorted []time.Duration, q float64) time.Duration {
+	return sorted[min(int(q*float64(len(sorted))), len(sorted)-1)]
+}
@@ -0,0 +1,228 @@
+// Package servicetest runs a [service.CloudService] in-process for end-to-end
+// tests.
+//
+// The service goes through the real lifecycle.Run path: it is initialized,
+// its servers listen on ephemeral ports, and once it is ready it is served
+// until the test finishes, exactly like in production. It is then stopped by
+// cancelling its context, and shut down.
+//
+//	func TestCreateEvent(t *testing.T) {
+//		svc := servicetest.Start(t, &ServiceName{})
+//		resp, err := svc.HTTP.Post(svc.URL("/events"), "application/json", body)
+//		...
+//	}
+//
+// Every service started has an admin server and readiness checks of its own,
+// thus a test may start several services, one after another or side by side.
+// As the listeners of the service are configured with environment variables,
+// the tests using [Start] must not run in parallel. The grpc handlers can also
+// be tested in memory, see [StartGRPC].
+package servicetest
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+
+	"github.com/eventscompass/service-template/src/internal/lifecycle"
+	"github.com/eventscompass/service-template/src/internal/middleware"
+)
+
+// Service is a service running in-process.
+type Service struct {
+	// Addr is the address of the rest server, empty if the
+	// service does not serve http requests.
+	Addr string
+
+	// HTTP is a client for the rest server.
+	HTTP *http.Client
+
+	// GRPCAddr is the address of the grpc server, empty if the
+	// service does not serve grpc requests.
+	GRPCAddr string
+
+	// GRPC is a client connection to the grpc server, nil if the
+	// service does not serve grpc requests. Wrap it with the
+	// generated clients, see [Client].
+	GRPC *grpc.ClientConn
+
+	// AdminAddr is the address of the admin server.
+	AdminAddr string
+}
+
+// Start starts the service with lifecycle.Run, and waits until it is ready,
+// i.e. its servers accept connections and the /readyz endpoint of its admin
+// server reports it ready. The rest handler is wrapped with the middleware
+// stack of the service, like [lifecycle.Start] does. Every listener of the
+// service, i.e. the rest, grpc, admin and streaming servers, listens on a free
+// local port. The service is stopped when the test finishes, and then shut
+// down if it implements [lifecycle.Shutdowner]. The test fails if the service
+// cannot be initialized, does not become ready within [ReadyTimeout], or
+// fails while it is served.
+func Start(t testing.TB, s service.CloudService) *Service {
+	t.Helper()
+	svc := &Service{HTTP: &http.Client{Timeout: ReadyTimeout}, AdminAddr: freeAddr(t)}
+	httpAddr, grpcAddr := freeAddr(t), freeAddr(t)
+	t.Setenv("HTTP_SERVER_LISTEN", httpAddr)
+	t.Setenv("GRPC_SERVER_LISTEN", grpcAddr)
+	t.Setenv(EnvPrefix+"ADMIN_SERVER_LISTEN", svc.AdminAddr)
+	t.Setenv(EnvPrefix+"STREAM_SERVER_LISTEN", freeAddr(t))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	rec := &recorder{CloudService: middleware.Apply(s), started: make(chan struct{})}
+	done := make(chan struct{})
+	var runErr error
+	go func() {
+		defer close(done)
+		runErr = lifecycle.Run(ctx, rec)
+		if err := lifecycle.Shutdown(s, ReadyTimeout); err != nil {
+			t.Errorf("servicetest: shut down the service: %v", err)
+		}
+	}()
+	t.Cleanup(func() {
+		cancel()
+		select {
+		case <-done:
+			if runErr != nil {
+				t.Errorf("servicetest: the service failed: %v", runErr)
+			}
+		case <-time.After(ReadyTimeout):
+			t.Error("servicetest: the service did not stop in time")
+		}
+	})
+
+	select {
+	case <-rec.started:
+	case <-done:
+		t.Fatalf("servicetest: the service stopped during start up: %v", runErr)
+	case <-time.After(ReadyTimeout):
+		t.Fatal("servicetest: the service did not start in time")
+	}
+
+	if rec.rest {
+		svc.Addr = httpAddr
+		waitListening(t, httpAddr, done)
+	}
+	if rec.grpc {
+		svc.GRPCAddr = grpcAddr
+		waitListening(t, grpcAddr, done)
+		conn, err := grpc.Dial(grpcAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+		if err != nil {
+			t.Fatalf("servicetest: dial grpc server: %v", err)
+		}
+		t.Cleanup(func() { conn.Close() }) //nolint:errcheck,gosec // test teardown
+		svc.GRPC = conn
+	}
+	waitReady(t, svc, done)
+	return svc
+}
+
+// URL returns the url of the given path on the rest server.
+func (s *Service) URL(path string) string { return "http://" + s.Addr + path }
+
+// Client wraps the grpc connection of the service with a generated client,
+// e.g.
+//
+//	events := servicetest.Client(svc, pb.NewEventsClient)
+func Client[T any](s *Service, newClient func(grpc.ClientConnInterface) T) T {
+	return newClient(s.GRPC)
+}
+
+// ReadyTimeout is how long [Start] waits for the service to become ready.
+var ReadyTimeout = 10 * time.Second
+
+// recorder records which servers the service runs. [service.Start] asks for
+// the servers after the service was initialized.
+type recorder struct {
+	service.CloudService
+
+	once       sync.Once
+	started    chan struct{}
+	rest, grpc bool
+}
+
+func (r *recorder) REST() http.Handler {
+	h := r.CloudService.REST()
+	r.rest = h != nil
+	return h
+}
+
+func (r *recorder) GRPC() *grpc.Server {
+	srv := r.CloudService.GRPC()
+	r.grpc = srv != nil
+	r.once.Do(func() { close(r.started) })
+	return srv
+}
+
+// freeAddr returns a free local address.
+func freeAddr(t testing.TB) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("servicetest: find a free port: %v", err)
+	}
+	defer lis.Close() //nolint:errcheck // intentional
+	return lis.Addr().String()
+}
+
+// waitListening waits until the address accepts connections.
+func waitListening(t testing.TB, addr string, done <-chan struct{}) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), ReadyTimeout)
+	defer cancel()
+	var d net.Dialer
+	for {
+		conn, err := d.DialContext(ctx, "tcp", addr)
+		if err == nil {
+			conn.Close() //nolint:errcheck,gosec // probe connection
+			return
+		}
+		select {
+		case <-done:
+			t.Fatal("servicetest: the service stopped during start up, see the logs")
+		case <-ctx.Done():
+			t.Fatalf("servicetest: %s is not listening: %v", addr, err)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// waitReady waits until the /readyz endpoint of the admin server reports the
+// service ready.
+func waitReady(t testing.TB, svc *Service, done <-chan struct{}) {
+	t.Helper()
+	timeout := time.After(ReadyTimeout)
+	status := "no response"
+	for {
+		resp, err := svc.HTTP.Get("http://" + svc.AdminAddr + "/readyz")
+		if err == nil {
+			resp.Body.Close() //nolint:errcheck,gosec // probe response
+			if resp.StatusCode == http.StatusOK {
+				return
+			}
+			status = resp.Status
+		}
+		select {
+		case <-done:
+			t.Fatal("servicetest: the service stopped during start up, see the logs")
+		case <-timeout:
+			t.Fatalf("servicetest: the service is not ready: %s", status)
+		case <-time.After(pollInterval):
+		}
+	}
+}
+
+// EnvPrefix prefixes the environment variables of the listeners of the
+// service, other than the ones of the framework, see envPrefix in
+// src/config.go. It is set by newservice.
+var EnvPrefix = ""
+
+// pollInterval is the interval at which the readiness is checked.
+const pollInterval = 10 * time.Millisecond
@@ -0,0 +1,267 @@
+// Package session keeps login sessions and other state of browser-facing
+// services in cookies.
+//
+// Cookies are encrypted and authenticated with the keys of an
+// [encryption.Keyring], thus the client can neither read nor modify them. The
+// expiry is stored inside the cookie and enforced by the service, independent
+// of the expiry that the browser enforces. Keys can be rotated: cookies
+// encrypted with an old key are still accepted and re-issued with the primary
+// key.
+package session
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/encryption"
+)
+
+// Config encapsulates the configuration for the session cookies.
+type Config struct {
+	// Keys and PrimaryKey configure the keys protecting the
+	// cookies, in the format of [encryption.Config].
+	Keys       []string `env:"SESSION_KEYS,notEmpty"`
+	PrimaryKey string   `env:"SESSION_PRIMARY_KEY,notEmpty"`
+
+	// CookieName is the name of the session cookie.
+	CookieName string `env:"SESSION_COOKIE_NAME" envDefault:"session"`
+
+	// MaxAge is the lifetime of a session.
+	MaxAge time.Duration `env:"SESSION_MAX_AGE" envDefault:"24h"`
+
+	// SameSite is the SameSite attribute of the cookies, one of
+	// "lax", "strict" or "none".
+	SameSite string `env:"SESSION_SAME_SITE" envDefault:"lax"`
+
+	// Secure restricts the cookies to https. It should only be
+	// disabled for local development.
+	Secure bool `env:"SESSION_COOKIE_SECURE" envDefault:"true"`
+
+	// Domain is the domain attribute of the cookies. If empty,
+	// the cookies are sent only to the host that set them.
+	Domain string `env:"SESSION_COOKIE_DOMAIN"`
+}
+
+// Session is the state of a browser session.
+type Session struct {
+	// ID uniquely identifies the session, e.g. in logs.
+	ID string `json:"id"`
+
+	// Values are the values stored in the session. Keep them
+	// small, browsers limit the size of cookies to 4KB.
+	Values map[string]string `json:"values,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Manager reads and writes session cookies.
+type Manager struct {
+	cfg      Config
+	cookies  *Cookies
+	sameSite http.SameSite
+	clock    clock.Clock
+}
+
+// NewManager creates a new [Manager]. This function returns
+// [service.ErrBadRequest] in case the configuration is invalid.
+func NewManager(cfg Config) (*Manager, error) {
+	keys, err := encryption.NewKeyring(encryption.Config{Keys: cfg.Keys, PrimaryKey: cfg.PrimaryKey})
+	if err != nil {
+		return nil, fmt.Errorf("session keys: %w", err)
+	}
+	sameSite, ok := sameSiteModes[strings.ToLower(cfg.SameSite)]
+	if !ok {
+		return nil, fmt.Errorf("%w: invalid SameSite mode %q", service.ErrBadRequest, cfg.SameSite)
+	}
+	if sameSite == http.SameSiteNoneMode && !cfg.Secure {
+		return nil, fmt.Errorf("%w: SameSite=None requires secure cookies", service.ErrBadRequest)
+	}
+	return &Manager{cfg: cfg, cookies: NewCookies(keys), sameSite: sameSite, clock: clock.Real}, nil
+}
+
+// UseClock makes the manager use the given clock for the expiry of the
+// sessions, e.g. a fake clock in tests. UseClock must be called before the
+// manager is used.
+func (m *Manager) UseClock(c clock.Clock) {
+	m.clock = clock.Or(c)
+}
+
+// New creates a new session. The session is sent to the client with
+// [Manager.Save]. A new session must be created on login, so that a session
+// id set before the login cannot be reused.
+func (m *Manager) New() (*Session, error) {
+	id, err := randomID()
+	if err != nil {
+		return nil, err
+	}
+	now := m.clock.Now()
+	return &Session{
+		ID:        id,
+		Values:    make(map[string]string),
+		CreatedAt: now,
+		ExpiresAt: now.Add(m.cfg.MaxAge),
+	}, nil
+}
+
+// Load returns the session of the request. Cookies encrypted with an old key
+// are re-issued with the primary key. This function returns
+// [service.ErrNotFound] in case the request has no valid session.
+func (m *Manager) Load(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	c, err := r.Cookie(m.cfg.CookieName)
+	if err != nil {
+		return nil, fmt.Errorf("%w: no session", service.ErrNotFound)
+	}
+	var s Session
+	rotated, err := m.cookies.Decode(m.cfg.CookieName, c.Value, &s)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid session: %v", service.ErrNotFound, err)
+	}
+	if m.clock.Now().After(s.ExpiresAt) {
+		return nil, fmt.Errorf("%w: session expired", service.ErrNotFound)
+	}
+	if rotated {
+		if err := m.Save(w, &s); err != nil {
+			slog.Warn("failed to re-issue session cookie", slog.String("error", err.Error()))
+		}
+	}
+	return &s, nil
+}
+
+// Save sends the session to the client. It must be called before the response
+// body is written.
+func (m *Manager) Save(w http.ResponseWriter, s *Session) error {
+	value, err := m.cookies.Encode(m.cfg.CookieName, s)
+	if err != nil {
+		return err
+	}
+	if len(value) > maxCookieSize {
+		return fmt.Errorf("%w: session too large", service.ErrSpaceFull)
+	}
+	http.SetCookie(w, m.cookie(value, s.ExpiresAt))
+	return nil
+}
+
+// Destroy removes the session cookie from the client, e.g. on logout.
+func (m *Manager) Destroy(w http.ResponseWriter) {
+	c := m.cookie("", time.Time{})
+	c.MaxAge = -1
+	http.SetCookie(w, c)
+}
+
+// Middleware returns an http middleware that loads the session of every
+// request into the request context. Requests without a valid session are
+// passed on without session.
+func (m *Manager) Middleware() func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if s, err := m.Load(w, r); err == nil {
+				r = r.WithContext(NewContext(r.Context(), s))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Cookies encrypts and authenticates the values of cookies.
+type Cookies struct {
+	keys *encryption.Keyring
+}
+
+// NewCookies creates a new [Cookies] protecting the values with the keys.
+func NewCookies(keys *encryption.Keyring) *Cookies {
+	return &Cookies{keys: keys}
+}
+
+// Encode returns the protected value of the cookie with the given name. The
+// name is authenticated as well, so that values cannot be moved between
+// cookies.
+func (c *Cookies) Encode(name string, v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", fmt.Errorf("%w: encode cookie: %v", service.ErrUnexpected, err)
+	}
+	return c.keys.Encrypt(b, []byte(name)) //nolint:wrapcheck // documented errors
+}
+
+// Decode decodes the protected value of the cookie with the given name into v,
+// and reports whether the value should be re-issued because it was encrypted
+// with an old key. This function returns [service.ErrBadRequest] in case the
+// value was tampered with, and [service.ErrNotFound] in case its key is no
+// longer configured.
+func (c *Cookies) Decode(name, value string, v any) (bool, error) {
+	b, err := c.keys.Decrypt(value, []byte(name))
+	if err != nil {
+		return false, err //nolint:wrapcheck // documented errors
+	}
+	if err := json.Unmarshal(b, v); err != nil {
+		return false, fmt.Errorf("%w: decode cookie: %v", service.ErrBadRequest, err)
+	}
+	return c.keys.NeedsRotation(value), nil
+}
+
+// FromContext returns the session carried by ctx, see [NewContext].
+func FromContext(ctx context.Context) (*Session, bool) {
+	s, ok := ctx.Value(sessionKey{}).(*Session)
+	return s, ok && s != nil
+}
+
+// NewContext returns a copy of ctx carrying the session.
+func NewContext(ctx context.Context, s *Session) context.Context {
+	return context.WithValue(ctx, sessionKey{}, s)
+}
+
+// cookie returns the session cookie with the given value.
+func (m *Manager) cookie(value string, expires time.Time) *http.Cookie {
+	c := &http.Cookie{
+		Name:     m.cfg.CookieName,
+		Value:    value,
+		Path:     "/",
+		Domain:   m.cfg.Domain,
+		Secure:   m.cfg.Secure,
+		HttpOnly: true,
+		SameSite: m.sameSite,
+	}
+	if !expires.IsZero() {
+		c.Expires = expires
+		c.MaxAge = int(clock.Until(m.clock, expires).Seconds())
+	}
+	return c
+}
+
+// randomID returns a new random session id.
+func randomID() (string, error) {
+	b := make([]byte, idLen)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w: generate session id: %v", service.ErrUnexpected, err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// sessionKey is the context key of the session.
+type sessionKey struct{}
+
+const (
+	// idLen is the number of random bytes of a session id.
+	idLen = 16
+
+	// maxCookieSize is the maximum size of a cookie value accepted by all
+	// major browsers, leaving room for the attributes.
+	maxCookieSize = 3800
+)
+
+var sameSiteModes = map[string]http.SameSite{
+	"lax":    http.SameSiteLaxMode,
+	"strict": http.SameSiteStrictMode,
+	"none":   http.SameSiteNoneMode,
+}
@@ -0,0 +1,250 @@
+package session
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+var (
+	key1 = "k1:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("1", 32)))
+	key2 = "k2:" + base64.StdEncoding.EncodeToString([]byte(strings.Repeat("2", 32)))
+)
+
+func TestNewManager(t *testing.T) {
+	tests := []struct {
+		name    string
+		cfg     Config
+		wantErr error
+	}{
+		{"valid", Config{Keys: []string{key1}, PrimaryKey: "k1", SameSite: "lax"}, nil},
+		{"unknown primary key", Config{Keys: []string{key1}, PrimaryKey: "k2", SameSite: "lax"}, service.ErrBadRequest},
+		{"invalid key", Config{Keys: []string{"k1:short"}, PrimaryKey: "k1", SameSite: "lax"}, service.ErrBadRequest},
+		{"invalid SameSite", Config{Keys: []string{key1}, PrimaryKey: "k1", SameSite: "loose"}, service.ErrBadRequest},
+		{"SameSite none without secure", Config{Keys: []string{key1}, PrimaryKey: "k1", SameSite: "none"}, service.ErrBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewManager(tt.cfg); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestManagerLoad(t *testing.T) {
+	tests := []struct {
+		name string
+		// cookie returns the cookie sent by the client.
+		cookie      func(t *testing.T, m *Manager, c *servicetest.FakeClock) *http.Cookie
+		loadKeys    []string
+		loadPrimary string
+		wantErr     error
+		wantReissue bool
+	}{
+		{
+			name:   "valid",
+			cookie: issue,
+		},
+		{
+			name: "within the max age",
+			cookie: func(t *testing.T, m *Manager, c *servicetest.FakeClock) *http.Cookie {
+				cookie := issue(t, m, c)
+				c.Advance(time.Hour - time.Second)
+				return cookie
+			},
+		},
+		{
+			name: "expired",
+			cookie: func(t *testing.T, m *Manager, c *servicetest.FakeClock) *http.Cookie {
+				cookie := issue(t, m, c)
+				c.Advance(time.Hour + time.Second)
+				return cookie
+			},
+			wantErr: service.ErrNotFound,
+		},
+		{
+			name: "missing",
+			cookie: func(*testing.T, *Manager, *servicetest.FakeClock) *http.Cookie {
+				return nil
+			},
+			wantErr: service.ErrNotFound,
+		},
+		{
+			name: "tampered",
+			cookie: func(t *testing.T, m *Manager, c *servicetest.FakeClock) *http.Cookie {
+				cookie := issue(t, m, c)
+				b := []byte(cookie.Value)
+				b[len(b)-2] ^= 1
+				cookie.Value = string(b)
+				return cookie
+			},
+			wantErr: service.ErrNotFound,
+		},
+		{
+			name: "moved from another cookie",
+			cookie: func(t *testing.T, m *Manager, _ *servicetest.FakeClock) *http.Cookie {
+				value, err := m.cookies.Encode("other", Session{ID: "x", ExpiresAt: time.Now().Add(time.Hour)})
+				if err != nil {
+					t.Fatalf("encode: %v", err)
+				}
+				return &http.Cookie{Name: "session", Value: value}
+			},
+			wantErr: service.ErrNotFound,
+		},
+		{
+			name:        "old key is re-issued",
+			cookie:      issue,
+			loadKeys:    []string{key1, key2},
+			loadPrimary: "k2",
+			wantReissue: true,
+		},
+		{
+			name:        "removed key",
+			cookie:      issue,
+			loadKeys:    []string{key2},
+			loadPrimary: "k2",
+			wantErr:     service.ErrNotFound,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			m := newManager(t, c, []string{key1}, "k1")
+			cookie := tt.cookie(t, m, c)
+
+			if tt.loadKeys != nil {
+				m = newManager(t, c, tt.loadKeys, tt.loadPrimary)
+			}
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if cookie != nil {
+				req.AddCookie(cookie)
+			}
+			rec := httptest.NewRecorder()
+			s, err := m.Load(rec, req)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && s.Values["user"] != "user-1" {
+				t.Errorf("got values %v, want the user", s.Values)
+			}
+			if got := len(rec.Result().Cookies()) == 1; got != tt.wantReissue {
+				t.Errorf("got re-issued %v, want %v", got, tt.wantReissue)
+			}
+		})
+	}
+}
+
+func TestManagerSave(t *testing.T) {
+	tests := []struct {
+		name       string
+		value      string
+		advance    time.Duration
+		wantMaxAge int
+		wantErr    error
+	}{
+		{"new session", "v", 0, 3600, nil},
+		{"aged session", "v", 15 * time.Minute, 2700, nil},
+		{"too large", strings.Repeat("v", maxCookieSize), 0, 0, service.ErrSpaceFull},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+			m := newManager(t, c, []string{key1}, "k1")
+			s, err := m.New()
+			if err != nil {
+				t.Fatalf("new session: %v", err)
+			}
+			s.Values["v"] = tt.value
+			c.Advance(tt.advance)
+
+			rec := httptest.NewRecorder()
+			if err := m.Save(rec, s); !errors.Is(err, tt.wantErr) {
+				t.Fatalf("got error %v, want %v", err, tt.wantErr)
+			}
+			if tt.wantErr != nil {
+				return
+			}
+			cookie := rec.Result().Cookies()[0]
+			if cookie.MaxAge != tt.wantMaxAge || !cookie.HttpOnly || !cookie.Secure {
+				t.Errorf("got cookie %+v, want a secure http-only cookie with max age %d", cookie, tt.wantMaxAge)
+			}
+		})
+	}
+}
+
+func TestManagerMiddleware(t *testing.T) {
+	c := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	m := newManager(t, c, []string{key1}, "k1")
+	cookie := issue(t, m, c)
+
+	tests := []struct {
+		name   string
+		cookie *http.Cookie
+		want   bool
+	}{
+		{"with session", cookie, true},
+		{"without session", nil, false},
+		{"invalid session", &http.Cookie{Name: "session", Value: "garbage"}, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var got bool
+			h := m.Middleware()(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				_, got = FromContext(r.Context())
+			}))
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.cookie != nil {
+				req.AddCookie(tt.cookie)
+			}
+			h.ServeHTTP(httptest.NewRecorder(), req)
+			if got != tt.want {
+				t.Errorf("got session %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func newManager(t *testing.T, c *servicetest.FakeClock, keys []string, primary string) *Manager {
+	t.Helper()
+	m, err := NewManager(Config{
+		Keys:       keys,
+		PrimaryKey: primary,
+		CookieName: "session",
+		MaxAge:     time.Hour,
+		SameSite:   "lax",
+		Secure:     true,
+	})
+	if err != nil {
+		t.Fatalf("create manager: %v", err)
+	}
+	m.UseClock(c)
+	return m
+}
+
+// issue returns the cookie of a new session of the user.
+func issue(t *testing.T, m *Manager, _ *servicetest.FakeClock) *http.Cookie {
+	t.Helper()
+	s, err := m.New()
+	if err != nil {
+		t.Fatalf("new session: %v", err)
+	}
+	s.Values["user"] = "user-1"
+	rec := httptest.NewRecorder()
+	if err := m.Save(rec, s); err != nil {
+		t.Fatalf("save session: %v", err)
+	}
+	return rec.Result().Cookies()[0]
+}
@@ -0,0 +1,273 @@
+// Package spiffe provides the workload identity of the service as SPIFFE
+// X.509 SVIDs, for mTLS between services without distributing certificates by
+// hand. https://spiffe.io/docs/latest/spiffe-about/spiffe-concepts/
+//
+// A [Source] fetches the SVID of the service and the trust bundles from the
+// Workload API of the local agent, e.g. SPIRE, and keeps them up to date as
+// the agent rotates them. The tls configurations built from a source, see
+// [ServerTLSConfig] and [ClientTLSConfig], always present the current SVID and
+// authorize the peer by its SPIFFE ID, see [Authorizer]:
+//
+//	src := spiffe.NewSource(cfg.SPIFFE)
+//	srv := grpc.NewServer(spiffe.ServerOption(src, spiffe.AuthorizeMemberOf("example.org")))
+//	conn, err := client.DialGRPC(ctx, "payments", target, cfg.Payments,
+//		spiffe.DialOption(src, spiffe.AuthorizeID("spiffe://example.org/payments")))
+//
+// The source is run as a background worker, see [Source.Worker]. Handshakes
+// fail until the first SVID arrives.
+package spiffe
+
+import (
+	"context"
+	"crypto"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/eventscompass/service-template/src/internal/spiffe/workloadpb"
+	"github.com/eventscompass/service-template/src/internal/workers"
+)
+
+// Config encapsulates the configuration for the workload identity.
+type Config struct {
+	// EndpointSocket is the address of the Workload API, as set by
+	// the agent, e.g. "unix:///run/spire/sockets/agent.sock".
+	EndpointSocket string `env:"SPIFFE_ENDPOINT_SOCKET" envDefault:"unix:///tmp/spire-agent/public/api.sock"`
+}
+
+// SVID is an X.509 SVID of the service.
+type SVID struct {
+	// ID is the SPIFFE ID, e.g. "spiffe://example.org/payments".
+	ID string
+
+	// Certificate holds the certificate chain and private key.
+	Certificate tls.Certificate
+
+	// Expires is the expiry of the leaf certificate.
+	Expires time.Time
+}
+
+// Source keeps the current SVID of the service and the trust bundles, as
+// fetched from the Workload API.
+type Source struct {
+	cfg   Config
+	state atomic.Pointer[state]
+
+	mu    sync.Mutex
+	ready chan struct{}
+}
+
+// state is a snapshot of the identity of the service.
+type state struct {
+	svid    SVID
+	bundles map[string]*x509.CertPool // by trust domain
+}
+
+// NewSource creates a new [Source]. The identity is fetched once the source
+// runs, see [Source.Run].
+func NewSource(cfg Config) *Source {
+	return &Source{cfg: cfg, ready: make(chan struct{})}
+}
+
+// SVID returns the current SVID of the service. This function returns
+// [service.ErrNotFound] in case no SVID was fetched yet.
+func (s *Source) SVID() (SVID, error) {
+	st := s.state.Load()
+	if st == nil {
+		return SVID{}, fmt.Errorf("%w: no svid fetched yet", service.ErrNotFound)
+	}
+	return st.svid, nil
+}
+
+// Ready returns a channel that is closed once the first SVID is fetched.
+func (s *Source) Ready() <-chan struct{} { return s.ready }
+
+// Run streams the identity of the service from the Workload API until ctx is
+// cancelled. This is a blocking function. The stream is opened again if it
+// breaks, e.g. while the agent restarts. This function returns
+// [service.ErrBadRequest] in case the endpoint socket is malformed.
+func (s *Source) Run(ctx context.Context) error {
+	target, err := dialTarget(s.cfg.EndpointSocket)
+	if err != nil {
+		return err
+	}
+	creds := grpc.WithTransportCredentials(insecure.NewCredentials())
+	conn, err := grpc.DialContext(ctx, target, creds)
+	if err != nil {
+		return fmt.Errorf("%w: dial workload api: %v", service.ErrUnexpected, err)
+	}
+	defer conn.Close() //nolint:errcheck // intentional
+
+	// The Workload API rejects requests without this header, which
+	// proves that the caller is not a proxied remote client.
+	ctx = metadata.AppendToOutgoingContext(ctx, "workload.spiffe.io", "true")
+	for {
+		err := s.watch(ctx, conn)
+		if ctx.Err() != nil {
+			return nil
+		}
+		slog.Warn("workload api stream broken", slog.String("error", err.Error()))
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(retryDelay):
+		}
+	}
+}
+
+// Worker returns the background worker running the source.
+func (s *Source) Worker() workers.Worker {
+	return workers.Worker{Name: "spiffe-source", Run: s.Run, Restart: workers.RestartOnFailure}
+}
+
+// watch applies the responses of a FetchX509SVID stream until it breaks.
+func (s *Source) watch(ctx context.Context, conn *grpc.ClientConn) error {
+	stream, err := conn.NewStream(ctx, &fetchX509SVIDDesc, fetchX509SVIDMethod)
+	if err != nil {
+		return fmt.Errorf("%w: open workload api stream: %v", service.ErrConnectionClosed, err)
+	}
+	if err := stream.SendMsg(&workloadpb.X509SVIDRequest{}); err != nil {
+		return fmt.Errorf("%w: send svid request: %v", service.ErrConnectionClosed, err)
+	}
+	if err := stream.CloseSend(); err != nil {
+		return fmt.Errorf("%w: send svid request: %v", service.ErrConnectionClosed, err)
+	}
+	for {
+		var resp workloadpb.X509SVIDResponse
+		if err := stream.RecvMsg(&resp); err != nil {
+			if errors.Is(err, io.EOF) {
+				return fmt.Errorf("%w: workload api closed the stream", service.ErrConnectionClosed)
+			}
+			return fmt.Errorf("%w: receive svid: %v", service.ErrConnectionClosed, err)
+		}
+		st, err := parseResponse(&resp)
+		if err != nil {
+			slog.Error("invalid svid from workload api", slog.String("error", err.Error()))
+			continue
+		}
+		s.state.Store(st)
+		slog.Info("updated svid",
+			slog.String("spiffe_id", st.svid.ID),
+			slog.Time("expires", st.svid.Expires),
+		)
+		s.mu.Lock()
+		select {
+		case <-s.ready:
+		default:
+			close(s.ready)
+		}
+		s.mu.Unlock()
+	}
+}
+
+// parseResponse parses the default SVID and the bundles of the response.
+func parseResponse(resp *workloadpb.X509SVIDResponse) (*state, error) {
+	if len(resp.GetSvids()) == 0 {
+		return nil, fmt.Errorf("%w: response without svids", service.ErrBadRequest)
+	}
+	pb := resp.GetSvids()[0]
+	certs, err := x509.ParseCertificates(pb.GetX509Svid())
+	if err != nil || len(certs) == 0 {
+		return nil, fmt.Errorf("%w: parse svid certificates: %v", service.ErrBadRequest, err)
+	}
+	key, err := x509.ParsePKCS8PrivateKey(pb.GetX509SvidKey())
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse svid key: %v", service.ErrBadRequest, err)
+	}
+	signer, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: svid key cannot sign", service.ErrBadRequest)
+	}
+	id, err := TrustDomain(pb.GetSpiffeId())
+	if err != nil {
+		return nil, err
+	}
+
+	st := &state{
+		svid: SVID{
+			ID:      pb.GetSpiffeId(),
+			Expires: certs[0].NotAfter,
+			Certificate: tls.Certificate{
+				PrivateKey: signer,
+				Leaf:       certs[0],
+			},
+		},
+		bundles: make(map[string]*x509.CertPool),
+	}
+	for _, c := range certs {
+		st.svid.Certificate.Certificate = append(st.svid.Certificate.Certificate, c.Raw)
+	}
+	if st.bundles[id], err = certPool(pb.GetBundle()); err != nil {
+		return nil, err
+	}
+	for td, der := range resp.GetFederatedBundles() {
+		domain, err := TrustDomain(td)
+		if err != nil {
+			domain = td // federated bundles may be keyed by name only
+		}
+		if st.bundles[domain], err = certPool(der); err != nil {
+			return nil, err
+		}
+	}
+	return st, nil
+}
+
+// TrustDomain returns the trust domain of the SPIFFE ID, e.g. "example.org" for
+// "spiffe://example.org/payments". This function returns
+// [service.ErrBadRequest] in case the id is malformed.
+func TrustDomain(id string) (string, error) {
+	u, err := url.Parse(id)
+	if err != nil || u.Scheme != "spiffe" || u.Host == "" ||
+		u.User != nil || u.RawQuery != "" || u.Fragment != "" {
+		return "", fmt.Errorf("%w: malformed spiffe id %q", service.ErrBadRequest, id)
+	}
+	return strings.ToLower(u.Host), nil
+}
+
+// certPool parses the concatenated DER certificates of a bundle.
+func certPool(der []byte) (*x509.CertPool, error) {
+	certs, err := x509.ParseCertificates(der)
+	if err != nil {
+		return nil, fmt.Errorf("%w: parse bundle: %v", service.ErrBadRequest, err)
+	}
+	pool := x509.NewCertPool()
+	for _, c := range certs {
+		pool.AddCert(c)
+	}
+	return pool, nil
+}
+
+// dialTarget converts the endpoint socket to a grpc target.
+func dialTarget(socket string) (string, error) {
+	switch {
+	case strings.HasPrefix(socket, "unix://"):
+		return "unix:" + strings.TrimPrefix(socket, "unix://"), nil
+	case strings.HasPrefix(socket, "unix:"), strings.HasPrefix(socket, "tcp:"):
+		return strings.TrimPrefix(socket, "tcp:"), nil
+	default:
+		return "", fmt.Errorf("%w: malformed spiffe endpoint socket %q", service.ErrBadRequest, socket)
+	}
+}
+
+// retryDelay is the delay before a broken stream is opened again.
+const retryDelay = time.Second
+
+// fetchX509SVIDMethod is the full name of the streaming method fetching the
+// SVIDs.
+const fetchX509SVIDMethod = "/SpiffeWorkloadAPI/FetchX509SVID"
+
+// fetchX509SVIDDesc describes the server streaming method.
+var fetchX509SVIDDesc = grpc.StreamDesc{StreamName: "FetchX509SVID", ServerStreams: true}
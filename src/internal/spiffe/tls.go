@@ -0,0 +1,172 @@
+package spiffe
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net/http"
+	"slices"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/peer"
+
+	"github.com/eventscompass/service-template/src/internal/auth"
+)
+
+// Authorizer decides whether the peer with the SPIFFE ID may connect. It
+// returns a non-nil error if it may not.
+type Authorizer func(id string) error
+
+// AuthorizeAny authorizes every peer with a valid SVID of a trusted domain.
+func AuthorizeAny() Authorizer { return func(string) error { return nil } }
+
+// AuthorizeID authorizes the peers with one of the SPIFFE IDs.
+func AuthorizeID(ids ...string) Authorizer {
+	return func(id string) error {
+		if slices.Contains(ids, id) {
+			return nil
+		}
+		return fmt.Errorf("%w: spiffe id %s is not allowed", auth.ErrUnauthorized, id)
+	}
+}
+
+// AuthorizeMemberOf authorizes the peers of the trust domain, e.g.
+// "example.org".
+func AuthorizeMemberOf(trustDomain string) Authorizer {
+	return func(id string) error {
+		if td, err := TrustDomain(id); err == nil && td == trustDomain {
+			return nil
+		}
+		return fmt.Errorf("%w: spiffe id %s is not a member of %s", auth.ErrUnauthorized, id, trustDomain)
+	}
+}
+
+// ServerTLSConfig returns a tls configuration presenting the current SVID of
+// the source, which requires clients to present an SVID authorized by a.
+func ServerTLSConfig(s *Source, a Authorizer) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ClientAuth: tls.RequireAnyClientCert,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return s.certificate()
+		},
+		VerifyPeerCertificate: s.verifier(a),
+	}
+}
+
+// ClientTLSConfig returns a tls configuration presenting the current SVID of
+// the source, which requires the server to present an SVID authorized by a.
+// The server is verified by its SPIFFE ID instead of its host name.
+func ClientTLSConfig(s *Source, a Authorizer) *tls.Config {
+	return &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return s.certificate()
+		},
+		// The default verification checks host names, which SVIDs
+		// do not have. The chain is verified by VerifyPeerCertificate.
+		InsecureSkipVerify:    true, //nolint:gosec // verified by VerifyPeerCertificate
+		VerifyPeerCertificate: s.verifier(a),
+	}
+}
+
+// ServerOption returns the grpc server option for mTLS with SVIDs, see
+// [ServerTLSConfig].
+func ServerOption(s *Source, a Authorizer) grpc.ServerOption {
+	return grpc.Creds(credentials.NewTLS(ServerTLSConfig(s, a)))
+}
+
+// DialOption returns the grpc dial option for mTLS with SVIDs, see
+// [ClientTLSConfig].
+func DialOption(s *Source, a Authorizer) grpc.DialOption {
+	return grpc.WithTransportCredentials(credentials.NewTLS(ClientTLSConfig(s, a)))
+}
+
+// Transport returns an http transport for mTLS with SVIDs, see
+// [ClientTLSConfig]. Use it as base transport of the http clients, see
+// [client.NewHTTPWithTransport].
+func Transport(s *Source, a Authorizer) *http.Transport {
+	t := http.DefaultTransport.(*http.Transport).Clone() //nolint:forcetypeassert // the default is a transport
+	t.TLSClientConfig = ClientTLSConfig(s, a)
+	return t
+}
+
+// PeerID returns the SPIFFE ID of the peer of a grpc call served with
+// [ServerOption].
+func PeerID(ctx context.Context) (string, bool) {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return "", false
+	}
+	info, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(info.State.PeerCertificates) == 0 {
+		return "", false
+	}
+	id, err := svidID(info.State.PeerCertificates[0])
+	return id, err == nil
+}
+
+// certificate returns the current SVID as certificate.
+func (s *Source) certificate() (*tls.Certificate, error) {
+	svid, err := s.SVID()
+	if err != nil {
+		return nil, err
+	}
+	return &svid.Certificate, nil
+}
+
+// verifier returns a function verifying the SVID of a peer against the trust
+// bundle of its domain, and authorizing its SPIFFE ID.
+func (s *Source) verifier(a Authorizer) func([][]byte, [][]*x509.Certificate) error {
+	return func(raw [][]byte, _ [][]*x509.Certificate) error {
+		st := s.state.Load()
+		if st == nil {
+			return fmt.Errorf("%w: no trust bundle fetched yet", auth.ErrUnauthorized)
+		}
+		if len(raw) == 0 {
+			return fmt.Errorf("%w: peer presented no svid", auth.ErrUnauthorized)
+		}
+		certs := make([]*x509.Certificate, 0, len(raw))
+		for _, der := range raw {
+			c, err := x509.ParseCertificate(der)
+			if err != nil {
+				return fmt.Errorf("%w: parse peer certificate: %v", auth.ErrUnauthorized, err)
+			}
+			certs = append(certs, c)
+		}
+		id, err := svidID(certs[0])
+		if err != nil {
+			return err
+		}
+		td, err := TrustDomain(id)
+		if err != nil {
+			return fmt.Errorf("%w: %v", auth.ErrUnauthorized, err)
+		}
+		roots := st.bundles[td]
+		if roots == nil {
+			return fmt.Errorf("%w: trust domain %s is not trusted", auth.ErrUnauthorized, td)
+		}
+		intermediates := x509.NewCertPool()
+		for _, c := range certs[1:] {
+			intermediates.AddCert(c)
+		}
+		if _, err := certs[0].Verify(x509.VerifyOptions{
+			Roots:         roots,
+			Intermediates: intermediates,
+			KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageAny},
+		}); err != nil {
+			return fmt.Errorf("%w: verify svid of %s: %v", auth.ErrUnauthorized, id, err)
+		}
+		return a(id)
+	}
+}
+
+// svidID returns the SPIFFE ID of an SVID, its only URI SAN.
+func svidID(c *x509.Certificate) (string, error) {
+	if len(c.URIs) != 1 || c.URIs[0].Scheme != "spiffe" {
+		return "", fmt.Errorf("%w: certificate is not an svid", auth.ErrUnauthorized)
+	}
+	return c.URIs[0].String(), nil
+}
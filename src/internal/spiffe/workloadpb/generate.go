@@ -0,0 +1,5 @@
+// Package workloadpb contains the generated types of the SPIFFE Workload API,
+// see workload.proto.
+package workloadpb
+
+//go:generate protoc --go_out=. --go_opt=paths=source_relative workload.proto
@@ -0,0 +1,116 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Audit holds the audit columns of a row. Embed it in the structs of tables
+// that have `created_at`, `updated_at` and `deleted_at` columns.
+type Audit struct {
+	CreatedAt time.Time    `json:"created_at"`
+	UpdatedAt time.Time    `json:"updated_at"`
+	DeletedAt sql.NullTime `json:"-"`
+}
+
+// Touch updates the audit columns before writing the row. The creation time is
+// set only once, the update time is set on every call.
+func (a *Audit) Touch(now time.Time) {
+	now = now.UTC()
+	if a.CreatedAt.IsZero() {
+		a.CreatedAt = now
+	}
+	a.UpdatedAt = now
+}
+
+// IsDeleted reports whether the row was soft deleted.
+func (a *Audit) IsDeleted() bool { return a.DeletedAt.Valid }
+
+// Execer is implemented by [sql.DB], [sql.Conn] and [sql.Tx].
+type Execer interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+}
+
+// NotDeleted extends the given where condition so that soft deleted rows are
+// ignored. An empty condition matches all rows that are not deleted.
+//
+//	query := "SELECT id, name FROM venues WHERE " + store.NotDeleted("city = $1")
+func NotDeleted(cond string) string {
+	if strings.TrimSpace(cond) == "" {
+		return notDeletedCond
+	}
+	return "(" + cond + ") AND " + notDeletedCond
+}
+
+// SoftDelete marks the row with the given key as deleted, without removing it
+// from the table. This function returns [service.ErrNotFound] in case there is
+// no such row, or the row is already deleted.
+func SoftDelete(ctx context.Context, db Execer, table, keyColumn string, key any) error {
+	query := fmt.Sprintf(
+		"UPDATE %s SET deleted_at = $1, updated_at = $1 WHERE %s = $2 AND %s",
+		quoteIdent(table), quoteIdent(keyColumn), notDeletedCond,
+	)
+	return execOne(ctx, db, query, time.Now().UTC(), key)
+}
+
+// Restore reverts the soft deletion of the row with the given key. This
+// function returns [service.ErrNotFound] in case there is no such deleted row.
+func Restore(ctx context.Context, db Execer, table, keyColumn string, key any) error {
+	query := fmt.Sprintf(
+		"UPDATE %s SET deleted_at = NULL, updated_at = $1 WHERE %s = $2 AND deleted_at IS NOT NULL",
+		quoteIdent(table), quoteIdent(keyColumn),
+	)
+	return execOne(ctx, db, query, time.Now().UTC(), key)
+}
+
+// Purge permanently removes the rows that were soft deleted longer than the
+// retention period ago. Returns the number of removed rows.
+func Purge(ctx context.Context, db Execer, table string, retention time.Duration) (int64, error) {
+	query := fmt.Sprintf(
+		"DELETE FROM %s WHERE deleted_at IS NOT NULL AND deleted_at < $1",
+		quoteIdent(table),
+	)
+	res, err := db.ExecContext(ctx, query, time.Now().UTC().Add(-retention))
+	if err != nil {
+		return 0, service.Unexpected(ctx, fmt.Errorf("purge %s: %w", table, err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, service.Unexpected(ctx, fmt.Errorf("purge %s: %w", table, err))
+	}
+	return n, nil
+}
+
+// execOne executes a query that is expected to modify exactly one row.
+func execOne(ctx context.Context, db Execer, query string, args ...any) error {
+	res, err := db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: no matching row", service.ErrNotFound)
+	}
+	return nil
+}
+
+// quoteIdent quotes an sql identifier, so that it can be safely used inside a
+// query. Qualified names, e.g. "schema.table", are quoted part by part.
+func quoteIdent(name string) string {
+	parts := strings.Split(name, ".")
+	for i, p := range parts {
+		parts[i] = `"` + strings.ReplaceAll(p, `"`, `""`) + `"`
+	}
+	return strings.Join(parts, ".")
+}
+
+// notDeletedCond is the condition matching rows that are not soft deleted.
+const notDeletedCond = "deleted_at IS NULL"
@@ -0,0 +1,273 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// BulkError is returned by the bulk helpers in case some of the chunks could
+// not be written. The chunks that succeeded are committed.
+type BulkError struct {
+	// Written is the number of rows that were written.
+	Written int
+
+	// Failed lists the chunks that could not be written.
+	Failed []ChunkError
+}
+
+// ChunkError describes a chunk that could not be written.
+type ChunkError struct {
+	// Offset is the index of the first row of the chunk.
+	Offset int
+
+	// Count is the number of rows in the chunk.
+	Count int
+
+	Err error
+}
+
+// Error implements the error interface.
+func (e *BulkError) Error() string {
+	failed := 0
+	for _, c := range e.Failed {
+		failed += c.Count
+	}
+	return fmt.Sprintf("bulk write: %d rows written, %d rows in %d chunks failed: %v",
+		e.Written, failed, len(e.Failed), e.Failed[0].Err)
+}
+
+// Unwrap returns the errors of the failed chunks.
+func (e *BulkError) Unwrap() []error {
+	errs := make([]error, len(e.Failed))
+	for i, c := range e.Failed {
+		errs[i] = c.Err
+	}
+	return errs
+}
+
+// Chunked splits n items into chunks of the given size and calls write for the
+// items [lo, hi) of every chunk. A failing chunk does not stop the remaining
+// chunks from being written. If any of the chunks fails a [*BulkError] is
+// returned. This helper can be used for implementing bulk writes for any kind
+// of store, see [BulkWrite] for mongo.
+func Chunked(
+	ctx context.Context,
+	n int,
+	size int,
+	write func(ctx context.Context, lo, hi int) error,
+) error {
+	if size <= 0 {
+		size = defaultChunkSize
+	}
+	res := &BulkError{}
+	for lo := 0; lo < n; lo += size {
+		if err := ctx.Err(); err != nil {
+			return err //nolint:wrapcheck // context errors are not wrapped
+		}
+		hi := min(lo+size, n)
+		if err := write(ctx, lo, hi); err != nil {
+			res.Failed = append(res.Failed, ChunkError{Offset: lo, Count: hi - lo, Err: err})
+			continue
+		}
+		res.Written += hi - lo
+	}
+	if len(res.Failed) > 0 {
+		return res
+	}
+	return nil
+}
+
+// CopyIn inserts the rows into the table using the postgres COPY protocol,
+// which is the fastest way of loading large amounts of data. Every chunk is
+// copied inside a separate transaction. See [Chunked] for the errors returned
+// by this function.
+//
+// The database driver must support the "COPY ... FROM STDIN" statements of
+// lib/pq: the statement is prepared, every row is sent with Exec, and a final
+// Exec without arguments flushes the data.
+func CopyIn(
+	ctx context.Context,
+	db *sql.DB,
+	table string,
+	columns []string,
+	rows [][]any,
+	chunkSize int,
+) error {
+	query := fmt.Sprintf("COPY %s (%s) FROM STDIN", quoteIdent(table), quoteIdents(columns))
+	return Chunked(ctx, len(rows), chunkSize, func(ctx context.Context, lo, hi int) error {
+		return InTx(ctx, db, func(tx *sql.Tx) error {
+			stmt, err := tx.PrepareContext(ctx, query)
+			if err != nil {
+				return service.Unexpected(ctx, err)
+			}
+			defer stmt.Close() //nolint:errcheck // intentional
+
+			for _, row := range rows[lo:hi] {
+				if _, err := stmt.ExecContext(ctx, row...); err != nil {
+					return service.Unexpected(ctx, err)
+				}
+			}
+			if _, err := stmt.ExecContext(ctx); err != nil {
+				return service.Unexpected(ctx, err)
+			}
+			return nil
+		})
+	})
+}
+
+// Upsert inserts the rows into the table with multi-row INSERT statements. If
+// conflict columns are given, rows conflicting on these columns are updated
+// instead. See [Chunked] for the errors returned by this function.
+func Upsert(
+	ctx context.Context,
+	db Execer,
+	table string,
+	columns []string,
+	conflict []string,
+	rows [][]any,
+	chunkSize int,
+) error {
+	if len(columns) == 0 {
+		return fmt.Errorf("%w: no columns", service.ErrUnexpected)
+	}
+	// Postgres limits the number of parameters of a single query.
+	if maxRows := maxParams / len(columns); chunkSize <= 0 || chunkSize > maxRows {
+		chunkSize = min(defaultChunkSize, maxRows)
+	}
+
+	suffix := upsertSuffix(columns, conflict)
+	return Chunked(ctx, len(rows), chunkSize, func(ctx context.Context, lo, hi int) error {
+		var (
+			b    strings.Builder
+			args = make([]any, 0, (hi-lo)*len(columns))
+		)
+		fmt.Fprintf(&b, "INSERT INTO %s (%s) VALUES ", quoteIdent(table), quoteIdents(columns))
+		for i, row := range rows[lo:hi] {
+			if len(row) != len(columns) {
+				return fmt.Errorf("%w: row %d has %d values, expected %d",
+					service.ErrBadRequest, lo+i, len(row), len(columns))
+			}
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteByte('(')
+			for j := range row {
+				if j > 0 {
+					b.WriteByte(',')
+				}
+				b.WriteString("$" + strconv.Itoa(len(args)+j+1))
+			}
+			b.WriteByte(')')
+			args = append(args, row...)
+		}
+		b.WriteString(suffix)
+
+		if _, err := db.ExecContext(ctx, b.String(), args...); err != nil {
+			return service.Unexpected(ctx, err)
+		}
+		return nil
+	})
+}
+
+// BulkWrite writes the models to the collection with unordered bulk writes of
+// the given size, thus a failing model does not stop the others from being
+// written. If any of the models fails a [*BulkError] is returned: every model
+// rejected by mongo is a failed chunk of its own at the index of the model,
+// with [service.ErrAlreadyExists] for a duplicate key, while a bulk write that
+// failed as a whole, e.g. on a network error, fails all of its models.
+func BulkWrite(
+	ctx context.Context,
+	coll *mongo.Collection,
+	models []mongo.WriteModel,
+	chunkSize int,
+) error {
+	if chunkSize <= 0 {
+		chunkSize = defaultChunkSize
+	}
+	res := &BulkError{}
+	for lo := 0; lo < len(models); lo += chunkSize {
+		if err := ctx.Err(); err != nil {
+			return err //nolint:wrapcheck // context errors are not wrapped
+		}
+		hi := min(lo+chunkSize, len(models))
+		_, err := coll.BulkWrite(ctx, models[lo:hi], options.BulkWrite().SetOrdered(false))
+		res.add(ctx, lo, hi-lo, err)
+	}
+	if len(res.Failed) > 0 {
+		return res
+	}
+	return nil
+}
+
+// add records the outcome of the unordered mongo bulk write of the n models
+// starting at offset, see [BulkWrite].
+func (e *BulkError) add(ctx context.Context, offset, n int, err error) {
+	var bwe mongo.BulkWriteException
+	switch {
+	case err == nil:
+		e.Written += n
+	case errors.As(err, &bwe) && bwe.WriteConcernError == nil && len(bwe.WriteErrors) > 0:
+		// The other models of an unordered bulk write were written.
+		e.Written += n - len(bwe.WriteErrors)
+		for _, we := range bwe.WriteErrors {
+			werr := fmt.Errorf("%w: %v", service.ErrUnexpected, we)
+			if mongo.IsDuplicateKeyError(we.WriteError) {
+				werr = fmt.Errorf("%w: %v", service.ErrAlreadyExists, we)
+			}
+			e.Failed = append(e.Failed, ChunkError{Offset: offset + we.Index, Count: 1, Err: werr})
+		}
+	default:
+		e.Failed = append(e.Failed, ChunkError{
+			Offset: offset,
+			Count:  n,
+			Err:    service.Unexpected(ctx, err),
+		})
+	}
+}
+
+// upsertSuffix builds the ON CONFLICT clause of an upsert.
+func upsertSuffix(columns, conflict []string) string {
+	if len(conflict) == 0 {
+		return ""
+	}
+	isKey := make(map[string]bool, len(conflict))
+	for _, c := range conflict {
+		isKey[c] = true
+	}
+	var updates []string
+	for _, c := range columns {
+		if !isKey[c] {
+			updates = append(updates, quoteIdent(c)+" = EXCLUDED."+quoteIdent(c))
+		}
+	}
+	if len(updates) == 0 {
+		return " ON CONFLICT (" + quoteIdents(conflict) + ") DO NOTHING"
+	}
+	return " ON CONFLICT (" + quoteIdents(conflict) + ") DO UPDATE SET " +
+		strings.Join(updates, ", ")
+}
+
+func quoteIdents(names []string) string {
+	quoted := make([]string, len(names))
+	for i, n := range names {
+		quoted[i] = quoteIdent(n)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+const (
+	// defaultChunkSize is the number of rows written at once, if no chunk
+	// size is provided.
+	defaultChunkSize = 1000
+
+	// maxParams is the maximum number of parameters of a postgres query.
+	maxParams = 65535
+)
@@ -0,0 +1,94 @@
+package store
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestBulkErrorAdd(t *testing.T) {
+	writeErr := func(index, code int) mongo.BulkWriteError {
+		return mongo.BulkWriteError{WriteError: mongo.WriteError{Index: index, Code: code, Message: "rejected"}}
+	}
+	tests := []struct {
+		name        string
+		err         error
+		wantWritten int
+		wantFailed  []ChunkError
+	}{
+		{
+			name:        "written",
+			wantWritten: 10,
+		},
+		{
+			name: "rejected models",
+			err: mongo.BulkWriteException{WriteErrors: []mongo.BulkWriteError{
+				writeErr(2, 11000), writeErr(7, 121),
+			}},
+			wantWritten: 8,
+			wantFailed: []ChunkError{
+				{Offset: 102, Count: 1, Err: service.ErrAlreadyExists},
+				{Offset: 107, Count: 1, Err: service.ErrUnexpected},
+			},
+		},
+		{
+			name: "write concern",
+			err: mongo.BulkWriteException{
+				WriteConcernError: &mongo.WriteConcernError{Code: 64, Message: "timeout"},
+			},
+			wantFailed: []ChunkError{{Offset: 100, Count: 10, Err: service.ErrUnexpected}},
+		},
+		{
+			name:       "network",
+			err:        errors.New("connection reset"),
+			wantFailed: []ChunkError{{Offset: 100, Count: 10, Err: service.ErrUnexpected}},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var e BulkError
+			e.add(context.Background(), 100, 10, tt.err)
+			if e.Written != tt.wantWritten {
+				t.Errorf("got %d written, want %d", e.Written, tt.wantWritten)
+			}
+			if len(e.Failed) != len(tt.wantFailed) {
+				t.Fatalf("got failed %+v, want %+v", e.Failed, tt.wantFailed)
+			}
+			for i, got := range e.Failed {
+				want := tt.wantFailed[i]
+				if got.Offset != want.Offset || got.Count != want.Count || !errors.Is(got.Err, want.Err) {
+					t.Errorf("got failed chunk %+v, want %+v", got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestChunked(t *testing.T) {
+	var calls [][2]int
+	err := Chunked(context.Background(), 25, 10, func(_ context.Context, lo, hi int) error {
+		calls = append(calls, [2]int{lo, hi})
+		if lo == 10 {
+			return service.ErrUnexpected
+		}
+		return nil
+	})
+	var bulk *BulkError
+	if !errors.As(err, &bulk) {
+		t.Fatalf("got error %v, want a bulk error", err)
+	}
+	if want := [][2]int{{0, 10}, {10, 20}, {20, 25}}; len(calls) != len(want) ||
+		calls[0] != want[0] || calls[1] != want[1] || calls[2] != want[2] {
+		t.Errorf("got chunks %v, want %v", calls, want)
+	}
+	if bulk.Written != 15 || len(bulk.Failed) != 1 || bulk.Failed[0].Offset != 10 || bulk.Failed[0].Count != 10 {
+		t.Errorf("got %+v, want 15 written and the second chunk failed", bulk)
+	}
+	if !errors.Is(err, service.ErrUnexpected) {
+		t.Errorf("got error %v, want it to wrap the chunk error", err)
+	}
+}
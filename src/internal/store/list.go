@@ -0,0 +1,175 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Querier is implemented by [sql.DB], [sql.Conn] and [sql.Tx].
+type Querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+// ListQuery describes a query listing the rows of a table in a stable order,
+// one page at a time. Pages are addressed either by offset, or by the key of
+// the row they start after or end before, which is stable while rows are
+// inserted and scales to deep pages.
+type ListQuery struct {
+	// Table is the table to list, see [quoteIdent].
+	Table string
+
+	// Columns are the selected columns, scanned by the scan
+	// function of [List].
+	Columns []string
+
+	// Where is an optional condition with the placeholders $1,
+	// $2, ... bound to Args, e.g. [NotDeleted]("city = $1").
+	Where string
+	Args  []any
+
+	// OrderBy are the columns the rows are ordered by. Together
+	// they must be unique, e.g. {"created_at", "id"}.
+	OrderBy []string
+
+	// Desc orders the rows descending.
+	Desc bool
+
+	// Limit is the maximum number of rows, zero is unlimited.
+	Limit int
+
+	// Offset skips the first rows.
+	Offset int
+
+	// After and Before list the rows following, or preceding, the
+	// row with the given values of the OrderBy columns. At most
+	// one of them may be set. The rows are returned in order in
+	// both cases.
+	After  []any
+	Before []any
+}
+
+// List returns the rows of the query, scanned by scan. This function returns
+// [service.ErrBadRequest] in case the query is inconsistent.
+//
+//	venues, err := store.List(ctx, db, q, func(rows *sql.Rows) (Venue, error) {
+//		var v Venue
+//		err := rows.Scan(&v.ID, &v.Name, &v.CreatedAt)
+//		return v, err
+//	})
+func List[T any](
+	ctx context.Context,
+	db Querier,
+	q ListQuery,
+	scan func(*sql.Rows) (T, error),
+) ([]T, error) {
+	query, args, err := q.build()
+	if err != nil {
+		return nil, err
+	}
+	rows, err := db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, service.Unexpected(ctx, fmt.Errorf("list %s: %w", q.Table, err))
+	}
+	defer rows.Close() //nolint:errcheck // intentional
+
+	var res []T
+	for rows.Next() {
+		item, err := scan(rows)
+		if err != nil {
+			return nil, service.Unexpected(ctx, fmt.Errorf("scan %s: %w", q.Table, err))
+		}
+		res = append(res, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, service.Unexpected(ctx, fmt.Errorf("list %s: %w", q.Table, err))
+	}
+	if q.Before != nil {
+		slices.Reverse(res)
+	}
+	return res, nil
+}
+
+// Count returns the number of rows of the table matching the optional where
+// condition, see [ListQuery].
+func Count(ctx context.Context, db Querier, table, where string, args ...any) (int64, error) {
+	query := "SELECT COUNT(*) FROM " + quoteIdent(table)
+	if strings.TrimSpace(where) != "" {
+		query += " WHERE " + where
+	}
+	var n int64
+	if err := db.QueryRowContext(ctx, query, args...).Scan(&n); err != nil {
+		return 0, service.Unexpected(ctx, fmt.Errorf("count %s: %w", table, err))
+	}
+	return n, nil
+}
+
+// build returns the sql of the query and its arguments.
+func (q ListQuery) build() (string, []any, error) {
+	if len(q.Columns) == 0 || len(q.OrderBy) == 0 {
+		return "", nil, fmt.Errorf("%w: list query needs columns and an order", service.ErrBadRequest)
+	}
+	if q.After != nil && q.Before != nil {
+		return "", nil, fmt.Errorf("%w: list query cannot page both after and before",
+			service.ErrBadRequest)
+	}
+	key := q.After
+	if q.Before != nil {
+		key = q.Before
+	}
+	if key != nil && len(key) != len(q.OrderBy) {
+		return "", nil, fmt.Errorf("%w: list key has %d values, want %d",
+			service.ErrBadRequest, len(key), len(q.OrderBy))
+	}
+	if q.Limit < 0 || q.Offset < 0 {
+		return "", nil, fmt.Errorf("%w: negative limit or offset", service.ErrBadRequest)
+	}
+
+	// Listing before a row is listing after it in the reversed order,
+	// the rows are put back in order by the caller.
+	desc := q.Desc != (q.Before != nil)
+	cmp, dir := ">", "ASC"
+	if desc {
+		cmp, dir = "<", "DESC"
+	}
+
+	args := slices.Clone(q.Args)
+	var conds []string
+	if strings.TrimSpace(q.Where) != "" {
+		conds = append(conds, "("+q.Where+")")
+	}
+	if key != nil {
+		placeholders := make([]string, len(key))
+		for i, v := range key {
+			args = append(args, v)
+			placeholders[i] = "$" + strconv.Itoa(len(args))
+		}
+		conds = append(conds, fmt.Sprintf("(%s) %s (%s)",
+			quoteIdents(q.OrderBy), cmp, strings.Join(placeholders, ", ")))
+	}
+
+	order := make([]string, len(q.OrderBy))
+	for i, c := range q.OrderBy {
+		order[i] = quoteIdent(c) + " " + dir
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "SELECT %s FROM %s", quoteIdents(q.Columns), quoteIdent(q.Table))
+	if len(conds) > 0 {
+		b.WriteString(" WHERE " + strings.Join(conds, " AND "))
+	}
+	b.WriteString(" ORDER BY " + strings.Join(order, ", "))
+	if q.Limit > 0 {
+		fmt.Fprintf(&b, " LIMIT %d", q.Limit)
+	}
+	if q.Offset > 0 {
+		fmt.Fprintf(&b, " OFFSET %d", q.Offset)
+	}
+	return b.String(), args, nil
+}
@@ -0,0 +1,73 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io/fs"
+	"sort"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Migrate applies the sql migrations of the file system that were not applied
+// yet, in the lexical order of their names, e.g. "0001_create_events.sql".
+// Every migration runs in a transaction of its own, and is recorded in the
+// schema_migrations table, which is created if needed:
+//
+//	CREATE TABLE schema_migrations (
+//		name       TEXT PRIMARY KEY,
+//		applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+//	);
+//
+// Migrate returns the names of the applied migrations. This function returns
+// [service.ErrUnexpected] in case a migration fails; the migrations before it
+// stay applied.
+func Migrate(ctx context.Context, db *sql.DB, fsys fs.FS) ([]string, error) {
+	if _, err := db.ExecContext(ctx, createMigrationsTable); err != nil {
+		return nil, fmt.Errorf("%w: create migrations table: %v", service.ErrUnexpected, err)
+	}
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("%w: list migrations: %v", service.ErrUnexpected, err)
+	}
+	sort.Strings(names)
+
+	var applied []string
+	for _, name := range names {
+		b, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return applied, fmt.Errorf("%w: read migration %s: %v", service.ErrUnexpected, name, err)
+		}
+		var done bool
+		err = InTx(ctx, db, func(tx *sql.Tx) error {
+			var n int
+			if err := tx.QueryRowContext(ctx,
+				"SELECT count(*) FROM schema_migrations WHERE name = $1", name).Scan(&n); err != nil {
+				return err //nolint:wrapcheck // wrapped below
+			}
+			if done = n > 0; done {
+				return nil
+			}
+			if _, err := tx.ExecContext(ctx, string(b)); err != nil {
+				return err //nolint:wrapcheck // wrapped below
+			}
+			_, err := tx.ExecContext(ctx, "INSERT INTO schema_migrations (name) VALUES ($1)", name)
+			return err //nolint:wrapcheck // wrapped below
+		})
+		if err != nil {
+			return applied, fmt.Errorf("%w: apply migration %s: %v", service.ErrUnexpected, name, err)
+		}
+		if !done {
+			applied = append(applied, strings.TrimSuffix(name, ".sql"))
+		}
+	}
+	return applied, nil
+}
+
+// createMigrationsTable creates the table recording the applied migrations.
+const createMigrationsTable = `CREATE TABLE IF NOT EXISTS schema_migrations (
+	name       TEXT PRIMARY KEY,
+	applied_at TIMESTAMPTZ NOT NULL DEFAULT now()
+)`
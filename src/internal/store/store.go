@@ -0,0 +1,60 @@
+// Package store provides helpers for working with the database of the service.
+//
+// The package works with [database/sql] and does not import any drivers. The
+// service has to import the driver that it uses, e.g.:
+//
+//	import _ "github.com/lib/pq"
+//
+// The queries built by this package use postgres placeholders ($1, $2, ...).
+package store
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/health"
+)
+
+// Config encapsulates the configuration for the database used by the service.
+type Config struct {
+	// Driver is the name of the registered [database/sql] driver.
+	Driver string `env:"DATABASE_DRIVER" envDefault:"postgres"`
+
+	// DSN is the data source name used for connecting to the
+	// database.
+	DSN string `env:"DATABASE_DSN,notEmpty"`
+
+	MaxOpenConns    int           `env:"DATABASE_MAX_OPEN_CONNS" envDefault:"10"`
+	MaxIdleConns    int           `env:"DATABASE_MAX_IDLE_CONNS" envDefault:"5"`
+	ConnMaxLifetime time.Duration `env:"DATABASE_CONN_MAX_LIFETIME" envDefault:"30m"`
+}
+
+// Open opens a connection pool to the database and verifies that the database
+// is reachable. A ping-based check named "database" is registered in the
+// readiness registry of ctx, see [health.Register], so that a lost database
+// connection makes the service unready. This function returns [service.ErrConnectionClosed] in case
+// the database cannot be reached.
+func Open(ctx context.Context, cfg Config) (*sql.DB, error) {
+	db, err := sql.Open(cfg.Driver, cfg.DSN)
+	if err != nil {
+		return nil, fmt.Errorf("%w: open database: %v", service.ErrUnexpected, err)
+	}
+	db.SetMaxOpenConns(cfg.MaxOpenConns)
+	db.SetMaxIdleConns(cfg.MaxIdleConns)
+	db.SetConnMaxLifetime(cfg.ConnMaxLifetime)
+
+	if err := db.PingContext(ctx); err != nil {
+		db.Close() //nolint:errcheck,gosec // intentional
+		return nil, fmt.Errorf("%w: ping database: %v", service.ErrConnectionClosed, err)
+	}
+
+	health.Register(ctx, healthCheckName, health.Ping(db))
+	return db, nil
+}
+
+// healthCheckName is the name of the health check registered by [Open].
+const healthCheckName = "database"
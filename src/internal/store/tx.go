@@ -0,0 +1,63 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/resilience"
+)
+
+// InTx runs fn inside a transaction, which is committed if fn succeeds and
+// rolled back otherwise. Transactions aborted by the database because of a
+// serialization failure or a deadlock are retried, thus fn must not have side
+// effects outside of the transaction.
+func InTx(ctx context.Context, db *sql.DB, fn func(tx *sql.Tx) error) error {
+	err := resilience.Retry(ctx, txRetryPolicy, func(ctx context.Context) error {
+		tx, err := db.BeginTx(ctx, nil)
+		if err != nil {
+			return service.Unexpected(ctx, err)
+		}
+		if err := fn(tx); err != nil {
+			return errors.Join(err, tx.Rollback())
+		}
+		if err := tx.Commit(); err != nil {
+			if isTxConflict(err) {
+				return err //nolint:wrapcheck // wrapped below
+			}
+			return service.Unexpected(ctx, err)
+		}
+		return nil
+	})
+	if isTxConflict(err) {
+		return service.Unexpected(ctx, err)
+	}
+	return err //nolint:wrapcheck // errors of fn are returned as is
+}
+
+// isTxConflict reports whether the transaction was aborted because it
+// conflicted with a concurrent transaction. The postgres drivers expose the
+// SQLSTATE code of their errors.
+func isTxConflict(err error) bool {
+	var e interface{ SQLState() string }
+	if !errors.As(err, &e) {
+		return false
+	}
+	switch e.SQLState() {
+	case "40001", "40P01": // serialization_failure, deadlock_detected
+		return true
+	default:
+		return false
+	}
+}
+
+// txRetryPolicy retries conflicting transactions.
+var txRetryPolicy = resilience.Policy{
+	MaxAttempts:    5, //nolint:gomnd // conflicts are usually resolved quickly
+	InitialBackoff: 10 * time.Millisecond,
+	MaxBackoff:     500 * time.Millisecond,
+	Retryable:      isTxConflict,
+}
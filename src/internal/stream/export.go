@@ -0,0 +1,190 @@
+package stream
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// ExportConfig configures the flushing of a streamed export.
+type ExportConfig struct {
+	// FlushRows is the number of rows after which the buffered
+	// rows are flushed to the client. Defaults to 1000.
+	FlushRows int
+
+	// FlushInterval is the maximum time rows stay buffered.
+	// Defaults to 1s.
+	FlushInterval time.Duration
+}
+
+// CSVWriter streams rows as csv to the client. Rows are flushed in batches,
+// and the writer stops once the client goes away, see [CSVWriter.Write].
+type CSVWriter struct {
+	exporter
+	w *csv.Writer
+}
+
+// NewCSVWriter starts a csv response, offering it as download under the file
+// name unless it is empty. The header row is written right away, unless it is
+// nil. The route should lift the default deadlines of the streaming server,
+// see [Exempt].
+func NewCSVWriter(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg ExportConfig,
+	filename string,
+	header []string,
+) (*CSVWriter, error) {
+	cw := &CSVWriter{exporter: newExporter(w, r, cfg, "text/csv; charset=utf-8", filename)}
+	cw.w = csv.NewWriter(w)
+	if header != nil {
+		if err := cw.w.Write(header); err != nil {
+			return nil, fmt.Errorf("export: %w", err)
+		}
+	}
+	return cw, nil
+}
+
+// Write writes a row. This function returns [context.Canceled] in case the
+// client went away, which ends the export, and [service.ErrConnectionClosed]
+// in case the row cannot be written.
+func (c *CSVWriter) Write(row []string) error {
+	if err := c.w.Write(row); err != nil {
+		return fmt.Errorf("%w: export: %v", service.ErrConnectionClosed, err)
+	}
+	return c.row(c.w.Flush)
+}
+
+// Close flushes the buffered rows. This function returns
+// [service.ErrConnectionClosed] in case the rows cannot be written.
+func (c *CSVWriter) Close() error {
+	c.w.Flush()
+	if err := c.w.Error(); err != nil {
+		return fmt.Errorf("%w: export: %v", service.ErrConnectionClosed, err)
+	}
+	return c.flush(func() {})
+}
+
+// NDJSONWriter streams values as newline delimited json to the client, see
+// [CSVWriter].
+type NDJSONWriter struct {
+	exporter
+	enc *json.Encoder
+}
+
+// NewNDJSONWriter starts a newline delimited json response, offering it as
+// download under the file name unless it is empty.
+func NewNDJSONWriter(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg ExportConfig,
+	filename string,
+) *NDJSONWriter {
+	return &NDJSONWriter{
+		exporter: newExporter(w, r, cfg, ndjsonType, filename),
+		enc:      json.NewEncoder(w),
+	}
+}
+
+// Write writes the json encoding of the value as a line. This function returns
+// [context.Canceled] in case the client went away, [service.ErrBadRequest] in
+// case the value cannot be encoded, and [service.ErrConnectionClosed] in case
+// it cannot be written.
+func (n *NDJSONWriter) Write(v any) error {
+	if err := n.enc.Encode(v); err != nil {
+		var unsupported *json.UnsupportedTypeError
+		var marshaler *json.MarshalerError
+		if errors.As(err, &unsupported) || errors.As(err, &marshaler) {
+			return fmt.Errorf("%w: export: %v", service.ErrBadRequest, err)
+		}
+		return fmt.Errorf("%w: export: %v", service.ErrConnectionClosed, err)
+	}
+	return n.row(func() {})
+}
+
+// Close flushes the buffered values. This function returns
+// [service.ErrConnectionClosed] in case the values cannot be written.
+func (n *NDJSONWriter) Close() error { return n.flush(func() {}) }
+
+// Exempt returns the handler with the default deadlines of the streaming server
+// lifted, for exports that run as long as the client keeps reading, see
+// [Deadline].
+func Exempt(h http.Handler) http.Handler { return Deadline(h, 0) }
+
+// exporter counts the rows of an export and flushes them periodically.
+type exporter struct {
+	ctx       context.Context //nolint:containedctx // the request context
+	rc        *http.ResponseController
+	cfg       ExportConfig
+	pending   int
+	lastFlush time.Time
+}
+
+// newExporter writes the headers of the export response.
+func newExporter(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg ExportConfig,
+	contentType, filename string,
+) exporter {
+	if cfg.FlushRows <= 0 {
+		cfg.FlushRows = defaultFlushRows
+	}
+	if cfg.FlushInterval <= 0 {
+		cfg.FlushInterval = defaultFlushInterval
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if filename != "" {
+		disposition := mime.FormatMediaType("attachment", map[string]string{"filename": filename})
+		w.Header().Set("Content-Disposition", disposition)
+	}
+	return exporter{
+		ctx:       r.Context(),
+		rc:        http.NewResponseController(w), //nolint:bodyclose // not a response body
+		cfg:       cfg,
+		lastFlush: time.Now(),
+	}
+}
+
+// row records a written row. The buffered rows are flushed with flushBuf, then
+// to the client, once there are enough of them or they are buffered for long
+// enough. The context is checked on every flush only, so that cancellation
+// costs nothing per row.
+func (e *exporter) row(flushBuf func()) error {
+	e.pending++
+	if e.pending < e.cfg.FlushRows && time.Since(e.lastFlush) < e.cfg.FlushInterval {
+		return nil
+	}
+	if err := e.ctx.Err(); err != nil {
+		return fmt.Errorf("export: %w", err)
+	}
+	return e.flush(flushBuf)
+}
+
+// flush flushes the buffered rows to the client.
+func (e *exporter) flush(flushBuf func()) error {
+	flushBuf()
+	e.pending, e.lastFlush = 0, time.Now()
+	if err := e.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return fmt.Errorf("%w: export: %v", service.ErrConnectionClosed, err)
+	}
+	return nil
+}
+
+const (
+	// defaultFlushRows is the default number of rows per flush.
+	defaultFlushRows = 1000
+
+	// defaultFlushInterval is the default maximum time rows stay
+	// buffered.
+	defaultFlushInterval = time.Second
+)
@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// ImportConfig encapsulates the limits of streamed json imports. Zero limits
+// are not enforced.
+type ImportConfig struct {
+	// MaxBytes is the maximum size of an import.
+	MaxBytes int64 `env:"STREAM_IMPORT_MAX_BYTES" envDefault:"104857600"`
+
+	// MaxItems is the maximum number of items of an import.
+	MaxItems int `env:"STREAM_IMPORT_MAX_ITEMS" envDefault:"1000000"`
+}
+
+// EachJSON decodes the items of the json request body one at a time and
+// passes them to fn, in order, without buffering the body in memory. The body
+// is a json array of items, or newline delimited json if its content type is
+// "application/x-ndjson", matching the exports of [NDJSONWriter]. EachJSON
+// returns the number of items passed to fn. This function returns
+// [service.ErrBadRequest] in case the body is malformed or exceeds the limits
+// of cfg, and the errors of fn otherwise; the items before the failing one
+// were passed to fn.
+func EachJSON[T any](
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg ImportConfig,
+	fn func(T) error,
+) (int, error) {
+	if cfg.MaxBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBytes)
+	}
+	if mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mt == ndjsonType {
+		return eachValue(json.NewDecoder(r.Body), cfg, fn)
+	}
+	return eachElement(json.NewDecoder(r.Body), cfg, fn)
+}
+
+// Elements decodes the elements of the json array read from r one at a time
+// and passes them to fn, like [EachJSON] does, e.g. for the json files of an
+// upload, see [EachFile]. Elements returns the number of elements passed to
+// fn. This function returns [service.ErrBadRequest] in case the array is
+// malformed or exceeds the limits of cfg, and the errors of fn otherwise.
+func Elements[T any](r io.Reader, cfg ImportConfig, fn func(T) error) (int, error) {
+	if cfg.MaxBytes > 0 {
+		r = &limitedReader{r: r, n: cfg.MaxBytes}
+	}
+	return eachElement(json.NewDecoder(r), cfg, fn)
+}
+
+// eachElement decodes the elements of a json array.
+func eachElement[T any](dec *json.Decoder, cfg ImportConfig, fn func(T) error) (int, error) {
+	tok, err := dec.Token()
+	if err != nil {
+		return 0, decodeError(cfg, 0, err)
+	}
+	if d, ok := tok.(json.Delim); !ok || d != '[' {
+		return 0, fmt.Errorf("%w: import: expected a json array", service.ErrBadRequest)
+	}
+
+	n := 0
+	for dec.More() {
+		if cfg.MaxItems > 0 && n >= cfg.MaxItems {
+			return n, fmt.Errorf("%w: import: at most %d items", service.ErrBadRequest, cfg.MaxItems)
+		}
+		var v T
+		if err := dec.Decode(&v); err != nil {
+			return n, decodeError(cfg, n, err)
+		}
+		if err := fn(v); err != nil {
+			return n, err
+		}
+		n++
+	}
+	if _, err := dec.Token(); err != nil { // the closing bracket
+		return n, decodeError(cfg, n, err)
+	}
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return n, fmt.Errorf("%w: import: data after the json array", service.ErrBadRequest)
+	}
+	return n, nil
+}
+
+// eachValue decodes a sequence of json values, e.g. newline delimited json.
+func eachValue[T any](dec *json.Decoder, cfg ImportConfig, fn func(T) error) (int, error) {
+	for n := 0; ; n++ {
+		var v T
+		err := dec.Decode(&v)
+		if errors.Is(err, io.EOF) {
+			return n, nil
+		}
+		if err != nil {
+			return n, decodeError(cfg, n, err)
+		}
+		if cfg.MaxItems > 0 && n >= cfg.MaxItems {
+			return n, fmt.Errorf("%w: import: at most %d items", service.ErrBadRequest, cfg.MaxItems)
+		}
+		if err := fn(v); err != nil {
+			return n, err
+		}
+	}
+}
+
+// decodeError returns the error decoding the item at the index.
+func decodeError(cfg ImportConfig, i int, err error) error {
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) || errors.Is(err, errFileTooLarge) {
+		return fmt.Errorf("%w: import: exceeds %d bytes", service.ErrBadRequest, cfg.MaxBytes)
+	}
+	return fmt.Errorf("%w: import: item %d: %v", service.ErrBadRequest, i, err)
+}
+
+// ndjsonType is the content type of newline delimited json.
+const ndjsonType = "application/x-ndjson"
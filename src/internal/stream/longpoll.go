@@ -0,0 +1,122 @@
+package stream
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Notifier wakes up the long polls waiting for a change, see [Wait]. Call
+// Notify whenever the polled state changes, or subscribe [Notifier.Handler]
+// for the topic of the bus announcing the changes.
+type Notifier struct {
+	mu sync.Mutex
+	ch chan struct{}
+}
+
+// NewNotifier creates a new [Notifier].
+func NewNotifier() *Notifier { return &Notifier{ch: make(chan struct{})} }
+
+// C returns a channel that is closed on the next call to Notify.
+func (n *Notifier) C() <-chan struct{} {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.ch
+}
+
+// Notify wakes up all waiting long polls.
+func (n *Notifier) Notify() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	close(n.ch)
+	n.ch = make(chan struct{})
+}
+
+// Handler returns an event handler calling Notify on every message.
+func (n *Notifier) Handler() service.EventHandler {
+	return func(context.Context, []byte) { n.Notify() }
+}
+
+// Wait long polls for the result of check: check is called right away and
+// every time n notifies, until it reports the result as ready or the timeout
+// elapses. Without notifier, check is polled every second. The wait ends early
+// enough to respond within the deadline of the request, i.e. the timeout of
+// the rest listener or of the streaming server. Handlers respond with 204 if
+// the result is not ready:
+//
+//	order, ok, err := stream.Wait(r, s.orders, 30*time.Second, s.shippedOrder(id))
+//	if err != nil { ... }
+//	if !ok {
+//		w.WriteHeader(http.StatusNoContent)
+//		return
+//	}
+//
+// This function returns [context.Canceled] in case the client went away, and
+// the errors of check.
+func Wait[T any](
+	r *http.Request,
+	n *Notifier,
+	timeout time.Duration,
+	check func(context.Context) (T, bool, error),
+) (T, bool, error) {
+	ctx := r.Context()
+	end := time.Now().Add(timeout)
+	if d, ok := requestDeadline(ctx); ok && d.Add(-deadlineMargin).Before(end) {
+		end = d.Add(-deadlineMargin)
+	}
+	timer := time.NewTimer(time.Until(end))
+	defer timer.Stop()
+
+	var zero T
+	for {
+		wake := pollWake(n)
+		res, ok, err := check(ctx)
+		if err != nil || ok {
+			return res, ok, err
+		}
+		select {
+		case <-ctx.Done():
+			return zero, false, fmt.Errorf("long poll: %w", ctx.Err())
+		case <-timer.C:
+			return zero, false, nil
+		case <-wake:
+		}
+	}
+}
+
+// pollWake returns the channel waking up the next check.
+func pollWake(n *Notifier) <-chan struct{} {
+	if n != nil {
+		return n.C()
+	}
+	ch := make(chan struct{})
+	time.AfterFunc(pollInterval, func() { close(ch) })
+	return ch
+}
+
+// requestDeadline returns the earlier of the context deadline, e.g. set by the
+// timeout handler of the rest listener, and the connection deadline set by
+// [Deadline].
+func requestDeadline(ctx context.Context) (time.Time, bool) {
+	d, ok := ctx.Deadline()
+	if cd, cok := ctx.Value(deadlineKey{}).(time.Time); cok && !cd.IsZero() && (!ok || cd.Before(d)) {
+		return cd, true
+	}
+	return d, ok
+}
+
+// deadlineKey is the context key of the connection deadline.
+type deadlineKey struct{}
+
+const (
+	// deadlineMargin is the time left to write the response of a
+	// long poll before the deadline of the request.
+	deadlineMargin = time.Second
+
+	// pollInterval is the interval of long polls without notifier.
+	pollInterval = time.Second
+)
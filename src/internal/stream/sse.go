@@ -0,0 +1,239 @@
+package stream
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/eventscompass/service-template/src/internal/auth"
+	"github.com/eventscompass/service-template/src/internal/httperr"
+)
+
+// SSEWriter writes server-sent events to the client. Every event is flushed
+// right away.
+type SSEWriter struct {
+	w  io.Writer
+	rc *http.ResponseController
+}
+
+// NewSSEWriter starts an event stream response.
+func NewSSEWriter(w http.ResponseWriter) *SSEWriter {
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no") // disable proxy buffering
+	w.WriteHeader(http.StatusOK)
+	s := &SSEWriter{w: w, rc: http.NewResponseController(w)} //nolint:bodyclose // not a response body
+	s.flush()                                                //nolint:errcheck // reported by the next write
+	return s
+}
+
+// Send writes an event of the type with the data, which may span multiple
+// lines. An empty type sends a "message" event. This function returns
+// [service.ErrConnectionClosed] in case the event cannot be written.
+func (s *SSEWriter) Send(event string, data []byte) error {
+	var b strings.Builder
+	if event != "" {
+		b.WriteString("event: " + event + "\n")
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		b.WriteString("data: " + line + "\n")
+	}
+	b.WriteString("\n")
+	if _, err := io.WriteString(s.w, b.String()); err != nil {
+		return fmt.Errorf("%w: send event: %v", service.ErrConnectionClosed, err)
+	}
+	return s.flush()
+}
+
+// Heartbeat writes a comment, which keeps idle connections open through
+// proxies. This function returns [service.ErrConnectionClosed] in case the
+// comment cannot be written.
+func (s *SSEWriter) Heartbeat() error {
+	if _, err := io.WriteString(s.w, ":\n\n"); err != nil {
+		return fmt.Errorf("%w: send heartbeat: %v", service.ErrConnectionClosed, err)
+	}
+	return s.flush()
+}
+
+// flush flushes the written events to the client.
+func (s *SSEWriter) flush() error {
+	if err := s.rc.Flush(); err != nil && !errors.Is(err, http.ErrNotSupported) {
+		return fmt.Errorf("%w: flush events: %v", service.ErrConnectionClosed, err)
+	}
+	return nil
+}
+
+// Receiver is a server-streaming grpc client, e.g. the stream returned by a
+// generated client method.
+type Receiver[M proto.Message] interface {
+	Recv() (M, error)
+}
+
+// GRPCStream returns a handler exposing a server-streaming grpc method as an
+// event stream, for browser clients:
+//
+//	mux.Handle("/v1/events/watch", stream.Exempt(stream.GRPCStream(
+//		func(r *http.Request) (*pb.WatchRequest, error) { ... },
+//		func(ctx context.Context, req *pb.WatchRequest) (stream.Receiver[*pb.Event], error) {
+//			return s.client.Watch(ctx, req)
+//		},
+//	)))
+//
+// The request is decoded with decode, and the stream is opened with open. The
+// Authorization header of the request is forwarded as grpc metadata, thus the
+// grpc api authenticates the caller. Errors opening the stream are mapped to
+// http errors, e.g. codes.Unauthenticated to 401. Every message is sent as a
+// "message" event with its protojson encoding, and later errors of the stream
+// as an "error" event with the grpc code and message. Heartbeats keep the
+// stream open while no messages arrive.
+func GRPCStream[Req any, M proto.Message](
+	decode func(*http.Request) (Req, error),
+	open func(context.Context, Req) (Receiver[M], error),
+) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithCancel(r.Context())
+		defer cancel()
+		if a := r.Header.Get("Authorization"); a != "" {
+			ctx = metadata.AppendToOutgoingContext(ctx, "authorization", a)
+		}
+
+		req, err := decode(r)
+		if err != nil {
+			httperr.Write(ctx, w, err)
+			return
+		}
+		recv, err := open(ctx, req)
+		if err != nil {
+			httperr.Write(ctx, w, grpcError(err))
+			return
+		}
+
+		msgs := make(chan M)
+		errc := make(chan error, 1)
+		go func() {
+			for {
+				m, err := recv.Recv()
+				if err != nil {
+					errc <- err
+					return
+				}
+				select {
+				case msgs <- m:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+
+		// The errors of a call, e.g. codes.Unauthenticated, are
+		// returned by the first Recv. They are mapped to http
+		// errors if they arrive before the stream has to start.
+		var first []M
+		select {
+		case <-ctx.Done():
+			return
+		case err := <-errc:
+			if !errors.Is(err, io.EOF) {
+				httperr.Write(ctx, w, grpcError(err))
+				return
+			}
+			errc <- err
+		case m := <-msgs:
+			first = append(first, m)
+		case <-time.After(startTimeout):
+		}
+
+		sse := NewSSEWriter(w)
+		for _, m := range first {
+			if sendMessage(sse, m) != nil {
+				return
+			}
+		}
+		ticker := time.NewTicker(heartbeatInterval)
+		defer ticker.Stop()
+		for {
+			var err error
+			select {
+			case <-ctx.Done():
+				return
+			case m := <-msgs:
+				err = sendMessage(sse, m)
+			case err := <-errc:
+				if !errors.Is(err, io.EOF) {
+					st := status.Convert(err)
+					data, _ := json.Marshal(map[string]string{ //nolint:errcheck,errchkjson // strings
+						"code":    st.Code().String(),
+						"message": st.Message(),
+					})
+					sse.Send("error", data) //nolint:errcheck // the stream ends anyway
+				}
+				return
+			case <-ticker.C:
+				err = sse.Heartbeat()
+			}
+			if err != nil {
+				return // the client went away
+			}
+		}
+	})
+}
+
+// sendMessage sends the protojson encoding of the message as event.
+func sendMessage(sse *SSEWriter, m proto.Message) error {
+	data, err := protojson.Marshal(m)
+	if err != nil {
+		return fmt.Errorf("%w: encode message: %v", service.ErrBadRequest, err)
+	}
+	return sse.Send("", data)
+}
+
+// grpcError converts a grpc status error to the errors of the framework, which
+// are mapped to http errors by [httperr.Write].
+func grpcError(err error) error {
+	st, ok := status.FromError(err)
+	if !ok {
+		return err
+	}
+	var target error
+	switch st.Code() {
+	case codes.Unauthenticated:
+		target = auth.ErrUnauthorized
+	case codes.PermissionDenied:
+		target = service.ErrNotAllowed
+	case codes.NotFound:
+		target = service.ErrNotFound
+	case codes.AlreadyExists:
+		target = service.ErrAlreadyExists
+	case codes.InvalidArgument, codes.FailedPrecondition, codes.OutOfRange:
+		target = service.ErrBadRequest
+	case codes.Canceled:
+		target = context.Canceled
+	case codes.DeadlineExceeded:
+		target = context.DeadlineExceeded
+	default:
+		target = service.ErrUnexpected
+	}
+	return fmt.Errorf("%w: %s", target, st.Message())
+}
+
+const (
+	// heartbeatInterval is the interval of heartbeats on idle
+	// event streams.
+	heartbeatInterval = 15 * time.Second
+
+	// startTimeout is the time the first message of a grpc stream
+	// is awaited before the event stream starts.
+	startTimeout = time.Second
+)
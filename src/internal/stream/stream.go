@@ -0,0 +1,103 @@
+// Package stream serves the long-running http routes of the service, e.g.
+// large uploads, imports and exports, on a dedicated listener.
+//
+// The rest listener of the framework wraps every handler with
+// [http.TimeoutHandler], which buffers the whole response and cancels every
+// request after HTTP_SERVER_WRITE_TIMEOUT, and its server cuts the reading of
+// request bodies after HTTP_SERVER_READ_TIMEOUT. The streaming server has no
+// such limits. Every request gets read and write deadlines of cfg.Timeout
+// instead, which routes extend or lift with [Deadline]. Services return the
+// handler of the streaming routes from their Stream method:
+//
+//	func (s *ServiceName) Stream() http.Handler {
+//		mux := http.NewServeMux()
+//		mux.Handle("/v1/uploads", stream.Deadline(http.HandlerFunc(s.upload), time.Hour))
+//		return auth.Middleware(s.verifier)(mux)
+//	}
+//
+// The server is run as a background worker, see [Worker].
+package stream
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/listen"
+	"github.com/eventscompass/service-template/src/internal/workers"
+)
+
+// Config encapsulates the configuration for the streaming server.
+type Config struct {
+	// Listen is the port on which the streaming routes of this
+	// service will be registered.
+	Listen string `env:"STREAM_SERVER_LISTEN" envDefault:":8082"`
+
+	// Timeout is the default deadline for reading the request
+	// and writing the response, see [Deadline].
+	Timeout time.Duration `env:"STREAM_SERVER_TIMEOUT" envDefault:"30s"`
+
+	// Upload limits the uploads, see [EachFile].
+	Upload UploadConfig
+
+	// Import limits the json imports, see [EachJSON].
+	Import ImportConfig
+}
+
+// Worker returns the background worker running the streaming server with the
+// handler.
+func Worker(cfg Config, h http.Handler) workers.Worker {
+	return workers.Worker{
+		Name:    "stream-server",
+		Restart: workers.RestartOnFailure,
+		Run: func(ctx context.Context) error {
+			l, err := listen.Listen("stream", cfg.Listen)
+			if err != nil {
+				return err //nolint:wrapcheck // logged by the supervisor
+			}
+			srv := &http.Server{
+				Addr:              cfg.Listen,
+				Handler:           Deadline(h, cfg.Timeout),
+				ReadHeaderTimeout: readHeaderTimeout,
+			}
+			go func() {
+				<-ctx.Done() // block until context is cancelled
+				slog.Info("shutting down stream server")
+				srv.Shutdown(context.Background()) //nolint:errcheck,contextcheck // intentional
+			}()
+			slog.Info("starting stream server", slog.String("port", cfg.Listen))
+			if err := srv.Serve(l); !errors.Is(err, http.ErrServerClosed) {
+				return err //nolint:wrapcheck // logged by the supervisor
+			}
+			return nil
+		},
+	}
+}
+
+// Deadline returns a handler setting the read and write deadlines of the
+// connection to d from the start of the request, replacing the deadlines set
+// before, e.g. the default of the streaming server. Zero lifts the deadlines,
+// for routes that bound their work themselves, e.g. by the client going away.
+// The deadlines cannot be changed on the rest listener of the framework: the
+// handler is a no-op there.
+func Deadline(h http.Handler, d time.Duration) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var deadline time.Time
+		if d > 0 {
+			deadline = time.Now().Add(d)
+		}
+		rc := http.NewResponseController(w) //nolint:bodyclose // not a response body
+		if err := rc.SetReadDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			slog.Warn("failed to set read deadline", slog.String("error", err.Error()))
+		}
+		if err := rc.SetWriteDeadline(deadline); err != nil && !errors.Is(err, http.ErrNotSupported) {
+			slog.Warn("failed to set write deadline", slog.String("error", err.Error()))
+		}
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), deadlineKey{}, deadline)))
+	})
+}
+
+// readHeaderTimeout protects the streaming server from slow clients.
+const readHeaderTimeout = 10 * time.Second
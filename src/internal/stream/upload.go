@@ -0,0 +1,230 @@
+package stream
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"slices"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// UploadConfig encapsulates the limits of multipart uploads.
+type UploadConfig struct {
+	// MaxBytes is the maximum size of a request body.
+	MaxBytes int64 `env:"STREAM_UPLOAD_MAX_BYTES" envDefault:"1073741824"`
+
+	// MaxFileBytes is the maximum size of a single file.
+	MaxFileBytes int64 `env:"STREAM_UPLOAD_MAX_FILE_BYTES" envDefault:"104857600"`
+
+	// MaxFiles is the maximum number of files of a request.
+	MaxFiles int `env:"STREAM_UPLOAD_MAX_FILES" envDefault:"10"`
+
+	// AllowedTypes are the accepted content types of the files,
+	// as sniffed from their contents. Empty accepts any type.
+	AllowedTypes []string `env:"STREAM_UPLOAD_ALLOWED_TYPES"`
+}
+
+// File is a file of a multipart upload, streamed from the request body.
+type File struct {
+	// Field is the name of the form field of the file.
+	Field string
+
+	// Name is the file name given by the client. Never use it as
+	// a path.
+	Name string
+
+	// ContentType is the type sniffed from the contents of the
+	// file, see [http.DetectContentType]. The type claimed by
+	// the client is not trusted.
+	ContentType string
+
+	// Size is the number of bytes read from the file so far.
+	Size int64
+
+	r io.Reader
+}
+
+// Read implements the [io.Reader] interface. Reading beyond the size limit of
+// the file or of the request fails.
+func (f *File) Read(p []byte) (int, error) {
+	n, err := f.r.Read(p)
+	f.Size += int64(n)
+	return n, err //nolint:wrapcheck // transparent reader
+}
+
+// ObjectStore stores uploaded files, e.g. in a bucket of an object storage.
+type ObjectStore interface {
+	// Put stores the object read from r under the key. The size
+	// of the object is not known up front.
+	Put(_ context.Context, key string, r io.Reader, contentType string) error
+}
+
+// EachFile streams the files of the multipart request to fn, in order, without
+// buffering the request in memory or on disk. The other form fields are
+// returned, each limited to 64KiB. fn must consume the file before it returns,
+// e.g. with [SaveTemp] or [Put]; the unread rest is skipped. This function
+// returns [service.ErrBadRequest] in case the request is not a multipart
+// request or exceeds the limits of cfg, and the errors of fn otherwise.
+func EachFile(
+	w http.ResponseWriter,
+	r *http.Request,
+	cfg UploadConfig,
+	fn func(*File) error,
+) (map[string]string, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, cfg.MaxBytes)
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("%w: multipart upload: %v", service.ErrBadRequest, err)
+	}
+
+	fields := make(map[string]string)
+	files := 0
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return fields, nil
+		}
+		if err != nil {
+			return nil, readError(err)
+		}
+		if part.FileName() == "" {
+			b, err := io.ReadAll(io.LimitReader(part, maxFieldBytes+1))
+			if err != nil {
+				return nil, readError(err)
+			}
+			if len(b) > maxFieldBytes {
+				return nil, fmt.Errorf("%w: form field %q too large", service.ErrBadRequest, part.FormName())
+			}
+			fields[part.FormName()] = string(b)
+			continue
+		}
+
+		if files++; cfg.MaxFiles > 0 && files > cfg.MaxFiles {
+			return nil, fmt.Errorf("%w: more than %d files", service.ErrBadRequest, cfg.MaxFiles)
+		}
+		f, err := newFile(part.FormName(), part.FileName(), part, cfg)
+		if err != nil {
+			return nil, err
+		}
+		if err := fn(f); err != nil {
+			return nil, uploadError(err)
+		}
+	}
+}
+
+// SaveTemp writes the file to a new temporary file in dir, or in the default
+// directory for temporary files if dir is empty, and returns its path. The
+// caller removes the file once done. This function returns
+// [service.ErrBadRequest] in case the upload exceeds its limits.
+func SaveTemp(f *File, dir string) (string, error) {
+	tmp, err := os.CreateTemp(dir, "upload-*")
+	if err != nil {
+		return "", fmt.Errorf("%w: create temp file: %v", service.ErrUnexpected, err)
+	}
+	if _, err := io.Copy(tmp, f); err != nil {
+		tmp.Close()           //nolint:errcheck,gosec // the copy error is reported
+		os.Remove(tmp.Name()) //nolint:errcheck,gosec // best effort
+		return "", uploadError(err)
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmp.Name()) //nolint:errcheck,gosec // best effort
+		return "", fmt.Errorf("%w: write temp file: %v", service.ErrUnexpected, err)
+	}
+	return tmp.Name(), nil
+}
+
+// Put streams the file to the object store under the key. This function
+// returns [service.ErrBadRequest] in case the upload exceeds its limits, and
+// the errors of the store otherwise.
+func Put(ctx context.Context, s ObjectStore, key string, f *File) error {
+	if err := s.Put(ctx, key, f, f.ContentType); err != nil {
+		return uploadError(err)
+	}
+	return nil
+}
+
+// newFile sniffs the content type of the part and checks it against the
+// allowed types.
+func newFile(field, name string, part io.Reader, cfg UploadConfig) (*File, error) {
+	var r io.Reader = part
+	if cfg.MaxFileBytes > 0 {
+		r = &limitedReader{r: part, n: cfg.MaxFileBytes}
+	}
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return nil, readError(err)
+	}
+	ct := http.DetectContentType(head)
+	if len(cfg.AllowedTypes) > 0 {
+		mt, _, _ := mime.ParseMediaType(ct) //nolint:errcheck // DetectContentType returns valid types
+		if !slices.Contains(cfg.AllowedTypes, mt) {
+			return nil, fmt.Errorf("%w: file %q has unsupported type %s", service.ErrBadRequest, name, mt)
+		}
+	}
+	return &File{Field: field, Name: name, ContentType: ct, r: br}, nil
+}
+
+// limitedReader fails once more than n bytes are read.
+type limitedReader struct {
+	r io.Reader
+	n int64
+}
+
+// Read implements the [io.Reader] interface.
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.n < 0 {
+		return 0, errFileTooLarge
+	}
+	if int64(len(p)) > l.n+1 {
+		p = p[:l.n+1]
+	}
+	n, err := l.r.Read(p)
+	if l.n -= int64(n); l.n < 0 {
+		return n, errFileTooLarge
+	}
+	return n, err //nolint:wrapcheck // transparent reader
+}
+
+// uploadError classifies an error of consuming an upload. Exceeded limits are
+// bad requests, other errors are returned as they are.
+func uploadError(err error) error {
+	var maxErr *http.MaxBytesError
+	switch {
+	case errors.Is(err, service.ErrBadRequest):
+		return err
+	case errors.As(err, &maxErr):
+		return fmt.Errorf("%w: request body larger than %d bytes", service.ErrBadRequest, maxErr.Limit)
+	case errors.Is(err, errFileTooLarge):
+		return fmt.Errorf("%w: %v", service.ErrBadRequest, err)
+	default:
+		return fmt.Errorf("upload: %w", err)
+	}
+}
+
+// readError classifies an error of reading the multipart body, which is
+// malformed unless it exceeds the limits.
+func readError(err error) error {
+	if err := uploadError(err); errors.Is(err, service.ErrBadRequest) {
+		return err
+	}
+	return fmt.Errorf("%w: multipart upload: %v", service.ErrBadRequest, err)
+}
+
+// errFileTooLarge is returned when a file exceeds its size limit.
+var errFileTooLarge = errors.New("file too large")
+
+const (
+	// sniffLen is the number of bytes used to sniff the
+	// content type, see [http.DetectContentType].
+	sniffLen = 512
+
+	// maxFieldBytes is the maximum size of a form field.
+	maxFieldBytes = 64 << 10
+)
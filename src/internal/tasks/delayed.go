@@ -0,0 +1,190 @@
+package tasks
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Store persists delayed tasks until they are due.
+type Store interface {
+	// Save persists the task, which is due at t.NotBefore. A
+	// task saved again, e.g. for its next attempt, replaces the
+	// saved one.
+	Save(_ context.Context, t Task) error
+
+	// Claim returns up to limit tasks that are due at now. The
+	// returned tasks are not returned by other calls to Claim
+	// until the lease expires, so that replicas polling the
+	// same store don't publish the same task twice.
+	Claim(_ context.Context, now time.Time, lease time.Duration, limit int) ([]Task, error)
+
+	// Delete removes the task after it was published.
+	Delete(_ context.Context, id string) error
+}
+
+// Poll publishes the delayed tasks once they are due. This is a blocking
+// function that polls the store until ctx is cancelled. A task is removed from
+// the store only after it was published, thus a task might be published more
+// than once, but is never lost. This function returns [service.ErrNotFound] in
+// case no store is configured.
+func (q *Queue) Poll(ctx context.Context) error {
+	q.mu.RLock()
+	s := q.store
+	q.mu.RUnlock()
+	if s == nil {
+		return fmt.Errorf("%w: no store for delayed tasks", service.ErrNotFound)
+	}
+
+	interval := q.cfg.PollInterval
+	if interval <= 0 {
+		interval = defaultPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		q.publishDue(ctx, s, interval)
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+// publishDue publishes all tasks that are currently due.
+func (q *Queue) publishDue(ctx context.Context, s Store, interval time.Duration) {
+	for ctx.Err() == nil {
+		due, err := s.Claim(ctx, q.now(), leaseIntervals*interval, pollBatchSize)
+		if err != nil {
+			slog.Error("failed to claim delayed tasks", slog.String("error", err.Error()))
+			return
+		}
+		for _, t := range due {
+			if err := q.publish(ctx, q.cfg.Topic, t); err != nil {
+				// The task is published again once the lease expires.
+				slog.Error("failed to publish delayed task",
+					slog.String("task", t.Name),
+					slog.String("id", t.ID),
+					slog.String("error", err.Error()),
+				)
+				continue
+			}
+			if err := s.Delete(ctx, t.ID); err != nil {
+				slog.Error("failed to delete delayed task",
+					slog.String("task", t.Name),
+					slog.String("id", t.ID),
+					slog.String("error", err.Error()),
+				)
+			}
+		}
+		if len(due) < pollBatchSize {
+			return
+		}
+	}
+}
+
+// SQLStore is a [Store] backed by a postgres table. The table must be created
+// by the migrations of the service:
+//
+//	CREATE TABLE delayed_tasks (
+//		id            TEXT PRIMARY KEY,
+//		name          TEXT NOT NULL,
+//		payload       BYTEA,
+//		attempt       INTEGER NOT NULL DEFAULT 1,
+//		last_error    TEXT NOT NULL DEFAULT '',
+//		run_at        TIMESTAMPTZ NOT NULL,
+//		claimed_until TIMESTAMPTZ
+//	);
+//	CREATE INDEX delayed_tasks_run_at ON delayed_tasks (run_at);
+type SQLStore struct {
+	db *sql.DB
+}
+
+var _ Store = (*SQLStore)(nil)
+
+// NewSQLStore creates a new [SQLStore].
+func NewSQLStore(db *sql.DB) *SQLStore {
+	return &SQLStore{db: db}
+}
+
+// Save implements the [Store] interface.
+func (s *SQLStore) Save(ctx context.Context, t Task) error {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO delayed_tasks (id, name, payload, attempt, last_error, run_at)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (id) DO UPDATE SET
+			attempt = EXCLUDED.attempt,
+			last_error = EXCLUDED.last_error,
+			run_at = EXCLUDED.run_at,
+			claimed_until = NULL`,
+		t.ID, t.Name, t.Payload, max(t.Attempt, 1), t.LastError, t.NotBefore.UTC(),
+	)
+	if err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	return nil
+}
+
+// Claim implements the [Store] interface.
+func (s *SQLStore) Claim(
+	ctx context.Context,
+	now time.Time,
+	lease time.Duration,
+	limit int,
+) ([]Task, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		UPDATE delayed_tasks SET claimed_until = $1
+		WHERE id IN (
+			SELECT id FROM delayed_tasks
+			WHERE run_at <= $2 AND (claimed_until IS NULL OR claimed_until < $2)
+			ORDER BY run_at
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING id, name, payload, attempt, last_error, run_at`,
+		now.Add(lease).UTC(), now.UTC(), limit,
+	)
+	if err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	defer rows.Close() //nolint:errcheck // intentional
+
+	var res []Task
+	for rows.Next() {
+		var t Task
+		err := rows.Scan(&t.ID, &t.Name, &t.Payload, &t.Attempt, &t.LastError, &t.NotBefore)
+		if err != nil {
+			return nil, service.Unexpected(ctx, err)
+		}
+		res = append(res, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, service.Unexpected(ctx, err)
+	}
+	return res, nil
+}
+
+// Delete implements the [Store] interface.
+func (s *SQLStore) Delete(ctx context.Context, id string) error {
+	if _, err := s.db.ExecContext(ctx, "DELETE FROM delayed_tasks WHERE id = $1", id); err != nil {
+		return service.Unexpected(ctx, err)
+	}
+	return nil
+}
+
+const (
+	// defaultPollInterval is used if no poll interval is configured.
+	defaultPollInterval = 5 * time.Second
+
+	// pollBatchSize is the maximum number of tasks claimed at once.
+	pollBatchSize = 100
+
+	// leaseIntervals is the number of poll intervals for which claimed tasks
+	// are reserved for the replica that claimed them.
+	leaseIntervals = 3
+)
@@ -0,0 +1,358 @@
+// Package tasks implements a durable queue of background tasks on top of the
+// [service.MessageBus].
+//
+// Tasks are published to a topic of the message bus and are executed by the
+// replica that consumes the message. Failing tasks are retried with
+// exponential backoff, and tasks that exhaust their attempts are moved to a
+// dead-letter topic. The consumer does not hold the tasks that are not due
+// yet, see [Queue.Handle], thus delayed tasks and retries should be kept in a
+// [Store], see [Queue.UseStore].
+//
+//	q := tasks.NewQueue(bus, cfg)
+//	q.Register("resize-image", resizeImage)
+//	q.Enqueue(ctx, "resize-image", payload)
+//
+// The service has to subscribe [Queue.Handle] for [Queue.Topic] inside its
+// Events method.
+package tasks
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/delivery"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/resilience"
+)
+
+// Config encapsulates the configuration of the task queue.
+type Config struct {
+	// Topic is the message bus topic on which tasks are
+	// published.
+	Topic string `env:"TASKS_TOPIC" envDefault:"tasks"`
+
+	// DeadLetterTopic is the topic to which tasks are moved
+	// after exhausting all of their attempts.
+	DeadLetterTopic string `env:"TASKS_DEAD_LETTER_TOPIC" envDefault:"tasks.dead-letter"`
+
+	// MaxAttempts is the number of times a task is executed
+	// before it is moved to the dead-letter topic.
+	MaxAttempts int `env:"TASKS_MAX_ATTEMPTS" envDefault:"5"`
+
+	// Backoff is the delay before the first retry. Every
+	// following retry doubles the delay.
+	Backoff time.Duration `env:"TASKS_RETRY_BACKOFF" envDefault:"1s"`
+
+	// MaxBackoff caps the delay between retries.
+	MaxBackoff time.Duration `env:"TASKS_RETRY_MAX_BACKOFF" envDefault:"1m"`
+
+	// PollInterval is the interval at which the store of delayed
+	// tasks is polled for due tasks.
+	PollInterval time.Duration `env:"TASKS_POLL_INTERVAL" envDefault:"5s"`
+}
+
+// Handler executes a task with the given payload. Returning an error causes the
+// task to be retried.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Task is a task as it is published on the message bus.
+type Task struct {
+	ID      string `json:"id"`
+	Name    string `json:"name"`
+	Payload []byte `json:"payload"`
+
+	// Attempt is the number of the current attempt, starting
+	// from 1.
+	Attempt int `json:"attempt"`
+
+	// NotBefore delays the execution of the task.
+	NotBefore time.Time `json:"not_before"`
+
+	// LastError is the error of the previous attempt.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Queue publishes tasks and executes the received ones.
+type Queue struct {
+	bus service.MessageBus
+	cfg Config
+
+	mu       sync.RWMutex
+	handlers map[string]Handler
+	store    Store
+	clock    clock.Clock
+}
+
+// NewQueue creates a new [Queue] publishing tasks on the given bus.
+func NewQueue(bus service.MessageBus, cfg Config) *Queue {
+	if cfg.MaxAttempts <= 0 {
+		cfg.MaxAttempts = 1
+	}
+	return &Queue{bus: bus, cfg: cfg, handlers: make(map[string]Handler), clock: clock.Real}
+}
+
+// Register registers the handler executing the tasks with the given name.
+func (q *Queue) Register(name string, h Handler) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.handlers[name] = h
+}
+
+// Topic returns the message bus topic on which tasks are published.
+func (q *Queue) Topic() string { return q.cfg.Topic }
+
+// Enqueue publishes a new task with the given name and payload. This function
+// returns [service.ErrConnectionClosed] in case the connection to the message
+// broker is closed.
+func (q *Queue) Enqueue(ctx context.Context, name string, payload []byte) error {
+	return q.enqueue(ctx, name, payload, time.Time{})
+}
+
+// EnqueueIn is like [Queue.Enqueue], but the task is not executed before the
+// given delay has passed, see [Queue.EnqueueAt].
+func (q *Queue) EnqueueIn(ctx context.Context, d time.Duration, name string, payload []byte) error {
+	return q.EnqueueAt(ctx, q.now().Add(d), name, payload)
+}
+
+// EnqueueAt schedules a task to be executed at the given time. If a [Store] is
+// configured with [Queue.UseStore], the task is persisted and published once it
+// is due by [Queue.Poll], thus it survives restarts of the service. Otherwise
+// the task is published immediately and returned to the message bus by the
+// consumer until it is due, see [Queue.Handle]. This function returns
+// [service.ErrConnectionClosed] in case the connection to the message broker
+// is closed.
+func (q *Queue) EnqueueAt(ctx context.Context, when time.Time, name string, payload []byte) error {
+	q.mu.RLock()
+	s := q.store
+	q.mu.RUnlock()
+	if s == nil {
+		return q.enqueue(ctx, name, payload, when)
+	}
+
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	t := Task{ID: id, Name: name, Payload: payload, Attempt: 1, NotBefore: when}
+	if err := s.Save(ctx, t); err != nil {
+		return fmt.Errorf("save delayed task %s: %w", name, err)
+	}
+	tasksTotal.Inc(name, "scheduled")
+	return nil
+}
+
+// UseStore configures the store in which delayed tasks are persisted.
+func (q *Queue) UseStore(s Store) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.store = s
+}
+
+// UseClock makes the queue use the given clock for the due time of the tasks,
+// e.g. a fake clock in tests. The store of delayed tasks is still polled in
+// real time.
+func (q *Queue) UseClock(c clock.Clock) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	q.clock = clock.Or(c)
+}
+
+// Handle is the [service.EventHandler] executing the tasks received from the
+// message bus. The tasks that are not due yet are not held by the consumer,
+// which would block the other messages of the subscription, and lose the
+// tasks when the replica stops. They are saved to the store of delayed tasks
+// instead, and published again by [Queue.Poll] once due, or returned to the
+// message bus to be delivered again if no store is configured, see
+// [delivery.Message.Nack].
+func (q *Queue) Handle(ctx context.Context, msg []byte) {
+	delivery.Handler(q.handle)(ctx, msg)
+}
+
+// handle executes the task of the message, see [Queue.Handle].
+func (q *Queue) handle(ctx context.Context, m *delivery.Message) {
+	var t Task
+	if err := json.Unmarshal(m.Body, &t); err != nil {
+		slog.Error("failed to decode task", slog.String("error", err.Error()))
+		q.deadLetter(ctx, Task{Payload: m.Body, LastError: err.Error()})
+		return
+	}
+
+	q.mu.RLock()
+	h, ok := q.handlers[t.Name]
+	q.mu.RUnlock()
+	if !ok {
+		t.LastError = fmt.Sprintf("%v: no handler for task %q", service.ErrNotFound, t.Name)
+		q.deadLetter(ctx, t)
+		return
+	}
+
+	q.mu.RLock()
+	c, s := q.clock, q.store
+	q.mu.RUnlock()
+	if clock.Until(c, t.NotBefore) > 0 {
+		if s == nil {
+			m.Nack(true)
+			return
+		}
+		if err := s.Save(ctx, t); err != nil {
+			slog.Error("failed to save delayed task, returning it to the queue",
+				slog.String("task", t.Name),
+				slog.String("id", t.ID),
+				slog.String("error", err.Error()),
+			)
+			m.Nack(true)
+		}
+		return
+	}
+
+	start := time.Now()
+	err := run(ctx, h, t.Payload)
+	taskDuration.ObserveSince(start, t.Name)
+	if err == nil {
+		tasksTotal.Inc(t.Name, "success")
+		return
+	}
+
+	slog.Warn("task failed",
+		slog.String("task", t.Name),
+		slog.String("id", t.ID),
+		slog.Int("attempt", t.Attempt),
+		slog.String("error", err.Error()),
+	)
+	t.LastError = err.Error()
+	if t.Attempt >= q.cfg.MaxAttempts {
+		tasksTotal.Inc(t.Name, "dead-letter")
+		q.deadLetter(ctx, t)
+		return
+	}
+	tasksTotal.Inc(t.Name, "retry")
+	t.NotBefore = c.Now().Add(q.backoff(t.Attempt))
+	t.Attempt++
+	if err := q.retry(ctx, s, t); err != nil {
+		slog.Error("failed to retry task, returning it to the queue",
+			slog.String("task", t.Name),
+			slog.String("id", t.ID),
+			slog.String("error", err.Error()),
+		)
+		m.Nack(true)
+	}
+}
+
+// now returns the current time on the clock of the queue.
+func (q *Queue) now() time.Time {
+	q.mu.RLock()
+	defer q.mu.RUnlock()
+	return q.clock.Now()
+}
+
+func (q *Queue) enqueue(
+	ctx context.Context,
+	name string,
+	payload []byte,
+	notBefore time.Time,
+) error {
+	id, err := newID()
+	if err != nil {
+		return err
+	}
+	t := Task{ID: id, Name: name, Payload: payload, Attempt: 1, NotBefore: notBefore}
+	if err := q.publish(ctx, q.cfg.Topic, t); err != nil {
+		return err
+	}
+	tasksTotal.Inc(name, "enqueued")
+	return nil
+}
+
+// publish publishes the task on the given topic. Transient failures of the
+// message bus are retried.
+func (q *Queue) publish(ctx context.Context, topic string, t Task) error {
+	msg, err := json.Marshal(t)
+	if err != nil {
+		return fmt.Errorf("%w: encode task: %v", service.ErrUnexpected, err)
+	}
+	err = resilience.Retry(ctx, resilience.DefaultPolicy, func(ctx context.Context) error {
+		return q.bus.Publish(ctx, topic, msg)
+	})
+	if err != nil {
+		return fmt.Errorf("publish task %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+// retry schedules the next attempt of the task, which is due at t.NotBefore.
+// The task is saved to the store of delayed tasks, if any, otherwise it is
+// published right away, see [Queue.Handle].
+func (q *Queue) retry(ctx context.Context, s Store, t Task) error {
+	if s == nil {
+		return q.publish(ctx, q.cfg.Topic, t)
+	}
+	if err := s.Save(ctx, t); err != nil {
+		return fmt.Errorf("save delayed task %s: %w", t.Name, err)
+	}
+	return nil
+}
+
+// deadLetter moves the task to the dead-letter topic.
+func (q *Queue) deadLetter(ctx context.Context, t Task) {
+	if err := q.publish(ctx, q.cfg.DeadLetterTopic, t); err != nil {
+		slog.Error("failed to dead-letter task",
+			slog.String("task", t.Name),
+			slog.String("id", t.ID),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// backoff returns the delay before the retry following the given attempt.
+func (q *Queue) backoff(attempt int) time.Duration {
+	d := q.cfg.Backoff
+	for i := 1; i < attempt && d < q.cfg.MaxBackoff; i++ {
+		d *= 2
+	}
+	if q.cfg.MaxBackoff > 0 {
+		d = min(d, q.cfg.MaxBackoff)
+	}
+	return d
+}
+
+// run executes the handler, converting panics into errors.
+func run(ctx context.Context, h Handler, payload []byte) (err error) {
+	defer func() {
+		if msg := recover(); msg != nil {
+			err = fmt.Errorf("%w: panic: %v", service.ErrUnexpected, msg)
+		}
+	}()
+	return h(ctx, payload)
+}
+
+// newID generates a random task id.
+func newID() (string, error) {
+	b := make([]byte, 16) //nolint:gomnd // 128 bits
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w: generate task id: %v", service.ErrUnexpected, err)
+	}
+	return hex.EncodeToString(b), nil
+}
+
+var (
+	tasksTotal = metrics.NewCounter(
+		"tasks_total",
+		"Number of tasks by outcome.",
+		"task", "outcome",
+	)
+	taskDuration = metrics.NewHistogram(
+		"tasks_duration_seconds",
+		"Duration of task executions in seconds.",
+		nil,
+		"task",
+	)
+)
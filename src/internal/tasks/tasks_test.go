@@ -0,0 +1,154 @@
+package tasks
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/delivery"
+	"github.com/eventscompass/service-template/src/internal/membus"
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestQueueHandle(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name           string
+		notBefore      time.Time
+		fail           bool
+		withStore      bool
+		wantRuns       int
+		wantSettlement delivery.Settlement
+		wantSaved      []Task
+		wantPublished  []Task
+	}{
+		{
+			name:           "due",
+			notBefore:      now,
+			wantRuns:       1,
+			wantSettlement: delivery.Unsettled,
+		},
+		{
+			name:           "not due without store",
+			notBefore:      now.Add(time.Hour),
+			wantSettlement: delivery.Requeued,
+		},
+		{
+			name:           "not due with store",
+			notBefore:      now.Add(time.Hour),
+			withStore:      true,
+			wantSettlement: delivery.Unsettled,
+			wantSaved:      []Task{{ID: "t-1", Name: "resize", Attempt: 1, NotBefore: now.Add(time.Hour)}},
+		},
+		{
+			name:           "failed without store",
+			notBefore:      now,
+			fail:           true,
+			wantRuns:       1,
+			wantSettlement: delivery.Unsettled,
+			wantPublished: []Task{
+				{ID: "t-1", Name: "resize", Attempt: 2, NotBefore: now.Add(time.Second), LastError: "boom"},
+			},
+		},
+		{
+			name:           "failed with store",
+			notBefore:      now,
+			fail:           true,
+			withStore:      true,
+			wantRuns:       1,
+			wantSettlement: delivery.Unsettled,
+			wantSaved: []Task{
+				{ID: "t-1", Name: "resize", Attempt: 2, NotBefore: now.Add(time.Second), LastError: "boom"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			bus := membus.New()
+			q := NewQueue(bus, Config{Topic: "tasks", MaxAttempts: 3, Backoff: time.Second})
+			q.UseClock(servicetest.NewFakeClock(now))
+			store := &memoryStore{}
+			if tt.withStore {
+				q.UseStore(store)
+			}
+			var runs int
+			q.Register("resize", func(context.Context, []byte) error {
+				runs++
+				if tt.fail {
+					return errors.New("boom")
+				}
+				return nil
+			})
+
+			msg, _ := json.Marshal(Task{ID: "t-1", Name: "resize", Attempt: 1, NotBefore: tt.notBefore})
+			s, err := delivery.Handle(context.Background(), q.Handle, &delivery.Message{Body: msg, Attempt: 1})
+			if s != tt.wantSettlement || err != nil {
+				t.Errorf("got settlement %v, %v, want %v", s, err, tt.wantSettlement)
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("got %d runs, want %d", runs, tt.wantRuns)
+			}
+			assertTasks(t, "saved", store.tasks, tt.wantSaved)
+			var published []Task
+			for _, b := range bus.Published("tasks") {
+				var p Task
+				if err := json.Unmarshal(b, &p); err != nil {
+					t.Fatalf("decode published task: %v", err)
+				}
+				published = append(published, p)
+			}
+			assertTasks(t, "published", published, tt.wantPublished)
+		})
+	}
+}
+
+func TestQueueHandleDeadLetter(t *testing.T) {
+	bus := membus.New()
+	q := NewQueue(bus, Config{Topic: "tasks", DeadLetterTopic: "tasks.dead-letter", MaxAttempts: 2})
+	q.Register("resize", func(context.Context, []byte) error { return errors.New("boom") })
+	msg, _ := json.Marshal(Task{ID: "t-1", Name: "resize", Attempt: 2})
+	q.Handle(context.Background(), msg)
+	if n := len(bus.Published("tasks.dead-letter")); n != 1 {
+		t.Errorf("got %d dead-lettered tasks, want 1", n)
+	}
+	if n := len(bus.Published("tasks")); n != 0 {
+		t.Errorf("got %d retries after the last attempt, want 0", n)
+	}
+}
+
+func assertTasks(t *testing.T, what string, got, want []Task) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d %s tasks, want %d", len(got), what, len(want))
+	}
+	for i := range got {
+		g, w := got[i], want[i]
+		if g.ID != w.ID || g.Name != w.Name || g.Attempt != w.Attempt ||
+			!g.NotBefore.Equal(w.NotBefore) || g.LastError != w.LastError {
+			t.Errorf("got %s task %+v, want %+v", what, g, w)
+		}
+	}
+}
+
+// memoryStore is a [Store] recording the saved tasks.
+type memoryStore struct {
+	mu    sync.Mutex
+	tasks []Task
+}
+
+func (s *memoryStore) Save(_ context.Context, t Task) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tasks = append(s.tasks, t)
+	return nil
+}
+
+func (s *memoryStore) Claim(context.Context, time.Time, time.Duration, int) ([]Task, error) {
+	return nil, nil
+}
+
+func (s *memoryStore) Delete(context.Context, string) error { return nil }
@@ -0,0 +1,356 @@
+package tenant
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/flight"
+	"github.com/eventscompass/service-template/src/internal/httperr"
+	"github.com/eventscompass/service-template/src/internal/quota"
+)
+
+// SettingsConfig encapsulates the configuration of the per-tenant settings.
+type SettingsConfig struct {
+	// File is the path of the json file of the plans and tenants,
+	// see [StaticProvider]. Empty serves every tenant the zero
+	// settings.
+	File string `env:"TENANT_SETTINGS_FILE"`
+
+	// CacheTTL is the time the settings of a tenant are cached,
+	// see [CachedProvider].
+	CacheTTL time.Duration `env:"TENANT_SETTINGS_CACHE_TTL" envDefault:"1m"`
+}
+
+// Settings are the limits and features of a tenant, usually those of its plan
+// with overrides for the tenant.
+type Settings struct {
+	// Plan names the plan of the tenant, e.g. "free".
+	Plan string `json:"plan,omitempty"`
+
+	// RequestsPerMinute and RequestsPerDay are the quotas of the
+	// tenant, see [QuotaLimits]. Zero disables the limit.
+	RequestsPerMinute int64 `json:"requests_per_minute,omitempty"`
+	RequestsPerDay    int64 `json:"requests_per_day,omitempty"`
+
+	// Features are the feature flags of the tenant, see [Enabled].
+	Features map[string]bool `json:"features,omitempty"`
+
+	// Limits are the named limits of the tenant, e.g. the maximum
+	// number of projects, see [Limit].
+	Limits map[string]int64 `json:"limits,omitempty"`
+}
+
+// Merge returns the settings with the non-zero fields of the overrides
+// applied. Features and limits are merged key by key.
+func (s Settings) Merge(o Settings) Settings {
+	if o.Plan != "" {
+		s.Plan = o.Plan
+	}
+	if o.RequestsPerMinute != 0 {
+		s.RequestsPerMinute = o.RequestsPerMinute
+	}
+	if o.RequestsPerDay != 0 {
+		s.RequestsPerDay = o.RequestsPerDay
+	}
+	if len(o.Features) > 0 {
+		s.Features = maps.Clone(s.Features)
+		if s.Features == nil {
+			s.Features = make(map[string]bool, len(o.Features))
+		}
+		maps.Copy(s.Features, o.Features)
+	}
+	if len(o.Limits) > 0 {
+		s.Limits = maps.Clone(s.Limits)
+		if s.Limits == nil {
+			s.Limits = make(map[string]int64, len(o.Limits))
+		}
+		maps.Copy(s.Limits, o.Limits)
+	}
+	return s
+}
+
+// Provider provides the settings of the tenants.
+type Provider interface {
+	// Settings returns the settings of the tenant. This function
+	// returns [service.ErrNotFound] in case the tenant is unknown.
+	Settings(_ context.Context, tenant string) (*Settings, error)
+}
+
+// NewProvider creates the [Provider] configured by cfg: the plans and tenants
+// of the settings file, cached for the configured ttl. This function returns
+// [service.ErrBadRequest] in case the file is malformed.
+func NewProvider(cfg SettingsConfig) (Provider, error) {
+	if cfg.File == "" {
+		return &StaticProvider{}, nil
+	}
+	p, err := LoadStatic(cfg.File)
+	if err != nil {
+		return nil, err
+	}
+	return NewCachedProvider(p, cfg.CacheTTL), nil
+}
+
+// StaticProvider provides fixed settings, e.g. loaded from a file, see
+// [LoadStatic]. The settings of a tenant are those of its plan, or of the
+// default plan, merged with the overrides of the tenant.
+type StaticProvider struct {
+	// DefaultPlan is the plan of the tenants that are not listed,
+	// or list no plan. Empty makes unlisted tenants unknown.
+	DefaultPlan string `json:"default_plan"`
+
+	// Plans are the settings by plan.
+	Plans map[string]Settings `json:"plans"`
+
+	// Tenants are the overrides by tenant.
+	Tenants map[string]Settings `json:"tenants"`
+}
+
+var _ Provider = (*StaticProvider)(nil)
+
+// LoadStatic loads a [StaticProvider] from the json file at path. This
+// function returns [service.ErrBadRequest] in case the file is malformed or
+// refers to unknown plans.
+func LoadStatic(path string) (*StaticProvider, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("%w: read tenant settings: %v", service.ErrBadRequest, err)
+	}
+	var p StaticProvider
+	if err := json.Unmarshal(data, &p); err != nil {
+		return nil, fmt.Errorf("%w: parse tenant settings: %v", service.ErrBadRequest, err)
+	}
+	if _, ok := p.Plans[p.DefaultPlan]; p.DefaultPlan != "" && !ok {
+		return nil, fmt.Errorf("%w: unknown default plan %q", service.ErrBadRequest, p.DefaultPlan)
+	}
+	for t, s := range p.Tenants {
+		if _, ok := p.Plans[s.Plan]; s.Plan != "" && !ok {
+			return nil, fmt.Errorf("%w: unknown plan %q of tenant %q", service.ErrBadRequest, s.Plan, t)
+		}
+	}
+	return &p, nil
+}
+
+// Settings implements the [Provider] interface.
+func (p *StaticProvider) Settings(_ context.Context, tenant string) (*Settings, error) {
+	override, listed := p.Tenants[tenant]
+	plan := override.Plan
+	if plan == "" {
+		plan = p.DefaultPlan
+	}
+	if !listed && plan == "" {
+		if len(p.Plans) == 0 && len(p.Tenants) == 0 {
+			return &Settings{}, nil // nothing configured
+		}
+		return nil, fmt.Errorf("%w: tenant %q", service.ErrNotFound, tenant)
+	}
+	s := Settings{Plan: plan}.Merge(p.Plans[plan]).Merge(override)
+	return &s, nil
+}
+
+// CachedProvider caches the settings of another [Provider]. Unknown tenants are
+// cached as well. Changed settings apply once the cache entry expires.
+type CachedProvider struct {
+	provider Provider
+	ttl      time.Duration
+
+	// flight collapses the concurrent misses of a tenant.
+	flight *flight.Group[string, *Settings]
+
+	mu      sync.Mutex
+	entries map[string]cachedSettings
+}
+
+var _ Provider = (*CachedProvider)(nil)
+
+// NewCachedProvider creates a new [CachedProvider] caching the settings
+// provided by p for the given ttl.
+func NewCachedProvider(p Provider, ttl time.Duration) *CachedProvider {
+	return &CachedProvider{
+		provider: p,
+		ttl:      ttl,
+		flight:   flight.NewGroup[string, *Settings]("tenant_settings"),
+		entries:  make(map[string]cachedSettings),
+	}
+}
+
+// Settings implements the [Provider] interface.
+func (p *CachedProvider) Settings(ctx context.Context, tenant string) (*Settings, error) {
+	now := time.Now()
+	p.mu.Lock()
+	e, ok := p.entries[tenant]
+	p.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		if e.settings == nil {
+			return nil, fmt.Errorf("%w: tenant %q", service.ErrNotFound, tenant)
+		}
+		return e.settings, nil
+	}
+
+	return p.flight.Do(ctx, tenant, func(ctx context.Context) (*Settings, error) {
+		return p.fetch(ctx, tenant, now)
+	})
+}
+
+// fetch gets the settings of the tenant from the provider and caches them.
+func (p *CachedProvider) fetch(
+	ctx context.Context,
+	tenant string,
+	now time.Time,
+) (*Settings, error) {
+	s, err := p.provider.Settings(ctx, tenant)
+	if err != nil && !errors.Is(err, service.ErrNotFound) {
+		return nil, err
+	}
+
+	p.mu.Lock()
+	if len(p.entries) >= maxCachedSettings {
+		for t, e := range p.entries {
+			if now.After(e.expires) {
+				delete(p.entries, t)
+			}
+		}
+		if len(p.entries) >= maxCachedSettings {
+			p.entries = make(map[string]cachedSettings)
+		}
+	}
+	p.entries[tenant] = cachedSettings{settings: s, expires: now.Add(p.ttl)}
+	p.mu.Unlock()
+	return s, err
+}
+
+// WithSettings returns a copy of ctx carrying the settings of the tenant.
+func WithSettings(ctx context.Context, s *Settings) context.Context {
+	return context.WithValue(ctx, settingsKey{}, s)
+}
+
+// SettingsFrom returns the settings of the tenant carried by ctx, see
+// [SettingsMiddleware]. Returns false if the request has no tenant.
+func SettingsFrom(ctx context.Context) (*Settings, bool) {
+	s, ok := ctx.Value(settingsKey{}).(*Settings)
+	return s, ok && s != nil
+}
+
+// SettingsMiddleware returns an http middleware putting the settings of the
+// tenant of every request into the request context. Requests of unknown
+// tenants are rejected with 403. The middleware must run after [Middleware].
+func SettingsMiddleware(p Provider) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, err := withProvided(r.Context(), p)
+			if err != nil {
+				httperr.Write(r.Context(), w, err)
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+// SettingsUnaryInterceptor returns a grpc interceptor putting the settings of
+// the tenant of every call into the context, see [SettingsMiddleware]. It
+// must run after [UnaryServerInterceptor].
+func SettingsUnaryInterceptor(p Provider) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		ctx, err := withProvided(ctx, p)
+		if err != nil {
+			if errors.Is(err, service.ErrNotAllowed) {
+				return nil, grpcError(err)
+			}
+			return nil, status.Error(codes.Unavailable, err.Error())
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Enabled reports whether the feature is enabled for the tenant of ctx.
+// Features are disabled for requests without tenant.
+func Enabled(ctx context.Context, feature string) bool {
+	s, ok := SettingsFrom(ctx)
+	return ok && s.Features[feature]
+}
+
+// Limit returns the named limit of the tenant of ctx, or def if the tenant
+// has no such limit.
+func Limit(ctx context.Context, name string, def int64) int64 {
+	if s, ok := SettingsFrom(ctx); ok {
+		if v, ok := s.Limits[name]; ok {
+			return v
+		}
+	}
+	return def
+}
+
+// QuotaLimits returns the quota limits of the tenant of ctx. Use it with
+// [quota.Limiter.UseLimits] to enforce the quotas of the plans, and [QuotaKey]
+// to count the requests per tenant. Returns false if the request has no
+// tenant, or its plan sets no quota.
+func QuotaLimits(ctx context.Context) ([]quota.Limit, bool) {
+	s, ok := SettingsFrom(ctx)
+	if !ok || (s.RequestsPerMinute == 0 && s.RequestsPerDay == 0) {
+		return nil, false
+	}
+	return quota.Config{PerMinute: s.RequestsPerMinute, PerDay: s.RequestsPerDay}.Limits(), true
+}
+
+// QuotaKey identifies the caller of a call by the tenant of ctx, see
+// [quota.UnaryServerInterceptor].
+func QuotaKey(ctx context.Context) (string, bool) {
+	t, ok := From(ctx)
+	if !ok {
+		return "", false
+	}
+	return "tenant/" + t, true
+}
+
+// ByTenant identifies the caller of a request by its tenant, see
+// [quota.Middleware].
+func ByTenant(r *http.Request) (string, bool) { return QuotaKey(r.Context()) }
+
+// withProvided returns a copy of ctx carrying the settings of its tenant, or
+// ctx if it has no tenant. This function returns [service.ErrNotAllowed] in
+// case the tenant is unknown.
+func withProvided(ctx context.Context, p Provider) (context.Context, error) {
+	t, ok := From(ctx)
+	if !ok {
+		return ctx, nil
+	}
+	s, err := p.Settings(ctx, t)
+	if errors.Is(err, service.ErrNotFound) {
+		return nil, fmt.Errorf("%w: unknown tenant %q", service.ErrNotAllowed, t)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return WithSettings(ctx, s), nil
+}
+
+// cachedSettings is an entry of a [CachedProvider]. Nil settings mean that the
+// tenant is unknown.
+type cachedSettings struct {
+	settings *Settings
+	expires  time.Time
+}
+
+// settingsKey is the context key of the settings of the tenant.
+type settingsKey struct{}
+
+// maxCachedSettings bounds the number of tenants cached by a
+// [CachedProvider].
+const maxCachedSettings = 10000
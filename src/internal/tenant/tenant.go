@@ -0,0 +1,330 @@
+// Package tenant carries the tenant of a request through the service, for
+// services serving several tenants from the same instances.
+//
+// The http middleware and the grpc interceptors extract the tenant from the
+// request, see [Config], and put it into the context, where handlers retrieve
+// it with [From]. Tenant-scoped routes reject requests without tenant, see
+// [Require]. The tenant is propagated to the calls of the service: to other
+// services with [Transport] and [UnaryClientInterceptor], and to the consumers
+// of its events with [Inject] and [Extract]:
+//
+//	meta := codec.Meta{Headers: tenant.Inject(ctx, nil)}
+//	err := codec.PublishEnvelope(ctx, bus, codec.Proto, topic, meta, event)
+//
+//	codec.EnvelopeHandler(func(ctx context.Context, meta codec.Meta, e *eventsv1.ExampleCreated) {
+//		ctx = tenant.Extract(ctx, meta.Headers)
+//		...
+//	})
+//
+// Tenants on different plans get different limits and features, see
+// [Settings]. The settings of the tenant of a request are loaded from a
+// [Provider] by [SettingsMiddleware], and queried with [Enabled], [Limit] and
+// [QuotaLimits]:
+//
+//	limiter := quota.NewLimiter(store, cfg.Quota.Limits()...)
+//	limiter.UseLimits(tenant.QuotaLimits)
+//	h = quota.Middleware(limiter, tenant.ByTenant)(h)
+//	h = tenant.SettingsMiddleware(provider)(h)
+//	h = tenant.Middleware(cfg.Tenant)(h)
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/httperr"
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+// Config encapsulates the configuration for extracting the tenant of a
+// request. The sources are tried in order: the claim of the authenticated
+// principal, the header, and the subdomain. A header contradicting the claim
+// is rejected, and so is a header sent by a principal without the claim,
+// unless the principal is one of the trusted callers. Thus authenticated
+// callers cannot act for tenants they do not belong to. Anonymous requests,
+// e.g. to public routes, may name any tenant.
+type Config struct {
+	// Header is the request header, and grpc metadata key, that
+	// carries the tenant. It is also set on outbound calls.
+	Header string `env:"TENANT_HEADER" envDefault:"X-Tenant-ID"`
+
+	// Claim is the claim of the principal that holds the tenant,
+	// see [auth.Principal]. Empty disables the claim.
+	Claim string `env:"TENANT_CLAIM" envDefault:"tenant_id"`
+
+	// BaseDomain enables tenants by subdomain, e.g. "acme" for
+	// "acme.example.com" if the base domain is "example.com".
+	BaseDomain string `env:"TENANT_BASE_DOMAIN"`
+
+	// TrustedCallers are the principals allowed to act for any
+	// tenant, e.g. other services calling with an api key, as
+	// issuer/subject, e.g. "api-key/billing".
+	TrustedCallers []string `env:"TENANT_TRUSTED_CALLERS"`
+}
+
+// WithTenant returns a copy of ctx carrying the tenant, see
+// [reqctx.WithTenant].
+func WithTenant(ctx context.Context, tenant string) context.Context {
+	return reqctx.WithTenant(ctx, tenant)
+}
+
+// From returns the tenant carried by ctx. Returns false if the request has no
+// tenant. It is the same as [reqctx.TenantFrom].
+func From(ctx context.Context) (string, bool) {
+	return reqctx.TenantFrom(ctx)
+}
+
+// Middleware returns an http middleware putting the tenant of every request
+// into the request context. Requests without tenant pass, see [Require];
+// requests naming an invalid tenant, or one contradicting the claim of the
+// principal, are rejected with 400 and 403 respectively. The middleware must
+// run after the authentication middleware, see [auth.Middleware].
+func Middleware(cfg Config) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx := r.Context()
+			t, err := resolve(ctx, cfg, r.Header.Get(cfg.Header), r.Host)
+			if err != nil {
+				httperr.Write(ctx, w, err)
+				return
+			}
+			if t != "" {
+				r = r.WithContext(WithTenant(ctx, t))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Require returns an http middleware rejecting requests without tenant with
+// 400, for the tenant-scoped routes.
+func Require(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := From(r.Context()); !ok {
+			httperr.Write(r.Context(), w, errMissing)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// UnaryServerInterceptor returns a grpc interceptor putting the tenant of
+// every call into the context, see [Middleware]. The tenant is read from the
+// metadata.
+func UnaryServerInterceptor(cfg Config) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		_ *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		ctx, err := fromMetadata(ctx, cfg)
+		if err != nil {
+			return nil, err
+		}
+		return handler(ctx, req)
+	}
+}
+
+// StreamServerInterceptor is the streaming counterpart of
+// [UnaryServerInterceptor].
+func StreamServerInterceptor(cfg Config) grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		_ *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx, err := fromMetadata(ss.Context(), cfg)
+		if err != nil {
+			return err
+		}
+		return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+// RequireUnary returns a grpc interceptor rejecting calls of the tenant-scoped
+// methods without tenant with codes.InvalidArgument. The methods are full
+// method names, e.g. "/events.v1.Events/GetEvent".
+func RequireUnary(methods ...string) grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		if _, ok := From(ctx); !ok && slices.Contains(methods, info.FullMethod) {
+			return nil, grpcError(errMissing)
+		}
+		return handler(ctx, req)
+	}
+}
+
+// Transport returns an http transport setting the tenant of the request
+// context as header of outbound requests, see [client.NewHTTPWithTransport].
+func Transport(cfg Config, next http.RoundTripper) http.RoundTripper {
+	return roundTripper(func(req *http.Request) (*http.Response, error) {
+		if t, ok := From(req.Context()); ok && req.Header.Get(cfg.Header) == "" {
+			req = req.Clone(req.Context())
+			req.Header.Set(cfg.Header, t)
+		}
+		return next.RoundTrip(req) //nolint:wrapcheck // transparent transport
+	})
+}
+
+// UnaryClientInterceptor returns a grpc interceptor setting the tenant of the
+// context as metadata of outbound calls.
+func UnaryClientInterceptor(cfg Config) grpc.UnaryClientInterceptor {
+	key := strings.ToLower(cfg.Header)
+	return func(
+		ctx context.Context,
+		method string,
+		req, reply any,
+		cc *grpc.ClientConn,
+		invoker grpc.UnaryInvoker,
+		opts ...grpc.CallOption,
+	) error {
+		if t, ok := From(ctx); ok {
+			ctx = metadata.AppendToOutgoingContext(ctx, key, t)
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// Inject adds the tenant of ctx to the headers of an event, see
+// [codec.Meta], or of a message, see [delivery.Metadata]. The headers are
+// allocated if nil.
+func Inject(ctx context.Context, headers map[string]string) map[string]string {
+	t, ok := From(ctx)
+	if !ok {
+		return headers
+	}
+	if headers == nil {
+		headers = make(map[string]string)
+	}
+	headers[eventHeader] = t
+	return headers
+}
+
+// Extract returns a copy of ctx carrying the tenant of the headers of an
+// event, see [Inject].
+func Extract(ctx context.Context, headers map[string]string) context.Context {
+	if t := headers[eventHeader]; t != "" {
+		return WithTenant(ctx, t)
+	}
+	return ctx
+}
+
+// resolve returns the tenant of a request, or "" if it has none. This function
+// returns [service.ErrBadRequest] in case the tenant is malformed, and
+// [service.ErrNotAllowed] in case the principal does not belong to the
+// requested tenant.
+func resolve(ctx context.Context, cfg Config, header, host string) (string, error) {
+	var claimed string
+	p, authenticated := reqctx.PrincipalFrom(ctx)
+	if authenticated && cfg.Claim != "" {
+		claimed, _ = p.Claims[cfg.Claim].(string)
+	}
+	requested := header
+	if requested == "" && cfg.BaseDomain != "" {
+		requested = subdomain(host, cfg.BaseDomain)
+	}
+
+	switch {
+	case claimed != "" && requested != "" && requested != claimed:
+		return "", fmt.Errorf("%w: principal does not belong to tenant %q",
+			service.ErrNotAllowed, requested)
+	case claimed != "":
+		return claimed, nil
+	case requested == "":
+		return "", nil
+	case authenticated && cfg.Claim != "" && !trusted(cfg, p):
+		return "", fmt.Errorf("%w: principal does not belong to tenant %q",
+			service.ErrNotAllowed, requested)
+	case !validTenant.MatchString(requested):
+		return "", fmt.Errorf("%w: malformed tenant %q", service.ErrBadRequest, requested)
+	default:
+		return requested, nil
+	}
+}
+
+// trusted reports whether the principal may act for any tenant.
+func trusted(cfg Config, p *reqctx.Principal) bool {
+	return slices.Contains(cfg.TrustedCallers, p.Issuer+"/"+p.Subject)
+}
+
+// subdomain returns the label of the host below the base domain, e.g. "acme"
+// for "acme.example.com:8080".
+func subdomain(host, base string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	label, ok := strings.CutSuffix(strings.ToLower(host), "."+strings.ToLower(base))
+	if !ok || strings.Contains(label, ".") {
+		return ""
+	}
+	return label
+}
+
+// fromMetadata puts the tenant of the incoming metadata into the context.
+func fromMetadata(ctx context.Context, cfg Config) (context.Context, error) {
+	var header string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if v := md.Get(cfg.Header); len(v) > 0 {
+			header = v[0]
+		}
+	}
+	t, err := resolve(ctx, cfg, header, "")
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	if t == "" {
+		return ctx, nil
+	}
+	return WithTenant(ctx, t), nil
+}
+
+// grpcError converts the errors of the package to grpc status errors.
+func grpcError(err error) error {
+	code := codes.InvalidArgument
+	if errors.Is(err, service.ErrNotAllowed) {
+		code = codes.PermissionDenied
+	}
+	return status.Error(code, err.Error())
+}
+
+// serverStream overrides the context of a grpc server stream.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context //nolint:containedctx // the stream context
+}
+
+func (s *serverStream) Context() context.Context { return s.ctx }
+
+// roundTripper adapts a function to the [http.RoundTripper] interface.
+type roundTripper func(*http.Request) (*http.Response, error)
+
+func (f roundTripper) RoundTrip(req *http.Request) (*http.Response, error) { return f(req) }
+
+// eventHeader is the header of the events carrying the tenant.
+const eventHeader = "tenant"
+
+var (
+	// errMissing is returned for tenant-scoped requests without tenant.
+	errMissing = fmt.Errorf("%w: tenant required", service.ErrBadRequest)
+
+	// validTenant matches the tenant ids accepted from requests.
+	validTenant = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_-]{0,62}$`)
+)
@@ -0,0 +1,222 @@
+package tenant
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+
+	"github.com/eventscompass/service-template/src/internal/reqctx"
+)
+
+var testConfig = Config{
+	Header:         "X-Tenant-ID",
+	Claim:          "tenant_id",
+	BaseDomain:     "example.com",
+	TrustedCallers: []string{"api-key/billing"},
+}
+
+// resolveTests are shared by the http and the grpc tests. The grpc tests
+// skip the cases with a host.
+var resolveTests = []struct {
+	name       string
+	principal  *reqctx.Principal
+	header     string
+	host       string
+	wantTenant string
+	wantStatus int
+}{
+	{
+		name:       "anonymous without tenant",
+		wantStatus: http.StatusOK,
+	},
+	{
+		name:       "anonymous with header",
+		header:     "acme",
+		wantTenant: "acme",
+		wantStatus: http.StatusOK,
+	},
+	{
+		name:       "anonymous with subdomain",
+		host:       "acme.example.com:8080",
+		wantTenant: "acme",
+		wantStatus: http.StatusOK,
+	},
+	{
+		name:       "anonymous with malformed header",
+		header:     "acme/../other",
+		wantStatus: http.StatusBadRequest,
+	},
+	{
+		name:       "claim",
+		principal:  principal("alice", "tenant_id", "acme"),
+		wantTenant: "acme",
+		wantStatus: http.StatusOK,
+	},
+	{
+		name:       "claim and matching header",
+		principal:  principal("alice", "tenant_id", "acme"),
+		header:     "acme",
+		wantTenant: "acme",
+		wantStatus: http.StatusOK,
+	},
+	{
+		name:       "claim and other header",
+		principal:  principal("alice", "tenant_id", "acme"),
+		header:     "other",
+		wantStatus: http.StatusForbidden,
+	},
+	{
+		name:       "claim and other subdomain",
+		principal:  principal("alice", "tenant_id", "acme"),
+		host:       "other.example.com",
+		wantStatus: http.StatusForbidden,
+	},
+	{
+		name:       "principal without claim and header",
+		principal:  principal("alice", "", nil),
+		header:     "acme",
+		wantStatus: http.StatusForbidden,
+	},
+	{
+		name:       "principal without claim and subdomain",
+		principal:  principal("alice", "", nil),
+		host:       "acme.example.com",
+		wantStatus: http.StatusForbidden,
+	},
+	{
+		name:       "principal without claim nor tenant",
+		principal:  principal("alice", "", nil),
+		wantStatus: http.StatusOK,
+	},
+	{
+		name:       "non-string claim and header",
+		principal:  principal("alice", "tenant_id", 42),
+		header:     "acme",
+		wantStatus: http.StatusForbidden,
+	},
+	{
+		name:       "trusted caller and header",
+		principal:  &reqctx.Principal{Subject: "billing", Issuer: "api-key"},
+		header:     "acme",
+		wantTenant: "acme",
+		wantStatus: http.StatusOK,
+	},
+	{
+		name:       "trusted subject of another issuer",
+		principal:  &reqctx.Principal{Subject: "billing", Issuer: "https://idp.example.com"},
+		header:     "acme",
+		wantStatus: http.StatusForbidden,
+	},
+}
+
+func TestMiddleware(t *testing.T) {
+	for _, tt := range resolveTests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			var got string
+			h := Middleware(testConfig)(http.HandlerFunc(func(_ http.ResponseWriter, r *http.Request) {
+				got, _ = From(r.Context())
+			}))
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			if tt.host != "" {
+				r.Host = tt.host
+			}
+			if tt.header != "" {
+				r.Header.Set("X-Tenant-ID", tt.header)
+			}
+			if tt.principal != nil {
+				r = r.WithContext(reqctx.WithPrincipal(r.Context(), tt.principal))
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("got status %d, want %d", w.Code, tt.wantStatus)
+			}
+			if got != tt.wantTenant {
+				t.Errorf("got tenant %q, want %q", got, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	codeOf := map[int]codes.Code{
+		http.StatusOK:         codes.OK,
+		http.StatusBadRequest: codes.InvalidArgument,
+		http.StatusForbidden:  codes.PermissionDenied,
+	}
+	for _, tt := range resolveTests {
+		tt := tt
+		if tt.host != "" {
+			continue
+		}
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.header != "" {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs("x-tenant-id", tt.header))
+			}
+			if tt.principal != nil {
+				ctx = reqctx.WithPrincipal(ctx, tt.principal)
+			}
+			var got string
+			_, err := UnaryServerInterceptor(testConfig)(ctx, nil, &grpc.UnaryServerInfo{},
+				func(ctx context.Context, _ any) (any, error) {
+					got, _ = From(ctx)
+					return nil, nil
+				})
+			if code := status.Code(err); code != codeOf[tt.wantStatus] {
+				t.Fatalf("got code %v, want %v", code, codeOf[tt.wantStatus])
+			}
+			if got != tt.wantTenant {
+				t.Errorf("got tenant %q, want %q", got, tt.wantTenant)
+			}
+		})
+	}
+}
+
+func TestRequire(t *testing.T) {
+	h := Require(http.HandlerFunc(func(http.ResponseWriter, *http.Request) {}))
+	tests := []struct {
+		name   string
+		ctx    context.Context
+		status int
+	}{
+		{"with tenant", WithTenant(context.Background(), "acme"), http.StatusOK},
+		{"without tenant", context.Background(), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/", nil).WithContext(tt.ctx))
+			if w.Code != tt.status {
+				t.Errorf("got status %d, want %d", w.Code, tt.status)
+			}
+		})
+	}
+}
+
+func TestInjectExtract(t *testing.T) {
+	headers := Inject(WithTenant(context.Background(), "acme"), nil)
+	if got, _ := From(Extract(context.Background(), headers)); got != "acme" {
+		t.Errorf("got tenant %q after the round trip, want %q", got, "acme")
+	}
+	if got := Inject(context.Background(), nil); got != nil {
+		t.Errorf("got headers %v without tenant, want nil", got)
+	}
+}
+
+// principal returns a principal with the given claim, if any.
+func principal(subject, claim string, value any) *reqctx.Principal {
+	p := &reqctx.Principal{Subject: subject, Issuer: "https://idp.example.com", Claims: map[string]any{}}
+	if claim != "" {
+		p.Claims[claim] = value
+	}
+	return p
+}
@@ -0,0 +1,159 @@
+// Package tlsconfig builds the tls configuration of the servers of the service
+// from certificate files, e.g. the ones mounted from a kubernetes secret or
+// written by cert-manager.
+//
+// The certificate is reloaded once its files change, thus rotated
+// certificates are picked up without restarting the service. The client
+// certificates are verified against the bundle of CAs if one is configured,
+// which is mutual TLS if they are required too.
+package tlsconfig
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+// Config encapsulates the tls configuration of a server. It is usually
+// embedded with a prefix naming the server, e.g.
+//
+//	GRPCTLS tlsconfig.Config `envPrefix:"GRPC_"`
+type Config struct {
+	// CertFile and KeyFile are the pem encoded certificate chain and
+	// private key of the server. Empty disables tls.
+	CertFile string `env:"TLS_CERT_FILE"`
+	KeyFile  string `env:"TLS_KEY_FILE"`
+
+	// CAFile is the pem encoded bundle of the CAs that the client
+	// certificates are verified against. Empty accepts no client
+	// certificates.
+	CAFile string `env:"TLS_CA_FILE"`
+
+	// RequireClientCert rejects the clients without a certificate
+	// verified against CAFile, i.e. enables mutual TLS.
+	RequireClientCert bool `env:"TLS_REQUIRE_CLIENT_CERT"`
+}
+
+// Enabled reports whether the server is configured to serve tls.
+func (c Config) Enabled() bool { return c.CertFile != "" || c.KeyFile != "" }
+
+// Server returns the tls configuration of a server, or nil if tls is not
+// enabled. This function returns [service.ErrBadRequest] in case the
+// configuration is incomplete, or the files cannot be loaded.
+func Server(c Config) (*tls.Config, error) {
+	if !c.Enabled() {
+		if c.CAFile != "" || c.RequireClientCert {
+			return nil, fmt.Errorf("%w: client certificates require a server certificate",
+				service.ErrBadRequest)
+		}
+		return nil, nil //nolint:nilnil // tls is optional
+	}
+	if c.CertFile == "" || c.KeyFile == "" {
+		return nil, fmt.Errorf("%w: both the tls certificate and key files are required",
+			service.ErrBadRequest)
+	}
+	if c.RequireClientCert && c.CAFile == "" {
+		return nil, fmt.Errorf("%w: requiring client certificates needs a ca file", service.ErrBadRequest)
+	}
+
+	r := &reloader{certFile: c.CertFile, keyFile: c.KeyFile}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	cfg := &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: r.certificate,
+	}
+	if c.CAFile != "" {
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: read tls ca file: %v", service.ErrBadRequest, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: tls ca file %s holds no certificates",
+				service.ErrBadRequest, c.CAFile)
+		}
+		cfg.ClientCAs = pool
+		cfg.ClientAuth = tls.VerifyClientCertIfGiven
+		if c.RequireClientCert {
+			cfg.ClientAuth = tls.RequireAndVerifyClientCert
+		}
+	}
+	return cfg, nil
+}
+
+// reloader reloads the certificate of a server once its files change.
+type reloader struct {
+	certFile, keyFile string
+
+	mu      sync.Mutex
+	cert    *tls.Certificate
+	modTime time.Time // of the loaded files, the latest of both
+	checked time.Time // when the files were last checked
+}
+
+// certificate returns the current certificate, reloading it if its files
+// changed since they were last checked. A certificate failing to reload is
+// logged, and the previous one is kept.
+func (r *reloader) certificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if now := time.Now(); now.Sub(r.checked) >= checkInterval {
+		r.checked = now
+		if m, err := r.latestModTime(); err == nil && m.After(r.modTime) {
+			if err := r.loadLocked(); err != nil {
+				slog.Error("failed to reload the tls certificate", slog.String("error", err.Error()))
+			} else {
+				slog.Info("reloaded the tls certificate", slog.String("file", r.certFile))
+			}
+		}
+	}
+	return r.cert, nil
+}
+
+// load loads the certificate from its files.
+func (r *reloader) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.checked = time.Now()
+	return r.loadLocked()
+}
+
+func (r *reloader) loadLocked() error {
+	m, err := r.latestModTime()
+	if err != nil {
+		return err
+	}
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return fmt.Errorf("%w: load tls certificate: %v", service.ErrBadRequest, err)
+	}
+	r.cert, r.modTime = &cert, m
+	return nil
+}
+
+// latestModTime returns the latest modification time of the files.
+func (r *reloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, f := range []string{r.certFile, r.keyFile} {
+		fi, err := os.Stat(f)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("%w: stat tls file: %v", service.ErrBadRequest, err)
+		}
+		if fi.ModTime().After(latest) {
+			latest = fi.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// checkInterval is the minimum interval between checking the certificate
+// files for changes.
+const checkInterval = 10 * time.Second
@@ -0,0 +1,218 @@
+// Package tracing traces the requests of the service with OpenTelemetry, from
+// the rest and grpc servers to the handlers of the events they publish, so that
+// a single trace follows a request across the services:
+//
+//	rest / grpc request -> handler -> published event -> consumed event
+//
+// [Setup] installs the tracer provider exporting the spans over OTLP, and the
+// W3C trace context propagator. The rest server is traced by [Handler], the
+// grpc server by [UnaryServerInterceptor] and [StreamServerInterceptor], and
+// the message bus injects the trace context into the headers of the published
+// messages, and extracts it from the consumed ones, see [StartPublish] and
+// [StartConsume].
+package tracing
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"path"
+
+	"github.com/eventscompass/service-framework/service"
+	"go.opentelemetry.io/contrib/instrumentation/google.golang.org/grpc/otelgrpc"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/grpc"
+
+	"github.com/eventscompass/service-template/src/internal/info"
+)
+
+// Config encapsulates the configuration of the tracing.
+type Config struct {
+	// Endpoint is the address of the OTLP/gRPC collector, e.g.
+	// "otel-collector:4317". Empty exports no spans, but the trace
+	// context of the requests is still propagated.
+	Endpoint string `env:"TRACING_OTLP_ENDPOINT"`
+
+	// Insecure exports the spans without tls, e.g. to a collector
+	// running as a sidecar.
+	Insecure bool `env:"TRACING_OTLP_INSECURE"`
+
+	// SampleRatio is the ratio of the traces started by the service
+	// that are sampled. The traces started by the callers keep their
+	// sampling decision.
+	SampleRatio float64 `env:"TRACING_SAMPLE_RATIO" envDefault:"1"`
+
+	// ServiceName names the service in the traces. Empty uses the
+	// last element of the module path of the binary.
+	ServiceName string `env:"TRACING_SERVICE_NAME"`
+}
+
+// Provider is the tracer provider installed by [Setup].
+type Provider struct {
+	tp *sdktrace.TracerProvider // nil without an endpoint
+}
+
+// Setup installs the global tracer provider and propagator. The spans are
+// described by the attributes of the instance, see [info.Info.Attributes].
+// This function returns [service.ErrBadRequest] in case the configuration is
+// invalid.
+func Setup(ctx context.Context, cfg Config, instance info.Info) (*Provider, error) {
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+	))
+	if cfg.Endpoint == "" {
+		return &Provider{}, nil
+	}
+	if cfg.SampleRatio < 0 || cfg.SampleRatio > 1 {
+		return nil, fmt.Errorf("%w: tracing sample ratio must be within [0, 1], got %v",
+			service.ErrBadRequest, cfg.SampleRatio)
+	}
+
+	opts := []otlptracegrpc.Option{otlptracegrpc.WithEndpoint(cfg.Endpoint)}
+	if cfg.Insecure {
+		opts = append(opts, otlptracegrpc.WithInsecure())
+	}
+	// The exporter connects lazily, thus an unreachable collector does
+	// not fail the service.
+	exporter, err := otlptracegrpc.New(ctx, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: create otlp exporter: %v", service.ErrBadRequest, err)
+	}
+
+	name := cfg.ServiceName
+	if name == "" {
+		name = path.Base(instance.Build.Path)
+	}
+	attrs := []attribute.KeyValue{attribute.String("service.name", name)}
+	for k, v := range instance.Attributes() {
+		attrs = append(attrs, attribute.String(k, v))
+	}
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(attrs...)),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.TraceIDRatioBased(cfg.SampleRatio))),
+	)
+	otel.SetTracerProvider(tp)
+	return &Provider{tp: tp}, nil
+}
+
+// Shutdown exports the buffered spans and stops the provider. This function
+// returns [service.ErrTimeOut] in case the spans are not exported before the
+// ctx is done.
+func (p *Provider) Shutdown(ctx context.Context) error {
+	if p == nil || p.tp == nil {
+		return nil
+	}
+	if err := p.tp.Shutdown(ctx); err != nil {
+		return fmt.Errorf("%w: flush spans: %v", service.ErrTimeOut, err)
+	}
+	return nil
+}
+
+// Handler traces the requests served by h. The spans are named after the
+// server, e.g. "rest", and continue the trace of the caller.
+func Handler(h http.Handler, server string) http.Handler {
+	return otelhttp.NewHandler(h, server)
+}
+
+// UnaryServerInterceptor traces the unary calls served by a grpc server. The
+// spans continue the trace of the caller.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return otelgrpc.UnaryServerInterceptor()
+}
+
+// StreamServerInterceptor traces the streams served by a grpc server, like
+// [UnaryServerInterceptor] does.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return otelgrpc.StreamServerInterceptor()
+}
+
+// StartPublish starts the span of publishing a message to the topic, and
+// injects its trace context into the headers of the message. End the span
+// once the message is published, see [End].
+func StartPublish(
+	ctx context.Context,
+	topic string,
+	headers propagation.TextMapCarrier,
+) (context.Context, trace.Span) {
+	ctx, span := tracer().Start(ctx, topic+" publish",
+		trace.WithSpanKind(trace.SpanKindProducer),
+		trace.WithAttributes(messagingAttrs(topic, "publish")...),
+	)
+	otel.GetTextMapPropagator().Inject(ctx, headers)
+	return ctx, span
+}
+
+// StartConsume starts the span of handling a message consumed from the topic,
+// continuing the trace context carried by the headers of the message. End
+// the span once the message is handled, see [End].
+func StartConsume(
+	ctx context.Context,
+	topic string,
+	headers propagation.TextMapCarrier,
+) (context.Context, trace.Span) {
+	ctx = otel.GetTextMapPropagator().Extract(ctx, headers)
+	return tracer().Start(ctx, topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(messagingAttrs(topic, "process")...),
+	)
+}
+
+// StartConsumeBatch starts the span of handling a batch of messages consumed
+// from the topic. The messages of a batch belong to distinct traces, thus the
+// span starts a trace of its own, linked to the trace context carried by the
+// headers of every message.
+func StartConsumeBatch(
+	ctx context.Context,
+	topic string,
+	headers []propagation.TextMapCarrier,
+) (context.Context, trace.Span) {
+	links := make([]trace.Link, 0, len(headers))
+	for _, h := range headers {
+		sc := trace.SpanContextFromContext(otel.GetTextMapPropagator().Extract(context.Background(), h))
+		if sc.IsValid() {
+			links = append(links, trace.Link{SpanContext: sc})
+		}
+	}
+	return tracer().Start(ctx, topic+" process",
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithLinks(links...),
+		trace.WithAttributes(append(messagingAttrs(topic, "process"),
+			attribute.Int("messaging.batch.message_count", len(headers)))...),
+	)
+}
+
+// End records the error, if any, and ends the span.
+func End(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// tracer returns the tracer of the package, of the current global provider.
+func tracer() trace.Tracer { return otel.Tracer(instrumentationName) }
+
+// messagingAttrs returns the attributes of a messaging span, following the
+// OpenTelemetry semantic conventions.
+// https://opentelemetry.io/docs/specs/semconv/messaging/messaging-spans/
+func messagingAttrs(topic, operation string) []attribute.KeyValue {
+	return []attribute.KeyValue{
+		attribute.String("messaging.system", "rabbitmq"),
+		attribute.String("messaging.destination.name", topic),
+		attribute.String("messaging.operation", operation),
+	}
+}
+
+// instrumentationName names the tracer of the package.
+const instrumentationName = "github.com/eventscompass/service-template/src/internal/tracing"
@@ -0,0 +1,165 @@
+package venues
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	apiv1 "github.com/eventscompass/service-template/pkg/api/v1"
+	"github.com/eventscompass/service-template/src/internal/filter"
+	"github.com/eventscompass/service-template/src/internal/page"
+)
+
+// GRPCServer serves the grpc api of the venues, see venues.proto. The pages
+// of ListVenues are addressed by the cursors of the page package, thus the
+// page tokens are interchangeable with the cursors of the rest api. Unlike the
+// rest api, ListVenues does not filter the venues.
+type GRPCServer struct {
+	apiv1.UnimplementedVenuesServiceServer
+
+	svc  *Service
+	page page.Config
+}
+
+var _ apiv1.VenuesServiceServer = (*GRPCServer)(nil)
+
+// NewGRPCServer creates a new [GRPCServer] serving the venues of the service,
+// with the page sizes of cfg. Register it with
+// apiv1.RegisterVenuesServiceServer.
+func NewGRPCServer(svc *Service, cfg page.Config) *GRPCServer {
+	return &GRPCServer{svc: svc, page: cfg}
+}
+
+// CreateVenue implements the [apiv1.VenuesServiceServer] interface.
+func (s *GRPCServer) CreateVenue(
+	ctx context.Context,
+	req *apiv1.CreateVenueRequest,
+) (*apiv1.Venue, error) {
+	v, err := s.svc.Create(ctx, Venue{
+		Name:     req.GetName(),
+		City:     req.GetCity(),
+		Capacity: int(req.GetCapacity()),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProto(v), nil
+}
+
+// GetVenue implements the [apiv1.VenuesServiceServer] interface.
+func (s *GRPCServer) GetVenue(
+	ctx context.Context,
+	req *apiv1.GetVenueRequest,
+) (*apiv1.Venue, error) {
+	v, err := s.svc.Get(ctx, req.GetId())
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProto(v), nil
+}
+
+// ListVenues implements the [apiv1.VenuesServiceServer] interface.
+func (s *GRPCServer) ListVenues(
+	ctx context.Context,
+	req *apiv1.ListVenuesRequest,
+) (*apiv1.ListVenuesResponse, error) {
+	pr := page.Request{Limit: s.page.DefaultLimit}
+	if n := int(req.GetPageSize()); n > 0 {
+		pr.Limit = n
+	} else if n < 0 {
+		return nil, grpcError(fmt.Errorf("%w: page size must not be negative", service.ErrBadRequest))
+	}
+	if s.page.MaxLimit > 0 {
+		pr.Limit = min(pr.Limit, s.page.MaxLimit)
+	}
+	if t := req.GetPageToken(); t != "" {
+		c, err := page.DecodeCursor(t)
+		if err != nil {
+			return nil, grpcError(err)
+		}
+		pr.Cursor = &c
+	}
+
+	p, err := s.svc.List(ctx, pr, filter.Spec{})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &apiv1.ListVenuesResponse{
+		Venues:        make([]*apiv1.Venue, len(p.Items)),
+		NextPageToken: p.Next,
+	}
+	for i, v := range p.Items {
+		resp.Venues[i] = toProto(v)
+	}
+	return resp, nil
+}
+
+// UpdateVenue implements the [apiv1.VenuesServiceServer] interface.
+func (s *GRPCServer) UpdateVenue(
+	ctx context.Context,
+	req *apiv1.UpdateVenueRequest,
+) (*apiv1.Venue, error) {
+	v, err := s.svc.Update(ctx, Venue{
+		ID:       req.GetId(),
+		Name:     req.GetName(),
+		City:     req.GetCity(),
+		Capacity: int(req.GetCapacity()),
+	})
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return toProto(v), nil
+}
+
+// DeleteVenue implements the [apiv1.VenuesServiceServer] interface.
+func (s *GRPCServer) DeleteVenue(
+	ctx context.Context,
+	req *apiv1.DeleteVenueRequest,
+) (*apiv1.DeleteVenueResponse, error) {
+	if err := s.svc.Delete(ctx, req.GetId()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &apiv1.DeleteVenueResponse{}, nil
+}
+
+// toProto converts the venue to its message of the api.
+func toProto(v Venue) *apiv1.Venue {
+	return &apiv1.Venue{
+		Id:        v.ID,
+		Name:      v.Name,
+		City:      v.City,
+		Capacity:  int32(v.Capacity), //nolint:gosec // bounded by Validate
+		CreatedAt: timestamppb.New(v.CreatedAt),
+		UpdatedAt: timestamppb.New(v.UpdatedAt),
+	}
+}
+
+// grpcError converts the error to a grpc status error, like
+// [service.HTTPError] does for the rest api.
+func grpcError(err error) error {
+	switch {
+	case errors.Is(err, context.Canceled):
+		return status.Error(codes.Canceled, err.Error())
+	case errors.Is(err, context.DeadlineExceeded), errors.Is(err, service.ErrTimeOut):
+		return status.Error(codes.DeadlineExceeded, err.Error())
+	case errors.Is(err, service.ErrBadRequest):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, service.ErrNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.Is(err, service.ErrAlreadyExists):
+		return status.Error(codes.AlreadyExists, err.Error())
+	case errors.Is(err, service.ErrNotAllowed):
+		return status.Error(codes.PermissionDenied, err.Error())
+	case errors.Is(err, service.ErrSpaceFull):
+		return status.Error(codes.ResourceExhausted, err.Error())
+	case errors.Is(err, service.ErrConnectionClosed):
+		return status.Error(codes.Unavailable, err.Error())
+	default:
+		return status.Error(codes.Internal, err.Error())
+	}
+}
@@ -0,0 +1,120 @@
+package venues
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/filter"
+	"github.com/eventscompass/service-template/src/internal/page"
+)
+
+// MemoryRepository is a [Repository] keeping the venues in memory, e.g. for
+// tests and for running the service locally without a database. The venues
+// are lost when the service stops.
+type MemoryRepository struct {
+	mu     sync.RWMutex
+	venues map[string]Venue // by id, without the deleted ones
+}
+
+var _ Repository = (*MemoryRepository)(nil)
+
+// NewMemoryRepository creates a new, empty [MemoryRepository].
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{venues: make(map[string]Venue)}
+}
+
+// Create implements the [Repository] interface.
+func (r *MemoryRepository) Create(_ context.Context, v Venue) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.venues[v.ID]; ok {
+		return fmt.Errorf("%w: venue %s", service.ErrAlreadyExists, v.ID)
+	}
+	r.venues[v.ID] = v
+	return nil
+}
+
+// Get implements the [Repository] interface.
+func (r *MemoryRepository) Get(_ context.Context, id string) (Venue, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	v, ok := r.venues[id]
+	if !ok {
+		return Venue{}, fmt.Errorf("%w: venue %s", service.ErrNotFound, id)
+	}
+	return v, nil
+}
+
+// List implements the [Repository] interface.
+func (r *MemoryRepository) List(
+	_ context.Context,
+	req page.Request,
+	f filter.Spec,
+) (page.Page[Venue], error) {
+	r.mu.RLock()
+	venues := make([]Venue, 0, len(r.venues))
+	for _, v := range r.venues {
+		if f.Match(values(v)) {
+			venues = append(venues, v)
+		}
+	}
+	r.mu.RUnlock()
+
+	slices.SortFunc(venues, func(a, b Venue) int { return compare(a, b.CreatedAt, b.ID) })
+	return page.Slice(venues, req, key, compareKey)
+}
+
+// Update implements the [Repository] interface.
+func (r *MemoryRepository) Update(_ context.Context, v Venue) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.venues[v.ID]; !ok {
+		return fmt.Errorf("%w: venue %s", service.ErrNotFound, v.ID)
+	}
+	r.venues[v.ID] = v
+	return nil
+}
+
+// Delete implements the [Repository] interface.
+func (r *MemoryRepository) Delete(_ context.Context, id string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if _, ok := r.venues[id]; !ok {
+		return fmt.Errorf("%w: venue %s", service.ErrNotFound, id)
+	}
+	delete(r.venues, id)
+	return nil
+}
+
+// compareKey compares the key of the venue with the key of a cursor, which
+// holds the creation time and the id as json strings, see [key].
+func compareKey(v Venue, k []any) (int, error) {
+	if len(k) != 2 { //nolint:gomnd // see key
+		return 0, fmt.Errorf("key has %d values, want 2", len(k))
+	}
+	created, ok := k[0].(string)
+	id, ok2 := k[1].(string)
+	if !ok || !ok2 {
+		return 0, errors.New("key values must be strings")
+	}
+	t, err := time.Parse(time.RFC3339Nano, created)
+	if err != nil {
+		return 0, fmt.Errorf("key creation time: %w", err)
+	}
+	return compare(v, t, id), nil
+}
+
+// compare compares the key of the venue with the given creation time and id.
+func compare(v Venue, created time.Time, id string) int {
+	if n := v.CreatedAt.Compare(created); n != 0 {
+		return n
+	}
+	return strings.Compare(v.ID, id)
+}
@@ -0,0 +1,145 @@
+package venues
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/codec"
+	"github.com/eventscompass/service-template/src/internal/page"
+)
+
+// Handler serves the rest api of the venues:
+//
+//	GET    /venues       lists the venues, see the page and filter packages
+//	POST   /venues       creates a venue
+//	GET    /venues/{id}  returns a venue
+//	PUT    /venues/{id}  updates a venue
+//	DELETE /venues/{id}  deletes a venue
+//
+// The bodies are encoded with the codec negotiated with the client, see
+// [codec.Decode] and [codec.Write].
+type Handler struct {
+	svc  *Service
+	page page.Config
+	mux  *http.ServeMux
+}
+
+// NewHandler creates a new [Handler] serving the venues of the service, with
+// the page sizes of cfg.
+func NewHandler(svc *Service, cfg page.Config) *Handler {
+	h := &Handler{svc: svc, page: cfg, mux: http.NewServeMux()}
+	h.mux.HandleFunc(collectionPath, h.collection)
+	h.mux.HandleFunc(collectionPath+"/", h.item)
+	return h
+}
+
+// ServeHTTP implements the [http.Handler] interface.
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) { h.mux.ServeHTTP(w, r) }
+
+// Routes implements the introspect.RouteLister interface.
+func (h *Handler) Routes() []string {
+	return []string{
+		"GET " + collectionPath,
+		"POST " + collectionPath,
+		"GET " + collectionPath + "/{id}",
+		"PUT " + collectionPath + "/{id}",
+		"DELETE " + collectionPath + "/{id}",
+	}
+}
+
+// collection serves the venues collection.
+func (h *Handler) collection(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	switch r.Method {
+	case http.MethodGet:
+		req, err := page.Parse(r, h.page)
+		if err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		f, err := fields.Parse(r.URL.Query())
+		if err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		p, err := h.svc.List(ctx, req, f)
+		if err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		page.Write(w, r, p)
+
+	case http.MethodPost:
+		var v Venue
+		if err := codec.Decode(r, &v); err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		v, err := h.svc.Create(ctx, v)
+		if err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		w.Header().Set("Location", collectionPath+"/"+v.ID)
+		codec.Write(w, r, http.StatusCreated, v)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPost)
+	}
+}
+
+// item serves a single venue.
+func (h *Handler) item(w http.ResponseWriter, r *http.Request) {
+	ctx := r.Context()
+	id := strings.TrimPrefix(r.URL.Path, collectionPath+"/")
+	if id == "" || strings.Contains(id, "/") {
+		http.NotFound(w, r)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		v, err := h.svc.Get(ctx, id)
+		if err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		codec.Write(w, r, http.StatusOK, v)
+
+	case http.MethodPut:
+		var v Venue
+		if err := codec.Decode(r, &v); err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		v.ID = id
+		v, err := h.svc.Update(ctx, v)
+		if err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		codec.Write(w, r, http.StatusOK, v)
+
+	case http.MethodDelete:
+		if err := h.svc.Delete(ctx, id); err != nil {
+			service.HTTPError(ctx, w, err)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		methodNotAllowed(w, http.MethodGet, http.MethodPut, http.MethodDelete)
+	}
+}
+
+// methodNotAllowed rejects a request with a method other than the allowed
+// ones.
+func methodNotAllowed(w http.ResponseWriter, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed) // 405
+}
+
+// collectionPath is the path of the venues collection.
+const collectionPath = "/venues"
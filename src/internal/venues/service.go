@@ -0,0 +1,150 @@
+package venues
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"log/slog"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	eventsv1 "github.com/eventscompass/service-template/pkg/events/v1"
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/events"
+	"github.com/eventscompass/service-template/src/internal/filter"
+	"github.com/eventscompass/service-template/src/internal/page"
+	"github.com/eventscompass/service-template/src/internal/store"
+	"github.com/eventscompass/service-template/src/internal/tenant"
+)
+
+// Service implements the use cases of the venues over a [Repository], and
+// publishes the lifecycle events of the venues: [events.VenueCreated],
+// [events.VenueUpdated] and [events.VenueDeleted].
+//
+// The events are published once the change is stored. A failed publish is
+// logged, and the change is kept; services that must not lose events append
+// them to an event store instead, see eventstore.Publisher.
+type Service struct {
+	repo  Repository
+	bus   service.MessageBus
+	clock clock.Clock
+}
+
+// NewService creates a new [Service]. A nil bus disables the events, e.g. if
+// the service runs without a message bus.
+func NewService(repo Repository, bus service.MessageBus) *Service {
+	return &Service{repo: repo, bus: bus, clock: clock.Real}
+}
+
+// UseClock sets the clock of the audit times of the venues.
+func (s *Service) UseClock(c clock.Clock) { s.clock = clock.Or(c) }
+
+// Create creates a venue from the fields set by the client, and returns it
+// with its id and audit times. This function returns [service.ErrBadRequest]
+// in case the venue is invalid, and the errors of the [Repository] otherwise.
+func (s *Service) Create(ctx context.Context, v Venue) (Venue, error) {
+	if err := v.Validate(); err != nil {
+		return Venue{}, err
+	}
+	id, err := newID()
+	if err != nil {
+		return Venue{}, err
+	}
+	v.ID, v.Audit = id, store.Audit{}
+	v.Touch(now(s.clock.Now()))
+	if err := s.repo.Create(ctx, v); err != nil {
+		return Venue{}, err
+	}
+
+	publish(ctx, s.bus, events.VenueCreated, &eventsv1.VenueCreated{
+		Id:        v.ID,
+		Name:      v.Name,
+		City:      v.City,
+		Capacity:  int32(v.Capacity), //nolint:gosec // bounded by Validate
+		CreatedAt: timestamppb.New(v.CreatedAt),
+	})
+	return v, nil
+}
+
+// Get returns the venue with the given id. This function returns
+// [service.ErrNotFound] in case there is no such venue.
+func (s *Service) Get(ctx context.Context, id string) (Venue, error) {
+	return s.repo.Get(ctx, id) //nolint:wrapcheck // documented by the repository
+}
+
+// List returns a page of the venues matching the filter, oldest first. This
+// function returns [service.ErrBadRequest] in case the cursor of the request
+// is malformed.
+func (s *Service) List(
+	ctx context.Context,
+	req page.Request,
+	f filter.Spec,
+) (page.Page[Venue], error) {
+	return s.repo.List(ctx, req, f) //nolint:wrapcheck // documented by the repository
+}
+
+// Update replaces the fields set by the client of the venue with the id of v,
+// and returns the updated venue. This function returns [service.ErrBadRequest]
+// in case the venue is invalid, and [service.ErrNotFound] in case there is no
+// such venue.
+func (s *Service) Update(ctx context.Context, v Venue) (Venue, error) {
+	if err := v.Validate(); err != nil {
+		return Venue{}, err
+	}
+	current, err := s.repo.Get(ctx, v.ID)
+	if err != nil {
+		return Venue{}, err //nolint:wrapcheck // documented by the repository
+	}
+	v.Audit = current.Audit
+	v.Touch(now(s.clock.Now()))
+	if err := s.repo.Update(ctx, v); err != nil {
+		return Venue{}, err //nolint:wrapcheck // documented by the repository
+	}
+
+	publish(ctx, s.bus, events.VenueUpdated, &eventsv1.VenueUpdated{
+		Id:        v.ID,
+		Name:      v.Name,
+		City:      v.City,
+		Capacity:  int32(v.Capacity), //nolint:gosec // bounded by Validate
+		UpdatedAt: timestamppb.New(v.UpdatedAt),
+	})
+	return v, nil
+}
+
+// Delete deletes the venue with the given id. This function returns
+// [service.ErrNotFound] in case there is no such venue.
+func (s *Service) Delete(ctx context.Context, id string) error {
+	if err := s.repo.Delete(ctx, id); err != nil {
+		return err //nolint:wrapcheck // documented by the repository
+	}
+	publish(ctx, s.bus, events.VenueDeleted, &eventsv1.VenueDeleted{
+		Id:        id,
+		DeletedAt: timestamppb.New(now(s.clock.Now())),
+	})
+	return nil
+}
+
+// publish publishes the event with the tenant of ctx, if there is a bus. A
+// failed publish is logged.
+func publish[T any](ctx context.Context, bus service.MessageBus, e *events.Event[T], event T) {
+	if bus == nil {
+		return
+	}
+	if err := e.Publish(ctx, bus, event, tenant.Inject(ctx, nil)); err != nil {
+		slog.ErrorContext(ctx, "failed to publish venue event",
+			slog.String("type", e.Type),
+			slog.String("error", err.Error()),
+		)
+	}
+}
+
+// newID generates a random venue id.
+func newID() (string, error) {
+	b := make([]byte, 16) //nolint:gomnd // 128 bits
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w: generate venue id: %v", service.ErrUnexpected, err)
+	}
+	return hex.EncodeToString(b), nil
+}
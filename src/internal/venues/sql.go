@@ -0,0 +1,134 @@
+package venues
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/filter"
+	"github.com/eventscompass/service-template/src/internal/page"
+	"github.com/eventscompass/service-template/src/internal/store"
+)
+
+// SQLRepository is a [Repository] backed by a postgres table. The table is
+// created by the migrations of the service, see migrations/0001_create_venues.sql:
+//
+//	CREATE TABLE venues (
+//		id         TEXT PRIMARY KEY,
+//		name       TEXT NOT NULL,
+//		city       TEXT NOT NULL,
+//		capacity   INTEGER NOT NULL,
+//		created_at TIMESTAMPTZ NOT NULL,
+//		updated_at TIMESTAMPTZ NOT NULL,
+//		deleted_at TIMESTAMPTZ
+//	);
+//	CREATE INDEX venues_created_at_id ON venues (created_at, id);
+//
+// Deleted venues are soft deleted, see [store.SoftDelete].
+type SQLRepository struct {
+	db *sql.DB
+}
+
+var _ Repository = (*SQLRepository)(nil)
+
+// NewSQLRepository creates a new [SQLRepository].
+func NewSQLRepository(db *sql.DB) *SQLRepository {
+	return &SQLRepository{db: db}
+}
+
+// Create implements the [Repository] interface.
+func (r *SQLRepository) Create(ctx context.Context, v Venue) error {
+	_, err := r.db.ExecContext(ctx, `
+		INSERT INTO venues (id, name, city, capacity, created_at, updated_at)
+		VALUES ($1, $2, $3, $4, $5, $6)`,
+		v.ID, v.Name, v.City, v.Capacity, v.CreatedAt, v.UpdatedAt,
+	)
+	if isUniqueViolation(err) {
+		return fmt.Errorf("%w: venue %s", service.ErrAlreadyExists, v.ID)
+	}
+	if err != nil {
+		return service.Unexpected(ctx, fmt.Errorf("create venue: %w", err))
+	}
+	return nil
+}
+
+// Get implements the [Repository] interface.
+func (r *SQLRepository) Get(ctx context.Context, id string) (Venue, error) {
+	query := "SELECT " + columns + " FROM venues WHERE " + store.NotDeleted("id = $1")
+	var v Venue
+	err := r.db.QueryRowContext(ctx, query, id).
+		Scan(&v.ID, &v.Name, &v.City, &v.Capacity, &v.CreatedAt, &v.UpdatedAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Venue{}, fmt.Errorf("%w: venue %s", service.ErrNotFound, id)
+	}
+	if err != nil {
+		return Venue{}, service.Unexpected(ctx, fmt.Errorf("get venue: %w", err))
+	}
+	return v, nil
+}
+
+// List implements the [Repository] interface.
+func (r *SQLRepository) List(
+	ctx context.Context,
+	req page.Request,
+	f filter.Spec,
+) (page.Page[Venue], error) {
+	q := store.ListQuery{
+		Table:   "venues",
+		Columns: []string{"id", "name", "city", "capacity", "created_at", "updated_at"},
+		Where:   store.NotDeleted(""),
+		OrderBy: []string{"created_at", "id"},
+	}
+	if err := f.Apply(&q); err != nil {
+		return page.Page[Venue]{}, err //nolint:wrapcheck // bad request
+	}
+	return page.List(ctx, r.db, req, q, scan, key)
+}
+
+// Update implements the [Repository] interface.
+func (r *SQLRepository) Update(ctx context.Context, v Venue) error {
+	res, err := r.db.ExecContext(ctx, `
+		UPDATE venues SET name = $2, city = $3, capacity = $4, updated_at = $5
+		WHERE `+store.NotDeleted("id = $1"),
+		v.ID, v.Name, v.City, v.Capacity, v.UpdatedAt,
+	)
+	if err != nil {
+		return service.Unexpected(ctx, fmt.Errorf("update venue: %w", err))
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return service.Unexpected(ctx, fmt.Errorf("update venue: %w", err))
+	}
+	if n == 0 {
+		return fmt.Errorf("%w: venue %s", service.ErrNotFound, v.ID)
+	}
+	return nil
+}
+
+// Delete implements the [Repository] interface.
+func (r *SQLRepository) Delete(ctx context.Context, id string) error {
+	if err := store.SoftDelete(ctx, r.db, "venues", "id", id); err != nil {
+		return fmt.Errorf("delete venue %s: %w", id, err)
+	}
+	return nil
+}
+
+// scan scans a venue selected with [columns].
+func scan(rows *sql.Rows) (Venue, error) {
+	var v Venue
+	err := rows.Scan(&v.ID, &v.Name, &v.City, &v.Capacity, &v.CreatedAt, &v.UpdatedAt)
+	return v, err //nolint:wrapcheck // wrapped by store.List
+}
+
+// isUniqueViolation reports whether the insert violated a unique constraint.
+// The postgres drivers expose the SQLSTATE code of their errors.
+func isUniqueViolation(err error) bool {
+	var e interface{ SQLState() string }
+	return errors.As(err, &e) && e.SQLState() == "23505" // unique_violation
+}
+
+// columns are the selected columns of a venue, in the order of [scan].
+const columns = "id, name, city, capacity, created_at, updated_at"
@@ -0,0 +1,125 @@
+// Package venues is the reference module of the template: a complete vertical
+// slice managing the venues that events take place at, wired end-to-end with
+// the framework. New modules start as a copy of this one.
+//
+// The module is layered like every module of the service:
+//
+//   - [Venue] is the domain type, validated by [Venue.Validate].
+//   - [Repository] persists the venues, in postgres with [SQLRepository], or
+//     in memory with [MemoryRepository] for tests and local runs.
+//   - [Service] holds the business logic, and publishes the lifecycle events
+//     of the venues, see the events package.
+//   - [Handler] serves the rest api, and [GRPCServer] the grpc api; both are
+//     thin adapters over the [Service].
+//
+// The module is wired in the Init method of the service:
+//
+//	svc := venues.NewService(venues.NewSQLRepository(db), s.bus)
+//	s.venuesREST = venues.NewHandler(svc, s.cfg.Page)
+//	apiv1.RegisterVenuesServiceServer(srv, venues.NewGRPCServer(svc, s.cfg.Page))
+package venues
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strings"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/filter"
+	"github.com/eventscompass/service-template/src/internal/page"
+	"github.com/eventscompass/service-template/src/internal/store"
+)
+
+// Venue is a place that events take place at.
+type Venue struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+	City string `json:"city"`
+
+	// Capacity is the maximum number of attendees.
+	Capacity int `json:"capacity"`
+
+	store.Audit
+}
+
+// Validate validates the fields of the venue that clients set. This function
+// returns [service.ErrBadRequest] in case a field is invalid.
+func (v *Venue) Validate() error {
+	switch {
+	case strings.TrimSpace(v.Name) == "":
+		return fmt.Errorf("%w: venue name is required", service.ErrBadRequest)
+	case len(v.Name) > maxNameLength:
+		return fmt.Errorf("%w: venue name exceeds %d bytes", service.ErrBadRequest, maxNameLength)
+	case strings.TrimSpace(v.City) == "":
+		return fmt.Errorf("%w: venue city is required", service.ErrBadRequest)
+	case v.Capacity <= 0 || v.Capacity > maxCapacity:
+		return fmt.Errorf("%w: venue capacity must be between 1 and %d",
+			service.ErrBadRequest, maxCapacity)
+	}
+	return nil
+}
+
+// key returns the values of the columns that the venues are listed by, which
+// make up the cursors of the pages, see [page.Cursor].
+func key(v Venue) []any { return []any{v.CreatedAt, v.ID} }
+
+// fields are the fields that clients may filter the venues by, e.g.
+// "?filter=city:eq:Sofia,capacity:ge:1000", see the filter package. The
+// venues are always listed oldest first, thus none of them is sortable.
+var fields = filter.Schema{
+	"name": {Column: "name", Type: filter.String, Ops: []filter.Op{filter.Eq, filter.Contains}},
+	"city": {
+		Column: "city",
+		Type:   filter.String,
+		Ops:    []filter.Op{filter.Eq, filter.Ne, filter.In},
+	},
+	"capacity": {Column: "capacity", Type: filter.Int},
+}
+
+// values returns the values of the fields of the venue, see [filter.Spec.Match].
+func values(v Venue) map[string]any {
+	return map[string]any{"name": v.Name, "city": v.City, "capacity": int64(v.Capacity)}
+}
+
+// Repository persists the venues. Deleted venues are not returned.
+type Repository interface {
+	// Create stores a new venue. This function returns
+	// [service.ErrAlreadyExists] in case a venue with the same id
+	// exists.
+	Create(ctx context.Context, v Venue) error
+
+	// Get returns the venue with the given id. This function
+	// returns [service.ErrNotFound] in case there is no such venue.
+	Get(ctx context.Context, id string) (Venue, error)
+
+	// List returns a page of the venues matching the filter, oldest
+	// first. This function returns [service.ErrBadRequest] in case
+	// the cursor of the request does not fit the list.
+	List(ctx context.Context, req page.Request, f filter.Spec) (page.Page[Venue], error)
+
+	// Update replaces the stored venue with the same id. This
+	// function returns [service.ErrNotFound] in case there is no
+	// such venue.
+	Update(ctx context.Context, v Venue) error
+
+	// Delete deletes the venue with the given id. This function
+	// returns [service.ErrNotFound] in case there is no such venue.
+	Delete(ctx context.Context, id string) error
+}
+
+// now returns the current time with the precision of postgres timestamps, so
+// that the venues returned by the [Service] equal the stored ones.
+func now(t time.Time) time.Time { return t.UTC().Truncate(time.Microsecond) }
+
+const (
+	// maxNameLength is the maximum length of the name of a venue,
+	// in bytes.
+	maxNameLength = 200
+
+	// maxCapacity is the maximum capacity of a venue, which fits
+	// the int32 of the api and the events.
+	maxCapacity = math.MaxInt32
+)
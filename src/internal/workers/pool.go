@@ -0,0 +1,220 @@
+// Package workers manages the goroutines of the service.
+//
+// A [Pool] provides bounded concurrent processing, e.g. fanning out work inside
+// request handlers and event consumers without spawning an unbounded number of
+// goroutines. A [Supervisor] runs long-running background workers and
+// restarts them when they fail.
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// Pool runs tasks on a fixed number of worker goroutines. Tasks that cannot be
+// started immediately wait in a bounded queue.
+type Pool struct {
+	name  string
+	queue chan task
+
+	// mu guards closed. Submitting holds a read lock, so that the queue is
+	// not closed while a task is being sent.
+	mu     sync.RWMutex
+	closed bool
+	wg     sync.WaitGroup
+}
+
+// NewPool creates a new [Pool] with the given number of workers and queue
+// size. The name of the pool is used for labeling the metrics.
+func NewPool(name string, size, queueSize int) *Pool {
+	p := &Pool{name: name, queue: make(chan task, max(queueSize, 0))}
+	for i := 0; i < max(size, 1); i++ {
+		p.wg.Add(1)
+		go p.work()
+	}
+	return p
+}
+
+// Submit queues fn for execution. It blocks while the queue is full. The
+// context is passed to fn, and cancelling it before fn is started prevents fn
+// from running. The error returned by fn is delivered through the returned
+// channel, which is closed afterwards. This function returns
+// [service.ErrNotAllowed] in case the pool is closed.
+func (p *Pool) Submit(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+) (<-chan error, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, fmt.Errorf("%w: pool %s is closed", service.ErrNotAllowed, p.name)
+	}
+
+	t := task{ctx: ctx, fn: fn, done: make(chan error, 1)}
+	queueDepth.Inc(p.name)
+	select {
+	case p.queue <- t:
+		return t.done, nil
+	case <-ctx.Done():
+		queueDepth.Dec(p.name)
+		return nil, ctx.Err() //nolint:wrapcheck // context errors are not wrapped
+	}
+}
+
+// TrySubmit is like [Pool.Submit], but does not block if the queue is full.
+// This function returns [service.ErrSpaceFull] in case the queue is full, and
+// [service.ErrNotAllowed] in case the pool is closed.
+func (p *Pool) TrySubmit(
+	ctx context.Context,
+	fn func(ctx context.Context) error,
+) (<-chan error, error) {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+	if p.closed {
+		return nil, fmt.Errorf("%w: pool %s is closed", service.ErrNotAllowed, p.name)
+	}
+
+	t := task{ctx: ctx, fn: fn, done: make(chan error, 1)}
+	queueDepth.Inc(p.name)
+	select {
+	case p.queue <- t:
+		return t.done, nil
+	default:
+		queueDepth.Dec(p.name)
+		rejected.Inc(p.name)
+		return nil, fmt.Errorf("%w: pool %s queue is full", service.ErrSpaceFull, p.name)
+	}
+}
+
+// Close stops accepting new tasks and waits for the queued and running tasks to
+// finish.
+func (p *Pool) Close() {
+	p.mu.Lock()
+	if !p.closed {
+		p.closed = true
+		close(p.queue)
+	}
+	p.mu.Unlock()
+	p.wg.Wait()
+}
+
+// Group is a set of tasks submitted to a [Pool], which can be waited on
+// together. The first task that fails cancels the context of the group.
+type Group struct {
+	pool   *Pool
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	once sync.Once
+	err  error
+	wg   sync.WaitGroup
+}
+
+// Group creates a new [Group] of tasks running on the pool.
+func (p *Pool) Group(ctx context.Context) *Group {
+	ctx, cancel := context.WithCancel(ctx)
+	return &Group{pool: p, ctx: ctx, cancel: cancel}
+}
+
+// Go submits fn to the pool, blocking while the queue of the pool is full.
+func (g *Group) Go(fn func(ctx context.Context) error) {
+	done, err := g.pool.Submit(g.ctx, fn)
+	if err != nil {
+		g.fail(err)
+		return
+	}
+	g.wg.Add(1)
+	go func() {
+		defer g.wg.Done()
+		if err := <-done; err != nil {
+			g.fail(err)
+		}
+	}()
+}
+
+// Wait blocks until all tasks of the group have finished, and returns the
+// error of the first failed task, if any.
+func (g *Group) Wait() error {
+	g.wg.Wait()
+	g.cancel()
+	return g.err
+}
+
+func (g *Group) fail(err error) {
+	g.once.Do(func() {
+		g.err = err
+		g.cancel()
+	})
+}
+
+// work runs the queued tasks until the queue is closed.
+func (p *Pool) work() {
+	defer p.wg.Done()
+	for t := range p.queue {
+		queueDepth.Dec(p.name)
+		t.done <- p.run(t)
+		close(t.done)
+	}
+}
+
+// run runs a single task, converting panics into errors.
+func (p *Pool) run(t task) (err error) {
+	if err := t.ctx.Err(); err != nil {
+		tasksTotal.Inc(p.name, "cancelled")
+		return err //nolint:wrapcheck // context errors are not wrapped
+	}
+
+	active.Inc(p.name)
+	defer active.Dec(p.name)
+	defer func() {
+		if msg := recover(); msg != nil {
+			slog.Error("panic in worker pool task",
+				slog.String("pool", p.name),
+				slog.Any("message", msg),
+			)
+			err = fmt.Errorf("%w: panic: %v", service.ErrUnexpected, msg)
+		}
+		if err != nil {
+			tasksTotal.Inc(p.name, "failure")
+		} else {
+			tasksTotal.Inc(p.name, "success")
+		}
+	}()
+	return t.fn(t.ctx)
+}
+
+// task is a unit of work submitted to the pool.
+type task struct {
+	ctx  context.Context //nolint:containedctx // the ctx of the submitter
+	fn   func(ctx context.Context) error
+	done chan error
+}
+
+var (
+	queueDepth = metrics.NewGauge(
+		"workers_queue_depth",
+		"Number of tasks waiting in the queue of the pool.",
+		"pool",
+	)
+	active = metrics.NewGauge(
+		"workers_active",
+		"Number of tasks currently running in the pool.",
+		"pool",
+	)
+	tasksTotal = metrics.NewCounter(
+		"workers_tasks_total",
+		"Number of tasks processed by the pool by outcome.",
+		"pool", "outcome",
+	)
+	rejected = metrics.NewCounter(
+		"workers_rejected_total",
+		"Number of tasks rejected because the queue of the pool was full.",
+		"pool",
+	)
+)
@@ -0,0 +1,141 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+)
+
+func TestPoolSubmit(t *testing.T) {
+	errFailed := errors.New("failed")
+	tests := []struct {
+		name    string
+		fn      func(ctx context.Context) error
+		wantErr error
+	}{
+		{"success", func(context.Context) error { return nil }, nil},
+		{"failure", func(context.Context) error { return errFailed }, errFailed},
+		{"panic", func(context.Context) error { panic("boom") }, service.ErrUnexpected},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool("test", 1, 1)
+			defer p.Close()
+			done, err := p.Submit(context.Background(), tt.fn)
+			if err != nil {
+				t.Fatalf("submit: %v", err)
+			}
+			if err := <-done; !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+
+			// The worker survives the panic.
+			done, _ = p.Submit(context.Background(), func(context.Context) error { return nil })
+			if err := <-done; err != nil {
+				t.Errorf("got error %v after the first task, want nil", err)
+			}
+		})
+	}
+}
+
+func TestPoolRejects(t *testing.T) {
+	tests := []struct {
+		name    string
+		submit  func(p *Pool, ctx context.Context) error
+		wantErr error
+	}{
+		{
+			name: "full queue",
+			submit: func(p *Pool, ctx context.Context) error {
+				_, err := p.TrySubmit(ctx, func(context.Context) error { return nil })
+				return err
+			},
+			wantErr: service.ErrSpaceFull,
+		},
+		{
+			name: "cancelled while queueing",
+			submit: func(p *Pool, ctx context.Context) error {
+				ctx, cancel := context.WithCancel(ctx)
+				cancel()
+				_, err := p.Submit(ctx, func(context.Context) error { return nil })
+				return err
+			},
+			wantErr: context.Canceled,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewPool("test", 1, 1)
+			defer p.Close()
+
+			// Occupy the worker and the queue.
+			block := make(chan struct{})
+			defer close(block)
+			started := make(chan struct{})
+			p.Submit(context.Background(), func(context.Context) error { //nolint:errcheck // cannot fail
+				close(started)
+				<-block
+				return nil
+			})
+			<-started
+			p.Submit(context.Background(), func(context.Context) error { return nil }) //nolint:errcheck // cannot fail
+
+			if err := tt.submit(p, context.Background()); !errors.Is(err, tt.wantErr) {
+				t.Errorf("got error %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPoolClose(t *testing.T) {
+	p := NewPool("test", 2, 10)
+	var dones []<-chan error
+	for i := 0; i < 10; i++ {
+		done, err := p.Submit(context.Background(), func(context.Context) error { return nil })
+		if err != nil {
+			t.Fatalf("submit: %v", err)
+		}
+		dones = append(dones, done)
+	}
+	p.Close()
+
+	// The queued tasks run before Close returns.
+	for _, done := range dones {
+		select {
+		case <-done:
+		default:
+			t.Fatal("got a queued task pending after close")
+		}
+	}
+	if _, err := p.Submit(context.Background(), func(context.Context) error { return nil }); !errors.Is(err, service.ErrNotAllowed) {
+		t.Errorf("got error %v submitting to a closed pool, want %v", err, service.ErrNotAllowed)
+	}
+}
+
+func TestGroup(t *testing.T) {
+	errFailed := errors.New("failed")
+	p := NewPool("test", 4, 4)
+	defer p.Close()
+
+	g := p.Group(context.Background())
+	cancelled := make(chan struct{})
+	g.Go(func(ctx context.Context) error {
+		<-ctx.Done()
+		close(cancelled)
+		return ctx.Err()
+	})
+	g.Go(func(context.Context) error { return errFailed })
+
+	if err := g.Wait(); !errors.Is(err, errFailed) {
+		t.Errorf("got error %v, want %v", err, errFailed)
+	}
+	select {
+	case <-cancelled:
+	default:
+		t.Error("got the other task running, want it cancelled by the failure")
+	}
+}
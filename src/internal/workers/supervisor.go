@@ -0,0 +1,242 @@
+package workers
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/clock"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+)
+
+// RestartPolicy defines what happens when a worker returns.
+type RestartPolicy int
+
+const (
+	// RestartOnFailure restarts the worker if it returns an error
+	// or panics. This is the default policy.
+	RestartOnFailure RestartPolicy = iota
+
+	// RestartAlways restarts the worker whenever it returns.
+	RestartAlways
+
+	// RestartNever never restarts the worker.
+	RestartNever
+)
+
+// Worker is a long-running background process of the service, e.g. a loop
+// polling a remote resource.
+type Worker struct {
+	// Name uniquely identifies the worker.
+	Name string
+
+	// Run performs the work. It must return once ctx is
+	// cancelled.
+	Run func(ctx context.Context) error
+
+	// Restart defines whether the worker is restarted when Run
+	// returns.
+	Restart RestartPolicy
+}
+
+// WorkerStatus describes the state of a supervised worker.
+type WorkerStatus struct {
+	Name     string `json:"name"`
+	Running  bool   `json:"running"`
+	Restarts int    `json:"restarts"`
+
+	// StartedAt is the time when the worker was (re)started.
+	StartedAt time.Time `json:"started_at"`
+
+	// LastError is the error returned by the last failed run.
+	LastError string `json:"last_error,omitempty"`
+}
+
+// Supervisor runs a set of workers, restarting them according to their restart
+// policy until the context is cancelled.
+type Supervisor struct {
+	wg sync.WaitGroup
+
+	mu     sync.Mutex
+	status []*WorkerStatus
+	clock  clock.Clock
+}
+
+// Supervise starts the given workers in separate goroutines. The workers run
+// until ctx is cancelled. Call [Supervisor.Wait] to wait for them to return.
+func Supervise(ctx context.Context, ws ...Worker) *Supervisor {
+	s := &Supervisor{clock: clock.Real}
+	for _, w := range ws {
+		w, st := w, &WorkerStatus{Name: w.Name}
+		s.status = append(s.status, st)
+		s.wg.Add(1)
+		go func() {
+			defer s.wg.Done()
+			s.supervise(ctx, w, st)
+		}()
+	}
+	return s
+}
+
+// UseClock makes the supervisor use the given clock for the restart backoff
+// and the drain timeout, e.g. a fake clock in tests.
+func (s *Supervisor) UseClock(c clock.Clock) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clock = clock.Or(c)
+}
+
+// Status returns the state of the supervised workers.
+func (s *Supervisor) Status() []WorkerStatus {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	res := make([]WorkerStatus, len(s.status))
+	for i, st := range s.status {
+		res[i] = *st
+	}
+	return res
+}
+
+// Wait blocks until all workers have returned.
+func (s *Supervisor) Wait() {
+	if s != nil {
+		s.wg.Wait()
+	}
+}
+
+// Drain waits up to the given timeout for the workers to return, once their
+// context was cancelled. Workers still running afterwards are logged and
+// abandoned. Returns true if all workers returned in time.
+func (s *Supervisor) Drain(timeout time.Duration) bool {
+	if s == nil {
+		return true
+	}
+	done := make(chan struct{})
+	go func() {
+		s.Wait()
+		close(done)
+	}()
+	timer := s.getClock().NewTimer(timeout)
+	defer timer.Stop()
+	select {
+	case <-done:
+		return true
+	case <-timer.C():
+	}
+
+	for _, st := range s.Status() {
+		if st.Running {
+			slog.Error("abandoning worker, drain timeout exceeded",
+				slog.String("worker", st.Name),
+				slog.Time("started", st.StartedAt),
+			)
+		}
+	}
+	return false
+}
+
+// supervise runs a single worker, restarting it according to its policy.
+func (s *Supervisor) supervise(ctx context.Context, w Worker, st *WorkerStatus) {
+	backoff := minBackoff
+	for {
+		slog.Info("starting worker", slog.String("worker", w.Name))
+		running.Inc(w.Name)
+		c := s.getClock()
+		start := c.Now()
+		s.update(func() { st.Running, st.StartedAt = true, start })
+		err := runWorker(ctx, w)
+		running.Dec(w.Name)
+		s.update(func() {
+			st.Running = false
+			if err != nil {
+				st.LastError = err.Error()
+			}
+		})
+
+		if ctx.Err() != nil {
+			slog.Info("worker stopped", slog.String("worker", w.Name))
+			return
+		}
+		if err != nil {
+			failures.Inc(w.Name)
+			slog.Error("worker failed",
+				slog.String("worker", w.Name),
+				slog.String("error", err.Error()),
+			)
+		}
+		restart := w.Restart == RestartAlways ||
+			(w.Restart == RestartOnFailure && err != nil)
+		if !restart {
+			slog.Info("worker finished", slog.String("worker", w.Name))
+			return
+		}
+
+		// A worker that ran for a while is considered healthy and is
+		// restarted quickly; a crash-looping worker backs off.
+		if clock.Since(c, start) > maxBackoff {
+			backoff = minBackoff
+		}
+		if clock.Sleep(ctx, c, backoff) != nil {
+			return
+		}
+		backoff = min(2*backoff, maxBackoff)
+		restarts.Inc(w.Name)
+		s.update(func() { st.Restarts++ })
+	}
+}
+
+// getClock returns the clock of the supervisor, which may be replaced while
+// the workers run.
+func (s *Supervisor) getClock() clock.Clock {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.clock
+}
+
+// update modifies the status of a worker while holding the lock.
+func (s *Supervisor) update(fn func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	fn()
+}
+
+// runWorker runs the worker once, converting panics into errors.
+func runWorker(ctx context.Context, w Worker) (err error) {
+	defer func() {
+		if msg := recover(); msg != nil {
+			err = fmt.Errorf("%w: panic: %v", service.ErrUnexpected, msg)
+		}
+	}()
+	return w.Run(ctx)
+}
+
+const (
+	// minBackoff and maxBackoff bound the delay before restarting a worker.
+	minBackoff = time.Second
+	maxBackoff = time.Minute
+)
+
+var (
+	running = metrics.NewGauge(
+		"background_workers_running",
+		"Whether the background worker is currently running.",
+		"worker",
+	)
+	restarts = metrics.NewCounter(
+		"background_worker_restarts_total",
+		"Number of times the background worker was restarted.",
+		"worker",
+	)
+	failures = metrics.NewCounter(
+		"background_worker_failures_total",
+		"Number of times the background worker failed.",
+		"worker",
+	)
+)
@@ -0,0 +1,95 @@
+package workers
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+)
+
+func TestSupervise(t *testing.T) {
+	tests := []struct {
+		name        string
+		policy      RestartPolicy
+		result      func() error
+		wantRestart bool
+	}{
+		{"on failure, failed", RestartOnFailure, func() error { return errors.New("failed") }, true},
+		{"on failure, panicked", RestartOnFailure, func() error { panic("boom") }, true},
+		{"on failure, finished", RestartOnFailure, func() error { return nil }, false},
+		{"always, finished", RestartAlways, func() error { return nil }, true},
+		{"never, failed", RestartNever, func() error { return errors.New("failed") }, false},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel() // the restarts back off for a second
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			var runs atomic.Int32
+			restarted := make(chan struct{})
+			s := Supervise(ctx, Worker{
+				Name:    tt.name,
+				Restart: tt.policy,
+				Run: func(ctx context.Context) error {
+					if runs.Add(1) == 1 {
+						return tt.result()
+					}
+					close(restarted)
+					<-ctx.Done()
+					return nil
+				},
+			})
+
+			finished := make(chan struct{})
+			go func() {
+				s.Wait()
+				close(finished)
+			}()
+			select {
+			case <-restarted:
+				if !tt.wantRestart {
+					t.Error("got the worker restarted, want it finished")
+				}
+				if st := s.Status()[0]; st.Restarts != 1 || !st.Running {
+					t.Errorf("got status %+v, want one restart and running", st)
+				}
+			case <-finished:
+				if tt.wantRestart {
+					t.Error("got the worker finished, want it restarted")
+				}
+			}
+			cancel()
+			if !s.Drain(time.Second) {
+				t.Error("got the worker running after the drain")
+			}
+		})
+	}
+}
+
+func TestSupervisorDrainTimeout(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stuck := make(chan struct{})
+	defer close(stuck)
+	s := Supervise(ctx, Worker{
+		Name: "stuck",
+		Run: func(context.Context) error {
+			<-stuck // ignores the cancellation
+			return nil
+		},
+	})
+	clk := servicetest.NewFakeClock(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC))
+	s.UseClock(clk)
+	cancel()
+	drained := make(chan bool)
+	go func() { drained <- s.Drain(time.Minute) }()
+	clk.WaitForTimers(1)
+	clk.Advance(time.Minute)
+	if <-drained {
+		t.Error("got the drain completed, want it timed out")
+	}
+}
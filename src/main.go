@@ -1,11 +1,287 @@
 package main
 
-import "github.com/eventscompass/service-framework/service"
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/eventscompass/service-framework/service"
+	"google.golang.org/grpc"
+
+	"github.com/eventscompass/service-template/src/internal/admin"
+	"github.com/eventscompass/service-template/src/internal/autotune"
+	"github.com/eventscompass/service-template/src/internal/chaos"
+	"github.com/eventscompass/service-template/src/internal/cli"
+	"github.com/eventscompass/service-template/src/internal/clientip"
+	"github.com/eventscompass/service-template/src/internal/di"
+	"github.com/eventscompass/service-template/src/internal/discovery"
+	"github.com/eventscompass/service-template/src/internal/health"
+	"github.com/eventscompass/service-template/src/internal/info"
+	"github.com/eventscompass/service-template/src/internal/introspect"
+	"github.com/eventscompass/service-template/src/internal/jobs"
+	"github.com/eventscompass/service-template/src/internal/leader"
+	"github.com/eventscompass/service-template/src/internal/lifecycle"
+	"github.com/eventscompass/service-template/src/internal/listen"
+	"github.com/eventscompass/service-template/src/internal/metrics"
+	"github.com/eventscompass/service-template/src/internal/middleware"
+	"github.com/eventscompass/service-template/src/internal/rabbitmq"
+	"github.com/eventscompass/service-template/src/internal/requestid"
+	"github.com/eventscompass/service-template/src/internal/stream"
+	"github.com/eventscompass/service-template/src/internal/tracing"
+	"github.com/eventscompass/service-template/src/internal/workers"
+)
 
 type ServiceName struct {
 	service.BaseService
+
+	// Deps builds the components of the service, and closes them
+	// once the service stops. Tests override components before
+	// Init, see di.Override. Nil creates an empty container.
+	Deps *di.Container
+
+	// workers supervises the background workers of the service.
+	workers *workers.Supervisor
+
+	// scheduler runs the scheduled jobs of the service.
+	scheduler *jobs.Scheduler
+
+	// admin serves the internal endpoints of the service, e.g.
+	// its readiness.
+	admin *admin.Server
+
+	// bus is the message bus of the service, nil if none is
+	// configured.
+	bus service.MessageBus
+
+	// tracer exports the spans of the service, see the tracing
+	// package.
+	tracer *tracing.Provider
+
+	// clientIP resolves the client address of the requests, see
+	// the clientip package.
+	clientIP *clientip.Resolver
+
+	// rest and grpc are the servers returned by REST and GRPC. The
+	// apis of the service are registered on grpc on Init.
+	rest http.Handler
+	grpc *grpc.Server
+
+	cfg Config
+}
+
+var (
+	_ service.CloudService = (*ServiceName)(nil)
+	_ lifecycle.Shutdowner = (*ServiceName)(nil)
+	_ middleware.Stacker   = (*ServiceName)(nil)
+)
+
+// Init implements the [service.CloudService] interface.
+func (s *ServiceName) Init(ctx context.Context) error {
+	if err := parseEnv(&s.cfg); err != nil {
+		return fmt.Errorf("%w: parse environment variables: %v", service.ErrBadRequest, err)
+	}
+	// The components register their readiness checks in the registry of
+	// ctx, which is served by the admin server of the service.
+	ready, ok := health.RegistryFrom(ctx)
+	if !ok {
+		ready = health.NewRegistry()
+		ctx = health.WithRegistry(ctx, ready)
+	}
+	s.admin = admin.New(s.cfg.Admin, ready)
+	s.admin.RegisterControl()
+	if s.Deps == nil {
+		s.Deps = di.New()
+	}
+	// Attach the pod metadata to the telemetry before anything is logged.
+	instance := info.Detect()
+	info.Enrich(instance)
+	requestid.EnrichLogs()
+	autotune.Apply(s.cfg.Autotune)
+	tracer, err := tracing.Setup(ctx, s.cfg.Tracing, instance)
+	if err != nil {
+		return fmt.Errorf("init tracing: %w", err)
+	}
+	s.tracer = tracer
+
+	if err := chaos.Configure(s.cfg.Chaos); err != nil {
+		return fmt.Errorf("init fault injection: %w", err)
+	}
+	listen.Configure(s.cfg.Listen)
+	// Tests override the bus, e.g. with membus.New.
+	if bus, err := di.Get[service.MessageBus](ctx, s.Deps); err == nil {
+		s.bus = bus
+	}
+	if s.bus == nil && s.cfg.Bus.URL != "" {
+		bus, err := rabbitmq.Dial(ctx, s.cfg.Bus)
+		if err != nil {
+			return fmt.Errorf("init message bus: %w", err)
+		}
+		s.bus = chaos.Bus(bus)
+		if s.cfg.Bus.Buffer.Size > 0 {
+			s.bus = rabbitmq.NewBuffered(s.bus, s.cfg.Bus.Buffer)
+		}
+	}
+	s.clientIP, err = clientip.NewResolver(s.cfg.ClientIP)
+	if err != nil {
+		return fmt.Errorf("init client address resolution: %w", err)
+	}
+	grpcServer, err := newGRPCServer(s.cfg.GRPCTLS, s.clientIP)
+	if err != nil {
+		return fmt.Errorf("init grpc server: %w", err)
+	}
+	s.grpc = grpcServer
+	if err := s.initVenues(ctx); err != nil {
+		return err
+	}
+
+	scheduler, err := jobs.NewScheduler(s.cfg.Jobs, nil, s.Jobs()...)
+	if err != nil {
+		return fmt.Errorf("init jobs: %w", err)
+	}
+	locker, identity, err := jobLocker(instance)
+	if err != nil {
+		return fmt.Errorf("init jobs: %w", err)
+	}
+	scheduler.UseLocker(locker, identity)
+	s.scheduler = scheduler
+	s.admin.Handle("/jobs", admin.JSON(s.backgroundStatus))
+	s.admin.Handle("/introspect", introspect.Handler(s, s.cfg, ready))
+	s.admin.Handle("/info", info.Handler(instance))
+	metrics.Register(append(s.Collectors(), metrics.RuntimeCollector())...)
+	s.admin.Handle("/metrics", metrics.Handler())
+	s.admin.Handle("/healthz", health.Liveness)
+	s.admin.Handle("/readyz", ready)
+
+	// The context is cancelled once the service receives a stop signal,
+	// which stops the workers.
+	ws := append(s.Workers(),
+		s.admin.Worker(),
+		workers.Worker{Name: "scheduler", Run: s.scheduler.Run},
+	)
+	if h := s.Stream(); h != nil {
+		ws = append(ws, stream.Worker(s.cfg.Stream, h))
+	}
+	registrar, err := discovery.New(s.cfg.Discovery)
+	if err != nil {
+		return fmt.Errorf("init service registration: %w", err)
+	}
+	if registrar != nil {
+		inst, err := discovery.NewInstance(s.cfg.Discovery)
+		if err != nil {
+			return fmt.Errorf("init service registration: %w", err)
+		}
+		ws = append(ws, discovery.Worker(s.cfg.Discovery, registrar, inst))
+	}
+	s.workers = workers.Supervise(ctx, ws...)
+	return nil
+}
+
+// Shutdown implements the [lifecycle.Shutdowner] interface. It gives the
+// workers until ctx is done to return, flushes the messages they published,
+// closes the components of the service, and exports the remaining spans.
+func (s *ServiceName) Shutdown(ctx context.Context) error {
+	if s.workers != nil {
+		timeout := s.cfg.Lifecycle.ShutdownGracePeriod
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = time.Until(deadline)
+		}
+		s.workers.Drain(timeout)
+	}
+	var errs []error
+	if s.bus != nil {
+		if err := s.bus.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close message bus: %w", err))
+		}
+	}
+	if s.Deps != nil {
+		if err := s.Deps.Close(); err != nil {
+			errs = append(errs, fmt.Errorf("close components: %w", err))
+		}
+	}
+	if err := s.tracer.Shutdown(ctx); err != nil {
+		errs = append(errs, fmt.Errorf("shut down tracing: %w", err))
+	}
+	return errors.Join(errs...)
+}
+
+// Middleware implements the [middleware.Stacker] interface. It returns the
+// middleware wrapping the rest handler, the first being the outermost one.
+// Add the middleware of the service, e.g. auth.Middleware, after the tracing
+// and the metrics, so that the rejected requests are observed too.
+func (s *ServiceName) Middleware() []middleware.Middleware {
+	return []middleware.Middleware{
+		s.clientIP.Middleware(),
+		requestid.Middleware,
+		func(h http.Handler) http.Handler { return tracing.Handler(h, "rest") },
+		func(h http.Handler) http.Handler { return metrics.InstrumentHandler(h, "rest") },
+		middleware.Recover,
+		chaos.Middleware,
+		s.admin.DumpRequests,
+	}
+}
+
+// Workers returns the long-running background workers of the service. The
+// workers are started on Init and stopped when the service shuts down. Do not
+// start goroutines from Init directly, register a worker instead.
+func (s *ServiceName) Workers() []workers.Worker { return nil }
+
+// Stream returns the handler for the long-running routes of the service, e.g.
+// uploads and exports, which are served on the streaming listener instead of
+// the rest listener, see the stream package. Nil disables the listener.
+func (s *ServiceName) Stream() http.Handler { return nil }
+
+// Jobs returns the scheduled jobs of the service. The jobs are scheduled on
+// Init and stopped when the service shuts down. Singleton jobs are run by one
+// replica per tick, which inside the cluster requires the service account to
+// manage leases, see leader.LeaseLocker.
+func (s *ServiceName) Jobs() []jobs.ScheduledJob { return nil }
+
+// Collectors returns the collectors of the custom metrics of the service,
+// which are run whenever the metrics are scraped from /metrics on the admin
+// listener, see the metrics package. Metrics updated as things happen are
+// registered with metrics.NewCounter and the like instead.
+func (s *ServiceName) Collectors() []metrics.Collector { return nil }
+
+// jobLocker returns the lock that the replicas compete for on every tick of
+// the singleton jobs, together with the identity of this replica: a lease
+// inside the cluster, and a lock in memory outside of it, where the service
+// runs as a single replica.
+func jobLocker(instance info.Info) (jobs.Locker, string, error) {
+	if instance.Kubernetes == nil {
+		return leader.NewMemoryLocker(), "local", nil
+	}
+	l, err := leader.NewLeaseLocker()
+	if err != nil {
+		return nil, "", fmt.Errorf("create lease locker: %w", err)
+	}
+	return l, instance.Kubernetes.Pod, nil
+}
+
+// backgroundStatus reports the state of the jobs and workers of the service.
+func (s *ServiceName) backgroundStatus() any {
+	return struct {
+		Jobs    []jobs.JobStatus       `json:"jobs"`
+		Workers []workers.WorkerStatus `json:"workers"`
+	}{s.scheduler.Status(), s.workers.Status()}
 }
 
 func main() {
-	service.Start(&ServiceName{})
+	s := &ServiceName{}
+	cli.Main(
+		cli.Command{Name: "serve", Summary: "Run the service.", Run: s.serve},
+		cli.Command{Name: "migrate", Summary: "Apply the database migrations.", Run: migrate},
+		cli.Command{
+			Name:    "check-config",
+			Summary: "Validate the configuration and print it.",
+			Run:     s.checkConfig,
+		},
+		cli.Command{Name: "version", Summary: "Print the build information.", Run: version},
+		cli.Command{
+			Name:    "routes",
+			Summary: "List the routes, grpc methods and subscriptions.",
+			Run:     s.routes,
+		},
+	)
 }
@@ -1 +1,7 @@
 package main
+
+import "net/http"
+
+// REST implements the [service.CloudService] interface. It returns the rest
+// api of the venues, see initVenues.
+func (s *ServiceName) REST() http.Handler { return s.rest }
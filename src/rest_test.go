@@ -1,3 +1,226 @@
 package main_test
 
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/eventscompass/service-framework/service"
+
+	eventsv1 "github.com/eventscompass/service-template/pkg/events/v1"
+	main "github.com/eventscompass/service-template/src"
+	"github.com/eventscompass/service-template/src/internal/chaos"
+	"github.com/eventscompass/service-template/src/internal/delivery"
+	"github.com/eventscompass/service-template/src/internal/di"
+	"github.com/eventscompass/service-template/src/internal/membus"
+	"github.com/eventscompass/service-template/src/internal/page"
+	"github.com/eventscompass/service-template/src/internal/requestid"
+	"github.com/eventscompass/service-template/src/internal/servicetest"
+	"github.com/eventscompass/service-template/src/internal/venues"
+)
+
 // This file should contain integration tests for the rest api of the service.
+// The tests of the venues, the reference module, go through the servers of
+// the service like production traffic does.
+
+func TestVenuesREST(t *testing.T) {
+	svc, bus := startVenues(t)
+	t.Run("lifecycle", func(t *testing.T) { testVenuesLifecycle(t, svc, bus) })
+	t.Run("errors", func(t *testing.T) { testVenuesErrors(t, svc) })
+	t.Run("request id", func(t *testing.T) { testVenuesRequestID(t, svc, bus) })
+}
+
+func TestServicesSideBySide(t *testing.T) {
+	// Every service has an admin server and readiness checks of its own,
+	// thus both become ready, also after the services of the other tests
+	// stopped, and keep their venues apart.
+	a, _ := startVenues(t)
+	b, _ := startVenues(t)
+	created := do[venues.Venue](t, a, http.MethodPost, "/venues",
+		`{"name": "Arena", "city": "Sofia", "capacity": 12000}`, http.StatusCreated)
+	resp := request(t, b, http.MethodGet, "/venues/"+created.ID, "")
+	servicetest.AssertHTTPResponse(t, resp, servicetest.ErrorResponse{Status: http.StatusNotFound})
+	for _, svc := range []*servicetest.Service{a, b} {
+		resp, err := svc.HTTP.Get("http://" + svc.AdminAddr + "/jobs")
+		if err != nil {
+			t.Fatalf("get jobs: %v", err)
+		}
+		resp.Body.Close() //nolint:errcheck,gosec // test
+		if resp.StatusCode != http.StatusOK {
+			t.Errorf("got status %d from /jobs of %s, want 200", resp.StatusCode, svc.AdminAddr)
+		}
+	}
+}
+
+func TestVenuesRESTMiddleware(t *testing.T) {
+	// The requests go through the fault injection of the service, which
+	// fails every request once enabled, after the request id is assigned.
+	t.Setenv(servicetest.EnvPrefix+"CHAOS_ENABLED", "true")
+	t.Setenv(servicetest.EnvPrefix+"CHAOS_ERROR_RATE", "1")
+	t.Cleanup(func() { chaos.Configure(chaos.Config{}) }) //nolint:errcheck // valid config
+	svc, _ := startVenues(t)
+	resp := request(t, svc, http.MethodGet, "/venues", "")
+	if resp.Header.Get(requestid.Header) == "" {
+		t.Errorf("got no %s header, want the request identified", requestid.Header)
+	}
+	servicetest.AssertHTTPResponse(t, resp, servicetest.ErrorResponse{
+		Status: http.StatusServiceUnavailable,
+		Body:   "injected fault",
+	})
+}
+
+// startVenues starts the service with the venues in memory, see newService.
+func startVenues(t *testing.T) (*servicetest.Service, *membus.Bus) {
+	t.Helper()
+	s, bus := newService()
+	return servicetest.Start(t, s), bus
+}
+
+// newService returns the service with the venues and their events kept in
+// memory, even if a database or a message bus is configured.
+func newService() (*main.ServiceName, *membus.Bus) {
+	s := &main.ServiceName{Deps: di.New()}
+	di.Override[venues.Repository](s.Deps, venues.NewMemoryRepository())
+	bus := membus.New()
+	di.Override[service.MessageBus](s.Deps, bus)
+	return s, bus
+}
+
+func testVenuesLifecycle(t *testing.T, svc *servicetest.Service, bus *membus.Bus) {
+	bus.Reset()
+	created := do[venues.Venue](t, svc, http.MethodPost, "/venues",
+		`{"name": "Arena", "city": "Sofia", "capacity": 12000}`, http.StatusCreated)
+	if created.ID == "" || created.CreatedAt.IsZero() {
+		t.Fatalf("create: got %+v, want an id and a creation time", created)
+	}
+
+	got := do[venues.Venue](t, svc, http.MethodGet, "/venues/"+created.ID, "", http.StatusOK)
+	if got != created {
+		t.Errorf("get: got %+v, want %+v", got, created)
+	}
+
+	updated := do[venues.Venue](t, svc, http.MethodPut, "/venues/"+created.ID,
+		`{"name": "Arena", "city": "Sofia", "capacity": 15000}`, http.StatusOK)
+	if updated.Capacity != 15000 || !updated.CreatedAt.Equal(created.CreatedAt) {
+		t.Errorf("update: got %+v, want the capacity updated", updated)
+	}
+
+	list := do[page.Page[venues.Venue]](t, svc, http.MethodGet, "/venues?limit=10", "", http.StatusOK)
+	if len(list.Items) != 1 || list.Items[0].ID != created.ID {
+		t.Errorf("list: got %+v, want the created venue", list.Items)
+	}
+	list = do[page.Page[venues.Venue]](t, svc, http.MethodGet, "/venues?filter=city:eq:Sofia,capacity:ge:15000", "", http.StatusOK)
+	if len(list.Items) != 1 || list.Items[0].ID != created.ID {
+		t.Errorf("filter: got %+v, want the created venue", list.Items)
+	}
+	list = do[page.Page[venues.Venue]](t, svc, http.MethodGet, "/venues?filter=city:eq:Plovdiv", "", http.StatusOK)
+	if len(list.Items) != 0 {
+		t.Errorf("filter: got %+v, want no venues", list.Items)
+	}
+
+	do[struct{}](t, svc, http.MethodDelete, "/venues/"+created.ID, "", http.StatusNoContent)
+	resp := request(t, svc, http.MethodGet, "/venues/"+created.ID, "")
+	servicetest.AssertHTTPResponse(t, resp, servicetest.ErrorResponse{Status: http.StatusNotFound})
+
+	// Created, updated and deleted.
+	if got := bus.Published(eventsv1.TopicVenues); len(got) != 3 {
+		t.Errorf("events: got %d venue events, want 3", len(got))
+	}
+}
+
+func testVenuesErrors(t *testing.T, svc *servicetest.Service) {
+	tests := []struct {
+		name, method, path, body string
+		want                     servicetest.ErrorResponse
+	}{
+		{"malformed body", http.MethodPost, "/venues", `{`, servicetest.ErrorResponse{Status: http.StatusBadRequest}},
+		{"missing name", http.MethodPost, "/venues", `{"city": "Sofia", "capacity": 1}`,
+			servicetest.ErrorResponse{Status: http.StatusBadRequest, Body: "name is required"}},
+		{"no capacity", http.MethodPost, "/venues", `{"name": "Arena", "city": "Sofia"}`,
+			servicetest.ErrorResponse{Status: http.StatusBadRequest, Body: "capacity"}},
+		{"malformed cursor", http.MethodGet, "/venues?cursor=x", "",
+			servicetest.ErrorResponse{Status: http.StatusBadRequest, Body: "cursor"}},
+		{"unknown filter field", http.MethodGet, "/venues?filter=owner:eq:x", "",
+			servicetest.ErrorResponse{Status: http.StatusBadRequest, Body: "cannot filter by"}},
+		{"unsortable field", http.MethodGet, "/venues?sort=name", "",
+			servicetest.ErrorResponse{Status: http.StatusBadRequest, Body: "cannot sort by"}},
+		{"unknown venue", http.MethodGet, "/venues/unknown", "", servicetest.ErrorResponse{Status: http.StatusNotFound}},
+		{"update unknown venue", http.MethodPut, "/venues/unknown", `{"name": "Arena", "city": "Sofia", "capacity": 1}`,
+			servicetest.ErrorResponse{Status: http.StatusNotFound}},
+		{"method", http.MethodPatch, "/venues", "", servicetest.ErrorResponse{
+			Status: http.StatusMethodNotAllowed,
+			Header: http.Header{"Allow": {"GET, POST"}},
+		}},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			resp := request(t, svc, tt.method, tt.path, tt.body)
+			servicetest.AssertHTTPResponse(t, resp, tt.want)
+		})
+	}
+}
+
+func testVenuesRequestID(t *testing.T, svc *servicetest.Service, bus *membus.Bus) {
+	bus.Reset()
+	req, err := http.NewRequest(http.MethodPost, svc.URL("/venues"),
+		strings.NewReader(`{"name": "Arena", "city": "Sofia", "capacity": 12000}`))
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set(requestid.Header, "req-1")
+	resp, err := svc.HTTP.Do(req)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	resp.Body.Close() //nolint:errcheck,gosec // intentional
+	if got := resp.Header.Get(requestid.Header); got != "req-1" {
+		t.Errorf("create: got request id %q, want %q", got, "req-1")
+	}
+	events := bus.Messages()
+	if len(events) != 1 || events[0].Headers[delivery.HeaderCorrelationID] != "req-1" {
+		t.Errorf("create: got events %+v, want one correlated with the request", events)
+	}
+
+	// Requests without an id get a new one.
+	resp = request(t, svc, http.MethodGet, "/venues", "")
+	resp.Body.Close() //nolint:errcheck,gosec // intentional
+	if got := resp.Header.Get(requestid.Header); !requestid.Valid(got) {
+		t.Errorf("list: got request id %q, want a generated one", got)
+	}
+}
+
+// request sends a json request to the rest server of the service.
+func request(t *testing.T, svc *servicetest.Service, method, path, body string) *http.Response {
+	t.Helper()
+	req, err := http.NewRequest(method, svc.URL(path), strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := svc.HTTP.Do(req)
+	if err != nil {
+		t.Fatalf("%s %s: %v", method, path, err)
+	}
+	return resp
+}
+
+// do sends a json request to the rest server of the service, checks the status
+// of the response and decodes its body, if any.
+func do[T any](t *testing.T, svc *servicetest.Service, method, path, body string, status int) T {
+	t.Helper()
+	resp := request(t, svc, method, path, body)
+	defer resp.Body.Close() //nolint:errcheck // intentional
+
+	var v T
+	if resp.StatusCode != status {
+		t.Fatalf("%s %s: got status %d, want %d", method, path, resp.StatusCode, status)
+	}
+	if status != http.StatusNoContent {
+		if err := json.NewDecoder(resp.Body).Decode(&v); err != nil {
+			t.Fatalf("%s %s: decode the response: %v", method, path, err)
+		}
+	}
+	return v
+}
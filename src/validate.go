@@ -0,0 +1,142 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/eventscompass/service-framework/service"
+
+	"github.com/eventscompass/service-template/src/internal/discovery"
+	"github.com/eventscompass/service-template/src/internal/jobs"
+	"github.com/eventscompass/service-template/src/internal/rabbitmq"
+	"github.com/eventscompass/service-template/src/internal/store"
+	"github.com/eventscompass/service-template/src/internal/tlsconfig"
+)
+
+// dryRun parses the flags of serve, and returns whether the service is only
+// validated instead of run, and whether the dependencies are probed too:
+//
+//	serve -validate          # or SERVICE_DRY_RUN=true
+//	serve -validate -probe   # or SERVICE_DRY_RUN=probe
+//
+// This function returns [service.ErrBadRequest] in case the flags or
+// SERVICE_DRY_RUN are malformed.
+func dryRun(args []string) (validate, probe bool, err error) {
+	fs := flag.NewFlagSet("serve", flag.ContinueOnError)
+	fs.BoolVar(&validate, "validate", false, "validate the configuration, print a report and exit")
+	fs.BoolVar(&probe, "probe", false,
+		"with -validate, also connect to the message bus and the database")
+	if err := fs.Parse(args); err != nil {
+		return false, false, fmt.Errorf("%w: %v", service.ErrBadRequest, err)
+	}
+	switch v := os.Getenv("SERVICE_DRY_RUN"); v {
+	case "":
+	case "probe":
+		return true, true, nil
+	default:
+		on, err := strconv.ParseBool(v)
+		if err != nil {
+			return false, false, fmt.Errorf("%w: SERVICE_DRY_RUN must be a boolean or probe, got %q",
+				service.ErrBadRequest, v)
+		}
+		validate = validate || on
+	}
+	return validate, validate && probe, nil
+}
+
+// validate checks the configuration of the service without running it, so that
+// CI and operators catch misconfiguration before rolling out a release. With
+// probe, the message bus and the database are connected to as well. Every
+// check is run, even if a previous one failed, and the report is written to
+// w. This function returns [service.ErrBadRequest] in case a check failed.
+func (s *ServiceName) validate(ctx context.Context, w io.Writer, probe bool) error {
+	var storeCfg store.Config
+	checks := []check{
+		{"config", func(context.Context) error { return parseEnv(&s.cfg) }},
+		{"database config", func(context.Context) error {
+			if os.Getenv(envPrefix+"DATABASE_DSN") == "" {
+				return errSkipped // kept in memory
+			}
+			return parseEnv(&storeCfg)
+		}},
+		{"jobs", func(context.Context) error {
+			_, err := jobs.NewScheduler(s.cfg.Jobs, nil, s.Jobs()...)
+			return err //nolint:wrapcheck // reported as is
+		}},
+		{"discovery", func(context.Context) error {
+			if s.cfg.Discovery.Backend == "" {
+				return errSkipped
+			}
+			if _, err := discovery.New(s.cfg.Discovery); err != nil {
+				return err //nolint:wrapcheck // reported as is
+			}
+			_, err := discovery.NewInstance(s.cfg.Discovery)
+			return err //nolint:wrapcheck // reported as is
+		}},
+		{"grpc tls", func(context.Context) error {
+			if s.cfg.GRPCTLS == (tlsconfig.Config{}) {
+				return errSkipped
+			}
+			_, err := tlsconfig.Server(s.cfg.GRPCTLS)
+			return err //nolint:wrapcheck // reported as is
+		}},
+		{"message bus", func(ctx context.Context) error {
+			if s.cfg.Bus.URL == "" {
+				return errSkipped
+			}
+			if err := s.cfg.Bus.Validate(); err != nil || !probe {
+				return err //nolint:wrapcheck // reported as is
+			}
+			bus, err := rabbitmq.Dial(ctx, s.cfg.Bus)
+			if err != nil {
+				return err //nolint:wrapcheck // reported as is
+			}
+			return bus.Close() //nolint:wrapcheck // reported as is
+		}},
+		{"database", func(ctx context.Context) error {
+			if storeCfg.DSN == "" || !probe {
+				return errSkipped
+			}
+			db, err := store.Open(ctx, storeCfg)
+			if err != nil {
+				return err //nolint:wrapcheck // reported as is
+			}
+			return db.Close() //nolint:wrapcheck // reported as is
+		}},
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	failed := 0
+	for _, c := range checks {
+		switch err := c.run(ctx); {
+		case errors.Is(err, errSkipped):
+			fmt.Fprintf(tw, "skip\t%s\n", c.name)
+		case err != nil:
+			failed++
+			fmt.Fprintf(tw, "FAIL\t%s\t%v\n", c.name, err)
+		default:
+			fmt.Fprintf(tw, "ok\t%s\n", c.name)
+		}
+	}
+	tw.Flush() //nolint:errcheck,gosec // best effort
+	if failed > 0 {
+		return fmt.Errorf("%w: %d of %d checks failed", service.ErrBadRequest, failed, len(checks))
+	}
+	return nil
+}
+
+// check is a named check of [ServiceName.validate].
+type check struct {
+	name string
+	run  func(ctx context.Context) error
+}
+
+// errSkipped is returned by the checks that do not apply, e.g. the probes
+// without -probe.
+var errSkipped = errors.New("skipped")
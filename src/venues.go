@@ -0,0 +1,59 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"os"
+
+	"github.com/eventscompass/service-framework/service"
+	_ "github.com/lib/pq" // the postgres driver of the store
+
+	apiv1 "github.com/eventscompass/service-template/pkg/api/v1"
+	"github.com/eventscompass/service-template/src/internal/di"
+	"github.com/eventscompass/service-template/src/internal/store"
+	"github.com/eventscompass/service-template/src/internal/venues"
+)
+
+// initVenues wires the venues, the reference module of the template, into the
+// rest and grpc servers of the service. The venues are stored in postgres if
+// DATABASE_DSN is set, and in memory otherwise, e.g. for local runs. The
+// components are built by the container of the service, thus tests override
+// them, e.g. the repository, with di.Override. Replace the module with the
+// modules of the service.
+func (s *ServiceName) initVenues(ctx context.Context) error {
+	di.Provide(s.Deps, func(ctx context.Context) (*sql.DB, error) {
+		var cfg store.Config
+		if err := parseEnv(&cfg); err != nil {
+			return nil, fmt.Errorf("%w: parse database configuration: %v", service.ErrBadRequest, err)
+		}
+		return store.Open(ctx, cfg) //nolint:wrapcheck // wrapped by the container
+	})
+	di.Provide(s.Deps, func(ctx context.Context) (venues.Repository, error) {
+		if os.Getenv(envPrefix+"DATABASE_DSN") == "" {
+			slog.WarnContext(ctx, "DATABASE_DSN is not set, keeping the venues in memory")
+			return venues.NewMemoryRepository(), nil
+		}
+		db, err := di.Get[*sql.DB](ctx, s.Deps)
+		if err != nil {
+			return nil, err
+		}
+		return venues.NewSQLRepository(db), nil
+	})
+	di.Provide(s.Deps, func(ctx context.Context) (*venues.Service, error) {
+		repo, err := di.Get[venues.Repository](ctx, s.Deps)
+		if err != nil {
+			return nil, err
+		}
+		return venues.NewService(repo, s.bus), nil
+	})
+
+	svc, err := di.Get[*venues.Service](ctx, s.Deps)
+	if err != nil {
+		return fmt.Errorf("init venues: %w", err)
+	}
+	s.rest = venues.NewHandler(svc, s.cfg.Page)
+	apiv1.RegisterVenuesServiceServer(s.grpc, venues.NewGRPCServer(svc, s.cfg.Page))
+	return nil
+}